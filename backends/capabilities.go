@@ -11,6 +11,11 @@ type Capabilities struct {
 	// DTypes list the data types supported by a backend.
 	// If not listed, it's assumed to be false, hence not supported.
 	DTypes map[dtypes.DType]bool
+
+	// DynamicShapes indicates that the backend compiles graphs whose parameters have dynamic dimensions
+	// (shapes.DynamicDim, see shapes.MakeDynamic), and executes them with inputs of any size on those axes.
+	// It may still return an error when building or compiling operations it doesn't support with dynamic shapes.
+	DynamicShapes bool
 }
 
 // Clone makes a deep copy of the Capabilities.
@@ -24,5 +29,6 @@ func (c Capabilities) Clone() Capabilities {
 	for k, v := range c.DTypes {
 		c2.DTypes[k] = v
 	}
+	c2.DynamicShapes = c.DynamicShapes
 	return c2
 }
@@ -0,0 +1,13 @@
+package backends
+
+// StableHLOExporter is an optional interface implemented by the Builder of backends that use StableHLO to
+// represent computations (e.g.: "stablehlo").
+//
+// It is used by graph.Graph.ExportStableHLO, by casting the Builder to this interface.
+type StableHLOExporter interface {
+	// ExportStableHLO finishes the computation with the given outputs and returns the StableHLO program
+	// (MLIR text format), instead of compiling it.
+	//
+	// The Builder shouldn't be used afterward.
+	ExportStableHLO(outputs ...Op) ([]byte, error)
+}
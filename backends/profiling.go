@@ -0,0 +1,36 @@
+package backends
+
+import (
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+)
+
+// OpProfile is the profile of the execution of one op of a computation, see ProfilingExecutable.
+type OpProfile struct {
+	// Op is the op (as returned by the Builder) executed.
+	Op Op
+
+	// OpType of the op executed.
+	OpType OpType
+
+	// InputShapes and OutputShapes of the op.
+	InputShapes, OutputShapes []shapes.Shape
+
+	// Start and Duration (wall time) of the execution of the op.
+	Start    time.Time
+	Duration time.Duration
+
+	// BytesAllocated by the op for its outputs: it is 0 if the op reused (in-place) the buffer of one of its inputs.
+	BytesAllocated uintptr
+}
+
+// ProfilingExecutable is an optional interface implemented by the Executable of backends that can profile
+// the execution of the individual ops of a computation (e.g.: "go", the SimpleGo backend).
+//
+// It is used by graph.Exec when profiling is enabled, by casting the Executable to this interface.
+type ProfilingExecutable interface {
+	// ExecuteProfiled executes the computation as Executable.Execute, and also returns the profile of each
+	// op executed, in no particular order.
+	ExecuteProfiled(inputs []Buffer, donate []bool) ([]Buffer, []OpProfile, error)
+}
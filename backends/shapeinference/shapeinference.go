@@ -9,6 +9,12 @@
 // like Reshape, etc.
 //
 // For the remainder ops, it defines one function per OpType.
+//
+// Dynamic dimensions (shapes.DynamicDim, see shapes.MakeDynamic) stand for one symbolic dimension, the same for all
+// the dynamic axes of a graph. They are propagated by the element-wise operations (including broadcasting), Where,
+// Reshape, Transpose, BroadcastInDim, Reduce*, ArgMinMax and Concatenate (on a static axis). A dynamic dimension
+// only matches another dynamic dimension, or a dimension 1 when broadcasting.
+// The other operations return an error for dynamic shapes, or don't support them.
 package shapeinference
 
 import (
@@ -227,6 +233,8 @@ func binaryOpImpl(opType backends.OpType, lhsShape, rhsShape shapes.Shape) (outp
 	}
 
 	// Other cases, either the dimensions match or one of them is 1.
+	// A dynamic dimension only matches another dynamic dimension (or 1), since any other dimension would only
+	// match for one value of it.
 	if lhsShape.Rank() != rhsShape.Rank() {
 		err = errors.Errorf("if operands are not scalars, their rank must match for BinaryOp (%s), got shapes %s and %s",
 			opType, lhsShape, rhsShape)
@@ -236,12 +244,16 @@ func binaryOpImpl(opType backends.OpType, lhsShape, rhsShape shapes.Shape) (outp
 	for axis := range output.Rank() {
 		lhsDim := lhsShape.Dimensions[axis]
 		rhsDim := rhsShape.Dimensions[axis]
-		if lhsDim != 1 && rhsDim != 1 && lhsDim != rhsDim {
+		switch {
+		case lhsDim == rhsDim || rhsDim == 1:
+			output.Dimensions[axis] = lhsDim
+		case lhsDim == 1:
+			output.Dimensions[axis] = rhsDim
+		default:
 			err = errors.Errorf("dimension of axis #%d doesn't match and cannot be broadcast for BinaryOp (%s), got shapes %s and %s",
 				axis, opType, lhsShape, rhsShape)
 			return
 		}
-		output.Dimensions[axis] = max(lhsDim, rhsDim)
 	}
 	return
 }
@@ -356,8 +368,19 @@ func WhereOp(condition, onTrue, onFalse shapes.Shape) (output shapes.Shape, err
 // ReshapeOp to the given dimensions: trivial output shape, but this function also checks
 // that the sizes are the same.
 //
-// Notice the backends.Reshape doesn't support auto-scaling dimensions (set to -1), as graph.Reshape does.
+// Notice the backends.Reshape doesn't support auto-scaling dimensions (set to -1), as graph.Reshape does:
+// here -1 is shapes.DynamicDim, and the operand must have as many dynamic axes as dims.
 func ReshapeOp(operand shapes.Shape, dims []int) (output shapes.Shape, err error) {
+	if operand.IsDynamic() || slices.Contains(dims, shapes.DynamicDim) {
+		// The sizes must match for any value of the dynamic dimension.
+		output = shapes.MakeDynamic(operand.DType, dims...)
+		if len(operand.DynamicAxes()) != len(output.DynamicAxes()) || staticSize(operand) != staticSize(output) {
+			err = errors.Errorf("Reshape() cannot reshape %s to dimensions %v, their size don't match for all values "+
+				"of the dynamic dimension", operand, dims)
+			return shapes.Invalid(), err
+		}
+		return
+	}
 	output = shapes.Make(operand.DType, dims...)
 	if operand.Size() != output.Size() {
 		err = errors.Errorf("Reshape() cannot reshape %s to dimensions %v, their size don't match",
@@ -641,6 +664,10 @@ func ConcatenateOp(inputs []shapes.Shape, axis int) (output shapes.Shape, err er
 
 		for d := 0; d < rank; d++ {
 			if d == axis {
+				if output.Dimensions[d] == shapes.DynamicDim || currentShape.Dimensions[d] == shapes.DynamicDim {
+					return shapes.Invalid(), errors.Errorf("ConcatenateOp of dynamic shapes %s and %s on the "+
+						"dynamic axis %d is not supported", firstShape, currentShape, axis)
+				}
 				output.Dimensions[d] += currentShape.Dimensions[d]
 			} else {
 				if currentShape.Dimensions[d] != output.Dimensions[d] {
@@ -805,7 +832,7 @@ func ArgMinMaxOp(operand shapes.Shape, axis int, outputDType dtypes.DType) (outp
 	}
 	newDims := slices.Clone(operand.Dimensions)
 	newDims = slices.Delete(newDims, axis, axis+1)
-	output = shapes.Make(outputDType, newDims...)
+	output = shapes.MakeDynamic(outputDType, newDims...)
 	return
 }
 
@@ -1101,3 +1128,14 @@ func ConvGeneralOp(input, kernel shapes.Shape, axes backends.ConvolveAxesConfig,
 
 	return output, nil
 }
+
+// staticSize returns the product of the static dimensions of the shape, ignoring the dynamic ones.
+func staticSize(shape shapes.Shape) int {
+	size := 1
+	for _, dim := range shape.Dimensions {
+		if dim != shapes.DynamicDim {
+			size *= dim
+		}
+	}
+	return size
+}
@@ -80,6 +80,44 @@ func TestBinaryOp(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestDynamicShapes(t *testing.T) {
+	D := shapes.DynamicDim
+	dynamic := shapes.MakeDynamic(F32, D, 3)
+
+	// Broadcasting with dynamic dimensions.
+	require.Equal(t, "(Float32)[? 3]", must1(BinaryOp(OpTypeAdd, dynamic, S(F32, 1, 3))).String())
+	require.Equal(t, "(Float32)[? 3]", must1(BinaryOp(OpTypeAdd, S(F32, 1, 3), dynamic)).String())
+	require.Equal(t, "(Float32)[? 3]", must1(BinaryOp(OpTypeAdd, dynamic, dynamic)).String())
+	require.Equal(t, "(Bool)[? 3]", must1(ComparisonOp(OpTypeLessThan, dynamic, S(F32))).String())
+	_, err := BinaryOp(OpTypeAdd, dynamic, S(F32, 5, 3))
+	require.Error(t, err, "a dynamic dimension only matches another dynamic dimension or 1")
+	_, err = BinaryOp(OpTypeAdd, dynamic, S(F32, 1, 4))
+	require.Error(t, err)
+
+	// Other ops.
+	require.Equal(t, "(Float32)[? 3]", must1(UnaryOp(OpTypeExp, dynamic)).String())
+	require.Equal(t, "(Float32)[3 ?]", must1(TransposeOp(dynamic, []int{1, 0})).String())
+	require.Equal(t, "(Float32)[?]", must1(ReduceOp(dynamic, []int{1})).String())
+	require.Equal(t, "(Float32)[3]", must1(ReduceOp(dynamic, []int{0})).String())
+	require.Equal(t, "(Int32)[?]", must1(ArgMinMaxOp(dynamic, 1, dtypes.Int32)).String())
+	require.Equal(t, "(Float32)[? 6]", must1(ConcatenateOp([]shapes.Shape{dynamic, dynamic}, 1)).String())
+	_, err = ConcatenateOp([]shapes.Shape{dynamic, S(F32, 2, 3)}, 0)
+	require.Error(t, err)
+	require.Equal(t, "(Float32)[? 3]", must1(WhereOp(shapes.MakeDynamic(dtypes.Bool, D, 3), dynamic, S(F32))).String())
+	require.NoError(t, BroadcastInDimOp(S(F32, 1, 3), dynamic, []int{0, 1}))
+	require.Error(t, BroadcastInDimOp(S(F32, 2, 3), dynamic, []int{0, 1}))
+
+	// Reshape must keep the dynamic axes and the size of the static ones.
+	require.Equal(t, "(Float32)[? 3 1]", must1(ReshapeOp(dynamic, []int{D, 3, 1})).String())
+	require.Equal(t, "(Float32)[1 ?]", must1(ReshapeOp(shapes.MakeDynamic(F32, D, 1), []int{1, D})).String())
+	_, err = ReshapeOp(dynamic, []int{3, 2})
+	require.Error(t, err)
+	_, err = ReshapeOp(dynamic, []int{D, 6})
+	require.Error(t, err)
+	_, err = ReshapeOp(S(F32, 2, 3), []int{D, 3})
+	require.Error(t, err)
+}
+
 func TestUnaryOp(t *testing.T) {
 	// Invalid data types check.
 	require.Panics(t, func() { must1(UnaryOp(OpTypeLogicalNot, S(F32))) })
@@ -56,8 +56,14 @@ func (b *Builder) Compile(outputs ...backends.Op) (backends.Executable, error) {
 			return nil, errors.Errorf("%s node %q is internal (with multiple-outputs) and cannot be used for output", b.Name(), node.opType)
 		}
 	}
+	isDynamic, err := b.checkDynamicShapes()
+	if err != nil {
+		return nil, err
+	}
 	b.compiled = true
-	return newExecutable(b), nil
+	e := newExecutable(b)
+	e.isDynamic = isDynamic
+	return e, nil
 }
 
 // Finalize immediately release the resources associated with the Builder.
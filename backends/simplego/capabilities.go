@@ -68,40 +68,42 @@ var Capabilities = backends.Capabilities{
 		backends.OpTypeLessThan:       true,
 
 		// Other operations:
-		backends.OpTypeArgMinMax:        true,
-		backends.OpTypeBroadcast:        true,
-		backends.OpTypeBroadcastInDim:   true,
-		backends.OpTypeConcatenate:      true,
-		backends.OpTypeConvertDType:     true,
-		backends.OpTypeDot:              true,
-		backends.OpTypeDotGeneral:       true,
-		backends.OpTypeGather:           true,
-		backends.OpTypeIdentity:         true,
-		backends.OpTypeIota:             true,
-		backends.OpTypeReduceBitwiseAnd: true,
-		backends.OpTypeReduceBitwiseOr:  true,
-		backends.OpTypeReduceBitwiseXor: true,
-		backends.OpTypeReduceLogicalAnd: true,
-		backends.OpTypeReduceLogicalOr:  true,
-		backends.OpTypeReduceLogicalXor: true,
-		backends.OpTypeReduceMax:        true,
-		backends.OpTypeReduceMin:        true,
-		backends.OpTypeReduceProduct:    true,
-		backends.OpTypeReduceSum:        true,
-		backends.OpTypeReduceWindow:     true,
-		backends.OpTypeReshape:          true,
-		backends.OpTypeRngBitGenerator:  true,
-		backends.OpTypeScatterMax:       true,
-		backends.OpTypeScatterMin:       true,
-		backends.OpTypeScatterSum:       true,
-		backends.OpTypeSlice:            true,
-		backends.OpTypeTranspose:        true,
-		backends.OpTypeWhere:            true,
-		backends.OpTypeConvGeneral:      true,
+		backends.OpTypeArgMinMax:          true,
+		backends.OpTypeBroadcast:          true,
+		backends.OpTypeBroadcastInDim:     true,
+		backends.OpTypeConcatenate:        true,
+		backends.OpTypeConvertDType:       true,
+		backends.OpTypeDot:                true,
+		backends.OpTypeDotGeneral:         true,
+		backends.OpTypeGather:             true,
+		backends.OpTypeIdentity:           true,
+		backends.OpTypeIota:               true,
+		backends.OpTypeReduceBitwiseAnd:   true,
+		backends.OpTypeReduceBitwiseOr:    true,
+		backends.OpTypeReduceBitwiseXor:   true,
+		backends.OpTypeReduceLogicalAnd:   true,
+		backends.OpTypeReduceLogicalOr:    true,
+		backends.OpTypeReduceLogicalXor:   true,
+		backends.OpTypeReduceMax:          true,
+		backends.OpTypeReduceMin:          true,
+		backends.OpTypeReduceProduct:      true,
+		backends.OpTypeReduceSum:          true,
+		backends.OpTypeReduceWindow:       true,
+		backends.OpTypeReshape:            true,
+		backends.OpTypeRngBitGenerator:    true,
+		backends.OpTypeScatterMax:         true,
+		backends.OpTypeScatterMin:         true,
+		backends.OpTypeScatterSum:         true,
+		backends.OpTypeSlice:              true,
+		backends.OpTypeDynamicSlice:       true,
+		backends.OpTypeDynamicUpdateSlice: true,
+		backends.OpTypeTranspose:          true,
+		backends.OpTypeReverse:            true,
+		backends.OpTypePad:                true,
+		backends.OpTypeWhere:              true,
+		backends.OpTypeConvGeneral:        true,
 
 		// TODO: not implemented yet:
-		// backends.OpTypePad: true,
-		// backends.OpTypeReverse: true,
 		// backends.OpTypeSelectAndScatterMax: true,
 		// backends.OpTypeSelectAndScatterMin: true,
 		// backends.OpTypeSelectAndScatterSum: true,
@@ -109,8 +111,6 @@ var Capabilities = backends.Capabilities{
 		// backends.OpTypeShiftRightArithmetic: true,
 		// backends.OpTypeShiftRightLogical: true,
 		// backends.OpTypeBitcast: true,
-		// backends.OpTypeDynamicSlice: true,
-		// backends.OpTypeDynamicUpdateSlice: true,
 
 		// Lower priority ops:
 		// backends.OpTypeBatchNormForInference: true,
@@ -143,4 +143,7 @@ var Capabilities = backends.Capabilities{
 		dtypes.Float64:  true,
 		dtypes.BFloat16: true,
 	},
+
+	// See dynamicShapesOps for the operations that support dynamic shapes.
+	DynamicShapes: true,
 }
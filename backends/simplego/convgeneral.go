@@ -85,6 +85,8 @@ func (b *Builder) ConvGeneral(inputOp, kernelOp backends.Op, axes backends.Convo
 				kernelDilations[i] = 1
 			}
 		}
+	} else {
+		kernelDilations = xslices.SliceWithValue(spatialRank, 1)
 	}
 	params := &convNode{
 		axes:              axes.Clone(),
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"math/bits"
+	"slices"
 	"strings"
 
 	"github.com/gomlx/gopjrt/dtypes"
@@ -131,14 +132,70 @@ func (b *Builder) DotGeneral(lhsOp backends.Op, lhsContractingAxes, lhsBatchAxes
 		batchDims[ii] = lhs.shape.Dimensions[lhsAxis]
 	}
 
-	// Find sizes of the normalized operands ([batchSize, crossSize, contractSize]).
-	var lhsCrossDims, rhsCrossDims []int
-	params.batchSize, params.lhsCrossSize, params.contractingSize, lhsCrossDims = dgFindSizes(lhs.shape, lhsContractingAxes, lhsBatchAxes)
-	_, params.rhsCrossSize, _, rhsCrossDims = dgFindSizes(rhs.shape, rhsContractingAxes, rhsBatchAxes)
+	// Find the cross dimensions of the normalized operands ([batchSize, crossSize, contractSize]).
+	_, _, _, lhsCrossDims := dgFindSizes(lhs.shape, lhsContractingAxes, lhsBatchAxes)
+	_, _, _, rhsCrossDims := dgFindSizes(rhs.shape, rhsContractingAxes, rhsBatchAxes)
+	resultingDims := make([]int, 0, len(batchDims)+len(lhsCrossDims)+len(rhsCrossDims))
+	resultingDims = append(resultingDims, batchDims...)
+	resultingDims = append(resultingDims, lhsCrossDims...)
+	resultingDims = append(resultingDims, rhsCrossDims...)
+
+	if lhs.shape.IsDynamic() || rhs.shape.IsDynamic() {
+		// The sizes are only known at execution time, see specializeDotGeneral: the normalized output has a
+		// dynamic dimension for each group of axes with a dynamic axis.
+		if slices.Contains(contractingDims, shapes.DynamicDim) {
+			return nil, errors.Errorf("DotGeneral contracting axes cannot be dynamic: lhs=%s, rhs=%s", lhs.shape, rhs.shape)
+		}
+		dynamicOrSize := func(dims []int) int {
+			if slices.Contains(dims, shapes.DynamicDim) {
+				return shapes.DynamicDim
+			}
+			size := 1
+			for _, dim := range dims {
+				size *= dim
+			}
+			return size
+		}
+		dotGeneral := b.newNode(backends.OpTypeDotGeneral, shapes.MakeDynamic(dtype,
+			dynamicOrSize(batchDims), dynamicOrSize(lhsCrossDims), dynamicOrSize(rhsCrossDims)), lhs, rhs)
+		dotGeneral.data = &params
+
+		// The normalized output can't be validated by ReshapeOp, since its dynamic dimensions stand for
+		// the size of the group of axes.
+		return b.newNode(backends.OpTypeReshape, shapes.MakeDynamic(dtype, resultingDims...), dotGeneral), nil
+	}
+
+	// Create dot-general node: it will generate a normalized output [batchSize, lhsCrossSize, rhsCrossSize].
+	dotGeneralShape, err := params.setSizes(dtype, lhs.shape, rhs.shape)
+	if err != nil {
+		return nil, err
+	}
+	dotGeneral := b.newNode(backends.OpTypeDotGeneral, dotGeneralShape, lhs, rhs)
+	dotGeneral.data = &params
+
+	// Reshape result to recover batch and cross dimensions.
+	result, err := b.Reshape(dotGeneral, resultingDims...)
+
+	// fmt.Printf("DotGeneral(*lhs*: %s, c:%v, b:%v; *rhs*:  %s, c:%v, b:%v) -> %s\n",
+	//	lhs.shape, lhsContractingAxes, lhsBatchAxes, rhs.shape, rhsContractingAxes, rhsBatchAxes,
+	//	result.(*Node).shape)
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// setSizes sets the sizes of the normalized operands ([batchSize, crossSize, contractSize]) and their blocked
+// shapes, for the given static lhs and rhs shapes.
+// It returns the shape of the normalized output [batchSize, lhsCrossSize, rhsCrossSize].
+func (params *dotGeneralNodeData) setSizes(dtype dtypes.DType, lhsShape, rhsShape shapes.Shape) (shapes.Shape, error) {
+	params.batchSize, params.lhsCrossSize, params.contractingSize, _ = dgFindSizes(lhsShape, params.lhsContractingAxes, params.lhsBatchAxes)
+	_, params.rhsCrossSize, _, _ = dgFindSizes(rhsShape, params.rhsContractingAxes, params.rhsBatchAxes)
 
 	// Check that all sizes are positive
 	if params.batchSize <= 0 || params.lhsCrossSize <= 0 || params.contractingSize <= 0 || params.rhsCrossSize <= 0 {
-		return nil, errors.Errorf("DotGeneral sizes must be positive: lhs(batch=%d, cross=%d, contracting=%d), rhs(cross=%d)",
+		return shapes.Invalid(), errors.Errorf("DotGeneral sizes must be positive: lhs(batch=%d, cross=%d, contracting=%d), rhs(cross=%d)",
 			params.batchSize, params.lhsCrossSize, params.contractingSize,
 			params.rhsCrossSize)
 	}
@@ -153,26 +210,20 @@ func (b *Builder) DotGeneral(lhsOp backends.Op, lhsContractingAxes, lhsBatchAxes
 		outputDType = dtypes.Float32
 	}
 	params.outputBlockedShape = dgCreateBlockedShape(outputDType, params.batchSize, params.lhsCrossSize, params.rhsCrossSize, blockLog2Dim)
+	return shapes.Make(dtype, params.batchSize, params.lhsCrossSize, params.rhsCrossSize), nil
+}
 
-	// Create dot-general node: it will generate a normalized output [batchSize, lhsCrossSize, rhsCrossSize].
-	dotGeneral := b.newNode(backends.OpTypeDotGeneral, shapes.Make(dtype, params.batchSize, params.lhsCrossSize, params.rhsCrossSize), lhs, rhs)
-	dotGeneral.data = &params
-
-	// Reshape result to recover batch and cross dimensions.
-	resultingDims := make([]int, 0, len(batchDims)+len(lhsCrossDims)+len(rhsCrossDims))
-	resultingDims = append(resultingDims, batchDims...)
-	resultingDims = append(resultingDims, lhsCrossDims...)
-	resultingDims = append(resultingDims, rhsCrossDims...)
-	result, err := b.Reshape(dotGeneral, resultingDims...)
-
-	// fmt.Printf("DotGeneral(*lhs*: %s, c:%v, b:%v; *rhs*:  %s, c:%v, b:%v) -> %s\n",
-	//	lhs.shape, lhsContractingAxes, lhsBatchAxes, rhs.shape, rhsContractingAxes, rhsBatchAxes,
-	//	result.(*Node).shape)
-
+// specializeDotGeneral sets the sizes of a DotGeneral node built with dynamic shapes, once its inputs are
+// specialized to static shapes. See Executable.specialize.
+func specializeDotGeneral(node *Node) error {
+	params := *node.data.(*dotGeneralNodeData)
+	var err error
+	node.shape, err = params.setSizes(node.shape.DType, node.inputs[0].shape, node.inputs[1].shape)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return result, nil
+	node.data = &params
+	return nil
 }
 
 func dgFindSizes(shape shapes.Shape, contractingAxes, batchAxes []int) (batchSize, crossSize, contractingSize int, crossDims []int) {
@@ -0,0 +1,165 @@
+package simplego
+
+import (
+	"fmt"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/backends/shapeinference"
+	"github.com/gomlx/gomlx/pkg/support/sets"
+	"github.com/pkg/errors"
+)
+
+// This file implements the support for dynamic shapes (see shapes.DynamicDim): graphs whose parameters have
+// dynamic axes are compiled once, and for each new dimension of the dynamic axes, the Executable is specialized
+// by resolving the shapes of all its nodes -- which is cheap compared to building and compiling the graph.
+
+// dynamicShapesOps are the operations that support dynamic shapes: their output shape with the dynamic dimension
+// resolved is the one they would have with the resolved inputs, and their node data doesn't depend on it --
+// or else they are listed in dynamicShapesSpecializers.
+var dynamicShapesOps = sets.MakeWith(
+	backends.OpTypeParameter,
+	backends.OpTypeConstant,
+	backends.OpTypeIdentity,
+	backends.OpTypeWhere,
+	backends.OpTypeReshape,
+	backends.OpTypeTranspose,
+	backends.OpTypeBroadcastInDim,
+	backends.OpTypeConvertDType,
+	backends.OpTypeConcatenate,
+	backends.OpTypeArgMinMax,
+	backends.OpTypeDotGeneral,
+	backends.OpTypeIota,
+	backends.OpTypeIsFinite,
+	backends.OpTypeIsNaN,
+	backends.OpTypeReduceMax,
+	backends.OpTypeReduceMin,
+	backends.OpTypeReduceSum,
+	backends.OpTypeReduceProduct,
+	backends.OpTypeReduceBitwiseAnd,
+	backends.OpTypeReduceBitwiseOr,
+	backends.OpTypeReduceBitwiseXor,
+	backends.OpTypeReduceLogicalAnd,
+	backends.OpTypeReduceLogicalOr,
+	backends.OpTypeReduceLogicalXor,
+)
+
+// dynamicShapesSpecializers update the shape and data of the nodes whose dynamic shape can't be simply resolved,
+// once their inputs are specialized.
+var dynamicShapesSpecializers = map[backends.OpType]func(node *Node) error{
+	backends.OpTypeDotGeneral: specializeDotGeneral,
+}
+
+// isDynamicShapesOp returns whether the operation supports dynamic shapes.
+func isDynamicShapesOp(opType backends.OpType) bool {
+	return dynamicShapesOps.Has(opType) ||
+		shapeinference.StandardUnaryOperations.Has(opType) ||
+		shapeinference.StandardBinaryOperations.Has(opType) ||
+		shapeinference.ComparisonOperations.Has(opType)
+}
+
+// checkDynamicShapes returns an error if any node uses dynamic shapes (in its inputs or output) with an operation
+// that doesn't support them.
+// It returns whether the graph has dynamic parameters.
+func (b *Builder) checkDynamicShapes() (isDynamic bool, err error) {
+	for _, node := range b.nodes {
+		dynamic := node.shape.IsDynamic()
+		for _, input := range node.inputs {
+			dynamic = dynamic || input.shape.IsDynamic()
+		}
+		if !dynamic {
+			continue
+		}
+		if !isDynamicShapesOp(node.opType) || node.IsMultiOutputs() || node.isNodeSelectOutput {
+			return false, errors.Errorf("%s doesn't support dynamic shapes for %s yet (output shape %s) in %q",
+				BackendName, node.opType, node.shape, b.name)
+		}
+		if node.opType == backends.OpTypeParameter {
+			isDynamic = true
+		}
+	}
+	return isDynamic, nil
+}
+
+// dynamicDim returns the dimension of the dynamic axes of the parameters for the given inputs.
+// All the dynamic axes must have the same dimension.
+func (e *Executable) dynamicDim(inputs []backends.Buffer) (int, error) {
+	dim := -1
+	for ii, input := range inputs {
+		param := e.builder.inputs[ii]
+		if !param.shape.IsDynamic() {
+			continue
+		}
+		inputBuffer, ok := input.(*Buffer)
+		if !ok || inputBuffer == nil {
+			return 0, errors.Errorf("Execute: input buffer #%d is nil or not from SimpleGo backend", ii)
+		}
+		if !param.shape.Matches(inputBuffer.shape) {
+			return 0, errors.Errorf("Execute: parameter %q (input #%d) for %q: expected shape %s, got %s",
+				param.data.(*nodeParameter).name, ii, e.builder.name, param.shape, inputBuffer.shape)
+		}
+		for _, axis := range param.shape.DynamicAxes() {
+			inputDim := inputBuffer.shape.Dimensions[axis]
+			if dim == -1 {
+				dim = inputDim
+			} else if inputDim != dim {
+				return 0, errors.Errorf("Execute: the dynamic axes of the inputs of %q have different dimensions "+
+					"(%d and %d): input #%d has shape %s", e.builder.name, dim, inputDim, ii, inputBuffer.shape)
+			}
+		}
+	}
+	return dim, nil
+}
+
+// specialize returns the Executable for the given dimension of the dynamic axes, creating it if needed.
+func (e *Executable) specialize(dim int) (*Executable, error) {
+	e.specializedMu.Lock()
+	defer e.specializedMu.Unlock()
+	if specialized, found := e.specialized[dim]; found {
+		return specialized, nil
+	}
+
+	b := &Builder{
+		name:     fmt.Sprintf("%s[%d]", e.builder.name, dim),
+		backend:  e.backend,
+		compiled: true,
+		nodes:    make([]*Node, len(e.builder.nodes)),
+	}
+	for idx, node := range e.builder.nodes {
+		specialized := *node
+		specialized.builder = b
+		specialized.shape = node.shape.ResolveDynamic(dim)
+		specialized.inputs = make([]*Node, len(node.inputs))
+		for ii, input := range node.inputs {
+			specialized.inputs[ii] = b.nodes[input.builderIdx]
+		}
+		if specializerFn := dynamicShapesSpecializers[node.opType]; specializerFn != nil {
+			if err := specializerFn(&specialized); err != nil {
+				return nil, errors.WithMessagef(err, "while specializing %q for dynamic dimension %d",
+					e.builder.name, dim)
+			}
+		}
+		b.nodes[idx] = &specialized
+	}
+	remap := func(nodes []*Node) []*Node {
+		if nodes == nil {
+			return nil
+		}
+		remapped := make([]*Node, len(nodes))
+		for ii, node := range nodes {
+			remapped[ii] = b.nodes[node.builderIdx]
+		}
+		return remapped
+	}
+	for _, node := range b.nodes {
+		node.multiOutputsNodes = remap(node.multiOutputsNodes)
+	}
+	b.inputs = remap(e.builder.inputs)
+	b.outputs = remap(e.builder.outputs)
+
+	specialized := newExecutable(b)
+	if e.specialized == nil {
+		e.specialized = make(map[int]*Executable)
+	}
+	e.specialized[dim] = specialized
+	return specialized, nil
+}
@@ -0,0 +1,85 @@
+package simplego
+
+import (
+	"testing"
+
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+)
+
+func TestDynamicShapes(t *testing.T) {
+	D := shapes.DynamicDim
+	builder := backend.Builder("dynamic")
+	x, err := builder.Parameter("x", shapes.MakeDynamic(dtypes.Float32, D, 2, 3))
+	require.NoError(t, err)
+	w, err := builder.Constant([]float32{1, 0, 0, 1, 1, 1}, 3, 2)
+	require.NoError(t, err)
+	bias, err := builder.Constant([]float32{100}, 1, 1, 1)
+	require.NoError(t, err)
+
+	// The dynamic axis is grouped with a static axis in the normalized DotGeneral.
+	y, err := builder.DotGeneral(x, []int{2}, nil, w, []int{0}, nil)
+	require.NoError(t, err)
+	y, err = builder.Add(y, bias)
+	require.NoError(t, err)
+	yShape, err := builder.OpShape(y)
+	require.NoError(t, err)
+	require.Equal(t, "(Float32)[? 2 2]", yShape.String())
+	sum, err := builder.ReduceSum(y, 1, 2)
+	require.NoError(t, err)
+	exec, err := builder.Compile(y, sum)
+	require.NoError(t, err)
+	_, inputShapes := exec.Inputs()
+	require.True(t, inputShapes[0].IsDynamic())
+
+	for _, batchSize := range []int{1, 4, 3, 4} {
+		flat := make([]float32, batchSize*2*3)
+		for ii := range flat {
+			flat[ii] = float32(ii)
+		}
+		input, err := backend.BufferFromFlatData(0, flat, shapes.Make(dtypes.Float32, batchSize, 2, 3))
+		require.NoError(t, err)
+		outputs, err := exec.Execute([]backends.Buffer{input}, nil)
+		require.NoError(t, err, "batchSize=%d", batchSize)
+		require.Equal(t, []int{batchSize, 2, 2}, outputs[0].(*Buffer).shape.Dimensions)
+		require.Equal(t, []int{batchSize}, outputs[1].(*Buffer).shape.Dimensions)
+		got := outputs[0].(*Buffer).flat.([]float32)
+		sums := outputs[1].(*Buffer).flat.([]float32)
+		for row := range batchSize * 2 {
+			x0, x1, x2 := flat[row*3], flat[row*3+1], flat[row*3+2]
+			require.Equal(t, []float32{x0 + x2 + 100, x1 + x2 + 100}, got[row*2:row*2+2])
+		}
+		require.Equal(t, got[0]+got[1]+got[2]+got[3], sums[0])
+	}
+	// One specialization per batch size seen.
+	require.Len(t, exec.(*Executable).specialized, 3)
+
+	// Dynamic axes with different dimensions.
+	builder = backend.Builder("dynamic_mismatch")
+	a, err := builder.Parameter("a", shapes.MakeDynamic(dtypes.Float32, D))
+	require.NoError(t, err)
+	b, err := builder.Parameter("b", shapes.MakeDynamic(dtypes.Float32, D))
+	require.NoError(t, err)
+	c, err := builder.Add(a, b)
+	require.NoError(t, err)
+	exec, err = builder.Compile(c)
+	require.NoError(t, err)
+	i0, err := backend.BufferFromFlatData(0, []float32{1, 2}, shapes.Make(dtypes.Float32, 2))
+	require.NoError(t, err)
+	i1, err := backend.BufferFromFlatData(0, []float32{1, 2, 3}, shapes.Make(dtypes.Float32, 3))
+	require.NoError(t, err)
+	_, err = exec.Execute([]backends.Buffer{i0, i1}, nil)
+	require.Error(t, err)
+
+	// Operations that don't support dynamic shapes fail to compile.
+	builder = backend.Builder("dynamic_unsupported")
+	a, err = builder.Parameter("a", shapes.MakeDynamic(dtypes.Float32, D, 2))
+	require.NoError(t, err)
+	a, err = builder.Reverse(a, 0)
+	require.NoError(t, err)
+	_, err = builder.Compile(a)
+	require.Error(t, err)
+}
@@ -1,7 +1,9 @@
 package simplego
 
 import (
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -9,7 +11,10 @@ import (
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 )
 
-var _ backends.Executable = (*Executable)(nil)
+var (
+	_ backends.Executable          = (*Executable)(nil)
+	_ backends.ProfilingExecutable = (*Executable)(nil)
+)
 
 // Executable holds a frozen Builder. It assumes the graph in Builder is valid and has been properly
 // checked that all the shapes and data types are valid.
@@ -39,6 +44,12 @@ type Executable struct {
 	// dependents maps each node to the list of nodes that depend on it -- only count nodes that are used
 	// by this executable.
 	dependents [][]int
+
+	// isDynamic is set if the parameters have dynamic shapes (see shapes.DynamicDim): the execution is delegated to
+	// the Executable specialized for the dimension of the dynamic axes of the inputs, see Executable.specialize.
+	isDynamic     bool
+	specializedMu sync.Mutex
+	specialized   map[int]*Executable
 }
 
 // executionBuffers holds the intermediate results during the execution of the graph.
@@ -73,6 +84,10 @@ type executionBuffers struct {
 	// Parallel execution only:
 	// mu protects numUsed and results in Executable.executeNode.
 	mu sync.Mutex
+
+	// opsProfile is set only when profiling (see Executable.ExecuteProfiled), and it is indexed by the node index.
+	// Each node is executed only once, so it needs no locking.
+	opsProfile []backends.OpProfile
 }
 
 // Compile time check.
@@ -86,12 +101,19 @@ var _ backends.Executable = (*Executable)(nil)
 //       without finishing. Finally, remove the `e.builder == nil` checks, that won't be necessary anymore,
 //       since e.builder will never be set to nil while there is an execution alive.
 func (e *Executable) Finalize() {
+	e.specializedMu.Lock()
+	for _, specialized := range e.specialized {
+		specialized.Finalize()
+	}
+	e.specialized = nil
+	e.specializedMu.Unlock()
 	e.builder.Finalize()
 	e.builder = nil
 	return
 }
 
 // Inputs returns the list of parameters names and shapes, in order created by the Builder.Parameter calls.
+// The shapes may be dynamic (see shapes.DynamicDim).
 func (e *Executable) Inputs() (names []string, inputShapes []shapes.Shape) {
 	numInputs := len(e.builder.inputs)
 	if numInputs == 0 {
@@ -208,15 +230,41 @@ const (
 // Donated buffers are no longer valid after the call.
 // If donate is nil, it is assumed to be false for all buffers, and no buffer is donated.
 func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backends.Buffer, error) {
-	// Keep the live executions count.
-	e.backend.numLiveExecutions.Add(1)
-	defer e.backend.numLiveExecutions.Add(-1)
+	outputs, _, err := e.execute(inputs, donate, false)
+	return outputs, err
+}
+
+// ExecuteProfiled executes the computation as Execute, and also returns the profile of each op executed.
+// It implements backends.ProfilingExecutable.
+func (e *Executable) ExecuteProfiled(inputs []backends.Buffer, donate []bool) (
+	[]backends.Buffer, []backends.OpProfile, error) {
+	return e.execute(inputs, donate, true)
+}
 
+// execute implements Execute and ExecuteProfiled.
+func (e *Executable) execute(inputs []backends.Buffer, donate []bool, profile bool) (
+	[]backends.Buffer, []backends.OpProfile, error) {
 	// Check inputs length
 	if len(inputs) != len(e.builder.inputs) {
-		return nil, errors.Errorf("Execute: expected %d inputs, got %d", len(e.builder.inputs), len(inputs))
+		return nil, nil, errors.Errorf("Execute: expected %d inputs, got %d", len(e.builder.inputs), len(inputs))
 	}
 
+	if e.isDynamic {
+		dim, err := e.dynamicDim(inputs)
+		if err != nil {
+			return nil, nil, err
+		}
+		specialized, err := e.specialize(dim)
+		if err != nil {
+			return nil, nil, err
+		}
+		return specialized.execute(inputs, donate, profile)
+	}
+
+	// Keep the live executions count.
+	e.backend.numLiveExecutions.Add(1)
+	defer e.backend.numLiveExecutions.Add(-1)
+
 	// donate defaults to false for all buffers.
 	if len(donate) == 0 {
 		donate = make([]bool, len(inputs))
@@ -225,24 +273,24 @@ func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backend
 	// Check input shapes
 	for ii, input := range inputs {
 		if input == nil {
-			return nil, errors.Errorf("Execute: input buffer #%d is nil!?", ii)
+			return nil, nil, errors.Errorf("Execute: input buffer #%d is nil!?", ii)
 		}
 		inputBuffer, ok := input.(*Buffer)
 		if !ok {
-			return nil, errors.Errorf("Execute: input buffer #%d is not from SimpleGo backend", ii)
+			return nil, nil, errors.Errorf("Execute: input buffer #%d is not from SimpleGo backend", ii)
 		}
 		if !inputBuffer.valid {
-			return nil, errors.Errorf(
+			return nil, nil, errors.Errorf(
 				"Execute: input buffer (%p) #%d is not valid, likely it is being used after being isFinalized",
 				inputBuffer, ii)
 		}
 		if inputBuffer.flat == nil {
-			return nil, errors.Errorf("Execute: input buffer #%d flat data is set to nil (!?)", ii)
+			return nil, nil, errors.Errorf("Execute: input buffer #%d flat data is set to nil (!?)", ii)
 		}
 		nodeInput := e.builder.inputs[ii]
 		if !inputBuffer.shape.Equal(nodeInput.shape) {
 			paramName := nodeInput.data.(*nodeParameter).name
-			return nil, errors.Errorf("Execute: parameter %q (input #%d) for %q: expected shape %s, got %s",
+			return nil, nil, errors.Errorf("Execute: parameter %q (input #%d) for %q: expected shape %s, got %s",
 				paramName, ii, e.builder.name, nodeInput.shape, inputBuffer.shape)
 		}
 	}
@@ -278,6 +326,9 @@ func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backend
 		}
 	}
 	execBuf.opsExecutionType = executionMode
+	if profile {
+		execBuf.opsProfile = make([]backends.OpProfile, e.numNodesToProcess)
+	}
 
 	var err error
 
@@ -287,7 +338,7 @@ func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backend
 		err = e.executeParallel(execBuf)
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Return outputs, copying them if not owned by the executor
@@ -297,11 +348,11 @@ func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backend
 		outBuf := execBuf.results[outNodeIdx]
 		execBuf.results[outNodeIdx] = nil // Make sure we don't return the same buffer twice.
 		if outBuf == nil {
-			return nil, errors.Errorf("Execute: output #%d (%s, nodeIdx=%d) is not calculated yet (!?) -- "+
+			return nil, nil, errors.Errorf("Execute: output #%d (%s, nodeIdx=%d) is not calculated yet (!?) -- "+
 				"this is a bug, it should never have happened", ii, outputNode.opType, outNodeIdx)
 		}
 		if !outBuf.shape.Ok() {
-			return nil, errors.Errorf("Execute: output #%d (%s, nodeIdx=%d) returned an invalid shape (!?) -- "+
+			return nil, nil, errors.Errorf("Execute: output #%d (%s, nodeIdx=%d) returned an invalid shape (!?) -- "+
 				"this is a bug, it should never have happened", ii, outputNode.opType, outNodeIdx)
 		}
 		if !execBuf.owned[outNodeIdx] {
@@ -323,9 +374,20 @@ func (e *Executable) Execute(inputs []backends.Buffer, donate []bool) ([]backend
 		execBuf.results[nodeIdx] = nil
 	}
 
+	// Collect the profile of the executed ops.
+	var opsProfile []backends.OpProfile
+	if profile {
+		for _, opProfile := range execBuf.opsProfile {
+			if opProfile.Op != nil {
+				opsProfile = append(opsProfile, opProfile)
+			}
+		}
+		execBuf.opsProfile = nil
+	}
+
 	// Return buffers to pool
 	e.executionBuffersPool.Put(execBuf)
-	return outputs, nil
+	return outputs, opsProfile, nil
 }
 
 // executeSequentially executes operations one after another. It uses execBuf to store the results.
@@ -404,6 +466,15 @@ func (e *Executable) executeNode(node *Node, execBuf *executionBuffers) error {
 		inputsOwned[ii] = execBuf.owned[inputNodeIdx] && e.numUses[inputNodeIdx]-execBuf.numUsed[inputNodeIdx] == 1
 	}
 
+	var (
+		startTime           time.Time
+		profileInputBuffers []*Buffer
+	)
+	if execBuf.opsProfile != nil {
+		// Executors set the inputs they take over (reuse) to nil, so we keep a copy to check for reuse.
+		profileInputBuffers = slices.Clone(inputBuffers)
+		startTime = time.Now()
+	}
 	if node.IsMultiOutputs() {
 		// Multi-output node:
 		multiNodeExecutor := multiOutputsNodeExecutors[node.opType]
@@ -425,6 +496,9 @@ func (e *Executable) executeNode(node *Node, execBuf *executionBuffers) error {
 			execBuf.results[outputNodeIdx] = outputBuf
 			execBuf.owned[outputNodeIdx] = true
 		}
+		if execBuf.opsProfile != nil {
+			e.profileNode(node, execBuf, startTime, profileInputBuffers, outputs)
+		}
 
 	} else {
 		// Single-output node:
@@ -438,6 +512,9 @@ func (e *Executable) executeNode(node *Node, execBuf *executionBuffers) error {
 			return errors.WithMessagef(err, "while executing %q", node.opType)
 		}
 		execBuf.owned[nodeIdx] = true
+		if execBuf.opsProfile != nil {
+			e.profileNode(node, execBuf, startTime, profileInputBuffers, []*Buffer{execBuf.results[nodeIdx]})
+		}
 	}
 
 	// If input has been reused, erase it from results.
@@ -470,6 +547,38 @@ func (e *Executable) executeNode(node *Node, execBuf *executionBuffers) error {
 	return nil
 }
 
+// profileNode records the profile of the execution of node, that started at startTime.
+func (e *Executable) profileNode(node *Node, execBuf *executionBuffers, startTime time.Time,
+	inputBuffers, outputBuffers []*Buffer) {
+	opProfile := backends.OpProfile{
+		Op:          node,
+		OpType:      node.opType,
+		InputShapes: make([]shapes.Shape, len(node.inputs)),
+		Start:       startTime,
+		Duration:    time.Since(startTime),
+	}
+	for ii, input := range node.inputs {
+		opProfile.InputShapes[ii] = input.shape
+	}
+	for _, output := range outputBuffers {
+		if output == nil {
+			continue
+		}
+		opProfile.OutputShapes = append(opProfile.OutputShapes, output.shape)
+		reused := false
+		for _, input := range inputBuffers {
+			if input == output {
+				reused = true
+				break
+			}
+		}
+		if !reused {
+			opProfile.BytesAllocated += output.shape.Memory()
+		}
+	}
+	execBuf.opsProfile[node.builderIdx] = opProfile
+}
+
 // executeParallel executes ops one after another. It uses execBuf to store the results.
 // It's the parallel implementation of Executable.Execute.
 func (e *Executable) executeParallel(execBuf *executionBuffers) error {
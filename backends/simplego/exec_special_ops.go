@@ -20,6 +20,8 @@ func init() {
 	nodeExecutors[backends.OpTypeWhere] = execWhere
 	nodeExecutors[backends.OpTypeReshape] = execReshape
 	nodeExecutors[backends.OpTypeTranspose] = execTranspose
+	nodeExecutors[backends.OpTypeReverse] = execReverse
+	nodeExecutors[backends.OpTypePad] = execPad
 	nodeExecutors[backends.OpTypeBroadcast] = execBroadcast
 	nodeExecutors[backends.OpTypeBroadcastInDim] = execBroadcastInDim
 	nodeExecutors[backends.OpTypeReduceMax] = execReduce
@@ -40,6 +42,8 @@ func init() {
 	nodeExecutors[backends.OpTypeScatterMin] = execScatter
 	nodeExecutors[backends.OpTypeScatterSum] = execScatter
 	nodeExecutors[backends.OpTypeSlice] = execSlice
+	nodeExecutors[backends.OpTypeDynamicSlice] = execDynamicSlice
+	nodeExecutors[backends.OpTypeDynamicUpdateSlice] = execDynamicUpdateSlice
 	nodeExecutors[backends.OpTypeArgMinMax] = execArgMinMax
 	nodeExecutors[backends.OpTypeReduceWindow] = execReduceWindow
 
@@ -530,6 +534,123 @@ func execTranspose(backend *Backend, node *Node, inputs []*Buffer, inputsOwned [
 	return output, nil
 }
 
+// ReverseOp ======================================================================================================
+
+// execReverse implements Reverse: it works on the raw bytes, so it works for any dtype.
+func execReverse(backend *Backend, node *Node, inputs []*Buffer, inputsOwned []bool) (*Buffer, error) {
+	operand := inputs[0]
+	_ = inputsOwned // We don't reuse the inputs.
+	output := backend.getBuffer(node.shape.DType, node.shape.Size())
+	output.shape = node.shape
+	if node.shape.Size() == 0 {
+		return output, nil
+	}
+	operandBytes, outputBytes := operand.mutableBytes(), output.mutableBytes()
+	dims := node.shape.Dimensions
+	rank := len(dims)
+	if rank == 0 {
+		copy(outputBytes, operandBytes)
+		return output, nil
+	}
+	reversed := make([]bool, rank)
+	for _, axis := range node.data.([]int) {
+		reversed[axis] = !reversed[axis]
+	}
+	strides := calculateStrides(dims)
+	elementSize := node.shape.DType.Size()
+
+	// We copy contiguous rows of the last axis, unless the last axis is reversed.
+	rowLen := dims[rank-1]
+	numRows := node.shape.Size() / rowLen
+	rowIdx := make([]int, rank-1) // Position of the row in the output.
+	for row := range numRows {
+		operandOffset := 0
+		for axis, idx := range rowIdx {
+			if reversed[axis] {
+				idx = dims[axis] - 1 - idx
+			}
+			operandOffset += idx * strides[axis]
+		}
+		outputOffset := row * rowLen
+		if !reversed[rank-1] {
+			copy(outputBytes[outputOffset*elementSize:(outputOffset+rowLen)*elementSize],
+				operandBytes[operandOffset*elementSize:(operandOffset+rowLen)*elementSize])
+		} else {
+			for ii := range rowLen {
+				src := (operandOffset + rowLen - 1 - ii) * elementSize
+				dst := (outputOffset + ii) * elementSize
+				copy(outputBytes[dst:dst+elementSize], operandBytes[src:src+elementSize])
+			}
+		}
+		// Increment the row position.
+		for axis := rank - 2; axis >= 0; axis-- {
+			rowIdx[axis]++
+			if rowIdx[axis] < dims[axis] {
+				break
+			}
+			rowIdx[axis] = 0
+		}
+	}
+	return output, nil
+}
+
+// PadOp ==========================================================================================================
+
+// execPad implements Pad: it works on the raw bytes, so it works for any dtype.
+func execPad(backend *Backend, node *Node, inputs []*Buffer, inputsOwned []bool) (*Buffer, error) {
+	operand, fillValue := inputs[0], inputs[1]
+	_ = inputsOwned // We don't reuse the inputs.
+	output := backend.getBuffer(node.shape.DType, node.shape.Size())
+	output.shape = node.shape
+	if node.shape.Size() == 0 {
+		return output, nil
+	}
+	config := node.data.([]backends.PadAxis)
+	elementSize := node.shape.DType.Size()
+	outputBytes, operandBytes := output.mutableBytes(), operand.mutableBytes()
+
+	// Fill the output with the fillValue.
+	fillBytes := fillValue.mutableBytes()
+	for offset := 0; offset < len(outputBytes); offset += elementSize {
+		copy(outputBytes[offset:offset+elementSize], fillBytes)
+	}
+	if operand.shape.Size() == 0 {
+		return output, nil
+	}
+
+	// Copy each element of the operand to its position in the output, if it is not cropped by negative paddings.
+	outputDims := node.shape.Dimensions
+	outputStrides := calculateStrides(outputDims)
+	operandDims := operand.shape.Dimensions
+	rank := len(operandDims)
+	operandIdx := make([]int, rank)
+	for operandOffset := 0; operandOffset < len(operandBytes); operandOffset += elementSize {
+		outputOffset := 0
+		inBounds := true
+		for axis, idx := range operandIdx {
+			pos := config[axis].Start + idx*(config[axis].Interior+1)
+			if pos < 0 || pos >= outputDims[axis] {
+				inBounds = false
+				break
+			}
+			outputOffset += pos * outputStrides[axis]
+		}
+		if inBounds {
+			outputOffset *= elementSize
+			copy(outputBytes[outputOffset:outputOffset+elementSize], operandBytes[operandOffset:operandOffset+elementSize])
+		}
+		// Increment the operand position.
+		for axis := rank - 1; axis >= 0; axis-- {
+			operandIdx[axis]++
+			if operandIdx[axis] < operandDims[axis] {
+				break
+			}
+			operandIdx[axis] = 0
+		}
+	}
+	return output, nil
+}
+
 type transposeIterator struct {
 	flatIdx                                int
 	perAxisIdx, perAxisStrides, dimensions []int
@@ -1477,6 +1598,120 @@ func execSliceGeneric[T SupportedTypesConstraints](operand, output *Buffer, para
 	}
 }
 
+// DynamicSlice and DynamicUpdateSlice ================================================================================
+
+// dynamicStartIndices reads the start indices from the scalar buffers, clamped such that a block of blockDims fits
+// in operandDims.
+func dynamicStartIndices(startIndices []*Buffer, operandDims, blockDims []int) []int {
+	starts := make([]int, len(startIndices))
+	for axis, buf := range startIndices {
+		var start int
+		switch flat := buf.flat.(type) {
+		case []int8:
+			start = int(flat[0])
+		case []int16:
+			start = int(flat[0])
+		case []int32:
+			start = int(flat[0])
+		case []int64:
+			start = int(flat[0])
+		case []uint8:
+			start = int(flat[0])
+		case []uint16:
+			start = int(flat[0])
+		case []uint32:
+			start = int(flat[0])
+		case []uint64:
+			start = int(flat[0])
+		}
+		starts[axis] = min(max(start, 0), operandDims[axis]-blockDims[axis])
+	}
+	return starts
+}
+
+// copyDynamicBlock copies the block (with blockDims) from/to the larger operand (with operandDims) at the
+// position given by starts. If toOperand is true, it copies from block to operand, otherwise from operand to
+// block. It works on the raw bytes, so it works for any dtype.
+func copyDynamicBlock(operand, block []byte, operandDims, blockDims, starts []int, elementSize int, toOperand bool) {
+	rank := len(operandDims)
+	if rank == 0 {
+		if toOperand {
+			copy(operand, block)
+		} else {
+			copy(block, operand)
+		}
+		return
+	}
+	operandStrides := calculateStrides(operandDims)
+	rowSize := blockDims[rank-1] * elementSize
+	numRows := 1
+	for _, dim := range blockDims[:rank-1] {
+		numRows *= dim
+	}
+	if rowSize == 0 || numRows == 0 {
+		return
+	}
+	rowIdx := make([]int, rank-1) // Position of the row in the block.
+	for row := range numRows {
+		operandOffset := starts[rank-1]
+		for axis, idx := range rowIdx {
+			operandOffset += (starts[axis] + idx) * operandStrides[axis]
+		}
+		operandOffset *= elementSize
+		blockOffset := row * rowSize
+		if toOperand {
+			copy(operand[operandOffset:operandOffset+rowSize], block[blockOffset:blockOffset+rowSize])
+		} else {
+			copy(block[blockOffset:blockOffset+rowSize], operand[operandOffset:operandOffset+rowSize])
+		}
+		// Increment the row position.
+		for axis := rank - 2; axis >= 0; axis-- {
+			rowIdx[axis]++
+			if rowIdx[axis] < blockDims[axis] {
+				break
+			}
+			rowIdx[axis] = 0
+		}
+	}
+}
+
+// execDynamicSlice is the executor function registered for backends.OpTypeDynamicSlice.
+func execDynamicSlice(backend *Backend, node *Node, inputs []*Buffer, inputsOwned []bool) (*Buffer, error) {
+	_ = inputsOwned
+	operand := inputs[0]
+	output := backend.getBuffer(node.shape.DType, node.shape.Size())
+	output.shape = node.shape
+	if node.shape.Size() == 0 {
+		return output, nil
+	}
+	starts := dynamicStartIndices(inputs[1:], operand.shape.Dimensions, node.shape.Dimensions)
+	copyDynamicBlock(operand.mutableBytes(), output.mutableBytes(), operand.shape.Dimensions, node.shape.Dimensions,
+		starts, node.shape.DType.Size(), false)
+	return output, nil
+}
+
+// execDynamicUpdateSlice is the executor function registered for backends.OpTypeDynamicUpdateSlice.
+func execDynamicUpdateSlice(backend *Backend, node *Node, inputs []*Buffer, inputsOwned []bool) (*Buffer, error) {
+	operand, update := inputs[0], inputs[1]
+	var output *Buffer
+	if inputsOwned[0] {
+		// Update the operand in place.
+		output = operand
+		inputs[0] = nil
+	} else {
+		output = backend.getBuffer(operand.shape.DType, operand.shape.Size())
+		output.shape = operand.shape
+		copyFlat(output.flat, operand.flat)
+	}
+	if update.shape.Size() == 0 {
+		return output, nil
+	}
+	starts := dynamicStartIndices(inputs[2:], operand.shape.Dimensions, update.shape.Dimensions)
+	copyDynamicBlock(output.mutableBytes(), update.mutableBytes(), output.shape.Dimensions, update.shape.Dimensions,
+		starts, output.shape.DType.Size(), true)
+	return output, nil
+}
+
 // RngBitGenerator ====================================================================================================
 
 // execRngBitGenerator is the executor function registered for backends.OpTypeRngBitGenerator.
@@ -199,6 +199,41 @@ func TestExecSpecialOps_Transpose(t *testing.T) {
 	require.Equal(t, want, y0.Value())
 }
 
+func TestExecSpecialOps_Reverse(t *testing.T) {
+	operand := tensors.FromFlatDataAndDimensions(xslices.Iota(float32(0), 24), 2, 3, 4)
+	y0 := graph.MustExecOnce(backend, func(x *graph.Node) *graph.Node {
+		return graph.Reverse(x, 1, 2)
+	}, operand)
+	want := [][][]float32{
+		{{11, 10, 9, 8}, {7, 6, 5, 4}, {3, 2, 1, 0}},
+		{{23, 22, 21, 20}, {19, 18, 17, 16}, {15, 14, 13, 12}}}
+	require.Equal(t, want, y0.Value())
+
+	y1 := graph.MustExecOnce(backend, func(x *graph.Node) *graph.Node {
+		return graph.Reverse(x, 0)
+	}, [][]int8{{1, 2}, {3, 4}, {5, 6}})
+	require.Equal(t, [][]int8{{5, 6}, {3, 4}, {1, 2}}, y1.Value())
+
+	y2 := graph.MustExecOnce(backend, func(x *graph.Node) *graph.Node {
+		return graph.Reverse(x)
+	}, []bool{true, false, false})
+	require.Equal(t, []bool{true, false, false}, y2.Value())
+}
+
+func TestExecSpecialOps_Pad(t *testing.T) {
+	y0 := graph.MustExecOnce(backend, func(x *graph.Node) *graph.Node {
+		return graph.Pad(x, graph.Const(x.Graph(), float32(-1)),
+			backends.PadAxis{Start: 1}, backends.PadAxis{End: 2, Interior: 1})
+	}, [][]float32{{1, 2}, {3, 4}})
+	require.Equal(t, [][]float32{{-1, -1, -1, -1, -1}, {1, -1, 2, -1, -1}, {3, -1, 4, -1, -1}}, y0.Value())
+
+	// Negative paddings crop the operand.
+	y1 := graph.MustExecOnce(backend, func(x *graph.Node) *graph.Node {
+		return graph.Pad(x, graph.Const(x.Graph(), int32(0)), backends.PadAxis{Start: -1, End: -2, Interior: 2})
+	}, []int32{1, 2, 3})
+	require.Equal(t, []int32{0, 0, 2, 0}, y1.Value())
+}
+
 func TestExecSpecialOps_Iota(t *testing.T) {
 	y0 := graph.MustExecOnce(backend, func(g *graph.Graph) *graph.Node {
 		return graph.Iota(g, shapes.Make(dtypes.Int8, 2, 3), 1)
@@ -800,3 +835,29 @@ func TestExecSpecialOps_ReduceWindow(t *testing.T) { // Renamed for common Go te
 		})
 	}
 }
+
+func TestExecSpecialOps_DynamicSlice(t *testing.T) {
+	y0 := graph.MustExecOnce(backend, func(operand, start *graph.Node) *graph.Node {
+		return graph.DynamicSlice(operand, []*graph.Node{start, graph.Const(start.Graph(), int64(1))}, []int{2, 2})
+	}, [][]float32{{0, 1, 2}, {3, 4, 5}, {6, 7, 8}}, int32(1))
+	require.Equal(t, [][]float32{{4, 5}, {7, 8}}, y0.Value())
+
+	// Start indices are clamped.
+	y1 := graph.MustExecOnce(backend, func(operand, start *graph.Node) *graph.Node {
+		return graph.DynamicSlice(operand, []*graph.Node{start}, []int{2})
+	}, []bool{true, false, true, true}, int32(5))
+	require.Equal(t, []bool{true, true}, y1.Value())
+}
+
+func TestExecSpecialOps_DynamicUpdateSlice(t *testing.T) {
+	y0 := graph.MustExecOnce(backend, func(operand, update, start *graph.Node) *graph.Node {
+		return graph.DynamicUpdateSlice(operand, update, []*graph.Node{graph.Const(start.Graph(), int32(0)), start})
+	}, [][]int64{{0, 1, 2}, {3, 4, 5}}, [][]int64{{10}, {20}}, int32(1))
+	require.Equal(t, [][]int64{{0, 10, 2}, {3, 20, 5}}, y0.Value())
+
+	// Start indices are clamped, and the operand is updated in place if it is not used elsewhere.
+	y1 := graph.MustExecOnce(backend, func(operand, update, start *graph.Node) *graph.Node {
+		return graph.DynamicUpdateSlice(graph.AddScalar(operand, 1), update, []*graph.Node{start})
+	}, []float64{0, 1, 2, 3}, []float64{-1, -2}, int32(-3))
+	require.Equal(t, []float64{-1, -2, 3, 4}, y1.Value())
+}
@@ -3,6 +3,7 @@ package simplego
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gomlx/gopjrt/dtypes"
 	"github.com/stretchr/testify/require"
@@ -75,6 +76,42 @@ func TestBuilder_Compile(t *testing.T) {
 	require.True(t, outputShape.Equal(shapes.Make(dtypes.Int64, 3)))
 }
 
+func TestExecuteProfiled(t *testing.T) {
+	builder := backend.Builder("test")
+	x, err := builder.Parameter("x", shapes.Make(dtypes.Float32, 3))
+	require.NoError(t, err)
+	neg, err := builder.Neg(x)
+	require.NoError(t, err)
+	y, err := builder.Add(neg, x)
+	require.NoError(t, err)
+	exec, err := builder.Compile(y)
+	require.NoError(t, err)
+	profiler, ok := exec.(backends.ProfilingExecutable)
+	require.True(t, ok)
+
+	i0, err := backend.BufferFromFlatData(0, []float32{3, 5, 7}, shapes.Make(dtypes.Float32, 3))
+	require.NoError(t, err)
+	outputs, opsProfile, err := profiler.ExecuteProfiled([]backends.Buffer{i0}, []bool{false})
+	require.NoError(t, err)
+	require.Len(t, outputs, 1)
+	require.Len(t, opsProfile, 2)
+	opTypes := make(map[backends.OpType]backends.OpProfile)
+	for _, opProfile := range opsProfile {
+		opTypes[opProfile.OpType] = opProfile
+		require.False(t, opProfile.Start.IsZero())
+		require.GreaterOrEqual(t, opProfile.Duration, time.Duration(0))
+		require.Len(t, opProfile.OutputShapes, 1)
+		require.True(t, opProfile.OutputShapes[0].Equal(shapes.Make(dtypes.Float32, 3)))
+	}
+	require.Contains(t, opTypes, backends.OpTypeNeg)
+	require.Contains(t, opTypes, backends.OpTypeAdd)
+	require.Equal(t, neg, opTypes[backends.OpTypeNeg].Op)
+	require.Len(t, opTypes[backends.OpTypeAdd].InputShapes, 2)
+	// Neg allocates a new buffer, since the input is not donated; Add reuses the buffer from Neg.
+	require.Equal(t, uintptr(12), opTypes[backends.OpTypeNeg].BytesAllocated)
+	require.Equal(t, uintptr(0), opTypes[backends.OpTypeAdd].BytesAllocated)
+}
+
 func TestGomlxIntegration(t *testing.T) {
 	// Makes sure we get a SimpleGo backend.
 	backend, err := backends.NewWithConfig(BackendName)
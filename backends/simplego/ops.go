@@ -147,6 +147,67 @@ func (b *Builder) Transpose(operandOp backends.Op, permutations ...int) (backend
 	return node, nil
 }
 
+// Reverse returns x with the values for the given axes reversed, that is,
+// the value indexed at `i` will be swapped with the value at indexed `(dimension_size - 1 - i)`.
+// The shape remains the same.
+func (b *Builder) Reverse(operandOp backends.Op, axes ...int) (backends.Op, error) {
+	opType := backends.OpTypeReverse
+	inputs, err := b.checkOps(opType.String(), operandOp)
+	if err != nil {
+		return nil, err
+	}
+	operand := inputs[0]
+	for _, axis := range axes {
+		if axis < 0 || axis >= operand.shape.Rank() {
+			return nil, errors.Errorf("%s: axis %d out of range for operand shape %s", opType, axis, operand.shape)
+		}
+	}
+	node := b.newNode(opType, operand.shape, operand)
+	node.data = axes
+	return node, nil
+}
+
+// Pad injects padding on the start, end, or interior (in between each element) of the given operand.
+// There must be at most `operand.Rank()` axesConfig values. Missing PadAxis are assumed to be zeros,
+// that is, no padding for those axes. Negative start or end paddings remove elements.
+func (b *Builder) Pad(operandOp, fillValueOp backends.Op, axesConfig ...backends.PadAxis) (backends.Op, error) {
+	opType := backends.OpTypePad
+	inputs, err := b.checkOps(opType.String(), operandOp, fillValueOp)
+	if err != nil {
+		return nil, err
+	}
+	operand, fillValue := inputs[0], inputs[1]
+	if !fillValue.shape.IsScalar() || fillValue.shape.DType != operand.shape.DType {
+		return nil, errors.Errorf("%s: fillValue (shape=%s) must be a scalar with the same dtype as the operand (shape=%s)",
+			opType, fillValue.shape, operand.shape)
+	}
+	if len(axesConfig) > operand.shape.Rank() {
+		return nil, errors.Errorf("%s: %d axesConfig given, but operand (shape=%s) has rank %d",
+			opType, len(axesConfig), operand.shape, operand.shape.Rank())
+	}
+	config := make([]backends.PadAxis, operand.shape.Rank())
+	copy(config, axesConfig)
+	outputShape := operand.shape.Clone()
+	for axis, padding := range config {
+		if padding.Interior < 0 {
+			return nil, errors.Errorf("%s: interior padding must be >= 0, got %+v for axis %d", opType, padding, axis)
+		}
+		dim := operand.shape.Dimensions[axis]
+		if dim > 0 {
+			dim += (dim - 1) * padding.Interior
+		}
+		dim += padding.Start + padding.End
+		if dim < 0 {
+			return nil, errors.Errorf("%s: padding %+v for axis %d of operand (shape=%s) yields a negative dimension",
+				opType, padding, axis, operand.shape)
+		}
+		outputShape.Dimensions[axis] = dim
+	}
+	node := b.newNode(opType, outputShape, operand, fillValue)
+	node.data = config
+	return node, nil
+}
+
 // Broadcast prefixes dimensions to an array by duplicating the data in the array.
 // See BroadcastInDim for a broadcast in between the axes.
 // The new dimensions dims are inserted on the left, i.e., if
@@ -441,6 +502,71 @@ type sliceNode struct {
 	starts, limits, strides []int
 }
 
+// DynamicSlice extracts a slice from the operand at the startIndices position and the given sliceDims.
+// The startIndices are clamped such that the slice fits in the operand.
+func (b *Builder) DynamicSlice(operandOp backends.Op, startIndicesOps []backends.Op, sliceDims []int) (backends.Op, error) {
+	opType := backends.OpTypeDynamicSlice
+	inputs, err := b.checkOps(opType.String(), append([]backends.Op{operandOp}, startIndicesOps...)...)
+	if err != nil {
+		return nil, err
+	}
+	operand := inputs[0]
+	if err := checkDynamicStartIndices(opType, operand.shape, inputs[1:]); err != nil {
+		return nil, err
+	}
+	if len(sliceDims) != operand.shape.Rank() {
+		return nil, errors.Errorf("%s: sliceDims (%v) must have one value per axis of the operand (shape=%s)",
+			opType, sliceDims, operand.shape)
+	}
+	for axis, dim := range sliceDims {
+		if dim < 0 || dim > operand.shape.Dimensions[axis] {
+			return nil, errors.Errorf("%s: sliceDims=%v out of bounds for operand shape %s", opType, sliceDims, operand.shape)
+		}
+	}
+	outputShape := shapes.Make(operand.shape.DType, sliceDims...)
+	return b.newNode(opType, outputShape, inputs...), nil
+}
+
+// DynamicUpdateSlice updates the operand with the values given in update, at the position given by startIndices.
+// The startIndices are clamped such that the update fits in the operand.
+func (b *Builder) DynamicUpdateSlice(operandOp, updateOp backends.Op, startIndicesOps []backends.Op) (backends.Op, error) {
+	opType := backends.OpTypeDynamicUpdateSlice
+	inputs, err := b.checkOps(opType.String(), append([]backends.Op{operandOp, updateOp}, startIndicesOps...)...)
+	if err != nil {
+		return nil, err
+	}
+	operand, update := inputs[0], inputs[1]
+	if err := checkDynamicStartIndices(opType, operand.shape, inputs[2:]); err != nil {
+		return nil, err
+	}
+	if update.shape.DType != operand.shape.DType || update.shape.Rank() != operand.shape.Rank() {
+		return nil, errors.Errorf("%s: update (shape=%s) must have the same dtype and rank as the operand (shape=%s)",
+			opType, update.shape, operand.shape)
+	}
+	for axis, dim := range update.shape.Dimensions {
+		if dim > operand.shape.Dimensions[axis] {
+			return nil, errors.Errorf("%s: update (shape=%s) doesn't fit in the operand (shape=%s)",
+				opType, update.shape, operand.shape)
+		}
+	}
+	return b.newNode(opType, operand.shape, inputs...), nil
+}
+
+// checkDynamicStartIndices checks that there is one scalar integer start index per axis of the operand.
+func checkDynamicStartIndices(opType backends.OpType, operandShape shapes.Shape, startIndices []*Node) error {
+	if len(startIndices) != operandShape.Rank() {
+		return errors.Errorf("%s: %d startIndices given, but operand (shape=%s) has rank %d",
+			opType, len(startIndices), operandShape, operandShape.Rank())
+	}
+	for ii, startIndex := range startIndices {
+		if !startIndex.shape.IsScalar() || !startIndex.shape.DType.IsInt() {
+			return errors.Errorf("%s: startIndices must be integer scalars, got startIndices[%d].shape=%s",
+				opType, ii, startIndex.shape)
+		}
+	}
+	return nil
+}
+
 // RngBitGenerator generates the given shape filled with random bits.
 // It takes as input the current random number generator (RNG) state, see RngState or RngStateFromSeed.
 // The algorithm is hard-coded to use Philox algorithm for now.
@@ -24,6 +24,9 @@ type Backend struct {
 	capabilities     backends.Capabilities
 	numDevices       int
 	DotGeneralConfig
+
+	// exportOnly backends have no PJRT plugin, and can only build and export programs. See NewExportOnly.
+	exportOnly bool
 }
 
 // Compile-time check:
@@ -37,12 +40,25 @@ func (backend *Backend) CheckValid() error {
 	if backend == nil {
 		return errors.Errorf("%q backend is nil", BackendName)
 	}
+	if backend.exportOnly {
+		return errors.Errorf("%q backend created with NewExportOnly has no PJRT plugin, it can only be used "+
+			"to build and export StableHLO programs", BackendName)
+	}
 	if backend.plugin == nil {
 		return errors.Errorf("backend %q has already been finalized", BackendName)
 	}
 	return nil
 }
 
+// checkCanBuild returns an error if the backend cannot be used to build computations.
+// Different from CheckValid, it accepts backends created with NewExportOnly.
+func (backend *Backend) checkCanBuild() error {
+	if backend != nil && backend.exportOnly {
+		return nil
+	}
+	return backend.CheckValid()
+}
+
 // Name returns the short name of the backend. E.g.: "stablehlo" for the StableHLO/PJRT plugin.
 func (backend *Backend) Name() string {
 	return BackendName
@@ -55,6 +71,9 @@ func (backend *Backend) String() string {
 
 // Description is a longer description of the Backend that can be used to pretty-print.
 func (backend *Backend) Description() string {
+	if backend != nil && backend.exportOnly {
+		return fmt.Sprintf("%s: export only, no PJRT plugin", BackendName)
+	}
 	if backend.CheckValid() != nil {
 		return fmt.Sprintf("%s: in an invalid state!", BackendName)
 	}
@@ -87,6 +106,7 @@ func (backend *Backend) DeviceDescription(deviceNum backends.DeviceNum) string {
 
 // Finalize releases all the associated resources immediately and makes the backend invalid.
 func (backend *Backend) Finalize() {
+	backend.exportOnly = false
 	if backend.plugin == nil {
 		return
 	}
@@ -103,7 +123,7 @@ func (backend *Backend) Finalize() {
 
 // IsFinalized returns true if the backend is in an invalid state.
 func (backend *Backend) IsFinalized() bool {
-	return backend == nil || backend.plugin == nil
+	return backend == nil || (backend.plugin == nil && !backend.exportOnly)
 }
 
 // castToPJRT casts the buffer to pjrt.Buffer and panics if not possible.
@@ -209,6 +229,9 @@ func (backend *Backend) BufferToFlatData(buffer backends.Buffer, flat any) error
 // BufferFromFlatData transfers data from Go given as a flat slice (of the type corresponding to the shape DType)
 // to the deviceNum, and returns the corresponding Buffer.
 func (backend *Backend) BufferFromFlatData(deviceNum backends.DeviceNum, flat any, shape shapes.Shape) (backends.Buffer, error) {
+	if err := backend.CheckValid(); err != nil {
+		return nil, err
+	}
 	flatV := reflect.ValueOf(flat)
 	if flatV.Kind() != reflect.Slice {
 		return nil, errors.Errorf("backend %q: BuffferFromFlatData, but flat is not a slice, instead it is %T", BackendName, flat)
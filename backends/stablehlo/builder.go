@@ -45,11 +45,14 @@ type argMinMaxKey struct {
 	isMin                    bool
 }
 
-var _ backends.Builder = (*Builder)(nil)
+var (
+	_ backends.Builder           = (*Builder)(nil)
+	_ backends.StableHLOExporter = (*Builder)(nil)
+)
 
 // Builder creates a new builder used to define a new computation.
 func (backend *Backend) Builder(name string) backends.Builder {
-	if err := backend.CheckValid(); err != nil {
+	if err := backend.checkCanBuild(); err != nil {
 		klog.Error(err)
 		return nil
 	}
@@ -82,7 +85,7 @@ func (b *Builder) CheckValid() error {
 	if b == nil || b.builder == nil {
 		return errors.Errorf("builder is nil or undefined for %q", BackendName)
 	}
-	return b.backend.CheckValid()
+	return b.backend.checkCanBuild()
 }
 
 // verifyAndCastValues sanity checks that the values (backends.Op) are valid and created with this builder.
@@ -137,6 +140,11 @@ func (b *Builder) Parameter(name string, shape shapes.Shape) (backends.Op, error
 	if err := b.CheckValid(); err != nil {
 		return nil, err
 	}
+	if shape.IsDynamic() {
+		// The StableHLO programs are generated with static shapes only, see Capabilities.DynamicShapes.
+		return nil, errors.Errorf("backend %q doesn't support dynamic shapes, got %s for parameter %q",
+			BackendName, shape, name)
+	}
 	normalizedName := stablehlo.NormalizeIdentifier(name)
 	if slices.Index(b.parameterNames, normalizedName) != -1 {
 		if name == normalizedName {
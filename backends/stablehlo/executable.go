@@ -24,16 +24,51 @@ func (b *Builder) Compile(outputs ...backends.Op) (backends.Executable, error) {
 	if err := b.CheckValid(); err != nil {
 		return nil, err
 	}
+	if err := b.backend.CheckValid(); err != nil {
+		return nil, errors.WithMessagef(err, "cannot compile computation %q", b.name)
+	}
+	program, outputShapes, err := b.buildProgram(outputs)
+	if err != nil {
+		return nil, err
+	}
+	exec, err := b.backend.client.Compile().WithStableHLO(program).Done()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "backend %q: failed to compile computation %q", BackendName, b.name)
+	}
+	return &Executable{
+		backend:         b.backend,
+		exec:            exec,
+		name:            b.name,
+		parameterNames:  b.parameterNames,
+		parameterShapes: b.parameterShapes,
+		outputShapes:    outputShapes,
+	}, nil
+}
+
+// ExportStableHLO finishes the computation with the given outputs and returns the StableHLO program (MLIR text)
+// instead of compiling it. It implements backends.StableHLOExporter.
+//
+// It works also with backends created with NewExportOnly. Like after Compile, the Builder shouldn't be used anymore.
+func (b *Builder) ExportStableHLO(outputs ...backends.Op) ([]byte, error) {
+	if err := b.CheckValid(); err != nil {
+		return nil, err
+	}
+	program, _, err := b.buildProgram(outputs)
+	return program, err
+}
+
+// buildProgram finishes the "main" function with the given outputs and builds the StableHLO program.
+func (b *Builder) buildProgram(outputs []backends.Op) (program []byte, outputShapes []shapes.Shape, err error) {
 	if len(outputs) == 0 {
-		return nil, errors.Errorf("backend %q, computation %q: you must have at least one output to a computation", BackendName, b.name)
+		return nil, nil, errors.Errorf("backend %q, computation %q: you must have at least one output to a computation", BackendName, b.name)
 	}
 
 	outputNodes, err := b.verifyAndCastValues("Compile", outputs...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	outputValues := make([]*stablehlo.Value, len(outputs))
-	outputShapes := make([]shapes.Shape, len(outputs))
+	outputShapes = make([]shapes.Shape, len(outputs))
 	for ii, outputNode := range outputNodes {
 		outputValues[ii] = outputNode.value
 		outputShapes[ii] = outputNode.shape
@@ -42,27 +77,16 @@ func (b *Builder) Compile(outputs ...backends.Op) (backends.Executable, error) {
 	// Finish StableHLO "main" function:
 	err = b.fn.Return(outputValues[0], outputValues[1:]...)
 	if err != nil {
-		return nil, errors.WithMessagef(err, "backend %q: failed to finish StableHLO program %q", BackendName, b.name)
+		return nil, nil, errors.WithMessagef(err, "backend %q: failed to finish StableHLO program %q", BackendName, b.name)
 	}
-	program, err := b.builder.Build()
+	program, err = b.builder.Build()
 	if err != nil {
-		return nil, errors.WithMessagef(err, "backend %q: failed to build StableHLO from computation %q", BackendName, b.name)
+		return nil, nil, errors.WithMessagef(err, "backend %q: failed to build StableHLO from computation %q", BackendName, b.name)
 	}
 	if klog.V(2).Enabled() {
 		klog.Infof("StableHLO program:\n%s\n", program)
 	}
-	exec, err := b.backend.client.Compile().WithStableHLO(program).Done()
-	if err != nil {
-		return nil, errors.WithMessagef(err, "backend %q: failed to compile computation %q", BackendName, b.name)
-	}
-	return &Executable{
-		backend:         b.backend,
-		exec:            exec,
-		name:            b.name,
-		parameterNames:  b.parameterNames,
-		parameterShapes: b.parameterShapes,
-		outputShapes:    outputShapes,
-	}, nil
+	return program, outputShapes, nil
 }
 
 // CheckValid returns an error if the backend or the executable are not ok -- e.g.: if they have been finalized or the builder
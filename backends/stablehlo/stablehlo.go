@@ -204,3 +204,16 @@ func ShapeFromStableHLO(shape stablehloshapes.Shape) shapes.Shape {
 	}
 	return shapes.Make(shape.DType, slices.Clone(shape.Dimensions)...)
 }
+
+// NewExportOnly returns a backend that is not connected to any PJRT plugin: it can only be used to build
+// computations and export them as StableHLO programs (see Builder.ExportStableHLO and graph.Exec.ExportStableHLO),
+// for instance, in machines without the PJRT plugins installed.
+//
+// Compiling, executing or transferring buffers with it returns an error.
+func NewExportOnly() *Backend {
+	return &Backend{
+		pluginName:   "export-only",
+		capabilities: Capabilities.Clone(),
+		exportOnly:   true,
+	}
+}
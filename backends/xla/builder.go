@@ -114,6 +114,10 @@ func (b *Builder) OpShape(op backends.Op) (shapes.Shape, error) {
 // Parameter creates an input parameter for the computation.
 // During execution of the computation this value will need to be fed, in the same order it is created.
 func (b *Builder) Parameter(name string, shape shapes.Shape) (backends.Op, error) {
+	if shape.IsDynamic() {
+		return nil, errors.Errorf("backend %q doesn't support dynamic shapes, got %s for parameter %q",
+			BackendName, shape, name)
+	}
 	op, err := xlabuilder.Parameter(b.builder, name, len(b.parameterNames), shapeToXShape(shape))
 	if err != nil {
 		return nil, errors.WithMessagef(err, "backend %q: Parameter(%q, %s)", BackendName, name, shape)
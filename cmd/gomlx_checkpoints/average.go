@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/internal/must"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flagAverage = flag.String("average", "",
+		"Averages the checkpoints given (the latest checkpoint of each directory, or the mean of its last -take_mean "+
+			"checkpoints) and saves the result as a new checkpoint in the given output directory. "+
+			"Only float variables are averaged: the other variables and the hyperparameters are taken from the first checkpoint.")
+	flagAverageWeights = flag.String("average_weights", "",
+		"Comma-separated weights used by -average, one per checkpoint given. They are normalized to sum to 1. "+
+			"If not set, all checkpoints have the same weight.")
+)
+
+// Average the checkpoints with the given weights (comma-separated, empty for equal weights) and save the
+// result as a new checkpoint in outputDir.
+func Average(checkpointPaths []string, weightsList string, outputDir string) {
+	weights := parseWeights(weightsList, len(checkpointPaths))
+	ctxs := make([]*context.Context, len(checkpointPaths))
+	for ii, checkpointPath := range checkpointPaths {
+		ctxs[ii] = context.New()
+		_ = loadCheckpoint(ctxs[ii], checkpointPath)
+	}
+
+	weightedSumFn := MustNewExec(backends.MustNew(), func(sum, x, weight *Node) *Node {
+		return Add(sum, Mul(x, weight))
+	}).SetMaxCache(-1)
+	var numAveraged int
+	for v := range ctxs[0].IterVariables() {
+		shape := v.Shape()
+		if !shape.DType.IsFloat() {
+			continue
+		}
+		sum := tensors.FromShape(shape)
+		for ii, ctx := range ctxs {
+			vI := ctx.GetVariableByScopeAndName(v.Scope(), v.Name())
+			if vI == nil {
+				klog.Fatalf("variable %q not found in checkpoint %q", v.ScopeAndName(), checkpointPaths[ii])
+			}
+			if !vI.Shape().Equal(shape) {
+				klog.Fatalf("variable %q has shape %s in checkpoint %q, but shape %s in checkpoint %q",
+					v.ScopeAndName(), shape, checkpointPaths[0], vI.Shape(), checkpointPaths[ii])
+			}
+			newSum := weightedSumFn.MustExec(sum, vI.Value(), shapes.CastAsDType(weights[ii], shape.DType))[0]
+			sum.FinalizeAll()
+			sum = newSum
+		}
+		v.SetValue(sum)
+		numAveraged++
+	}
+	saveToDir(ctxs[0], outputDir, checkpoints.BinGZIP)
+	fmt.Printf("%d variables averaged from %d checkpoints, saved to %q.\n", numAveraged, len(ctxs), outputDir)
+}
+
+// parseWeights parses the comma-separated list of weights, and normalizes them to sum to 1.
+// If weightsList is empty, it returns n equal weights.
+func parseWeights(weightsList string, n int) []float64 {
+	weights := make([]float64, n)
+	if weightsList == "" {
+		for ii := range weights {
+			weights[ii] = 1.0 / float64(n)
+		}
+		return weights
+	}
+	parts := strings.Split(weightsList, ",")
+	if len(parts) != n {
+		klog.Fatalf("%d weights given (%q), but %d checkpoints", len(parts), weightsList, n)
+	}
+	var total float64
+	for ii, part := range parts {
+		weights[ii] = must.M1(strconv.ParseFloat(strings.TrimSpace(part), 64))
+		total += weights[ii]
+	}
+	if total <= 0 {
+		klog.Fatalf("weights %q must sum to a positive value", weightsList)
+	}
+	for ii := range weights {
+		weights[ii] /= total
+	}
+	return weights
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saveTestCheckpoint saves a checkpoint with the given variables to a new temporary directory.
+func saveTestCheckpoint(t *testing.T, vars map[string]any) string {
+	dir, err := os.MkdirTemp("", "test_gomlx_checkpoints")
+	require.NoError(t, err)
+	ctx := context.New()
+	ctx.SetParam("learning_rate", 0.01)
+	for scopeAndName, value := range vars {
+		scope, name := context.SplitScope(scopeAndName)
+		ctx.InAbsPath(scope).VariableWithValue(name, value)
+	}
+	checkpoint, err := checkpoints.Build(ctx).Dir(dir).Keep(-1).Done()
+	require.NoError(t, err)
+	require.NoError(t, checkpoint.Save())
+	return dir
+}
+
+func TestAverage(t *testing.T) {
+	dir1 := saveTestCheckpoint(t, map[string]any{"/model/w": []float32{1, 2}, "/step": int64(10)})
+	defer func() { _ = os.RemoveAll(dir1) }()
+	dir2 := saveTestCheckpoint(t, map[string]any{"/model/w": []float32{4, 8}, "/step": int64(20)})
+	defer func() { _ = os.RemoveAll(dir2) }()
+	outputDir, err := os.MkdirTemp("", "test_gomlx_checkpoints")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(outputDir) }()
+
+	Average([]string{dir1, dir2}, "2,1", outputDir)
+	ctx := context.New()
+	_ = loadCheckpoint(ctx, outputDir)
+	assert.Equal(t, []float32{2, 4}, ctx.GetVariableByScopeAndName("/model", "w").Value().Value())
+	assert.Equal(t, int64(10), ctx.GetVariableByScopeAndName("/", "step").Value().Value())
+	learningRate, found := ctx.GetParam("learning_rate")
+	require.True(t, found)
+	assert.Equal(t, 0.01, learningRate)
+}
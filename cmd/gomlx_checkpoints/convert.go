@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/gomlx/gomlx/internal/must"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/core/tensors/numpy"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/gomlx/gomlx/pkg/ml/context/safetensors"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flagConvert = flag.String("convert", "",
+		"Converts the latest checkpoint (or the mean of the last -take_mean checkpoints) to the given format: "+
+			"\"gzip\", \"uncompressed\" or \"sharded\" save a new checkpoint in that format (in the -output directory "+
+			"if given, otherwise in the checkpoint directory itself); "+
+			"\"npz\" or \"safetensors\" export the variables to the file given by -output, named like \"scope.subscope.name\".")
+	flagOutput = flag.String("output", "", "Output path used by -convert.")
+)
+
+// Convert the latest checkpoint in checkpointPath to the given format. See -convert.
+func Convert(checkpointPath, format, outputPath string) {
+	switch format {
+	case "npz", "safetensors":
+		if outputPath == "" {
+			klog.Fatalf("-convert=%s requires -output to be set", format)
+		}
+		ctx := context.New()
+		_ = loadCheckpoint(ctx, checkpointPath)
+		if format == "safetensors" {
+			must.M(safetensors.WriteContextFile(ctx, outputPath, nil))
+		} else {
+			tensorsMap := make(map[string]*tensors.Tensor)
+			for v := range ctx.IterVariables() {
+				tensorsMap[safetensors.DefaultTensorName(v.Scope(), v.Name())] = v.Value()
+			}
+			must.M(numpy.ToNpzFile(tensorsMap, outputPath))
+		}
+		fmt.Printf("Checkpoint %q exported to %q.\n", checkpointPath, outputPath)
+		return
+	}
+
+	var binFormat checkpoints.BinFormat
+	switch format {
+	case "gzip":
+		binFormat = checkpoints.BinGZIP
+	case "uncompressed":
+		binFormat = checkpoints.BinUncompressed
+	case "sharded":
+		binFormat = checkpoints.BinSharded
+	default:
+		klog.Fatalf("unknown format %q for -convert, valid values are gzip, uncompressed, sharded, npz and safetensors", format)
+	}
+	ctx := context.New()
+	if outputPath != "" {
+		_ = loadCheckpoint(ctx, checkpointPath)
+		saveToDir(ctx, outputPath, binFormat)
+		fmt.Printf("Checkpoint %q converted to %q format in %q.\n", checkpointPath, binFormat, outputPath)
+		return
+	}
+	checkpoint := loadCheckpointWithConfig(ctx, checkpointPath, func(config *checkpoints.Config) {
+		config.WithCompression(binFormat)
+	})
+	must.M(checkpoint.Save())
+	fmt.Printf("Checkpoint %q converted to %q format, new checkpoint saved.\n", checkpointPath, binFormat)
+}
+
+// saveToDir saves the variables and hyperparameters of ctx as a new checkpoint in outputDir,
+// using the given format. The outputDir must not already have checkpoints.
+func saveToDir(ctx *context.Context, outputDir string, binFormat checkpoints.BinFormat) {
+	newCtx := context.New()
+	checkpoint := must.M1(checkpoints.Build(newCtx).Dir(outputDir).Keep(-1).WithCompression(binFormat).Done())
+	if must.M1(checkpoint.HasCheckpoints()) {
+		klog.Fatalf("output directory %q already has checkpoints", outputDir)
+	}
+	ctx.EnumerateParams(func(scope, key string, value any) {
+		newCtx.InAbsPath(scope).SetParam(key, value)
+	})
+	for v := range ctx.IterVariables() {
+		newCtx.InAbsPath(v.Scope()).VariableWithValue(v.Name(), v.Value()).SetTrainable(v.Trainable)
+	}
+	must.M(checkpoint.Save())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomlx/gomlx/pkg/core/tensors/numpy"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/gomlx/gomlx/pkg/ml/context/safetensors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	dir := saveTestCheckpoint(t, map[string]any{"/model/w": []float32{1, 2}})
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// Convert in place to the sharded format.
+	Convert(dir, "sharded", "")
+	checkpoint, err := checkpoints.Build(context.New()).Dir(dir).Done()
+	require.NoError(t, err)
+	list, err := checkpoint.ListCheckpoints()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.DirExists(t, path.Join(dir, list[1]+checkpoints.ShardsDirSuffix))
+	ctx := context.New()
+	_ = loadCheckpoint(ctx, dir)
+	assert.Equal(t, []float32{1, 2}, ctx.GetVariableByScopeAndName("/model", "w").Value().Value())
+
+	// Export to npz and safetensors.
+	npzPath := path.Join(dir, "model.npz")
+	Convert(dir, "npz", npzPath)
+	tensorsMap, err := numpy.FromNpzFile(npzPath)
+	require.NoError(t, err)
+	require.Contains(t, tensorsMap, "model.w")
+	assert.Equal(t, []float32{1, 2}, tensorsMap["model.w"].Value())
+
+	safetensorsPath := path.Join(dir, "model.safetensors")
+	Convert(dir, "safetensors", safetensorsPath)
+	tensorsMap, err = safetensors.ReadFile(safetensorsPath)
+	require.NoError(t, err)
+	require.Contains(t, tensorsMap, "model.w")
+	assert.Equal(t, []float32{1, 2}, tensorsMap["model.w"].Value())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gomlx/gomlx/backends"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/sets"
+	"github.com/gomlx/gopjrt/dtypes"
+	"golang.org/x/exp/maps"
+	"k8s.io/klog/v2"
+)
+
+var flagDiff = flag.Bool("diff", false,
+	"Compares the first two checkpoints given: lists the variables under --scope with their shapes and the L2 norm and "+
+		"max absolute value of their difference (changes are highlighted), and the hyperparameters that changed.")
+
+// Diff compares the variables and hyperparameters of 2 checkpoints.
+func Diff(ctxs, scopedCtxs []*context.Context, names []string) {
+	if len(ctxs) != 2 {
+		klog.Fatalf("-diff requires exactly 2 checkpoints, %d given", len(ctxs))
+	}
+	DiffVariables(scopedCtxs, names)
+	DiffParams(ctxs, names)
+}
+
+// DiffVariables lists the variables of the 2 contexts, their shapes and the L2 norm and max absolute value of their
+// difference. Variables that differ are highlighted.
+func DiffVariables(scopedCtxs []*context.Context, names []string) {
+	fmt.Println(titleStyle.Render(fmt.Sprintf("Variables differences in scope %q", scopedCtxs[0].Scope())))
+	diffFn := MustNewExec(backends.MustNew(), func(a, b *Node) (l2, maxAbs *Node) {
+		diff := Sub(ConvertDType(a, dtypes.Float64), ConvertDType(b, dtypes.Float64))
+		l2 = Sqrt(ReduceAllSum(Square(diff)))
+		maxAbs = ReduceAllMax(Abs(diff))
+		return
+	}).SetMaxCache(-1)
+
+	// Collect variables of both checkpoints.
+	varsPerCtx := make([]map[string]*context.Variable, len(scopedCtxs))
+	keysSet := sets.Make[string]()
+	for ii, ctx := range scopedCtxs {
+		varsPerCtx[ii] = make(map[string]*context.Variable)
+		ctx.EnumerateVariablesInScope(func(v *context.Variable) {
+			key := v.ScopeAndName()
+			keysSet.Insert(key)
+			varsPerCtx[ii][key] = v
+		})
+	}
+	keys := maps.Keys(keysSet)
+	slices.Sort(keys)
+
+	table := newPlainTableWithReds(true)
+	table.Table.Headers("Scope", "Name", "Shape: "+names[0], "Shape: "+names[1], "L2(diff)", "MaxAV(diff)")
+	var numChanged int
+	for _, key := range keys {
+		vA, vB := varsPerCtx[0][key], varsPerCtx[1][key]
+		v := vA
+		if v == nil {
+			v = vB
+		}
+		row := []string{v.Scope(), v.Name(), "<missing>", "<missing>", "", ""}
+		if vA != nil {
+			row[2] = vA.Shape().String()
+		}
+		if vB != nil {
+			row[3] = vB.Shape().String()
+		}
+		changed := row[2] != row[3]
+		if !changed && !vA.Shape().DType.IsComplex() {
+			results := diffFn.MustExec(vA.Value(), vB.Value())
+			l2, maxAbs := results[0].Value().(float64), results[1].Value().(float64)
+			row[4] = fmt.Sprintf("%.3g", l2)
+			row[5] = fmt.Sprintf("%.3g", maxAbs)
+			changed = maxAbs != 0
+		}
+		if changed {
+			numChanged++
+		}
+		table.Row(changed, row...)
+	}
+	fmt.Println(table.Table.Render())
+	fmt.Printf("  %d out of %d variables differ.\n", numChanged, len(keys))
+	if *flagGlossary {
+		fmt.Printf("  %s:\n", sectionStyle.Render("Glossary"))
+		fmt.Printf("   ◦ %s: %s\n", emphasisStyle.Render("L2(diff)"), italicStyle.Render("L2 norm of the difference of the variable values"))
+		fmt.Printf("   ◦ %s: %s\n", emphasisStyle.Render("MaxAV(diff)"), italicStyle.Render("Max Absolute Value of the difference of the variable values"))
+	}
+}
+
+// DiffParams lists the hyperparameters whose values differ in the 2 contexts.
+func DiffParams(ctxs []*context.Context, names []string) {
+	fmt.Println(titleStyle.Render("Hyperparameters differences"))
+	type scopeKey struct{ Scope, Key string }
+	valuesPerCtx := make([]map[scopeKey]string, len(ctxs))
+	keysSet := sets.Make[scopeKey]()
+	for ii, ctx := range ctxs {
+		valuesPerCtx[ii] = make(map[scopeKey]string)
+		ctx.EnumerateParams(func(scope, key string, value any) {
+			sk := scopeKey{Scope: scope, Key: key}
+			keysSet.Insert(sk)
+			valuesPerCtx[ii][sk] = fmt.Sprintf("%v", value)
+		})
+	}
+	keys := maps.Keys(keysSet)
+	slices.SortFunc(keys, func(a, b scopeKey) int {
+		if cmp := strings.Compare(a.Scope, b.Scope); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	table := newPlainTable(true)
+	table.Headers("Scope", "Name", names[0], names[1])
+	var numChanged int
+	for _, sk := range keys {
+		valueA, foundA := valuesPerCtx[0][sk]
+		valueB, foundB := valuesPerCtx[1][sk]
+		if foundA && foundB && valueA == valueB {
+			continue
+		}
+		if !foundA {
+			valueA = "<missing>"
+		}
+		if !foundB {
+			valueB = "<missing>"
+		}
+		table.Row(sk.Scope, sk.Key, valueA, valueB)
+		numChanged++
+	}
+	if numChanged == 0 {
+		fmt.Println("  No hyperparameters differ.")
+		return
+	}
+	fmt.Println(table.Render())
+}
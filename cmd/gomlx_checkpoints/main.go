@@ -1,6 +1,11 @@
 // gomlx_checkpoints reports back on model size (and memory) usage (--summary), individual variables shapes and sizes (--vars),
 // hyperparameters used with the model (--params) or metrics collected during model training (--metrics, --metrics_labels).
 //
+// It can also compare two checkpoints (--diff), average checkpoints (--average), convert them to other formats
+// (--convert) or rename the scopes of variables (--rename).
+//
+// It reads checkpoints in any of the formats saved by package checkpoints, including the sharded format.
+//
 // See gomlx_checkpoint --help for details.
 package main
 
@@ -13,6 +18,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/gomlx/gomlx/backends"
 	"github.com/gomlx/gomlx/internal/must"
 	"github.com/gomlx/gomlx/pkg/ml/context"
 	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
@@ -35,6 +41,10 @@ var (
 	flagBackup   = flag.Bool("backup", false, "Set to true to make a backup of the most recent checkpoint, under the 'backup' subdirectory.")
 	flagGlossary = flag.Bool("glossary", true, "Whether to list glossary of abbreviation on the bottom of tables.")
 
+	flagTakeMean = flag.Int("take_mean", 1,
+		"Loads the mean of the last <n> checkpoints of each checkpoint directory, instead of only the latest one "+
+			"(see checkpoints.Config.TakeMean). Use -1 to take the mean of all checkpoints in the directory.")
+
 	flagLoop = flag.Duration("loop", 0, "Sets looping with the given period. "+
 		"This is used to monitor the training of a program, usually used in conjunction with --metrics. "+
 		"It will also clear the terminal in between printing out the metrics")
@@ -49,6 +59,8 @@ func main() {
 		pf("\n\t$ gomlx_checkpoints [flags...] <checkpoint_path> [<checkpoint_path2> ...]\n" +
 			"\ngomlx_checkpoints reports back on model size (and memory) usage (--summary), individual variables shapes and sizes (--vars), " +
 			"hyperparameters used with the model (--params) or metrics collected during model training (--metrics, --metrics_labels).\n" +
+			"It can also compare two checkpoints (--diff), average checkpoints (--average), convert them to other formats (--convert) " +
+			"or rename the scopes of variables (--rename).\n" +
 			"\n\t<checkpoint_path> is the path of a checkpoint directory used to save a GoMLX model (see package github.com/gomlx/gomlx/pkg/ml/context/checkpoints)\n" +
 			"\tSome flags support more than one checkpoint, which can be used to compare models.\n\n" +
 			"Flags:\n\n")
@@ -74,6 +86,18 @@ func main() {
 		PerturbVars(args[0], *flagPerturbVars)
 	}
 
+	if *flagRename != "" {
+		RenameScopes(args[0], *flagRename, *flagRenameTo)
+	}
+
+	if *flagConvert != "" {
+		Convert(args[0], *flagConvert, *flagOutput)
+	}
+
+	if *flagAverage != "" {
+		Average(args, *flagAverageWeights, *flagAverage)
+	}
+
 	if *flagAll {
 		*flagSummary = true
 		*flagParams = true
@@ -110,9 +134,8 @@ func Reports(checkpointPaths []string) {
 	scopedCtxs := make([]*context.Context, 0, len(checkpointPaths))
 	for _, checkpointPath := range checkpointPaths {
 		ctx := context.New()
-		if *flagSummary || *flagParams || *flagVars {
-			_ = must.M1(checkpoints.Build(ctx).
-				Dir(checkpointPath).Immediate().Done())
+		if *flagSummary || *flagParams || *flagVars || *flagDiff {
+			_ = loadCheckpoint(ctx, checkpointPath)
 		}
 		scopedCtx := ctx
 		if *flagScope != "" {
@@ -134,6 +157,9 @@ func Reports(checkpointPaths []string) {
 	if *flagParams {
 		Params(ctxs, scopedCtxs, names)
 	}
+	if *flagDiff {
+		Diff(ctxs, scopedCtxs, names)
+	}
 	if *flagMetrics || *flagMetricsLabels || *flagPlot {
 		metrics(checkpointPaths, names)
 	}
@@ -146,6 +172,25 @@ func Reports(checkpointPaths []string) {
 
 }
 
+// loadCheckpoint loads immediately the latest checkpoint (or the mean of the last -take_mean checkpoints) in
+// checkpointPath into ctx. The returned handler doesn't remove any checkpoints when saving.
+func loadCheckpoint(ctx *context.Context, checkpointPath string) *checkpoints.Handler {
+	return loadCheckpointWithConfig(ctx, checkpointPath, nil)
+}
+
+// loadCheckpointWithConfig is like loadCheckpoint, but calls configFn (if not nil) to further configure the
+// checkpoint before it is loaded.
+func loadCheckpointWithConfig(ctx *context.Context, checkpointPath string, configFn func(config *checkpoints.Config)) *checkpoints.Handler {
+	config := checkpoints.Build(ctx).Dir(checkpointPath).Keep(-1).Immediate()
+	if *flagTakeMean != 1 {
+		config.TakeMean(*flagTakeMean, backends.MustNew())
+	}
+	if configFn != nil {
+		configFn(config)
+	}
+	return must.M1(config.Done())
+}
+
 func Backup(checkpointPath string) {
 	ctx := context.New()
 	checkpoint := must.M1(checkpoints.Build(ctx).
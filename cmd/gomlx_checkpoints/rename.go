@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gomlx/gomlx/internal/must"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/sets"
+	"k8s.io/klog/v2"
+)
+
+var (
+	flagRename = flag.String("rename", "",
+		"Regular expression matched against the scope of each variable: the matched part is replaced by -rename_to, "+
+			"and a new checkpoint is saved. E.g.: -rename='^/model/' -rename_to='/encoder/'.")
+	flagRenameTo = flag.String("rename_to", "",
+		"Replacement for the part of the scopes matched by -rename. It can refer to capture groups with ${1}, ${2}, etc.")
+)
+
+// RenameScopes of the variables in the latest checkpoint: the part of the scopes matching the regular expression
+// pattern is replaced by replacement (see regexp.Regexp.ReplaceAllString). A new checkpoint is saved.
+func RenameScopes(checkpointPath, pattern, replacement string) {
+	re := must.M1(regexp.Compile(pattern))
+	ctx := context.New()
+	checkpoint := loadCheckpoint(ctx, checkpointPath)
+
+	type renamedVar struct {
+		oldScope, newScope, name string
+		value                    *tensors.Tensor
+		trainable                bool
+	}
+	var renames []renamedVar
+	oldNames := sets.Make[string]()
+	for v := range ctx.IterVariables() {
+		newScope := re.ReplaceAllString(v.Scope(), replacement)
+		if newScope == v.Scope() {
+			continue
+		}
+		if !strings.HasPrefix(newScope, context.ScopeSeparator) {
+			klog.Fatalf("variable %q would be renamed to scope %q, which doesn't start with %q",
+				v.ScopeAndName(), newScope, context.ScopeSeparator)
+		}
+		if newScope != context.RootScope {
+			newScope = strings.TrimSuffix(newScope, context.ScopeSeparator)
+		}
+		renames = append(renames, renamedVar{
+			oldScope: v.Scope(), newScope: newScope, name: v.Name(), value: v.Value(), trainable: v.Trainable})
+		oldNames.Insert(v.ScopeAndName())
+	}
+	if len(renames) == 0 {
+		// No changes needed.
+		fmt.Printf("No variable scopes matched %q.\n", pattern)
+		return
+	}
+
+	// Check for collisions.
+	newNames := sets.Make[string]()
+	for _, r := range renames {
+		newVarName := context.JoinScope(r.newScope, r.name)
+		if newNames.Has(newVarName) {
+			klog.Fatalf("more than one variable would be renamed to %q", newVarName)
+		}
+		newNames.Insert(newVarName)
+		if !oldNames.Has(newVarName) && ctx.GetVariableByScopeAndName(r.newScope, r.name) != nil {
+			klog.Fatalf("variable %q would be renamed to %q, which already exists",
+				context.JoinScope(r.oldScope, r.name), newVarName)
+		}
+	}
+
+	for _, r := range renames {
+		ctx.DeleteVariable(r.oldScope, r.name)
+	}
+	for _, r := range renames {
+		ctx.InAbsPath(r.newScope).VariableWithValue(r.name, r.value).SetTrainable(r.trainable)
+	}
+	must.M(checkpoint.Save())
+	fmt.Printf("%d variables renamed, new checkpoint saved.\n", len(renames))
+}
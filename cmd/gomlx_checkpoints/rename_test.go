@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameScopes(t *testing.T) {
+	dir := saveTestCheckpoint(t, map[string]any{
+		"/model/layer_0/w": []float32{1, 2},
+		"/model/layer_1/w": []float32{3, 4},
+		"/other/w":         []float32{5, 6},
+	})
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	RenameScopes(dir, `^/model/layer_(\d+)$`, "/encoder/block_${1}")
+	ctx := context.New()
+	_ = loadCheckpoint(ctx, dir)
+	assert.Nil(t, ctx.GetVariableByScopeAndName("/model/layer_0", "w"))
+	require.NotNil(t, ctx.GetVariableByScopeAndName("/encoder/block_0", "w"))
+	assert.Equal(t, []float32{1, 2}, ctx.GetVariableByScopeAndName("/encoder/block_0", "w").Value().Value())
+	require.NotNil(t, ctx.GetVariableByScopeAndName("/encoder/block_1", "w"))
+	assert.Equal(t, []float32{3, 4}, ctx.GetVariableByScopeAndName("/encoder/block_1", "w").Value().Value())
+	require.NotNil(t, ctx.GetVariableByScopeAndName("/other", "w"))
+}
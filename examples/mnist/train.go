@@ -40,13 +40,16 @@ import (
 	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
 	"github.com/gomlx/gomlx/pkg/ml/train/optimizers/cosineschedule"
 	"github.com/gomlx/gomlx/ui/commandline"
+	"github.com/gomlx/gomlx/ui/dashboard"
 	"github.com/gomlx/gomlx/ui/gonb/plotly"
+	"github.com/gomlx/gomlx/ui/tensorboard"
 	"github.com/gomlx/gopjrt/dtypes"
 )
 
 var ModelList = []string{"linear", "cnn"}
 
-var excludeParams = []string{"data_dir", "train_steps", "num_checkpoints", "plots"}
+var excludeParams = []string{"data_dir", "train_steps", "num_checkpoints", "plots", "tensorboard", "dashboard",
+	optimizers.ParamGradientsTracer}
 
 type ContextFn func(ctx *context.Context) *context.Context
 
@@ -78,6 +81,14 @@ func CreateDefaultContext() *context.Context {
 		//	$ gomlx_checkpoints --metrics --metrics_labels --metrics_types=accuracy  --metrics_names='E(Tra)/#loss,E(Val)/#loss' --loop=3s "<checkpoint_path>"
 		plotly.ParamPlots: false,
 
+		// tensorboard.ParamTensorBoard writes TensorBoard event files to the checkpoint directory (if one is given),
+		// that can be visualized with `tensorboard --logdir=<checkpoint_path>`.
+		tensorboard.ParamTensorBoard: false,
+
+		// dashboard.ParamDashboard is the address where to serve a live training dashboard, e.g. "localhost:8080".
+		// If empty, the dashboard is disabled.
+		dashboard.ParamDashboard: "",
+
 		optimizers.ParamOptimizer:       "adamw",
 		optimizers.ParamLearningRate:    1e-4,
 		optimizers.ParamAdamEpsilon:     1e-7,
@@ -206,6 +217,35 @@ func TrainModel(ctx *context.Context, dataDir, checkpointPath string, paramsSet
 			WithBatchNormalizationAveragesUpdate(trainEvalDS)
 	}
 
+	// Attach TensorBoard event files writer, also at exponential steps, in the checkpoint directory.
+	if checkpoint != nil && context.GetParamOr(ctx, tensorboard.ParamTensorBoard, false) {
+		tb, err := tensorboard.AttachToLoop(loop, checkpoint.Dir())
+		if err != nil {
+			return errors.WithMessagef(err, "failed to create TensorBoard event files in %s", checkpoint.Dir())
+		}
+		defer func() { _ = tb.Close() }()
+		tb.WithDatasets(trainEvalDS, validationEvalDS).
+			WithBatchNormalizationAveragesUpdate(trainEvalDS).
+			WithHParams().
+			WithVariableHistograms().
+			WithGradientHistograms().
+			ScheduleExponential(10, 1.2)
+	}
+
+	// Serve the live training dashboard.
+	if addr := context.GetParamOr(ctx, dashboard.ParamDashboard, ""); addr != "" {
+		db, err := dashboard.AttachToLoop(loop, addr)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+		fmt.Printf("\t- dashboard in %s\n", db.URL())
+		db.WithCheckpoint(checkpoint).
+			WithDatasets(trainEvalDS, validationEvalDS).
+			WithBatchNormalizationAveragesUpdate(trainEvalDS).
+			ScheduleExponential(10, 1.2)
+	}
+
 	// Loop for given number of steps.
 	numTrainSteps := context.GetParamOr(ctx, "train_steps", 0)
 	globalStep := int(optimizers.GetGlobalStep(ctx))
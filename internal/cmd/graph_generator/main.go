@@ -85,6 +85,7 @@ func buildMethodInfo() (methods []*MethodInfo) {
 			pi := &ParameterInfo{
 				Name:        param.Name,
 				BackendType: param.Type,
+				IsStatic:    true,
 			}
 			mi.Inputs = append(mi.Inputs, pi)
 			switch pi.BackendType {
@@ -92,12 +93,14 @@ func buildMethodInfo() (methods []*MethodInfo) {
 				pi.BackendType = "backends.Op"
 				pi.GraphType = "*Node"
 				pi.ConvertStatement = fmt.Sprintf("%s.outputOps[0]", param.Name)
+				pi.IsStatic = false
 				mi.OpInputs = append(mi.OpInputs, param.Name)
 				pi.Format = "[#%d]"
 				pi.FormatValue = fmt.Sprintf("ni.%s.Id()", param.Name)
 			case "...Op":
 				pi.BackendType = "...backends.Op"
 				pi.GraphType = "...*Node"
+				pi.IsStatic = false
 				mi.OpInputSlices = append(mi.OpInputSlices, param.Name)
 				pi.NodeInputType = "[]*Node"
 				pi.CopyStatement = fmt.Sprintf("slices.Clone(%s)", param.Name)
@@ -109,6 +112,7 @@ func buildMethodInfo() (methods []*MethodInfo) {
 			case "[]Op":
 				pi.BackendType = "[]backends.Op"
 				pi.GraphType = "[]*Node"
+				pi.IsStatic = false
 				mi.OpInputSlices = append(mi.OpInputSlices, param.Name)
 				pi.NodeInputType = "[]*Node"
 				pi.CopyStatement = fmt.Sprintf("slices.Clone(%s)", param.Name)
@@ -161,6 +165,7 @@ func buildMethodInfo() (methods []*MethodInfo) {
 				pi.FormatValue = "ni." + pi.Name
 			}
 			mi.HasGraph = len(mi.OpInputSlices) == 0 && len(mi.OpInputs) == 0
+			mi.HasStaticInputs = mi.HasStaticInputs || pi.IsStatic
 		}
 		for _, output := range raw.Outputs[:len(raw.Outputs)-1] { // Skip the error.
 			mi.OutputNames = append(mi.OutputNames, output.Name)
@@ -181,6 +186,7 @@ type MethodInfo struct {
 	Exported, Excluded     bool
 	Comments               []string
 	StopGradient           bool
+	HasStaticInputs        bool
 
 	HasMultipleOutputs bool
 	OutputNames        []string
@@ -192,6 +198,9 @@ type ParameterInfo struct {
 	BackendType, GraphType, NodeInputType string
 	CopyStatement, ConvertStatement       string
 	Format, FormatValue                   string
+
+	// IsStatic is true for parameters that are not graph nodes (Op), e.g.: axes, shapes, etc.
+	IsStatic bool
 }
 
 const (
@@ -249,6 +258,18 @@ func (ni *nodeInputs{{.BackendName}}) String() string {
 {{end}}	)
 }
 
+{{- if .HasStaticInputs}}
+
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputs{{.BackendName}}) staticInputs() map[string]any {
+	return map[string]any{
+{{- range .Inputs}}{{if .IsStatic}}
+		"{{.Name}}": ni.{{.Name}},
+{{- end}}{{end}}
+	}
+}
+{{- end}}
+
 {{- if not .Exported}}
 // {{.GraphName}} is a Graph wrapper for the backend.Builder.{{.BackendName}} method.
 {{- else}}
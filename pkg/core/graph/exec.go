@@ -23,6 +23,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomlx/gomlx/backends"
@@ -163,6 +164,10 @@ type LoggerFn func(graph *Graph, messages []string, values []*tensors.Tensor, no
 // The usual solution is to use shapes with dimensions in a power scale (for instance, powers of 2) and
 // use padding and masking of tensors for unused slices of the input.
 //
+// Alternatively, an axis (usually the batch axis) can be marked as dynamic with SetDynamicAxis, and Exec
+// compiles the graph once with a dynamic dimension, if the backend supports it, or otherwise takes care of
+// padding it to a few bucket sizes.
+//
 // For safety concerns, there are a maximum number of different instantiations of the graph.
 // It can be set or disabled with SetMaxCache.
 type Exec struct {
@@ -183,6 +188,20 @@ type Exec struct {
 	setSideParams SideParamsFn
 	loggerFn      LoggerFn
 
+	// profiler, if set, records the building, compilation and execution of the graphs.
+	profiler atomic.Pointer[Profiler]
+
+	// dynamicAxis, if >= 0, is built with shapes.DynamicDim for the dynamicArgs arguments, or if not supported
+	// (or dynamicPadding is set) padded to one of the dynamicBuckets sizes, and trimmed back for the dynamicOutputs
+	// outputs.
+	// See SetDynamicAxis.
+	dynamicAxis            int
+	dynamicArgs            []int
+	dynamicOutputs         []int
+	dynamicOutputsOffsetFn func(g *Graph) int
+	dynamicBuckets         DynamicBucketFn
+	dynamicPadding         atomic.Bool
+
 	// Protects cache structure.
 	cacheMu sync.Mutex
 	cache   []*execGraphCacheEntry
@@ -193,8 +212,9 @@ type Exec struct {
 type execGraphCacheEntry struct {
 	argsShapes     []shapes.Shape
 	graph          *Graph
-	numOutputs     int      // Number of flattened outputs for this graph, including logged nodes.
-	loggedMessages []string // Messages for logged nodes.
+	numOutputs     int            // Number of flattened outputs for this graph, including logged nodes.
+	outputShapes   []shapes.Shape // Shapes of the flattened outputs, including logged nodes.
+	loggedMessages []string       // Messages for logged nodes.
 	loggedNodeIDs  []NodeId
 }
 
@@ -213,12 +233,14 @@ const DefaultExecMaxCacheSize = 32
 func NewExecAny(backend backends.Backend, graphFn any) (*Exec, error) {
 	funcName := runtime.FuncForPC(reflect.ValueOf(graphFn).Pointer()).Name()
 	e := &Exec{
-		backend:      backend,
-		name:         fmt.Sprintf("Exec:%s", funcName),
-		deviceNum:    0,
-		graphFn:      graphFn,
-		maxCacheSize: DefaultExecMaxCacheSize,
-		loggerFn:     DefaultNodeLogger,
+		backend:        backend,
+		name:           fmt.Sprintf("Exec:%s", funcName),
+		deviceNum:      0,
+		graphFn:        graphFn,
+		maxCacheSize:   DefaultExecMaxCacheSize,
+		loggerFn:       DefaultNodeLogger,
+		dynamicAxis:    -1,
+		dynamicBuckets: PowerOfTwoBuckets,
 	}
 	if err := e.parseGraphFn(); err != nil {
 		return nil, err
@@ -373,6 +395,21 @@ func (e *Exec) GetNodeLogger() LoggerFn {
 	return e.loggerFn
 }
 
+// SetProfiler sets a Profiler to record the building, compilation and execution of the graphs, see Profiler for
+// details. It can be changed at any time, including while the graphs are being executed in other goroutines.
+//
+// Set it to nil to disable profiling (the default).
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetProfiler(profiler *Profiler) *Exec {
+	e.profiler.Store(profiler)
+	return e
+}
+
+// Profiler returns the Profiler set with SetProfiler, or nil if profiling is disabled.
+func (e *Exec) Profiler() *Profiler {
+	return e.profiler.Load()
+}
+
 // Exec executes the computation with the given arguments.
 //
 // It the input arguments shape has never been seen before, it JIT-compiles a new computation graph for that shape,
@@ -443,13 +480,29 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 			"# of arguments to call (#args=%d) don't match # arguments to the graph function (#args=%d) for %q",
 			len(args), e.numInputs, e.Name())
 	}
+	// Dynamic axis: use the graph built with dynamic shapes, or pad the arguments.
+	profiler := e.profiler.Load()
+	var entry *execGraphCacheEntry
+	dynamicDim, paddedDim := -1, -1
+	if e.dynamicAxis >= 0 {
+		entry = e.findOrCreateDynamicGraph(args, profiler)
+		if entry == nil {
+			args, dynamicDim, paddedDim = e.padDynamicArgs(args)
+		}
+	}
 
 	// Convert args to tensors.
 	// Note there may be more parameters, set with Exec.setSideParams later.
 	argsAsBuffer := make([]backends.Buffer, len(args))
 	argsShapes := make([]shapes.Shape, len(args))
 	argsDonate := make([]bool, len(args))
+	var transferEvents []ProfileEvent
 	for ii, arg := range args {
+		var start time.Time
+		transfer := profiler != nil && isTransferToDevice(arg, e.deviceNum)
+		if transfer {
+			start = time.Now()
+		}
 		err := exceptions.TryCatch[error](func() {
 			argsAsBuffer[ii], argsShapes[ii], argsDonate[ii] = anyToBuffer(e.backend, e.deviceNum, arg)
 		})
@@ -457,10 +510,16 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 			panic(errors.WithMessagef(err, "Failed to convert argument #%d of %d to device(%d) -- type %T: %v",
 				ii, len(args), e.deviceNum, args[ii], args[ii]))
 		}
+		if transfer {
+			transferEvents = append(transferEvents, ProfileEvent{Type: ProfileTransfer,
+				Name: ProfileTransfer.String(), NodeId: InvalidNodeId, OutputShapes: []shapes.Shape{argsShapes[ii]},
+				Start: start, Duration: time.Since(start), Bytes: argsShapes[ii].Memory()})
+		}
 	}
-
 	// Get or build the graph.
-	entry := e.findOrCreateGraph(argsShapes)
+	if entry == nil {
+		entry = e.findOrCreateGraph(argsShapes, profiler)
+	}
 	if entry == nil {
 		exceptions.Panicf(
 			"maximum cache size of %d reached for %q, cannot create another graph -- "+
@@ -469,6 +528,15 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 				"the cache size with executable.SetMaxCache()", e.maxCacheSize, e.Name())
 	}
 	g := entry.graph
+	if paddedDim != -1 {
+		e.checkDynamicOutputs(entry, paddedDim)
+	}
+	if len(transferEvents) > 0 {
+		for ii := range transferEvents {
+			transferEvents[ii].Graph = g.name
+		}
+		profiler.Record(transferEvents...)
+	}
 
 	// Now that the graph is created, we know the exact number of parameters: if the graph building function created
 	// new graph.Parameter, we may need to include those in our argsAsBuffer and argsDonate accordingly.
@@ -498,7 +566,7 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 	if !execute {
 		return nil, g
 	}
-	outputs := g.RunWithBuffers(argsAsBuffer, argsDonate)
+	outputs := g.runWithBuffers(argsAsBuffer, argsDonate, profiler)
 
 	// Call the logger on logged nodes, even if no node is marked for logging (it serves as a hook).
 	numGraphFnOutputs := entry.numOutputs - len(entry.loggedMessages)
@@ -512,6 +580,9 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 	if len(outputs) != numGraphFnOutputs {
 		outputs = outputs[:numGraphFnOutputs]
 	}
+	if paddedDim != dynamicDim {
+		e.trimDynamicOutputs(entry, outputs, dynamicDim)
+	}
 	return outputs, g
 }
 
@@ -519,12 +590,49 @@ func (e *Exec) compileAndExecute(execute bool, args ...any) ([]*tensors.Tensor,
 // shapes. It creates and stores a cache entry for it and returns it.
 // Returns nil if the cache size is >= MaxCacheSize.
 // Should be called with cacheMu locked.
-func (e *Exec) createAndCacheGraph(argsShapes []shapes.Shape) *execGraphCacheEntry {
+//
+// If profiler is not nil, the build and compilation times are recorded.
+func (e *Exec) createAndCacheGraph(argsShapes []shapes.Shape, profiler *Profiler) *execGraphCacheEntry {
 	if e.maxCacheSize > 0 && len(e.cache) >= e.maxCacheSize {
 		return nil
 	}
 	entry := &execGraphCacheEntry{graph: NewGraph(e.backend, fmt.Sprintf("%s#%d", e.name, len(e.cache)))}
 	g := entry.graph
+	start := time.Now()
+	outputs := e.callGraphFn(g, argsShapes)
+
+	// Append logged nodes as outputs.
+	loggedNodes := g.LoggedNodes()
+	entry.loggedMessages = make([]string, 0, len(loggedNodes))
+	entry.loggedNodeIDs = make([]NodeId, 0, len(loggedNodes))
+	for _, node := range loggedNodes {
+		outputs = append(outputs, node)
+		entry.loggedMessages = append(entry.loggedMessages, node.LogMessage())
+		entry.loggedNodeIDs = append(entry.loggedNodeIDs, node.Id())
+	}
+
+	buildEnd := time.Now()
+
+	// Compile graph.
+	g.Compile(outputs...)
+	if profiler != nil {
+		profiler.Record(
+			ProfileEvent{Type: ProfileBuild, Graph: g.name, Name: ProfileBuild.String(), NodeId: InvalidNodeId,
+				Start: start, Duration: buildEnd.Sub(start)},
+			ProfileEvent{Type: ProfileCompile, Graph: g.name, Name: ProfileCompile.String(), NodeId: InvalidNodeId,
+				Start: buildEnd, Duration: time.Since(buildEnd)})
+	}
+	entry.argsShapes = make([]shapes.Shape, len(argsShapes))
+	copy(entry.argsShapes, argsShapes)
+	entry.numOutputs = len(outputs)
+	entry.outputShapes = xslices.Map(outputs, (*Node).Shape)
+	e.cache = append(e.cache, entry)
+	return entry
+}
+
+// callGraphFn creates the parameters for the given shapes in g, and calls the graphFn with them.
+// It returns the outputs of graphFn.
+func (e *Exec) callGraphFn(g *Graph, argsShapes []shapes.Shape) []*Node {
 	var argsV []reflect.Value
 	var args []*Node
 	switch {
@@ -581,29 +689,12 @@ func (e *Exec) createAndCacheGraph(argsShapes []shapes.Shape) *execGraphCacheEnt
 			outputs = append(outputs, outputNode)
 		}
 	}
-
-	// Append logged nodes as outputs.
-	loggedNodes := g.LoggedNodes()
-	entry.loggedMessages = make([]string, 0, len(loggedNodes))
-	entry.loggedNodeIDs = make([]NodeId, 0, len(loggedNodes))
-	for _, node := range loggedNodes {
-		outputs = append(outputs, node)
-		entry.loggedMessages = append(entry.loggedMessages, node.LogMessage())
-		entry.loggedNodeIDs = append(entry.loggedNodeIDs, node.Id())
-	}
-
-	// Compile graph.
-	g.Compile(outputs...)
-	entry.argsShapes = make([]shapes.Shape, len(argsShapes))
-	copy(entry.argsShapes, argsShapes)
-	entry.numOutputs = len(outputs)
-	e.cache = append(e.cache, entry)
-	return entry
+	return outputs
 }
 
 // findOrCreateGraph returns the graph for the given arguments shapes: either from cache or by creating a new one.
 // if no cache entry exists.
-func (e *Exec) findOrCreateGraph(argsShapes []shapes.Shape) *execGraphCacheEntry {
+func (e *Exec) findOrCreateGraph(argsShapes []shapes.Shape, profiler *Profiler) *execGraphCacheEntry {
 	e.cacheMu.Lock()
 	defer e.cacheMu.Unlock()
 
@@ -621,7 +712,19 @@ LoopCache:
 	}
 
 	// No graph in cache, create a new one.
-	return e.createAndCacheGraph(argsShapes)
+	return e.createAndCacheGraph(argsShapes, profiler)
+}
+
+// isTransferToDevice returns whether converting the argument to a buffer (see anyToBuffer) requires transferring
+// it from host to device.
+func isTransferToDevice(arg any, deviceNum backends.DeviceNum) bool {
+	switch v := arg.(type) {
+	case *tensors.Tensor:
+		return !v.IsOnDevice(deviceNum)
+	case *donateBuffer:
+		return false
+	}
+	return true
 }
 
 // Finalize clears the cache, finalizing the compiled graphs. The Exec object shouldn't be
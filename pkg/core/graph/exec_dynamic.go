@@ -0,0 +1,315 @@
+package graph
+
+import (
+	"slices"
+
+	"github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// DynamicBucketFn returns the padded dimension (the bucket size) to use for the given dimension of a dynamic axis.
+// It must return a value >= dim. See Exec.SetDynamicBuckets.
+type DynamicBucketFn func(dim int) int
+
+// PowerOfTwoBuckets pads the dimension to the next power of 2. It's the default DynamicBucketFn.
+func PowerOfTwoBuckets(dim int) int {
+	if dim <= 1 {
+		return dim
+	}
+	bucket := 1
+	for bucket < dim {
+		bucket <<= 1
+	}
+	return bucket
+}
+
+// MultipleOfBuckets returns a DynamicBucketFn that pads the dimension to the next multiple of step.
+func MultipleOfBuckets(step int) DynamicBucketFn {
+	if step <= 0 {
+		exceptions.Panicf("MultipleOfBuckets(%d): step must be > 0", step)
+	}
+	return func(dim int) int {
+		return ((dim + step - 1) / step) * step
+	}
+}
+
+// SetDynamicAxis marks the given axis (e.g., 0 for the batch axis) of the arguments as dynamic, so that
+// arguments with different dimensions on that axis don't trigger the compilation of a new graph for each
+// different dimension.
+//
+// If the backend supports dynamic shapes (see backends.Capabilities.DynamicShapes), the graph is built and compiled
+// once, with shapes.DynamicDim as the dimension of the dynamic axis of the arguments, and executed for any
+// dimension. The graph function sees the dynamic shapes: operations that depend on the actual dimension
+// (e.g., ReduceMean over the dynamic axis) panic, and so do the operations the backend doesn't support
+// with dynamic shapes.
+//
+// Otherwise, or if building or compiling the graph with dynamic shapes fails, Exec falls back to padding:
+// the arguments are padded with zeros on the dynamic axis to a bucket size (see SetDynamicBuckets, by default the
+// next power of 2), and the outputs are trimmed back on the same axis (see SetDynamicOutputs). So at most one
+// graph is compiled per bucket size. The graph function then sees the padded shapes, so padding is only valid for
+// computations where the values along the dynamic axis are computed independently -- e.g., the inference of a model
+// on a batch of examples, but not a loss averaged over the batch.
+// Padding is done on the host, so arguments already on device are transferred back.
+//
+// argIndices selects which arguments have the dynamic axis. If empty, all arguments with rank > axis are used.
+// All of them must have the same dimension on the axis. Set axis to -1 to disable it (the default).
+//
+// This should be called before any invocations of Exec.
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicAxis(axis int, argIndices ...int) *Exec {
+	if axis < -1 {
+		exceptions.Panicf("SetDynamicAxis(%d): axis must be >= 0, or -1 to disable it", axis)
+	}
+	e.dynamicAxis = axis
+	e.dynamicArgs = slices.Clone(argIndices)
+	return e
+}
+
+// SetDynamicOutputs selects which outputs have the dynamic axis set with SetDynamicAxis: when padding, they are
+// trimmed back from the padded dimension to the dimension of the arguments. The other outputs are returned as they
+// are.
+//
+// If not set (or set to empty), all outputs must have the dynamic axis. The selected outputs are checked for every
+// graph, and Exec returns an error if one doesn't have the dynamic axis, independently of whether padding is used.
+//
+// This should be called before any invocations of Exec.
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicOutputs(outputIndices ...int) *Exec {
+	e.dynamicOutputs = slices.Clone(outputIndices)
+	return e
+}
+
+// SetDynamicOutputsOffsetHook configures a function that returns, for a graph built by Exec, the number of leading
+// outputs of the graph function that are not indexed by SetDynamicOutputs, and that don't have the dynamic axis.
+//
+// It is used by executors that add extra outputs to the graph function (e.g., context.Exec prepends the updated
+// values of the variables), and not normally needed by end users.
+//
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicOutputsOffsetHook(fn func(g *Graph) int) *Exec {
+	e.dynamicOutputsOffsetFn = fn
+	return e
+}
+
+// DynamicAxis returns the axis set with SetDynamicAxis, or -1 if it is not set.
+func (e *Exec) DynamicAxis() int {
+	return e.dynamicAxis
+}
+
+// SetDynamicBuckets sets the function that defines the padded dimension (bucket size) used for the dynamic axis,
+// when the backend doesn't support dynamic shapes, see SetDynamicAxis. The default is PowerOfTwoBuckets.
+//
+// This should be called before any invocations of Exec.
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicBuckets(bucketFn DynamicBucketFn) *Exec {
+	e.dynamicBuckets = bucketFn
+	return e
+}
+
+// isDynamicArg returns whether the argument has its dynamic axis padded, see SetDynamicAxis.
+func (e *Exec) isDynamicArg(argIdx int) bool {
+	return len(e.dynamicArgs) == 0 || slices.Contains(e.dynamicArgs, argIdx)
+}
+
+// dynamicArgsShapes returns the shapes of the arguments with the dynamic axis (the others are left zero) and the
+// dimension of their dynamic axis, or -1 if no argument has it.
+func (e *Exec) dynamicArgsShapes(args []any) (argsShapes []shapes.Shape, dim int) {
+	axis := e.dynamicAxis
+	dim = -1
+	argsShapes = make([]shapes.Shape, len(args))
+	for ii, arg := range args {
+		if !e.isDynamicArg(ii) {
+			continue
+		}
+		shape := argShape(arg)
+		if shape.Rank() <= axis {
+			if len(e.dynamicArgs) > 0 {
+				exceptions.Panicf("argument #%d of %q has shape %s, it doesn't have the dynamic axis %d",
+					ii, e.Name(), shape, axis)
+			}
+			continue
+		}
+		argsShapes[ii] = shape
+		argDim := shape.Dimensions[axis]
+		if dim == -1 {
+			dim = argDim
+		} else if argDim != dim {
+			exceptions.Panicf("arguments of %q have different dimensions (%d and %d) on the dynamic axis %d",
+				e.Name(), dim, argDim, axis)
+		}
+	}
+	return argsShapes, dim
+}
+
+// findOrCreateDynamicGraph returns the graph built with shapes.DynamicDim on the dynamic axis of the arguments.
+//
+// It returns nil if the backend doesn't support dynamic shapes, if no argument has the dynamic axis, or if
+// the graph failed to build or compile with dynamic shapes -- in which case Exec falls back to padding from then on.
+// See SetDynamicAxis.
+func (e *Exec) findOrCreateDynamicGraph(args []any, profiler *Profiler) *execGraphCacheEntry {
+	if e.dynamicPadding.Load() || !e.backend.Capabilities().DynamicShapes {
+		return nil
+	}
+	argsShapes, dim := e.dynamicArgsShapes(args)
+	if dim == -1 {
+		return nil
+	}
+	for ii, arg := range args {
+		if argsShapes[ii].Ok() {
+			argsShapes[ii] = argsShapes[ii].Clone()
+			argsShapes[ii].Dimensions[e.dynamicAxis] = shapes.DynamicDim
+		} else {
+			argsShapes[ii] = argShape(arg)
+		}
+	}
+	var entry *execGraphCacheEntry
+	err := exceptions.TryCatch[error](func() {
+		entry = e.findOrCreateGraph(argsShapes, profiler)
+		if entry != nil {
+			e.checkDynamicOutputs(entry, shapes.DynamicDim)
+		}
+	})
+	if err != nil {
+		klog.Warningf("%q failed to build the graph with dynamic shapes, falling back to padding the dynamic "+
+			"axis: %v", e.Name(), err)
+		e.dynamicPadding.Store(true)
+		return nil
+	}
+	return entry
+}
+
+// padDynamicArgs pads the dynamic axis of the arguments, see SetDynamicAxis.
+// It returns the new arguments (args is not changed), the original dimension of the dynamic axis and its padded
+// dimension. The dimensions are -1 if no argument has the dynamic axis.
+func (e *Exec) padDynamicArgs(args []any) (padded []any, dim, paddedDim int) {
+	axis := e.dynamicAxis
+	argsShapes, dim := e.dynamicArgsShapes(args)
+	if dim == -1 {
+		return args, -1, -1
+	}
+	paddedDim = e.dynamicBuckets(dim)
+	if paddedDim < dim {
+		exceptions.Panicf("DynamicBucketFn for %q returned bucket size %d for dimension %d, it must be >= dim",
+			e.Name(), paddedDim, dim)
+	}
+	if paddedDim == dim {
+		return args, dim, paddedDim
+	}
+
+	padded = slices.Clone(args)
+	for ii, arg := range args {
+		if !argsShapes[ii].Ok() {
+			continue
+		}
+		var t *tensors.Tensor
+		owned := true
+		switch v := arg.(type) {
+		case *tensors.Tensor:
+			t, owned = v, false
+		case *donateBuffer:
+			t = tensors.FromBuffer(e.backend, v.buffer)
+		default:
+			t = tensors.FromAnyValue(v)
+		}
+		paddedT := resizeAxis(t, axis, paddedDim)
+		if owned {
+			t.FinalizeAll()
+		}
+		padded[ii] = DonateTensorBuffer(paddedT, e.backend, e.deviceNum)
+	}
+	return padded, dim, paddedDim
+}
+
+// dynamicOutputIndices returns the indices of the outputs of the graph with the dynamic axis: the ones selected with
+// SetDynamicOutputs (all by default), shifted by the offset set with SetDynamicOutputsOffsetHook.
+// It also returns the offset.
+func (e *Exec) dynamicOutputIndices(entry *execGraphCacheEntry) (indices []int, offset int) {
+	if e.dynamicOutputsOffsetFn != nil {
+		offset = e.dynamicOutputsOffsetFn(entry.graph)
+	}
+	numGraphFnOutputs := entry.numOutputs - len(entry.loggedMessages)
+	if len(e.dynamicOutputs) == 0 {
+		return xslices.Iota(offset, numGraphFnOutputs-offset), offset
+	}
+	indices = make([]int, len(e.dynamicOutputs))
+	for ii, idx := range e.dynamicOutputs {
+		if idx < 0 || offset+idx >= numGraphFnOutputs {
+			exceptions.Panicf("SetDynamicOutputs(%v) for %q: output #%d is out-of-range, the graph has %d outputs",
+				e.dynamicOutputs, e.name, idx, numGraphFnOutputs-offset)
+		}
+		indices[ii] = offset + idx
+	}
+	return indices, offset
+}
+
+// checkDynamicOutputs checks that the outputs of the graph selected with SetDynamicOutputs have the given dimension
+// on the dynamic axis: shapes.DynamicDim for graphs built with dynamic shapes, or the padded dimension otherwise.
+func (e *Exec) checkDynamicOutputs(entry *execGraphCacheEntry, dim int) {
+	axis := e.dynamicAxis
+	indices, offset := e.dynamicOutputIndices(entry)
+	for _, idx := range indices {
+		shape := entry.outputShapes[idx]
+		if shape.Rank() <= axis || shape.Dimensions[axis] != dim {
+			exceptions.Panicf("output #%d of %q has shape %s, it doesn't have the dynamic axis %d: "+
+				"use SetDynamicOutputs to select the outputs with the dynamic axis", idx-offset, e.name, shape, axis)
+		}
+	}
+}
+
+// trimDynamicOutputs trims in-place the outputs selected with SetDynamicOutputs (all by default) on the dynamic axis,
+// from the padded dimension back to the original dimension. See SetDynamicAxis.
+func (e *Exec) trimDynamicOutputs(entry *execGraphCacheEntry, outputs []*tensors.Tensor, dim int) {
+	indices, _ := e.dynamicOutputIndices(entry)
+	for _, idx := range indices {
+		output := outputs[idx]
+		outputs[idx] = resizeAxis(output, e.dynamicAxis, dim)
+		output.FinalizeAll()
+	}
+}
+
+// argShape returns the shape of an argument to Exec, without converting it.
+func argShape(arg any) shapes.Shape {
+	switch v := arg.(type) {
+	case *tensors.Tensor:
+		return v.Shape()
+	case *donateBuffer:
+		return v.shape
+	}
+	shape, err := shapes.FromAnyValue(arg)
+	if err != nil {
+		panic(errors.WithMessagef(err, "failed to get shape of argument type %T", arg))
+	}
+	return shape
+}
+
+// resizeAxis returns a new local tensor with the dimension of axis changed to newDim: values are either truncated
+// or padded with zeros.
+func resizeAxis(t *tensors.Tensor, axis, newDim int) *tensors.Tensor {
+	shape := t.Shape()
+	newShape := shape.Clone()
+	newShape.Dimensions[axis] = newDim
+	resized := tensors.FromShape(newShape)
+	outerSize := 1
+	for _, dim := range shape.Dimensions[:axis] {
+		outerSize *= dim
+	}
+	innerBytes := int(shape.DType.Memory())
+	for _, dim := range shape.Dimensions[axis+1:] {
+		innerBytes *= dim
+	}
+	srcStride := shape.Dimensions[axis] * innerBytes
+	dstStride := newDim * innerBytes
+	copyBytes := min(srcStride, dstStride)
+	t.ConstBytes(func(src []byte) {
+		resized.MutableBytes(func(dst []byte) {
+			for ii := range outerSize {
+				copy(dst[ii*dstStride:ii*dstStride+copyBytes], src[ii*srcStride:ii*srcStride+copyBytes])
+			}
+		})
+	})
+	return resized
+}
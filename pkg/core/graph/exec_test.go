@@ -305,3 +305,127 @@ func TestExecUnusedInput(t *testing.T) {
 	_, err = unusedInputFn.Exec(0)
 	require.NoError(t, err)
 }
+
+// staticShapesBackend hides the support for dynamic shapes of the wrapped backend, to test padding.
+type staticShapesBackend struct {
+	backends.Backend
+}
+
+func (b staticShapesBackend) Capabilities() backends.Capabilities {
+	capabilities := b.Backend.Capabilities().Clone()
+	capabilities.DynamicShapes = false
+	return capabilities
+}
+
+func TestExecDynamicAxis(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	if !backend.Capabilities().DynamicShapes {
+		t.Skipf("backend %q doesn't support dynamic shapes", backend.Name())
+	}
+	scaleFn := func(x, scale *Node) (*Node, *Node) {
+		return Mul(x, scale), ReduceSum(x, -1)
+	}
+	testScaleFn := func(t *testing.T, exec *Exec, batchSize int) *Graph {
+		x := make([][]float32, batchSize)
+		for ii := range x {
+			x[ii] = []float32{float32(ii), 1, 2}
+		}
+		outputs, g, err := exec.ExecWithGraph(x, float32(10))
+		require.NoError(t, err, "batchSize=%d", batchSize)
+		require.Equal(t, []int{batchSize, 3}, outputs[0].Shape().Dimensions)
+		require.Equal(t, []int{batchSize}, outputs[1].Shape().Dimensions)
+		scaled := outputs[0].Value().([][]float32)
+		sums := outputs[1].Value().([]float32)
+		for ii := range batchSize {
+			assert.Equal(t, []float32{float32(ii) * 10, 10, 20}, scaled[ii])
+			assert.Equal(t, float32(ii)+3, sums[ii])
+		}
+		return g
+	}
+
+	t.Run("DynamicShapes", func(t *testing.T) {
+		// One graph for all batch sizes.
+		exec := MustNewExec(backend, scaleFn).SetDynamicAxis(0).SetMaxCache(1)
+		for _, batchSize := range []int{3, 4, 5, 7, 8} {
+			g := testScaleFn(t, exec, batchSize)
+			assert.Equal(t, "(Float32)[? 3]", g.GetParameterByHandle(0).Shape().String())
+		}
+
+		// Operations not supported with dynamic shapes fall back to padding.
+		exec = MustNewExec(backend, func(x *Node) *Node {
+			return Reverse(x, 0)
+		}).SetDynamicAxis(0).SetMaxCache(2)
+		// Reversing the padded values is not per-example, the padded zero comes first for a batch of 3.
+		for batchSize, want := range map[int][]float32{3: {0, 2, 1}, 4: {3, 2, 1, 0}} {
+			got, g, err := exec.ExecWithGraph(xslices.Iota(float32(0), batchSize))
+			require.NoError(t, err)
+			assert.Equal(t, want, got[0].Value())
+			assert.Equal(t, []int{4}, g.GetParameterByHandle(0).Shape().Dimensions)
+		}
+	})
+
+	t.Run("Padding", func(t *testing.T) {
+		backend := staticShapesBackend{backend}
+		exec := MustNewExec(backend, scaleFn).SetDynamicAxis(0).SetMaxCache(2)
+		for _, batchSize := range []int{3, 4, 5, 7, 8} {
+			g := testScaleFn(t, exec, batchSize)
+			if batchSize > 4 {
+				assert.Equal(t, []int{8, 3}, g.GetParameterByHandle(0).Shape().Dimensions)
+			}
+		}
+
+		// Dynamic axis 1 of the first argument only, padded to multiples of 4.
+		exec = MustNewExec(backend, func(x, y *Node) *Node {
+			return Add(x, y)
+		}).SetDynamicAxis(1, 0).SetDynamicBuckets(MultipleOfBuckets(4)).SetMaxCache(1)
+		for _, dim := range []int{3, 1, 4} {
+			x := make([][]int32, 2)
+			for row := range x {
+				x[row] = make([]int32, dim)
+				for col := range dim {
+					x[row][col] = int32(row*10 + col)
+				}
+			}
+			got := exec.MustExec1(x, int32(100)).Value().([][]int32)
+			for row := range x {
+				for col := range dim {
+					x[row][col] += 100
+				}
+			}
+			assert.Equal(t, x, got)
+		}
+
+		// An output that doesn't depend on the batch, but whose dimension coincides with the bucket size:
+		// a batch of 5 is padded to 8, and the [8, 8] output must not be trimmed.
+		coincidentalFn := func(x *Node) (*Node, *Node) {
+			return OnePlus(x), Ones(x.Graph(), shapes.Make(dtypes.Float32, 8, 8))
+		}
+		exec = MustNewExec(backend, coincidentalFn).SetDynamicAxis(0).SetDynamicOutputs(0)
+		outputs, err := exec.Exec([]float32{0, 1, 2, 3, 4})
+		require.NoError(t, err)
+		assert.Equal(t, []float32{1, 2, 3, 4, 5}, outputs[0].Value())
+		assert.Equal(t, []int{8, 8}, outputs[1].Shape().Dimensions)
+	})
+
+	for _, testBackend := range []backends.Backend{backend, staticShapesBackend{backend}} {
+		// Arguments with different dimensions on the dynamic axis.
+		exec := MustNewExec(testBackend, Add).SetDynamicAxis(0)
+		_, err := exec.Exec([]float32{1, 2}, []float32{1, 2, 3})
+		require.Error(t, err)
+
+		// Without selecting the outputs, an output without the dynamic axis is an error, even if no padding is
+		// needed.
+		exec = MustNewExec(testBackend, func(x *Node) (*Node, *Node) {
+			return OnePlus(x), ReduceAllSum(x)
+		}).SetDynamicAxis(0)
+		for _, batchSize := range []int{4, 3} {
+			_, err = exec.Exec(xslices.Iota(float32(0), batchSize))
+			require.ErrorContains(t, err, "SetDynamicOutputs", "batchSize=%d", batchSize)
+		}
+	}
+
+	require.Equal(t, 1, PowerOfTwoBuckets(1))
+	require.Equal(t, 8, PowerOfTwoBuckets(5))
+	require.Equal(t, 8, PowerOfTwoBuckets(8))
+	require.Equal(t, 12, MultipleOfBuckets(4)(9))
+}
@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/pkg/errors"
+)
+
+// StableHLOProgram is a computation graph exported as a StableHLO program, to be used with other StableHLO
+// consumers (e.g.: serving systems), or for golden-file tests of the lowering of a model.
+//
+// See Graph.ExportStableHLO and Exec.ExportStableHLO.
+type StableHLOProgram struct {
+	// Program is the StableHLO program in MLIR text format.
+	// Its "main" function takes the inputs and returns the outputs in the order listed in Signature.
+	// Consumers of StableHLO (e.g.: PJRT) accept the text format, and it can be converted to MLIR bytecode
+	// with the MLIR tools (e.g.: `stablehlo-translate --serialize`), since GoMLX doesn't depend on the MLIR libraries.
+	Program []byte
+
+	// Signature describes the inputs and outputs of the program.
+	Signature StableHLOSignature
+}
+
+// StableHLOSignature describes the inputs and outputs of an exported StableHLO program.
+// It is serialized to JSON by StableHLOProgram.SignatureJSON.
+type StableHLOSignature struct {
+	Name    string                `json:"name"`
+	Inputs  []StableHLOTensorSpec `json:"inputs"`
+	Outputs []StableHLOTensorSpec `json:"outputs"`
+}
+
+// StableHLOTensorSpec describes one input or output of an exported StableHLO program.
+type StableHLOTensorSpec struct {
+	// Name of the input, as given to Parameter, or "output_<n>" for outputs.
+	Name string `json:"name"`
+
+	// DType name, as given by dtypes.DType.String (e.g.: "Float32").
+	DType string `json:"dtype"`
+
+	// Dimensions of the tensor, empty for scalars.
+	Dimensions []int `json:"dimensions"`
+}
+
+// newStableHLOTensorSpec creates the spec from a shape.
+func newStableHLOTensorSpec(name string, shape shapes.Shape) StableHLOTensorSpec {
+	dims := slices.Clone(shape.Dimensions)
+	if dims == nil {
+		dims = []int{}
+	}
+	return StableHLOTensorSpec{Name: name, DType: shape.DType.String(), Dimensions: dims}
+}
+
+// SignatureJSON returns the signature of the program, serialized as indented JSON.
+func (p *StableHLOProgram) SignatureJSON() ([]byte, error) {
+	signatureJSON, err := json.MarshalIndent(p.Signature, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize signature of StableHLO program %q", p.Signature.Name)
+	}
+	return signatureJSON, nil
+}
+
+// Save the program to "<basePath>.mlir" and its signature to "<basePath>.signature.json".
+func (p *StableHLOProgram) Save(basePath string) error {
+	signatureJSON, err := p.SignatureJSON()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(basePath+".mlir", p.Program, 0o644); err != nil {
+		return errors.Wrapf(err, "failed to save StableHLO program to %q", basePath+".mlir")
+	}
+	if err = os.WriteFile(basePath+".signature.json", signatureJSON, 0o644); err != nil {
+		return errors.Wrapf(err, "failed to save StableHLO program signature to %q", basePath+".signature.json")
+	}
+	return nil
+}
+
+// ExportStableHLO finishes building the graph with the given outputs and exports it as a StableHLO program,
+// instead of compiling it.
+// The inputs of the program are the graph parameters, in the order they were created.
+//
+// The graph backend must support it (see backends.StableHLOExporter): e.g., the "stablehlo" backend.
+// To export without a PJRT plugin installed, use the backend created with stablehlo.NewExportOnly.
+//
+// The Graph shouldn't be used afterward, except to be finalized.
+func (g *Graph) ExportStableHLO(outputs ...*Node) (*StableHLOProgram, error) {
+	var program *StableHLOProgram
+	err := exceptions.TryCatch[error](func() {
+		g.AssertBuilding()
+		if len(outputs) == 0 {
+			exceptions.Panicf("no outputs selected when exporting graph %q", g.name)
+		}
+		g.checkOutputs(outputs)
+		exporter, ok := g.builder.(backends.StableHLOExporter)
+		if !ok {
+			exceptions.Panicf("backend %q doesn't support exporting StableHLO programs, use the \"stablehlo\" "+
+				"backend instead (or the one returned by stablehlo.NewExportOnly)", g.backend.Name())
+		}
+		outputsOps := xslices.Map(outputs, func(node *Node) backends.Op { return node.outputOps[0] })
+		text, err := exporter.ExportStableHLO(outputsOps...)
+		if err != nil {
+			panic(errors.WithMessagef(err, "failed to export graph %q as StableHLO", g.name))
+		}
+
+		program = &StableHLOProgram{
+			Program:   text,
+			Signature: StableHLOSignature{Name: g.name},
+		}
+		for _, param := range g.parameters {
+			program.Signature.Inputs = append(program.Signature.Inputs,
+				newStableHLOTensorSpec(param.GetParameterName(), param.Shape()))
+		}
+		for ii, output := range outputs {
+			program.Signature.Outputs = append(program.Signature.Outputs,
+				newStableHLOTensorSpec(fmt.Sprintf("output_%d", ii), output.Shape()))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// ExportStableHLO builds the computation graph for the given input shapes and exports it as a StableHLO program,
+// instead of compiling it. The graph is not cached, and nodes marked for logging are not included.
+//
+// The backend used to create Exec must support it (see Graph.ExportStableHLO for details).
+// Graph functions that create extra parameters (other than the inputs) are exported with those parameters as
+// extra inputs, after the regular inputs.
+func (e *Exec) ExportStableHLO(inputShapes ...shapes.Shape) (*StableHLOProgram, error) {
+	if !e.inputAsSlice && len(inputShapes) != e.numInputs {
+		return nil, errors.Errorf("# of input shapes (%d) don't match # arguments to the graph function (%d) for %q",
+			len(inputShapes), e.numInputs, e.Name())
+	}
+	g := NewGraph(e.backend, e.name+"#StableHLO")
+	defer g.Finalize()
+	var outputs []*Node
+	err := exceptions.TryCatch[error](func() {
+		outputs = e.callGraphFn(g, inputShapes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g.ExportStableHLO(outputs...)
+}
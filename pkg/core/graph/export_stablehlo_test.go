@@ -0,0 +1,56 @@
+//go:build ((linux && amd64) || darwin) && !noxla
+
+package graph_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomlx/gomlx/backends/stablehlo"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportStableHLO(t *testing.T) {
+	exec := MustNewExec(stablehlo.NewExportOnly(), func(x, y *Node) (*Node, *Node) {
+		return AddScalar(Mul(x, y), 1), ReduceAllSum(x)
+	})
+	program, err := exec.ExportStableHLO(shapes.Make(dtypes.Float32, 2), shapes.Make(dtypes.Float32))
+	require.NoError(t, err)
+	text := string(program.Program)
+	require.Contains(t, text, "func.func @main(%arg0: tensor<2xf32>, %arg1: tensor<f32>) -> (tensor<2xf32>, tensor<f32>)")
+	require.Contains(t, text, "stablehlo.multiply")
+	require.Equal(t, []StableHLOTensorSpec{
+		{Name: "arg0", DType: "Float32", Dimensions: []int{2}},
+		{Name: "arg1", DType: "Float32", Dimensions: []int{}},
+	}, program.Signature.Inputs)
+	require.Equal(t, []StableHLOTensorSpec{
+		{Name: "output_0", DType: "Float32", Dimensions: []int{2}},
+		{Name: "output_1", DType: "Float32", Dimensions: []int{}},
+	}, program.Signature.Outputs)
+
+	// Saving program and signature.
+	basePath := path.Join(t.TempDir(), "model")
+	require.NoError(t, program.Save(basePath))
+	saved, err := os.ReadFile(basePath + ".mlir")
+	require.NoError(t, err)
+	require.Equal(t, program.Program, saved)
+	signatureJSON, err := os.ReadFile(basePath + ".signature.json")
+	require.NoError(t, err)
+	require.Contains(t, string(signatureJSON), `"name": "output_1"`)
+
+	// The export-only backend can't execute.
+	_, err = exec.Exec([]float32{1, 2}, float32(3))
+	require.Error(t, err)
+
+	// Backends that don't support exporting.
+	exec = MustNewExec(graphtest.BuildTestBackend(), func(x *Node) *Node { return Neg(x) })
+	_, err = exec.ExportStableHLO(shapes.Make(dtypes.Float32, 2))
+	if graphtest.BuildTestBackend().Name() != stablehlo.BackendName {
+		require.ErrorContains(t, err, "doesn't support exporting StableHLO programs")
+	}
+}
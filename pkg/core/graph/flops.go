@@ -0,0 +1,65 @@
+package graph
+
+// elementWiseFLOPsNodeTypes are the node types that cost (approximately) one floating point operation per element
+// of the output.
+var elementWiseFLOPsNodeTypes = map[NodeType]bool{
+	NodeTypeAbs: true, NodeTypeAdd: true, NodeTypeCeil: true, NodeTypeClamp: true, NodeTypeCos: true,
+	NodeTypeDiv: true, NodeTypeErf: true, NodeTypeExp: true, NodeTypeExpm1: true, NodeTypeFloor: true,
+	NodeTypeLog: true, NodeTypeLog1p: true, NodeTypeLogistic: true, NodeTypeMax: true, NodeTypeMin: true,
+	NodeTypeMul: true, NodeTypeNeg: true, NodeTypePow: true, NodeTypeRem: true, NodeTypeRound: true,
+	NodeTypeRsqrt: true, NodeTypeSign: true, NodeTypeSin: true, NodeTypeSqrt: true, NodeTypeSub: true,
+	NodeTypeTanh: true, NodeTypeWhere: true, NodeTypeIsFinite: true, NodeTypeIsNaN: true,
+	NodeTypeEqual: true, NodeTypeNotEqual: true, NodeTypeGreaterOrEqual: true, NodeTypeGreaterThan: true,
+	NodeTypeLessOrEqual: true, NodeTypeLessThan: true,
+}
+
+// EstimateFLOPs returns an estimate of the number of floating point operations needed to compute the node,
+// where a multiply-add counts as 2 operations.
+//
+// It is estimated for DotGeneral (and Dot), ConvGeneral, reductions and element-wise operations. Other operations,
+// including those that only move data around (Reshape, Transpose, Gather, Slice, etc.), count as 0.
+func (n *Node) EstimateFLOPs() int64 {
+	if n.NumOutputs() != 1 {
+		return 0
+	}
+	outputSize := int64(n.Shape().Size())
+	switch inputs := n.inputs.(type) {
+	case *nodeInputsDotGeneral:
+		contractingSize := int64(1)
+		for _, axis := range inputs.lhsContractingAxes {
+			contractingSize *= int64(inputs.lhs.Shape().Dimensions[axis])
+		}
+		return 2 * outputSize * contractingSize
+	case *nodeInputsDot:
+		lhsShape := inputs.lhs.Shape()
+		if lhsShape.Rank() == 0 {
+			return outputSize
+		}
+		return 2 * outputSize * int64(lhsShape.Dimensions[lhsShape.Rank()-1])
+	case *nodeInputsConvGeneral:
+		kernelDims := inputs.kernel.Shape().Dimensions
+		kernelSize := int64(kernelDims[inputs.axes.KernelInputChannels])
+		for _, axis := range inputs.axes.KernelSpatial {
+			kernelSize *= int64(kernelDims[axis])
+		}
+		return 2 * outputSize * kernelSize
+	case *nodeInputsReduceSum:
+		return int64(inputs.x.Shape().Size())
+	case *nodeInputsReduceMax:
+		return int64(inputs.x.Shape().Size())
+	case *nodeInputsReduceMin:
+		return int64(inputs.x.Shape().Size())
+	case *nodeInputsReduceProduct:
+		return int64(inputs.x.Shape().Size())
+	case *nodeInputsReduceWindow:
+		windowSize := int64(1)
+		for _, dim := range inputs.windowDimensions {
+			windowSize *= int64(dim)
+		}
+		return outputSize * windowSize
+	}
+	if elementWiseFLOPsNodeTypes[n.Type()] {
+		return outputSize
+	}
+	return 0
+}
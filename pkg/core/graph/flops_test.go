@@ -0,0 +1,31 @@
+package graph_test
+
+import (
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateFLOPs(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	g := NewGraph(backend, "flops")
+	x := Parameter(g, "x", shapes.Make(dtypes.Float32, 8, 4))
+	w := Parameter(g, "w", shapes.Make(dtypes.Float32, 4, 16))
+	assert.Equal(t, int64(2*8*16*4), Dot(x, w).EstimateFLOPs())
+	assert.Equal(t, int64(2*8*16*4), DotGeneral(x, []int{1}, nil, w, []int{0}, nil).EstimateFLOPs())
+	assert.Equal(t, int64(8*4), Tanh(x).EstimateFLOPs())
+	assert.Equal(t, int64(8*4), ReduceAllSum(x).EstimateFLOPs())
+	assert.Equal(t, int64(0), Reshape(x, 32).EstimateFLOPs())
+	assert.Equal(t, int64(0), x.EstimateFLOPs())
+
+	// Images [batch=2, 5, 5, channels=3], kernel [3, 3, 3, 7] and no padding: output is [2, 3, 3, 7].
+	images := Parameter(g, "images", shapes.Make(dtypes.Float32, 2, 5, 5, 3))
+	kernel := Parameter(g, "kernel", shapes.Make(dtypes.Float32, 3, 3, 3, 7))
+	conv := Convolve(images, kernel).NoPadding().Done()
+	assert.Equal(t, []int{2, 3, 3, 7}, conv.Shape().Dimensions)
+	assert.Equal(t, int64(2*(2*3*3*7)*(3*3*3)), conv.EstimateFLOPs())
+}
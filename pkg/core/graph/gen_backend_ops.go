@@ -227,6 +227,15 @@ func (ni *nodeInputsArgMinMax) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsArgMinMax) staticInputs() map[string]any {
+	return map[string]any{
+		"axis":        ni.axis,
+		"outputDType": ni.outputDType,
+		"isMin":       ni.isMin,
+	}
+}
+
 // backendArgMinMax is a Graph wrapper for the backend.Builder.ArgMinMax method.
 func backendArgMinMax(x *Node, axis int, outputDType dtypes.DType, isMin bool) (node *Node) {
 	inputNodes := []*Node{x}
@@ -282,6 +291,14 @@ func (ni *nodeInputsBatchNormForInference) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsBatchNormForInference) staticInputs() map[string]any {
+	return map[string]any{
+		"epsilon":     ni.epsilon,
+		"featureAxis": ni.featureAxis,
+	}
+}
+
 // backendBatchNormForInference is a Graph wrapper for the backend.Builder.BatchNormForInference method.
 func backendBatchNormForInference(operand *Node, scale *Node, offset *Node, mean *Node, variance *Node, epsilon float32, featureAxis int) (node *Node) {
 	inputNodes := []*Node{operand, scale, offset, mean, variance}
@@ -336,6 +353,14 @@ func (ni *nodeInputsBatchNormForTraining) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsBatchNormForTraining) staticInputs() map[string]any {
+	return map[string]any{
+		"epsilon":     ni.epsilon,
+		"featureAxis": ni.featureAxis,
+	}
+}
+
 // backendBatchNormForTraining is a Graph wrapper for the backend.Builder.BatchNormForTraining method.
 func backendBatchNormForTraining(operand *Node, scale *Node, offset *Node, epsilon float32, featureAxis int) (normalized, batchMean, batchVariance *Node) {
 	inputNodes := []*Node{operand, scale, offset}
@@ -394,6 +419,14 @@ func (ni *nodeInputsBatchNormGradient) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsBatchNormGradient) staticInputs() map[string]any {
+	return map[string]any{
+		"epsilon":     ni.epsilon,
+		"featureAxis": ni.featureAxis,
+	}
+}
+
 // backendBatchNormGradient is a Graph wrapper for the backend.Builder.BatchNormGradient method.
 func backendBatchNormGradient(operand *Node, scale *Node, mean *Node, variance *Node, gradOutput *Node, epsilon float32, featureAxis int) (gradOperand, gradScale, gradOffset *Node) {
 	inputNodes := []*Node{operand, scale, mean, variance, gradOutput}
@@ -485,6 +518,13 @@ func (ni *nodeInputsBitcast) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsBitcast) staticInputs() map[string]any {
+	return map[string]any{
+		"targetDType": ni.targetDType,
+	}
+}
+
 // Bitcast performs an elementwise bit-cast operation from a dtype to another dtype.
 //
 // The Bitcast doesn't "convert", rather it just reinterprets the bits from x.DType() to the targetDType.
@@ -712,6 +752,14 @@ func (ni *nodeInputsBroadcastInDim) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsBroadcastInDim) staticInputs() map[string]any {
+	return map[string]any{
+		"outputShape":   ni.outputShape,
+		"broadcastAxes": ni.broadcastAxes,
+	}
+}
+
 // backendBroadcastInDim is a Graph wrapper for the backend.Builder.BroadcastInDim method.
 func backendBroadcastInDim(x *Node, outputShape shapes.Shape, broadcastAxes []int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -932,6 +980,13 @@ func (ni *nodeInputsConcatenate) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsConcatenate) staticInputs() map[string]any {
+	return map[string]any{
+		"axis": ni.axis,
+	}
+}
+
 // backendConcatenate is a Graph wrapper for the backend.Builder.Concatenate method.
 func backendConcatenate(axis int, operands ...*Node) (node *Node) {
 	inputNodes := []*Node{}
@@ -1030,6 +1085,19 @@ func (ni *nodeInputsConvGeneral) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsConvGeneral) staticInputs() map[string]any {
+	return map[string]any{
+		"axes":              ni.axes,
+		"strides":           ni.strides,
+		"paddings":          ni.paddings,
+		"inputDilations":    ni.inputDilations,
+		"kernelDilations":   ni.kernelDilations,
+		"channelGroupCount": ni.channelGroupCount,
+		"batchGroupCount":   ni.batchGroupCount,
+	}
+}
+
 // backendConvGeneral is a Graph wrapper for the backend.Builder.ConvGeneral method.
 func backendConvGeneral(input *Node, kernel *Node, axes backends.ConvolveAxesConfig, strides []int, paddings [][2]int, inputDilations []int, kernelDilations []int, channelGroupCount int, batchGroupCount int) (node *Node) {
 	inputNodes := []*Node{input, kernel}
@@ -1080,6 +1148,13 @@ func (ni *nodeInputsConvertDType) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsConvertDType) staticInputs() map[string]any {
+	return map[string]any{
+		"dtype": ni.dtype,
+	}
+}
+
 // backendConvertDType is a Graph wrapper for the backend.Builder.ConvertDType method.
 func backendConvertDType(x *Node, dtype dtypes.DType) (node *Node) {
 	inputNodes := []*Node{x}
@@ -1269,6 +1344,16 @@ func (ni *nodeInputsDotGeneral) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsDotGeneral) staticInputs() map[string]any {
+	return map[string]any{
+		"lhsContractingAxes": ni.lhsContractingAxes,
+		"lhsBatchAxes":       ni.lhsBatchAxes,
+		"rhsContractingAxes": ni.rhsContractingAxes,
+		"rhsBatchAxes":       ni.rhsBatchAxes,
+	}
+}
+
 // backendDotGeneral is a Graph wrapper for the backend.Builder.DotGeneral method.
 func backendDotGeneral(lhs *Node, lhsContractingAxes []int, lhsBatchAxes []int, rhs *Node, rhsContractingAxes []int, rhsBatchAxes []int) (node *Node) {
 	inputNodes := []*Node{lhs, rhs}
@@ -1318,6 +1403,13 @@ func (ni *nodeInputsDynamicSlice) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsDynamicSlice) staticInputs() map[string]any {
+	return map[string]any{
+		"sliceDims": ni.sliceDims,
+	}
+}
+
 // DynamicSlice extracts a slice from the operand at the startIndices position and the given sliceSizes.
 //
 // - operand: tensor from where to take the slice.
@@ -1643,6 +1735,14 @@ func (ni *nodeInputsFFT) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsFFT) staticInputs() map[string]any {
+	return map[string]any{
+		"fftType":   ni.fftType,
+		"fftLength": ni.fftLength,
+	}
+}
+
 // backendFFT is a Graph wrapper for the backend.Builder.FFT method.
 func backendFFT(operand *Node, fftType backends.FFTType, fftLength []int) (node *Node) {
 	inputNodes := []*Node{operand}
@@ -1739,6 +1839,18 @@ func (ni *nodeInputsGather) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsGather) staticInputs() map[string]any {
+	return map[string]any{
+		"indexVectorAxis":    ni.indexVectorAxis,
+		"offsetOutputAxes":   ni.offsetOutputAxes,
+		"collapsedSliceAxes": ni.collapsedSliceAxes,
+		"startIndexMap":      ni.startIndexMap,
+		"sliceSizes":         ni.sliceSizes,
+		"indicesAreSorted":   ni.indicesAreSorted,
+	}
+}
+
 // backendGather is a Graph wrapper for the backend.Builder.Gather method.
 func backendGather(operand *Node, startIndices *Node, indexVectorAxis int, offsetOutputAxes []int, collapsedSliceAxes []int, startIndexMap []int, sliceSizes []int, indicesAreSorted bool) (node *Node) {
 	inputNodes := []*Node{operand, startIndices}
@@ -2049,6 +2161,14 @@ func (ni *nodeInputsIota) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsIota) staticInputs() map[string]any {
+	return map[string]any{
+		"shape":    ni.shape,
+		"iotaAxis": ni.iotaAxis,
+	}
+}
+
 // backendIota is a Graph wrapper for the backend.Builder.Iota method.
 func backendIota(g *Graph, shape shapes.Shape, iotaAxis int) (node *Node) {
 	g.AssertBuilding()
@@ -2904,6 +3024,13 @@ func (ni *nodeInputsPad) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsPad) staticInputs() map[string]any {
+	return map[string]any{
+		"axesConfig": ni.axesConfig,
+	}
+}
+
 // Pad injects padding on the start, end, or interior (in between each element) of the given operand.
 // There must be at most `operand.Rank()` axesConfig values. Missing PadAxis are assumed to be zeros,
 // that is, no padding for those axes.
@@ -3033,6 +3160,13 @@ func (ni *nodeInputsReduceBitwiseAnd) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceBitwiseAnd) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceBitwiseAnd is a Graph wrapper for the backend.Builder.ReduceBitwiseAnd method.
 func backendReduceBitwiseAnd(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3076,6 +3210,13 @@ func (ni *nodeInputsReduceBitwiseOr) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceBitwiseOr) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceBitwiseOr is a Graph wrapper for the backend.Builder.ReduceBitwiseOr method.
 func backendReduceBitwiseOr(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3119,6 +3260,13 @@ func (ni *nodeInputsReduceBitwiseXor) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceBitwiseXor) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceBitwiseXor is a Graph wrapper for the backend.Builder.ReduceBitwiseXor method.
 func backendReduceBitwiseXor(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3162,6 +3310,13 @@ func (ni *nodeInputsReduceLogicalAnd) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceLogicalAnd) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceLogicalAnd is a Graph wrapper for the backend.Builder.ReduceLogicalAnd method.
 func backendReduceLogicalAnd(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3205,6 +3360,13 @@ func (ni *nodeInputsReduceLogicalOr) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceLogicalOr) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceLogicalOr is a Graph wrapper for the backend.Builder.ReduceLogicalOr method.
 func backendReduceLogicalOr(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3248,6 +3410,13 @@ func (ni *nodeInputsReduceLogicalXor) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceLogicalXor) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceLogicalXor is a Graph wrapper for the backend.Builder.ReduceLogicalXor method.
 func backendReduceLogicalXor(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3291,6 +3460,13 @@ func (ni *nodeInputsReduceMax) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceMax) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceMax is a Graph wrapper for the backend.Builder.ReduceMax method.
 func backendReduceMax(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3334,6 +3510,13 @@ func (ni *nodeInputsReduceMin) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceMin) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceMin is a Graph wrapper for the backend.Builder.ReduceMin method.
 func backendReduceMin(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3377,6 +3560,13 @@ func (ni *nodeInputsReduceProduct) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceProduct) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceProduct is a Graph wrapper for the backend.Builder.ReduceProduct method.
 func backendReduceProduct(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3420,6 +3610,13 @@ func (ni *nodeInputsReduceSum) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceSum) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReduceSum is a Graph wrapper for the backend.Builder.ReduceSum method.
 func backendReduceSum(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3473,6 +3670,18 @@ func (ni *nodeInputsReduceWindow) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReduceWindow) staticInputs() map[string]any {
+	return map[string]any{
+		"reductionType":    ni.reductionType,
+		"windowDimensions": ni.windowDimensions,
+		"strides":          ni.strides,
+		"baseDilations":    ni.baseDilations,
+		"windowDilations":  ni.windowDilations,
+		"paddings":         ni.paddings,
+	}
+}
+
 // backendReduceWindow is a Graph wrapper for the backend.Builder.ReduceWindow method.
 func backendReduceWindow(x *Node, reductionType ReduceOpType, windowDimensions []int, strides []int, baseDilations []int, windowDilations []int, paddings [][2]int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3565,6 +3774,13 @@ func (ni *nodeInputsReshape) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReshape) staticInputs() map[string]any {
+	return map[string]any{
+		"dimensions": ni.dimensions,
+	}
+}
+
 // backendReshape is a Graph wrapper for the backend.Builder.Reshape method.
 func backendReshape(x *Node, dimensions ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3608,6 +3824,13 @@ func (ni *nodeInputsReverse) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsReverse) staticInputs() map[string]any {
+	return map[string]any{
+		"axes": ni.axes,
+	}
+}
+
 // backendReverse is a Graph wrapper for the backend.Builder.Reverse method.
 func backendReverse(x *Node, axes ...int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -3651,6 +3874,13 @@ func (ni *nodeInputsRngBitGenerator) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsRngBitGenerator) staticInputs() map[string]any {
+	return map[string]any{
+		"shape": ni.shape,
+	}
+}
+
 // backendRngBitGenerator is a Graph wrapper for the backend.Builder.RngBitGenerator method.
 func backendRngBitGenerator(state *Node, shape shapes.Shape) (newState, values *Node) {
 	inputNodes := []*Node{state}
@@ -3790,6 +4020,18 @@ func (ni *nodeInputsScatterMax) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsScatterMax) staticInputs() map[string]any {
+	return map[string]any{
+		"indexVectorAxis":          ni.indexVectorAxis,
+		"updateWindowAxes":         ni.updateWindowAxes,
+		"insertedWindowAxes":       ni.insertedWindowAxes,
+		"scatterAxesToOperandAxes": ni.scatterAxesToOperandAxes,
+		"indicesAreSorted":         ni.indicesAreSorted,
+		"uniqueIndices":            ni.uniqueIndices,
+	}
+}
+
 // backendScatterMax is a Graph wrapper for the backend.Builder.ScatterMax method.
 func backendScatterMax(operand *Node, scatterIndices *Node, updates *Node, indexVectorAxis int, updateWindowAxes []int, insertedWindowAxes []int, scatterAxesToOperandAxes []int, indicesAreSorted bool, uniqueIndices bool) (node *Node) {
 	inputNodes := []*Node{operand, scatterIndices, updates}
@@ -3854,6 +4096,18 @@ func (ni *nodeInputsScatterMin) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsScatterMin) staticInputs() map[string]any {
+	return map[string]any{
+		"indexVectorAxis":          ni.indexVectorAxis,
+		"updateWindowAxes":         ni.updateWindowAxes,
+		"insertedWindowAxes":       ni.insertedWindowAxes,
+		"scatterAxesToOperandAxes": ni.scatterAxesToOperandAxes,
+		"indicesAreSorted":         ni.indicesAreSorted,
+		"uniqueIndices":            ni.uniqueIndices,
+	}
+}
+
 // backendScatterMin is a Graph wrapper for the backend.Builder.ScatterMin method.
 func backendScatterMin(operand *Node, scatterIndices *Node, updates *Node, indexVectorAxis int, updateWindowAxes []int, insertedWindowAxes []int, scatterAxesToOperandAxes []int, indicesAreSorted bool, uniqueIndices bool) (node *Node) {
 	inputNodes := []*Node{operand, scatterIndices, updates}
@@ -3918,6 +4172,18 @@ func (ni *nodeInputsScatterSum) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsScatterSum) staticInputs() map[string]any {
+	return map[string]any{
+		"indexVectorAxis":          ni.indexVectorAxis,
+		"updateWindowAxes":         ni.updateWindowAxes,
+		"insertedWindowAxes":       ni.insertedWindowAxes,
+		"scatterAxesToOperandAxes": ni.scatterAxesToOperandAxes,
+		"indicesAreSorted":         ni.indicesAreSorted,
+		"uniqueIndices":            ni.uniqueIndices,
+	}
+}
+
 // backendScatterSum is a Graph wrapper for the backend.Builder.ScatterSum method.
 func backendScatterSum(operand *Node, scatterIndices *Node, updates *Node, indexVectorAxis int, updateWindowAxes []int, insertedWindowAxes []int, scatterAxesToOperandAxes []int, indicesAreSorted bool, uniqueIndices bool) (node *Node) {
 	inputNodes := []*Node{operand, scatterIndices, updates}
@@ -3974,6 +4240,15 @@ func (ni *nodeInputsSelectAndScatterMax) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsSelectAndScatterMax) staticInputs() map[string]any {
+	return map[string]any{
+		"windowDimensions": ni.windowDimensions,
+		"windowStrides":    ni.windowStrides,
+		"paddings":         ni.paddings,
+	}
+}
+
 // backendSelectAndScatterMax is a Graph wrapper for the backend.Builder.SelectAndScatterMax method.
 func backendSelectAndScatterMax(operand *Node, source *Node, windowDimensions []int, windowStrides []int, paddings [][2]int) (node *Node) {
 	inputNodes := []*Node{operand, source}
@@ -4026,6 +4301,15 @@ func (ni *nodeInputsSelectAndScatterMin) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsSelectAndScatterMin) staticInputs() map[string]any {
+	return map[string]any{
+		"windowDimensions": ni.windowDimensions,
+		"windowStrides":    ni.windowStrides,
+		"paddings":         ni.paddings,
+	}
+}
+
 // backendSelectAndScatterMin is a Graph wrapper for the backend.Builder.SelectAndScatterMin method.
 func backendSelectAndScatterMin(operand *Node, source *Node, windowDimensions []int, windowStrides []int, paddings [][2]int) (node *Node) {
 	inputNodes := []*Node{operand, source}
@@ -4285,6 +4569,15 @@ func (ni *nodeInputsSlice) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsSlice) staticInputs() map[string]any {
+	return map[string]any{
+		"starts":  ni.starts,
+		"limits":  ni.limits,
+		"strides": ni.strides,
+	}
+}
+
 // backendSlice is a Graph wrapper for the backend.Builder.Slice method.
 func backendSlice(x *Node, starts []int, limits []int, strides []int) (node *Node) {
 	inputNodes := []*Node{x}
@@ -4454,6 +4747,13 @@ func (ni *nodeInputsTranspose) String() string {
 	)
 }
 
+// staticInputs implements the interface staticInputsIntrospector.
+func (ni *nodeInputsTranspose) staticInputs() map[string]any {
+	return map[string]any{
+		"permutation": ni.permutation,
+	}
+}
+
 // backendTranspose is a Graph wrapper for the backend.Builder.Transpose method.
 func backendTranspose(x *Node, permutation ...int) (node *Node) {
 	inputNodes := []*Node{x}
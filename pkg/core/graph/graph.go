@@ -149,6 +149,15 @@ type Graph struct {
 	// aliasScope is the current scope for aliases
 	aliasScope []string
 
+	// scopes is the stack of scopes pushed with PushScope: the last one is recorded in the nodes created.
+	// See Node.Scope.
+	scopes []string
+
+	// opsToNodes maps backend ops to the nodes that created them, used to profile the execution.
+	// It is built on-demand, see Graph.nodeForOp.
+	opsToNodesOnce sync.Once
+	opsToNodes     map[backends.Op]*Node
+
 	// Compiled Graph
 	executable backends.Executable
 }
@@ -266,6 +275,7 @@ func (g *Graph) Finalize() {
 		g.executable = nil
 	}
 	g.nodes = nil
+	g.opsToNodes = nil
 	g.parameters = nil
 	g.parametersNames = nil
 	g.parameterNameToHandle = nil
@@ -347,6 +357,7 @@ func (g *Graph) registerNode(node *Node) (id NodeId) {
 	id = NodeId(len(g.nodes))
 	g.nodes = append(g.nodes, node)
 	node.id = id
+	node.scope = g.Scope()
 	if g.traced {
 		node.trace = errors.New("Stack-trace")
 	}
@@ -384,6 +395,28 @@ func (g *Graph) Compile(outputs ...*Node) {
 		exceptions.Panicf("no outputs selected when Graph.Compile graph %q", g.name)
 	}
 
+	g.checkOutputs(outputs)
+
+	if klog.V(1).Enabled() {
+		start := time.Now()
+		defer func() {
+			elapsed := time.Since(start)
+			klog.Infof("Graph.Compile time for graph %q: %s", g.Name(), elapsed)
+		}()
+	}
+
+	outputsOps := xslices.Map(outputs, func(node *Node) backends.Op { return node.outputOps[0] })
+	var err error
+	g.executable, err = g.builder.Compile(outputsOps...)
+	if err != nil {
+		panic(errors.WithMessagef(err, "Graph failed to compile for the backend"))
+	}
+	return
+}
+
+// checkOutputs sanity checks the outputs of the graph, and replaces duplicate outputs by identities, as
+// required by the backends.
+func (g *Graph) checkOutputs(outputs []*Node) {
 	// Sanity check on the output nodes.
 	for ii, node := range outputs {
 		if node.NumOutputs() != 1 {
@@ -409,22 +442,6 @@ func (g *Graph) Compile(outputs ...*Node) {
 			outputsSet.Insert(node)
 		}
 	}
-
-	if klog.V(1).Enabled() {
-		start := time.Now()
-		defer func() {
-			elapsed := time.Since(start)
-			klog.Infof("Graph.Compile time for graph %q: %s", g.Name(), elapsed)
-		}()
-	}
-
-	outputsOps := xslices.Map(outputs, func(node *Node) backends.Op { return node.outputOps[0] })
-	var err error
-	g.executable, err = g.builder.Compile(outputsOps...)
-	if err != nil {
-		panic(errors.WithMessagef(err, "Graph failed to compile for the backend"))
-	}
-	return
 }
 
 // donateBuffer holds a buffer to be donated to the execution of a graph.
@@ -536,6 +553,11 @@ func (g *Graph) RunWithMap(inputs ParamsMap) (outputs []*tensors.Tensor) {
 // Notice that for repeated output nodes in the graph (the same output node returned in more than one position), the
 // returned tensors are shared.
 func (g *Graph) RunWithBuffers(inputs []backends.Buffer, donate []bool) (outputs []*tensors.Tensor) {
+	return g.runWithBuffers(inputs, donate, nil)
+}
+
+// runWithBuffers implements RunWithBuffers, and records the execution in the profiler, if it is not nil.
+func (g *Graph) runWithBuffers(inputs []backends.Buffer, donate []bool, profiler *Profiler) (outputs []*tensors.Tensor) {
 	g.AssertCompiled()
 	numParams := g.NumParameters()
 	if len(inputs) != numParams {
@@ -544,20 +566,32 @@ func (g *Graph) RunWithBuffers(inputs []backends.Buffer, donate []bool) (outputs
 	if len(donate) != numParams {
 		exceptions.Panicf("graph %q takes %d donate values for the input parameters, but %d were given to RunWithBuffers()", g.name, numParams, len(donate))
 	}
-	var start time.Time
 	var results []backends.Buffer
+	var opsProfile []backends.OpProfile
 	var err error
-	if klog.V(1).Enabled() {
-		start = time.Now()
-		results, err = g.executable.Execute(inputs, donate)
-		elapsed := time.Since(start)
-		klog.V(1).Infof("Graph.RunWithBuffers: %s elapsed", elapsed)
+	start := time.Now()
+	profilingExecutable, profileOps := g.executable.(backends.ProfilingExecutable)
+	if profiler != nil && profileOps {
+		results, opsProfile, err = profilingExecutable.ExecuteProfiled(inputs, donate)
 	} else {
 		results, err = g.executable.Execute(inputs, donate)
 	}
+	elapsed := time.Since(start)
+	if klog.V(1).Enabled() {
+		klog.V(1).Infof("Graph.RunWithBuffers: %s elapsed", elapsed)
+	}
 	if err != nil {
 		panic(errors.WithMessagef(err, "Graph failed to execute"))
 	}
+	if profiler != nil {
+		events := make([]ProfileEvent, 0, len(opsProfile)+1)
+		events = append(events, ProfileEvent{Type: ProfileExecute, Graph: g.name, Name: ProfileExecute.String(),
+			NodeId: InvalidNodeId, Start: start, Duration: elapsed})
+		for _, opProfile := range opsProfile {
+			events = append(events, g.opProfileEvent(opProfile))
+		}
+		profiler.Record(events...)
+	}
 	outputs = xslices.Map(results, func(buf backends.Buffer) *tensors.Tensor { return tensors.FromBuffer(g.backend, buf) })
 	return
 }
@@ -626,6 +660,43 @@ func (g *Graph) String() string {
 	return strings.Join(parts, "\n")
 }
 
+// PushScope sets the scope recorded in the nodes created from now on (see Node.Scope), until the matching
+// call to PopScope, usually using defer.
+//
+// It is a free-form path (e.g.: "/model/dense_0") used to group the nodes by the layer that created them: see
+// Graph.Visualize, Profiler.ByScope and train.Summarize. The layers push the scope of their context.Context at
+// their entry point:
+//
+//	func MyLayer(ctx *context.Context, x *Node) *Node {
+//		g := x.Graph()
+//		g.PushScope(ctx.Scope())
+//		defer g.PopScope()
+//		...
+//	}
+//
+// Notice this is orthogonal to the alias scope (see PushAliasScope), used to name the node aliases.
+func (g *Graph) PushScope(scope string) {
+	g.scopes = append(g.scopes, scope)
+}
+
+// PopScope restores the scope current before the matching call to PushScope.
+//
+// It panics if there are no scopes pushed.
+func (g *Graph) PopScope() {
+	if len(g.scopes) == 0 {
+		exceptions.Panicf("no scopes pushed when calling Graph.PopScope")
+	}
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// Scope returns the current scope (see PushScope), or "" if none was pushed.
+func (g *Graph) Scope() string {
+	if len(g.scopes) == 0 {
+		return ""
+	}
+	return g.scopes[len(g.scopes)-1]
+}
+
 // LoggedNodes returns all nodes from the graph marked to be logged. Exec object makes use
 // of this information and logs those values when executing the graph.
 func (g *Graph) LoggedNodes() (nodes []*Node) {
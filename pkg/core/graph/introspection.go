@@ -30,6 +30,28 @@ func (n *Node) ConstantValue() *tensors.Tensor {
 	return params.tensor
 }
 
+// staticInputsIntrospector is implemented by the NodeInputs of nodes that take static (non-Node) inputs.
+type staticInputsIntrospector interface {
+	staticInputs() map[string]any
+}
+
+// StaticInputs returns the static (non-Node) inputs used to create the node, indexed by the name of the parameter
+// in the corresponding backends.Builder method (e.g.: "axes" for ReduceSum, or "permutation" for Transpose).
+// It returns nil if the node has no static inputs.
+//
+// The returned values are shared with the node, and they must not be modified.
+// It's an "introspection" method.
+func (n *Node) StaticInputs() map[string]any {
+	if n == nil || n.inputs == nil {
+		return nil
+	}
+	introspector, ok := n.inputs.(staticInputsIntrospector)
+	if !ok {
+		return nil
+	}
+	return introspector.staticInputs()
+}
+
 // IsConstantExpression returns whether the Node is a Constant or an expression that depends only on constant values.
 // It traverses all the node dependencies and checks that all leaf nodes are constants.
 func (n *Node) IsConstantExpression() bool {
@@ -1,10 +1,13 @@
 package graph_test
 
 import (
+	"testing"
+
 	. "github.com/gomlx/gomlx/pkg/core/graph"
 	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gopjrt/dtypes"
 	"github.com/stretchr/testify/require"
-	"testing"
 )
 
 func TestIsConstantExpression(t *testing.T) {
@@ -21,3 +24,16 @@ func TestIsConstantExpression(t *testing.T) {
 	require.False(t, d.IsConstantExpression())
 	require.False(t, e.IsConstantExpression())
 }
+
+func TestStaticInputs(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	g := NewGraph(backend, "")
+	x := Parameter(g, "x", shapes.Make(dtypes.Float32, 2, 3))
+	transposed := TransposeAllAxes(x, 1, 0)
+	require.Equal(t, NodeTypeTranspose, transposed.Type())
+	require.Equal(t, map[string]any{"permutation": []int{1, 0}}, transposed.StaticInputs())
+	sum := ReduceSum(x, 1)
+	require.Equal(t, []int{1}, sum.StaticInputs()["axes"])
+	require.Nil(t, Add(x, x).StaticInputs())
+	require.Nil(t, x.StaticInputs())
+}
@@ -59,6 +59,13 @@ type Node struct {
 	// alias is a name by which the Node be referred in the Graph.
 	alias string
 
+	// scope is the graph scope when the node was created, see Node.Scope.
+	scope string
+
+	// onGradientPath is set for nodes through which a gradient was back-propagated by Gradient, and
+	// isGradient is set for the nodes created by Gradient to back-propagate it. Used for visualization.
+	onGradientPath, isGradient bool
+
 	// logMessage is set if node is marked for logging.
 	logMessage string
 
@@ -188,6 +195,12 @@ func (n *Node) LogMessage() string {
 	return n.logMessage
 }
 
+// Scope returns the scope (see Graph.PushScope) current when the node was created, or "" if none was pushed.
+// For graphs built with a context.Context, it is the context scope of the layer that created the node.
+func (n *Node) Scope() string {
+	return n.scope
+}
+
 // Trace returns stack-trace in form of an error, of when the node was created.
 // Only available if enabled by `Graph.SetTraced(true)`.
 func (n *Node) Trace() error {
@@ -548,8 +548,14 @@ func Where(condition, onTrue, onFalse *Node) *Node {
 
 // Reshape x to the given dimensions. Total size cannot change. One dimension can be left as -1,
 // in which case it will be set to match the size, if possible.
+//
+// If x has a dynamic shape (see shapes.DynamicDim), -1 stands for the dynamic dimension instead.
 func Reshape(x *Node, dimensions ...int) *Node {
 	_ = validateBuildingGraphFromInputs(x)
+	if x.Shape().IsDynamic() {
+		// -1 is shapes.DynamicDim for dynamic shapes, and the backend checks the sizes match.
+		return backendReshape(x, dimensions...)
+	}
 	totalSize := x.Shape().Size()
 	newSize := 1
 	missingIdx := -1
@@ -875,6 +881,21 @@ func MaskedReduceAllSum(x, mask *Node) *Node {
 func ReduceMean(x *Node, reduceAxes ...int) *Node {
 	_ = validateBuildingGraphFromInputs(x)
 	sum := ReduceSum(x, reduceAxes...)
+	if x.Shape().IsDynamic() {
+		// The dimension of the dynamic axes is only known at execution, see shapes.DynamicDim.
+		axes := adjustAxesToRank(x.Rank(), reduceAxes, "x")
+		denominator := 1
+		for axis, dim := range x.Shape().Dimensions {
+			if len(axes) > 0 && !slices.Contains(axes, axis) {
+				continue
+			}
+			if dim == shapes.DynamicDim {
+				exceptions.Panicf("ReduceMean over the dynamic axis %d of x (shape %s) is not supported", axis, x.Shape())
+			}
+			denominator *= dim
+		}
+		return MulScalar(sum, 1.0/float64(denominator))
+	}
 	denominator := x.Shape().Size() / sum.Shape().Size()
 	return MulScalar(sum, 1.0/float64(denominator))
 }
@@ -0,0 +1,195 @@
+package graph
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// AffineTransformConfig is created with AffineTransform and then actually executed
+// with a call to Done.
+//
+// Between its construction and execution one can set the various parameters for
+// the transformation.
+type AffineTransformConfig struct {
+	input, transforms         *Node
+	channelsAxisConfig        images.ChannelsAxisConfig
+	outputHeight, outputWidth int
+	isBilinear                bool
+	fillValue                 float64
+}
+
+// AffineTransform resamples a batch of 2D images using one affine transformation per example.
+//
+// The input is expected to be shaped `[batch_size, height, width, channels]` (the default) or
+// `[batch_size, channels, height, width]` if configured with ChannelsAxis(images.ChannelsFirst).
+//
+// The transforms are shaped `[batch_size, 2, 3]` (or `[2, 3]` if the same transformation is to be
+// used for all examples), and they map each *output* pixel coordinate to the *input* coordinate
+// from where it is sampled (the "inverse mapping" convention):
+//
+//	[input_row, input_col] = transforms[b] · [output_row, output_col, 1]
+//
+// Coordinates are given in pixel index units, so `[0, 0]` is the center of the top-left pixel.
+// Pixels sampled from outside the input image take the value configured with FillValue (default 0).
+//
+// Example: flip all images horizontally:
+//
+//	width := img.Shape().Dimensions[2]
+//	flip := Const(g, [][]float32{{1, 0, 0}, {0, -1, float32(width - 1)}})
+//	img = AffineTransform(img, flip).Done()
+//
+// AffineTransform returns an AffineTransformConfig that can be configured. When Done is called it
+// builds the graph for the transformation and returns the resampled images. The default is Bilinear sampling.
+//
+// The gradient is defined both with respect to the input images and to the transforms.
+func AffineTransform(input, transforms *Node) *AffineTransformConfig {
+	_ = validateBuildingGraphFromInputs(input, transforms)
+	return &AffineTransformConfig{
+		input:              input,
+		transforms:         transforms,
+		channelsAxisConfig: images.ChannelsLast,
+		isBilinear:         true,
+	}
+}
+
+// ChannelsAxis configures the axis for the channels (aka. "depth" or "features") dimension. The default is
+// `images.ChannelsLast`, meaning the "channels" dimension comes last.
+//
+// Note: `images` refers to package `github.com/gomlx/gomlx/core/tensors/images`.
+//
+// It returns the AffineTransformConfig passed, to allow cascaded method calls.
+func (c *AffineTransformConfig) ChannelsAxis(channelsAxisConfig images.ChannelsAxisConfig) *AffineTransformConfig {
+	c.channelsAxisConfig = channelsAxisConfig
+	return c
+}
+
+// OutputSize configures the height and width of the output images. The default is to use the same
+// size as the input.
+//
+// It returns the AffineTransformConfig passed, to allow cascaded method calls.
+func (c *AffineTransformConfig) OutputSize(height, width int) *AffineTransformConfig {
+	c.outputHeight, c.outputWidth = height, width
+	return c
+}
+
+// Bilinear configures the sampling to be bilinear (as opposed to nearest). Default is Bilinear.
+// See also Nearest.
+//
+// It returns the AffineTransformConfig passed, to allow cascaded method calls.
+func (c *AffineTransformConfig) Bilinear() *AffineTransformConfig {
+	c.isBilinear = true
+	return c
+}
+
+// Nearest configures the sampling to take the nearest pixel (as opposed to bilinear). Default is Bilinear.
+// Notice that with Nearest there is no gradient with respect to the transforms.
+//
+// It returns the AffineTransformConfig passed, to allow cascaded method calls.
+func (c *AffineTransformConfig) Nearest() *AffineTransformConfig {
+	c.isBilinear = false
+	return c
+}
+
+// FillValue configures the value used for pixels sampled from outside the input image. Default is 0.
+//
+// It returns the AffineTransformConfig passed, to allow cascaded method calls.
+func (c *AffineTransformConfig) FillValue(value float64) *AffineTransformConfig {
+	c.fillValue = value
+	return c
+}
+
+// Done finishes the configuration and creates the computation graph that resamples the images.
+// It returns the transformed images.
+func (c *AffineTransformConfig) Done() (output *Node) {
+	input := c.input
+	g := input.Graph()
+	if input.Rank() != 4 {
+		Panicf("AffineTransform requires images shaped [batch_size, height, width, channels] (or channels first), got %s",
+			input.Shape())
+	}
+	dtype := input.DType()
+	if !dtype.IsFloat() {
+		Panicf("AffineTransform requires images with a float dtype, got %s", input.Shape())
+	}
+	if c.channelsAxisConfig == images.ChannelsFirst {
+		input = TransposeAllAxes(input, 0, 2, 3, 1)
+	}
+	batchSize, height, width := input.Shape().Dimensions[0], input.Shape().Dimensions[1], input.Shape().Dimensions[2]
+	outHeight, outWidth := c.outputHeight, c.outputWidth
+	if outHeight <= 0 || outWidth <= 0 {
+		outHeight, outWidth = height, width
+	}
+
+	transforms := ConvertDType(c.transforms, dtype)
+	switch {
+	case transforms.Rank() == 2 && transforms.Shape().Dimensions[0] == 2 && transforms.Shape().Dimensions[1] == 3:
+		transforms = BroadcastPrefix(transforms, batchSize)
+	case transforms.Rank() == 3 && transforms.Shape().Dimensions[0] == batchSize &&
+		transforms.Shape().Dimensions[1] == 2 && transforms.Shape().Dimensions[2] == 3:
+		// Already in the expected shape.
+	default:
+		Panicf("AffineTransform requires transforms shaped [batch_size=%d, 2, 3] or [2, 3], got %s",
+			batchSize, c.transforms.Shape())
+	}
+
+	// Input coordinates for each output pixel: shaped [batch_size, outHeight, outWidth, 2].
+	gridShape := shapes.Make(dtype, outHeight, outWidth)
+	grid := Stack([]*Node{Iota(g, gridShape, 0), Iota(g, gridShape, 1), Ones(g, gridShape)}, -1)
+	// Rows and columns are split with a contraction (as opposed to a slice) to keep the gradient simple.
+	coords := Einsum("bij,hwj->bhwi", transforms, grid)
+	rows := ExpandAxes(Einsum("bhwi,i->bhw", coords, ConvertDType(Const(g, []float32{1, 0}), dtype)), -1)
+	cols := ExpandAxes(Einsum("bhwi,i->bhw", coords, ConvertDType(Const(g, []float32{0, 1}), dtype)), -1)
+
+	batchIndices := Iota(g, shapes.Make(dtypes.Int32, batchSize, outHeight, outWidth, 1), 0)
+	sample := func(rowsIdx, colsIdx *Node) (values, valid *Node) {
+		valid = And(
+			And(GreaterOrEqual(rowsIdx, ScalarZero(g, dtype)), LessOrEqual(rowsIdx, Scalar(g, dtype, height-1))),
+			And(GreaterOrEqual(colsIdx, ScalarZero(g, dtype)), LessOrEqual(colsIdx, Scalar(g, dtype, width-1))))
+		valid = ConvertDType(valid, dtype)
+		rowsIdx = ConvertDType(ClipScalar(rowsIdx, 0, float64(height-1)), dtypes.Int32)
+		colsIdx = ConvertDType(ClipScalar(colsIdx, 0, float64(width-1)), dtypes.Int32)
+		indices := Concatenate([]*Node{batchIndices, rowsIdx, colsIdx}, -1)
+		values = Gather(input, indices)
+		return
+	}
+
+	var weightedSum, totalWeight *Node
+	if c.isBilinear {
+		rows0 := StopGradient(Floor(rows))
+		cols0 := StopGradient(Floor(cols))
+		rows1, cols1 := OnePlus(rows0), OnePlus(cols0)
+		rowsW1 := Sub(rows, rows0)
+		colsW1 := Sub(cols, cols0)
+		rowsW0, colsW0 := OneMinus(rowsW1), OneMinus(colsW1)
+		for _, corner := range [][4]*Node{
+			{rows0, cols0, rowsW0, colsW0},
+			{rows0, cols1, rowsW0, colsW1},
+			{rows1, cols0, rowsW1, colsW0},
+			{rows1, cols1, rowsW1, colsW1},
+		} {
+			values, valid := sample(corner[0], corner[1])
+			weight := Mul(Mul(corner[2], corner[3]), valid)
+			if weightedSum == nil {
+				weightedSum = Mul(values, weight)
+				totalWeight = weight
+			} else {
+				weightedSum = Add(weightedSum, Mul(values, weight))
+				totalWeight = Add(totalWeight, weight)
+			}
+		}
+	} else {
+		values, valid := sample(StopGradient(Round(rows)), StopGradient(Round(cols)))
+		weightedSum = Mul(values, valid)
+		totalWeight = valid
+	}
+	output = weightedSum
+	if c.fillValue != 0 {
+		output = Add(output, MulScalar(OneMinus(totalWeight), c.fillValue))
+	}
+	if c.channelsAxisConfig == images.ChannelsFirst {
+		output = TransposeAllAxes(output, 0, 3, 1, 2)
+	}
+	return
+}
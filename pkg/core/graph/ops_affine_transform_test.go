@@ -0,0 +1,66 @@
+package graph_test
+
+import (
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+)
+
+func TestAffineTransform(t *testing.T) {
+	testFuncOneInput(t, "AffineTransform(identity)",
+		func(g *Graph) (input, output *Node) {
+			input = Const(g, [][][][]float32{{{{1}, {2}}, {{3}, {4}}}})
+			output = AffineTransform(input, Const(g, [][]float32{{1, 0, 0}, {0, 1, 0}})).Done()
+			return
+		}, [][][][]float32{{{{1}, {2}}, {{3}, {4}}}})
+
+	testFuncOneInput(t, "AffineTransform(flip left-right)",
+		func(g *Graph) (input, output *Node) {
+			input = Const(g, [][][][]float32{{{{1}, {2}, {3}}, {{4}, {5}, {6}}}})
+			output = AffineTransform(input, Const(g, [][]float32{{1, 0, 0}, {0, -1, 2}})).Done()
+			return
+		}, [][][][]float32{{{{3}, {2}, {1}}, {{6}, {5}, {4}}}})
+
+	testFuncOneInput(t, "AffineTransform(translate).FillValue(-1)",
+		func(g *Graph) (input, output *Node) {
+			input = Const(g, [][][][]float32{{{{1}, {2}, {3}}}})
+			output = AffineTransform(input, Const(g, [][]float32{{1, 0, 0}, {0, 1, -0.5}})).
+				FillValue(-1).Done()
+			return
+		}, [][][][]float32{{{{0}, {1.5}, {2.5}}}})
+
+	testFuncOneInput(t, "AffineTransform(per-example).Nearest().ChannelsAxis(ChannelsFirst)",
+		func(g *Graph) (input, output *Node) {
+			input = Const(g, [][][][]float32{{{{1, 2}}}, {{{3, 4}}}})
+			output = AffineTransform(input, Const(g, [][][]float32{
+				{{1, 0, 0}, {0, 1, 0}},
+				{{1, 0, 0}, {0, -1, 1.2}},
+			})).Nearest().ChannelsAxis(images.ChannelsFirst).Done()
+			return
+		}, [][][][]float32{{{{1, 2}}}, {{{4, 3}}}})
+
+	testFuncOneInput(t, "AffineTransform(downscale).OutputSize(1, 2)",
+		func(g *Graph) (input, output *Node) {
+			input = Const(g, [][][][]float32{{{{0}, {1}, {2}, {3}}, {{4}, {5}, {6}, {7}}}})
+			output = AffineTransform(input, Const(g, [][]float32{{1, 0, 0.5}, {0, 2, 0.5}})).
+				OutputSize(1, 2).Done()
+			return
+		}, [][][][]float32{{{{2.5}, {4.5}}}})
+}
+
+func TestGradientAffineTransform(t *testing.T) {
+	testGradients(t, "Gradient AffineTransform() wrt horizontal shift",
+		func(g *Graph) (output *Node, nodesForGrad []*Node) {
+			input := Const(g, [][][][]float64{{{{1}, {2}, {4}, {8}}}})
+			shift := Const(g, 0.25)
+			transform := Add(Const(g, [][]float64{{1, 0, 0}, {0, 1, 0}}),
+				Mul(Const(g, [][]float64{{0, 0, 0}, {0, 0, 1}}), shift))
+			output = AffineTransform(input, transform).Done()
+			return output, []*Node{shift}
+		}, []any{
+			// Moving the sampling point to the right increases the output by the slope of each
+			// interval (1, 2, 4), and the last pixel samples outside the image (slope -8).
+			float64(1 + 2 + 4 - 8),
+		})
+}
@@ -98,7 +98,7 @@ func Convolve(x, kernel *Node) *ConvolutionBuilder {
 			"and kernel has an output_channels dimension", kernel.Rank(), x.Rank())
 	}
 
-	return conv.ChannelsAxis(timage.ChannelsLast).NoPadding()
+	return conv.ChannelsAxis(timage.ChannelsLast).NoPadding().Strides(1)
 }
 
 // gatherSlice returns a slice of int values by gathering values from the params slices indexed by indices.
@@ -579,15 +579,20 @@ func convVJPWrtX(node, x, kernel, v *Node, numSpatialDims int, axes ConvolveAxes
 
 	// Instead of transposing output/input channels, just swap their indices in the reverseAxes. Effectively this does:
 	//     reverseKernel = Transpose(reverseKernel, axes.KernelOutputChannels, axes.KernelInputChannels)
-
 	reverseAxes := axes
 	reverseAxes.KernelInputChannels, reverseAxes.KernelOutputChannels = axes.KernelOutputChannels, axes.KernelInputChannels
 
-	// (2) we need to pad the reverse convolution to match get the original input.
+	// (2) we need to pad the reverse convolution to get the original input shape.
+	//
+	// The input x[i] contributes to the output[o] (with kernel position k) if `i + padding_start = o*stride + k*dilation`.
+	// So the gradient is the convolution of v, dilated by the strides (as input dilation) and padded at the start by
+	// `(kernelSize-1)*dilation - padding_start`, with the reversed kernel. Negative paddings are converted to a slice
+	// of the result.
 	reversePaddings := make([][2]int, numSpatialDims)
+	sliceStarts := make([]int, numSpatialDims)
+	var needsSlice bool
 	dilation := 1
 	for axis := 0; axis < numSpatialDims; axis++ {
-		//fmt.Printf("\taxis %d\n", axis)
 		// Effective kernel size.
 		kernelSize := kernelSpatialDims[axis]
 		if len(kernelDilations) > 0 {
@@ -600,50 +605,42 @@ func convVJPWrtX(node, x, kernel, v *Node, numSpatialDims int, axes ConvolveAxes
 		if len(strides) > 0 {
 			dimStride = strides[axis]
 		}
-
-		// Start/End positions on the original input.
 		var dimPadding [2]int
 		if len(paddings) > 0 {
 			dimPadding = paddings[axis]
 		}
-		inputDimStart := (kernelSize-1)/2 - dimPadding[0]
-		inputDimEnd := inputDimSize - kernelSize/2 + dimPadding[1]
-
-		if (inputDimEnd-inputDimStart+(dimStride-1))/dimStride != outputDimSize {
+		if expectedOutputSize(inputDimSize, kernelSpatialDims[axis], dilation, dimStride, dimPadding) != outputDimSize {
 			Panicf("failed to set up reverse Convolve() for gradient in spatial dimension %d: "+
-				"outputDimSize=%d, but input convolution window is %d with stride for this dimension %d",
-				axis, outputDimSize, inputDimEnd-inputDimStart, dimStride)
-		}
-
-		// Start/End positions on the output for the reverse convolution.
-		// Values below 0 or above outputDimSize means padding. It has to be such that it will regenerate
-		// the original input spatial shapes.
-		// Stride in the input becomes inputDilations in the reverse convolution.
-		outputDimStart := -inputDimStart - ((kernelSize - 1) / 2)
-		if outputDimStart > 0 {
-			Panicf("failed to set up reverse Convolve() for gradient: spatial dimension %d "+
-				"outputDimStart=%d > 0, which is out-of-bounds", axis, outputDimStart)
+				"outputDimSize=%d, but input size is %d, effective kernel size is %d and stride is %d",
+				axis, outputDimSize, inputDimSize, kernelSize, dimStride)
 		}
-		outputDimEnd := inputDimSize - inputDimStart + kernelSize/2
-		// So far outputDimEnd and outputDimStart haven't considered the strides converted to input dilation
-		// on the reverse convolution -- effectively injecting zeros.
-		numInjectedZeros := (outputDimSize - 1) * (dimStride - 1)
-		outputDimEnd -= numInjectedZeros
-		if outputDimEnd < outputDimSize {
-			Panicf("failed to set up reverse Convolve() for gradient: spatial dimension %d "+
-				"outputDimEnd=%d < outputDimSize=%d, which is out-of-bounds", axis, outputDimEnd, outputDimSize)
+		dilatedOutputSize := (outputDimSize-1)*dimStride + 1
+		start := kernelSize - 1 - dimPadding[0]
+		end := inputDimSize - 1 + dimPadding[0] - (dilatedOutputSize - 1) // So the reverse output has inputDimSize.
+		reversePaddings[axis] = [2]int{max(start, 0), max(end, 0)}
+		if start < 0 || end < 0 {
+			needsSlice = true
+			sliceStarts[axis] = -min(start, 0)
 		}
-
-		// Set padding to the output to match its start/end positions.
-		reversePaddings[axis][0] = -outputDimStart
-		reversePaddings[axis][1] = outputDimEnd - outputDimSize
 	}
-	// (3) Run2 the reverse convolution of the VJP.
+
+	// (3) Run the reverse convolution of the VJP.
 	revConv := Convolve(v, reverseKernel).PaddingPerDim(reversePaddings).DilationPerAxis(kernelDilations...).AxesConfig(reverseAxes)
 	if len(strides) > 0 {
 		revConv.InputDilationPerAxis(strides...)
 	}
-	return revConv.Done()
+	vjpX := revConv.Done()
+	if needsSlice {
+		specs := make([]SliceAxisSpec, vjpX.Rank())
+		for ii := range specs {
+			specs[ii] = AxisRange()
+		}
+		for axis, outputAxis := range reverseAxes.OutputSpatial {
+			specs[outputAxis] = AxisRange(sliceStarts[axis], sliceStarts[axis]+inputSpatialDims[axis])
+		}
+		vjpX = Slice(vjpX, specs...)
+	}
+	return vjpX
 }
 
 func expectedOutputSize(inputSize, kernelSize, dilation, stride int, padding [2]int) int {
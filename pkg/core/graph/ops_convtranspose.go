@@ -0,0 +1,327 @@
+package graph
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	timage "github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+)
+
+// This file contains all parts of the ConvolveTranspose implementation.
+
+// ConvolveTransposeBuilder is a helper to build a transposed convolution computation.
+// Create it with ConvolveTranspose, set the desired parameters and when set, call Done.
+type ConvolveTransposeBuilder struct {
+	graph                       *Graph
+	x, kernel                   *Node
+	numSpatialDims              int
+	channelsAxisConfig          timage.ChannelsAxisConfig
+	strides, dilations          []int
+	paddings                    [][2]int
+	padSame                     bool
+	outputPaddings, outputSizes []int
+	channelGroupCount           int
+}
+
+// ConvolveTranspose prepares a transposed convolution (also known as "deconvolution" or "fractionally strided
+// convolution") on x with the given kernel, for an arbitrary number of spatial dimensions (1D, 2D, 3D, etc.).
+//
+// It is the transpose (and the gradient with respect to the input) of a Convolve with the same kernel and
+// configuration (strides, paddings and dilations), and it is commonly used to up-sample images, e.g., in the
+// decoder of a U-Net. With strides = s, the output spatial dimensions are (approximately) s times larger.
+//
+// It returns a ConvolveTransposeBuilder object that can be further configured. Once the configuration is finished,
+// call ConvolveTransposeBuilder.Done, and it will return the result.
+//
+// * Shapes:
+//
+// The shape of x should be [batch, <spatial_dimensions...>, input_channels] if configured with
+// ConvolveTransposeBuilder.ChannelsAxis(timage.ChannelsLast), the default.
+// If one sets ConvolveTransposeBuilder.ChannelsAxis(timage.ChannelsFirst), then the shape should be
+// [batch, input_channels, <spatial_dimensions...>] instead.
+//
+// The shape of the kernel should be [<spatial_dimensions...>, output_channels/groups, input_channels] if
+// configured with ChannelsLast (the same as Keras Conv*DTranspose), or
+// [input_channels, output_channels/groups, <spatial_dimensions...>] if configured with ChannelsFirst (the same as
+// PyTorch and ONNX ConvTranspose). That is the same shape of the kernel of the Convolve it is the transpose of.
+//
+// The size of each output spatial axis is
+// `(input_size - 1) * stride - padding_start - padding_end + dilation * (kernel_size - 1) + 1 + output_padding`.
+//
+// Notice x and kernel must have the same rank.
+func ConvolveTranspose(x, kernel *Node) *ConvolveTransposeBuilder {
+	conv := &ConvolveTransposeBuilder{
+		graph:             validateBuildingGraphFromInputs(x, kernel),
+		x:                 x,
+		kernel:            kernel,
+		channelGroupCount: 1,
+	}
+	conv.numSpatialDims = x.Rank() - 2
+	if conv.numSpatialDims < 0 {
+		Panicf("the input x must have rank >= 3, shaped by default as [batch, <spatial_dimensions...>, channels], "+
+			"but x rank is %d", x.Rank())
+	}
+	if kernel.Rank() != x.Rank() {
+		Panicf("the kernel (rank %d) must have the same rank as the input x (rank %d) -- x has a batch dimension, "+
+			"and kernel has an output_channels dimension", kernel.Rank(), x.Rank())
+	}
+	return conv.ChannelsAxis(timage.ChannelsLast).NoPadding()
+}
+
+// ChannelsAxis configures the axis for the channels (aka. "depth" or "features") dimension. The default is
+// `timage.ChannelsLast`, meaning the "channels" dimension comes last.
+//
+// Note: `timage` refers to the package github.com/gomlx/gomlx/core/tensors/images
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (conv *ConvolveTransposeBuilder) ChannelsAxis(channelsAxisConfig timage.ChannelsAxisConfig) *ConvolveTransposeBuilder {
+	conv.channelsAxisConfig = channelsAxisConfig
+	return conv
+}
+
+// Strides sets the strides of the convolution it is the transpose of: it sets the same value for every dimension.
+// The default is 1.
+//
+// A stride of 2 will double the size of the input.
+func (conv *ConvolveTransposeBuilder) Strides(strides int) *ConvolveTransposeBuilder {
+	return conv.StridePerAxis(xslices.SliceWithValue(conv.numSpatialDims, strides)...)
+}
+
+// StridePerAxis sets the strides for each spatial dimension. The default is 1 for every dimension.
+func (conv *ConvolveTransposeBuilder) StridePerAxis(strides ...int) *ConvolveTransposeBuilder {
+	if len(strides) != conv.numSpatialDims {
+		Panicf("received %d strides in StridePerAxis, but x has %d spatial dimensions",
+			len(strides), conv.numSpatialDims)
+	}
+	conv.strides = strides
+	return conv
+}
+
+// Dilations sets the kernel dilations: the same value is used for every dimension. The default is 1.
+func (conv *ConvolveTransposeBuilder) Dilations(dilation int) *ConvolveTransposeBuilder {
+	return conv.DilationPerAxis(xslices.SliceWithValue(conv.numSpatialDims, dilation)...)
+}
+
+// DilationPerAxis sets the kernel dilations for each spatial dimension. The default is 1 for every axis.
+func (conv *ConvolveTransposeBuilder) DilationPerAxis(dilations ...int) *ConvolveTransposeBuilder {
+	if len(dilations) == 0 {
+		conv.dilations = nil
+		return conv
+	}
+	if len(dilations) != conv.numSpatialDims {
+		Panicf("received %d dilations in DilationPerAxis, but x has %d spatial dimensions",
+			len(dilations), conv.numSpatialDims)
+	}
+	conv.dilations = dilations
+	return conv
+}
+
+// PadSame sets the paddings such that the output spatial dimensions are the input's multiplied by the strides.
+// It's the transpose of a Convolve with PadSame, when its input dimensions are divisible by the strides.
+//
+// The default is no padding. See also NoPadding and PaddingPerDim.
+func (conv *ConvolveTransposeBuilder) PadSame() *ConvolveTransposeBuilder {
+	conv.paddings = nil
+	conv.padSame = true
+	return conv
+}
+
+// NoPadding sets no paddings, so the output spatial dimensions are the largest. This is the default.
+//
+// See also PadSame and PaddingPerDim.
+func (conv *ConvolveTransposeBuilder) NoPadding() *ConvolveTransposeBuilder {
+	conv.paddings = nil
+	conv.padSame = false
+	return conv
+}
+
+// PaddingPerDim specifies the paddings of the convolution it is the transpose of, at the start and at the end,
+// per spatial dimension. Contrary to Convolve, they are removed from the output.
+//
+// If a nil value for paddings is given, this has no effect.
+//
+// The default is no padding. See also NoPadding and PadSame.
+func (conv *ConvolveTransposeBuilder) PaddingPerDim(paddings [][2]int) *ConvolveTransposeBuilder {
+	if paddings == nil {
+		return conv
+	}
+	if len(paddings) != conv.numSpatialDims {
+		Panicf("received %d paddings in PaddingPerDim, but x has %d spatial dimensions",
+			len(paddings), conv.numSpatialDims)
+	}
+	conv.paddings = paddings
+	conv.padSame = false
+	return conv
+}
+
+// OutputPaddingPerAxis sets extra padding added at the end of each output spatial axis.
+//
+// With strides > 1, different input sizes of a Convolve yield the same output size, so the transposed
+// convolution is ambiguous. The output padding, usually in the range [0, stride), resolves the ambiguity.
+//
+// The default is 0. See also OutputSizePerAxis.
+func (conv *ConvolveTransposeBuilder) OutputPaddingPerAxis(paddings ...int) *ConvolveTransposeBuilder {
+	if len(paddings) != conv.numSpatialDims {
+		Panicf("received %d output paddings in OutputPaddingPerAxis, but x has %d spatial dimensions",
+			len(paddings), conv.numSpatialDims)
+	}
+	conv.outputPaddings = paddings
+	conv.outputSizes = nil
+	return conv
+}
+
+// OutputSizePerAxis sets the output spatial dimensions: the output padding is calculated such that the output has
+// the given sizes. It must be at least the output size without output padding.
+//
+// See also OutputPaddingPerAxis.
+func (conv *ConvolveTransposeBuilder) OutputSizePerAxis(sizes ...int) *ConvolveTransposeBuilder {
+	if len(sizes) != conv.numSpatialDims {
+		Panicf("received %d output sizes in OutputSizePerAxis, but x has %d spatial dimensions",
+			len(sizes), conv.numSpatialDims)
+	}
+	conv.outputSizes = sizes
+	conv.outputPaddings = nil
+	return conv
+}
+
+// ChannelGroupCount splits input/output channels into independent groups, like ConvolutionBuilder.ChannelGroupCount.
+//
+// The kernel's output channels axis must be output_channels / groupCount.
+func (conv *ConvolveTransposeBuilder) ChannelGroupCount(groupCount int) *ConvolveTransposeBuilder {
+	if groupCount < 1 {
+		Panicf("ChannelGroupCount must be >= 1, got %d", groupCount)
+	}
+	conv.channelGroupCount = groupCount
+	return conv
+}
+
+// Done indicates that the transposed convolution is finished being configured, and it updates the computation
+// graph with it, returning the resulting Node.
+//
+// It is implemented as a regular convolution, with stride 1, of x dilated with zeros (strides - 1 zeros between
+// elements) and padded, using the kernel with the spatial axes reversed and the channels axes transposed.
+// So it is fully differentiable.
+func (conv *ConvolveTransposeBuilder) Done() *Node {
+	x, kernel := conv.x, conv.kernel
+	numSpatialDims := conv.numSpatialDims
+	groups := conv.channelGroupCount
+
+	// Canonical kernel layout: [<spatial_dimensions...>, output_channels/groups, input_channels].
+	var inputSpatialAxes []int
+	var inputChannelsAxis int
+	if conv.channelsAxisConfig == timage.ChannelsFirst {
+		inputChannelsAxis = 1
+		inputSpatialAxes = xslices.Iota(2, numSpatialDims)
+		permutation := append(xslices.Iota(2, numSpatialDims), 1, 0)
+		kernel = TransposeAllAxes(kernel, permutation...)
+	} else {
+		inputChannelsAxis = numSpatialDims + 1
+		inputSpatialAxes = xslices.Iota(1, numSpatialDims)
+	}
+	kernelSpatialDims := kernel.Shape().Dimensions[:numSpatialDims]
+	inputChannels := x.Shape().Dimensions[inputChannelsAxis]
+	groupOutputChannels := kernel.Shape().Dimensions[numSpatialDims]
+	if kernel.Shape().Dimensions[numSpatialDims+1] != inputChannels {
+		Panicf("ConvolveTranspose: kernel shape %s doesn't match the number of input channels %d of x (shape %s)",
+			conv.kernel.Shape(), inputChannels, x.Shape())
+	}
+	if inputChannels%groups != 0 {
+		Panicf("ConvolveTranspose: input channels (%d) not divisible by ChannelGroupCount (%d)", inputChannels, groups)
+	}
+
+	// Kernel of the equivalent convolution: spatial axes reversed, shaped
+	// [<spatial_dimensions...>, input_channels/groups, output_channels].
+	kernel = Reverse(kernel, xslices.Iota(0, numSpatialDims)...)
+	if groups == 1 {
+		kernel = Transpose(kernel, numSpatialDims, numSpatialDims+1)
+	} else {
+		dims := kernel.Shape().Dimensions
+		kernel = Reshape(kernel, append(dims[:numSpatialDims:numSpatialDims],
+			groupOutputChannels, groups, inputChannels/groups)...)
+		permutation := append(xslices.Iota(0, numSpatialDims), numSpatialDims+2, numSpatialDims+1, numSpatialDims)
+		kernel = TransposeAllAxes(kernel, permutation...)
+		kernel = Reshape(kernel, append(dims[:numSpatialDims:numSpatialDims],
+			inputChannels/groups, groups*groupOutputChannels)...)
+	}
+
+	// Dilate x with zeros, and calculate the paddings of the equivalent convolution.
+	paddings := make([][2]int, numSpatialDims)
+	for spatialIdx, axis := range inputSpatialAxes {
+		stride, dilation := 1, 1
+		if len(conv.strides) > 0 {
+			stride = conv.strides[spatialIdx]
+		}
+		if len(conv.dilations) > 0 {
+			dilation = conv.dilations[spatialIdx]
+		}
+		inputSize := x.Shape().Dimensions[axis]
+		effectiveKernelSize := (kernelSpatialDims[spatialIdx]-1)*dilation + 1
+		var padding [2]int
+		var outputPadding int
+		if conv.padSame {
+			total := max(effectiveKernelSize-stride, 0)
+			padding = [2]int{total / 2, total - total/2}
+			outputPadding = max(stride-effectiveKernelSize, 0)
+		} else if conv.paddings != nil {
+			padding = conv.paddings[spatialIdx]
+		}
+		baseOutputSize := (inputSize-1)*stride - padding[0] - padding[1] + effectiveKernelSize
+		if conv.outputSizes != nil {
+			outputPadding = conv.outputSizes[spatialIdx] - baseOutputSize
+			if outputPadding < 0 {
+				Panicf("ConvolveTranspose: output size %d for spatial axis #%d is too small, it must be >= %d",
+					conv.outputSizes[spatialIdx], spatialIdx, baseOutputSize)
+			}
+		} else if conv.outputPaddings != nil {
+			outputPadding += conv.outputPaddings[spatialIdx]
+		}
+		if stride > 1 {
+			x = dilateWithZeros(x, axis, stride)
+		}
+		paddings[spatialIdx] = [2]int{
+			effectiveKernelSize - 1 - padding[0],
+			effectiveKernelSize - 1 - padding[1] + outputPadding,
+		}
+		// Negative paddings are converted to slicing of x.
+		if paddings[spatialIdx][0] < 0 || paddings[spatialIdx][1] < 0 {
+			start, end := max(-paddings[spatialIdx][0], 0), x.Shape().Dimensions[axis]-max(-paddings[spatialIdx][1], 0)
+			if start >= end {
+				Panicf("ConvolveTranspose: paddings %v are too large for spatial axis #%d", padding, spatialIdx)
+			}
+			specs := make([]SliceAxisSpec, x.Rank())
+			for ii := range specs {
+				specs[ii] = AxisRange()
+			}
+			specs[axis] = AxisRange(start, end)
+			x = Slice(x, specs...)
+			paddings[spatialIdx][0] = max(paddings[spatialIdx][0], 0)
+			paddings[spatialIdx][1] = max(paddings[spatialIdx][1], 0)
+		}
+	}
+
+	var axes ConvolveAxesConfig
+	axes.InputBatch, axes.InputChannels, axes.InputSpatial = 0, inputChannelsAxis, inputSpatialAxes
+	axes.OutputBatch, axes.OutputChannels, axes.OutputSpatial = 0, inputChannelsAxis, inputSpatialAxes
+	axes.KernelSpatial = xslices.Iota(0, numSpatialDims)
+	axes.KernelInputChannels, axes.KernelOutputChannels = numSpatialDims, numSpatialDims+1
+	strides := xslices.SliceWithValue(numSpatialDims, 1)
+	return ConvGeneral(x, kernel, axes, strides, paddings, nil, conv.dilations, groups, 1)
+}
+
+// dilateWithZeros inserts (dilation - 1) zeros in between the elements of x along the given axis.
+func dilateWithZeros(x *Node, axis, dilation int) *Node {
+	dims := x.Shape().Dimensions
+	x = InsertAxes(x, axis+1)
+	zerosDims := append([]int{}, x.Shape().Dimensions...)
+	zerosDims[axis+1] = dilation - 1
+	x = Concatenate([]*Node{x, Zeros(x.Graph(), shapes.Make(x.DType(), zerosDims...))}, axis+1)
+	newDims := append([]int{}, dims...)
+	newDims[axis] *= dilation
+	x = Reshape(x, newDims...)
+	specs := make([]SliceAxisSpec, x.Rank())
+	for ii := range specs {
+		specs[ii] = AxisRange()
+	}
+	specs[axis] = AxisRange(0, (dims[axis]-1)*dilation+1)
+	return Slice(x, specs...)
+}
@@ -0,0 +1,201 @@
+package graph_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+)
+
+// convTransposeTestCase is the configuration of one ConvolveTranspose test, with channels last.
+type convTransposeTestCase struct {
+	xDims, kernelDims           []int
+	strides, dilations          []int
+	paddings                    [][2]int
+	outputPaddings              []int
+	groups                      int
+	wantOutputSpatialDimensions []int
+}
+
+// referenceConvTranspose calculates the transposed convolution on the host, by scattering each input value
+// multiplied by the kernel to the output.
+func referenceConvTranspose(x, kernel *tensors.Tensor, tc convTransposeTestCase) *tensors.Tensor {
+	xDims, kernelDims := x.Shape().Dimensions, kernel.Shape().Dimensions
+	numSpatialDims := len(xDims) - 2
+	batchSize, inputChannels := xDims[0], xDims[numSpatialDims+1]
+	groupOutputChannels := kernelDims[numSpatialDims]
+	groupInputChannels := inputChannels / tc.groups
+	outputDims := append([]int{batchSize}, tc.wantOutputSpatialDimensions...)
+	outputDims = append(outputDims, groupOutputChannels*tc.groups)
+	output := tensors.FromShape(shapes.Make(dtypes.Float64, outputDims...))
+	xFlat := tensors.CopyFlatData[float64](x)
+	kernelFlat := tensors.CopyFlatData[float64](kernel)
+	outputFlat := make([]float64, output.Shape().Size())
+
+	xStrides := shapes.Make(dtypes.Float64, xDims...).Strides()
+	kernelStrides := shapes.Make(dtypes.Float64, kernelDims...).Strides()
+	outputStrides := shapes.Make(dtypes.Float64, outputDims...).Strides()
+	xSpatial := xDims[1 : numSpatialDims+1]
+	kernelSpatial := kernelDims[:numSpatialDims]
+
+	// iterate over all indices of dims.
+	iterate := func(dims []int, fn func(indices []int)) {
+		indices := make([]int, len(dims))
+		for {
+			fn(indices)
+			axis := len(dims) - 1
+			for ; axis >= 0; axis-- {
+				indices[axis]++
+				if indices[axis] < dims[axis] {
+					break
+				}
+				indices[axis] = 0
+			}
+			if axis < 0 {
+				return
+			}
+		}
+	}
+	for b := range batchSize {
+		iterate(xSpatial, func(xIdx []int) {
+			iterate(kernelSpatial, func(kIdx []int) {
+				outputOffset := b * outputStrides[0]
+				for axis := range numSpatialDims {
+					pos := xIdx[axis]*tc.strides[axis] - tc.paddings[axis][0] + kIdx[axis]*tc.dilations[axis]
+					if pos < 0 || pos >= tc.wantOutputSpatialDimensions[axis] {
+						return
+					}
+					outputOffset += pos * outputStrides[axis+1]
+				}
+				xOffset := b * xStrides[0]
+				kernelOffset := 0
+				for axis := range numSpatialDims {
+					xOffset += xIdx[axis] * xStrides[axis+1]
+					kernelOffset += kIdx[axis] * kernelStrides[axis]
+				}
+				for inCh := range inputChannels {
+					group := inCh / groupInputChannels
+					for outCh := range groupOutputChannels {
+						outputFlat[outputOffset+group*groupOutputChannels+outCh] +=
+							xFlat[xOffset+inCh] * kernelFlat[kernelOffset+outCh*kernelStrides[numSpatialDims]+inCh]
+					}
+				}
+			})
+		})
+	}
+	tensors.MutableFlatData[float64](output, func(flat []float64) {
+		copy(flat, outputFlat)
+	})
+	return output
+}
+
+func TestConvTranspose(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	testCases := []convTransposeTestCase{
+		{ // 1D with strides, paddings and output padding.
+			xDims: []int{2, 5, 3}, kernelDims: []int{3, 2, 3},
+			strides: []int{2}, dilations: []int{1}, paddings: [][2]int{{1, 0}}, outputPaddings: []int{1},
+			groups: 1, wantOutputSpatialDimensions: []int{11},
+		},
+		{ // 2D with strides, dilations and groups.
+			xDims: []int{1, 4, 3, 4}, kernelDims: []int{2, 3, 3, 4},
+			strides: []int{2, 1}, dilations: []int{1, 2}, paddings: [][2]int{{0, 0}, {1, 2}}, outputPaddings: []int{0, 0},
+			groups: 2, wantOutputSpatialDimensions: []int{8, 4},
+		},
+		{ // 3D with strides.
+			xDims: []int{1, 2, 3, 2, 2}, kernelDims: []int{2, 2, 2, 1, 2},
+			strides: []int{2, 2, 1}, dilations: []int{1, 1, 1}, paddings: [][2]int{{0, 0}, {0, 0}, {0, 0}},
+			outputPaddings: []int{0, 1, 0}, groups: 1, wantOutputSpatialDimensions: []int{4, 7, 3},
+		},
+	}
+	for ii, tc := range testCases {
+		t.Run(fmt.Sprintf("case-%d", ii), func(t *testing.T) {
+			// Non-trivial values for the input and kernel.
+			x := MustExecOnce(backend, func(g *Graph) *Node {
+				return Sin(IotaFull(g, shapes.Make(dtypes.Float64, tc.xDims...)))
+			})
+			kernel := MustExecOnce(backend, func(g *Graph) *Node {
+				return Cos(IotaFull(g, shapes.Make(dtypes.Float64, tc.kernelDims...)))
+			})
+			want := referenceConvTranspose(x, kernel, tc)
+			got := MustExecOnce(backend, func(x, kernel *Node) *Node {
+				return ConvolveTranspose(x, kernel).
+					StridePerAxis(tc.strides...).
+					DilationPerAxis(tc.dilations...).
+					PaddingPerDim(tc.paddings).
+					OutputPaddingPerAxis(tc.outputPaddings...).
+					ChannelGroupCount(tc.groups).
+					Done()
+			}, x, kernel)
+			require.True(t, want.InDelta(got, 1e-9), "want %s\ngot %s", want, got)
+
+			// Same with channels first, and the output size given explicitly.
+			gotChannelsFirst := MustExecOnce(backend, func(x, kernel *Node) *Node {
+				rank := x.Rank()
+				x = TransposeAllAxes(x, append([]int{0, rank - 1}, xslices.Iota(1, rank-2)...)...)
+				kernel = TransposeAllAxes(kernel, append([]int{rank - 1, rank - 2}, xslices.Iota(0, rank-2)...)...)
+				output := ConvolveTranspose(x, kernel).
+					ChannelsAxis(images.ChannelsFirst).
+					StridePerAxis(tc.strides...).
+					DilationPerAxis(tc.dilations...).
+					PaddingPerDim(tc.paddings).
+					OutputSizePerAxis(tc.wantOutputSpatialDimensions...).
+					ChannelGroupCount(tc.groups).
+					Done()
+				return TransposeAllAxes(output, append(append([]int{0}, xslices.Iota(2, rank-2)...), 1)...)
+			}, x, kernel)
+			require.True(t, want.InDelta(gotChannelsFirst, 1e-9), "want %s\ngot %s", want, gotChannelsFirst)
+		})
+	}
+}
+
+func TestConvTransposePadSame(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	for _, kernelSize := range []int{1, 2, 3, 4} {
+		output := MustExecOnce(backend, func(g *Graph) *Node {
+			x := IotaFull(g, shapes.Make(dtypes.Float32, 2, 5, 3, 4))
+			kernel := Ones(g, shapes.Make(dtypes.Float32, kernelSize, kernelSize, 2, 4))
+			return ConvolveTranspose(x, kernel).Strides(2).PadSame().Done()
+		})
+		require.NoError(t, output.Shape().CheckDims(2, 10, 6, 2))
+	}
+}
+
+// TestGradientConvTranspose checks that the transposed convolution is the adjoint of the convolution:
+// <ConvolveTranspose(x, kernel), y> = <x, Convolve(y, kernel)>, and so are their gradients.
+func TestGradientConvTranspose(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	for _, groups := range []int{1, 2} {
+		t.Run(fmt.Sprintf("groups=%d", groups), func(t *testing.T) {
+			outputs := MustExecOnceN(backend, func(g *Graph) []*Node {
+				x := Sin(IotaFull(g, shapes.Make(dtypes.Float64, 2, 3, 4, 4)))
+				kernel := Cos(IotaFull(g, shapes.Make(dtypes.Float64, 3, 2, 4/groups, 4)))
+				// The output of ConvolveTranspose is shaped [2, 6, 8, 4] with these parameters.
+				y := Sin(AddScalar(IotaFull(g, shapes.Make(dtypes.Float64, 2, 6, 8, 4)), 0.5))
+				transposed := ConvolveTranspose(x, kernel).
+					StridePerAxis(2, 2).PaddingPerDim([][2]int{{1, 0}, {0, 0}}).ChannelGroupCount(groups).Done()
+				transposed.AssertDims(2, 6, 8, 4)
+				lhs := ReduceAllSum(Mul(transposed, y))
+				convolved := Convolve(y, kernel).
+					StridePerAxis(2, 2).PaddingPerDim([][2]int{{1, 0}, {0, 0}}).ChannelGroupCount(groups).Done()
+				convolved.AssertDims(2, 3, 4, 4)
+				rhs := ReduceAllSum(Mul(convolved, x))
+				gradLhs := Gradient(lhs, x, kernel)
+				gradRhs := Gradient(rhs, x, kernel)
+				return []*Node{lhs, rhs, gradLhs[0], convolved, gradLhs[1], gradRhs[1]}
+			})
+			require.InDelta(t, outputs[0].Value().(float64), outputs[1].Value().(float64), 1e-9)
+			require.True(t, outputs[2].InDelta(outputs[3], 1e-9), "gradient with respect to x")
+			require.True(t, outputs[4].InDelta(outputs[5], 1e-9), "gradient with respect to the kernel")
+			require.False(t, math.IsNaN(outputs[0].Value().(float64)))
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package graph
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+)
+
+// This file contains the "fake quantization" ops, used for quantization-aware training (QAT).
+
+// RoundStraightThrough rounds x to the nearest integer (see Round), but its gradient is the
+// "straight-through estimator" (STE): the rounding is ignored, and the gradient is passed through unchanged,
+// as if it were the identity.
+//
+// It is the basis for quantization-aware training: see FakeQuantize and FakeQuantizeSymmetric.
+func RoundStraightThrough(x *Node) *Node {
+	n := Round(x)
+	n.customVJP = func(node *Node, vjpForOutputs []*Node, _ shapes.Shape) []*Node {
+		return []*Node{vjpForOutputs[0]}
+	}
+	return n
+}
+
+// checkFakeQuantizeRange checks that the range node can be broadcast to x, and returns it broadcast.
+func checkFakeQuantizeRange(x, rangeNode *Node, name string) *Node {
+	if rangeNode.DType() != x.DType() {
+		Panicf("FakeQuantize %s dtype (%s) must match x dtype (%s)", name, rangeNode.DType(), x.DType())
+	}
+	if !rangeNode.Shape().IsScalar() && rangeNode.Rank() != x.Rank() {
+		Panicf("FakeQuantize %s must be a scalar (per-tensor quantization) or have the same rank as x, with dimensions "+
+			"1 on the axes not quantized per channel: got %s for x shaped %s", name, rangeNode.Shape(), x.Shape())
+	}
+	return BroadcastToDims(rangeNode, x.Shape().Dimensions...)
+}
+
+// checkFakeQuantizeBits validates the number of bits.
+func checkFakeQuantizeBits(bits int) {
+	if bits < 2 || bits > 16 {
+		Panicf("FakeQuantize bits must be between 2 and 16, got %d", bits)
+	}
+}
+
+// FakeQuantize simulates asymmetric (affine) quantization of x to 2^bits levels in the range [minValue, maxValue],
+// and returns the dequantized values: x is clipped to the range, and rounded to the nearest of the levels.
+// The range is "nudged" such that 0 is exactly representable.
+//
+// minValue and maxValue can be scalars, for per-tensor quantization, or have the same rank as x, with dimension 1
+// on the axes not quantized independently (per-channel quantization). They must have the same dtype as x.
+//
+// The gradient is the straight-through estimator (see RoundStraightThrough): with respect to x it is the identity
+// inside the range and 0 outside. The ranges get the gradient of the clipped values and of the quantization
+// errors, so they can be learned.
+//
+// It is used for quantization-aware training: see also FakeQuantizeSymmetric.
+func FakeQuantize(x, minValue, maxValue *Node, bits int) *Node {
+	_ = validateBuildingGraphFromInputs(x, minValue, maxValue)
+	checkFakeQuantizeBits(bits)
+	minValue = checkFakeQuantizeRange(x, minValue, "minValue")
+	maxValue = checkFakeQuantizeRange(x, maxValue, "maxValue")
+	numLevels := float64(int(1)<<bits - 1)
+
+	// The range must include 0.
+	minValue = MinScalar(minValue, 0)
+	maxValue = MaxScalar(maxValue, 0)
+	scale := DivScalar(Sub(maxValue, minValue), numLevels)
+	scale = Where(IsZero(scale), OnesLike(scale), scale)
+
+	// Nudge the range such that the zero point is an integer.
+	zeroPoint := ClipScalar(RoundStraightThrough(Neg(Div(minValue, scale))), 0, numLevels)
+	nudgedMin := Neg(Mul(zeroPoint, scale))
+	nudgedMax := Mul(Sub(Scalar(x.Graph(), x.DType(), numLevels), zeroPoint), scale)
+
+	clipped := Min(Max(x, nudgedMin), nudgedMax)
+	quantized := RoundStraightThrough(Div(Sub(clipped, nudgedMin), scale))
+	return Add(Mul(quantized, scale), nudgedMin)
+}
+
+// FakeQuantizeSymmetric simulates symmetric quantization of x to the integer levels from -(2^(bits-1)-1) to
+// 2^(bits-1)-1 (e.g.: -127 to 127 for 8 bits) in the range [-maxAbs, maxAbs], and returns the dequantized values.
+// That is, it returns `Round(Clip(x, -maxAbs, maxAbs) / scale) * scale`, where `scale = maxAbs / (2^(bits-1)-1)`.
+//
+// maxAbs can be a scalar, for per-tensor quantization, or have the same rank as x, with dimension 1
+// on the axes not quantized independently (per-channel quantization). It must have the same dtype as x.
+//
+// The gradient is the straight-through estimator (see RoundStraightThrough): with respect to x it is the identity
+// inside the range and 0 outside. maxAbs gets the gradient of the clipped values and of the quantization
+// errors, so it can be learned.
+//
+// It is used for quantization-aware training: see also FakeQuantize.
+func FakeQuantizeSymmetric(x, maxAbs *Node, bits int) *Node {
+	_ = validateBuildingGraphFromInputs(x, maxAbs)
+	checkFakeQuantizeBits(bits)
+	maxAbs = Abs(checkFakeQuantizeRange(x, maxAbs, "maxAbs"))
+	maxLevel := float64(int(1)<<(bits-1) - 1)
+	scale := DivScalar(maxAbs, maxLevel)
+	scale = Where(IsZero(scale), OnesLike(scale), scale)
+	clipped := Min(Max(x, Neg(maxAbs)), maxAbs)
+	return Mul(RoundStraightThrough(Div(clipped, scale)), scale)
+}
@@ -0,0 +1,80 @@
+package graph_test
+
+import (
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundStraightThrough(t *testing.T) {
+	graphtest.RunTestGraphFn(t, "RoundStraightThrough", func(g *Graph) (inputs, outputs []*Node) {
+		x := Const(g, []float32{-1.7, -0.2, 0.4, 2.6})
+		output := RoundStraightThrough(x)
+		grad := Gradient(ReduceAllSum(MulScalar(output, 3)), x)[0]
+		inputs = []*Node{x}
+		outputs = []*Node{output, grad}
+		return
+	}, []any{
+		[]float32{-2, 0, 0, 3},
+		[]float32{3, 3, 3, 3},
+	}, 1e-6)
+}
+
+func TestFakeQuantize(t *testing.T) {
+	graphtest.RunTestGraphFn(t, "FakeQuantize", func(g *Graph) (inputs, outputs []*Node) {
+		// With 2 bits and the range [-1, 2], scale=1, so the levels are -1, 0, 1, 2.
+		x := Const(g, []float32{-3, -0.6, 0.4, 1.6, 5})
+		minValue, maxValue := Const(g, float32(-1)), Const(g, float32(2))
+		output := FakeQuantize(x, minValue, maxValue, 2)
+		grads := Gradient(ReduceAllSum(output), x, minValue, maxValue)
+		inputs = []*Node{x, minValue, maxValue}
+		outputs = []*Node{output, grads[0], grads[1], grads[2]}
+		return
+	}, []any{
+		[]float32{-1, -1, 0, 2, 2},
+		// Straight-through estimator: identity inside the range, 0 outside.
+		[]float32{0, 1, 1, 1, 0},
+		// The ranges get the gradients of the clipped values, plus quantization errors.
+		float32(1.0 + 1.0/3.0*(-(-1-(-0.6))-(0-0.4)-(2-1.6))),
+		float32(1.0 + 1.0/3.0*((-1-(-0.6))+(0-0.4)+(2-1.6))),
+	}, 1e-5)
+
+	graphtest.RunTestGraphFn(t, "FakeQuantize-Nudged", func(g *Graph) (inputs, outputs []*Node) {
+		// With 8 bits and the range [-0.1, 1.0], 0 must be exactly representable.
+		x := Const(g, []float32{0, -0.05, 0.5})
+		output := FakeQuantize(x, Const(g, float32(-0.1)), Const(g, float32(1.0)), 8)
+		inputs = []*Node{x}
+		outputs = []*Node{output}
+		return
+	}, []any{
+		[]float32{0, -0.051764715, 0.5003922},
+	}, 1e-5)
+}
+
+func TestFakeQuantizeSymmetric(t *testing.T) {
+	graphtest.RunTestGraphFn(t, "FakeQuantizeSymmetric-PerChannel", func(g *Graph) (inputs, outputs []*Node) {
+		// 3 bits: levels from -3 to 3; per-channel (column) maxAbs of 3 and 0.3.
+		x := Const(g, [][]float32{{-4, 0.14}, {1.4, -0.26}, {2.6, 0.5}})
+		maxAbs := Const(g, [][]float32{{3, 0.3}})
+		output := FakeQuantizeSymmetric(x, maxAbs, 3)
+		grads := Gradient(ReduceAllSum(output), x)
+		inputs = []*Node{x, maxAbs}
+		outputs = []*Node{output, grads[0]}
+		return
+	}, []any{
+		[][]float32{{-3, 0.1}, {1, -0.3}, {3, 0.3}},
+		[][]float32{{0, 1}, {1, 1}, {1, 0}},
+	}, 1e-5)
+
+	// Learnable maxAbs: the gradient pushes it to cover the clipped values.
+	backend := graphtest.BuildTestBackend()
+	gradMaxAbs := MustExecOnce(backend, func(g *Graph) *Node {
+		x := Const(g, []float32{-5, 0.5, 5})
+		maxAbs := Const(g, float32(1))
+		loss := ReduceAllSum(Square(Sub(FakeQuantizeSymmetric(x, maxAbs, 8), x)))
+		return Gradient(loss, maxAbs)[0]
+	})
+	require.Less(t, gradMaxAbs.Value().(float32), float32(0))
+}
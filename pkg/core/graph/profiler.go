@@ -0,0 +1,348 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+)
+
+// ProfileEventType is the type of event recorded by a Profiler.
+type ProfileEventType int
+
+const (
+	// ProfileBuild is the building of a computation graph, by calling the graph function.
+	ProfileBuild ProfileEventType = iota
+
+	// ProfileCompile is the compilation of a computation graph by the backend.
+	ProfileCompile
+
+	// ProfileTransfer is the transfer of an input from host to the device.
+	ProfileTransfer
+
+	// ProfileExecute is the execution of a compiled computation graph.
+	ProfileExecute
+
+	// ProfileOp is the execution of one op of the computation graph. It is only recorded for backends that
+	// support it, see backends.ProfilingExecutable.
+	ProfileOp
+)
+
+var profileEventTypeNames = []string{"build", "compile", "transfer", "execute", "op"}
+
+// String implements fmt.Stringer.
+func (t ProfileEventType) String() string {
+	if t < 0 || int(t) >= len(profileEventTypeNames) {
+		return fmt.Sprintf("ProfileEventType(%d)", int(t))
+	}
+	return profileEventTypeNames[t]
+}
+
+// ProfileEvent is one event recorded by a Profiler.
+type ProfileEvent struct {
+	Type ProfileEventType
+
+	// Graph is the name of the graph.
+	Graph string
+
+	// Name of the event: for ProfileOp events it is the node type (without the "NodeType" prefix) or, for ops
+	// created internally by the backend, the backend op type. For the other events it is the event type.
+	Name string
+
+	// NodeType is set for ProfileOp events of ops created by a graph Node, otherwise it is NodeTypeInvalid.
+	NodeType NodeType
+
+	// NodeId of the node that created the op, for ProfileOp events, otherwise it is InvalidNodeId.
+	NodeId NodeId
+
+	// Scope is the scope of the node (see Node.Scope), for ProfileOp events.
+	Scope string
+
+	// InputShapes and OutputShapes of the op, for ProfileOp events. For ProfileTransfer events, OutputShapes
+	// holds the shape of the transferred value.
+	InputShapes, OutputShapes []shapes.Shape
+
+	// Start and Duration (wall time) of the event.
+	Start    time.Time
+	Duration time.Duration
+
+	// Bytes allocated by the op, for ProfileOp events, or transferred, for ProfileTransfer events.
+	Bytes uintptr
+}
+
+// ProfileStats aggregates the profile events with the same key.
+type ProfileStats struct {
+	// Key of the aggregation, e.g.: the node type, or the scope.
+	Key string
+
+	Count    int
+	Duration time.Duration
+	Bytes    uintptr
+}
+
+// profileKey is the key of the aggregation of events kept by the Profiler.
+type profileKey struct {
+	eventType          ProfileEventType
+	graph, scope, name string
+}
+
+// DefaultProfilerMaxEvents is the default maximum number of individual events kept by a Profiler, see
+// Profiler.WithMaxEvents.
+const DefaultProfilerMaxEvents = 100_000
+
+// Profiler records where the time goes during the building, compilation and execution of computation graphs:
+// it is attached to an executor with Exec.SetProfiler (or with the context.ParamProfiler hyperparameter, for
+// context executors), and it can be enabled or disabled at any time.
+//
+// It records:
+//
+//   - Build and compile time of the computation graphs.
+//   - Transfer time of the inputs from host to device (the outputs are transferred lazily, when used).
+//   - Execution time of the computation graphs.
+//   - For backends that support it (see backends.ProfilingExecutable, e.g.: SimpleGo), the wall time, bytes
+//     allocated and shapes of each op executed.
+//
+// The results can be aggregated by node type (ByNodeType) or by the scope of the nodes (ByScope, see
+// Node.Scope and Graph.PushScope), summarized with Report, or exported to Chrome trace-event format (WriteChromeTrace) or
+// pprof format (WritePprof).
+//
+// It is safe for concurrent use.
+type Profiler struct {
+	mu sync.Mutex
+
+	// events kept, up to maxEvents. numDropped counts the events not kept.
+	events     []ProfileEvent
+	maxEvents  int
+	numDropped int
+
+	// stats aggregated for all events, including the dropped ones.
+	stats map[profileKey]*ProfileStats
+
+	// start is the earliest start of the events recorded: the origin of time for the exported traces.
+	start time.Time
+}
+
+// NewProfiler creates a new Profiler. Attach it to an executor with Exec.SetProfiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		maxEvents: DefaultProfilerMaxEvents,
+		stats:     make(map[profileKey]*ProfileStats),
+	}
+}
+
+// WithMaxEvents sets the maximum number of individual events kept, used by WriteChromeTrace. After that, events
+// are only aggregated (see ByNodeType, ByScope and WritePprof).
+// If set to -1, there is no limit. It defaults to DefaultProfilerMaxEvents.
+//
+// It returns itself to allow cascading configuration method calls.
+func (p *Profiler) WithMaxEvents(maxEvents int) *Profiler {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxEvents = maxEvents
+	return p
+}
+
+// String implements fmt.Stringer. See Report for a summary of the profile.
+func (p *Profiler) String() string {
+	if p == nil {
+		return "Profiler(nil)"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("Profiler(%d events, %d dropped)", len(p.events), p.numDropped)
+}
+
+// Reset discards all the events and statistics recorded so far.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = nil
+	p.numDropped = 0
+	p.stats = make(map[profileKey]*ProfileStats)
+	p.start = time.Time{}
+}
+
+// Record adds the events to the profile. It is used by Exec, but it can also be used to record custom events.
+func (p *Profiler) Record(events ...ProfileEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, event := range events {
+		if p.start.IsZero() || event.Start.Before(p.start) {
+			p.start = event.Start
+		}
+		key := profileKey{eventType: event.Type, graph: event.Graph, scope: event.Scope, name: event.Name}
+		stats := p.stats[key]
+		if stats == nil {
+			stats = &ProfileStats{}
+			p.stats[key] = stats
+		}
+		stats.Count++
+		stats.Duration += event.Duration
+		stats.Bytes += event.Bytes
+		if p.maxEvents >= 0 && len(p.events) >= p.maxEvents {
+			p.numDropped++
+			continue
+		}
+		p.events = append(p.events, event)
+	}
+}
+
+// Events returns a copy of the individual events kept. See WithMaxEvents.
+func (p *Profiler) Events() []ProfileEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.events)
+}
+
+// Aggregate the statistics of all events (including those not kept, see WithMaxEvents) with the given keyFn,
+// for the events of the given types (or all, if no type is given).
+// Events for which keyFn returns "" are skipped.
+//
+// The results are sorted by decreasing duration.
+func (p *Profiler) Aggregate(keyFn func(eventType ProfileEventType, graph, scope, name string) string,
+	eventTypes ...ProfileEventType) []ProfileStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	aggregated := make(map[string]*ProfileStats)
+	for key, stats := range p.stats {
+		if len(eventTypes) > 0 && !slices.Contains(eventTypes, key.eventType) {
+			continue
+		}
+		k := keyFn(key.eventType, key.graph, key.scope, key.name)
+		if k == "" {
+			continue
+		}
+		agg := aggregated[k]
+		if agg == nil {
+			agg = &ProfileStats{Key: k}
+			aggregated[k] = agg
+		}
+		agg.Count += stats.Count
+		agg.Duration += stats.Duration
+		agg.Bytes += stats.Bytes
+	}
+	results := make([]ProfileStats, 0, len(aggregated))
+	for _, stats := range aggregated {
+		results = append(results, *stats)
+	}
+	slices.SortFunc(results, func(a, b ProfileStats) int {
+		return cmp.Or(cmp.Compare(b.Duration, a.Duration), cmp.Compare(a.Key, b.Key))
+	})
+	return results
+}
+
+// ByEventType returns the statistics aggregated by event type: build, compile, transfer, execute and op.
+func (p *Profiler) ByEventType() []ProfileStats {
+	return p.Aggregate(func(eventType ProfileEventType, _, _, _ string) string { return eventType.String() })
+}
+
+// ByGraph returns the statistics of the execution of the computation graphs, aggregated by graph name.
+func (p *Profiler) ByGraph() []ProfileStats {
+	return p.Aggregate(func(_ ProfileEventType, graph, _, _ string) string { return graph }, ProfileExecute)
+}
+
+// ByNodeType returns the statistics of the execution of the ops, aggregated by node type.
+func (p *Profiler) ByNodeType() []ProfileStats {
+	return p.Aggregate(func(_ ProfileEventType, _, _, name string) string { return name }, ProfileOp)
+}
+
+// ByScope returns the statistics of the execution of the ops, aggregated by the scope of the nodes
+// (see Node.Scope): for graphs built with a context.Context, the scope of the layer that created them.
+// Ops without a scope are aggregated under the root scope ("/").
+func (p *Profiler) ByScope() []ProfileStats {
+	return p.Aggregate(func(_ ProfileEventType, _, scope, _ string) string {
+		if scope == "" {
+			return AliasScopeSeparator
+		}
+		return scope
+	}, ProfileOp)
+}
+
+// Report returns a human-readable summary of the profile, with up to topN entries per table.
+func (p *Profiler) Report(topN int) string {
+	var sb strings.Builder
+	writeTable := func(title string, stats []ProfileStats) {
+		if len(stats) == 0 {
+			return
+		}
+		var total time.Duration
+		for _, s := range stats {
+			total += s.Duration
+		}
+		keyWidth := len(title)
+		for ii, s := range stats {
+			if ii >= topN {
+				break
+			}
+			keyWidth = max(keyWidth, len(s.Key))
+		}
+		_, _ = fmt.Fprintf(&sb, "%-*s %10s %14s %7s %14s\n", keyWidth, title, "count", "total", "%", "bytes")
+		for ii, s := range stats {
+			if ii >= topN {
+				_, _ = fmt.Fprintf(&sb, "... (%d more)\n", len(stats)-topN)
+				break
+			}
+			var percent float64
+			if total > 0 {
+				percent = 100 * float64(s.Duration) / float64(total)
+			}
+			_, _ = fmt.Fprintf(&sb, "%-*s %10d %14s %6.1f%% %14d\n", keyWidth, s.Key, s.Count,
+				s.Duration.Round(time.Microsecond), percent, s.Bytes)
+		}
+		sb.WriteString("\n")
+	}
+	writeTable("Event", p.ByEventType())
+	writeTable("Graph", p.ByGraph())
+	writeTable("Node Type", p.ByNodeType())
+	writeTable("Scope", p.ByScope())
+	if sb.Len() == 0 {
+		return "(no profile events recorded)\n"
+	}
+	return sb.String()
+}
+
+// nodeForOp returns the node that created the backend op, or nil if the op was not created by a node of
+// the graph (e.g., ops created internally by the backend).
+func (g *Graph) nodeForOp(op backends.Op) *Node {
+	g.opsToNodesOnce.Do(func() {
+		g.opsToNodes = make(map[backends.Op]*Node, len(g.nodes))
+		for _, node := range g.nodes {
+			for _, nodeOp := range node.outputOps {
+				if nodeOp == nil {
+					continue
+				}
+				if _, found := g.opsToNodes[nodeOp]; !found {
+					g.opsToNodes[nodeOp] = node
+				}
+			}
+		}
+	})
+	return g.opsToNodes[op]
+}
+
+// opProfileEvent converts a backend op profile to a ProfileEvent.
+func (g *Graph) opProfileEvent(opProfile backends.OpProfile) ProfileEvent {
+	event := ProfileEvent{
+		Type:         ProfileOp,
+		Graph:        g.name,
+		Name:         strings.TrimPrefix(opProfile.OpType.String(), "OpType"),
+		NodeId:       InvalidNodeId,
+		InputShapes:  opProfile.InputShapes,
+		OutputShapes: opProfile.OutputShapes,
+		Start:        opProfile.Start,
+		Duration:     opProfile.Duration,
+		Bytes:        opProfile.BytesAllocated,
+	}
+	if node := g.nodeForOp(opProfile.Op); node != nil {
+		event.NodeType = node.Type()
+		event.Name = strings.TrimPrefix(node.Type().String(), "NodeType")
+		event.NodeId = node.Id()
+		event.Scope = node.Scope()
+	}
+	return event
+}
@@ -0,0 +1,287 @@
+package graph
+
+import (
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// chromeTraceEvent is one event of the Chrome trace-event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type chromeTraceEvent struct {
+	Name      string         `json:"name"`
+	Category  string         `json:"cat,omitempty"`
+	Phase     string         `json:"ph"`
+	Timestamp float64        `json:"ts"`
+	Duration  float64        `json:"dur,omitempty"`
+	Pid       int            `json:"pid"`
+	Tid       int            `json:"tid"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+// chromeTraceOpsTidOffset is the thread id of the first lane of ops in the exported Chrome trace: the lanes
+// before it are used by the other events (build, compile, transfer and execute).
+const chromeTraceOpsTidOffset = 1000
+
+// WriteChromeTrace writes the individual events kept (see WithMaxEvents) in the Chrome trace-event JSON format,
+// which can be visualized with chrome://tracing or https://ui.perfetto.dev.
+//
+// Events that overlap in time (e.g.: ops executed in parallel) are laid out in separate lanes (threads in
+// the trace), with the ops on lanes separate from the other events.
+func (p *Profiler) WriteChromeTrace(w io.Writer) error {
+	p.mu.Lock()
+	events := slices.Clone(p.events)
+	start := p.start
+	p.mu.Unlock()
+	slices.SortStableFunc(events, func(a, b ProfileEvent) int { return a.Start.Compare(b.Start) })
+
+	// Greedily assign each event to the first lane free at its start.
+	var execLanesEnd, opsLanesEnd []time.Time
+	assignLane := func(lanesEnd *[]time.Time, event *ProfileEvent) int {
+		end := event.Start.Add(event.Duration)
+		for ii, laneEnd := range *lanesEnd {
+			if !laneEnd.After(event.Start) {
+				(*lanesEnd)[ii] = end
+				return ii
+			}
+		}
+		*lanesEnd = append(*lanesEnd, end)
+		return len(*lanesEnd) - 1
+	}
+	toMicroseconds := func(d time.Duration) float64 { return float64(d) / float64(time.Microsecond) }
+	traceEvents := make([]chromeTraceEvent, 0, len(events)+8)
+	for ii := range events {
+		event := &events[ii]
+		traceEvent := chromeTraceEvent{
+			Name:      event.Name,
+			Category:  event.Type.String(),
+			Phase:     "X",
+			Timestamp: toMicroseconds(event.Start.Sub(start)),
+			Duration:  toMicroseconds(event.Duration),
+			Pid:       1,
+			Args:      map[string]any{"graph": event.Graph},
+		}
+		if event.Type == ProfileOp {
+			traceEvent.Tid = chromeTraceOpsTidOffset + assignLane(&opsLanesEnd, event)
+			if event.Scope != "" {
+				traceEvent.Args["scope"] = event.Scope
+			}
+			if event.NodeId != InvalidNodeId {
+				traceEvent.Args["node_id"] = int(event.NodeId)
+			}
+		} else {
+			traceEvent.Tid = assignLane(&execLanesEnd, event)
+		}
+		if len(event.InputShapes) > 0 {
+			traceEvent.Args["inputs"] = shapesToStrings(event.InputShapes)
+		}
+		if len(event.OutputShapes) > 0 {
+			traceEvent.Args["outputs"] = shapesToStrings(event.OutputShapes)
+		}
+		if event.Bytes > 0 {
+			traceEvent.Args["bytes"] = event.Bytes
+		}
+		traceEvents = append(traceEvents, traceEvent)
+	}
+
+	// Metadata: names of the process and lanes.
+	traceEvents = append(traceEvents, chromeTraceEvent{Name: "process_name", Phase: "M", Pid: 1,
+		Args: map[string]any{"name": "GoMLX"}})
+	for ii := range execLanesEnd {
+		traceEvents = append(traceEvents, chromeTraceEvent{Name: "thread_name", Phase: "M", Pid: 1, Tid: ii,
+			Args: map[string]any{"name": fmt.Sprintf("exec #%d", ii)}})
+	}
+	for ii := range opsLanesEnd {
+		traceEvents = append(traceEvents, chromeTraceEvent{Name: "thread_name", Phase: "M", Pid: 1,
+			Tid: chromeTraceOpsTidOffset + ii, Args: map[string]any{"name": fmt.Sprintf("ops #%d", ii)}})
+	}
+
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{traceEvents, "ns"})
+	if err != nil {
+		return errors.Wrap(err, "failed to write Chrome trace")
+	}
+	return nil
+}
+
+func shapesToStrings(values []shapes.Shape) []string {
+	return xslices.Map(values, func(shape shapes.Shape) string { return shape.String() })
+}
+
+// Field numbers of the pprof profile.proto messages used by WritePprof, see
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+const (
+	pprofProfileSampleType        = 1
+	pprofProfileSample            = 2
+	pprofProfileLocation          = 4
+	pprofProfileFunction          = 5
+	pprofProfileStringTable       = 6
+	pprofProfileTimeNanos         = 9
+	pprofProfileDurationNanos     = 10
+	pprofProfileDefaultSampleType = 14
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationId = 1
+	pprofSampleValue      = 2
+
+	pprofLocationId   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionId = 1
+
+	pprofFunctionId         = 1
+	pprofFunctionName       = 2
+	pprofFunctionSystemName = 3
+)
+
+// WritePprof writes the aggregated statistics (including the events not kept, see WithMaxEvents) as a gzipped
+// pprof profile, which can be visualized with `go tool pprof`.
+//
+// The samples have 3 values: the count, the wall time ("wall", the default) and the bytes allocated or transferred
+// ("alloc_space"). The "call stacks" are graph name -> event type -> scopes (for ops) -> op name, so one
+// can navigate the profile by scope, e.g. with the flame graph view.
+// Notice the time of the ops is also accounted in the time of the execution of their graphs.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	keys := make([]profileKey, 0, len(p.stats))
+	for key := range p.stats {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b profileKey) int {
+		return cmp.Or(cmp.Compare(a.graph, b.graph), cmp.Compare(a.eventType, b.eventType),
+			cmp.Compare(a.scope, b.scope), cmp.Compare(a.name, b.name))
+	})
+	stats := make([]ProfileStats, len(keys))
+	for ii, key := range keys {
+		stats[ii] = *p.stats[key]
+	}
+	start := p.start
+	p.mu.Unlock()
+
+	// String table: index 0 must be "".
+	stringsIndices := map[string]int{"": 0}
+	stringTable := []string{""}
+	stringIndex := func(s string) uint64 {
+		idx, found := stringsIndices[s]
+		if !found {
+			idx = len(stringTable)
+			stringsIndices[s] = idx
+			stringTable = append(stringTable, s)
+		}
+		return uint64(idx)
+	}
+
+	// Functions and locations: one per distinct frame name, with the same id.
+	frameIds := make(map[string]uint64)
+	var frames []string
+	frameId := func(name string) uint64 {
+		id, found := frameIds[name]
+		if !found {
+			frames = append(frames, name)
+			id = uint64(len(frames))
+			frameIds[name] = id
+		}
+		return id
+	}
+
+	var profile []byte
+	for _, valueType := range [][2]string{{"count", "count"}, {"wall", "nanoseconds"}, {"alloc_space", "bytes"}} {
+		var msg []byte
+		msg = protowire.AppendTag(msg, pprofValueTypeType, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, stringIndex(valueType[0]))
+		msg = protowire.AppendTag(msg, pprofValueTypeUnit, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, stringIndex(valueType[1]))
+		profile = protowire.AppendTag(profile, pprofProfileSampleType, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, msg)
+	}
+	var total time.Duration
+	for ii, key := range keys {
+		// Stack is leaf first.
+		var locationIds []byte
+		if key.eventType == ProfileOp {
+			locationIds = protowire.AppendVarint(locationIds, frameId(key.name))
+			for scope := key.scope; scope != "" && scope != AliasScopeSeparator; {
+				locationIds = protowire.AppendVarint(locationIds, frameId(scope))
+				scope = scope[:max(strings.LastIndex(scope, AliasScopeSeparator), 0)]
+			}
+		}
+		locationIds = protowire.AppendVarint(locationIds, frameId(key.eventType.String()))
+		locationIds = protowire.AppendVarint(locationIds, frameId(key.graph))
+
+		var values []byte
+		values = protowire.AppendVarint(values, uint64(stats[ii].Count))
+		values = protowire.AppendVarint(values, uint64(stats[ii].Duration.Nanoseconds()))
+		values = protowire.AppendVarint(values, uint64(stats[ii].Bytes))
+
+		var msg []byte
+		msg = protowire.AppendTag(msg, pprofSampleLocationId, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, locationIds)
+		msg = protowire.AppendTag(msg, pprofSampleValue, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, values)
+		profile = protowire.AppendTag(profile, pprofProfileSample, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, msg)
+		if key.eventType != ProfileOp {
+			total += stats[ii].Duration
+		}
+	}
+	for ii, name := range frames {
+		id := uint64(ii + 1)
+		var line []byte
+		line = protowire.AppendTag(line, pprofLineFunctionId, protowire.VarintType)
+		line = protowire.AppendVarint(line, id)
+		var msg []byte
+		msg = protowire.AppendTag(msg, pprofLocationId, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, id)
+		msg = protowire.AppendTag(msg, pprofLocationLine, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, line)
+		profile = protowire.AppendTag(profile, pprofProfileLocation, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, msg)
+
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, pprofFunctionId, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, id)
+		msg = protowire.AppendTag(msg, pprofFunctionName, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, stringIndex(name))
+		msg = protowire.AppendTag(msg, pprofFunctionSystemName, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, stringIndex(name))
+		profile = protowire.AppendTag(profile, pprofProfileFunction, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, msg)
+	}
+	if !start.IsZero() {
+		profile = protowire.AppendTag(profile, pprofProfileTimeNanos, protowire.VarintType)
+		profile = protowire.AppendVarint(profile, uint64(start.UnixNano()))
+	}
+	profile = protowire.AppendTag(profile, pprofProfileDurationNanos, protowire.VarintType)
+	profile = protowire.AppendVarint(profile, uint64(total.Nanoseconds()))
+	profile = protowire.AppendTag(profile, pprofProfileDefaultSampleType, protowire.VarintType)
+	profile = protowire.AppendVarint(profile, stringIndex("wall"))
+	// The string table must be last, since the other fields add strings to it.
+	for _, s := range stringTable {
+		profile = protowire.AppendTag(profile, pprofProfileStringTable, protowire.BytesType)
+		profile = protowire.AppendString(profile, s)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	if _, err := gzipWriter.Write(profile); err != nil {
+		return errors.Wrap(err, "failed to write pprof profile")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return errors.Wrap(err, "failed to write pprof profile")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package graph_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProfiler(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	profiler := NewProfiler()
+	exec := MustNewExec(backend, func(x *Node) *Node {
+		g := x.Graph()
+		g.PushScope("/layer")
+		y := Mul(x, x)
+		g.PopScope()
+		return Neg(y)
+	}).SetName("square").SetProfiler(profiler)
+	require.Equal(t, profiler, exec.Profiler())
+
+	// Two executions: graph is built and compiled only once; the Go value is transferred every time.
+	for range 2 {
+		y := exec.MustExec1([]float32{1, 2, 3})
+		require.Equal(t, []float32{-1, -4, -9}, tensors.CopyFlatData[float32](y))
+	}
+	counts := make(map[string]int)
+	for _, stats := range profiler.ByEventType() {
+		counts[stats.Key] = stats.Count
+	}
+	assert.Equal(t, 1, counts["build"])
+	assert.Equal(t, 1, counts["compile"])
+	assert.Equal(t, 2, counts["transfer"])
+	assert.Equal(t, 2, counts["execute"])
+	graphs := profiler.ByGraph()
+	require.Len(t, graphs, 1)
+	assert.Equal(t, "square#0", graphs[0].Key)
+
+	// Tensors already on device are not transferred.
+	x := tensors.FromValue([]float32{1, 2, 3})
+	x.MaterializeOnDevices(backend, false)
+	_ = exec.MustExec1(x)
+	for _, stats := range profiler.ByEventType() {
+		if stats.Key == "transfer" {
+			assert.Equal(t, 2, stats.Count)
+			assert.Equal(t, uintptr(2*3*4), stats.Bytes)
+		}
+	}
+
+	// Disabled profiler.
+	exec.SetProfiler(nil)
+	_ = exec.MustExec1([]float32{1, 2, 3})
+	var numExecEvents int
+	for _, event := range profiler.Events() {
+		if event.Type != ProfileOp {
+			numExecEvents++
+		}
+	}
+	assert.Equal(t, 1+1+2+3, numExecEvents)
+
+	if backend.String() == "go" {
+		// Per-op profiling by node type and by scope.
+		byNodeType := make(map[string]ProfileStats)
+		for _, stats := range profiler.ByNodeType() {
+			byNodeType[stats.Key] = stats
+		}
+		assert.Equal(t, 3, byNodeType["Mul"].Count)
+		assert.Equal(t, 3, byNodeType["Neg"].Count)
+		byScope := make(map[string]int)
+		for _, stats := range profiler.ByScope() {
+			byScope[stats.Key] = stats.Count
+		}
+		assert.Equal(t, 3, byScope["/layer"])
+		fmt.Println(profiler.Report(10))
+	}
+
+	// Chrome trace.
+	var buf bytes.Buffer
+	require.NoError(t, profiler.WriteChromeTrace(&buf))
+	var trace struct {
+		TraceEvents []struct {
+			Name  string         `json:"name"`
+			Phase string         `json:"ph"`
+			Args  map[string]any `json:"args"`
+		} `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	var numComplete int
+	for _, event := range trace.TraceEvents {
+		if event.Phase == "X" {
+			numComplete++
+			assert.Equal(t, "square#0", event.Args["graph"])
+		}
+	}
+	assert.Equal(t, len(profiler.Events()), numComplete)
+
+	// pprof: check that the gzipped profile is well-formed, and has the expected string table.
+	buf.Reset()
+	require.NoError(t, profiler.WritePprof(&buf))
+	gzipReader, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	profile, err := io.ReadAll(gzipReader)
+	require.NoError(t, err)
+	var stringTable []string
+	var numSamples int
+	for len(profile) > 0 {
+		num, wireType, n := protowire.ConsumeTag(profile)
+		require.GreaterOrEqual(t, n, 0)
+		profile = profile[n:]
+		n = protowire.ConsumeFieldValue(num, wireType, profile)
+		require.GreaterOrEqual(t, n, 0)
+		switch num {
+		case 2:
+			numSamples++
+		case 6:
+			value, _ := protowire.ConsumeString(profile)
+			stringTable = append(stringTable, value)
+		}
+		profile = profile[n:]
+	}
+	require.NotEmpty(t, stringTable)
+	assert.Equal(t, "", stringTable[0])
+	assert.Contains(t, stringTable, "wall")
+	assert.Contains(t, stringTable, "square#0")
+	assert.Equal(t, len(profiler.Aggregate(func(eventType ProfileEventType, graph, scope, name string) string {
+		return eventType.String() + graph + scope + name
+	})), numSamples)
+
+	profiler.Reset()
+	assert.Empty(t, profiler.Events())
+	assert.Empty(t, profiler.ByEventType())
+}
@@ -107,6 +107,7 @@ func Gradient(output *Node, gradientNodes ...*Node) []*Node {
 
 	rg := newReverseGraph(g, output, gradientNodes)
 	rOutput := rg.ReverseNodes[output.Id()]
+	firstGradientNodeId := NodeId(len(g.nodes))
 	// Initialize gradient of the output with respect to itself to 1. When outputShape.Rank() != 0
 	// we will need to find something akin to a matrix identity for possibly higher dimensional tensors.
 	rOutput.AccumulatedVJP = Ones(output.graph, shapes.Make(outputShape.DType))
@@ -200,6 +201,8 @@ func Gradient(output *Node, gradientNodes ...*Node) []*Node {
 		if node.NumOutputs() == 1 {
 			vjpsForOutputs = []*Node{rNode.AccumulatedVJP}
 		}
+		node.onGradientPath = true
+		g.PushScope(node.scope) // The nodes back-propagating the gradient share the scope of the node.
 		inputsVJPs := vjpFn(node, vjpsForOutputs, outputShape)
 		if len(inputsVJPs) != len(node.Inputs()) {
 			Panicf("AccumulatedVJP(%s) returned %d VJPs, but it has %d inputNodes, implementation of auto-differentiation for node failed",
@@ -229,6 +232,7 @@ func Gradient(output *Node, gradientNodes ...*Node) []*Node {
 				rInput.AccumulatedVJP = Add(rInput.AccumulatedVJP, vjp)
 			}
 		}
+		g.PopScope()
 	}
 
 	gradients := make([]*Node, len(gradientNodes))
@@ -242,8 +246,12 @@ func Gradient(output *Node, gradientNodes ...*Node) []*Node {
 
 		} else {
 			gradients[ii] = rNode.AccumulatedVJP
+			node.onGradientPath = true
 		}
 	}
+	for _, node := range g.nodes[firstGradientNodeId:] {
+		node.isGradient = true
+	}
 	return gradients
 }
 
@@ -413,6 +421,7 @@ var VJPRegistration = map[NodeType]VJP{
 	NodeTypeConvGeneral:        vjpForSingleOutput(convGeneralVJP),
 	NodeTypeReduceWindow:       vjpForSingleOutput(reduceWindowVJP),
 	NodeTypeTranspose:          vjpForSingleOutput(transposeVJP),
+	NodeTypeReverse:            vjpForSingleOutput(reverseVJP),
 	NodeTypeBroadcastInDim:     vjpForSingleOutput(broadcastInDimVJP),
 	NodeTypeFFT:                vjpForSingleOutput(fftVJP),
 	NodeTypeDynamicSlice:       vjpForSingleOutput(dynamicSliceVJP),
@@ -948,6 +957,12 @@ func transposeVJP(node, v *Node, _ shapes.Shape) []*Node {
 	return []*Node{vjp}
 }
 
+// reverseVJP generates the "vector dot jacobian" w.r.t. the input of Reverse: it's simply the reverse of v.
+func reverseVJP(node, v *Node, _ shapes.Shape) []*Node {
+	params := node.inputs.(*nodeInputsReverse)
+	return []*Node{Reverse(v, params.axes...)}
+}
+
 // broadcastInDimVJP generates the "vector dot jacobian" w.r.t. the input of BroadcastInDim.
 // One just needs to reduce the broadcast dimensions.
 func broadcastInDimVJP(node, v *Node, _ shapes.Shape) []*Node {
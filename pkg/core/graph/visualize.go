@@ -0,0 +1,423 @@
+package graph
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultVisualizeCollapseThreshold is the default number of nodes above which a scope is collapsed
+// into one node, see Visualizer.WithCollapseThreshold.
+const DefaultVisualizeCollapseThreshold = 50
+
+// Visualizer exports a computation graph for visualization, either as a Graphviz DOT file (WriteDOT) or as
+// a self-contained HTML page with an interactive viewer (WriteHTML).
+//
+// Nodes are grouped by their scope (see Node.Scope and Graph.PushScope), and the edges are
+// labeled with the shapes (and dtypes) of the values flowing through them. Scopes with too many nodes are
+// collapsed into one node, see WithCollapseThreshold -- in the HTML viewer they can be expanded and collapsed
+// interactively. The nodes through which a gradient is back-propagated (see Gradient) and the nodes created to
+// back-propagate it are highlighted.
+//
+// Create it with Graph.Visualize, configure it and then write it. Example:
+//
+//	_, g, err := exec.ExecWithGraph(inputs...)
+//	…
+//	f, err := os.Create("model.html")
+//	…
+//	err = g.Visualize().WithProfiler(profiler).WriteHTML(f)
+type Visualizer struct {
+	g                 *Graph
+	profiler          *Profiler
+	collapseThreshold int
+	expanded          map[string]bool
+}
+
+// Visualize returns a Visualizer to export the graph as a Graphviz DOT file or as an HTML page.
+// See Visualizer for details.
+//
+// The graph must be valid (not finalized), but it doesn't need to be compiled.
+func (g *Graph) Visualize() *Visualizer {
+	g.AssertValid()
+	return &Visualizer{
+		g:                 g,
+		collapseThreshold: DefaultVisualizeCollapseThreshold,
+		expanded:          make(map[string]bool),
+	}
+}
+
+// WithProfiler attaches the profile of the execution of the graph (see Profiler and Exec.SetProfiler) to
+// the nodes: their total execution time, number of executions and bytes allocated.
+// Only the events kept by the Profiler (see Profiler.WithMaxEvents) are used.
+func (v *Visualizer) WithProfiler(profiler *Profiler) *Visualizer {
+	v.profiler = profiler
+	return v
+}
+
+// WithCollapseThreshold sets the number of nodes (including those in sub-scopes) above which a scope
+// is collapsed into one node. If set to 0 or less, scopes are never collapsed.
+// It defaults to DefaultVisualizeCollapseThreshold.
+func (v *Visualizer) WithCollapseThreshold(numNodes int) *Visualizer {
+	v.collapseThreshold = numNodes
+	return v
+}
+
+// Expand the given scopes (and their parent scopes), even if they have more nodes than the collapse threshold.
+// Scopes are given as paths, e.g.: "/model/dense_0".
+func (v *Visualizer) Expand(scopes ...string) *Visualizer {
+	for _, scope := range scopes {
+		for scope = normalizeVisualizeScope(scope); scope != ""; scope = parentVisualizeScope(scope) {
+			v.expanded[scope] = true
+		}
+	}
+	return v
+}
+
+// Values of visualizeNode.Gradient.
+const (
+	visualizeNoGradient = iota
+	visualizeGradientPath
+	visualizeGradientNode
+)
+
+// visualizeNode is a node of the graph as exported for visualization.
+type visualizeNode struct {
+	Id       int    `json:"id"`
+	Label    string `json:"label"`
+	Details  string `json:"details"`
+	Type     string `json:"type"`
+	Scope    string `json:"scope"`
+	Shape    string `json:"shape"`
+	Gradient int    `json:"gradient"`
+
+	Profile *visualizeProfile `json:"profile,omitempty"`
+}
+
+// visualizeProfile is the aggregated profile of a node (or of a collapsed scope).
+type visualizeProfile struct {
+	Count      int     `json:"count"`
+	DurationNs int64   `json:"duration_ns"`
+	Bytes      uint64  `json:"bytes"`
+	Fraction   float64 `json:"fraction"`
+}
+
+// visualizeEdge connects the output of node From to the input of node To.
+type visualizeEdge struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Label string `json:"label"`
+}
+
+// visualizeScope is a scope in the hierarchy of scopes of the graph.
+type visualizeScope struct {
+	Path      string `json:"path"`
+	Parent    string `json:"parent"`
+	Name      string `json:"name"`
+	NumNodes  int    `json:"num_nodes"`
+	Collapsed bool   `json:"collapsed"`
+}
+
+// visualizeGraph is the graph as exported for visualization. It is the data used by the HTML viewer.
+type visualizeGraph struct {
+	Name   string           `json:"name"`
+	Nodes  []visualizeNode  `json:"nodes"`
+	Edges  []visualizeEdge  `json:"edges"`
+	Scopes []visualizeScope `json:"scopes"`
+
+	// scopes indexed by path, and the scopes and nodes in each scope.
+	scopesByPath  map[string]*visualizeScope
+	childScopes   map[string][]string
+	nodesInScopes map[string][]int
+}
+
+// normalizeVisualizeScope returns the scope as a path starting with "/" and without trailing "/",
+// or "" for the root scope.
+func normalizeVisualizeScope(scope string) string {
+	scope = strings.TrimRight(scope, AliasScopeSeparator)
+	if scope != "" && !strings.HasPrefix(scope, AliasScopeSeparator) {
+		scope = AliasScopeSeparator + scope
+	}
+	return scope
+}
+
+// parentVisualizeScope returns the parent of the (normalized) scope.
+func parentVisualizeScope(scope string) string {
+	return scope[:max(strings.LastIndex(scope, AliasScopeSeparator), 0)]
+}
+
+// visualizeShape returns the shapes of the outputs of the node as a string.
+func visualizeShape(node *Node) string {
+	if node.NumOutputs() == 1 {
+		return node.outputShapes[0].String()
+	}
+	return "(" + strings.Join(shapesToStrings(node.outputShapes), ", ") + ")"
+}
+
+// build the graph for visualization.
+func (v *Visualizer) build() *visualizeGraph {
+	g := v.g
+	g.AssertValid()
+	vg := &visualizeGraph{
+		Name:          g.name,
+		Nodes:         make([]visualizeNode, 0, len(g.nodes)),
+		scopesByPath:  make(map[string]*visualizeScope),
+		childScopes:   make(map[string][]string),
+		nodesInScopes: make(map[string][]int),
+	}
+
+	// Nodes and edges.
+	for _, node := range g.nodes {
+		typeName := strings.TrimPrefix(node.Type().String(), "NodeType")
+		label := typeName
+		if node.Type() == NodeTypeParameter {
+			label = fmt.Sprintf("%s %q", typeName, node.GetParameterName())
+		}
+		if node.alias != "" {
+			label += "\n" + node.alias
+		}
+		vNode := visualizeNode{
+			Id:      int(node.id),
+			Label:   label,
+			Details: node.String(),
+			Type:    typeName,
+			Scope:   normalizeVisualizeScope(node.scope),
+			Shape:   visualizeShape(node),
+		}
+		switch {
+		case node.isGradient:
+			vNode.Gradient = visualizeGradientNode
+		case node.onGradientPath:
+			vNode.Gradient = visualizeGradientPath
+		}
+		vg.Nodes = append(vg.Nodes, vNode)
+		vg.nodesInScopes[vNode.Scope] = append(vg.nodesInScopes[vNode.Scope], vNode.Id)
+		for _, input := range node.inputNodes {
+			vg.Edges = append(vg.Edges, visualizeEdge{From: int(input.id), To: vNode.Id, Label: visualizeShape(input)})
+		}
+	}
+
+	// Hierarchy of scopes, with the number of nodes in each, including sub-scopes.
+	for _, vNode := range vg.Nodes {
+		for scope := vNode.Scope; scope != ""; scope = parentVisualizeScope(scope) {
+			vScope := vg.scopesByPath[scope]
+			if vScope == nil {
+				parent := parentVisualizeScope(scope)
+				vScope = &visualizeScope{Path: scope, Parent: parent, Name: scope[len(parent)+1:]}
+				vg.scopesByPath[scope] = vScope
+				vg.childScopes[parent] = append(vg.childScopes[parent], scope)
+			}
+			vScope.NumNodes++
+		}
+	}
+	for _, children := range vg.childScopes {
+		slices.Sort(children)
+	}
+	for _, vScope := range vg.scopesByPath {
+		vScope.Collapsed = v.collapseThreshold > 0 && vScope.NumNodes > v.collapseThreshold && !v.expanded[vScope.Path]
+		vg.Scopes = append(vg.Scopes, *vScope)
+	}
+	slices.SortFunc(vg.Scopes, func(a, b visualizeScope) int { return strings.Compare(a.Path, b.Path) })
+
+	// Profile of the nodes.
+	if v.profiler != nil {
+		var total time.Duration
+		profiles := make(map[NodeId]*visualizeProfile)
+		for _, event := range v.profiler.Events() {
+			if event.Type != ProfileOp || event.Graph != g.name || event.NodeId == InvalidNodeId ||
+				int(event.NodeId) >= len(vg.Nodes) {
+				continue
+			}
+			profile := profiles[event.NodeId]
+			if profile == nil {
+				profile = &visualizeProfile{}
+				profiles[event.NodeId] = profile
+				vg.Nodes[event.NodeId].Profile = profile
+			}
+			profile.Count++
+			profile.DurationNs += event.Duration.Nanoseconds()
+			profile.Bytes += uint64(event.Bytes)
+			total += event.Duration
+		}
+		if total > 0 {
+			for _, profile := range profiles {
+				profile.Fraction = float64(profile.DurationNs) / float64(total.Nanoseconds())
+			}
+		}
+	}
+	return vg
+}
+
+// collapsedAncestor returns the outermost collapsed scope that contains the scope (or is the scope itself),
+// or "" if it is not collapsed.
+func (vg *visualizeGraph) collapsedAncestor(scope string) (collapsed string) {
+	for ; scope != ""; scope = parentVisualizeScope(scope) {
+		if vg.scopesByPath[scope].Collapsed {
+			collapsed = scope
+		}
+	}
+	return
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format, which can be rendered with, e.g.:
+// `dot -Tsvg graph.dot -o graph.svg`.
+//
+// Scopes are rendered as clusters, and collapsed scopes as one "box3d" node.
+func (v *Visualizer) WriteDOT(w io.Writer) error {
+	vg := v.build()
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "digraph %s {\n", strconv.Quote(vg.Name))
+	buf.WriteString("\trankdir=TB;\n")
+	buf.WriteString("\tnode [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\", fontname=\"Helvetica\", fontsize=10];\n")
+	buf.WriteString("\tedge [fontname=\"Helvetica\", fontsize=8, color=\"#6b7280\"];\n")
+
+	// Nodes (and collapsed scopes), by scope.
+	var writeScope func(scope, indent string)
+	writeScope = func(scope, indent string) {
+		for _, child := range vg.childScopes[scope] {
+			vScope := vg.scopesByPath[child]
+			if vScope.Collapsed {
+				writeDOTCollapsedScope(&buf, vg, vScope, indent)
+				continue
+			}
+			_, _ = fmt.Fprintf(&buf, "%ssubgraph %s {\n", indent, strconv.Quote("cluster_"+child))
+			_, _ = fmt.Fprintf(&buf, "%s\tlabel=%s; style=\"rounded,filled\"; fillcolor=\"#f9fafb\"; color=\"#9ca3af\"; fontname=\"Helvetica\"; fontsize=10;\n",
+				indent, strconv.Quote(vScope.Name))
+			writeScope(child, indent+"\t")
+			_, _ = fmt.Fprintf(&buf, "%s}\n", indent)
+		}
+		for _, id := range vg.nodesInScopes[scope] {
+			writeDOTNode(&buf, &vg.Nodes[id], indent)
+		}
+	}
+	writeScope("", "\t")
+
+	// Edges, between the visible nodes: edges to/from collapsed scopes are merged.
+	type edgeKey struct{ from, to string }
+	var edgeKeys []edgeKey
+	edges := make(map[edgeKey][]string)
+	visibleId := func(id int) string {
+		if collapsed := vg.collapsedAncestor(vg.Nodes[id].Scope); collapsed != "" {
+			return "scope:" + collapsed
+		}
+		return "n" + strconv.Itoa(id)
+	}
+	for _, edge := range vg.Edges {
+		key := edgeKey{visibleId(edge.From), visibleId(edge.To)}
+		if key.from == key.to {
+			continue
+		}
+		if _, found := edges[key]; !found {
+			edgeKeys = append(edgeKeys, key)
+		}
+		edges[key] = append(edges[key], edge.Label)
+	}
+	for _, key := range edgeKeys {
+		labels := edges[key]
+		label := labels[0]
+		if len(labels) > 1 {
+			label = fmt.Sprintf("%s (x%d)", label, len(labels))
+		}
+		_, _ = fmt.Fprintf(&buf, "\t%s -> %s [label=%s];\n", strconv.Quote(key.from), strconv.Quote(key.to),
+			strconv.Quote(label))
+	}
+	buf.WriteString("}\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return errors.Wrapf(err, "failed to write DOT for graph %q", vg.Name)
+	}
+	return nil
+}
+
+// DOT returns the graph in the Graphviz DOT format, see WriteDOT.
+func (v *Visualizer) DOT() string {
+	var buf bytes.Buffer
+	_ = v.WriteDOT(&buf) // Writing to a bytes.Buffer doesn't fail.
+	return buf.String()
+}
+
+// formatVisualizeProfile returns a one-line summary of the profile.
+func formatVisualizeProfile(profile *visualizeProfile) string {
+	return fmt.Sprintf("%s, %d runs, %.1f%%", time.Duration(profile.DurationNs).Round(time.Microsecond),
+		profile.Count, 100*profile.Fraction)
+}
+
+// writeDOTNode writes one node in DOT format.
+func writeDOTNode(buf *bytes.Buffer, vNode *visualizeNode, indent string) {
+	label := fmt.Sprintf("%s\n#%d", vNode.Label, vNode.Id)
+	attrs := []string{"tooltip=" + strconv.Quote(vNode.Details)}
+	if vNode.Profile != nil {
+		label += "\n" + formatVisualizeProfile(vNode.Profile)
+	}
+	switch vNode.Type {
+	case "Parameter":
+		attrs = append(attrs, `shape=ellipse`, `fillcolor="#dbeafe"`)
+	case "Constant":
+		attrs = append(attrs, `fillcolor="#f3f4f6"`)
+	}
+	switch vNode.Gradient {
+	case visualizeGradientPath:
+		attrs = append(attrs, `color="#d97706"`, `penwidth=2`)
+	case visualizeGradientNode:
+		attrs = append(attrs, `fillcolor="#fee2e2"`, `color="#dc2626"`)
+	}
+	attrs = append([]string{"label=" + strconv.Quote(label)}, attrs...)
+	_, _ = fmt.Fprintf(buf, "%s\"n%d\" [%s];\n", indent, vNode.Id, strings.Join(attrs, ", "))
+}
+
+// writeDOTCollapsedScope writes a collapsed scope as one node in DOT format.
+func writeDOTCollapsedScope(buf *bytes.Buffer, vg *visualizeGraph, vScope *visualizeScope, indent string) {
+	label := fmt.Sprintf("%s\n(%d nodes)", vScope.Path, vScope.NumNodes)
+	var profile *visualizeProfile
+	var onGradientPath bool
+	for _, vNode := range vg.Nodes {
+		if vNode.Scope != vScope.Path && !strings.HasPrefix(vNode.Scope, vScope.Path+AliasScopeSeparator) {
+			continue
+		}
+		onGradientPath = onGradientPath || vNode.Gradient == visualizeGradientPath
+		if vNode.Profile != nil {
+			if profile == nil {
+				profile = &visualizeProfile{}
+			}
+			profile.Count = max(profile.Count, vNode.Profile.Count)
+			profile.DurationNs += vNode.Profile.DurationNs
+			profile.Bytes += vNode.Profile.Bytes
+			profile.Fraction += vNode.Profile.Fraction
+		}
+	}
+	if profile != nil {
+		label += "\n" + formatVisualizeProfile(profile)
+	}
+	attrs := []string{"label=" + strconv.Quote(label), "shape=box3d", `style=filled`, `fillcolor="#e5e7eb"`}
+	if onGradientPath {
+		attrs = append(attrs, `color="#d97706"`, `penwidth=2`)
+	}
+	_, _ = fmt.Fprintf(buf, "%s%s [%s];\n", indent, strconv.Quote("scope:"+vScope.Path), strings.Join(attrs, ", "))
+}
+
+//go:embed visualize.html
+var visualizeHTML string
+
+// visualizeDataPlaceholder is replaced by the graph data in visualize.html.
+const visualizeDataPlaceholder = "/*GRAPH_DATA*/null"
+
+// WriteHTML writes the graph as a self-contained HTML page (no external resources needed) with an
+// interactive viewer: scopes can be collapsed and expanded, and clicking a node shows its details.
+func (v *Visualizer) WriteHTML(w io.Writer) error {
+	vg := v.build()
+	data, err := json.Marshal(vg) // It escapes "<", ">" and "&", so it is safe to embed in a <script>.
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode graph %q for visualization", vg.Name)
+	}
+	page := strings.Replace(visualizeHTML, visualizeDataPlaceholder, string(data), 1)
+	if _, err = io.WriteString(w, page); err != nil {
+		return errors.Wrapf(err, "failed to write HTML for graph %q", vg.Name)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package graph_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisualize(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	g := NewGraph(backend, "visualize")
+	x := Parameter(g, "x", shapes.Make(dtypes.Float32, 2, 3))
+	g.PushScope("/layer_0")
+	w := Parameter(g, "w", shapes.Make(dtypes.Float32, 2, 3))
+	y := Mul(x, w)
+	g.PushScope("/layer_0/activation")
+	y = Tanh(y)
+	g.PopScope()
+	z := Neg(y)
+	g.PopScope()
+	loss := ReduceAllSum(z)
+	grad := Gradient(loss, w)[0]
+	assert.Equal(t, "/layer_0/activation", y.Scope())
+	assert.Equal(t, "/layer_0", z.Scope())
+	assert.Equal(t, "", loss.Scope())
+	require.Panics(t, func() { g.PopScope() })
+	assert.True(t, grad.Shape().Equal(w.Shape()))
+
+	dot := g.Visualize().DOT()
+	assert.Contains(t, dot, `digraph "visualize" {`)
+	assert.Contains(t, dot, `subgraph "cluster_/layer_0" {`)
+	assert.Contains(t, dot, `subgraph "cluster_/layer_0/activation" {`)
+	assert.Contains(t, dot, `[label="(Float32)[2 3]"]`)
+	assert.Contains(t, dot, `color="#d97706"`, "nodes on the gradient path should be highlighted")
+	assert.Contains(t, dot, `fillcolor="#fee2e2"`, "gradient nodes should be highlighted")
+	assert.Contains(t, dot, `"n1" [label="Parameter \"w\"\n#1"`)
+
+	// Collapsed scopes.
+	dot = g.Visualize().WithCollapseThreshold(2).DOT()
+	assert.NotContains(t, dot, "cluster_/layer_0")
+	assert.Contains(t, dot, `"scope:/layer_0" [label="/layer_0\n(`)
+	assert.Contains(t, dot, `"n0" -> "scope:/layer_0"`)
+	dot = g.Visualize().WithCollapseThreshold(2).Expand("/layer_0/activation").DOT()
+	assert.Contains(t, dot, `subgraph "cluster_/layer_0" {`)
+
+	// HTML viewer embeds the graph.
+	var buf bytes.Buffer
+	require.NoError(t, g.Visualize().WriteHTML(&buf))
+	html := buf.String()
+	assert.Contains(t, html, `"name":"visualize"`)
+	assert.Contains(t, html, `"path":"/layer_0/activation"`)
+	assert.NotContains(t, html, "/*GRAPH_DATA*/")
+}
+
+func TestVisualizeWithProfiler(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	if backend.String() != "go" {
+		t.Skipf("per-op profile not supported by backend %q", backend.String())
+	}
+	profiler := NewProfiler()
+	exec := MustNewExec(backend, func(x *Node) *Node {
+		x.Graph().PushScope("/square")
+		defer x.Graph().PopScope()
+		return Mul(x, x)
+	}).SetProfiler(profiler)
+	_, g, err := exec.ExecWithGraph([]float32{1, 2, 3})
+	require.NoError(t, err)
+	dot := g.Visualize().WithProfiler(profiler).DOT()
+	assert.Contains(t, dot, "1 runs, 100.0%")
+}
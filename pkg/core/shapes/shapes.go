@@ -105,6 +105,26 @@ func Make(dtype dtypes.DType, dimensions ...int) Shape {
 	return s
 }
 
+// DynamicDim is the dimension used for an axis whose size is only known at execution time, a symbolic dimension
+// -- e.g., the batch axis of a model served with requests of different batch sizes.
+//
+// Shapes with dynamic dimensions are created with MakeDynamic, and they are only used to describe a family of
+// concrete shapes (see Shape.Matches): tensors always have concrete (static) shapes.
+const DynamicDim = -1
+
+// MakeDynamic returns a Shape that may have dynamic axes, marked with DynamicDim.
+// Other than that, it is the same as Make.
+func MakeDynamic(dtype dtypes.DType, dimensions ...int) Shape {
+	s := Shape{Dimensions: slices.Clone(dimensions), DType: dtype}
+	for _, dim := range dimensions {
+		if dim < 0 && dim != DynamicDim {
+			panic(errors.Errorf("shapes.MakeDynamic(%s): cannot create a shape with an axis with dimension < 0, "+
+				"except DynamicDim (%d)", s, DynamicDim))
+		}
+	}
+	return s
+}
+
 // Scalar returns a scalar Shape for the given type.
 func Scalar[T dtypes.Number]() Shape {
 	return Shape{DType: dtypes.FromGenericsType[T]()}
@@ -155,20 +175,85 @@ func (s Shape) String() string {
 	if s.Rank() == 0 {
 		return fmt.Sprintf("(%s)", s.DType)
 	}
+	if s.IsDynamic() {
+		parts := make([]string, 0, s.Rank())
+		for _, dim := range s.Dimensions {
+			if dim == DynamicDim {
+				parts = append(parts, "?")
+			} else {
+				parts = append(parts, fmt.Sprintf("%d", dim))
+			}
+		}
+		return fmt.Sprintf("(%s)[%s]", s.DType, strings.Join(parts, " "))
+	}
 	return fmt.Sprintf("(%s)%v", s.DType, s.Dimensions)
 }
 
 // Size returns the number of elements (not bytes) for this shape. It's the product of all dimensions.
 //
+// For a dynamic shape (see IsDynamic) the size is unknown, and it returns DynamicDim.
+//
 // For the number of bytes used to store this shape, see Shape.Memory.
 func (s Shape) Size() (size int) {
 	size = 1
 	for _, d := range s.Dimensions {
+		if d == DynamicDim {
+			return DynamicDim
+		}
 		size *= d
 	}
 	return
 }
 
+// IsDynamic returns whether any of the axes has a dynamic dimension (DynamicDim), see MakeDynamic.
+func (s Shape) IsDynamic() bool {
+	return slices.Contains(s.Dimensions, DynamicDim)
+}
+
+// DynamicAxes returns the list of axes with a dynamic dimension (DynamicDim), or nil if the shape is static.
+func (s Shape) DynamicAxes() (axes []int) {
+	for axis, dim := range s.Dimensions {
+		if dim == DynamicDim {
+			axes = append(axes, axis)
+		}
+	}
+	return
+}
+
+// Matches returns whether the concrete shape is an instance of s: the dtype and rank are the same,
+// and the dimensions are the same, except on the dynamic axes of s, which match any dimension.
+//
+// For static shapes, it is the same as Equal.
+func (s Shape) Matches(concrete Shape) bool {
+	if !s.IsDynamic() {
+		return s.Equal(concrete)
+	}
+	if s.DType != concrete.DType || s.Rank() != concrete.Rank() {
+		return false
+	}
+	for axis, dim := range s.Dimensions {
+		if dim != DynamicDim && dim != concrete.Dimensions[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveDynamic returns a copy of the shape with the dynamic axes (see DynamicDim) set to dim.
+// If the shape is static, it returns the shape itself.
+func (s Shape) ResolveDynamic(dim int) Shape {
+	if !s.IsDynamic() {
+		return s
+	}
+	resolved := s.Clone()
+	for axis, axisDim := range resolved.Dimensions {
+		if axisDim == DynamicDim {
+			resolved.Dimensions[axis] = dim
+		}
+	}
+	return resolved
+}
+
 // IsZeroSize returns whether any of the dimensions is zero, in which case
 // it's an empty shape, with no data attached to it.
 //
@@ -185,8 +270,14 @@ func (s Shape) IsZeroSize() bool {
 
 // Memory returns the memory used to store an array of the given shape, the same as the size in bytes.
 // Careful, so far all types in Go and on device seem to use the same sizes, but future type this is not guaranteed.
+//
+// It returns 0 for dynamic shapes (see IsDynamic), since their size is not known.
 func (s Shape) Memory() uintptr {
-	return s.DType.Memory() * uintptr(s.Size())
+	size := s.Size()
+	if size == DynamicDim {
+		return 0
+	}
+	return s.DType.Memory() * uintptr(size)
 }
 
 // MakeTuple returns a shape representing a tuple of elements with the given shapes.
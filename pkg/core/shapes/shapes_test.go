@@ -72,6 +72,31 @@ func TestDim(t *testing.T) {
 	require.Panics(t, func() { _ = shape.Dim(-4) })
 }
 
+func TestDynamicShape(t *testing.T) {
+	shape := MakeDynamic(dtypes.Float32, DynamicDim, 3)
+	require.True(t, shape.IsDynamic())
+	require.Equal(t, []int{0}, shape.DynamicAxes())
+	require.Equal(t, "(Float32)[? 3]", shape.String())
+	require.Equal(t, DynamicDim, shape.Size())
+	require.Equal(t, 0, int(shape.Memory()))
+	require.True(t, shape.Matches(Make(dtypes.Float32, 7, 3)))
+	require.True(t, shape.Matches(Make(dtypes.Float32, 1, 3)))
+	require.False(t, shape.Matches(Make(dtypes.Float32, 7, 4)))
+	require.False(t, shape.Matches(Make(dtypes.Float64, 7, 3)))
+	require.False(t, shape.Matches(Make(dtypes.Float32, 7)))
+	require.Panics(t, func() { _ = MakeDynamic(dtypes.Float32, -2, 3) })
+	require.Panics(t, func() { _ = Make(dtypes.Float32, DynamicDim, 3) })
+
+	require.Equal(t, "(Float32)[7 3]", shape.ResolveDynamic(7).String())
+	require.True(t, shape.IsDynamic(), "ResolveDynamic must not change the original shape")
+
+	static := MakeDynamic(dtypes.Float32, 2, 3)
+	require.False(t, static.IsDynamic())
+	require.Nil(t, static.DynamicAxes())
+	require.True(t, static.Matches(Make(dtypes.Float32, 2, 3)))
+	require.False(t, static.Matches(Make(dtypes.Float32, 7, 3)))
+}
+
 func TestFromAnyValue(t *testing.T) {
 	shape, err := FromAnyValue([]int32{1, 2, 3})
 	require.NoError(t, err)
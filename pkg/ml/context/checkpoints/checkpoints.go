@@ -48,6 +48,14 @@
 //	}
 //	…
 //
+// Checkpoint files are written atomically (to a temporary file that is renamed once complete), so a crash while
+// saving doesn't corrupt previous checkpoints. To save without blocking the training loop, use Config.Async, and
+// attach Handler.OnEndFn to the loop (with train.Loop.OnEnd) to wait for the last save to be written.
+//
+// By default, a checkpoint is stored as a metadata (JSON) file and one data file with all the variables.
+// For large models, Config.Sharded stores each variable in its own file, written and read concurrently,
+// and variables are only read when used. Checkpoints in either format are loaded transparently.
+//
 // Example 2: To load a checkpoint from an embedded checkpoint, something usually used to distribute a model for
 // inference:
 //
@@ -77,10 +85,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gomlx/gopjrt/dtypes"
@@ -117,6 +128,9 @@ const (
 	BinGZIP BinFormat = iota
 	// BinUncompressed represents the uncompressed binary file format.  This is the format used up until version 0.24.1
 	BinUncompressed
+	// BinSharded represents the sharded format: each variable is stored uncompressed in its own file, under the
+	// directory "<checkpoint>.shards", with a checksum stored in the metadata (JSON) file. See Config.Sharded.
+	BinSharded
 )
 
 // Config for the checkpoints' Handler to be created. This is created with Build() and
@@ -145,6 +159,10 @@ type Config struct {
 	varsToExclude sets.Set[*context.Variable]
 
 	binFormat BinFormat // the compression format
+
+	asyncMaxPending int // if > 0, checkpoints are saved asynchronously.
+
+	parallelism int // number of files read/written concurrently for sharded checkpoints.
 }
 
 // Build a configuration for building a checkpoints.Handler. After configuring the
@@ -170,6 +188,7 @@ func Build(ctx *context.Context) *Config {
 		takeMean:        1,
 		paramsToExclude: sets.Make[string](),
 		varsToExclude:   sets.Make[*context.Variable](),
+		parallelism:     runtime.NumCPU(),
 	}
 	return c
 }
@@ -375,14 +394,56 @@ func (c *Config) TakeMean(n int, backend backends.Backend) *Config {
 }
 
 // WithCompression sets the binary format to the provided value.  The default configuration is BinGZIP.
+// See also Config.Sharded.
 func (c *Config) WithCompression(bf BinFormat) *Config {
 	c.binFormat = bf
-	if bf != BinGZIP && bf != BinUncompressed {
+	if bf != BinGZIP && bf != BinUncompressed && bf != BinSharded {
 		c.binFormat = BinGZIP
 	}
 	return c
 }
 
+// Sharded configures the Handler to save checkpoints in the sharded format (BinSharded): each variable
+// is saved (uncompressed) to its own file, and the metadata (JSON) file works as an index, with the
+// checksum of each file.
+//
+// Files are written and read concurrently (see Config.Parallelism), and when loading a sharded checkpoint,
+// variables are only read when they are used (unless Config.Immediate is set) -- so loading part of a
+// large model only reads the corresponding files.
+//
+// It only affects saving: checkpoints in any format are loaded transparently.
+func (c *Config) Sharded() *Config {
+	c.binFormat = BinSharded
+	return c
+}
+
+// Parallelism sets the maximum number of files read or written concurrently for sharded checkpoints.
+// The default is runtime.NumCPU(). If n <= 0, it is set to 1.
+func (c *Config) Parallelism(n int) *Config {
+	if n <= 0 {
+		n = 1
+	}
+	c.parallelism = n
+	return c
+}
+
+// Async configures the Handler to save checkpoints asynchronously: Handler.Save takes a snapshot of the
+// variables (copying their values to host memory) and Params, and the files are written in a background goroutine.
+//
+// At most maxPending checkpoints are kept in memory waiting to be written: if Handler.Save is called while there
+// are already maxPending saves in progress, it blocks until one is finished. If maxPending <= 0, it is set to 1.
+//
+// Errors of the background saves are returned by the next call to Handler.Save or by Handler.Wait.
+// Call Handler.Wait (or attach Handler.OnEndFn to the train.Loop with train.Loop.OnEnd) before exiting the
+// program, to make sure the last checkpoint is written.
+func (c *Config) Async(maxPending int) *Config {
+	if maxPending <= 0 {
+		maxPending = 1
+	}
+	c.asyncMaxPending = maxPending
+	return c
+}
+
 // Done creates a Handler with the current configuration. It returns an error if
 // the configuration is invalid or if it's missing information.
 func (c *Config) Done() (*Handler, error) {
@@ -399,8 +460,14 @@ func (c *Config) Done() (*Handler, error) {
 		Params:    nil,
 		Variables: nil,
 	}}
+	if c.asyncMaxPending > 0 {
+		handler.asyncSlots = make(chan struct{}, c.asyncMaxPending)
+	}
 
 	if c.dir != "" {
+		// Remove temporary files of checkpoints that were not completely written.
+		removeTempFiles(c.dir)
+
 		// Load (if checkpoints exist) from a directory.
 		checkpoints, err := handler.ListCheckpoints()
 		if err != nil {
@@ -416,8 +483,8 @@ func (c *Config) Done() (*Handler, error) {
 				takeMean = len(checkpoints)
 			}
 			if c.takeMean == 1 {
-				// Just load most recent checkpoint.
-				err = handler.loadCheckpointFromFile(checkpoints[len(checkpoints)-1], false, 0)
+				// Just load most recent checkpoint, falling back to the previous ones if it is corrupted.
+				err = handler.loadLatestCheckpoint(checkpoints)
 			} else {
 				err = handler.takeMean(checkpoints[len(checkpoints)-takeMean:])
 			}
@@ -437,6 +504,9 @@ func (c *Config) Done() (*Handler, error) {
 	}
 
 	if c.immediate {
+		if err := handler.materializeLazyVariables(); err != nil {
+			return nil, err
+		}
 		ctxToSet := c.ctx.Checked(false)
 		for paramName, value := range handler.variableValues {
 			scope, name := context.VariableScopeAndNameFromParameterName(paramName)
@@ -453,12 +523,14 @@ func (c *Config) Done() (*Handler, error) {
 		// Force overwriting variables already present in the context: e.g., global_step.
 		ctxToSet := c.ctx.Checked(false)
 		for v := range ctxToSet.IterVariables() {
-			value, found := handler.LoadedVariables()[v.ParameterName()]
+			value, found, err := handler.takeVariable(v.ParameterName())
+			if err != nil {
+				return nil, err
+			}
 			if !found {
 				continue
 			}
 			v.SetValue(value)
-			delete(handler.variableValues, v.ParameterName())
 		}
 	}
 	handler.attachTo(c.ctx)
@@ -509,7 +581,17 @@ type Handler struct {
 	variableValues map[string]*tensors.Tensor
 	mergeExec      *graph.Exec
 
+	// lazyVariables of a sharded checkpoint, not yet read. See Config.Sharded.
+	lazyVariables map[string]lazyVariable
+
 	checkpointsCount int
+
+	// Asynchronous saving, see Config.Async.
+	asyncSlots   chan struct{}
+	asyncPending sync.WaitGroup
+	muAsyncErr   sync.Mutex
+	asyncErr     error
+	muKeep       sync.Mutex // Serializes the removal of excess checkpoints by concurrent saves.
 }
 
 // serializedData is how the information is read and written from storage.
@@ -518,8 +600,9 @@ type serializedData struct {
 
 	// Variables maps context.Variable.GetParameterName() to its position in storage.
 	Variables []serializedVar
-	// BinFormat describes the format used by the binary file.  It is informative.
-	// The current valid values are "gzip" and "uncompressed"
+	// BinFormat describes the format used by the binary file.
+	// The current valid values are "gzip", "uncompressed" and "sharded" -- only "sharded" changes how the data
+	// is read, the other ones are informative.
 	BinFormat string
 }
 
@@ -536,6 +619,12 @@ type serializedVar struct {
 
 	// Pos, Length in bytes in the file.
 	Pos, Length int
+
+	// File holding the variable data, relative to the shards directory. Only used by the sharded format.
+	File string `json:",omitempty"`
+
+	// Checksum of the variable data, in the form "crc32c:<hex value>". Only used by the sharded format.
+	Checksum string `json:",omitempty"`
 }
 
 // serializedParam represents a serialized context parameter.
@@ -547,6 +636,28 @@ type serializedParam struct {
 	ValueType  string
 }
 
+// isSerializableParam returns whether a param value of the given type can be saved: booleans, strings, numbers,
+// and slices and maps of those. Other values, like structs or pointers (e.g., optimizers.ParamGradientsTracer or
+// optimizers.ParamNanLogger), are only meaningful in the running program and are not saved.
+func isSerializableParam(valueType reflect.Type) bool {
+	if valueType == nil {
+		return false
+	}
+	switch valueType.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array:
+		return isSerializableParam(valueType.Elem())
+	case reflect.Map:
+		return valueType.Key().Kind() == reflect.String && isSerializableParam(valueType.Elem())
+	default:
+		return false
+	}
+}
+
 // jsonDecodedTypeConvert attempts to convert the Value decoded by Json into
 // the original ValueType.
 //
@@ -624,6 +735,13 @@ const (
 	// BinDataSuffix for the data files (holding the tensor values) returned by Handler.ListCheckpoints.
 	BinDataSuffix = ".bin"
 
+	// ShardsDirSuffix for the directories holding the variables files of sharded checkpoints (see Config.Sharded).
+	ShardsDirSuffix = ".shards"
+
+	// TempFileSuffix is appended to the names of the checkpoint files while they are being written.
+	// They are renamed to their final names once completely written.
+	TempFileSuffix = ".tmp"
+
 	// BackupDir is the name of the (sub-)directory under the model checkpoints directory that holds
 	// the backups. See Handler.Backup.
 	BackupDir = "backup"
@@ -682,6 +800,41 @@ func maxCheckPointCountFromCheckpoints(checkpoints []string) int {
 	return maxId
 }
 
+// loadLatestCheckpoint loads the latest checkpoint that can be read: if a checkpoint fails to load (e.g.:
+// it was not completely written), it logs a warning and tries the previous one.
+// If none can be loaded, it returns the error of the latest.
+func (h *Handler) loadLatestCheckpoint(baseNames []string) error {
+	var firstErr error
+	for ii := len(baseNames) - 1; ii >= 0; ii-- {
+		err := h.loadCheckpointFromFile(baseNames[ii], false, 0)
+		if err == nil {
+			return nil
+		}
+		klog.Warningf("Skipping checkpoint %q that failed to load: %v", baseNames[ii], err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// removeTempFiles removes the temporary files (see TempFileSuffix) of checkpoints that were not completely written.
+func removeTempFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasPrefix(fileName, baseNamePrefix) || !strings.HasSuffix(fileName, TempFileSuffix) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, fileName)); err != nil {
+			klog.Warningf("Failed to remove incomplete checkpoint file %q: %v", fileName, err)
+		}
+	}
+}
+
 // loadCheckpointFromFile loads a specific checkpoint file. This needs to happen before attachTo,
 // since otherwise it may not have any effect.
 //
@@ -702,7 +855,27 @@ func (h *Handler) loadCheckpointFromFile(baseName string, merge bool, mergeWeigh
 			h, baseName)
 	}
 
-	// Open files for reading.
+	// Read metadata first: it tells the format of the data.
+	jsonFileName := filepath.Join(h.config.dir, baseName+JsonNameSuffix)
+	jsonFile, err := os.Open(jsonFileName)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to open checkpoint metadata file %s", h, jsonFileName)
+	}
+	serialized, err := h.decodeMetadata(jsonFile)
+	_ = jsonFile.Close()
+	if err != nil {
+		return errors.WithMessagef(err, "failed loading checkpoint metadata from %s%s", baseName, JsonNameSuffix)
+	}
+	if serialized.BinFormat == BinSharded.String() {
+		err = h.loadShardedVariables(baseName, serialized, merge, mergeWeight)
+		if err != nil {
+			err = errors.WithMessagef(err,
+				"failed loading checkpoint from %s{%s,%s}", baseName, JsonNameSuffix, ShardsDirSuffix)
+		}
+		return err
+	}
+
+	// Open data file for reading.
 	binFileName := filepath.Join(h.config.dir, baseName+BinDataSuffix)
 	f, err := os.Open(binFileName)
 	if err != nil {
@@ -713,14 +886,7 @@ func (h *Handler) loadCheckpointFromFile(baseName string, merge bool, mergeWeigh
 	if err != nil {
 		return errors.Wrapf(err, "%s: failed to read checkpoint data file %s", h, binFileName)
 	}
-
-	jsonFileName := filepath.Join(h.config.dir, baseName+JsonNameSuffix)
-	jsonFile, err := os.Open(jsonFileName)
-	if err != nil {
-		return errors.Wrapf(err, "%s: failed to open checkpoint metadata file %s", h, jsonFileName)
-	}
-	defer func() { _ = jsonFile.Close() }()
-	if err = h.loadCheckpoint(jsonFile, binFile, merge, mergeWeight); err != nil {
+	if err = h.loadVariables(serialized, binFile, merge, mergeWeight); err != nil {
 		err = errors.WithMessagef(err,
 			"failed loading checkpoint from %s{%s,%s}", baseName, JsonNameSuffix, BinDataSuffix)
 		return err
@@ -734,11 +900,25 @@ func (h *Handler) loadCheckpointFromFile(baseName string, merge bool, mergeWeigh
 // If `merge` is set to true, only trainable weights are merged into the current values, using
 // `mergeWeight` for the current weight. For merging one must set up `h.mergeExec` as well.
 func (h *Handler) loadCheckpoint(jsonReader, binReader io.Reader, merge bool, mergeWeight float64) error {
-	// Read metadata.
+	serialized, err := h.decodeMetadata(jsonReader)
+	if err != nil {
+		return err
+	}
+	if serialized.BinFormat == BinSharded.String() {
+		return errors.Errorf("%s: checkpoints in the %q format can only be loaded from a directory", h, serialized.BinFormat)
+	}
+	return h.loadVariables(serialized, binReader, merge, mergeWeight)
+}
+
+// decodeMetadata reads the checkpoint metadata (JSON) from jsonReader.
+func (h *Handler) decodeMetadata(jsonReader io.Reader) (*serializedData, error) {
 	dec := json.NewDecoder(jsonReader)
 	var serialized *serializedData
 	if err := dec.Decode(&serialized); err != nil {
-		return errors.Wrapf(err, "%s: failed to decode contents of checkpoint", h)
+		return nil, errors.Wrapf(err, "%s: failed to decode contents of checkpoint", h)
+	}
+	if serialized == nil {
+		return nil, errors.Errorf("%s: empty checkpoint metadata", h)
 	}
 	if h.config.includeParams {
 		for ii := range serialized.Params {
@@ -749,10 +929,18 @@ func (h *Handler) loadCheckpoint(jsonReader, binReader io.Reader, merge bool, me
 		// Discard loaded Params, if they were not included.
 		serialized.Params = nil
 	}
+	return serialized, nil
+}
+
+// loadVariables described by the serialized metadata from binReader, with the data of all variables in sequence.
+//
+// See loadCheckpoint for the meaning of merge and mergeWeight.
+func (h *Handler) loadVariables(serialized *serializedData, binReader io.Reader, merge bool, mergeWeight float64) error {
 	if !merge {
 		// We are loading all the variables, as opposed to merging them.
 		h.serialized = serialized
 		h.variableValues = make(map[string]*tensors.Tensor, len(h.serialized.Variables))
+		h.lazyVariables = nil
 	}
 
 	// Load variable values: we assume they are stored in order.
@@ -783,27 +971,33 @@ func (h *Handler) loadCheckpoint(jsonReader, binReader io.Reader, merge bool, me
 			// Load the value.
 			h.variableValues[varInfo.ParameterName] = tensor
 		} else {
-			// Merge value:
-			current, found := h.variableValues[varInfo.ParameterName]
-			if !found || !varInfo.DType.IsFloat() {
-				// Variable not found in last checkpoint or not merge-able, just ignore it.
-				continue
-			}
-			var results []*tensors.Tensor
-			err := TryCatch[error](func() {
-				results = h.mergeExec.MustExec(current, tensor, shapes.CastAsDType(mergeWeight, varInfo.DType))
-			})
-			if err != nil {
-				panic(errors.WithMessagef(err, "when taking the mean of variable %q", varInfo.ParameterName))
-			}
-			current.FinalizeAll()
-			h.variableValues[varInfo.ParameterName] = results[0]
-			tensor.FinalizeAll()
+			h.mergeVariable(&varInfo, tensor, mergeWeight)
 		}
 	}
 	return nil
 }
 
+// mergeVariable merges the tensor loaded for the variable varInfo into its current value, using `mergeWeight`
+// for the current value. The tensor is freed.
+func (h *Handler) mergeVariable(varInfo *serializedVar, tensor *tensors.Tensor, mergeWeight float64) {
+	current, found := h.variableValues[varInfo.ParameterName]
+	if !found || !varInfo.DType.IsFloat() {
+		// Variable not found in last checkpoint or not merge-able, just ignore it.
+		tensor.FinalizeAll()
+		return
+	}
+	var results []*tensors.Tensor
+	err := TryCatch[error](func() {
+		results = h.mergeExec.MustExec(current, tensor, shapes.CastAsDType(mergeWeight, varInfo.DType))
+	})
+	if err != nil {
+		panic(errors.WithMessagef(err, "when taking the mean of variable %q", varInfo.ParameterName))
+	}
+	current.FinalizeAll()
+	h.variableValues[varInfo.ParameterName] = results[0]
+	tensor.FinalizeAll()
+}
+
 // takeMean will load the checkpoints pointed by baseNames and take the mean of those.
 // It takes the mean only for trainable float variables, everything else it just takes
 // the value from the last checkpoint.
@@ -816,6 +1010,9 @@ func (h *Handler) takeMean(baseNames []string) error {
 	if err != nil {
 		return err
 	}
+	if err = h.materializeLazyVariables(); err != nil {
+		return err
+	}
 
 	// Create merger graph executor.
 	h.mergeExec = graph.MustNewExec(h.config.backend, func(a, b, bWeight *graph.Node) *graph.Node {
@@ -847,6 +1044,8 @@ func (bf BinFormat) String() string {
 		return "gzip"
 	case BinUncompressed:
 		return "uncompressed"
+	case BinSharded:
+		return "sharded"
 	default:
 		return "unknown"
 	}
@@ -857,13 +1056,21 @@ func (bf BinFormat) String() string {
 // All variables in the context are saved, as well as those previously loaded -- this allows one
 // to load the variables only for a part of the model, update that part, and save again with everything.
 //
-// Params is (de-) serialized with package json.
+// Params is (de-) serialized with package json. Params whose values are not serializable (e.g., structs or pointers)
+// are not saved.
 //
 // If the handler is nil, this is a no-op: so it's safe to simply be called, even if the user hasn't configured a
 // checkpoint.
 //
 // By default, the binary file is compressed.  The option WithCompression overrides the default behavior.  This
 // information is reported in the JSON file.
+//
+// The files are first written with a temporary name (see TempFileSuffix), synced to disk and then renamed,
+// so a crash in the middle of a Save doesn't leave a truncated checkpoint behind.
+//
+// If the Handler was configured with Config.Async, it only takes a snapshot of the variables and Params and
+// returns, while the checkpoint is written in the background. In this case, it returns the error of a previous
+// background save, if one failed. See also Handler.Wait.
 func (h *Handler) Save() error {
 	if h == nil {
 		return nil
@@ -871,107 +1078,275 @@ func (h *Handler) Save() error {
 	if h.ctx == nil {
 		return errors.Errorf("%s not attached to a context.Context yet.", h)
 	}
+	if h.config.asyncMaxPending <= 0 {
+		snapshot, err := h.takeSnapshot(false)
+		if err != nil {
+			return err
+		}
+		return h.writeCheckpoint(snapshot)
+	}
+
+	// Asynchronous save.
+	if err := h.takeAsyncError(); err != nil {
+		return err
+	}
+	snapshot, err := h.takeSnapshot(true)
+	if err != nil {
+		return err
+	}
+	h.asyncSlots <- struct{}{} // Blocks if there are already asyncMaxPending saves in progress.
+	h.asyncPending.Add(1)
+	go func() {
+		defer func() {
+			snapshot.finalize()
+			<-h.asyncSlots
+			h.asyncPending.Done()
+		}()
+		if err := h.writeCheckpoint(snapshot); err != nil {
+			klog.Errorf("Asynchronous checkpoint save failed: %+v", err)
+			h.setAsyncError(err)
+		}
+	}()
+	return nil
+}
+
+// Wait for the checkpoints being saved in the background (see Config.Async) to be written, and returns the
+// error of any failed background save.
+//
+// It should be called at the end of the training, see also Handler.OnEndFn.
+// If the Handler is synchronous (the default) or nil, it is a no-op.
+func (h *Handler) Wait() error {
+	if h == nil {
+		return nil
+	}
+	h.asyncPending.Wait()
+	return h.takeAsyncError()
+}
+
+// setAsyncError records the error of a background save, if no other error is pending.
+func (h *Handler) setAsyncError(err error) {
+	h.muAsyncErr.Lock()
+	defer h.muAsyncErr.Unlock()
+	if h.asyncErr == nil {
+		h.asyncErr = err
+	}
+}
+
+// takeAsyncError returns and clears the pending error of background saves.
+func (h *Handler) takeAsyncError() error {
+	h.muAsyncErr.Lock()
+	defer h.muAsyncErr.Unlock()
+	err := h.asyncErr
+	h.asyncErr = nil
+	if err != nil {
+		return errors.WithMessagef(err, "%s: asynchronous save of checkpoint failed", h)
+	}
+	return nil
+}
+
+// checkpointSnapshot holds the contents of one checkpoint to be written.
+type checkpointSnapshot struct {
+	baseName   string
+	serialized *serializedData
+	names      []string
+	values     []*tensors.Tensor
 
+	// owned indicates the values are copies owned by the snapshot, to be freed after written.
+	owned bool
+}
+
+// finalize frees the values, if they are owned by the snapshot.
+func (s *checkpointSnapshot) finalize() {
+	if !s.owned {
+		return
+	}
+	for _, value := range s.values {
+		value.FinalizeAll()
+	}
+	s.values = nil
+}
+
+// takeSnapshot collects the variables (from the Context and previously loaded ones) and Params to be saved, and
+// their metadata.
+//
+// If clone is true, the variables values are copied to host memory, so the snapshot is not affected by
+// later changes of the variables.
+func (h *Handler) takeSnapshot(clone bool) (*checkpointSnapshot, error) {
 	// Read globalStep if one is set.
 	globalStep := optimizers.GetGlobalStep(h.ctx)
+	snapshot := &checkpointSnapshot{
+		baseName: h.newCheckpointBaseName(globalStep),
+		owned:    clone,
+	}
+	h.checkpointsCount += 1 // Bump unique number.
+
 	// Update the binary format in JSON.
-	h.serialized.BinFormat = h.config.binFormat.String()
+	serialized := &serializedData{BinFormat: h.config.binFormat.String()}
+	snapshot.serialized = serialized
+
+	// Previously loaded variables not yet read from a sharded checkpoint must be read now: the checkpoint they
+	// are read from may be removed after this one is saved.
+	if err := h.materializeLazyVariables(); err != nil {
+		return nil, err
+	}
 
 	// Copy over Params.
 	if h.config.includeParams {
-		h.serialized.Params = nil
 		h.ctx.EnumerateParams(func(scope, name string, value any) {
-			h.serialized.Params = append(h.serialized.Params,
+			if !isSerializableParam(reflect.TypeOf(value)) {
+				klog.V(1).Infof("%s: param %q (scope %q) of type %T is not serializable, not saved", h, name, scope, value)
+				return
+			}
+			serialized.Params = append(serialized.Params,
 				serializedParam{
 					Scope: scope, Key: name, Value: value, ValueType: fmt.Sprintf("%T", value)})
 		})
 	}
 
-	// Create files.
-	baseName := h.newCheckpointBaseName(globalStep)
-	h.checkpointsCount += 1 // Bump unique number.
-	varFileName := filepath.Join(h.config.dir, baseName+BinDataSuffix)
-	varFile, err := getSaveVarFiles(varFileName, h.config.binFormat)
-	if err != nil {
-		return errors.Wrapf(err, "%s: failed to create checkpoint data file %s", h, varFileName)
-	}
-	jsonFileName := filepath.Join(h.config.dir, baseName+JsonNameSuffix)
-	var jsonFile *os.File
-	jsonFile, err = os.Create(jsonFileName)
-	if err != nil {
-		return errors.Wrapf(err, "%s: failed to create checkpoint metadata file %s", h, jsonFileName)
-	}
-
-	// Copy over and set variables: both from Context and previously loaded ones, that haven't yet
+	// Copy over variables: both from Context and previously loaded ones, that haven't yet
 	// been loaded into context.
-	h.serialized.Variables = make([]serializedVar, 0, h.ctx.NumVariables()+len(h.variableValues))
+	serialized.Variables = make([]serializedVar, 0, h.ctx.NumVariables()+len(h.variableValues))
 	pos := 0
-	// * Closure to save the contents of a variable.
-	saveVar := func(name string, tensor *tensors.Tensor) error {
-		shape := tensor.Shape()
-		var err error
-		var n, memoryLen int
-		tensor.ConstBytes(func(rawData []byte) {
-			memoryLen = len(rawData)
-			n, err = varFile.Write(rawData)
-		})
-		if err != nil {
-			err = errors.Wrapf(err, "%s: failed to write variable %s", h, name)
-		}
-		if n != memoryLen {
-			return errors.Errorf("%s: failed to write variable %s -- %d bytes requested, %d bytes written", h, name, memoryLen, n)
+	addVar := func(name string, value *tensors.Tensor) {
+		if clone {
+			value = value.LocalClone()
 		}
-		h.serialized.Variables = append(h.serialized.Variables, serializedVar{
+		shape := value.Shape()
+		length := int(shape.Memory())
+		varInfo := serializedVar{
 			ParameterName: name,
 			Dimensions:    shape.Dimensions,
 			DType:         shape.DType,
 			Pos:           pos,
-			Length:        memoryLen,
-		})
-		pos += memoryLen
-		return nil
+			Length:        length,
+		}
+		if h.config.binFormat == BinSharded {
+			// Each variable in its own file.
+			varInfo.Pos = 0
+			varInfo.File = shardFileName(len(serialized.Variables))
+		}
+		serialized.Variables = append(serialized.Variables, varInfo)
+		pos += length
+		snapshot.names = append(snapshot.names, name)
+		snapshot.values = append(snapshot.values, value)
 	}
-
-	// * Loop over variables in context.
 	h.ctx.EnumerateVariables(func(v *context.Variable) {
-		if err != nil {
-			return
-		}
 		if h.config.varsToExclude.Has(v) {
 			return
 		}
-		err = saveVar(v.ParameterName(), v.Value())
+		addVar(v.ParameterName(), v.Value())
+	})
+	for name, value := range h.variableValues {
+		addVar(name, value)
+	}
+	return snapshot, nil
+}
+
+// writeCheckpoint writes the files of the checkpoint snapshot, and then removes the excess checkpoints.
+//
+// The data file (or the shards directory) is written first, and the metadata (JSON) file last: since checkpoints
+// are listed by their metadata files, a checkpoint only becomes visible once it is completely written.
+func (h *Handler) writeCheckpoint(snapshot *checkpointSnapshot) error {
+	var err error
+	if h.config.binFormat == BinSharded {
+		err = h.writeShards(snapshot)
+	} else {
+		err = h.writeBinData(snapshot)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Serialize all the metadata, including Params.
+	var jsonBuf bytes.Buffer
+	enc := json.NewEncoder(&jsonBuf)
+	enc.SetIndent("", "\t")
+	if err = enc.Encode(snapshot.serialized); err != nil {
+		return errors.Wrapf(err, "%s: failed to serialize checkpoint metadata", h)
+	}
+	jsonFileName := filepath.Join(h.config.dir, snapshot.baseName+JsonNameSuffix)
+	err = writeFileAtomically(jsonFileName, func(w io.Writer) error {
+		_, err := w.Write(jsonBuf.Bytes())
+		return err
 	})
+	if err != nil {
+		return errors.WithMessagef(err, "%s: failed to write checkpoint metadata file %s", h, jsonFileName)
+	}
+	syncDir(h.config.dir)
 
-	// * Loop over current loaded variables.
-	for name, tensor := range h.variableValues {
+	// Remove excess checkpoints.
+	h.muKeep.Lock()
+	defer h.muKeep.Unlock()
+	return h.keepNCheckpoints()
+}
+
+// writeBinData writes the values of all variables of the snapshot to one data file, optionally compressed.
+func (h *Handler) writeBinData(snapshot *checkpointSnapshot) error {
+	varFileName := filepath.Join(h.config.dir, snapshot.baseName+BinDataSuffix)
+	err := writeFileAtomically(varFileName, func(w io.Writer) error {
+		varFile, err := newVarWriter(w, h.config.binFormat)
 		if err != nil {
-			break
+			return err
 		}
-		err = saveVar(name, tensor)
+		for ii, value := range snapshot.values {
+			var n, memoryLen int
+			value.ConstBytes(func(rawData []byte) {
+				memoryLen = len(rawData)
+				n, err = varFile.Write(rawData)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to write variable %s", snapshot.names[ii])
+			}
+			if n != memoryLen {
+				return errors.Errorf("failed to write variable %s -- %d bytes requested, %d bytes written",
+					snapshot.names[ii], memoryLen, n)
+			}
+		}
+		if err = varFile.Flush(); err != nil {
+			return errors.Wrap(err, "failed to flush")
+		}
+		return varFile.Close()
+	})
+	if err != nil {
+		return errors.WithMessagef(err, "%s: failed to write checkpoint data file %s", h, varFileName)
 	}
+	return nil
+}
+
+// writeFileAtomically creates a temporary file (filePath + TempFileSuffix), calls writeFn to write its contents,
+// syncs it to disk and renames it to filePath.
+// If anything fails, the temporary file is removed.
+func writeFileAtomically(filePath string, writeFn func(w io.Writer) error) error {
+	tmpPath := filePath + TempFileSuffix
+	f, err := os.Create(tmpPath)
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "failed to create %q", tmpPath)
 	}
-	if err := varFile.Flush(); err != nil {
-		return errors.Wrapf(err, "%s: failed to flush checkpoint data file %s", h, varFileName)
+	err = writeFn(f)
+	if err == nil {
+		err = errors.Wrapf(f.Sync(), "failed to sync %q", tmpPath)
 	}
-	if err := varFile.Close(); err != nil {
-		return errors.Wrapf(err, "%s: failed to close checkpoint data file %s", h, varFileName)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close %q", tmpPath)
+	}
+	if err == nil {
+		err = errors.Wrapf(os.Rename(tmpPath, filePath), "failed to rename %q to %q", tmpPath, filePath)
 	}
-	// Write all the metadata, including Params.
-	enc := json.NewEncoder(jsonFile)
-	enc.SetIndent("", "\t")
-	err = enc.Encode(&h.serialized)
 	if err != nil {
-		return errors.Wrapf(err, "%s: failed to write checkpoint metadata file %s", h, jsonFileName)
+		_ = os.Remove(tmpPath)
 	}
-	err = jsonFile.Close()
+	return err
+}
+
+// syncDir syncs the directory entries to disk, so renamed files are persisted.
+// Errors are ignored, since not all platforms support it.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
 	if err != nil {
-		return errors.Wrapf(err, "%s: failed to close checkpoint metadata file %s", h, jsonFileName)
+		return
 	}
-	// Remove excess checkpoints.
-	return h.keepNCheckpoints()
+	_ = d.Sync()
+	_ = d.Close()
 }
 
 // Backup links (or copies) the latest checkpoint to a separate sub-directory under the model directory called
@@ -998,12 +1373,37 @@ func (h *Handler) Backup() error {
 	if err != nil {
 		return errors.Wrapf(err, "trying to create dir %q", backupDir)
 	}
-	for _, srcFilePath := range []string{varFilePath, jsonFilePath} {
-		newPath := path.Join(backupDir, path.Base(srcFilePath))
-		err := os.Link(srcFilePath, newPath)
+	shardsDir := filepath.Join(h.config.dir, baseName+ShardsDirSuffix)
+	isSharded, err := fsutil.FileExists(shardsDir)
+	if err != nil {
+		return errors.WithMessagef(err, "failed Backup() checking for %q", shardsDir)
+	}
+	if isSharded {
+		// Sharded checkpoint: link each of the variables files.
+		entries, err := os.ReadDir(shardsDir)
 		if err != nil {
-			return errors.Wrapf(err, "failed to link %q to %q", srcFilePath, newPath)
+			return errors.Wrapf(err, "failed to list %q", shardsDir)
 		}
+		newShardsDir := path.Join(backupDir, path.Base(shardsDir))
+		if err = os.MkdirAll(newShardsDir, DirPermMode); err != nil {
+			return errors.Wrapf(err, "trying to create dir %q", newShardsDir)
+		}
+		for _, entry := range entries {
+			srcFilePath := path.Join(shardsDir, entry.Name())
+			newPath := path.Join(newShardsDir, entry.Name())
+			if err = os.Link(srcFilePath, newPath); err != nil {
+				return errors.Wrapf(err, "failed to link %q to %q", srcFilePath, newPath)
+			}
+		}
+	} else {
+		newPath := path.Join(backupDir, path.Base(varFilePath))
+		if err = os.Link(varFilePath, newPath); err != nil {
+			return errors.Wrapf(err, "failed to link %q to %q", varFilePath, newPath)
+		}
+	}
+	newPath := path.Join(backupDir, path.Base(jsonFilePath))
+	if err = os.Link(jsonFilePath, newPath); err != nil {
+		return errors.Wrapf(err, "failed to link %q to %q", jsonFilePath, newPath)
 	}
 	return nil
 }
@@ -1014,6 +1414,12 @@ func (h *Handler) OnStepFn(_ *train.Loop, _ []*tensors.Tensor) error {
 	return h.Save()
 }
 
+// OnEndFn implements `train.OnEndFn`, and make it convenient to attach to a training loop.
+// It waits for the checkpoints being saved in the background (see Config.Async) to be written.
+func (h *Handler) OnEndFn(_ *train.Loop, _ []*tensors.Tensor) error {
+	return h.Wait()
+}
+
 // keepNCheckpoints checks if there are more than the configured number of checkpoints, and remove
 // the excess.
 func (h *Handler) keepNCheckpoints() error {
@@ -1031,11 +1437,13 @@ func (h *Handler) keepNCheckpoints() error {
 	// Remove the excess checkpoints, starting from the earlier ones.
 	list = list[:len(list)-h.config.keep]
 	for _, baseName := range list {
-		varFileName := filepath.Join(h.config.dir, baseName+BinDataSuffix)
+		// Remove the metadata file first, so partially removed checkpoints are not listed.
 		jsonFileName := filepath.Join(h.config.dir, baseName+JsonNameSuffix)
-		for _, fileName := range []string{varFileName, jsonFileName} {
-			err = os.Remove(fileName)
-			if err != nil && !os.IsNotExist(err) {
+		varFileName := filepath.Join(h.config.dir, baseName+BinDataSuffix)
+		shardsDir := filepath.Join(h.config.dir, baseName+ShardsDirSuffix)
+		for _, fileName := range []string{jsonFileName, varFileName, shardsDir} {
+			err = os.RemoveAll(fileName)
+			if err != nil {
 				return errors.Wrapf(err, "%s failed to remove excess checkpoint file %q", h, fileName)
 			}
 		}
@@ -1094,15 +1502,32 @@ func (h *Handler) LoadVariable(ctx *context.Context, scope, name string) (value
 		}
 	}
 
-	// Try to find variable in our currently loaded checkpoint.
+	// Try to find variable in our currently loaded checkpoint, and "consume" it, meaning remove it from Handler.
 	varParamName := context.VariableParameterNameFromScopeAndName(scope, name)
+	value, found, err := h.takeVariable(varParamName)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// takeVariable returns the loaded value of the variable, reading it from its file if it was lazy-loaded
+// from a sharded checkpoint, and removes it from the Handler.
+func (h *Handler) takeVariable(varParamName string) (value *tensors.Tensor, found bool, err error) {
 	value, found = h.variableValues[varParamName]
+	if found {
+		delete(h.variableValues, varParamName)
+		return
+	}
+	lazyVar, found := h.lazyVariables[varParamName]
 	if !found {
 		return
 	}
-
-	// "Consume" value, meaning remove it from Handler.
-	delete(h.variableValues, varParamName)
+	value, err = lazyVar.read()
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "%s: failed to load variable %q", h, varParamName)
+	}
+	delete(h.lazyVariables, varParamName)
 	return
 }
 
@@ -1115,13 +1540,20 @@ func (h *Handler) DeleteVariable(ctx *context.Context, scope, name string) {
 	}
 	varParamName := context.VariableParameterNameFromScopeAndName(scope, name)
 	delete(h.variableValues, varParamName)
+	delete(h.lazyVariables, varParamName)
 }
 
 // LoadedVariables for inspection. These are the values loaded -- but not necessarily immediately available in
 // context, since they are actually used only when a model asks for the variable.
 //
 // The Handler owns the returned map, don't change it -- the behavior is undefined if you do.
+//
+// For sharded checkpoints, variables not yet used are read (concurrently) when this is called.
+// It panics if they fail to be read.
 func (h *Handler) LoadedVariables() map[string]*tensors.Tensor {
+	if err := h.materializeLazyVariables(); err != nil {
+		panic(err)
+	}
 	return h.variableValues
 }
 
@@ -1192,32 +1624,62 @@ type flushWriter interface {
 	Flush() error
 }
 
+// flushNullWriter is used for uncompressed data: Flush and Close are no-ops.
 type flushNullWriter struct {
-	io.WriteCloser
+	io.Writer
 }
 
 func (fw flushNullWriter) Flush() error {
 	return nil
 }
 
-// getSaveVarFiles creates a new file at the specified path, writes a predefined header "gomlx_00", and returns a gzip
-// writer for the file.  It is the responsibility of the caller to call the writer's Flush function before closing.
-// Returns an error if the file creation or header writing process fails.
+func (fw flushNullWriter) Close() error {
+	return nil
+}
+
+// getSaveVarFiles creates a new file at the specified path, and returns a writer for the variables data on it,
+// see newVarWriter. The file is closed when the returned writer is closed.
 func getSaveVarFiles(path string, bf BinFormat) (flushWriter, error) {
 	f, err := os.Create(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "create file")
 	}
+	w, err := newVarWriter(f, bf)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &fileFlushWriter{flushWriter: w, file: f}, nil
+}
+
+// fileFlushWriter closes the underlying file when closed.
+type fileFlushWriter struct {
+	flushWriter
+	file *os.File
+}
+
+func (fw *fileFlushWriter) Close() error {
+	err := fw.flushWriter.Close()
+	if closeErr := fw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// newVarWriter writes the header for the binary format to w and returns a writer for the variables data:
+// for BinGZIP it is a gzip writer. It is the responsibility of the caller to call the writer's Flush and Close
+// functions -- closing it doesn't close w.
+func newVarWriter(w io.Writer, bf BinFormat) (flushWriter, error) {
 	if bf == BinUncompressed {
-		return &flushNullWriter{f}, nil
+		return flushNullWriter{w}, nil
 	}
 	var h []byte
 	h = append(h, []byte(binHeader)...)
 	h = append(h, []byte{byte(lenGzipHeader)}...)
 	h = append(h, []byte(gzipHeader)...)
-	_, err = f.Write(h)
+	_, err := w.Write(h)
 	if err != nil {
 		return nil, errors.Wrap(err, "write header")
 	}
-	return gzip.NewWriter(f), nil
+	return gzip.NewWriter(w), nil
 }
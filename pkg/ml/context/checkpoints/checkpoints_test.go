@@ -21,6 +21,7 @@ package checkpoints
 // * Test what happens with saving/loading of objects in Params: do they need to be filtered?
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -39,6 +40,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/ml/context"
 	"github.com/gomlx/gomlx/pkg/ml/layers/regularizers"
 	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
 )
 
 func TestCheckpoints(t *testing.T) {
@@ -222,6 +224,158 @@ func TestMergedCheckpoints(t *testing.T) {
 	}
 }
 
+func TestAsyncSave(t *testing.T) {
+	var dir string
+	{
+		ctx := context.New().Checked(false)
+		checkpoint := Build(ctx).TempDir("", "test_checkpoints_").Keep(2).Async(2).MustDone()
+		dir = checkpoint.Dir()
+		xV := ctx.VariableWithValue("x", []float64{1.0, 1.0, 1.0})
+		for ii := range 5 {
+			xV.SetValue(tensors.FromValue([]float64{float64(ii), float64(ii), float64(ii)}))
+			require.NoError(t, checkpoint.Save())
+		}
+		// Changing the variable after Save must not affect the checkpoint being written.
+		xV.SetValue(tensors.FromValue([]float64{-1.0, -1.0, -1.0}))
+		require.NoError(t, checkpoint.Wait())
+
+		list, err := checkpoint.ListCheckpoints()
+		require.NoError(t, err)
+		assert.Len(t, list, 2, "Number of remaining checkpoints")
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.NotContains(t, entry.Name(), TempFileSuffix)
+		}
+	}
+	{
+		ctx := context.New().Checked(false)
+		_ = Build(ctx).Dir(dir).MustDone()
+		xV := ctx.VariableWithValue("x", []float64{0.0, 0.0, 0.0})
+		assert.Equal(t, []float64{4.0, 4.0, 4.0}, xV.Value().Value(), "X")
+	}
+
+	if t.Failed() {
+		fmt.Printf("Temporary directory with saved context: %s\n", dir)
+	} else {
+		assert.NoErrorf(t, os.RemoveAll(dir), "Removing directory used for testing %q", dir)
+	}
+}
+
+func TestIncompleteCheckpoints(t *testing.T) {
+	var dir string
+	{
+		ctx := context.New().Checked(false)
+		checkpoint := Build(ctx).TempDir("", "test_checkpoints_").Keep(2).MustDone()
+		dir = checkpoint.Dir()
+		xV := ctx.VariableWithValue("x", []float64{1.0, 1.0, 1.0})
+		require.NoError(t, checkpoint.Save())
+		xV.SetValue(tensors.FromValue([]float64{2.0, 2.0, 2.0}))
+		require.NoError(t, checkpoint.Save())
+
+		// Simulate a crash: truncate the data of the latest checkpoint and leave a temporary file behind.
+		list, err := checkpoint.ListCheckpoints()
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		require.NoError(t, os.Truncate(path.Join(dir, list[1]+BinDataSuffix), 10))
+		tmpFile := path.Join(dir, "checkpoint-n0000002-20240101-000000-step-00000000"+JsonNameSuffix+TempFileSuffix)
+		require.NoError(t, os.WriteFile(tmpFile, []byte("{"), 0o644))
+	}
+	{
+		// The latest checkpoint is skipped, and the previous one is loaded instead.
+		ctx := context.New().Checked(false)
+		_ = Build(ctx).Dir(dir).MustDone()
+		xV := ctx.VariableWithValue("x", []float64{0.0, 0.0, 0.0})
+		assert.Equal(t, []float64{1.0, 1.0, 1.0}, xV.Value().Value(), "X")
+		_, err := os.Stat(path.Join(dir, "checkpoint-n0000002-20240101-000000-step-00000000"+JsonNameSuffix+TempFileSuffix))
+		assert.True(t, os.IsNotExist(err), "temporary file should have been removed")
+	}
+
+	if t.Failed() {
+		fmt.Printf("Temporary directory with saved context: %s\n", dir)
+	} else {
+		assert.NoErrorf(t, os.RemoveAll(dir), "Removing directory used for testing %q", dir)
+	}
+}
+
+func TestShardedCheckpoints(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	var dir string
+	{
+		// Save first a checkpoint in the previous format, and then 2 in the sharded format.
+		ctx := context.New().Checked(false)
+		checkpoint := Build(ctx).TempDir("", "test_checkpoints_").Keep(2).MustDone()
+		dir = checkpoint.Dir()
+		xV := ctx.VariableWithValue("x", []float64{1.0, 1.0, 1.0})
+		yV := ctx.In("layer_1").VariableWithValue("y", [][]float32{{4.0}, {4.0}})
+		require.NoError(t, checkpoint.Save())
+
+		ctx = context.New().Checked(false)
+		checkpoint = Build(ctx).Dir(dir).Keep(2).Sharded().Parallelism(2).MustDone()
+		xV = ctx.VariableWithValue("x", []float64{0.0, 0.0, 0.0})
+		yV = ctx.In("layer_1").VariableWithValue("y", [][]float32{{0.0}, {0.0}})
+		assert.Equal(t, []float64{1.0, 1.0, 1.0}, xV.Value().Value(), "X loaded from the previous format")
+		require.NoError(t, checkpoint.Save())
+		xV.SetValue(tensors.FromValue([]float64{3.0, 3.0, 3.0}))
+		yV.SetValue(tensors.FromValue([][]float32{{6.0}, {6.0}}))
+		require.NoError(t, checkpoint.Save())
+
+		// The checkpoint in the previous format should have been removed, and the sharded ones have no data file.
+		list, err := checkpoint.ListCheckpoints()
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 4, "Expected only the JSON files and shards directories of the 2 checkpoints")
+		for _, baseName := range list {
+			shards, err := os.ReadDir(path.Join(dir, baseName+ShardsDirSuffix))
+			require.NoError(t, err)
+			assert.Len(t, shards, 3, "One file per variable: x, y and global_step")
+		}
+	}
+	{
+		// Lazy loading: only variables used are read.
+		ctx := context.New().Checked(false)
+		checkpoint := Build(ctx).Dir(dir).MustDone()
+		assert.Len(t, checkpoint.lazyVariables, 3)
+		xV := ctx.VariableWithValue("x", []float64{0.0, 0.0, 0.0})
+		assert.Equal(t, []float64{3.0, 3.0, 3.0}, xV.Value().Value(), "X")
+		assert.Len(t, checkpoint.lazyVariables, 2)
+		assert.Len(t, checkpoint.LoadedVariables(), 2)
+		assert.Empty(t, checkpoint.lazyVariables)
+	}
+	{
+		// Mean of sharded checkpoints.
+		ctx := context.New().Checked(false)
+		_ = Build(ctx).Dir(dir).TakeMean(-1, backend).Immediate().MustDone()
+		yV := ctx.In("layer_1").GetVariable("y")
+		require.NotNil(t, yV)
+		assert.Equal(t, [][]float32{{5.0}, {5.0}}, yV.Value().Value(), "Y")
+	}
+	{
+		// Corrupt a variable file of the latest checkpoint: it must fail the checksum.
+		ctx := context.New().Checked(false)
+		checkpoint := Build(ctx).Dir(dir).MustDone()
+		list, err := checkpoint.ListCheckpoints()
+		require.NoError(t, err)
+		shardsDir := path.Join(dir, xslices.Last(list)+ShardsDirSuffix)
+		shardPath := path.Join(shardsDir, checkpoint.lazyVariables[context.VariableParameterNameFromScopeAndName("/", "x")].info.File)
+		data, err := os.ReadFile(shardPath)
+		require.NoError(t, err)
+		data[0] ^= 0xFF
+		require.NoError(t, os.WriteFile(shardPath, data, 0o644))
+		_, err = Build(context.New()).Dir(dir).Immediate().Done()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "checksum mismatch")
+	}
+
+	if t.Failed() {
+		fmt.Printf("Temporary directory with saved context: %s\n", dir)
+	} else {
+		assert.NoErrorf(t, os.RemoveAll(dir), "Removing directory used for testing %q", dir)
+	}
+}
+
 func TestParams(t *testing.T) {
 	var (
 		dir                            string
@@ -240,6 +394,9 @@ func TestParams(t *testing.T) {
 		ctx = ctx.In("foo") // Some different scope.
 		ctx.SetParam("xStr", xStr)
 		ctx.SetParam("xStrs", xStrs)
+		// Values only meaningful in the running program are not saved.
+		ctx.SetParam("tracer", struct{}{})
+		ctx.SetParam("logger", &bytes.Buffer{})
 
 		checkpoint := Build(ctx).TempDir("", "test_checkpoints_").Keep(3).MustDone()
 		dir = checkpoint.Dir()
@@ -276,6 +433,11 @@ func TestParams(t *testing.T) {
 		got, found = ctx.GetParam("xStrs")
 		assert.True(t, found)
 		assert.Equal(t, xStrs, got)
+
+		_, found = ctx.GetParam("tracer")
+		assert.False(t, found)
+		_, found = ctx.GetParam("logger")
+		assert.False(t, found)
 	}
 
 	if t.Failed() {
@@ -0,0 +1,236 @@
+package checkpoints
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+)
+
+// This file implements the sharded checkpoint format (BinSharded), see Config.Sharded.
+//
+// A sharded checkpoint "<baseName>" is stored as:
+//
+//   - "<baseName>.shards/": directory with one file per variable, holding its raw (uncompressed) data.
+//   - "<baseName>.json": the metadata, as in the other formats, where each variable also has the name of its file
+//     (serializedVar.File) and the checksum of its contents (serializedVar.Checksum).
+//     It works as the index of the checkpoint, and it is written last.
+
+// crc32cTable is the CRC-32 Castagnoli table used for the checksums of the sharded format.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// shardFileName returns the name of the file for the idx-th variable of a sharded checkpoint.
+func shardFileName(idx int) string {
+	return fmt.Sprintf("var-%06d%s", idx, BinDataSuffix)
+}
+
+// formatChecksum formats the CRC-32C checksum as stored in serializedVar.Checksum.
+func formatChecksum(crc uint32) string {
+	return fmt.Sprintf("crc32c:%08x", crc)
+}
+
+// parallelFor calls fn(ii) for ii in [0, n), with at most parallelism calls running concurrently.
+// It returns the first error returned by fn, if any.
+func parallelFor(n, parallelism int, fn func(ii int) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, max(parallelism, 1))
+	for ii := range n {
+		slots <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := fn(ii); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// writeShards writes each variable of the snapshot to its own file, concurrently, and sets their checksums in
+// the snapshot metadata.
+//
+// The files are written to a temporary directory that is renamed to "<baseName>.shards" once they are all written.
+func (h *Handler) writeShards(snapshot *checkpointSnapshot) error {
+	shardsDir := filepath.Join(h.config.dir, snapshot.baseName+ShardsDirSuffix)
+	tmpDir := shardsDir + TempFileSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return errors.Wrapf(err, "%s: failed to remove previous temporary directory %q", h, tmpDir)
+	}
+	if err := os.Mkdir(tmpDir, DirPermMode); err != nil {
+		return errors.Wrapf(err, "%s: failed to create temporary directory %q", h, tmpDir)
+	}
+	variables := snapshot.serialized.Variables
+	err := parallelFor(len(snapshot.values), h.config.parallelism, func(ii int) error {
+		varInfo := &variables[ii]
+		crc, err := writeShard(filepath.Join(tmpDir, varInfo.File), snapshot.values[ii])
+		if err != nil {
+			return errors.WithMessagef(err, "failed to write variable %s", varInfo.ParameterName)
+		}
+		varInfo.Checksum = formatChecksum(crc)
+		return nil
+	})
+	if err == nil {
+		syncDir(tmpDir)
+		err = errors.Wrapf(os.Rename(tmpDir, shardsDir), "failed to rename %q to %q", tmpDir, shardsDir)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return errors.WithMessagef(err, "%s: failed to write checkpoint shards to %s", h, shardsDir)
+	}
+	return nil
+}
+
+// writeShard writes the raw data of value to filePath, syncing it to disk, and returns its CRC-32C checksum.
+func writeShard(filePath string, value *tensors.Tensor) (crc uint32, err error) {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to create %q", filePath)
+	}
+	value.ConstBytes(func(rawData []byte) {
+		crc = crc32.Checksum(rawData, crc32cTable)
+		_, err = f.Write(rawData)
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to write to %q", filePath)
+	} else {
+		err = errors.Wrapf(f.Sync(), "failed to sync %q", filePath)
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close %q", filePath)
+	}
+	return crc, err
+}
+
+// lazyVariable is a variable of a sharded checkpoint, read from its file only when used.
+type lazyVariable struct {
+	filePath string
+	info     serializedVar
+}
+
+// read the variable value from its file, and verify its checksum.
+func (lv lazyVariable) read() (*tensors.Tensor, error) {
+	f, err := os.Open(lv.filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open checkpoint shard file %q", lv.filePath)
+	}
+	defer func() { _ = f.Close() }()
+	tensor := tensors.FromShape(shapes.Make(lv.info.DType, lv.info.Dimensions...))
+	var crc uint32
+	tensor.MutableBytes(func(data []byte) {
+		if len(data) != lv.info.Length {
+			err = errors.Errorf("variable has %d bytes, but %d bytes were saved", len(data), lv.info.Length)
+			return
+		}
+		_, err = io.ReadFull(f, data)
+		crc = crc32.Checksum(data, crc32cTable)
+	})
+	if err == nil && lv.info.Checksum != "" && lv.info.Checksum != formatChecksum(crc) {
+		err = errors.Errorf("checksum mismatch: got %s, wanted %s", formatChecksum(crc), lv.info.Checksum)
+	}
+	if err != nil {
+		tensor.FinalizeAll()
+		return nil, errors.Wrapf(err, "failed to read variable %q from checkpoint shard file %q",
+			lv.info.ParameterName, lv.filePath)
+	}
+	return tensor, nil
+}
+
+// loadShardedVariables loads the variables of a sharded checkpoint.
+//
+// If merge is false, the variables are only read when used (see Handler.takeVariable), but the files are checked
+// to be complete. If merge is true, the variables are read and merged one at a time: see loadCheckpoint for details.
+func (h *Handler) loadShardedVariables(baseName string, serialized *serializedData, merge bool, mergeWeight float64) error {
+	shardsDir := filepath.Join(h.config.dir, baseName+ShardsDirSuffix)
+	lazyVars := make(map[string]lazyVariable, len(serialized.Variables))
+	for _, varInfo := range serialized.Variables {
+		if varInfo.File == "" || filepath.Base(varInfo.File) != varInfo.File {
+			return errors.Errorf("%s: invalid file name %q for variable %q", h, varInfo.File, varInfo.ParameterName)
+		}
+		lazyVar := lazyVariable{filePath: filepath.Join(shardsDir, varInfo.File), info: varInfo}
+		fileInfo, err := os.Stat(lazyVar.filePath)
+		if err != nil {
+			return errors.Wrapf(err, "%s: missing checkpoint shard file for variable %q", h, varInfo.ParameterName)
+		}
+		if fileInfo.Size() != int64(varInfo.Length) {
+			return errors.Errorf("%s: checkpoint shard file %q for variable %q has %d bytes, wanted %d bytes",
+				h, lazyVar.filePath, varInfo.ParameterName, fileInfo.Size(), varInfo.Length)
+		}
+		lazyVars[varInfo.ParameterName] = lazyVar
+	}
+
+	if !merge {
+		h.serialized = serialized
+		h.variableValues = make(map[string]*tensors.Tensor, len(serialized.Variables))
+		h.lazyVariables = lazyVars
+		return nil
+	}
+	for _, varInfo := range serialized.Variables {
+		if _, found := h.variableValues[varInfo.ParameterName]; !found || !varInfo.DType.IsFloat() {
+			// Not merge-able, no need to read it.
+			continue
+		}
+		tensor, err := lazyVars[varInfo.ParameterName].read()
+		if err != nil {
+			return err
+		}
+		h.mergeVariable(&varInfo, tensor, mergeWeight)
+	}
+	return nil
+}
+
+// materializeLazyVariables reads, concurrently, all the variables of a sharded checkpoint not yet read.
+func (h *Handler) materializeLazyVariables() error {
+	if len(h.lazyVariables) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(h.lazyVariables))
+	for name := range h.lazyVariables {
+		names = append(names, name)
+	}
+	values := make([]*tensors.Tensor, len(names))
+	err := parallelFor(len(names), h.config.parallelism, func(ii int) error {
+		var err error
+		values[ii], err = h.lazyVariables[names[ii]].read()
+		return err
+	})
+	if err != nil {
+		for _, value := range values {
+			if value != nil {
+				value.FinalizeAll()
+			}
+		}
+		return errors.WithMessagef(err, "%s: failed to load variables", h)
+	}
+	for ii, name := range names {
+		h.variableValues[name] = values[ii]
+	}
+	h.lazyVariables = nil
+	return nil
+}
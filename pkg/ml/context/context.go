@@ -30,6 +30,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/core/graph"
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/support/xsync"
 	"github.com/pkg/errors"
 	"golang.org/x/exp/slices"
 )
@@ -129,6 +130,11 @@ type contextData struct {
 	//   BatchNorm, etc.).
 	graphParams map[graph.GraphId]*scopedParams
 
+	// variablesAsConstants holds the graphs where variables are converted to constants with their current values,
+	// instead of parameters. See Exec.ExportStableHLO.
+	// It is a SyncMap because graphs of the same context may be built concurrently.
+	variablesAsConstants xsync.SyncMap[graph.GraphId, bool]
+
 	// variablesMap for this context organized per scope.
 	variablesMap map[string]scopedVariableMap
 
@@ -21,10 +21,12 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gomlx/gomlx/backends"
 	. "github.com/gomlx/gomlx/internal/exceptions"
 	"github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gomlx/pkg/core/tensors"
 	"github.com/pkg/errors"
 )
@@ -181,8 +183,27 @@ type Exec struct {
 	// Initializing variables within the cxtGraphFn would lead to an infinite recursion.
 	// This checks for that.
 	isInitializeVariablesExec bool
+
+	// profiler set with SetProfiler, used if ParamProfiler is not set.
+	profiler atomic.Pointer[graph.Profiler]
 }
 
+// ParamProfiler is the context hyperparameter with a *graph.Profiler to be used by all the context executors
+// (Exec) using the context, to profile the graphs build, compilation and execution. See graph.Profiler.
+//
+// It is read at every execution, so profiling can be enabled or disabled at any time.
+// It takes precedence over the profiler set with Exec.SetProfiler.
+// This value is not meant to be saved in a checkpoint.
+//
+// Typical use:
+//
+//	profiler := graph.NewProfiler()
+//	ctx.SetParam(context.ParamProfiler, profiler)
+//	… // Train or execute the model.
+//	ctx.SetParam(context.ParamProfiler, nil)  // Disable profiling.
+//	fmt.Println(profiler.Report(10))
+const ParamProfiler = "profiler"
+
 // NewExecAny constructs an Exec object for the given context and symbolic computation function ctxGraphFn.
 //
 // The ctxGraphFn is called to build the computation graphs with a Context.
@@ -263,6 +284,7 @@ func NewExecAny(backend backends.Backend, ctx *Context, ctxGraphFn any) (*Exec,
 	funcName := runtime.FuncForPC(reflect.ValueOf(ctxGraphFn).Pointer()).Name()
 	e.exec.SetName(fmt.Sprintf("Context.Exec:%s", funcName))
 	e.exec.SetSideParamsHook(e.setSideParams)
+	e.exec.SetDynamicOutputsOffsetHook(e.numChangedVars)
 	return e, nil
 }
 
@@ -308,9 +330,6 @@ func (e *Exec) buildGraphFn() {
 		argsWithContext[0] = reflect.ValueOf(e.context)
 		copy(argsWithContext[1:], args)
 
-		// Call ctxGraphFn, the results will be a slice of *Node.
-		ctxGraphFnResults := reflect.ValueOf(e.ctxGraphFn).Call(argsWithContext)
-
 		// Find the graph.
 		var g *Graph
 		if e.inputIsGraph {
@@ -324,6 +343,19 @@ func (e *Exec) buildGraphFn() {
 		}
 		graphId := g.GraphId()
 
+		// Mark context for reuse after the first time it is used -- also if building the graph fails, since the
+		// variables may have been created already, and it may be built again (e.g., with padding, see SetDynamicAxis).
+		defer func() {
+			if !e.context.reuse {
+				e.context = e.context.Reuse()
+			}
+		}()
+
+		// Call ctxGraphFn, the results will be a slice of *Node.
+		g.PushScope(e.context.Scope())
+		ctxGraphFnResults := reflect.ValueOf(e.ctxGraphFn).Call(argsWithContext)
+		g.PopScope()
+
 		// Find variables that were changed and their updated graph values (*Node).
 		var changedVars []*Variable
 		var allValues []*Node
@@ -352,11 +384,6 @@ func (e *Exec) buildGraphFn() {
 
 		// the results will be a []*Node, which will hold all the values.
 		results = []reflect.Value{reflect.ValueOf(allValues)}
-
-		// Mark context for reuse after the first time it is used.
-		if !e.context.reuse {
-			e.context = e.context.Reuse()
-		}
 		return
 	}).Interface()
 }
@@ -386,6 +413,12 @@ func (e *Exec) setSideParams(g *Graph, inputBuffers []backends.Buffer, donate []
 		ctx.InitializeVariables(e.backend)
 	}
 
+	// Padding the dynamic axis would affect the updated values: reject it before the buffers are donated.
+	if numChanged := e.numChangedVars(g); numChanged > 0 && e.exec.DynamicAxis() >= 0 && !hasDynamicParameters(g) {
+		Panicf("%q updates %d variables, which is not supported when padding the dynamic axis, "+
+			"see SetDynamicAxis", e.Name(), numChanged)
+	}
+
 	graphId := g.GraphId()
 	ctx.EnumerateVariables(func(v *Variable) {
 		nodes, found := v.graphToNodes.Load(graphId)
@@ -418,6 +451,23 @@ func (e *Exec) setSideParams(g *Graph, inputBuffers []backends.Buffer, donate []
 	})
 }
 
+// numChangedVars returns the number of variables updated by the graph, whose values are prepended to the outputs.
+func (e *Exec) numChangedVars(g *Graph) int {
+	e.muChangedVars.Lock()
+	defer e.muChangedVars.Unlock()
+	return len(e.changedVars[g.GraphId()])
+}
+
+// hasDynamicParameters returns whether any of the parameters of g has a dynamic shape (see shapes.DynamicDim).
+func hasDynamicParameters(g *Graph) bool {
+	for handle := range g.NumParameters() {
+		if g.GetParameterByHandle(graph.ParameterHandle(handle)).Shape().IsDynamic() {
+			return true
+		}
+	}
+	return false
+}
+
 // SetNodeLogger with the function to be called for the nodes
 // marked for logging during execution. If set to nil,
 // nothing will be logged.
@@ -460,6 +510,63 @@ func (e *Exec) SetMaxCache(maxCacheSize int) *Exec {
 	return e
 }
 
+// SetDynamicAxis marks the given axis (e.g., 0 for the batch axis) of the arguments as dynamic, so that arguments
+// with different dimensions on that axis don't trigger the compilation of a new graph for each dimension.
+// If the backend supports dynamic shapes, the graph is compiled once for any dimension. Otherwise, the arguments
+// are padded to a bucket size (see SetDynamicBuckets), and the outputs are trimmed back.
+//
+// See details and limitations in graph.Exec.SetDynamicAxis. When padding, graphs that update variables are not
+// supported, since the padded values would affect the updates: Exec returns an error, and the variables are
+// left untouched.
+//
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicAxis(axis int, argIndices ...int) *Exec {
+	e.exec.SetDynamicAxis(axis, argIndices...)
+	return e
+}
+
+// SetDynamicOutputs selects which outputs have the dynamic axis and are trimmed back, by default all of them.
+// The indices refer to the outputs of ctxGraphFn, the updated variables are not counted.
+// See SetDynamicAxis and graph.Exec.SetDynamicOutputs.
+//
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicOutputs(outputIndices ...int) *Exec {
+	e.exec.SetDynamicOutputs(outputIndices...)
+	return e
+}
+
+// SetDynamicBuckets sets the function that defines the padded dimension (bucket size) used for the dynamic axis,
+// see SetDynamicAxis and graph.Exec.SetDynamicBuckets.
+//
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetDynamicBuckets(bucketFn graph.DynamicBucketFn) *Exec {
+	e.exec.SetDynamicBuckets(bucketFn)
+	return e
+}
+
+// SetProfiler sets a Profiler to record the building, compilation and execution of the graphs, see
+// graph.Profiler. Set it to nil to disable profiling (the default).
+//
+// If the ParamProfiler hyperparameter is set in the context, it takes precedence.
+// It returns a reference to itself so calls can be cascaded.
+func (e *Exec) SetProfiler(profiler *graph.Profiler) *Exec {
+	e.profiler.Store(profiler)
+	return e
+}
+
+// Profiler returns the Profiler currently used: the one set with the ParamProfiler hyperparameter, if set,
+// or otherwise the one set with SetProfiler. It returns nil if profiling is disabled.
+func (e *Exec) Profiler() *graph.Profiler {
+	if e.context != nil {
+		if profilerAny, found := e.context.GetParam(ParamProfiler); found {
+			if profiler, ok := profilerAny.(*graph.Profiler); ok && profiler != nil {
+				return profiler
+			}
+		}
+	}
+	return e.profiler.Load()
+}
+
 // Context returns the associated Context object, usually created
 // during the creation of the Exec object. It can be set to something
 // different with SetContext().
@@ -500,6 +607,7 @@ func (e *Exec) Exec(args ...any) ([]*tensors.Tensor, error) {
 //
 // It returns an error if something goes wrong.
 func (e *Exec) ExecWithGraph(args ...any) (outputs []*tensors.Tensor, g *Graph, err error) {
+	e.exec.SetProfiler(e.Profiler())
 	outputs, g, err = e.exec.ExecWithGraph(args...)
 	if err != nil {
 		return nil, nil, err
@@ -531,5 +639,75 @@ func (e *Exec) ExecWithGraph(args ...any) (outputs []*tensors.Tensor, g *Graph,
 //
 // Useful when one wants to measure the time separately, from graph compilation and its execution.
 func (e *Exec) PreCompile(args ...any) {
+	e.exec.SetProfiler(e.Profiler())
 	e.exec.PreCompile(args...)
 }
+
+// ExportStableHLO builds the computation graph for the given input shapes and exports it as a StableHLO program,
+// instead of compiling it. Only the outputs of ctxGraphFn are exported: variable updates are not included.
+// The graph is not cached.
+//
+// The backend used to create Exec must support it (see graph.Graph.ExportStableHLO for details).
+//
+// If variablesAsConstants is true, the variables used are baked into the program as constants with their current
+// values -- they must be initialized or loaded from a checkpoint before.
+// Otherwise, they become extra inputs of the program, after the regular inputs, named with
+// Variable.ParameterName (see VariableScopeAndNameFromParameterName).
+func (e *Exec) ExportStableHLO(variablesAsConstants bool, inputShapes ...shapes.Shape) (*graph.StableHLOProgram, error) {
+	g := graph.NewGraph(e.backend, e.Name()+"#StableHLO")
+	defer g.Finalize()
+	var outputs []*Node
+	err := TryCatch[error](func() {
+		if variablesAsConstants {
+			e.context.data.variablesAsConstants.Store(g.GraphId(), true)
+			defer e.context.data.variablesAsConstants.Delete(g.GraphId())
+		}
+		outputs = e.callCtxGraphFn(g, inputShapes)
+	})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to build graph for %q", e.Name())
+	}
+	return g.ExportStableHLO(outputs...)
+}
+
+// callCtxGraphFn creates the parameters for the given shapes in g, and calls ctxGraphFn with them.
+// It returns the outputs of ctxGraphFn.
+func (e *Exec) callCtxGraphFn(g *Graph, inputShapes []shapes.Shape) []*Node {
+	g.PushScope(e.context.Scope())
+	defer g.PopScope()
+	numInputs := reflect.TypeOf(e.ctxGraphFn).NumIn() - 1
+	args := []reflect.Value{reflect.ValueOf(e.context)}
+	switch {
+	case e.inputIsGraph:
+		if len(inputShapes) != 0 {
+			Panicf("ctxGraphFn for %q takes no inputs, but %d input shapes were given", e.Name(), len(inputShapes))
+		}
+		args = append(args, reflect.ValueOf(g))
+	case e.inputAsSlice:
+		inputs := make([]*Node, len(inputShapes))
+		for ii, shape := range inputShapes {
+			inputs[ii] = graph.Parameter(g, fmt.Sprintf("arg%d", ii), shape)
+		}
+		args = append(args, reflect.ValueOf(inputs))
+	default:
+		if len(inputShapes) != numInputs {
+			Panicf("ctxGraphFn for %q takes %d inputs, but %d input shapes were given",
+				e.Name(), numInputs, len(inputShapes))
+		}
+		for ii, shape := range inputShapes {
+			args = append(args, reflect.ValueOf(graph.Parameter(g, fmt.Sprintf("arg%d", ii), shape)))
+		}
+	}
+	results := reflect.ValueOf(e.ctxGraphFn).Call(args)
+	if !e.context.reuse {
+		e.context = e.context.Reuse()
+	}
+	if e.outputAsSlice {
+		return results[0].Interface().([]*Node)
+	}
+	outputs := make([]*Node, len(results))
+	for ii, result := range results {
+		outputs[ii] = result.Interface().(*Node)
+	}
+	return outputs
+}
@@ -21,6 +21,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/gomlx/gomlx/backends"
 	. "github.com/gomlx/gomlx/pkg/core/graph"
 	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
 	"github.com/gomlx/gomlx/pkg/core/shapes"
@@ -28,6 +29,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/ml/context"
 	"github.com/gomlx/gomlx/pkg/ml/context/initializers"
 	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
 	"github.com/gomlx/gopjrt/dtypes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -123,3 +125,145 @@ func TestExec(t *testing.T) {
 		require.Equal(t, int64(2), tensors.ToScalar[int64](counterVar.Value()))
 	})
 }
+
+func TestExecProfiler(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	counterExec := context.MustNewExec(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		counterVar := ctx.VariableWithValue("count", int32(0))
+		count := AddScalar(counterVar.ValueGraph(g), 1)
+		counterVar.SetValueGraph(count)
+		return count
+	})
+	numExecutions := func(profiler *Profiler) int {
+		for _, stats := range profiler.ByEventType() {
+			if stats.Key == "execute" {
+				return stats.Count
+			}
+		}
+		return 0
+	}
+
+	// Profiler set in the executor.
+	execProfiler := NewProfiler()
+	counterExec.SetProfiler(execProfiler)
+	require.Equal(t, execProfiler, counterExec.Profiler())
+	_ = counterExec.MustExec()
+
+	// Context hyperparameter takes precedence.
+	ctxProfiler := NewProfiler()
+	ctx.SetParam(context.ParamProfiler, ctxProfiler)
+	require.Equal(t, ctxProfiler, counterExec.Profiler())
+	_ = counterExec.MustExec()
+	_ = counterExec.MustExec()
+
+	// Disabled.
+	ctx.SetParam(context.ParamProfiler, nil)
+	counterExec.SetProfiler(nil)
+	require.Nil(t, counterExec.Profiler())
+	_ = counterExec.MustExec()
+
+	assert.Equal(t, 1, numExecutions(execProfiler))
+	assert.Equal(t, 2, numExecutions(ctxProfiler))
+}
+
+func TestExecNodesScope(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	layer := func(ctx *context.Context, x *Node) *Node {
+		g := x.Graph()
+		g.PushScope(ctx.Scope())
+		defer g.PopScope()
+		bias := ctx.VariableWithValue("bias", float32(1)).ValueGraph(g)
+		return Mul(x, bias)
+	}
+	e := context.MustNewExec(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+		y := layer(ctx.In("layer"), x)
+		// The residual connection and the activation are in the caller's scope, even after reading a variable.
+		return Tanh(Add(x, y))
+	})
+	_, g, err := e.ExecWithGraph(float32(2))
+	require.NoError(t, err)
+	scopes := make(map[NodeType]string)
+	for _, node := range g.Nodes() {
+		scopes[node.Type()] = node.Scope()
+	}
+	assert.Equal(t, "/layer", scopes[NodeTypeMul])
+	assert.Equal(t, context.RootScope, scopes[NodeTypeAdd])
+	assert.Equal(t, context.RootScope, scopes[NodeTypeTanh])
+
+	// The profiler aggregates the ops by the same scopes.
+	if backend.String() != "go" {
+		return
+	}
+	profiler := NewProfiler()
+	e.SetProfiler(profiler)
+	_ = e.MustExec(float32(2))
+	byScope := make(map[string]int)
+	for _, stats := range profiler.ByScope() {
+		byScope[stats.Key] = stats.Count
+	}
+	assert.Equal(t, 1, byScope["/layer"])
+	assert.Equal(t, 2, byScope[context.RootScope])
+}
+
+// staticShapesBackend hides the support for dynamic shapes of the wrapped backend, to test padding.
+type staticShapesBackend struct {
+	backends.Backend
+}
+
+func (b staticShapesBackend) Capabilities() backends.Capabilities {
+	capabilities := b.Backend.Capabilities().Clone()
+	capabilities.DynamicShapes = false
+	return capabilities
+}
+
+func TestExecDynamicAxis(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	counterFn := func(ctx *context.Context, x *Node) (*Node, *Node) {
+		v := ctx.VariableWithValue("counter", int32(0))
+		v.SetValueGraph(OnePlus(v.ValueGraph(x.Graph())))
+		return OnePlus(x), ReduceAllSum(x)
+	}
+	for _, testBackend := range []backends.Backend{backend, staticShapesBackend{backend}} {
+		isDynamic := testBackend.Capabilities().DynamicShapes
+		t.Run(fmt.Sprintf("DynamicShapes=%v", isDynamic), func(t *testing.T) {
+			ctx := context.New()
+			e := context.MustNewExec(testBackend, ctx, oneLayerGraph).
+				SetDynamicAxis(0).SetDynamicBuckets(MultipleOfBuckets(4)).SetMaxCache(1)
+			want := e.MustExec([][]float32{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {0, 0, 1}})[0].Value().([][]float32)
+			for batchSize := 1; batchSize <= 4; batchSize++ {
+				x := [][]float32{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {0, 0, 1}}[:batchSize]
+				outputs, g, err := e.ExecWithGraph(x)
+				require.NoError(t, err)
+				require.Equal(t, isDynamic, g.GetParameterByHandle(0).Shape().IsDynamic())
+				got := outputs[0].Value().([][]float32)
+				require.Len(t, got, batchSize)
+				assert.InDeltaSlice(t, want[batchSize-1], got[batchSize-1], 1e-4)
+			}
+
+			// Graphs that update variables are only supported with dynamic shapes: the indices of SetDynamicOutputs
+			// don't count the updated variables.
+			counter := context.MustNewExec(testBackend, ctx, counterFn).SetDynamicAxis(0).SetDynamicOutputs(0)
+			for _, batchSize := range []int{3, 5} {
+				outputs, err := counter.Exec(xslices.Iota(float32(0), batchSize))
+				counterVar := ctx.GetVariable("counter")
+				require.NotNil(t, counterVar)
+				if !isDynamic {
+					// The error happens before the graph is executed, and the variable is left untouched.
+					require.Error(t, err)
+					require.NotNil(t, counterVar.Value())
+					require.Equal(t, int32(0), counterVar.Value().Value())
+					continue
+				}
+				require.NoError(t, err)
+				require.Len(t, outputs, 2)
+				assert.Equal(t, []int{batchSize}, outputs[0].Shape().Dimensions)
+				assert.Equal(t, 0, outputs[1].Rank())
+			}
+			if isDynamic {
+				require.Equal(t, int32(2), ctx.GetVariable("counter").Value().Value())
+			}
+		})
+	}
+}
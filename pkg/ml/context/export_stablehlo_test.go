@@ -0,0 +1,73 @@
+//go:build ((linux && amd64) || darwin) && !noxla
+
+package context_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gomlx/gomlx/backends/stablehlo"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecExportStableHLO(t *testing.T) {
+	ctx := context.New()
+	ctx.In("dense").VariableWithValue("weights", [][]float32{{1, 2}, {3, 4}})
+	ctx.In("dense").VariableWithValue("bias", []float32{-1, 1})
+	modelFn := func(ctx *context.Context, x *Node) *Node {
+		ctx = ctx.In("dense")
+		weights := ctx.GetVariable("weights").ValueGraph(x.Graph())
+		bias := ctx.GetVariable("bias").ValueGraph(x.Graph())
+		return Add(Dot(x, weights), InsertAxes(bias, 0))
+	}
+	exec := context.MustNewExec(stablehlo.NewExportOnly(), ctx, modelFn)
+	inputShape := shapes.Make(dtypes.Float32, 3, 2)
+
+	// Variables as parameters.
+	program, err := exec.ExportStableHLO(false, inputShape)
+	require.NoError(t, err)
+	require.Contains(t, string(program.Program), "func.func @main(%arg0: tensor<3x2xf32>, %var__dense_weights: tensor<2x2xf32>, %var__dense_bias: tensor<2xf32>)")
+	require.Len(t, program.Signature.Inputs, 3)
+	require.Equal(t, "arg0", program.Signature.Inputs[0].Name)
+	scope, name := context.VariableScopeAndNameFromParameterName(program.Signature.Inputs[1].Name)
+	require.Equal(t, "/dense", scope)
+	require.Equal(t, "weights", name)
+	require.Len(t, program.Signature.Outputs, 1)
+	require.Equal(t, []int{3, 2}, program.Signature.Outputs[0].Dimensions)
+
+	// Variables baked as constants.
+	program, err = exec.ExportStableHLO(true, inputShape)
+	require.NoError(t, err)
+	text := string(program.Program)
+	require.Contains(t, text, "func.func @main(%arg0: tensor<3x2xf32>) -> tensor<3x2xf32>")
+	require.Contains(t, text, "dense<[[1.0, 2.0], [3.0, 4.0]]>")
+	require.Len(t, program.Signature.Inputs, 1)
+
+	// Concurrent exports, with and without variables as constants, from the same context.
+	var wg sync.WaitGroup
+	for ii := range 8 {
+		variablesAsConstants := ii%2 == 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			program, err := exec.ExportStableHLO(variablesAsConstants, inputShape)
+			if assert.NoError(t, err) {
+				assert.Len(t, program.Signature.Inputs, map[bool]int{true: 1, false: 3}[variablesAsConstants])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Uninitialized variables can't be converted to constants.
+	ctx = context.New()
+	exec = context.MustNewExec(stablehlo.NewExportOnly(), ctx, func(ctx *context.Context, x *Node) *Node {
+		return Add(x, ctx.VariableWithShape("v", x.Shape()).ValueGraph(x.Graph()))
+	})
+	_, err = exec.ExportStableHLO(true, inputShape)
+	require.ErrorContains(t, err, "has no value to be converted to a constant")
+}
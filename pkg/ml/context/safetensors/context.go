@@ -0,0 +1,251 @@
+package safetensors
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+)
+
+// IndexFileName is the name of the index of sharded HuggingFace checkpoints, that maps each tensor to its file.
+const IndexFileName = "model.safetensors.index.json"
+
+// NameMappingFn maps the name of a tensor in a checkpoint to the scope and name of a context variable.
+// It returns an empty name for tensors that should not be loaded.
+type NameMappingFn func(tensorName string) (scope, name string)
+
+// DefaultNameMapping maps dot-separated tensor names (the PyTorch/HuggingFace convention) to variables: the last
+// component is the variable name, and the others form the scope.
+// E.g.: "encoder.layer.0.query.weight" is mapped to scope "/encoder/layer/0/query" and name "weight".
+func DefaultNameMapping(tensorName string) (scope, name string) {
+	parts := strings.Split(tensorName, ".")
+	name = parts[len(parts)-1]
+	scope = context.RootScope + strings.Join(parts[:len(parts)-1], context.ScopeSeparator)
+	return
+}
+
+// DefaultTensorName is the inverse of DefaultNameMapping: it joins the scope components and the variable name
+// with dots.
+func DefaultTensorName(scope, name string) string {
+	scope = strings.Trim(scope, context.ScopeSeparator)
+	if scope == "" {
+		return name
+	}
+	return strings.ReplaceAll(scope, context.ScopeSeparator, ".") + "." + name
+}
+
+// loaderEntry is the location of a variable value in the checkpoint.
+type loaderEntry struct {
+	file       *File
+	tensorName string
+}
+
+// Loader implements context.Loader for safetensors checkpoints: the variables are read from the files only when
+// they are created in the context (usually when the model graph is first built).
+// Create it with LoadCheckpoint.
+//
+// The files are closed once all the variables in the checkpoint are loaded, or when Close is called.
+type Loader struct {
+	mu         sync.Mutex
+	files      []*File
+	variables  map[string]loaderEntry // Indexed by the variable's scope and name, see context.JoinScope.
+	prevLoader context.Loader
+}
+
+// LoadCheckpoint opens a safetensors checkpoint and attaches a Loader to ctx, so that its variables take the
+// values from the checkpoint, as they are created.
+//
+// The checkpointPath can be a ".safetensors" file, or a directory. For directories, if a HuggingFace index
+// (see IndexFileName) is present, the files listed there are used, otherwise all the ".safetensors" files in the
+// directory are used.
+//
+// The nameFn maps the tensor names to the variables scope and name. If nil, DefaultNameMapping is used.
+// Notice the values are loaded as is: if the model uses a different layout (e.g.: the weights of a PyTorch linear
+// layer are transposed with respect to layers.Dense), they need to be converted after loading.
+//
+// If ctx already had a loader, it takes precedence: the new Loader is only used for variables not found there.
+func LoadCheckpoint(ctx *context.Context, checkpointPath string, nameFn NameMappingFn) (*Loader, error) {
+	if nameFn == nil {
+		nameFn = DefaultNameMapping
+	}
+	filePaths, err := checkpointFiles(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	l := &Loader{variables: make(map[string]loaderEntry)}
+	for _, filePath := range filePaths {
+		f, err := Open(filePath)
+		if err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+		l.files = append(l.files, f)
+		for _, tensorName := range f.Names() {
+			scope, name := nameFn(tensorName)
+			if name == "" {
+				continue
+			}
+			varKey := context.JoinScope(scope, name)
+			if prev, found := l.variables[varKey]; found {
+				_ = l.Close()
+				return nil, errors.Errorf("tensors %q and %q are both mapped to variable %q",
+					prev.tensorName, tensorName, varKey)
+			}
+			l.variables[varKey] = loaderEntry{file: f, tensorName: tensorName}
+		}
+	}
+	l.prevLoader = ctx.Loader()
+	ctx.SetLoader(l)
+	return l, nil
+}
+
+// checkpointFiles returns the list of safetensors files of the checkpoint.
+func checkpointFiles(checkpointPath string) ([]string, error) {
+	stat, err := os.Stat(checkpointPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "safetensors checkpoint %q", checkpointPath)
+	}
+	if !stat.IsDir() {
+		return []string{checkpointPath}, nil
+	}
+
+	indexPath := path.Join(checkpointPath, IndexFileName)
+	if indexBytes, err := os.ReadFile(indexPath); err == nil {
+		var index struct {
+			WeightMap map[string]string `json:"weight_map"`
+		}
+		if err = json.Unmarshal(indexBytes, &index); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %q", indexPath)
+		}
+		var filePaths []string
+		for _, fileName := range index.WeightMap {
+			filePath := path.Join(checkpointPath, fileName)
+			if !slices.Contains(filePaths, filePath) {
+				filePaths = append(filePaths, filePath)
+			}
+		}
+		slices.Sort(filePaths)
+		return filePaths, nil
+	}
+
+	filePaths, err := filepath.Glob(path.Join(checkpointPath, "*.safetensors"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list safetensors files in %q", checkpointPath)
+	}
+	if len(filePaths) == 0 {
+		return nil, errors.Errorf("no safetensors files found in %q", checkpointPath)
+	}
+	slices.Sort(filePaths)
+	return filePaths, nil
+}
+
+// LoadVariable implements context.Loader.
+func (l *Loader) LoadVariable(ctx *context.Context, scope, name string) (value *tensors.Tensor, found bool) {
+	if l.prevLoader != nil {
+		value, found = l.prevLoader.LoadVariable(ctx, scope, name)
+		if found {
+			return
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	varKey := context.JoinScope(scope, name)
+	entry, found := l.variables[varKey]
+	if !found {
+		return nil, false
+	}
+	value, err := entry.file.Tensor(entry.tensorName)
+	if err != nil {
+		panic(errors.WithMessagef(err, "loading variable %q", varKey))
+	}
+	l.consume(varKey)
+	return value, true
+}
+
+// DeleteVariable implements context.Loader.
+func (l *Loader) DeleteVariable(ctx *context.Context, scope, name string) {
+	if l.prevLoader != nil {
+		l.prevLoader.DeleteVariable(ctx, scope, name)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.consume(context.JoinScope(scope, name))
+}
+
+// consume removes the variable from the list to be loaded, and closes the files if there are no more variables.
+// It must be called with the mutex locked.
+func (l *Loader) consume(varKey string) {
+	delete(l.variables, varKey)
+	if len(l.variables) == 0 {
+		l.closeFiles()
+	}
+}
+
+// VariablesToLoad returns the sorted scope and name (see context.JoinScope) of the variables not yet loaded.
+func (l *Loader) VariablesToLoad() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.variables))
+	for key := range l.variables {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Close the checkpoint files. Variables not yet loaded won't be available anymore.
+// It is safe to call it more than once.
+func (l *Loader) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.variables)
+	return l.closeFiles()
+}
+
+// closeFiles closes all files. It must be called with the mutex locked.
+func (l *Loader) closeFiles() error {
+	var firstErr error
+	for _, f := range l.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.files = nil
+	return firstErr
+}
+
+// WriteContextFile saves all the variables of the context to a safetensors file.
+//
+// The nameFn maps each variable scope and name to the tensor name. If nil, DefaultTensorName is used.
+// Variables must be initialized (see context.Context.InitializeVariables).
+func WriteContextFile(ctx *context.Context, filePath string, nameFn func(scope, name string) string) (err error) {
+	if nameFn == nil {
+		nameFn = DefaultTensorName
+	}
+	tensorsMap := make(map[string]*tensors.Tensor)
+	err = TryCatch[error](func() {
+		ctx.EnumerateVariables(func(v *context.Variable) {
+			value := v.Value()
+			if value == nil {
+				Panicf("variable %q is not initialized", v.ScopeAndName())
+			}
+			tensorName := nameFn(v.Scope(), v.Name())
+			if _, found := tensorsMap[tensorName]; found {
+				Panicf("more than one variable mapped to tensor name %q", tensorName)
+			}
+			tensorsMap[tensorName] = value
+		})
+	})
+	if err != nil {
+		return errors.WithMessagef(err, "failed to save context to %q", filePath)
+	}
+	return WriteFile(filePath, tensorsMap, nil)
+}
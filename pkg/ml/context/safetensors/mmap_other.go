@@ -0,0 +1,17 @@
+//go:build !unix
+
+package safetensors
+
+import (
+	"os"
+)
+
+// mmapFile is not supported in this platform: it returns nil, and the tensors are read with os.File.ReadAt instead.
+func mmapFile(_ *os.File, _ int64) ([]byte, error) {
+	return nil, nil
+}
+
+// munmap is a no-op in this platform.
+func munmap(_ []byte) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package safetensors
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the contents of the file to memory, read-only.
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases the memory mapped with mmapFile.
+func munmap(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,323 @@
+// Package safetensors reads and writes tensors in the safetensors format (https://github.com/huggingface/safetensors),
+// and loads safetensors checkpoints (e.g.: HuggingFace models) into a context.Context.
+//
+// Files are opened with Open, and individual tensors are read on demand (File.Tensor) from the memory-mapped file
+// (on platforms that support it), so only the tensors used are read from disk.
+// ReadFile and WriteFile read and write whole maps of tensors.
+//
+// To load a checkpoint into a context, use LoadCheckpoint: it installs a context.Loader that lazily materializes
+// the variables as they are created by the model, similar to checkpoints.Handler.
+// WriteContextFile saves the variables of a context.
+package safetensors
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+// metadataKey is the special header entry that holds the free-form metadata.
+const metadataKey = "__metadata__"
+
+// maxHeaderSize protects against corrupted files.
+const maxHeaderSize = 100 << 20
+
+// dtypeNames maps the safetensors dtype names to GoMLX dtypes.
+var dtypeNames = map[string]dtypes.DType{
+	"BOOL": dtypes.Bool,
+	"U8":   dtypes.Uint8,
+	"I8":   dtypes.Int8,
+	"U16":  dtypes.Uint16,
+	"I16":  dtypes.Int16,
+	"F16":  dtypes.Float16,
+	"BF16": dtypes.BFloat16,
+	"U32":  dtypes.Uint32,
+	"I32":  dtypes.Int32,
+	"F32":  dtypes.Float32,
+	"U64":  dtypes.Uint64,
+	"I64":  dtypes.Int64,
+	"F64":  dtypes.Float64,
+	"C64":  dtypes.Complex64,
+}
+
+// dtypeName returns the safetensors name for the dtype.
+func dtypeName(dtype dtypes.DType) (string, error) {
+	for name, candidate := range dtypeNames {
+		if candidate == dtype {
+			return name, nil
+		}
+	}
+	return "", errors.Errorf("dtype %s not supported by safetensors", dtype)
+}
+
+// headerEntry is the JSON description of one tensor in the header.
+type headerEntry struct {
+	DType       string   `json:"dtype"`
+	Shape       []int    `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// TensorInfo describes a tensor stored in a safetensors file.
+type TensorInfo struct {
+	// Name of the tensor in the file.
+	Name string
+
+	// DTypeName is the safetensors name of the dtype (e.g.: "F32", "BF16").
+	DTypeName string
+
+	// Shape of the tensor. The DType is invalid if the dtype is not supported by GoMLX (e.g.: "F8_E4M3").
+	Shape shapes.Shape
+
+	// Offset and Size of the tensor data in the file, in bytes.
+	Offset, Size int64
+}
+
+// File is an opened safetensors file. The header is read when it is opened, and the tensors are read on demand.
+//
+// It is safe for concurrent use.
+type File struct {
+	path     string
+	file     *os.File
+	mapped   []byte // nil if memory-mapping is not supported.
+	infos    map[string]*TensorInfo
+	names    []string
+	metadata map[string]string
+}
+
+// Open opens the safetensors file and parses its header. The file is memory-mapped, if the platform supports it.
+//
+// The caller must call File.Close when done.
+func Open(filePath string) (*File, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open safetensors file %q", filePath)
+	}
+	f := &File{path: filePath, file: file}
+	if err = f.readHeader(); err != nil {
+		_ = file.Close()
+		return nil, errors.WithMessagef(err, "safetensors file %q", filePath)
+	}
+	return f, nil
+}
+
+// readHeader parses the header, and memory-maps the file.
+func (f *File) readHeader() error {
+	stat, err := f.file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat file")
+	}
+	fileSize := stat.Size()
+	var lenBytes [8]byte
+	if _, err = f.file.ReadAt(lenBytes[:], 0); err != nil {
+		return errors.Wrap(err, "failed to read header length")
+	}
+	headerSize := int64(binary.LittleEndian.Uint64(lenBytes[:]))
+	if headerSize > maxHeaderSize || 8+headerSize > fileSize {
+		return errors.Errorf("invalid header length %d for file of size %d", headerSize, fileSize)
+	}
+	headerBytes := make([]byte, headerSize)
+	if _, err = f.file.ReadAt(headerBytes, 8); err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+	var header map[string]json.RawMessage
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return errors.Wrap(err, "failed to parse header")
+	}
+
+	dataOffset := 8 + headerSize
+	f.infos = make(map[string]*TensorInfo, len(header))
+	for name, raw := range header {
+		if name == metadataKey {
+			if err = json.Unmarshal(raw, &f.metadata); err != nil {
+				return errors.Wrap(err, "failed to parse metadata")
+			}
+			continue
+		}
+		var entry headerEntry
+		if err = json.Unmarshal(raw, &entry); err != nil {
+			return errors.Wrapf(err, "failed to parse header of tensor %q", name)
+		}
+		info := &TensorInfo{
+			Name:      name,
+			DTypeName: entry.DType,
+			Shape:     shapes.Shape{DType: dtypeNames[entry.DType], Dimensions: entry.Shape},
+			Offset:    dataOffset + entry.DataOffsets[0],
+			Size:      entry.DataOffsets[1] - entry.DataOffsets[0],
+		}
+		if info.Size < 0 || info.Offset+info.Size > fileSize {
+			return errors.Errorf("tensor %q has invalid data offsets %v", name, entry.DataOffsets)
+		}
+		if info.Shape.DType != dtypes.InvalidDType && uintptr(info.Size) != info.Shape.Memory() {
+			return errors.Errorf("tensor %q shaped %s has %d bytes, expected %d",
+				name, info.Shape, info.Size, info.Shape.Memory())
+		}
+		f.infos[name] = info
+		f.names = append(f.names, name)
+	}
+	sort.Strings(f.names)
+
+	f.mapped, err = mmapFile(f.file, fileSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to memory-map file")
+	}
+	return nil
+}
+
+// Close releases the memory-mapping and closes the file. Tensors already read are not affected.
+func (f *File) Close() error {
+	err := munmap(f.mapped)
+	f.mapped = nil
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Path of the file.
+func (f *File) Path() string { return f.path }
+
+// Names returns the sorted names of the tensors in the file.
+func (f *File) Names() []string { return f.names }
+
+// Metadata returns the free-form metadata stored in the file, or nil if there is none.
+func (f *File) Metadata() map[string]string { return f.metadata }
+
+// Info returns the description of the tensor with the given name, or nil if it is not in the file.
+func (f *File) Info(name string) *TensorInfo { return f.infos[name] }
+
+// Tensor reads the tensor with the given name.
+//
+// The tensor is copied from the memory-mapped file (or read from disk, if memory-mapping is not supported),
+// so it remains valid after the file is closed.
+func (f *File) Tensor(name string) (*tensors.Tensor, error) {
+	info, found := f.infos[name]
+	if !found {
+		return nil, errors.Errorf("tensor %q not found in safetensors file %q", name, f.path)
+	}
+	if info.Shape.DType == dtypes.InvalidDType {
+		return nil, errors.Errorf("tensor %q in safetensors file %q has dtype %q, not supported",
+			name, f.path, info.DTypeName)
+	}
+	t := tensors.FromShape(info.Shape)
+	var err error
+	t.MutableBytes(func(data []byte) {
+		if f.mapped != nil {
+			copy(data, f.mapped[info.Offset:info.Offset+info.Size])
+			return
+		}
+		_, err = f.file.ReadAt(data, info.Offset)
+	})
+	if err != nil {
+		t.FinalizeAll()
+		return nil, errors.Wrapf(err, "failed to read tensor %q from safetensors file %q", name, f.path)
+	}
+	return t, nil
+}
+
+// ReadFile reads all the tensors of the safetensors file.
+func ReadFile(filePath string) (map[string]*tensors.Tensor, error) {
+	f, err := Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	tensorsMap := make(map[string]*tensors.Tensor, len(f.names))
+	for _, name := range f.names {
+		tensorsMap[name], err = f.Tensor(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tensorsMap, nil
+}
+
+// WriteFile writes the tensors to a safetensors file. The metadata is optional, and can be nil.
+func WriteFile(filePath string, tensorsMap map[string]*tensors.Tensor, metadata map[string]string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create safetensors file %q", filePath)
+	}
+	w := bufio.NewWriter(file)
+	err = Write(w, tensorsMap, metadata)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithMessagef(err, "failed to write safetensors file %q", filePath)
+	}
+	return nil
+}
+
+// Write writes the tensors in the safetensors format. The metadata is optional, and can be nil.
+//
+// Tensors are written sorted by name.
+func Write(w io.Writer, tensorsMap map[string]*tensors.Tensor, metadata map[string]string) error {
+	names := make([]string, 0, len(tensorsMap))
+	for name := range tensorsMap {
+		if name == metadataKey {
+			return errors.Errorf("tensor name %q is reserved", metadataKey)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Build header.
+	header := make(map[string]any, len(names)+1)
+	if len(metadata) > 0 {
+		header[metadataKey] = metadata
+	}
+	var offset int64
+	for _, name := range names {
+		t := tensorsMap[name]
+		dtype, err := dtypeName(t.DType())
+		if err != nil {
+			return errors.WithMessagef(err, "tensor %q", name)
+		}
+		size := int64(t.Shape().Memory())
+		dims := t.Shape().Dimensions
+		if dims == nil {
+			dims = []int{}
+		}
+		header[name] = headerEntry{DType: dtype, Shape: dims, DataOffsets: [2]int64{offset, offset + size}}
+		offset += size
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode header")
+	}
+	// Pad header with spaces, so the data is 8-bytes aligned.
+	for len(headerBytes)%8 != 0 {
+		headerBytes = append(headerBytes, ' ')
+	}
+	var lenBytes [8]byte
+	binary.LittleEndian.PutUint64(lenBytes[:], uint64(len(headerBytes)))
+	if _, err = w.Write(lenBytes[:]); err != nil {
+		return errors.Wrap(err, "failed to write header length")
+	}
+	if _, err = w.Write(headerBytes); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+
+	// Write data.
+	for _, name := range names {
+		tensorsMap[name].ConstBytes(func(data []byte) {
+			_, err = w.Write(data)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to write tensor %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package safetensors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/gomlx/gopjrt/dtypes/bfloat16"
+	"github.com/stretchr/testify/require"
+	"github.com/x448/float16"
+)
+
+func TestReadKnownFormat(t *testing.T) {
+	// File built following the format specification, as written by the Python library.
+	header := []byte(`{"__metadata__":{"format":"pt"},"bias":{"dtype":"F32","shape":[2],"data_offsets":[16,24]},` +
+		`"weight":{"dtype":"I32","shape":[2,2],"data_offsets":[0,16]}}`)
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(header)))
+	buf.Write(header)
+	_ = binary.Write(&buf, binary.LittleEndian, []int32{1, 2, 3, 4})
+	_ = binary.Write(&buf, binary.LittleEndian, []float32{0.5, -1})
+	filePath := path.Join(t.TempDir(), "known.safetensors")
+	require.NoError(t, os.WriteFile(filePath, buf.Bytes(), 0o644))
+
+	f, err := Open(filePath)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, f.Close()) }()
+	require.Equal(t, []string{"bias", "weight"}, f.Names())
+	require.Equal(t, map[string]string{"format": "pt"}, f.Metadata())
+	require.Equal(t, "I32", f.Info("weight").DTypeName)
+	require.True(t, f.Info("weight").Shape.Equal(shapes.Make(dtypes.Int32, 2, 2)))
+	require.Nil(t, f.Info("missing"))
+
+	weight, err := f.Tensor("weight")
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{1, 2}, {3, 4}}, weight.Value())
+	bias, err := f.Tensor("bias")
+	require.NoError(t, err)
+	require.Equal(t, []float32{0.5, -1}, bias.Value())
+	_, err = f.Tensor("missing")
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestWriteAndRead(t *testing.T) {
+	want := map[string]*tensors.Tensor{
+		"f32":  tensors.FromValue([][]float32{{1, 2, 3}, {4, 5, 6}}),
+		"bf16": tensors.FromFlatDataAndDimensions([]bfloat16.BFloat16{bfloat16.FromFloat32(1.5), bfloat16.FromFloat32(-2)}, 2),
+		"f16":  tensors.FromFlatDataAndDimensions([]float16.Float16{float16.Fromfloat32(0.25), float16.Fromfloat32(8)}, 2),
+		"bool": tensors.FromValue([]bool{true, false, true}),
+		"i64":  tensors.FromScalar(int64(7)),
+	}
+	filePath := path.Join(t.TempDir(), "test.safetensors")
+	require.NoError(t, WriteFile(filePath, want, map[string]string{"source": "test"}))
+
+	// Data must be 8-bytes aligned.
+	contents, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Zero(t, binary.LittleEndian.Uint64(contents)%8)
+
+	got, err := ReadFile(filePath)
+	require.NoError(t, err)
+	require.Len(t, got, len(want))
+	for name, wantTensor := range want {
+		require.Truef(t, wantTensor.Equal(got[name]), "tensor %q: want %s, got %s", name, wantTensor, got[name])
+	}
+
+	f, err := Open(filePath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"source": "test"}, f.Metadata())
+	require.Equal(t, "BF16", f.Info("bf16").DTypeName)
+	bf16, err := f.Tensor("bf16")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	// Tensors remain valid after the file is closed.
+	require.Equal(t, []bfloat16.BFloat16{bfloat16.FromFloat32(1.5), bfloat16.FromFloat32(-2)}, bf16.Value())
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	// Sharded checkpoint, with an index file.
+	dir := t.TempDir()
+	require.NoError(t, WriteFile(path.Join(dir, "model-00001-of-00002.safetensors"), map[string]*tensors.Tensor{
+		"encoder.layer.0.weight": tensors.FromValue([][]float32{{1, 2}, {3, 4}}),
+		"encoder.layer.0.bias":   tensors.FromValue([]float32{5, 6}),
+	}, nil))
+	require.NoError(t, WriteFile(path.Join(dir, "model-00002-of-00002.safetensors"), map[string]*tensors.Tensor{
+		"head.weight":    tensors.FromValue([]float32{7, 8}),
+		"ignored.tensor": tensors.FromScalar(float32(0)),
+	}, nil))
+	index := `{"metadata": {}, "weight_map": {
+		"encoder.layer.0.weight": "model-00001-of-00002.safetensors",
+		"encoder.layer.0.bias": "model-00001-of-00002.safetensors",
+		"head.weight": "model-00002-of-00002.safetensors",
+		"ignored.tensor": "model-00002-of-00002.safetensors"}}`
+	require.NoError(t, os.WriteFile(path.Join(dir, IndexFileName), []byte(index), 0o644))
+
+	ctx := context.New().Checked(false)
+	loader, err := LoadCheckpoint(ctx, dir, func(tensorName string) (scope, name string) {
+		if tensorName == "ignored.tensor" {
+			return "", ""
+		}
+		return DefaultNameMapping(tensorName)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/encoder/layer/0/bias", "/encoder/layer/0/weight", "/head/weight"},
+		loader.VariablesToLoad())
+
+	// Variables are loaded as they are created.
+	weight := ctx.In("encoder").In("layer").In("0").VariableWithShape("weight", shapes.Make(dtypes.Float32, 2, 2))
+	require.Equal(t, [][]float32{{1, 2}, {3, 4}}, weight.Value().Value())
+	require.Equal(t, []string{"/encoder/layer/0/bias", "/head/weight"}, loader.VariablesToLoad())
+	notInCheckpoint := ctx.In("other").VariableWithValue("x", float32(3))
+	require.Equal(t, float32(3), notInCheckpoint.Value().Value())
+	ctx.In("head").DeleteVariable(ctx.In("head").Scope(), "weight")
+	require.Equal(t, []string{"/encoder/layer/0/bias"}, loader.VariablesToLoad())
+	bias := ctx.In("encoder").In("layer").In("0").VariableWithValue("bias", []float32{0, 0})
+	require.Equal(t, []float32{5, 6}, bias.Value().Value())
+	require.Empty(t, loader.VariablesToLoad())
+	require.NoError(t, loader.Close())
+}
+
+func TestWriteContextFile(t *testing.T) {
+	ctx := context.New()
+	ctx.In("dense").VariableWithValue("weights", [][]float32{{1, 2}})
+	ctx.VariableWithValue("step", int64(3))
+	filePath := path.Join(t.TempDir(), "ctx.safetensors")
+	require.NoError(t, WriteContextFile(ctx, filePath, nil))
+
+	got, err := ReadFile(filePath)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, [][]float32{{1, 2}}, got["dense.weights"].Value())
+	require.Equal(t, int64(3), got["step"].Value())
+
+	// Loading it back with the default name mapping.
+	ctx2 := context.New().Checked(false)
+	_, err = LoadCheckpoint(ctx2, filePath, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{1, 2}}, ctx2.In("dense").VariableWithValue("weights", [][]float32{{0, 0}}).Value().Value())
+}
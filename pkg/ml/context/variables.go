@@ -287,13 +287,24 @@ func (v *Variable) SetValueGraph(value *Node) {
 // Since the value of a variable can change in the middle of the graph (e.g: something that uses the
 // variable after a gradient descent is applied) consider using ValueGraph to read the current associated
 // value of a variable in a graph.
+//
+// For graphs exported with the variables as constants (see Exec.ExportStableHLO), it returns instead a constant
+// with the current value of the variable.
 func (v *Variable) ParamNode(g *Graph) *Node {
 	v.AssertValid()
 	g.AssertValid()
 	nodes, found := v.graphToNodes.Load(g.GraphId())
 	if !found {
-		paramName := v.ParameterName()
-		paramNode := graph.Parameter(g, paramName, v.shape)
+		var paramNode *Node
+		if asConstant, _ := v.ctx.data.variablesAsConstants.Load(g.GraphId()); asConstant {
+			if v.value == nil {
+				Panicf("variable %q has no value to be converted to a constant: initialize the variables "+
+					"(see Context.InitializeVariables) or load them from a checkpoint first", v.ScopeAndName())
+			}
+			paramNode = graph.ConstTensor(g, v.value)
+		} else {
+			paramNode = graph.Parameter(g, v.ParameterName(), v.shape)
+		}
 		nodes = &variableNodes{valueNode: paramNode, paramNode: paramNode}
 		v.graphToNodes.Store(g.GraphId(), nodes)
 	}
@@ -17,6 +17,8 @@
 // Package datasets is a collection of utility datasets (train.Dataset) that can be combined for efficient
 // preprocessing: `Take`, `InMemory`, `Parallel`, `MapWithGraphFn`, `Freeing`.
 //
+// It also includes sources of data, like `NewImageFolder`, to read images organized in one directory per class.
+//
 // It also includes normalization tools.
 package datasets
 
@@ -0,0 +1,498 @@
+package datasets
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register JPEG decoder.
+	_ "image/png"  // Register PNG decoder.
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+// ImageFolderExtensions lists the (lower-case) file extensions recognized as images by NewImageFolder.
+var ImageFolderExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// ImageFolderDataset is a train.Dataset that reads images from an "ImageFolder"-style directory tree,
+// where each subdirectory of the base directory is a class, and all images under it (recursively)
+// are examples of that class:
+//
+//	baseDir/cat/001.jpg
+//	baseDir/cat/002.png
+//	baseDir/dog/more/003.jpeg
+//
+// Images are decoded with Go's standard library (JPEG and PNG), optionally resized and cropped to a
+// target size, and yielded as batches converted with images.ToTensor: the only input is shaped
+// `[batch_size, height, width, channels]`, and the only label is shaped `[batch_size, 1]` with the
+// index of the class (see Classes).
+//
+// Decoding and resizing can be expensive, so it can optionally cache the decoded images to disk, see CacheDir.
+//
+// Yield is safe for concurrent use: the decoding is done outside any lock, so it can be wrapped with
+// Parallel (or ReadAhead) to decode images in parallel.
+type ImageFolderDataset struct {
+	name, baseDir string
+
+	classes []string
+	paths   []string
+	labels  []int
+
+	// Configuration.
+	width, height int
+	withPadding   bool
+	dtype         dtypes.DType
+	withAlpha     bool
+	maxValue      float64
+	cacheDir      string
+
+	// muSampling serializes the sampling information, all the member variables below.
+	muSampling          sync.Mutex
+	batchSize           int
+	dropIncompleteBatch bool
+	infinite            bool
+	shuffle             []int
+	rng                 *rand.Rand
+	next                int
+}
+
+var _ train.Dataset = (*ImageFolderDataset)(nil)
+
+// NewImageFolder creates an ImageFolderDataset with the images found under baseDir: each subdirectory
+// of baseDir is a class, and the images under it are its examples. Classes are sorted by name, and their
+// index is used as the label.
+//
+// Files whose extensions are not listed in ImageFolderExtensions are ignored.
+//
+// By default, it yields one image at a time (see BatchSize), in the order of the files (see Shuffle),
+// with the images in their original size (see Size) converted to Float32 values from 0 to 1.
+// The configuration methods should be called before starting to read from the dataset.
+func NewImageFolder(name, baseDir string) (*ImageFolderDataset, error) {
+	ds := &ImageFolderDataset{
+		name:     name,
+		baseDir:  baseDir,
+		dtype:    dtypes.Float32,
+		maxValue: 1.0,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewImageFolder(%q) failed to list directory", baseDir)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ds.classes = append(ds.classes, entry.Name())
+	}
+	slices.Sort(ds.classes)
+	for classIdx, class := range ds.classes {
+		var classPaths []string
+		err = filepath.WalkDir(filepath.Join(baseDir, class), func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !slices.Contains(ImageFolderExtensions, strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+			classPaths = append(classPaths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "NewImageFolder(%q) failed to list images of class %q", baseDir, class)
+		}
+		slices.Sort(classPaths)
+		for _, path := range classPaths {
+			ds.paths = append(ds.paths, path)
+			ds.labels = append(ds.labels, classIdx)
+		}
+	}
+	if len(ds.paths) == 0 {
+		return nil, errors.Errorf("NewImageFolder(%q) found no images in any class subdirectory", baseDir)
+	}
+	return ds, nil
+}
+
+// Name implements train.Dataset.
+func (ds *ImageFolderDataset) Name() string { return ds.name }
+
+// Classes returns the names of the classes (the subdirectories of the base directory), in the order
+// of their label index.
+func (ds *ImageFolderDataset) Classes() []string { return ds.classes }
+
+// NumExamples returns the number of images found.
+func (ds *ImageFolderDataset) NumExamples() int { return len(ds.paths) }
+
+// Paths returns the paths to all images found, in their original order. The label of each is given by Labels.
+func (ds *ImageFolderDataset) Paths() []string { return ds.paths }
+
+// Labels returns the label (class index) of each image returned by Paths.
+func (ds *ImageFolderDataset) Labels() []int { return ds.labels }
+
+// Size configures the size of the yielded images. Images are resized so that they cover the target size
+// while preserving the aspect ratio, and then the center is cropped -- see WithPadding for an alternative.
+//
+// If not set (or if set to 0), images are yielded with their original size, in which case
+// all images in a batch must have the same size.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) Size(width, height int) *ImageFolderDataset {
+	ds.width, ds.height = width, height
+	return ds
+}
+
+// WithPadding configures the resizing (see Size) to fit the whole image inside the target size, preserving the
+// aspect ratio, and padding the rest with black (and transparent) pixels, as opposed to cropping the image.
+// Images smaller than the target size are enlarged.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) WithPadding() *ImageFolderDataset {
+	ds.withPadding = true
+	return ds
+}
+
+// DType configures the dtype of the yielded images. The default is Float32.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) DType(dtype dtypes.DType) *ImageFolderDataset {
+	ds.dtype = dtype
+	if !dtype.IsFloat() && ds.maxValue == 1.0 {
+		ds.maxValue = 255.0
+	}
+	return ds
+}
+
+// MaxValue configures the value of a saturated channel in the yielded images, see images.ToTensorConfig.MaxValue.
+// The default is 1.0 for float dtypes and 255 for integer dtypes.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) MaxValue(v float64) *ImageFolderDataset {
+	ds.maxValue = v
+	return ds
+}
+
+// WithAlpha configures the yielded images to include the alpha channel, so they have 4 channels.
+// The default is to yield only 3 channels (RGB).
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) WithAlpha() *ImageFolderDataset {
+	ds.withAlpha = true
+	return ds
+}
+
+// CacheDir configures a directory where the decoded (and resized) images are cached, so they don't need to be
+// decoded again in the next epochs (or the next time the program runs). The directory is created if it
+// doesn't exist, and it can be shared by different datasets.
+//
+// Cached entries are keyed by the image path, its size and modification time, and the target size,
+// so changes to the images are picked up automatically.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) CacheDir(dir string) *ImageFolderDataset {
+	ds.cacheDir = dir
+	return ds
+}
+
+// BatchSize configures the ImageFolderDataset to return batches of the given size. If dropIncompleteBatch is set
+// to true, it will simply drop examples if there are not enough to fill a batch -- this can only happen on the
+// last batch of an epoch. Otherwise, it will return a partially filled batch.
+//
+// If `n` is set to 0, it reverts back to yielding one example at a time: images shaped
+// `[height, width, channels]` and labels shaped `[1]`.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) BatchSize(n int, dropIncompleteBatch bool) *ImageFolderDataset {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	ds.batchSize = n
+	ds.dropIncompleteBatch = dropIncompleteBatch
+	return ds
+}
+
+// Shuffle configures the ImageFolderDataset to shuffle the order of the images. It is reshuffled at every Reset
+// (or at the end of each epoch, if it is configured to be Infinite).
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) Shuffle() *ImageFolderDataset {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	ds.shuffleLocked()
+	return ds
+}
+
+// WithRand sets the random number generator (RNG) for shuffling. This allows for repeatable
+// deterministic random sampling, if one wants. The default is to use an RNG initialized with the current
+// nanosecond time.
+//
+// If dataset is configured with Shuffle, this re-shuffles the dataset immediately.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) WithRand(rng *rand.Rand) *ImageFolderDataset {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	ds.rng = rng
+	if ds.shuffle != nil {
+		ds.shuffleLocked()
+	}
+	return ds
+}
+
+// Infinite sets whether the dataset should loop indefinitely. The default is `infinite = false`, which
+// causes the dataset to going through the data only once before returning io.EOF.
+//
+// It returns the modified ImageFolderDataset, so calls can be cascaded if one wants.
+func (ds *ImageFolderDataset) Infinite(infinite bool) *ImageFolderDataset {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	ds.infinite = infinite
+	return ds
+}
+
+// shuffleLocked shuffles dataset yield order. It assumes muSampling is locked.
+func (ds *ImageFolderDataset) shuffleLocked() {
+	if ds.shuffle == nil {
+		ds.shuffle = make([]int, len(ds.paths))
+		for ii := range ds.shuffle {
+			ds.shuffle[ii] = ii
+		}
+	}
+	ds.rng.Shuffle(len(ds.shuffle), func(i, j int) {
+		ds.shuffle[i], ds.shuffle[j] = ds.shuffle[j], ds.shuffle[i]
+	})
+}
+
+// Reset implements train.Dataset.
+func (ds *ImageFolderDataset) Reset() {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	ds.next = 0
+	if ds.shuffle != nil {
+		ds.shuffleLocked()
+	}
+}
+
+// indicesNextYield retrieves the indices of the images for the next Yield call, and the batch size used.
+// This needs to be done protected by `muSampling`, but the decoding of the images can be parallelized.
+func (ds *ImageFolderDataset) indicesNextYield() (indices []int, batchSize int) {
+	ds.muSampling.Lock()
+	defer ds.muSampling.Unlock()
+	batchSize = ds.batchSize
+	n := max(batchSize, 1)
+	numExamples := len(ds.paths)
+	indices = make([]int, 0, n)
+	for len(indices) < n {
+		if ds.next >= numExamples {
+			if !ds.infinite {
+				break
+			}
+			ds.next = 0
+			if ds.shuffle != nil {
+				ds.shuffleLocked()
+			}
+		}
+		if ds.shuffle != nil {
+			indices = append(indices, ds.shuffle[ds.next])
+		} else {
+			indices = append(indices, ds.next)
+		}
+		ds.next++
+	}
+	if len(indices) < n && ds.dropIncompleteBatch {
+		indices = nil
+	}
+	return
+}
+
+// Yield implements train.Dataset. It returns the images and their labels, and the spec is the dataset itself.
+func (ds *ImageFolderDataset) Yield() (spec any, inputs []*tensors.Tensor, labels []*tensors.Tensor, err error) {
+	indices, batchSize := ds.indicesNextYield()
+	if len(indices) == 0 {
+		err = io.EOF
+		return
+	}
+	imgs := make([]image.Image, len(indices))
+	labelsValues := make([][]int64, len(indices))
+	for ii, idx := range indices {
+		imgs[ii], err = ds.LoadImage(idx)
+		if err != nil {
+			return
+		}
+		labelsValues[ii] = []int64{int64(ds.labels[idx])}
+	}
+
+	toTensor := images.ToTensor(ds.dtype).MaxValue(ds.maxValue)
+	if ds.withAlpha {
+		toTensor = toTensor.WithAlpha()
+	}
+	var imagesT *tensors.Tensor
+	err = TryCatch[error](func() {
+		if batchSize <= 0 {
+			imagesT = toTensor.Single(imgs[0])
+			return
+		}
+		size := imgs[0].Bounds().Size()
+		for ii, img := range imgs {
+			if img.Bounds().Size() != size {
+				Panicf("image %q has size %s, but %q in the same batch has size %s -- use ImageFolderDataset.Size "+
+					"to resize all images to the same size", ds.paths[indices[ii]], img.Bounds().Size(),
+					ds.paths[indices[0]], size)
+			}
+		}
+		imagesT = toTensor.Batch(imgs)
+	})
+	if err != nil {
+		err = errors.WithMessagef(err, "ImageFolderDataset(%q).Yield()", ds.name)
+		return
+	}
+	if imagesT == nil {
+		err = errors.Errorf("ImageFolderDataset(%q).Yield() failed to convert images to dtype %s", ds.name, ds.dtype)
+		return
+	}
+	spec = ds
+	inputs = []*tensors.Tensor{imagesT}
+	if batchSize <= 0 {
+		labels = []*tensors.Tensor{tensors.FromValue(labelsValues[0])}
+	} else {
+		labels = []*tensors.Tensor{tensors.FromValue(labelsValues)}
+	}
+	return
+}
+
+// LoadImage returns the decoded image of the example with the given index (see Paths), resized according to
+// the configuration. If CacheDir is configured, the cache is used.
+//
+// It is safe for concurrent use.
+func (ds *ImageFolderDataset) LoadImage(idx int) (image.Image, error) {
+	path := ds.paths[idx]
+	var cachePath string
+	if ds.cacheDir != "" {
+		var err error
+		cachePath, err = ds.cachePath(path)
+		if err != nil {
+			return nil, err
+		}
+		img, err := readCachedImage(cachePath)
+		if err == nil {
+			return img, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.WithMessagef(err, "ImageFolderDataset(%q) failed to read cached image for %q", ds.name, path)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ImageFolderDataset(%q) failed to open image", ds.name)
+	}
+	img, _, err := image.Decode(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ImageFolderDataset(%q) failed to decode image %q", ds.name, path)
+	}
+	nrgba := ds.resize(img)
+	if cachePath != "" {
+		err = writeCachedImage(cachePath, nrgba)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "ImageFolderDataset(%q) failed to cache image %q", ds.name, path)
+		}
+	}
+	return nrgba, nil
+}
+
+// resize the image according to the configuration, and returns it as an image.NRGBA.
+func (ds *ImageFolderDataset) resize(img image.Image) *image.NRGBA {
+	if ds.width <= 0 || ds.height <= 0 {
+		return toNRGBA(img)
+	}
+	if !ds.withPadding {
+		return resizeFill(img, ds.width, ds.height)
+	}
+	return resizeFit(img, ds.width, ds.height)
+}
+
+// cachePath returns the path of the cache file for the image in the given path.
+func (ds *ImageFolderDataset) cachePath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "ImageFolderDataset(%q) failed to stat image", ds.name)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "ImageFolderDataset(%q) failed to find absolute path for %q", ds.name, path)
+	}
+	key := fmt.Sprintf("%s|%d|%d|%dx%d|%v", absPath, info.Size(), info.ModTime().UnixNano(),
+		ds.width, ds.height, ds.withPadding)
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(ds.cacheDir, hex.EncodeToString(hash[:])+".nrgba"), nil
+}
+
+// readCachedImage reads an image written by writeCachedImage.
+func readCachedImage(path string) (*image.NRGBA, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) < 8 {
+		return nil, errors.Errorf("invalid cached image file %q", path)
+	}
+	width := int(binary.LittleEndian.Uint32(contents[0:4]))
+	height := int(binary.LittleEndian.Uint32(contents[4:8]))
+	pix := contents[8:]
+	if len(pix) != 4*width*height {
+		return nil, errors.Errorf("invalid cached image file %q: expected %d bytes of pixels for %dx%d image, got %d",
+			path, 4*width*height, width, height, len(pix))
+	}
+	return &image.NRGBA{Pix: pix, Stride: 4 * width, Rect: image.Rect(0, 0, width, height)}, nil
+}
+
+// writeCachedImage writes the image to the given path: a header with the width and height as uint32, followed by
+// the NRGBA pixels.
+//
+// It writes to a temporary file first, and then renames it, so concurrent readers never see a partial file.
+func writeCachedImage(path string, img *image.NRGBA) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create cache directory")
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	contents := make([]byte, 8, 8+4*width*height)
+	binary.LittleEndian.PutUint32(contents[0:4], uint32(width))
+	binary.LittleEndian.PutUint32(contents[4:8], uint32(height))
+	for row := range height {
+		start := row * img.Stride
+		contents = append(contents, img.Pix[start:start+4*width]...)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create cache file")
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to write cache file %q", path)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package datasets
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createImageFolder creates an ImageFolder-style directory tree with images of the given sizes, filled with
+// a color that encodes the class index in the red channel.
+func createImageFolder(t *testing.T) (baseDir string) {
+	baseDir = t.TempDir()
+	for classIdx, class := range []string{"cats", "dogs"} {
+		for ii, size := range []image.Point{{8, 6}, {6, 8}, {10, 10}} {
+			img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+			for y := range size.Y {
+				for x := range size.X {
+					img.SetNRGBA(x, y, color.NRGBA{R: uint8(100 * classIdx), G: 200, B: 0, A: 255})
+				}
+			}
+			dir := filepath.Join(baseDir, class)
+			if ii == 2 {
+				dir = filepath.Join(dir, "nested")
+			}
+			require.NoError(t, os.MkdirAll(dir, 0o755))
+			f, err := os.Create(filepath.Join(dir, []string{"a.png", "b.JPG", "c.jpeg"}[ii]))
+			require.NoError(t, err)
+			if ii == 0 {
+				require.NoError(t, png.Encode(f, img))
+			} else {
+				require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 100}))
+			}
+			require.NoError(t, f.Close())
+		}
+	}
+	// Files that are not images are ignored.
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "cats", "README.txt"), []byte("meow"), 0o644))
+	return
+}
+
+func TestImageFolder(t *testing.T) {
+	baseDir := createImageFolder(t)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	ds, err := NewImageFolder("pets", baseDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cats", "dogs"}, ds.Classes())
+	require.Equal(t, 6, ds.NumExamples())
+	require.Equal(t, []int{0, 0, 0, 1, 1, 1}, ds.Labels())
+	ds.Size(4, 4).BatchSize(4, false).CacheDir(cacheDir)
+
+	readEpoch := func(ds *ImageFolderDataset) (labels []int64) {
+		for {
+			_, inputs, labelsT, err := ds.Yield()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			require.Len(t, inputs, 1)
+			batchSize := labelsT[0].Shape().Dimensions[0]
+			require.NoError(t, inputs[0].Shape().CheckDims(batchSize, 4, 4, 3))
+			require.NoError(t, labelsT[0].Shape().CheckDims(batchSize, 1))
+			imgs := inputs[0].Value().([][][][]float32)
+			for ii, label := range labelsT[0].Value().([][]int64) {
+				labels = append(labels, label[0])
+				require.InDelta(t, float32(label[0])*100/255, imgs[ii][2][2][0], 0.02)
+				require.InDelta(t, float32(200)/255, imgs[ii][2][2][1], 0.02)
+			}
+		}
+		return
+	}
+	require.Equal(t, []int64{0, 0, 0, 1, 1, 1}, readEpoch(ds))
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+
+	// Second epoch shuffled, reading from the cache.
+	ds.Shuffle().WithRand(rand.New(rand.NewSource(42))).Reset()
+	labels := readEpoch(ds)
+	require.ElementsMatch(t, []int64{0, 0, 0, 1, 1, 1}, labels)
+
+	// Unbatched with padding, in parallel.
+	ds2, err := NewImageFolder("pets", baseDir)
+	require.NoError(t, err)
+	ds2.Size(6, 4).WithPadding().WithAlpha()
+	pDS := Parallel(ds2)
+	count := 0
+	for {
+		_, inputs, labelsT, err := pDS.Yield()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, inputs[0].Shape().CheckDims(4, 6, 4))
+		require.NoError(t, labelsT[0].Shape().CheckDims(1))
+		count++
+	}
+	require.Equal(t, 6, count)
+
+	// Images of different sizes can't be batched without resizing.
+	ds3, err := NewImageFolder("pets", baseDir)
+	require.NoError(t, err)
+	_, _, _, err = ds3.BatchSize(2, true).Yield()
+	require.Error(t, err)
+
+	// Empty directories are an error.
+	_, err = NewImageFolder("empty", t.TempDir())
+	require.Error(t, err)
+}
+
+func TestImageFolderResize(t *testing.T) {
+	// 4x2 opaque image, with a red left half and a blue right half.
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// Fit enlarges the image to 8x4, and pads 2 rows above and below.
+	ds := &ImageFolderDataset{width: 8, height: 8, withPadding: true}
+	fit := ds.resize(img)
+	require.Equal(t, image.Rect(0, 0, 8, 8), fit.Bounds())
+	for x := range 8 {
+		require.Equal(t, uint8(0), fit.NRGBAAt(x, 0).A, "x=%d", x)
+		require.Equal(t, uint8(0), fit.NRGBAAt(x, 7).A, "x=%d", x)
+		for y := 2; y < 6; y++ {
+			require.Equal(t, uint8(255), fit.NRGBAAt(x, y).A, "x=%d, y=%d", x, y)
+		}
+	}
+	require.Equal(t, color.NRGBA{R: 255, A: 255}, fit.NRGBAAt(0, 3))
+	require.Equal(t, color.NRGBA{B: 255, A: 255}, fit.NRGBAAt(7, 3))
+
+	// Fill crops the center 2x2 and enlarges it: left half red, right half blue.
+	ds = &ImageFolderDataset{width: 4, height: 4}
+	fill := ds.resize(img)
+	require.Equal(t, image.Rect(0, 0, 4, 4), fill.Bounds())
+	require.Equal(t, color.NRGBA{R: 255, A: 255}, fill.NRGBAAt(0, 0))
+	require.Equal(t, color.NRGBA{B: 255, A: 255}, fill.NRGBAAt(3, 3))
+
+	// Shrinking averages the pixels.
+	ds = &ImageFolderDataset{width: 1, height: 1, withPadding: true}
+	shrunk := ds.resize(img.SubImage(image.Rect(1, 0, 3, 2)))
+	require.Equal(t, color.NRGBA{R: 128, B: 128, A: 255}, shrunk.NRGBAAt(0, 0))
+}
@@ -0,0 +1,157 @@
+package datasets
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// toNRGBA returns a copy of img as an *image.NRGBA, with its bounds starting at (0, 0).
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// resizeFill resizes img to fill exactly width x height, preserving the aspect ratio: the center of
+// the image is cropped to the target aspect ratio before resizing.
+func resizeFill(img image.Image, width, height int) *image.NRGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	crop := bounds
+	if srcWidth*height > srcHeight*width {
+		// Source is wider than the target: crop the sides.
+		cropWidth := max(1, int(math.Round(float64(srcHeight*width)/float64(height))))
+		crop.Min.X += (srcWidth - cropWidth) / 2
+		crop.Max.X = crop.Min.X + cropWidth
+	} else {
+		// Source is taller than the target: crop the top and bottom.
+		cropHeight := max(1, int(math.Round(float64(srcWidth*height)/float64(width))))
+		crop.Min.Y += (srcHeight - cropHeight) / 2
+		crop.Max.Y = crop.Min.Y + cropHeight
+	}
+	src := image.NewNRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Src)
+	return resizeNRGBA(src, width, height)
+}
+
+// resizeFit resizes img to the largest size that fits in width x height, preserving the aspect ratio -- it
+// both shrinks and enlarges images -- and pads the rest with transparent black pixels, keeping the image centered.
+func resizeFit(img image.Image, width, height int) *image.NRGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	scale := min(float64(width)/float64(srcWidth), float64(height)/float64(srcHeight))
+	fitWidth := min(width, max(1, int(math.Round(float64(srcWidth)*scale))))
+	fitHeight := min(height, max(1, int(math.Round(float64(srcHeight)*scale))))
+	resized := resizeNRGBA(toNRGBA(img), fitWidth, fitHeight)
+	if fitWidth == width && fitHeight == height {
+		return resized
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	offset := image.Pt((width-fitWidth)/2, (height-fitHeight)/2)
+	draw.Draw(dst, resized.Bounds().Add(offset), resized, image.Point{}, draw.Src)
+	return dst
+}
+
+// resampleWeights holds the weights of the source pixels, starting at start, used for one destination pixel.
+type resampleWeights struct {
+	start   int
+	weights []float64
+}
+
+// makeResampleWeights returns the weights of a triangle (linear) filter to resample srcSize pixels to dstSize.
+// When shrinking, the filter is widened to cover all the source pixels, which avoids aliasing.
+func makeResampleWeights(srcSize, dstSize int) []resampleWeights {
+	scale := float64(srcSize) / float64(dstSize)
+	radius := max(scale, 1.0)
+	all := make([]resampleWeights, dstSize)
+	for ii := range dstSize {
+		center := (float64(ii) + 0.5) * scale
+		start := max(int(math.Floor(center-radius)), 0)
+		end := min(int(math.Ceil(center+radius)), srcSize)
+		weights := make([]float64, 0, end-start)
+		var sum float64
+		for jj := start; jj < end; jj++ {
+			w := max(1.0-math.Abs((float64(jj)+0.5-center)/radius), 0)
+			weights = append(weights, w)
+			sum += w
+		}
+		if sum == 0 {
+			// Nearest pixel.
+			start = min(int(center), srcSize-1)
+			weights, sum = []float64{1}, 1
+		}
+		for jj := range weights {
+			weights[jj] /= sum
+		}
+		all[ii] = resampleWeights{start: start, weights: weights}
+	}
+	return all
+}
+
+// resizeNRGBA resizes src (with bounds starting at (0, 0)) to width x height with a separable triangle filter.
+// Colors are weighted by their alpha, so transparent pixels don't bleed into their neighbours.
+func resizeNRGBA(src *image.NRGBA, width, height int) *image.NRGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcWidth == width && srcHeight == height {
+		return src
+	}
+
+	// Alpha-premultiplied source values.
+	values := make([]float64, 4*srcWidth*srcHeight)
+	for y := range srcHeight {
+		row := src.Pix[y*src.Stride : y*src.Stride+4*srcWidth]
+		for x := range srcWidth {
+			alpha := float64(row[4*x+3])
+			idx := 4 * (y*srcWidth + x)
+			for c := range 3 {
+				values[idx+c] = float64(row[4*x+c]) * alpha / 255
+			}
+			values[idx+3] = alpha
+		}
+	}
+
+	// Horizontal pass: srcWidth -> width.
+	horizontal := make([]float64, 4*width*srcHeight)
+	for x, rw := range makeResampleWeights(srcWidth, width) {
+		for y := range srcHeight {
+			dst := horizontal[4*(y*width+x) : 4*(y*width+x)+4]
+			for jj, w := range rw.weights {
+				idx := 4 * (y*srcWidth + rw.start + jj)
+				for c := range 4 {
+					dst[c] += w * values[idx+c]
+				}
+			}
+		}
+	}
+
+	// Vertical pass: srcHeight -> height, and conversion back to NRGBA.
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var pixel [4]float64
+	for y, rw := range makeResampleWeights(srcHeight, height) {
+		for x := range width {
+			pixel = [4]float64{}
+			for jj, w := range rw.weights {
+				idx := 4 * ((rw.start+jj)*width + x)
+				for c := range 4 {
+					pixel[c] += w * horizontal[idx+c]
+				}
+			}
+			out := dst.Pix[y*dst.Stride+4*x : y*dst.Stride+4*x+4]
+			alpha := pixel[3]
+			out[3] = clampToUint8(alpha)
+			if alpha > 0 {
+				for c := range 3 {
+					out[c] = clampToUint8(pixel[c] * 255 / alpha)
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// clampToUint8 rounds v and clamps it to the range [0, 255].
+func clampToUint8(v float64) uint8 {
+	return uint8(min(max(math.Round(v), 0), 255))
+}
@@ -0,0 +1,199 @@
+package generation
+
+import (
+	"math"
+	"slices"
+	"strings"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+)
+
+// hypothesis is a finished beam search sequence, with its normalized score.
+type hypothesis struct {
+	tokens []int
+	score  float64
+}
+
+// beamSearch implements the beam search for the prompts.
+//
+// Each prompt is replicated numBeams times: row `b*numBeams + beam` holds the beam for the prompt b.
+// The selection of the candidates is done in the graph (see beamCandidates), and the bookkeeping of the
+// beams and finished hypotheses is done here.
+func (gen *Generator) beamSearch(prompts [][]int) [][]int {
+	numBeams := gen.numBeams
+	batchSize := len(prompts)
+	numRows := batchSize * numBeams
+	seqs := &sequences{tokens: make([][]int, numRows), promptLens: make([]int, numRows)}
+	scores := make([]float32, numRows)
+	for row := range numRows {
+		prompt := prompts[row/numBeams]
+		seqs.tokens[row] = slices.Clone(prompt)
+		seqs.promptLens[row] = len(prompt)
+		if row%numBeams != 0 {
+			// Only the first beam is active at the start, to avoid repeated candidates.
+			scores[row] = float32(math.Inf(-1))
+		}
+	}
+	finished := make([][]hypothesis, batchSize)
+	done := make([]bool, batchSize)
+	numDone := 0
+
+	// finish adds the active beams of the example to the finished hypotheses and marks it as done.
+	finish := func(example int) {
+		for row := example * numBeams; row < (example+1)*numBeams; row++ {
+			if !math.IsInf(float64(scores[row]), -1) {
+				generated := seqs.tokens[row][seqs.promptLens[row]:]
+				finished[example] = append(finished[example], hypothesis{
+					tokens: slices.Clone(generated),
+					score:  gen.normalizedScore(float64(scores[row]), len(generated)),
+				})
+			}
+		}
+		done[example] = true
+		numDone++
+	}
+
+	s := gen.newStepper()
+	for range s.maxSteps(seqs) {
+		outputs := s.step(seqs, scores)
+		candidateScores := tensors.CopyFlatData[float32](outputs[0])
+		candidateParents := tensors.CopyFlatData[int32](outputs[1])
+		candidateTokens := tensors.CopyFlatData[int32](outputs[2])
+		numCandidates := len(candidateScores) / batchSize
+
+		parents := make([]int32, numRows)
+		newTokens := make([][]int, numRows)
+		newScores := make([]float32, numRows)
+		for row := range numRows {
+			parents[row] = int32(row)
+			newTokens[row] = seqs.tokens[row]
+			newScores[row] = scores[row]
+		}
+		for example := range batchSize {
+			if done[example] {
+				continue
+			}
+			firstRow := example * numBeams
+			beam := 0
+			for candidate := range numCandidates {
+				idx := example*numCandidates + candidate
+				score := candidateScores[idx]
+				if math.IsInf(float64(score), -1) {
+					break
+				}
+				parentRow := firstRow + int(candidateParents[idx])
+				token := int(candidateTokens[idx])
+				if slices.Contains(gen.stopTokens, token) {
+					// Only accept finished hypotheses among the best numBeams candidates.
+					if candidate < numBeams {
+						generated := seqs.tokens[parentRow][seqs.promptLens[parentRow]:]
+						finished[example] = append(finished[example], hypothesis{
+							tokens: slices.Clone(generated),
+							score:  gen.normalizedScore(float64(score), len(generated)+1),
+						})
+					}
+					continue
+				}
+				row := firstRow + beam
+				parents[row] = int32(parentRow)
+				newTokens[row] = append(slices.Clone(seqs.tokens[parentRow]), token)
+				newScores[row] = score
+				beam++
+				if beam == numBeams {
+					break
+				}
+			}
+			for ; beam < numBeams; beam++ {
+				// Not enough candidates: the remaining beams are deactivated.
+				row := firstRow + beam
+				newTokens[row] = slices.Clone(seqs.tokens[firstRow])
+				newScores[row] = float32(math.Inf(-1))
+			}
+		}
+		seqs.tokens, scores = newTokens, newScores
+		if gen.incrementalFn != nil {
+			gen.reorderKVCache(parents)
+		}
+
+		// Check which examples are done.
+		for example := range batchSize {
+			if done[example] {
+				continue
+			}
+			firstRow := example * numBeams
+			if math.IsInf(float64(scores[firstRow]), -1) || !s.canGrow(seqs, firstRow) {
+				finish(example)
+				continue
+			}
+			if len(finished[example]) >= numBeams {
+				// Done if the best active beam can't improve on the finished hypotheses.
+				slices.SortFunc(finished[example], compareHypotheses)
+				worstScore := finished[example][numBeams-1].score
+				generatedLen := len(seqs.tokens[firstRow]) - seqs.promptLens[firstRow]
+				if gen.normalizedScore(float64(scores[firstRow]), generatedLen) <= worstScore {
+					done[example] = true
+					numDone++
+				}
+			}
+		}
+		if numDone == batchSize {
+			break
+		}
+	}
+	for example := range batchSize {
+		if !done[example] {
+			finish(example)
+		}
+	}
+
+	outputs := make([][]int, batchSize)
+	for example := range batchSize {
+		slices.SortStableFunc(finished[example], compareHypotheses)
+		if len(finished[example]) > 0 {
+			outputs[example] = finished[example][0].tokens
+		} else {
+			outputs[example] = []int{}
+		}
+	}
+	return outputs
+}
+
+// compareHypotheses sorts by decreasing score.
+func compareHypotheses(a, b hypothesis) int {
+	switch {
+	case a.score > b.score:
+		return -1
+	case a.score < b.score:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// reorderKVCache reorders the rows of the KV cache variables according to the parents of the new beams.
+func (gen *Generator) reorderKVCache(parents []int32) {
+	isIdentity := true
+	for ii, parent := range parents {
+		if int(parent) != ii {
+			isIdentity = false
+			break
+		}
+	}
+	if isIdentity {
+		return
+	}
+	if gen.reorderExec == nil {
+		gen.reorderExec = context.MustNewExec(gen.backend, gen.ctx.Reuse(), func(ctx *context.Context, parents *Node) {
+			indices := InsertAxes(parents, -1)
+			for v := range ctx.IterVariablesInScope() {
+				if strings.HasSuffix(v.Scope(), context.ScopeSeparator+layers.KVCacheScope) {
+					v.SetValueGraph(Gather(v.ValueGraph(parents.Graph()), indices))
+				}
+			}
+		})
+	}
+	gen.reorderExec.MustExec(parents)
+}
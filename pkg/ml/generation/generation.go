@@ -0,0 +1,449 @@
+// Package generation implements autoregressive generation of sequences (e.g.: text) from decoder (causal) models,
+// with greedy decoding, sampling (with temperature, top-k and nucleus/top-p filtering) and beam search.
+//
+// The model is given as a ModelFn, which is executed on a fixed-size buffer with the whole sequences at each step, or
+// as an IncrementalModelFn, which uses a KV cache (see layers.MultiHeadAttentionBuilder.UseKVCache and
+// transformer.Config.WithKVCache) to process only the new tokens at each step. In both cases, the
+// computation graphs are compiled only once (per batch size), and the selection of the next tokens is done
+// in the graph, using the context random number generator for sampling.
+//
+// E.g.: sampling from a decoder-only language model:
+//
+//	gen := generation.New(backend, ctx, func(ctx *context.Context, tokens, mask *Node) *Node {
+//		return LanguageModel(ctx, tokens, mask)  // Returns logits shaped [batch_size, seq_len, vocab_size].
+//	}).
+//		MaxLength(256).
+//		Temperature(0.8).TopP(0.95).
+//		StopTokens(eosToken)
+//	outputs, err := gen.Generate([][]int{prompt1, prompt2})
+package generation
+
+import (
+	"math"
+	"slices"
+
+	"github.com/gomlx/gomlx/backends"
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/pkg/errors"
+)
+
+// ModelFn is a causal (decoder) model graph building function used for generation: it takes the tokens shaped
+// `[batch_size, seq_len]` (Int32), and a mask shaped `[batch_size, seq_len]` (Bool), set to false for the padding
+// positions, and returns the logits for the next token at each position, shaped `[batch_size, seq_len, vocab_size]`.
+//
+// The logits at a position must only depend on the tokens up to that position (causality).
+type ModelFn func(ctx *context.Context, tokens, mask *Node) (logits *Node)
+
+// IncrementalModelFn is like ModelFn, but it uses a KV cache (see layers.MultiHeadAttentionBuilder.UseKVCache
+// and transformer.Config.WithKVCache), and only the new tokens are given at each step.
+//
+// The position is a scalar Int32 with the position in the sequence (and in the cache) of the first of the given tokens.
+// The mask is only set to false for the padding of the prompts, which are left-padded, and it must be stored in
+// the cache as well.
+type IncrementalModelFn func(ctx *context.Context, tokens, mask, position *Node) (logits *Node)
+
+// Generator generates sequences from prompts, using a decoder model. Create it with New or NewIncremental,
+// configure it with its methods, and call Generate.
+//
+// The computation graphs are created and compiled on the first call to Generate (and for each new batch size),
+// and reused afterward. Changing the configuration resets them.
+type Generator struct {
+	backend       backends.Backend
+	ctx           *context.Context
+	modelFn       ModelFn
+	incrementalFn IncrementalModelFn
+
+	maxLength         int
+	padToken          int
+	stopTokens        []int
+	sampling          bool
+	temperature       float64
+	topK              int
+	topP              float64
+	repetitionPenalty float64
+	numBeams          int
+	lengthPenalty     float64
+
+	// Compiled graphs and the number of rows (batch_size * numBeams) they were created for.
+	stepExec, reorderExec *context.Exec
+	numRows               int
+}
+
+// New creates a Generator for the model given by modelFn, executed with the variables in ctx.
+//
+// At each step, the model is executed with the whole sequences, right-padded to MaxLength, so the graph
+// is compiled only once. See NewIncremental for a model that uses a KV cache, which is faster for long sequences.
+//
+// The default is greedy decoding, with MaxLength of 128.
+func New(backend backends.Backend, ctx *context.Context, modelFn ModelFn) *Generator {
+	gen := newGenerator(backend, ctx)
+	gen.modelFn = modelFn
+	return gen
+}
+
+// NewIncremental creates a Generator for the model given by incrementalFn, executed with the variables in ctx.
+//
+// The prompts are left-padded to the same length and processed at once (the "prefill"), and afterward only one new
+// token per sequence is processed at each step, at increasing positions. Each distinct length of the (padded) prompts
+// requires a compilation of the prefill graph, the steps use always the same graph.
+//
+// The KV cache variables are reset (with layers.ResetKVCache) whenever the batch size changes.
+//
+// The default is greedy decoding, with MaxLength of 128.
+func NewIncremental(backend backends.Backend, ctx *context.Context, incrementalFn IncrementalModelFn) *Generator {
+	gen := newGenerator(backend, ctx)
+	gen.incrementalFn = incrementalFn
+	return gen
+}
+
+func newGenerator(backend backends.Backend, ctx *context.Context) *Generator {
+	return &Generator{
+		backend:           backend,
+		ctx:               ctx,
+		maxLength:         128,
+		temperature:       1.0,
+		topP:              1.0,
+		repetitionPenalty: 1.0,
+		numBeams:          1,
+		lengthPenalty:     1.0,
+	}
+}
+
+// reset the compiled graphs, after a configuration change.
+func (gen *Generator) reset() {
+	if gen.stepExec != nil {
+		gen.stepExec.Finalize()
+		gen.stepExec = nil
+	}
+	if gen.reorderExec != nil {
+		gen.reorderExec.Finalize()
+		gen.reorderExec = nil
+	}
+	gen.numRows = 0
+}
+
+// MaxLength sets the maximum length of the generated sequences, including the prompt.
+// For NewIncremental, it is also the size of the KV cache, and the prompts are left-padded to the longest one.
+//
+// The default is 128.
+func (gen *Generator) MaxLength(maxLength int) *Generator {
+	if maxLength < 2 {
+		Panicf("generation: MaxLength must be >= 2, got %d", maxLength)
+	}
+	gen.maxLength = maxLength
+	gen.reset()
+	return gen
+}
+
+// PadToken sets the token used for padding. The padding positions are also masked, so it usually doesn't matter.
+//
+// The default is 0.
+func (gen *Generator) PadToken(padToken int) *Generator {
+	gen.padToken = padToken
+	gen.reset()
+	return gen
+}
+
+// StopTokens sets the tokens (e.g.: end-of-sequence) that end the generation of a sequence.
+// The stop token is not included in the generated sequence.
+func (gen *Generator) StopTokens(stopTokens ...int) *Generator {
+	gen.stopTokens = slices.Clone(stopTokens)
+	return gen
+}
+
+// Greedy sets the generation to select at each step the token with the highest logit.
+// This is the default.
+func (gen *Generator) Greedy() *Generator {
+	gen.sampling = false
+	gen.numBeams = 1
+	gen.reset()
+	return gen
+}
+
+// Temperature sets the generation to sample the next token from the distribution given by the logits divided by the
+// temperature: higher temperatures (> 1) make the distribution flatter (more random), lower temperatures make it
+// sharper (closer to Greedy).
+func (gen *Generator) Temperature(temperature float64) *Generator {
+	if temperature <= 0 {
+		Panicf("generation: Temperature must be > 0, got %g -- use Greedy instead", temperature)
+	}
+	gen.setSampling()
+	gen.temperature = temperature
+	return gen
+}
+
+// TopK sets the generation to sample the next token from only the k most likely tokens.
+// Tokens with the same probability as the k-th token are also kept. Set to 0 to disable it.
+//
+// It can be combined with Temperature and TopP.
+func (gen *Generator) TopK(k int) *Generator {
+	if k < 0 {
+		Panicf("generation: TopK must be >= 0, got %d", k)
+	}
+	gen.setSampling()
+	gen.topK = k
+	return gen
+}
+
+// TopP sets the generation to sample the next token from the smallest set of most likely tokens whose cumulative
+// probability is >= p (nucleus sampling), as described in "The Curious Case of Neural Text Degeneration",
+// https://arxiv.org/abs/1904.09751. Set to 1.0 to disable it.
+//
+// It can be combined with Temperature and TopK.
+func (gen *Generator) TopP(p float64) *Generator {
+	if p <= 0 || p > 1 {
+		Panicf("generation: TopP must be in the range (0, 1], got %g", p)
+	}
+	gen.setSampling()
+	gen.topP = p
+	return gen
+}
+
+func (gen *Generator) setSampling() {
+	gen.sampling = true
+	gen.numBeams = 1
+	gen.reset()
+}
+
+// BeamSearch sets the generation to use beam search with numBeams beams: at each step, the numBeams
+// most likely sequences (by the sum of the log-probabilities of their tokens) are kept, and the most likely finished
+// sequence is returned, with the scores normalized by the length (see LengthPenalty).
+//
+// The repetition penalty is applied, but not the sampling options (Temperature, TopK, TopP).
+func (gen *Generator) BeamSearch(numBeams int) *Generator {
+	if numBeams < 1 {
+		Panicf("generation: BeamSearch numBeams must be >= 1, got %d", numBeams)
+	}
+	gen.sampling = false
+	gen.numBeams = numBeams
+	gen.reset()
+	return gen
+}
+
+// LengthPenalty sets the exponent of the length used to normalize the scores of the finished sequences in beam search:
+// the score is divided by `generated_length^lengthPenalty`. Values > 0 favor longer sequences, and 0 disables the
+// normalization.
+//
+// The default is 1.0.
+func (gen *Generator) LengthPenalty(lengthPenalty float64) *Generator {
+	gen.lengthPenalty = lengthPenalty
+	return gen
+}
+
+// RepetitionPenalty penalizes the tokens already in the sequence (including the prompt), as described in
+// "CTRL: A Conditional Transformer Language Model for Controllable Generation", https://arxiv.org/abs/1909.05858:
+// their positive logits are divided by the penalty, and the negative logits multiplied.
+//
+// The default is 1.0, which disables it.
+func (gen *Generator) RepetitionPenalty(penalty float64) *Generator {
+	if penalty <= 0 {
+		Panicf("generation: RepetitionPenalty must be > 0, got %g", penalty)
+	}
+	gen.repetitionPenalty = penalty
+	gen.reset()
+	return gen
+}
+
+// Generate sequences for each of the prompts, which can have different lengths.
+//
+// It returns the generated tokens for each prompt (not including the prompt), up to the first stop token
+// (not included) or MaxLength.
+func (gen *Generator) Generate(prompts [][]int) (outputs [][]int, err error) {
+	if len(prompts) == 0 {
+		return nil, nil
+	}
+	for ii, prompt := range prompts {
+		if len(prompt) == 0 || len(prompt) >= gen.maxLength {
+			return nil, errors.Errorf("generation: prompt #%d has length %d, it must be > 0 and < MaxLength=%d",
+				ii, len(prompt), gen.maxLength)
+		}
+	}
+	err = TryCatch[error](func() {
+		if err := gen.compile(len(prompts) * gen.numBeams); err != nil {
+			panic(err)
+		}
+		if gen.numBeams > 1 {
+			outputs = gen.beamSearch(prompts)
+		} else {
+			outputs = gen.generate(prompts)
+		}
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "generation failed")
+	}
+	return
+}
+
+// compile creates the execs for the given number of rows, if not yet created.
+func (gen *Generator) compile(numRows int) error {
+	if gen.stepExec != nil && gen.numRows == numRows {
+		return nil
+	}
+	gen.reset()
+	if gen.incrementalFn != nil {
+		layers.ResetKVCache(gen.ctx)
+	}
+	var err error
+	gen.stepExec, err = context.NewExec(gen.backend, gen.ctx.Reuse(), gen.stepGraph)
+	if err != nil {
+		return err
+	}
+	gen.stepExec.SetMaxCache(-1)
+	gen.numRows = numRows
+	return nil
+}
+
+// sequences holds the host-side state of the sequences being generated, one per row.
+type sequences struct {
+	tokens     [][]int
+	promptLens []int
+}
+
+// historyTensors returns the sequences right-padded to maxLength, and their lengths.
+func (gen *Generator) historyTensors(seqs *sequences) (history, lengths *tensors.Tensor) {
+	numRows := len(seqs.tokens)
+	flat := make([]int32, numRows*gen.maxLength)
+	lengthsValues := make([]int32, numRows)
+	for row, tokens := range seqs.tokens {
+		rowFlat := flat[row*gen.maxLength : (row+1)*gen.maxLength]
+		for ii := range rowFlat {
+			if ii < len(tokens) {
+				rowFlat[ii] = int32(tokens[ii])
+			} else {
+				rowFlat[ii] = int32(gen.padToken)
+			}
+		}
+		lengthsValues[row] = int32(len(tokens))
+	}
+	return tensors.FromFlatDataAndDimensions(flat, numRows, gen.maxLength), tensors.FromValue(lengthsValues)
+}
+
+// stepper executes one step of the generation, returning the outputs of the step graph.
+// It abstracts the differences between the full and the incremental models.
+type stepper struct {
+	gen      *Generator
+	position int // Only used by incremental models, the position in the cache of the next tokens.
+}
+
+// newStepper prepares the execution of the steps.
+func (gen *Generator) newStepper() *stepper {
+	return &stepper{gen: gen}
+}
+
+// maxSteps returns the maximum number of steps that can be executed for the sequences.
+func (s *stepper) maxSteps(seqs *sequences) int {
+	gen := s.gen
+	if gen.incrementalFn != nil {
+		return gen.maxLength - slices.Max(seqs.promptLens)
+	}
+	return gen.maxLength - slices.Min(seqs.promptLens)
+}
+
+// canGrow returns whether the sequence in row can grow by one more token.
+func (s *stepper) canGrow(seqs *sequences, row int) bool {
+	gen := s.gen
+	if gen.incrementalFn != nil {
+		return len(seqs.tokens[row])-seqs.promptLens[row]+slices.Max(seqs.promptLens) < gen.maxLength
+	}
+	return len(seqs.tokens[row]) < gen.maxLength
+}
+
+// step executes one step, with extra inputs (beam scores) appended.
+func (s *stepper) step(seqs *sequences, extraInputs ...any) []*tensors.Tensor {
+	gen := s.gen
+	history, lengths := gen.historyTensors(seqs)
+	var inputs []any
+	if gen.incrementalFn == nil {
+		inputs = []any{history, lengths}
+	} else {
+		stepTokens, stepMask := s.incrementalInputs(seqs)
+		inputs = []any{stepTokens, stepMask, int32(s.position), history, lengths}
+		s.position += stepTokens.Shape().Dim(1)
+	}
+	inputs = append(inputs, extraInputs...)
+	return gen.stepExec.MustExec(inputs...)
+}
+
+// incrementalInputs returns the tokens to feed to an incremental model: the left-padded prompts on the first step
+// (position 0), and the last token of each sequence afterward.
+func (s *stepper) incrementalInputs(seqs *sequences) (tokens, mask *tensors.Tensor) {
+	numRows := len(seqs.tokens)
+	if s.position > 0 {
+		tokensValues := make([]int32, numRows)
+		maskValues := make([]bool, numRows)
+		for row, rowTokens := range seqs.tokens {
+			tokensValues[row] = int32(rowTokens[len(rowTokens)-1])
+			maskValues[row] = true
+		}
+		return tensors.FromFlatDataAndDimensions(tokensValues, numRows, 1),
+			tensors.FromFlatDataAndDimensions(maskValues, numRows, 1)
+	}
+	seqLen := slices.Max(seqs.promptLens)
+	tokensValues := make([]int32, numRows*seqLen)
+	maskValues := make([]bool, numRows*seqLen)
+	for row, rowTokens := range seqs.tokens {
+		padding := seqLen - len(rowTokens)
+		for ii := range seqLen {
+			idx := row*seqLen + ii
+			if ii < padding {
+				tokensValues[idx] = int32(s.gen.padToken)
+			} else {
+				tokensValues[idx] = int32(rowTokens[ii-padding])
+				maskValues[idx] = true
+			}
+		}
+	}
+	return tensors.FromFlatDataAndDimensions(tokensValues, numRows, seqLen),
+		tensors.FromFlatDataAndDimensions(maskValues, numRows, seqLen)
+}
+
+// generate implements greedy decoding and sampling.
+func (gen *Generator) generate(prompts [][]int) [][]int {
+	seqs := &sequences{tokens: make([][]int, len(prompts)), promptLens: make([]int, len(prompts))}
+	for ii, prompt := range prompts {
+		seqs.tokens[ii] = slices.Clone(prompt)
+		seqs.promptLens[ii] = len(prompt)
+	}
+	done := make([]bool, len(prompts))
+	numDone := 0
+	s := gen.newStepper()
+	for range s.maxSteps(seqs) {
+		outputs := s.step(seqs)
+		nextTokens := tensors.CopyFlatData[int32](outputs[0])
+		for row, token := range nextTokens {
+			if done[row] {
+				continue
+			}
+			if slices.Contains(gen.stopTokens, int(token)) {
+				done[row] = true
+				numDone++
+				continue
+			}
+			seqs.tokens[row] = append(seqs.tokens[row], int(token))
+			if !s.canGrow(seqs, row) {
+				done[row] = true
+				numDone++
+			}
+		}
+		if numDone == len(prompts) {
+			break
+		}
+	}
+	outputs := make([][]int, len(prompts))
+	for row := range outputs {
+		outputs[row] = seqs.tokens[row][seqs.promptLens[row]:]
+	}
+	return outputs
+}
+
+// normalizedScore returns the score of a finished beam search hypothesis with the given number of generated tokens.
+func (gen *Generator) normalizedScore(score float64, length int) float64 {
+	if gen.lengthPenalty == 0 {
+		return score
+	}
+	return score / math.Pow(float64(max(length, 1)), gen.lengthPenalty)
+}
@@ -0,0 +1,237 @@
+package generation
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/transformer"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+// bigramModel returns a ModelFn whose logits for the next token are the log of the probabilities in the
+// table, indexed by the current token.
+func bigramModel(probabilities [][]float64) ModelFn {
+	logTable := make([][]float32, len(probabilities))
+	for ii, row := range probabilities {
+		logTable[ii] = make([]float32, len(row))
+		for jj, p := range row {
+			logTable[ii][jj] = float32(math.Log(max(p, 1e-9)))
+		}
+	}
+	return func(ctx *context.Context, tokens, mask *Node) *Node {
+		return Gather(Const(tokens.Graph(), logTable), InsertAxes(tokens, -1))
+	}
+}
+
+const stopToken = 4
+
+func TestGreedy(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	// Chain: i -> i+1, up to the stop token.
+	chain := [][]float64{
+		{0.1, 0.7, 0.1, 0.05, 0.05},
+		{0.1, 0.1, 0.6, 0.1, 0.1},
+		{0.1, 0.1, 0.1, 0.6, 0.1},
+		{0.1, 0.1, 0.1, 0.1, 0.6},
+		{0.6, 0.1, 0.1, 0.1, 0.1},
+	}
+	gen := New(backend, ctx, bigramModel(chain)).MaxLength(6).StopTokens(stopToken)
+	outputs, err := gen.Generate([][]int{{0}, {1, 2}, {3, 0}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 3}, {3}, {1, 2, 3}}, outputs)
+
+	// Without stop tokens it goes up to MaxLength.
+	gen.StopTokens()
+	outputs, err = gen.Generate([][]int{{0}, {1, 2}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 3, 4, 0}, {3, 4, 0, 1}}, outputs)
+
+	// Sampling restricted to the top-1 token, or to a small nucleus, is the same as greedy.
+	gen.StopTokens(stopToken).TopK(1)
+	outputs, err = gen.Generate([][]int{{0}, {1, 2}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 3}, {3}}, outputs)
+	gen.TopK(0).TopP(0.3)
+	outputs, err = gen.Generate([][]int{{0}, {1, 2}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 3}, {3}}, outputs)
+
+	// Invalid prompts.
+	_, err = gen.Generate([][]int{{}})
+	require.Error(t, err)
+	_, err = gen.Generate([][]int{{0, 1, 2, 3, 0, 1}})
+	require.Error(t, err)
+}
+
+func TestRepetitionPenalty(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	probabilities := [][]float64{
+		{0.5, 0.3, 0.2, 0.0, 0.0},
+		{0.2, 0.5, 0.3, 0.0, 0.0},
+		{0.3, 0.2, 0.5, 0.0, 0.0},
+	}
+	gen := New(backend, ctx, bigramModel(probabilities)).MaxLength(4)
+	outputs, err := gen.Generate([][]int{{0}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{0, 0, 0}}, outputs)
+
+	// With a penalty of 2, log(0.5)*2 < log(0.3), so it avoids repeating tokens, until all are penalized.
+	gen.RepetitionPenalty(2)
+	outputs, err = gen.Generate([][]int{{0}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 2}}, outputs)
+}
+
+func TestSampling(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.RngStateFromSeed(42)
+	probabilities := [][]float64{
+		{0.0, 0.7, 0.2, 0.1, 0.0},
+		{0.0, 0.7, 0.2, 0.1, 0.0},
+		{0.0, 0.7, 0.2, 0.1, 0.0},
+		{0.0, 0.7, 0.2, 0.1, 0.0},
+	}
+	const numSamples = 400
+	prompts := make([][]int, numSamples)
+	for ii := range prompts {
+		prompts[ii] = []int{0}
+	}
+	count := func(outputs [][]int) []int {
+		counts := make([]int, 5)
+		for _, output := range outputs {
+			require.Len(t, output, 1)
+			counts[output[0]]++
+		}
+		return counts
+	}
+
+	gen := New(backend, ctx, bigramModel(probabilities)).MaxLength(2).Temperature(1.0)
+	outputs, err := gen.Generate(prompts)
+	require.NoError(t, err)
+	counts := count(outputs)
+	assert.InDelta(t, 0.7*numSamples, counts[1], 0.1*numSamples)
+	assert.InDelta(t, 0.2*numSamples, counts[2], 0.1*numSamples)
+	assert.InDelta(t, 0.1*numSamples, counts[3], 0.1*numSamples)
+	assert.Zero(t, counts[0]+counts[4])
+
+	// The next call uses a different random state.
+	outputs2, err := gen.Generate(prompts)
+	require.NoError(t, err)
+	assert.NotEqual(t, outputs, outputs2)
+
+	// Top-k = 2 removes token 3: 1 and 2 are sampled with probabilities 7/9 and 2/9.
+	gen.TopK(2)
+	counts = count(must(gen.Generate(prompts)))
+	assert.Zero(t, counts[3])
+	assert.InDelta(t, 2.0/9.0*numSamples, counts[2], 0.1*numSamples)
+
+	// Top-p = 0.8: keeps tokens 1 and 2 only.
+	gen.TopK(0).TopP(0.8)
+	counts = count(must(gen.Generate(prompts)))
+	assert.Zero(t, counts[3])
+	assert.Greater(t, counts[2], 0)
+
+	// Low temperature is almost greedy.
+	gen.TopP(1).Temperature(0.05)
+	counts = count(must(gen.Generate(prompts)))
+	assert.Equal(t, numSamples, counts[1])
+}
+
+func must[T any](value T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func TestBeamSearch(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	probabilities := [][]float64{
+		{0.0, 0.6, 0.4, 0.0, 0.0},
+		{0.34, 0.33, 0.0, 0.33, 0.0},
+		{0.0, 0.0, 0.0, 0.1, 0.9},
+		{0.0, 0.0, 0.0, 0.0, 1.0},
+	}
+	gen := New(backend, ctx, bigramModel(probabilities)).MaxLength(6).StopTokens(stopToken)
+	// Greedy is trapped in the loop of 0 and 1.
+	outputs, err := gen.Generate([][]int{{0}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 0, 1, 0, 1}}, outputs)
+
+	// Beam search finds the most likely sequence: 0 -> 2 -> stop.
+	gen.BeamSearch(2)
+	outputs, err = gen.Generate([][]int{{0}, {3, 1}, {1, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, outputs[0])
+	assert.Equal(t, []int{}, outputs[2])
+}
+
+// languageModel is a small randomly initialized transformer language model, used to compare the full and incremental
+// generations.
+func languageModel(ctx *context.Context, tokens, mask, position *Node, maxLength int) *Node {
+	const vocabSize, modelDim = 7, 16
+	cfg := transformer.New(ctx).NumLayers(2).NumHeads(4).NumKVHeads(2).PositionEncoding(transformer.PositionRoPE)
+	if position != nil {
+		cfg = cfg.WithKVCache(maxLength, position)
+	}
+	x := layers.Embedding(ctx.In("embeddings"), InsertAxes(tokens, -1), dtypes.Float32, vocabSize, modelDim)
+	x = cfg.Decoder(ctx.In("decoder"), x, mask, nil, nil)
+	return MulScalar(layers.Dense(ctx.In("logits"), x, true, vocabSize), 5)
+}
+
+func TestIncremental(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	const maxLength = 10
+	_ = context.MustExecOnce(backend, ctx, func(ctx *context.Context, tokens, mask *Node) *Node {
+		return languageModel(ctx, tokens, mask, nil, maxLength)
+	}, [][]int32{{1, 2}}, [][]bool{{true, true}})
+
+	full := New(backend, ctx, func(ctx *context.Context, tokens, mask *Node) *Node {
+		return languageModel(ctx, tokens, mask, nil, maxLength)
+	}).MaxLength(maxLength)
+	incremental := NewIncremental(backend, ctx, func(ctx *context.Context, tokens, mask, position *Node) *Node {
+		return languageModel(ctx, tokens, mask, position, maxLength)
+	}).MaxLength(maxLength)
+
+	// Incremental generation uses left padding, so the sequences are limited by the longest prompt.
+	prompts := [][]int{{1, 2, 3}, {4, 5, 6}}
+	want, err := full.Generate(prompts)
+	require.NoError(t, err)
+	require.Len(t, want[0], maxLength-3)
+	got, err := incremental.Generate(prompts)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// Prompts of different lengths: the shorter prompt is left-padded and masked in the incremental generation.
+	prompts = [][]int{{1, 2}, {4, 5, 6}}
+	want, err = full.Generate(prompts)
+	require.NoError(t, err)
+	got, err = incremental.Generate(prompts)
+	require.NoError(t, err)
+	require.Len(t, got[0], maxLength-3)
+	assert.Equal(t, want[0][:maxLength-3], got[0])
+	assert.Equal(t, want[1], got[1])
+
+	// Beam search reorders the KV cache.
+	prompts = [][]int{{1, 2, 3}, {4, 5, 6}}
+	full.BeamSearch(3)
+	incremental.BeamSearch(3)
+	want, err = full.Generate(prompts)
+	require.NoError(t, err)
+	got, err = incremental.Generate(prompts)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,179 @@
+package generation
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// bisectionSteps is the number of steps used to find the probability thresholds of top-k and top-p filtering.
+const bisectionSteps = 32
+
+// stepGraph builds the graph of one generation step: it executes the model, and selects the next token for each
+// sequence -- or, for beam search, the candidates for the next beams.
+//
+// The inputs are:
+//
+//   - For ModelFn: history `[num_rows, max_length]` and lengths `[num_rows]`.
+//   - For IncrementalModelFn: tokens `[num_rows, seq_len]`, mask `[num_rows, seq_len]`, position (scalar),
+//     history `[num_rows, max_length]` and lengths `[num_rows]`.
+//   - For beam search only, the scores of the current beams `[num_rows]` are appended.
+//
+// The history holds the right-padded sequences generated so far (including the prompts), and lengths their lengths.
+//
+// It returns the next tokens `[num_rows]` for greedy decoding and sampling, or the candidates scores, parent beams and
+// tokens, all shaped `[batch_size, num_candidates]`, for beam search.
+func (gen *Generator) stepGraph(ctx *context.Context, inputs []*Node) []*Node {
+	var logits, history, lengths *Node
+	if gen.incrementalFn == nil {
+		history, lengths = inputs[0], inputs[1]
+		inputs = inputs[2:]
+		g := history.Graph()
+		numRows, maxLength := history.Shape().Dim(0), history.Shape().Dim(1)
+		mask := LessThan(
+			Iota(g, shapes.Make(dtypes.Int32, numRows, maxLength), 1),
+			BroadcastToDims(InsertAxes(lengths, -1), numRows, maxLength))
+		allLogits := gen.modelFn(ctx, history, mask)
+		checkLogits(allLogits, numRows, maxLength)
+
+		// Gather the logits of the last token of each sequence.
+		lastIndices := Stack([]*Node{Iota(g, shapes.Make(dtypes.Int32, numRows), 0), AddScalar(lengths, -1)}, -1)
+		logits = Gather(allLogits, lastIndices)
+	} else {
+		tokens, mask, position := inputs[0], inputs[1], inputs[2]
+		history, lengths = inputs[3], inputs[4]
+		inputs = inputs[5:]
+		allLogits := gen.incrementalFn(ctx, tokens, mask, position)
+		checkLogits(allLogits, tokens.Shape().Dim(0), tokens.Shape().Dim(1))
+
+		// Prompts are left-padded, so the last token is always the last position.
+		logits = Squeeze(Slice(allLogits, AxisRange(), AxisElem(-1)), 1)
+	}
+	logits = ConvertDType(logits, dtypes.Float32)
+	logits = gen.applyRepetitionPenalty(logits, history, lengths)
+
+	if gen.numBeams > 1 {
+		scores := inputs[0]
+		candidateScores, candidateParents, candidateTokens := gen.beamCandidates(logits, scores)
+		return []*Node{candidateScores, candidateParents, candidateTokens}
+	}
+	if !gen.sampling {
+		return []*Node{ArgMax(logits, -1, dtypes.Int32)}
+	}
+	return []*Node{gen.sample(ctx, logits)}
+}
+
+// checkLogits validates the shape of the logits returned by the model.
+func checkLogits(logits *Node, numRows, seqLen int) {
+	if logits.Rank() != 3 || logits.Shape().Dim(0) != numRows || logits.Shape().Dim(1) != seqLen ||
+		!logits.DType().IsFloat() {
+		Panicf("generation: the model must return float logits shaped [batch_size=%d, seq_len=%d, vocab_size], got %s",
+			numRows, seqLen, logits.Shape())
+	}
+}
+
+// applyRepetitionPenalty to the logits `[num_rows, vocab_size]` of the tokens present in the history.
+func (gen *Generator) applyRepetitionPenalty(logits, history, lengths *Node) *Node {
+	if gen.repetitionPenalty == 1 {
+		return logits
+	}
+	g := logits.Graph()
+	numRows, maxLength := history.Shape().Dim(0), history.Shape().Dim(1)
+	historyShape := shapes.Make(dtypes.Int32, numRows, maxLength)
+	valid := LessThan(Iota(g, historyShape, 1), BroadcastToDims(InsertAxes(lengths, -1), numRows, maxLength))
+	indices := Stack([]*Node{Iota(g, historyShape, 0), ConvertDType(history, dtypes.Int32)}, -1)
+	counts := ScatterSum(ZerosLike(logits), indices, ConvertDType(valid, logits.DType()), false, false)
+	zero := ScalarZero(g, logits.DType())
+	penalized := Where(GreaterThan(logits, zero),
+		DivScalar(logits, gen.repetitionPenalty),
+		MulScalar(logits, gen.repetitionPenalty))
+	return Where(GreaterThan(counts, zero), penalized, logits)
+}
+
+// sample the next tokens from the logits `[num_rows, vocab_size]`, after applying the temperature, and the top-k and
+// top-p filters, using the context random number generator.
+func (gen *Generator) sample(ctx *context.Context, logits *Node) *Node {
+	g := logits.Graph()
+	if gen.temperature != 1 {
+		logits = DivScalar(logits, gen.temperature)
+	}
+	negInf := Infinity(g, logits.DType(), -1)
+	if gen.topK > 0 {
+		k := float64(gen.topK)
+		threshold := probabilityThreshold(Softmax(logits, -1), func(probs, keep *Node) *Node {
+			count := ReduceAndKeep(ConvertDType(keep, probs.DType()), ReduceSum, -1)
+			return GreaterOrEqual(count, Scalar(g, probs.DType(), k))
+		})
+		logits = filterByThreshold(logits, threshold, negInf)
+	}
+	if gen.topP < 1 {
+		threshold := probabilityThreshold(Softmax(logits, -1), func(probs, keep *Node) *Node {
+			mass := ReduceAndKeep(Where(keep, probs, ScalarZero(g, probs.DType())), ReduceSum, -1)
+			return GreaterOrEqual(mass, Scalar(g, probs.DType(), gen.topP))
+		})
+		logits = filterByThreshold(logits, threshold, negInf)
+	}
+
+	// Gumbel-max trick: the argmax of the logits plus Gumbel noise is a sample of the categorical distribution.
+	uniform := ctx.RandomUniform(g, logits.Shape())
+	gumbel := Neg(Log(Neg(Log(uniform))))
+	return ArgMax(Add(logits, gumbel), -1, dtypes.Int32)
+}
+
+// probabilityThreshold returns the largest threshold `[num_rows, 1]`, for each row of probs `[num_rows, vocab_size]`,
+// such that condition(probs, keep) is true, where keep is the mask of the probabilities >= threshold.
+//
+// It is found by bisection, so it's approximate, and condition must be monotonic: if it is true for a threshold,
+// it must be true for any lower threshold. It must also be true for the threshold 0 (keeping all tokens).
+func probabilityThreshold(probs *Node, condition func(probs, keep *Node) *Node) *Node {
+	low := ZerosLike(ReduceAndKeep(probs, ReduceMax, -1))
+	high := ReduceAndKeep(probs, ReduceMax, -1)
+	for range bisectionSteps {
+		mid := MulScalar(Add(low, high), 0.5)
+		ok := condition(probs, GreaterOrEqual(probs, BroadcastToShape(mid, probs.Shape())))
+		low = Where(ok, mid, low)
+		high = Where(ok, high, mid)
+	}
+	return low
+}
+
+// filterByThreshold sets the logits whose probabilities are below the threshold `[num_rows, 1]` to negInf.
+func filterByThreshold(logits, threshold, negInf *Node) *Node {
+	probs := Softmax(logits, -1)
+	keep := GreaterOrEqual(probs, BroadcastToShape(threshold, probs.Shape()))
+	return Where(keep, logits, negInf)
+}
+
+// beamCandidates returns the best 2*numBeams candidates for the next beams of each example, out of the extensions of
+// each of the current beams by each token of the vocabulary. The scores are the sum of the log-probabilities.
+//
+// The logits are shaped `[num_rows, vocab_size]` and the current scores `[num_rows]`, where
+// `num_rows = batch_size * numBeams`. The returned candidates scores, parent beams (in `[0, numBeams)`) and tokens
+// are all shaped `[batch_size, num_candidates]`, sorted by decreasing scores.
+func (gen *Generator) beamCandidates(logits, scores *Node) (candidateScores, candidateParents, candidateTokens *Node) {
+	g := logits.Graph()
+	numRows, vocabSize := logits.Shape().Dim(0), logits.Shape().Dim(1)
+	batchSize := numRows / gen.numBeams
+	logProbs := Add(LogSoftmax(logits, -1), BroadcastToDims(InsertAxes(ConvertDType(scores, logits.DType()), -1),
+		numRows, vocabSize))
+	flat := Reshape(logProbs, batchSize, gen.numBeams*vocabSize)
+	flatIota := Iota(g, shapes.Make(dtypes.Int32, flat.Shape().Dimensions...), 1)
+	negInf := Infinity(g, flat.DType(), -1)
+	numCandidates := min(2*gen.numBeams, gen.numBeams*vocabSize)
+	var allScores, allIndices []*Node
+	for range numCandidates {
+		indices := ArgMax(flat, -1, dtypes.Int32)
+		selected := Equal(flatIota, BroadcastToDims(InsertAxes(indices, -1), flat.Shape().Dimensions...))
+		allScores = append(allScores, ReduceMax(Where(selected, flat, negInf), -1))
+		allIndices = append(allIndices, indices)
+		flat = Where(selected, negInf, flat)
+	}
+	candidateScores = Stack(allScores, -1)
+	candidateIndices := Stack(allIndices, -1)
+	vocabSizeNode := Scalar(g, dtypes.Int32, vocabSize)
+	candidateParents = Div(candidateIndices, vocabSizeNode)
+	candidateTokens = Mod(candidateIndices, vocabSizeNode)
+	return
+}
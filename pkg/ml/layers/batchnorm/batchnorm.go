@@ -196,6 +196,8 @@ func (builder *Config) Done() *Node {
 		builder.ctx = builder.ctx.In("batch_normalization")
 	}
 	ctx := builder.ctx
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 
 	featureAxis := AdjustAxisToOperandRank(x, builder.featureAxis)
 	featureDim := x.Shape().Dimensions[featureAxis]
@@ -22,6 +22,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gomlx/pkg/core/tensors/images"
 	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers/quantization"
 	"github.com/gomlx/gomlx/pkg/ml/layers/regularizers"
 	"github.com/gomlx/gomlx/pkg/support/xslices"
 )
@@ -45,6 +46,12 @@ type ConvBuilder struct {
 	newScope                           bool
 	regularizer                        regularizers.Regularizer
 	channelGroupCount, batchGroupCount int
+
+	// Variations of the convolution: see ConvTranspose, DepthwiseConvolution and SeparableConvolution.
+	transposed, depthwise, separable bool
+	depthMultiplier                  int
+	causal                           bool
+	outputPaddings, outputSizes      []int
 }
 
 // Convolution prepares one convolution on x with the given kernel for an arbitrary
@@ -67,6 +74,8 @@ type ConvBuilder struct {
 //
 // The output rank and order of the output axes are the same as the input's.
 // Their dimensions depend on the configuration options.
+//
+// It supports quantized kernels and quantization-aware training: see package quantization.
 func Convolution(ctx *context.Context, x *Node) *ConvBuilder {
 	conv := &ConvBuilder{
 		ctx:               ctx,
@@ -85,6 +94,58 @@ func Convolution(ctx *context.Context, x *Node) *ConvBuilder {
 	return conv.ChannelsAxis(images.ChannelsLast).NoPadding().UseBias(true).Strides(1)
 }
 
+// ConvTranspose prepares one transposed convolution (also known as "deconvolution") on x, for an arbitrary number
+// of spatial dimensions (1D, 2D, 3D, etc.). It is commonly used to up-sample images, e.g., in the decoder of a U-Net.
+//
+// It returns a ConvBuilder object for configuration, with the same options as Convolution: the strides, paddings
+// and dilations are those of the convolution it is the transpose of. So with Strides(2) the output spatial
+// dimensions are doubled. Additionally, the output size can be controlled with ConvBuilder.OutputPadding or
+// ConvBuilder.OutputSizePerAxis. See graph.ConvolveTranspose for details.
+//
+// The kernel variable ("weights") is shaped `[<kernel_spatial_dimensions...>, output_channels/groups, input_channels]`
+// for images.ChannelsLast (the default, as Keras), or `[input_channels, output_channels/groups, <kernel_spatial_dimensions...>]`
+// for images.ChannelsFirst (as PyTorch).
+//
+// By default, it creates a sub-scope named "conv_transpose".
+func ConvTranspose(ctx *context.Context, x *Node) *ConvBuilder {
+	conv := Convolution(ctx, x)
+	conv.transposed = true
+	return conv
+}
+
+// DepthwiseConvolution prepares one depthwise convolution on x: each input channel is convolved with its own
+// kernels (see ConvBuilder.DepthMultiplier), and the channels are not mixed.
+// It's a convolution with ConvBuilder.ChannelGroupCount set to the number of input channels.
+//
+// It returns a ConvBuilder object for configuration, with the same options as Convolution, except that
+// the number of output channels is not set with ConvBuilder.Channels, but it is given by the number of
+// input channels times the depth multiplier.
+//
+// By default, it creates a sub-scope named "depthwise_conv".
+func DepthwiseConvolution(ctx *context.Context, x *Node) *ConvBuilder {
+	conv := Convolution(ctx, x)
+	conv.depthwise = true
+	conv.depthMultiplier = 1
+	return conv
+}
+
+// SeparableConvolution prepares one depthwise-separable convolution on x: a DepthwiseConvolution
+// (kernel "depthwise_weights") followed by a pointwise (kernel size 1) convolution (kernel "pointwise_weights")
+// that mixes the channels into the number of output channels set with ConvBuilder.Channels.
+// It uses much fewer parameters than a regular convolution, as in MobileNet and Xception.
+//
+// It returns a ConvBuilder object for configuration, with the same options as Convolution: the strides, paddings
+// and dilations are applied to the depthwise convolution, and the bias is added after the pointwise convolution.
+// The regularizer is applied to both kernels.
+//
+// By default, it creates a sub-scope named "separable_conv".
+func SeparableConvolution(ctx *context.Context, x *Node) *ConvBuilder {
+	conv := Convolution(ctx, x)
+	conv.separable = true
+	conv.depthMultiplier = 1
+	return conv
+}
+
 // Channels sets the number of output channels.
 // There is no default, and this number must be set before Done is called.
 func (conv *ConvBuilder) Channels(filters int) *ConvBuilder {
@@ -152,9 +213,12 @@ func (conv *ConvBuilder) ChannelsAxis(channelsAxisConfig images.ChannelsAxisConf
 // PadSame adds paddings on the edges of x such that in the end the output
 // of the convolution has the same shape as the input (assuming strides=1).
 //
+// For ConvTranspose, the output has the shape of the input multiplied by the strides.
+//
 // The default is NoPadding.
 func (conv *ConvBuilder) PadSame() *ConvBuilder {
 	conv.padSame = true
+	conv.causal = false
 	return conv
 }
 
@@ -164,6 +228,78 @@ func (conv *ConvBuilder) PadSame() *ConvBuilder {
 // This is the default.
 func (conv *ConvBuilder) NoPadding() *ConvBuilder {
 	conv.padSame = false
+	conv.causal = false
+	return conv
+}
+
+// CausalPadding pads only the start of the spatial axes, with `dilation * (kernel_size - 1)`, such that
+// the output at position t only depends on the inputs at positions <= t, and (with strides=1) the output has
+// the same shape as the input.
+// It's used for sequence models (e.g., WaveNet, TCN), usually with 1D convolutions.
+//
+// It can't be used with ConvTranspose. The default is NoPadding.
+func (conv *ConvBuilder) CausalPadding() *ConvBuilder {
+	if conv.transposed {
+		Panicf("CausalPadding cannot be used with ConvTranspose")
+	}
+	conv.padSame = false
+	conv.causal = true
+	return conv
+}
+
+// OutputPadding sets extra padding added at the end of every output spatial axis of a ConvTranspose.
+// With strides > 1, different input sizes of a convolution yield the same output size, and the output padding
+// selects which one is generated by the transposed convolution. It must be smaller than the strides.
+//
+// The default is 0. It can only be used with ConvTranspose.
+func (conv *ConvBuilder) OutputPadding(padding int) *ConvBuilder {
+	return conv.OutputPaddingPerAxis(xslices.SliceWithValue(conv.numSpatialDims, padding)...)
+}
+
+// OutputPaddingPerAxis sets extra padding added at the end of each output spatial axis of a ConvTranspose.
+// See OutputPadding.
+//
+// The default is 0 for every axis. It can only be used with ConvTranspose.
+func (conv *ConvBuilder) OutputPaddingPerAxis(paddings ...int) *ConvBuilder {
+	if !conv.transposed {
+		Panicf("OutputPaddingPerAxis can only be used with ConvTranspose")
+	}
+	if len(paddings) != conv.numSpatialDims {
+		Panicf("received %d output paddings in OutputPaddingPerAxis, but x has %d spatial dimensions",
+			len(paddings), conv.numSpatialDims)
+	}
+	conv.outputPaddings = paddings
+	return conv
+}
+
+// OutputSizePerAxis sets the output spatial dimensions of a ConvTranspose: the output padding is calculated
+// accordingly. See OutputPadding.
+//
+// It can only be used with ConvTranspose.
+func (conv *ConvBuilder) OutputSizePerAxis(sizes ...int) *ConvBuilder {
+	if !conv.transposed {
+		Panicf("OutputSizePerAxis can only be used with ConvTranspose")
+	}
+	if len(sizes) != conv.numSpatialDims {
+		Panicf("received %d output sizes in OutputSizePerAxis, but x has %d spatial dimensions",
+			len(sizes), conv.numSpatialDims)
+	}
+	conv.outputSizes = sizes
+	return conv
+}
+
+// DepthMultiplier sets the number of output channels generated for each input channel by a DepthwiseConvolution
+// or by the depthwise part of a SeparableConvolution.
+//
+// The default is 1. It can only be used with DepthwiseConvolution or SeparableConvolution.
+func (conv *ConvBuilder) DepthMultiplier(multiplier int) *ConvBuilder {
+	if !conv.depthwise && !conv.separable {
+		Panicf("DepthMultiplier can only be used with DepthwiseConvolution or SeparableConvolution")
+	}
+	if multiplier < 1 {
+		Panicf("DepthMultiplier must be >= 1, got %d", multiplier)
+	}
+	conv.depthMultiplier = multiplier
 	return conv
 }
 
@@ -249,7 +385,8 @@ func (conv *ConvBuilder) DilationPerDim(dilations ...int) *ConvBuilder {
 // CurrentScope configures the convolution not to create a sub-scope for the kernel weights it needs,
 // and instead use the current one provided in Convolution.
 //
-// By default, Convolution will create a sub-scope named "conv".
+// By default, Convolution will create a sub-scope named "conv" (see ConvTranspose, DepthwiseConvolution and
+// SeparableConvolution for theirs).
 func (conv *ConvBuilder) CurrentScope() *ConvBuilder {
 	conv.newScope = false
 	return conv
@@ -326,17 +463,28 @@ func (conv *ConvBuilder) Done() *Node {
 	// Default is to create a sub-scope for the convolution variables.
 	ctxInScope := conv.ctx
 	if conv.newScope {
-		ctxInScope = ctxInScope.In("conv")
+		scopeName := "conv"
+		switch {
+		case conv.transposed:
+			scopeName = "conv_transpose"
+		case conv.depthwise:
+			scopeName = "depthwise_conv"
+		case conv.separable:
+			scopeName = "separable_conv"
+		}
+		ctxInScope = ctxInScope.In(scopeName)
 	}
+	conv.graph.PushScope(ctxInScope.Scope())
+	defer conv.graph.PopScope()
 
-	if len(conv.kernelSize) == 0 || conv.outputChannels <= 0 {
+	if len(conv.kernelSize) == 0 || (conv.outputChannels <= 0 && !conv.depthwise) {
 		Panicf("layers.Convolution requires Filters and KernelSize to be set")
 	}
 	if conv.numSpatialDims <= 0 {
 		Panicf("invalid x shape %s, can't figure spatial dimensions", conv.x.Shape())
 	}
 
-	// Check only one of strides / dilations are set.
+	// Check only one of strides / dilations are set: transposed convolutions support both.
 	var dilationsSet, stridesSet bool
 	if conv.strides != nil {
 		for _, stride := range conv.strides {
@@ -352,64 +500,143 @@ func (conv *ConvBuilder) Done() *Node {
 			}
 		}
 	}
-	if dilationsSet && stridesSet {
+	if dilationsSet && stridesSet && !conv.transposed {
 		Panicf("both strides (%v) and dilations (%v) are set, but only one can be used at a time",
 			conv.strides, conv.dilations)
 	}
 
-	// Create and apply kernel.
-	xShape := conv.x.Shape()
-	dtype := xShape.DType
-	kernelShape := shapes.Make(dtype)
-	kernelShape.Dimensions = make([]int, 0, conv.numSpatialDims+2)
+	x := quantization.FakeQuantizeInput(ctxInScope, conv.x)
+	xShape := x.Shape()
 	channelsAxis := images.GetChannelsAxis(xShape, conv.channelsAxisConfig)
 	inputChannels := xShape.Dimensions[channelsAxis]
-	if conv.channelsAxisConfig == images.ChannelsFirst {
-		kernelShape.Dimensions = append(kernelShape.Dimensions, conv.outputChannels)
-		kernelShape.Dimensions = append(kernelShape.Dimensions, inputChannels)
-		kernelShape.Dimensions = append(kernelShape.Dimensions, conv.kernelSize...)
-	} else {
-		kernelShape.Dimensions = append(kernelShape.Dimensions, conv.kernelSize...)
-		kernelShape.Dimensions = append(kernelShape.Dimensions, inputChannels)
-		kernelShape.Dimensions = append(kernelShape.Dimensions, conv.outputChannels)
-	}
-	kernelVar := ctxInScope.VariableWithShape("weights", kernelShape)
-	if conv.regularizer != nil {
-		conv.regularizer(ctxInScope, conv.graph, kernelVar)
+	groups := conv.channelGroupCount
+	outputChannels := conv.outputChannels
+	if conv.depthwise || conv.separable {
+		if groups != 1 || conv.batchGroupCount != 1 {
+			Panicf("DepthwiseConvolution and SeparableConvolution cannot be used with ChannelGroupCount (%d) or "+
+				"BatchGroupCount (%d)", groups, conv.batchGroupCount)
+		}
+		groups = inputChannels
+		outputChannels = inputChannels * conv.depthMultiplier
 	}
-	kernel := kernelVar.ValueGraph(conv.graph)
-	convOpts := Convolve(conv.x, kernel).
-		StridePerAxis(conv.strides...).
-		ChannelsAxis(conv.channelsAxisConfig).
-		ChannelGroupCount(conv.channelGroupCount).
-		BatchGroupCount(conv.batchGroupCount)
-	if len(conv.dilations) > 0 {
-		convOpts.DilationPerAxis(conv.dilations...)
+	if inputChannels%groups != 0 || outputChannels%groups != 0 {
+		Panicf("input channels (%d) and output channels (%d) must be divisible by ChannelGroupCount (%d)",
+			inputChannels, outputChannels, groups)
 	}
-	if conv.padSame {
-		convOpts.PadSame()
+
+	var output *Node
+	if conv.transposed {
+		if conv.batchGroupCount != 1 {
+			Panicf("BatchGroupCount (%d) cannot be used with ConvTranspose", conv.batchGroupCount)
+		}
+		kernel := conv.newKernel(ctxInScope, "weights", conv.kernelSize, outputChannels/groups, inputChannels)
+		convOpts := ConvolveTranspose(x, kernel).
+			StridePerAxis(conv.strides...).
+			ChannelsAxis(conv.channelsAxisConfig).
+			ChannelGroupCount(groups)
+		if len(conv.dilations) > 0 {
+			convOpts.DilationPerAxis(conv.dilations...)
+		}
+		if conv.padSame {
+			convOpts.PadSame()
+		} else {
+			convOpts.NoPadding()
+		}
+		if len(conv.outputPaddings) > 0 {
+			convOpts.OutputPaddingPerAxis(conv.outputPaddings...)
+		}
+		if len(conv.outputSizes) > 0 {
+			convOpts.OutputSizePerAxis(conv.outputSizes...)
+		}
+		output = convOpts.Done()
 	} else {
-		convOpts.NoPadding()
+		kernelName := "weights"
+		if conv.separable {
+			kernelName = "depthwise_weights"
+		}
+		kernel := conv.newKernel(ctxInScope, kernelName, conv.kernelSize, inputChannels/groups, outputChannels)
+		convOpts := Convolve(x, kernel).
+			StridePerAxis(conv.strides...).
+			ChannelsAxis(conv.channelsAxisConfig).
+			ChannelGroupCount(groups).
+			BatchGroupCount(conv.batchGroupCount)
+		if len(conv.dilations) > 0 {
+			convOpts.DilationPerAxis(conv.dilations...)
+		}
+		switch {
+		case conv.padSame:
+			convOpts.PadSame()
+		case conv.causal:
+			paddings := make([][2]int, conv.numSpatialDims)
+			for axis, kernelSize := range conv.kernelSize {
+				dilation := 1
+				if len(conv.dilations) > 0 {
+					dilation = conv.dilations[axis]
+				}
+				paddings[axis] = [2]int{dilation * (kernelSize - 1), 0}
+			}
+			convOpts.PaddingPerDim(paddings)
+		default:
+			convOpts.NoPadding()
+		}
+		output = convOpts.Done()
+
+		if conv.separable {
+			// Pointwise convolution, mixing the channels.
+			outputChannels = conv.outputChannels
+			kernel = conv.newKernel(ctxInScope, "pointwise_weights", xslices.SliceWithValue(conv.numSpatialDims, 1),
+				inputChannels*conv.depthMultiplier, outputChannels)
+			output = Convolve(output, kernel).ChannelsAxis(conv.channelsAxisConfig).Done()
+		}
 	}
-	output := convOpts.Done()
 
 	// Create and apply bias.
 	if conv.bias {
-		biasVar := ctxInScope.VariableWithShape("biases", shapes.Make(dtype, conv.outputChannels))
+		biasVar := ctxInScope.VariableWithShape("biases", shapes.Make(xShape.DType, outputChannels))
 		bias := biasVar.ValueGraph(conv.graph)
 		expandedDims := xslices.SliceWithValue(output.Rank(), 1)
 		outputChannelsAxis := images.GetChannelsAxis(output, conv.channelsAxisConfig)
-		expandedDims[outputChannelsAxis] = conv.outputChannels
+		expandedDims[outputChannelsAxis] = outputChannels
 		bias = Reshape(bias, expandedDims...)
 		output = Add(output, bias)
 	}
+	return output
+}
+
+// newKernel creates the kernel variable with the given name, for the given kernel spatial dimensions and the
+// kernel input and output channels axes -- they are ordered according to the channels axis configuration --,
+// and applies the regularizers to it.
+//
+// If the kernel was quantized, it is dequantized instead, and with quantization-aware training it is fake-quantized
+// (see package quantization).
+func (conv *ConvBuilder) newKernel(ctx *context.Context, name string, kernelSize []int, inputChannels, outputChannels int) *Node {
+	kernelShape := shapes.Make(conv.x.DType())
+	kernelShape.Dimensions = make([]int, 0, conv.numSpatialDims+2)
+	if conv.channelsAxisConfig == images.ChannelsFirst {
+		kernelShape.Dimensions = append(kernelShape.Dimensions, outputChannels)
+		kernelShape.Dimensions = append(kernelShape.Dimensions, inputChannels)
+		kernelShape.Dimensions = append(kernelShape.Dimensions, kernelSize...)
+	} else {
+		kernelShape.Dimensions = append(kernelShape.Dimensions, kernelSize...)
+		kernelShape.Dimensions = append(kernelShape.Dimensions, inputChannels)
+		kernelShape.Dimensions = append(kernelShape.Dimensions, outputChannels)
+	}
+	if quantized := quantization.Get(ctx, name); quantized != nil {
+		kernel := quantized.Dequantize(conv.graph, kernelShape.DType)
+		kernel.AssertDims(kernelShape.Dimensions...)
+		return kernel
+	}
+	kernelVar := ctx.VariableWithShape(name, kernelShape)
+	if conv.regularizer != nil {
+		conv.regularizer(ctx, conv.graph, kernelVar)
+	}
 
 	// Add regularization.
-	if l2any, found := ctxInScope.GetParam(ParamL2Regularization); found {
+	if l2any, found := ctx.GetParam(ParamL2Regularization); found {
 		l2 := l2any.(float64)
 		if l2 > 0 {
-			regularizers.L2(l2)(ctxInScope, conv.graph, kernelVar)
+			regularizers.L2(l2)(ctx, conv.graph, kernelVar)
 		}
 	}
-	return output
+	return quantization.FakeQuantizeWeights(ctx, kernelVar.ValueGraph(conv.graph), quantization.ConvChannelAxes(kernelShape.Rank(), conv.channelsAxisConfig, conv.transposed)...)
 }
@@ -46,3 +46,113 @@ func TestConvolution(t *testing.T) {
 		require.NoError(t, gotT.Shape().Check(dtypes.F32, 5, 32, 3, 3, 2))
 	})
 }
+
+func TestConvTranspose(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+
+	t.Run("1D-Strides", func(t *testing.T) {
+		gotT := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+			x := Ones(g, shapes.Make(dtypes.F32, 2, 5, 3))
+			ctx = ctx.In(path.Base(t.Name()))
+			return ConvTranspose(ctx, x).Channels(4).KernelSize(3).Strides(2).OutputPadding(1).Done()
+		})
+		require.NoError(t, gotT.Shape().Check(dtypes.F32, 2, 12, 4))
+		kernel := ctx.In("1D-Strides").In("conv_transpose").GetVariable("weights")
+		require.NotNil(t, kernel)
+		require.NoError(t, kernel.Shape().CheckDims(3, 4, 3))
+	})
+
+	t.Run("2D-PadSame-Groups", func(t *testing.T) {
+		gotT := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+			x := Ones(g, shapes.Make(dtypes.F32, 2, 4, 3, 6))
+			ctx = ctx.In(path.Base(t.Name()))
+			return ConvTranspose(ctx, x).Channels(4).KernelSize(3).Strides(2).PadSame().ChannelGroupCount(2).Done()
+		})
+		require.NoError(t, gotT.Shape().Check(dtypes.F32, 2, 8, 6, 4))
+		kernel := ctx.In("2D-PadSame-Groups").In("conv_transpose").GetVariable("weights")
+		require.NoError(t, kernel.Shape().CheckDims(3, 3, 2, 6))
+	})
+
+	t.Run("3D-ChannelsFirst-OutputSize", func(t *testing.T) {
+		gotT := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+			x := Ones(g, shapes.Make(dtypes.F32, 2, 3, 2, 3, 4))
+			ctx = ctx.In(path.Base(t.Name()))
+			return ConvTranspose(ctx, x).
+				ChannelsAxis(images.ChannelsFirst).
+				Channels(5).
+				KernelSize(2).
+				StridePerAxis(2, 2, 1).
+				OutputSizePerAxis(5, 6, 5).Done()
+		})
+		require.NoError(t, gotT.Shape().Check(dtypes.F32, 2, 5, 5, 6, 5))
+		kernel := ctx.In("3D-ChannelsFirst-OutputSize").In("conv_transpose").GetVariable("weights")
+		require.NoError(t, kernel.Shape().CheckDims(3, 5, 2, 2, 2))
+	})
+
+	// Output padding is only valid for transposed convolutions.
+	require.Panics(t, func() {
+		_ = context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+			x := Ones(g, shapes.Make(dtypes.F32, 2, 5, 3))
+			return Convolution(ctx.In("invalid"), x).Channels(4).KernelSize(3).OutputPadding(1).Done()
+		})
+	})
+}
+
+func TestDepthwiseAndSeparableConvolution(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+
+	gotT := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		x := Ones(g, shapes.Make(dtypes.F32, 2, 8, 8, 3))
+		return DepthwiseConvolution(ctx, x).KernelSize(3).DepthMultiplier(2).PadSame().Done()
+	})
+	require.NoError(t, gotT.Shape().Check(dtypes.F32, 2, 8, 8, 6))
+	require.NoError(t, ctx.In("depthwise_conv").GetVariable("weights").Shape().CheckDims(3, 3, 1, 6))
+	require.NoError(t, ctx.In("depthwise_conv").GetVariable("biases").Shape().CheckDims(6))
+
+	gotT = context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		x := Ones(g, shapes.Make(dtypes.F32, 2, 3, 8, 8))
+		return SeparableConvolution(ctx, x).
+			ChannelsAxis(images.ChannelsFirst).
+			Channels(5).
+			KernelSize(3).
+			DepthMultiplier(2).
+			Strides(2).Done()
+	})
+	require.NoError(t, gotT.Shape().Check(dtypes.F32, 2, 5, 3, 3))
+	require.NoError(t, ctx.In("separable_conv").GetVariable("depthwise_weights").Shape().CheckDims(6, 1, 3, 3))
+	require.NoError(t, ctx.In("separable_conv").GetVariable("pointwise_weights").Shape().CheckDims(5, 6, 1, 1))
+	require.NoError(t, ctx.In("separable_conv").GetVariable("biases").Shape().CheckDims(5))
+}
+
+func TestCausalConvolution(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	const seqLen, changedPos = 7, 4
+	outputs := context.MustExecOnceN(backend, ctx, func(ctx *context.Context, g *Graph) []*Node {
+		// Two examples that differ only from position changedPos onwards.
+		x := Iota(g, shapes.Make(dtypes.F32, 2, seqLen, 2), 1)
+		mask := GreaterOrEqual(Iota(g, shapes.Make(dtypes.Int32, 2, seqLen, 2), 1), Const(g, int32(changedPos)))
+		mask = LogicalAnd(mask, Equal(Iota(g, shapes.Make(dtypes.Int32, 2, seqLen, 2), 0), Const(g, int32(1))))
+		x = Where(mask, AddScalar(x, 100), x)
+		output := Convolution(ctx, x).Channels(3).KernelSize(3).Dilations(2).CausalPadding().Done()
+		// Gradients with respect to the input are also causal.
+		gradX := Gradient(ReduceAllSum(Slice(output, AxisRange(), AxisElem(changedPos-1))), x)[0]
+		return []*Node{output, gradX}
+	})
+	output, gradX := outputs[0], outputs[1]
+	require.NoError(t, output.Shape().CheckDims(2, seqLen, 3))
+	values := output.Value().([][][]float32)
+	for pos := range seqLen {
+		if pos < changedPos {
+			require.Equal(t, values[0][pos], values[1][pos], "position %d", pos)
+		} else {
+			require.NotEqual(t, values[0][pos], values[1][pos], "position %d", pos)
+		}
+	}
+	grads := gradX.Value().([][][]float32)
+	for pos := changedPos; pos < seqLen; pos++ {
+		require.Equal(t, []float32{0, 0}, grads[0][pos], "gradient at position %d", pos)
+	}
+}
@@ -223,6 +223,8 @@ func (c *Config) Done() *Node {
 	ctx := c.ctx
 	x := c.input
 	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	dtype := x.DType()
 
 	var dropoutRatio *Node
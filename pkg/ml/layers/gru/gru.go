@@ -0,0 +1,273 @@
+// Package gru provides a minimal "Gated Recurrent Unit" (GRU) [1] implementation.
+//
+// A GRU is a recurrent neural network similar to the LSTM (see package lstm), with fewer parameters: it merges
+// the cell state and the hidden state, and uses only two gates: an update gate (z) and a reset gate (r).
+//
+// Since GoMLX doesn't implement loops, the size of the graph will be O(N) on the size of the sequence -- each
+// step of the GRU is instantiated as its own graph nodes.
+//
+// It follows the specification of ONNX GRU [2], so ONNX models can be converted, but it's fully differentiable
+// and can be used to train models. See package rnn for stacked and bidirectional compositions of recurrent layers.
+//
+// [1] https://arxiv.org/abs/1406.1078, Cho et al., 2014
+// [2] https://onnx.ai/onnx/operators/onnx__GRU.html
+package gru
+
+import (
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers/lstm"
+)
+
+// GRU holds a GRU configuration. It can be created with New (or NewWithWeights),
+// and once finished to be configured, can be applied to x with Done.
+type GRU struct {
+	ctx                                 *context.Context
+	x                                   *Node
+	xLengths                            *Node
+	initialHiddenState                  *Node
+	direction                           DirectionType
+	batchSize, featuresSize, hiddenSize int
+	linearBeforeReset                   bool
+
+	// Model weights: see NewWithWeights for specification.
+	inputsW, recurrentW, biasesW *Node
+
+	// Activation functions: default to Sigmoid (for the gates) and Tanh (for the candidate hidden state),
+	// for each direction.
+	activations [2][2]ActivationFn
+}
+
+// ActivationFn defines an activation function used by the GRU.
+type ActivationFn = lstm.ActivationFn
+
+// DirectionType defines the direction to run the GRU. It's the same as lstm.DirectionType.
+type DirectionType = lstm.DirectionType
+
+const (
+	DirForward       = lstm.DirForward
+	DirReverse       = lstm.DirReverse
+	DirBidirectional = lstm.DirBidirectional
+)
+
+// New creates a new GRU layer to be configured and then applied to x.
+// x should be shaped [batchSize, sequenceSize, featuresSize].
+//
+// See GRU.Ragged if x is not densely used: a more compact version to padding or masking.
+//
+// Once finished configuring, call GRU.Done and it will return the hidden states of the GRU.
+func New(ctx *context.Context, x *Node, hiddenSize int) *GRU {
+	return &GRU{
+		ctx:          ctx,
+		x:            x,
+		direction:    DirForward,
+		batchSize:    x.Shape().Dim(0),
+		featuresSize: x.Shape().Dim(2),
+		hiddenSize:   hiddenSize,
+		activations: [2][2]ActivationFn{
+			{Sigmoid, Tanh},
+			{Sigmoid, Tanh},
+		},
+	}
+}
+
+// NewWithWeights creates a new GRU layer using the given weights -- as opposed to creating them
+// on-the-fly.
+//
+// Args:
+//   - x: shaped [batchSize, sequenceSize, featuresSize]
+//   - inputsW: shaped [numDirections, 3, hiddenSize, featuresSize], for the update (z), reset (r) and hidden (h) gates.
+//   - recurrentW: shaped [numDirections, 3, hiddenSize, hiddenSize]
+//   - biases: for the inputs and then the recurrent projections, shaped [numDirections, 6, hiddenSize].
+//
+// These are the ONNX weights W, R and B, reshaped. See details in [2]
+func NewWithWeights(x *Node, inputsW, recurrentW, biases *Node) *GRU {
+	l := New(nil, x, inputsW.Shape().Dim(2))
+	l.inputsW = inputsW
+	l.recurrentW = recurrentW
+	l.biasesW = biases
+	if inputsW.Shape().Dim(0) == 2 {
+		l.direction = DirBidirectional
+	}
+	inputsW.AssertDims(l.NumDirections(), 3, l.hiddenSize, l.featuresSize)
+	recurrentW.AssertDims(l.NumDirections(), 3, l.hiddenSize, l.hiddenSize)
+	biases.AssertDims(l.NumDirections(), 6, l.hiddenSize)
+	return l
+}
+
+// Direction configures in which direction to run the GRU: DirForward, DirReverse or both.
+func (l *GRU) Direction(dir DirectionType) *GRU {
+	l.direction = dir
+	return l
+}
+
+// Ragged indicates that x is "ragged" (the sequences are not used to the end), and its lengths are
+// given by sequenceLengths, which must be shaped [batchSize].
+// It is a more compact version of padding.
+//
+// The default is to assume all sequences are dense -- used to the end.
+func (l *GRU) Ragged(sequencesLengths *Node) *GRU {
+	l.xLengths = sequencesLengths
+	return l
+}
+
+// LinearBeforeReset configures whether the reset gate is applied after the recurrent projection of the
+// candidate hidden state (as in cuDNN and PyTorch) -- as opposed to before it (as in the original paper).
+//
+// Default to false, the same as ONNX (attribute "linear_before_reset").
+func (l *GRU) LinearBeforeReset(linearBeforeReset bool) *GRU {
+	l.linearBeforeReset = linearBeforeReset
+	return l
+}
+
+// Activations configures the activation functions for the gates (update and reset) and for the candidate
+// hidden state of the given direction index (0 for forward, 1 for the reverse of DirBidirectional).
+//
+// Default to Sigmoid and Tanh.
+func (l *GRU) Activations(dirIdx int, gatesFn, hiddenFn ActivationFn) *GRU {
+	l.activations[dirIdx] = [2]ActivationFn{gatesFn, hiddenFn}
+	return l
+}
+
+// InitialStates configures the GRU initial hidden state (h_0 in the literature).
+// If not set it defaults to 0.
+//
+// It must be shaped [numDirections, batchSize, hiddenSize].
+//
+// This is useful if concatenating the output of the GRU to another instance of the (same?) GRU.
+// That is, you can feed here the last hidden state returned by GRU.Done of a previous call.
+func (l *GRU) InitialStates(initialHiddenState *Node) *GRU {
+	l.initialHiddenState = initialHiddenState
+	return l
+}
+
+// NumDirections based on the direction information selected.
+// See GRU.Direction to configure the direction.
+func (l *GRU) NumDirections() int {
+	if l.direction == DirBidirectional {
+		return 2
+	}
+	return 1
+}
+
+// Done should be called once the GRU is configured.
+// It will apply the GRU layer to the sequence in X.
+// - allHiddenStates: [sequenceSize, numDirections, batchSize, hiddenSize]
+// - lastHiddenState: [numDirections, batchSize, hiddenSize]
+func (l *GRU) Done() (allHiddenStates, lastHiddenState *Node) {
+	// "Mis en place": everything we need in local variables.
+	ctx := l.ctx
+	x := l.x
+	g := l.x.Graph()
+	if ctx != nil {
+		// ctx is nil if created with NewWithWeights.
+		g.PushScope(ctx.Scope())
+		defer g.PopScope()
+	}
+	dtype := x.DType()
+	numDirections := l.NumDirections()
+	batchSize := l.batchSize
+	sequenceSize := x.Shape().Dim(1)
+	featuresSize := l.featuresSize
+	hiddenSize := l.hiddenSize
+	xLengths := l.xLengths
+	inputsW := l.inputsW
+	recurrentW := l.recurrentW
+	biasesW := l.biasesW
+
+	// If model weights were not given, create them here.
+	if inputsW == nil {
+		inputsW = ctx.VariableWithShape("inputsW", shapes.Make(dtype, numDirections, 3, hiddenSize, featuresSize)).ValueGraph(g)
+		recurrentW = ctx.VariableWithShape("recurrentW", shapes.Make(dtype, numDirections, 3, hiddenSize, hiddenSize)).ValueGraph(g)
+		biasesW = ctx.VariableWithShape("biasesW", shapes.Make(dtype, numDirections, 6, hiddenSize)).ValueGraph(g)
+	}
+
+	// Calculate all linear projections of x.
+	// b->batchSize, s->sequenceSize, f->featuresSize, d->numDirections, n=3, h->hiddenSize.
+	projX := Einsum("bsf,dnhf->dnbsh", x, inputsW)
+	{
+		biasX := Slice(biasesW, AxisRange(), AxisRangeFromStart(3)) // 3 first biases.
+		biasX = ExpandAxes(biasX, 2, 3)                             // Create batchSize and seqLen axes.
+		projX = Add(projX, biasX)
+	}
+
+	// Starting states: h_{i-1} so to say.
+	prevHidden := make([]*Node, numDirections) // One for each direction.
+	for dirIdx := range numDirections {
+		if l.initialHiddenState == nil {
+			prevHidden[dirIdx] = Zeros(g, shapes.Make(dtype, batchSize, hiddenSize))
+		} else {
+			l.initialHiddenState.AssertDims(numDirections, batchSize, hiddenSize)
+			prevHidden[dirIdx] = Squeeze(Slice(l.initialHiddenState, AxisElem(dirIdx)), 0)
+		}
+	}
+
+	// Collect hidden states of each step, to be returned later.
+	seqHiddenStates := make([][]*Node, numDirections)
+	for ii := range numDirections {
+		seqHiddenStates[ii] = make([]*Node, sequenceSize)
+	}
+
+	// Loop over each position of the sequence.
+	for seqIdx := range sequenceSize {
+		// Loop over directions.
+		for dirIdx := range numDirections {
+			seqPos := seqIdx
+			if dirIdx == 1 || l.direction == DirReverse {
+				// DirReverse:
+				seqPos = sequenceSize - 1 - seqIdx
+			}
+			gatesFn, hiddenFn := l.activations[dirIdx][0], l.activations[dirIdx][1]
+
+			// Projection of x for the gate elemIdx: 0 update (z); 1 reset (r); 2 hidden (h).
+			projXFn := func(elemIdx int) *Node {
+				proj := Slice(projX, AxisElem(dirIdx), AxisElem(elemIdx), AxisRange() /*batch*/, AxisElem(seqPos))
+				return Reshape(proj, batchSize, hiddenSize)
+			}
+			// Recurrent projection of state for the gate elemIdx, including its bias.
+			dirRecurrentW := Squeeze(Slice(recurrentW, AxisElem(dirIdx)), 0) // [3, hiddenSize (j), hiddenSize(h)]
+			projStateFn := func(state *Node, elemIdx int) *Node {
+				elemW := Squeeze(Slice(dirRecurrentW, AxisElem(elemIdx)), 0)
+				proj := Einsum("bh,jh->bj", state, elemW)
+				bias := Slice(biasesW, AxisElem(dirIdx), AxisElem(3+elemIdx))
+				return Add(proj, Reshape(bias, 1, hiddenSize))
+			}
+
+			// See [2] for details on the inner values of the GRU cell.
+			zT := gatesFn(Add(projXFn(0), projStateFn(prevHidden[dirIdx], 0))) // Shape [batchSize, hiddenSize]
+			rT := gatesFn(Add(projXFn(1), projStateFn(prevHidden[dirIdx], 1)))
+			var hT *Node
+			if l.linearBeforeReset {
+				hT = hiddenFn(Add(projXFn(2), Mul(rT, projStateFn(prevHidden[dirIdx], 2))))
+			} else {
+				hT = hiddenFn(Add(projXFn(2), projStateFn(Mul(rT, prevHidden[dirIdx]), 2)))
+			}
+			// hiddenState = (1 - z) * h + z * prevHidden
+			hiddenState := Add(hT, Mul(zT, Sub(prevHidden[dirIdx], hT)))
+
+			// Mask results after the sentence end: if position is after the end of the sentence, just
+			// use the prevHidden unchanged -- notice it works in both directions.
+			if l.xLengths != nil {
+				masked := GreaterOrEqual(Scalar(g, xLengths.DType(), seqPos), xLengths)
+				hiddenState = Where(masked, prevHidden[dirIdx], hiddenState)
+			}
+
+			// Save hidden state and move to next.
+			seqHiddenStates[dirIdx][seqPos] = hiddenState
+			prevHidden[dirIdx] = hiddenState
+		}
+	}
+
+	lastHiddenState = Stack(prevHidden, 0)
+	if numDirections == 2 {
+		allHiddenStates = Stack([]*Node{
+			Stack(seqHiddenStates[0], 0),
+			Stack(seqHiddenStates[1], 0)}, 1)
+	} else {
+		// Only one direction to stack.
+		allHiddenStates = Stack(seqHiddenStates[0], 0)
+		allHiddenStates = Reshape(allHiddenStates, sequenceSize, 1, batchSize, hiddenSize)
+	}
+	return
+}
@@ -0,0 +1,171 @@
+package gru
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+// fill returns a nested slice with the given dimensions with deterministic values in (-1, 1).
+func fill(seed float64, dims ...int) any {
+	counter := 0
+	var build func(dims []int) any
+	build = func(dims []int) any {
+		if len(dims) == 1 {
+			values := make([]float64, dims[0])
+			for ii := range values {
+				values[ii] = math.Sin(seed + 0.37*float64(counter))
+				counter++
+			}
+			return values
+		}
+		switch len(dims) {
+		case 2:
+			values := make([][]float64, dims[0])
+			for ii := range values {
+				values[ii] = build(dims[1:]).([]float64)
+			}
+			return values
+		case 3:
+			values := make([][][]float64, dims[0])
+			for ii := range values {
+				values[ii] = build(dims[1:]).([][]float64)
+			}
+			return values
+		default:
+			values := make([][][][]float64, dims[0])
+			for ii := range values {
+				values[ii] = build(dims[1:]).([][][]float64)
+			}
+			return values
+		}
+	}
+	return build(dims)
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// referenceGRU implements the ONNX GRU for one direction, on the host, and returns all the hidden states
+// shaped [sequenceSize, batchSize, hiddenSize].
+func referenceGRU(x [][][]float64, lengths []int, inputsW [][][]float64, recurrentW [][][]float64, biases [][]float64,
+	reverse, linearBeforeReset bool) [][][]float64 {
+	batchSize, sequenceSize := len(x), len(x[0])
+	hiddenSize := len(biases[0])
+	project := func(w [][]float64, v []float64) []float64 {
+		out := make([]float64, len(w))
+		for ii := range w {
+			for jj := range v {
+				out[ii] += w[ii][jj] * v[jj]
+			}
+		}
+		return out
+	}
+	all := make([][][]float64, sequenceSize)
+	for ii := range all {
+		all[ii] = make([][]float64, batchSize)
+	}
+	for b := range batchSize {
+		prev := make([]float64, hiddenSize)
+		for seqIdx := range sequenceSize {
+			pos := seqIdx
+			if reverse {
+				pos = sequenceSize - 1 - seqIdx
+			}
+			if pos >= lengths[b] {
+				all[pos][b] = prev
+				continue
+			}
+			xT := x[b][pos]
+			xz, xr, xh := project(inputsW[0], xT), project(inputsW[1], xT), project(inputsW[2], xT)
+			hz, hr := project(recurrentW[0], prev), project(recurrentW[1], prev)
+			z, r := make([]float64, hiddenSize), make([]float64, hiddenSize)
+			for ii := range hiddenSize {
+				z[ii] = sigmoid(xz[ii] + hz[ii] + biases[0][ii] + biases[3][ii])
+				r[ii] = sigmoid(xr[ii] + hr[ii] + biases[1][ii] + biases[4][ii])
+			}
+			var hh []float64
+			if linearBeforeReset {
+				hh = project(recurrentW[2], prev)
+				for ii := range hiddenSize {
+					hh[ii] = r[ii] * (hh[ii] + biases[5][ii])
+				}
+			} else {
+				resetPrev := make([]float64, hiddenSize)
+				for ii := range hiddenSize {
+					resetPrev[ii] = r[ii] * prev[ii]
+				}
+				hh = project(recurrentW[2], resetPrev)
+				for ii := range hiddenSize {
+					hh[ii] += biases[5][ii]
+				}
+			}
+			next := make([]float64, hiddenSize)
+			for ii := range hiddenSize {
+				h := math.Tanh(xh[ii] + hh[ii] + biases[2][ii])
+				next[ii] = (1-z[ii])*h + z[ii]*prev[ii]
+			}
+			all[pos][b] = next
+			prev = next
+		}
+	}
+	return all
+}
+
+func TestGRU(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, sequenceSize, featuresSize, hiddenSize = 2, 5, 3, 4
+	x := fill(0.1, batchSize, sequenceSize, featuresSize).([][][]float64)
+	lengths := []int32{5, 3}
+	for _, dir := range []DirectionType{DirForward, DirReverse, DirBidirectional} {
+		for _, linearBeforeReset := range []bool{false, true} {
+			for _, ragged := range []bool{false, true} {
+				name := fmt.Sprintf("%s-linearBeforeReset=%v-ragged=%v", dir, linearBeforeReset, ragged)
+				t.Run(name, func(t *testing.T) {
+					numDirections := 1
+					if dir == DirBidirectional {
+						numDirections = 2
+					}
+					inputsW := fill(1, numDirections, 3, hiddenSize, featuresSize).([][][][]float64)
+					recurrentW := fill(2, numDirections, 3, hiddenSize, hiddenSize).([][][][]float64)
+					biases := fill(3, numDirections, 6, hiddenSize).([][][]float64)
+					outputs := MustExecOnceN(backend, func(x, inputsW, recurrentW, biases, lengths *Node) []*Node {
+						layer := NewWithWeights(x, inputsW, recurrentW, biases).LinearBeforeReset(linearBeforeReset)
+						if dir != DirBidirectional {
+							layer.Direction(dir)
+						}
+						if ragged {
+							layer.Ragged(lengths)
+						}
+						allHiddenStates, lastHiddenState := layer.Done()
+						return []*Node{allHiddenStates, lastHiddenState}
+					}, x, inputsW, recurrentW, biases, lengths)
+					got := outputs[0].Value().([][][][]float64)
+					require.Len(t, got, sequenceSize)
+
+					refLengths := []int{sequenceSize, sequenceSize}
+					if ragged {
+						refLengths = []int{int(lengths[0]), int(lengths[1])}
+					}
+					for dirIdx := range numDirections {
+						reverse := dirIdx == 1 || dir == DirReverse
+						want := referenceGRU(x, refLengths, inputsW[dirIdx], recurrentW[dirIdx], biases[dirIdx],
+							reverse, linearBeforeReset)
+						for seqIdx := range sequenceSize {
+							for b := range batchSize {
+								assert.InDeltaSlice(t, want[seqIdx][b], got[seqIdx][dirIdx][b], 1e-6)
+							}
+						}
+					}
+					outputs[1].Shape().AssertDims(numDirections, batchSize, hiddenSize)
+				})
+			}
+		}
+	}
+}
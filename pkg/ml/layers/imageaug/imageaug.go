@@ -0,0 +1,550 @@
+// Package imageaug implements image data augmentation in the computation graph.
+//
+// All transformations operate on batches of images (shaped `[batch_size, height, width, channels]` or
+// `[batch_size, channels, height, width]`, see images.ChannelsAxisConfig), with independent random
+// parameters per example. All randomness comes from the context random number generator (see
+// context.Context.RandomUniform), so augmentation can run on the accelerator, either inside the
+// model or as a pre-processing step with datasets.MapWithGraphFn.
+//
+// Geometric transformations (crop, resize, flips, rotations, zoom, shear and translation) are composed into
+// one affine transformation per example, and the images are resampled only once (see graph.AffineTransform).
+//
+// Example:
+//
+//	func ModelGraph(ctx *context.Context, spec any, inputs []*Node) []*Node {
+//		x := inputs[0]
+//		if ctx.IsTraining(x.Graph()) {
+//			x = imageaug.New(ctx.In("augmentation"), x).
+//				RandomResizedCrop(224, 224).
+//				RandomFlipLeftRight(0.5).
+//				ColorJitter(0.2, 0.2, 0.2, 0.05).
+//				Done()
+//		} else {
+//			x = imageaug.New(ctx, x).Resize(224, 224).Done()
+//		}
+//		...
+//	}
+//
+// MixUp and CutMix also mix the labels, and are provided as separate functions.
+package imageaug
+
+import (
+	"math"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+var (
+	// ParamFlipLeftRight is the hyperparameter with the default probability of flipping an image horizontally.
+	// Default is float64(0.0).
+	ParamFlipLeftRight = "imageaug_flip_left_right"
+
+	// ParamFlipUpDown is the hyperparameter with the default probability of flipping an image vertically.
+	// Default is float64(0.0).
+	ParamFlipUpDown = "imageaug_flip_up_down"
+
+	// ParamRotation is the hyperparameter with the default maximum rotation angle, in degrees.
+	// Default is float64(0.0).
+	ParamRotation = "imageaug_rotation"
+
+	// ParamBrightness is the hyperparameter with the default brightness jitter (see Config.ColorJitter).
+	// Default is float64(0.0).
+	ParamBrightness = "imageaug_brightness"
+
+	// ParamContrast is the hyperparameter with the default contrast jitter (see Config.ColorJitter).
+	// Default is float64(0.0).
+	ParamContrast = "imageaug_contrast"
+
+	// ParamSaturation is the hyperparameter with the default saturation jitter (see Config.ColorJitter).
+	// Default is float64(0.0).
+	ParamSaturation = "imageaug_saturation"
+
+	// ParamHue is the hyperparameter with the default hue jitter (see Config.ColorJitter).
+	// Default is float64(0.0).
+	ParamHue = "imageaug_hue"
+
+	// ParamCutoutSize is the hyperparameter with the default cutout size, as a fraction of the image
+	// height and width (see Config.Cutout). Default is float64(0.0), which disables cutout.
+	ParamCutoutSize = "imageaug_cutout_size"
+)
+
+// Config holds the augmentations to apply to a batch of images. It is created with New, configured
+// with its various methods, and the graph is built when Done is called.
+type Config struct {
+	ctx                *context.Context
+	x                  *Node
+	channelsAxisConfig images.ChannelsAxisConfig
+	maxValue           float64
+
+	// Geometric transformations.
+	outHeight, outWidth int
+	randomCrop          bool
+	minScale, maxScale  float64
+	minRatio, maxRatio  float64
+	isBilinear          bool
+	geometricTransforms []func(c *Config) *Node
+	fillValue           float64
+
+	// Color and masking transformations.
+	brightness, contrast   float64
+	saturation, hue        float64
+	cutoutSize, cutoutFill float64
+	cutoutCount            int
+
+	// Set during Done.
+	g          *Graph
+	dtype      dtypes.DType
+	batchSize  int
+	outputDims [2]int
+}
+
+// New creates a configuration to augment the batch of images x, using the context ctx for the random
+// number generator and the default hyperparameters (see ParamFlipLeftRight, ParamRotation, ParamBrightness, etc.).
+//
+// The images in x must have a float dtype, and by default are assumed to be shaped `[batch_size, height, width, channels]`,
+// with values from 0.0 to 1.0. See ChannelsAxis and MaxValue to change that.
+//
+// Transformations are always applied: if they should only be applied during training, check for
+// ctx.IsTraining(g) before calling it.
+//
+// It returns a configuration object that can be further configured. Call Done when finished configuring,
+// and it will return the augmented images.
+func New(ctx *context.Context, x *Node) *Config {
+	c := &Config{
+		ctx:                ctx,
+		x:                  x,
+		channelsAxisConfig: images.ChannelsLast,
+		maxValue:           1.0,
+		minScale:           0.08,
+		maxScale:           1.0,
+		minRatio:           3.0 / 4.0,
+		maxRatio:           4.0 / 3.0,
+		isBilinear:         true,
+		cutoutCount:        1,
+	}
+	if prob := context.GetParamOr(ctx, ParamFlipLeftRight, 0.0); prob > 0 {
+		c.RandomFlipLeftRight(prob)
+	}
+	if prob := context.GetParamOr(ctx, ParamFlipUpDown, 0.0); prob > 0 {
+		c.RandomFlipUpDown(prob)
+	}
+	if degrees := context.GetParamOr(ctx, ParamRotation, 0.0); degrees > 0 {
+		c.RandomRotation(degrees)
+	}
+	c.ColorJitter(
+		context.GetParamOr(ctx, ParamBrightness, 0.0),
+		context.GetParamOr(ctx, ParamContrast, 0.0),
+		context.GetParamOr(ctx, ParamSaturation, 0.0),
+		context.GetParamOr(ctx, ParamHue, 0.0))
+	c.Cutout(context.GetParamOr(ctx, ParamCutoutSize, 0.0), 1)
+	return c
+}
+
+// ChannelsAxis configures the axis for the channels (aka. "depth" or "features") dimension. The default is
+// `images.ChannelsLast`, meaning the "channels" dimension comes last.
+//
+// Note: `images` refers to package `github.com/gomlx/gomlx/core/tensors/images`.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) ChannelsAxis(channelsAxisConfig images.ChannelsAxisConfig) *Config {
+	c.channelsAxisConfig = channelsAxisConfig
+	return c
+}
+
+// MaxValue sets the maximum value of each channel. It is used to clip the values after the color
+// transformations. Default is 1.0.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) MaxValue(v float64) *Config {
+	c.maxValue = v
+	return c
+}
+
+// Nearest configures the resampling of geometric transformations to use the nearest pixel, as opposed
+// to bilinear interpolation (the default).
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) Nearest() *Config {
+	c.isBilinear = false
+	return c
+}
+
+// FillValue configures the value used for pixels that fall outside the original image after
+// geometric transformations (e.g.: the corners after a rotation). Default is 0.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) FillValue(v float64) *Config {
+	c.fillValue = v
+	return c
+}
+
+// Resize the images to the given height and width, without any crop.
+// If RandomResizedCrop is also used, the last one called prevails.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) Resize(height, width int) *Config {
+	c.outHeight, c.outWidth = height, width
+	c.randomCrop = false
+	return c
+}
+
+// RandomResizedCrop takes a random crop of each image, and resizes it to the given height and width.
+//
+// The area of the crop is randomly chosen from CropScale (default from 0.08 to 1.0 of the original
+// image area), and its aspect ratio from CropAspectRatio (default 3/4 to 4/3). This is the
+// "Inception-style" crop commonly used for training image classifiers.
+//
+// If Resize is also used, the last one called prevails.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomResizedCrop(height, width int) *Config {
+	c.outHeight, c.outWidth = height, width
+	c.randomCrop = true
+	return c
+}
+
+// CropScale sets the range of the fraction of the image area covered by RandomResizedCrop.
+// Default is from 0.08 to 1.0.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) CropScale(minScale, maxScale float64) *Config {
+	if minScale <= 0 || maxScale > 1 || minScale > maxScale {
+		Panicf("imageaug.CropScale(%g, %g): values must be 0 < minScale <= maxScale <= 1", minScale, maxScale)
+	}
+	c.minScale, c.maxScale = minScale, maxScale
+	return c
+}
+
+// CropAspectRatio sets the range of the aspect ratio (width/height) of the crops taken by RandomResizedCrop.
+// The ratio is sampled uniformly in the log-space. Default is from 3/4 to 4/3.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) CropAspectRatio(minRatio, maxRatio float64) *Config {
+	if minRatio <= 0 || minRatio > maxRatio {
+		Panicf("imageaug.CropAspectRatio(%g, %g): values must be 0 < minRatio <= maxRatio", minRatio, maxRatio)
+	}
+	c.minRatio, c.maxRatio = minRatio, maxRatio
+	return c
+}
+
+// RandomFlipLeftRight flips each image horizontally with the given probability.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomFlipLeftRight(prob float64) *Config {
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		sign := c.randomSign(prob)
+		return c.matrix([3][3]any{{1.0, 0.0, 0.0}, {0.0, sign, 0.0}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// RandomFlipUpDown flips each image vertically with the given probability.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomFlipUpDown(prob float64) *Config {
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		sign := c.randomSign(prob)
+		return c.matrix([3][3]any{{sign, 0.0, 0.0}, {0.0, 1.0, 0.0}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// RandomRotation rotates each image around its center by an angle sampled uniformly from
+// `[-maxDegrees, +maxDegrees]`.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomRotation(maxDegrees float64) *Config {
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		maxRadians := maxDegrees * math.Pi / 180.0
+		angle := c.uniform(-maxRadians, maxRadians)
+		cos, sin := Cos(angle), Sin(angle)
+		return c.matrix([3][3]any{{cos, Neg(sin), 0.0}, {sin, cos, 0.0}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// RandomZoom scales each image around its center by a factor sampled uniformly from `[minFactor, maxFactor]`.
+// Factors larger than 1 zoom in (the image content becomes larger).
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomZoom(minFactor, maxFactor float64) *Config {
+	if minFactor <= 0 || minFactor > maxFactor {
+		Panicf("imageaug.RandomZoom(%g, %g): values must be 0 < minFactor <= maxFactor", minFactor, maxFactor)
+	}
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		inverseFactor := Inverse(c.uniform(minFactor, maxFactor))
+		return c.matrix([3][3]any{{inverseFactor, 0.0, 0.0}, {0.0, inverseFactor, 0.0}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// RandomShear applies a horizontal shear to each image, with a shear factor sampled uniformly from
+// `[-maxShear, +maxShear]`.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomShear(maxShear float64) *Config {
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		shear := c.uniform(-maxShear, maxShear)
+		return c.matrix([3][3]any{{1.0, 0.0, 0.0}, {shear, 1.0, 0.0}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// RandomTranslation shifts each image by a random offset, sampled uniformly from `[-maxFraction, +maxFraction]`
+// of the output height and width.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) RandomTranslation(maxFraction float64) *Config {
+	c.geometricTransforms = append(c.geometricTransforms, func(c *Config) *Node {
+		rowsShift := c.uniform(-maxFraction*float64(c.outputDims[0]), maxFraction*float64(c.outputDims[0]))
+		colsShift := c.uniform(-maxFraction*float64(c.outputDims[1]), maxFraction*float64(c.outputDims[1]))
+		return c.matrix([3][3]any{{1.0, 0.0, rowsShift}, {0.0, 1.0, colsShift}, {0.0, 0.0, 1.0}})
+	})
+	return c
+}
+
+// ColorJitter randomly changes the brightness, contrast, saturation and hue of each image.
+// Each value sets the amount of jitter, and zero disables the corresponding transformation:
+//
+//   - brightness: the pixel values are multiplied by a factor sampled from `[max(0, 1-brightness), 1+brightness]`.
+//   - contrast: the distance of the pixels to the image mean gray level are multiplied by a factor sampled from
+//     `[max(0, 1-contrast), 1+contrast]`.
+//   - saturation: the distance of the pixels to their gray level are multiplied by a factor sampled from
+//     `[max(0, 1-saturation), 1+saturation]`. It requires 3 (RGB) channels.
+//   - hue: the hue is rotated by a fraction of a full turn sampled from `[-hue, +hue]`, with hue <= 0.5.
+//     It requires 3 (RGB) channels.
+//
+// The transformations are applied in the order above, and the results are clipped to `[0, MaxValue]`.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) ColorJitter(brightness, contrast, saturation, hue float64) *Config {
+	if hue > 0.5 {
+		Panicf("imageaug.ColorJitter(hue=%g): hue must be <= 0.5", hue)
+	}
+	c.brightness, c.contrast, c.saturation, c.hue = brightness, contrast, saturation, hue
+	return c
+}
+
+// Cutout masks out (sets to fillValue) count randomly placed rectangles in each image, each with the given
+// size as a fraction of the height and width of the image -- e.g.: `Cutout(0.25, 1)` masks out one
+// rectangle with a quarter of the height and a quarter of the width of each image.
+//
+// The rectangles centers are uniformly sampled over the image, so they may be partially outside the image.
+// The fill value defaults to 0, see CutoutFillValue.
+//
+// See "Improved Regularization of Convolutional Neural Networks with Cutout", https://arxiv.org/abs/1708.04552
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) Cutout(size float64, count int) *Config {
+	c.cutoutSize, c.cutoutCount = size, count
+	return c
+}
+
+// CutoutFillValue sets the value used for the pixels masked out by Cutout. Default is 0.
+//
+// It returns the modified Config object, so calls can be cascaded.
+func (c *Config) CutoutFillValue(v float64) *Config {
+	c.cutoutFill = v
+	return c
+}
+
+// Done builds the graph with the configured augmentations, and returns the augmented images.
+// The output has the same shape as the input, except the spatial dimensions if Resize or
+// RandomResizedCrop were configured.
+func (c *Config) Done() *Node {
+	x := c.x
+	c.g = x.Graph()
+	if x.Rank() != 4 {
+		Panicf("imageaug requires images shaped [batch_size, height, width, channels] (or channels first), got %s",
+			x.Shape())
+	}
+	if !x.DType().IsFloat() {
+		Panicf("imageaug requires images with a float dtype, got %s -- convert them with ConvertDType first", x.Shape())
+	}
+	c.dtype = x.DType()
+	if c.dtype == dtypes.Float16 || c.dtype == dtypes.BFloat16 {
+		// Use higher precision for the random numbers and coordinates.
+		c.dtype = dtypes.Float32
+	}
+	if c.channelsAxisConfig == images.ChannelsFirst {
+		x = TransposeAllAxes(x, 0, 2, 3, 1)
+	}
+	c.batchSize = x.Shape().Dimensions[0]
+	x = c.geometric(x)
+	x = c.color(x)
+	x = c.cutout(x)
+	if c.channelsAxisConfig == images.ChannelsFirst {
+		x = TransposeAllAxes(x, 0, 3, 1, 2)
+	}
+	return x
+}
+
+// uniform returns values shaped [batchSize] sampled uniformly from [minValue, maxValue).
+func (c *Config) uniform(minValue, maxValue float64) *Node {
+	values := c.ctx.RandomUniform(c.g, shapes.Make(c.dtype, c.batchSize))
+	return AddScalar(MulScalar(values, maxValue-minValue), minValue)
+}
+
+// randomSign returns values shaped [batchSize] set to -1 with probability prob, and 1 otherwise.
+func (c *Config) randomSign(prob float64) *Node {
+	flip := LessThan(c.uniform(0, 1), Scalar(c.g, c.dtype, prob))
+	return Where(flip, Scalar(c.g, c.dtype, -1), Scalar(c.g, c.dtype, 1))
+}
+
+// matrix builds per-example matrices shaped [batchSize, 3, 3], where each entry is either a float64
+// constant or a node shaped [batchSize].
+func (c *Config) matrix(entries [3][3]any) *Node {
+	flat := make([]*Node, 0, 9)
+	for _, row := range entries {
+		for _, entry := range row {
+			switch v := entry.(type) {
+			case float64:
+				flat = append(flat, BroadcastToDims(Scalar(c.g, c.dtype, v), c.batchSize))
+			case *Node:
+				flat = append(flat, v)
+			default:
+				Panicf("imageaug: invalid matrix entry type %T", entry)
+			}
+		}
+	}
+	return Reshape(Stack(flat, -1), c.batchSize, 3, 3)
+}
+
+// geometric applies the crop, resize and all geometric transformations with one resampling.
+// x is given in the channels last layout.
+func (c *Config) geometric(x *Node) *Node {
+	height, width := x.Shape().Dimensions[1], x.Shape().Dimensions[2]
+	c.outputDims = [2]int{height, width}
+	if c.outHeight > 0 && c.outWidth > 0 {
+		c.outputDims = [2]int{c.outHeight, c.outWidth}
+	}
+	if !c.randomCrop && len(c.geometricTransforms) == 0 && c.outputDims == [2]int{height, width} {
+		// Nothing to do.
+		return x
+	}
+	outHeight, outWidth := float64(c.outputDims[0]), float64(c.outputDims[1])
+
+	// The transformations map the output pixel coordinates to input coordinates, composed right to left:
+	// the output coordinates are centered, then transformed by the geometric transformations (in reverse order),
+	// and finally mapped to the crop region in the input image.
+	var crop *Node
+	if c.randomCrop {
+		area := MulScalar(c.uniform(c.minScale, c.maxScale), float64(height*width))
+		ratio := Exp(c.uniform(math.Log(c.minRatio), math.Log(c.maxRatio)))
+		cropHeight := MinScalar(Sqrt(Div(area, ratio)), float64(height))
+		cropWidth := MinScalar(Sqrt(Mul(area, ratio)), float64(width))
+		centerRow := Add(MulScalar(cropHeight, 0.5), Mul(c.uniform(0, 1), AddScalar(Neg(cropHeight), float64(height))))
+		centerCol := Add(MulScalar(cropWidth, 0.5), Mul(c.uniform(0, 1), AddScalar(Neg(cropWidth), float64(width))))
+		crop = c.matrix([3][3]any{
+			{DivScalar(cropHeight, outHeight), 0.0, AddScalar(centerRow, -0.5)},
+			{0.0, DivScalar(cropWidth, outWidth), AddScalar(centerCol, -0.5)},
+			{0.0, 0.0, 1.0}})
+	} else {
+		crop = c.matrix([3][3]any{
+			{float64(height) / outHeight, 0.0, float64(height)/2 - 0.5},
+			{0.0, float64(width) / outWidth, float64(width)/2 - 0.5},
+			{0.0, 0.0, 1.0}})
+	}
+	transforms := crop
+	for _, transformFn := range c.geometricTransforms {
+		transforms = Einsum("bij,bjk->bik", transforms, transformFn(c))
+	}
+	center := c.matrix([3][3]any{{1.0, 0.0, 0.5 - outHeight/2}, {0.0, 1.0, 0.5 - outWidth/2}, {0.0, 0.0, 1.0}})
+	transforms = Einsum("bij,bjk->bik", transforms, center)
+	transforms = Slice(transforms, AxisRange(), AxisRange(0, 2))
+
+	affine := AffineTransform(x, transforms).OutputSize(c.outputDims[0], c.outputDims[1]).FillValue(c.fillValue)
+	if !c.isBilinear {
+		affine.Nearest()
+	}
+	return affine.Done()
+}
+
+// Coefficients to convert RGB to YIQ color space and back, used for the hue rotation.
+var (
+	rgbToYIQ = [][]float64{{0.299, 0.587, 0.114}, {0.596, -0.274, -0.322}, {0.211, -0.523, 0.312}}
+	yiqToRGB = [][]float64{{1, 0.956, 0.621}, {1, -0.272, -0.647}, {1, -1.106, 1.703}}
+)
+
+// grayScale returns the gray level of each pixel of x (channels last), keeping the channels axis with dimension 1.
+func grayScale(x *Node) *Node {
+	numChannels := x.Shape().Dimensions[3]
+	if numChannels != 3 {
+		return ReduceAndKeep(x, ReduceMean, -1)
+	}
+	weights := ConvertDType(Const(x.Graph(), rgbToYIQ[0]), x.DType())
+	return ExpandAxes(Einsum("bhwc,c->bhw", x, weights), -1)
+}
+
+// color applies the color jitter transformations. x is given in the channels last layout.
+func (c *Config) color(x *Node) *Node {
+	if c.brightness <= 0 && c.contrast <= 0 && c.saturation <= 0 && c.hue <= 0 {
+		return x
+	}
+	g := c.g
+	numChannels := x.Shape().Dimensions[3]
+	perExample := func(values *Node) *Node {
+		return Reshape(ConvertDType(values, x.DType()), c.batchSize, 1, 1, 1)
+	}
+	if c.brightness > 0 {
+		factor := c.uniform(max(0, 1-c.brightness), 1+c.brightness)
+		x = Mul(x, perExample(factor))
+	}
+	if c.contrast > 0 {
+		factor := perExample(c.uniform(max(0, 1-c.contrast), 1+c.contrast))
+		mean := ReduceAndKeep(grayScale(x), ReduceMean, 1, 2)
+		x = Add(Mul(Sub(x, mean), factor), mean)
+	}
+	if (c.saturation > 0 || c.hue > 0) && numChannels != 3 {
+		Panicf("imageaug.ColorJitter with saturation or hue requires images with 3 (RGB) channels, got %s", c.x.Shape())
+	}
+	if c.saturation > 0 {
+		factor := perExample(c.uniform(max(0, 1-c.saturation), 1+c.saturation))
+		gray := grayScale(x)
+		x = Add(Mul(Sub(x, gray), factor), gray)
+	}
+	if c.hue > 0 {
+		angle := c.uniform(-c.hue*2*math.Pi, c.hue*2*math.Pi)
+		cos, sin := Cos(angle), Sin(angle)
+		rotation := c.matrix([3][3]any{{1.0, 0.0, 0.0}, {0.0, cos, Neg(sin)}, {0.0, sin, cos}})
+		toYIQ := ConvertDType(Const(g, rgbToYIQ), c.dtype)
+		toRGB := ConvertDType(Const(g, yiqToRGB), c.dtype)
+		transform := Einsum("ij,bjk->bik", toRGB, rotation)
+		transform = Einsum("bij,jk->bik", transform, toYIQ)
+		x = Einsum("bhwc,bdc->bhwd", x, ConvertDType(transform, x.DType()))
+	}
+	return ClipScalar(x, 0, c.maxValue)
+}
+
+// cutout applies the Cutout masking. x is given in the channels last layout.
+func (c *Config) cutout(x *Node) *Node {
+	if c.cutoutSize <= 0 || c.cutoutCount <= 0 {
+		return x
+	}
+	g := c.g
+	height, width := x.Shape().Dimensions[1], x.Shape().Dimensions[2]
+	rows := AddScalar(Iota(g, shapes.Make(c.dtype, 1, height, 1), 1), 0.5)
+	cols := AddScalar(Iota(g, shapes.Make(c.dtype, 1, 1, width), 2), 0.5)
+	halfHeight := Scalar(g, c.dtype, c.cutoutSize*float64(height)/2)
+	halfWidth := Scalar(g, c.dtype, c.cutoutSize*float64(width)/2)
+	var mask *Node
+	for range c.cutoutCount {
+		centerRow := Reshape(c.uniform(0, float64(height)), c.batchSize, 1, 1)
+		centerCol := Reshape(c.uniform(0, float64(width)), c.batchSize, 1, 1)
+		inside := And(
+			LessOrEqual(Abs(Sub(rows, centerRow)), halfHeight),
+			LessOrEqual(Abs(Sub(cols, centerCol)), halfWidth))
+		if mask == nil {
+			mask = inside
+		} else {
+			mask = Or(mask, inside)
+		}
+	}
+	mask = BroadcastToDims(ExpandAxes(mask, -1), x.Shape().Dimensions...)
+	return Where(mask, Scalar(g, x.DType(), c.cutoutFill), x)
+}
@@ -0,0 +1,107 @@
+package imageaug
+
+import (
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+func TestGeometric(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.RngStateFromSeed(42)
+
+	// Flip with probability 1 is deterministic.
+	got := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		x := Const(g, [][][][]float32{{{{1}, {2}, {3}}, {{4}, {5}, {6}}}})
+		return New(ctx, x).RandomFlipLeftRight(1.0).RandomFlipUpDown(1.0).Done()
+	})
+	require.Equal(t, [][][][]float32{{{{6}, {5}, {4}}, {{3}, {2}, {1}}}}, got.Value())
+
+	// Channels first and resize.
+	got = context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		x := Const(g, [][][][]float32{{{{1, 1, 3, 3}, {1, 1, 3, 3}}}})
+		return New(ctx, x).ChannelsAxis(images.ChannelsFirst).Resize(1, 2).Done()
+	})
+	require.Equal(t, [][][][]float32{{{{1, 3}}}}, got.Value())
+
+	// Random crops, rotations, etc. only checks for shapes and value ranges.
+	got = context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		x := ctx.RandomUniform(g, shapes.Make(dtypes.Float32, 5, 16, 12, 3))
+		return New(ctx, x).RandomResizedCrop(8, 10).RandomRotation(30).RandomZoom(0.8, 1.2).
+			RandomShear(0.1).RandomTranslation(0.1).Done()
+	})
+	require.NoError(t, got.Shape().CheckDims(5, 8, 10, 3))
+	for _, v := range got.Value().([][][][]float32)[0][0] {
+		for _, channel := range v {
+			require.True(t, channel >= 0 && channel <= 1)
+		}
+	}
+}
+
+func TestColorAndCutout(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.RngStateFromSeed(42)
+	ctx.SetParam(ParamCutoutSize, 0.5)
+	outputs := context.MustExecOnceN(backend, ctx, func(ctx *context.Context, g *Graph) []*Node {
+		x := OnesLike(ctx.RandomUniform(g, shapes.Make(dtypes.Float32, 64, 8, 8, 3)))
+		x = MulScalar(x, 0.5)
+		jittered := New(ctx.In("jitter"), x).ColorJitter(0.3, 0.3, 0.3, 0.1).Cutout(0, 0).Done()
+		cutout := New(ctx.In("cutout"), x).CutoutFillValue(-1).Done()
+		return []*Node{
+			ReduceAllMin(jittered), ReduceAllMax(jittered),
+			ReduceAllMean(ConvertDType(Equal(cutout, Scalar(g, dtypes.Float32, -1)), dtypes.Float32)),
+		}
+	})
+	require.GreaterOrEqual(t, outputs[0].Value().(float32), float32(0))
+	require.LessOrEqual(t, outputs[1].Value().(float32), float32(1))
+	require.Less(t, outputs[0].Value().(float32), outputs[1].Value().(float32))
+	// Cutout covers 25% of the area, minus the parts of the rectangles that fall outside the image.
+	cutoutRatio := outputs[2].Value().(float32)
+	require.Greater(t, cutoutRatio, float32(0.1))
+	require.Less(t, cutoutRatio, float32(0.25))
+}
+
+func TestMixing(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.RngStateFromSeed(42)
+
+	// Beta distribution mean is alpha/(alpha+beta).
+	got := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+		return ReduceAllMean(SampleBeta(ctx, g, 0.5, 1.5, shapes.Make(dtypes.Float64, 10_000)))
+	})
+	require.InDelta(t, 0.25, got.Value().(float64), 0.01)
+
+	for _, mixFn := range []func(ctx *context.Context, imgs, labels *Node) (*Node, *Node){
+		func(ctx *context.Context, imgs, labels *Node) (*Node, *Node) { return MixUp(ctx, imgs, labels, 0.4) },
+		func(ctx *context.Context, imgs, labels *Node) (*Node, *Node) {
+			return CutMix(ctx, imgs, labels, 1.0, images.ChannelsLast)
+		},
+	} {
+		outputs := context.MustExecOnceN(backend, ctx, func(ctx *context.Context, g *Graph) []*Node {
+			// Each image is filled with its label, so the mean of the mixed images must match the mixed labels.
+			batchSize := 16
+			labels := Iota(g, shapes.Make(dtypes.Int32, batchSize), 0)
+			imgs := BroadcastToDims(Reshape(ConvertDType(labels, dtypes.Float32), batchSize, 1, 1, 1), batchSize, 10, 10, 1)
+			oneHot := OneHot(labels, batchSize, dtypes.Float32)
+			imgs, oneHot = mixFn(ctx, imgs, oneHot)
+			imgsMean := ReduceMean(imgs, 1, 2, 3)
+			labelsMean := Einsum("bc,c->b", oneHot, ConvertDType(Iota(g, shapes.Make(dtypes.Int32, batchSize), 0), dtypes.Float32))
+			return []*Node{imgsMean, labelsMean, ReduceSum(oneHot, -1)}
+		})
+		require.InDeltaSlice(t, outputs[0].Value(), outputs[1].Value(), 1e-3)
+		for _, sum := range outputs[2].Value().([]float32) {
+			require.InDelta(t, 1.0, sum, 1e-4)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package imageaug
+
+import (
+	"math"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// MixUp blends each example in the batch with another random example of the same batch, as described in [1].
+//
+// Each example is paired with another example of the batch (a random rotation of the batch), and both the
+// images and the labels are blended with a weight λ sampled from a Beta(alpha, alpha) distribution, per example.
+//
+// Parameters:
+//   - ctx: used for the random number generator.
+//   - imgs: the batch of images (or any other input), with a float dtype and the batch as the leading axis.
+//   - labels: the labels, with the batch as the leading axis. They must be given as probabilities (e.g.: one-hot
+//     encoded), so they can be mixed -- see graph.OneHot.
+//   - alpha: parameter of the Beta distribution. Typical values are from 0.1 to 0.4. Higher values mix more.
+//
+// It returns the mixed images and labels, with the same shapes as the inputs.
+// If the batch has only one example, they are returned unchanged.
+//
+// [1] "mixup: Beyond Empirical Risk Minimization", Hongyi Zhang, Moustapha Cisse, Yann N. Dauphin, David Lopez-Paz,
+// https://arxiv.org/abs/1710.09412
+func MixUp(ctx *context.Context, imgs, labels *Node, alpha float64) (mixedImages, mixedLabels *Node) {
+	checkMixingInputs("MixUp", imgs, labels, alpha)
+	batchSize := imgs.Shape().Dimensions[0]
+	if batchSize <= 1 {
+		return imgs, labels
+	}
+	dtype := randomDType(imgs.DType())
+	lambda := SampleBeta(ctx, imgs.Graph(), alpha, alpha, shapes.Make(dtype, batchSize))
+	partners := randomPartners(ctx, imgs.Graph(), batchSize)
+	mixedImages = mixWithPartners(imgs, partners, lambda)
+	mixedLabels = mixWithPartners(labels, partners, lambda)
+	return
+}
+
+// CutMix replaces a random rectangle of each image with the same region of another random example of the
+// same batch, as described in [1]. The labels are mixed in proportion to the area of the pasted rectangle.
+//
+// The fraction of the image area kept, λ, is sampled from a Beta(alpha, alpha) distribution per example, and the
+// pasted rectangle has the same aspect ratio as the image.
+//
+// Parameters:
+//   - ctx: used for the random number generator.
+//   - imgs: the batch of images shaped `[batch_size, height, width, channels]` or `[batch_size, channels, height, width]`,
+//     according to channelsAxisConfig.
+//   - labels: the labels, with the batch as the leading axis. They must be given as probabilities (e.g.: one-hot
+//     encoded), so they can be mixed -- see graph.OneHot.
+//   - alpha: parameter of the Beta distribution. The paper uses alpha=1, a uniform distribution.
+//   - channelsAxisConfig: the layout of the images.
+//
+// It returns the mixed images and labels, with the same shapes as the inputs.
+// If the batch has only one example, they are returned unchanged.
+//
+// [1] "CutMix: Regularization Strategy to Train Strong Classifiers with Localizable Features", Sangdoo Yun, Dongyoon Han,
+// Seong Joon Oh, Sanghyuk Chun, Junsuk Choe, Youngjoon Yoo, https://arxiv.org/abs/1905.04899
+func CutMix(ctx *context.Context, imgs, labels *Node, alpha float64, channelsAxisConfig images.ChannelsAxisConfig) (
+	mixedImages, mixedLabels *Node) {
+	checkMixingInputs("CutMix", imgs, labels, alpha)
+	if imgs.Rank() != 4 {
+		Panicf("CutMix requires images shaped [batch_size, height, width, channels] (or channels first), got %s",
+			imgs.Shape())
+	}
+	g := imgs.Graph()
+	batchSize := imgs.Shape().Dimensions[0]
+	if batchSize <= 1 {
+		return imgs, labels
+	}
+	dtype := randomDType(imgs.DType())
+	spatialAxes := images.GetSpatialAxes(imgs, channelsAxisConfig)
+	height, width := imgs.Shape().Dimensions[spatialAxes[0]], imgs.Shape().Dimensions[spatialAxes[1]]
+	lambda := SampleBeta(ctx, g, alpha, alpha, shapes.Make(dtype, batchSize))
+	partners := randomPartners(ctx, g, batchSize)
+
+	// Box bounds for each example, rounded to whole pixels and shaped [batchSize, 1, 1].
+	cutRatio := Sqrt(OneMinus(lambda))
+	boxBounds := func(dim int) (start, end *Node) {
+		center := MulScalar(ctx.RandomUniform(g, shapes.Make(dtype, batchSize)), float64(dim))
+		halfSize := MulScalar(cutRatio, float64(dim)/2)
+		start = Round(ClipScalar(Sub(center, halfSize), 0, float64(dim)))
+		end = Round(ClipScalar(Add(center, halfSize), 0, float64(dim)))
+		return Reshape(start, batchSize, 1, 1), Reshape(end, batchSize, 1, 1)
+	}
+	rowStart, rowEnd := boxBounds(height)
+	colStart, colEnd := boxBounds(width)
+	rows := AddScalar(Iota(g, shapes.Make(dtype, 1, height, 1), 1), 0.5)
+	cols := AddScalar(Iota(g, shapes.Make(dtype, 1, 1, width), 2), 0.5)
+	mask := And(
+		And(GreaterOrEqual(rows, rowStart), LessThan(rows, rowEnd)),
+		And(GreaterOrEqual(cols, colStart), LessThan(cols, colEnd))) // [batchSize, height, width]
+
+	// Adjust lambda to the actual area kept, after clipping the box.
+	boxArea := Mul(Sub(rowEnd, rowStart), Sub(colEnd, colStart))
+	lambda = OneMinus(DivScalar(Reshape(boxArea, batchSize), float64(height*width)))
+
+	// Broadcast mask to the images shape.
+	if channelsAxisConfig == images.ChannelsFirst {
+		mask = ExpandAxes(mask, 1)
+	} else {
+		mask = ExpandAxes(mask, -1)
+	}
+	mask = BroadcastToDims(mask, imgs.Shape().Dimensions...)
+	mixedImages = Where(mask, Gather(imgs, ExpandAxes(partners, -1)), imgs)
+	mixedLabels = mixWithPartners(labels, partners, lambda)
+	return
+}
+
+// checkMixingInputs validates the inputs for MixUp and CutMix.
+func checkMixingInputs(name string, imgs, labels *Node, alpha float64) {
+	if !imgs.DType().IsFloat() {
+		Panicf("%s requires images with a float dtype, got %s", name, imgs.Shape())
+	}
+	if !labels.DType().IsFloat() {
+		Panicf("%s requires labels given as probabilities (e.g.: one-hot encoded) with a float dtype, got %s -- "+
+			"see graph.OneHot", name, labels.Shape())
+	}
+	if labels.Rank() == 0 || labels.Shape().Dimensions[0] != imgs.Shape().Dimensions[0] {
+		Panicf("%s requires images and labels to have the same batch size (leading axis), got images %s and labels %s",
+			name, imgs.Shape(), labels.Shape())
+	}
+	if alpha <= 0 {
+		Panicf("%s requires alpha > 0, got %g", name, alpha)
+	}
+}
+
+// randomDType returns the dtype to use for random values used to transform values of the given dtype.
+func randomDType(dtype dtypes.DType) dtypes.DType {
+	if dtype == dtypes.Float16 || dtype == dtypes.BFloat16 {
+		return dtypes.Float32
+	}
+	return dtype
+}
+
+// randomPartners returns for each example in the batch the index of another example, shaped [batchSize].
+// It uses a random rotation of the batch, so no example is paired with itself.
+func randomPartners(ctx *context.Context, g *Graph, batchSize int) *Node {
+	shift := OnePlus(ctx.RandomIntN(g, int32(batchSize-1), shapes.Make(dtypes.Int32)))
+	return ModScalar(Add(Iota(g, shapes.Make(dtypes.Int32, batchSize), 0), shift), batchSize)
+}
+
+// mixWithPartners returns `lambda * x + (1 - lambda) * x[partners]`, where lambda is shaped [batchSize].
+func mixWithPartners(x, partners, lambda *Node) *Node {
+	lambda = ConvertDType(lambda, x.DType())
+	lambdaDims := make([]int, x.Rank())
+	for ii := range lambdaDims {
+		lambdaDims[ii] = 1
+	}
+	lambdaDims[0] = x.Shape().Dimensions[0]
+	lambda = Reshape(lambda, lambdaDims...)
+	partnersX := Gather(x, ExpandAxes(partners, -1))
+	return Add(Mul(x, lambda), Mul(partnersX, OneMinus(lambda)))
+}
+
+// gammaNumCandidates is the number of candidates drawn by SampleGamma for its rejection sampling.
+// The acceptance rate of each candidate is > 95%, so the chance of all of them being rejected is negligible.
+const gammaNumCandidates = 8
+
+// SampleGamma samples values from a Gamma(alpha, 1) distribution with the given shape, using the
+// context random number generator.
+//
+// It uses the rejection method from Marsaglia and Tsang [1], with a fixed number of candidates drawn
+// in parallel (so it can be computed in the graph), and the "boosting" trick for alpha < 1.
+//
+// [1] "A Simple Method for Generating Gamma Variables", George Marsaglia and Wai Wan Tsang, ACM Transactions on
+// Mathematical Software, 2000.
+func SampleGamma(ctx *context.Context, g *Graph, alpha float64, shape shapes.Shape) *Node {
+	if alpha <= 0 {
+		Panicf("SampleGamma requires alpha > 0, got %g", alpha)
+	}
+	if !shape.DType.IsFloat() {
+		Panicf("SampleGamma requires a float dtype, got %s", shape)
+	}
+	boostedAlpha := alpha
+	if alpha < 1 {
+		boostedAlpha += 1
+	}
+	d := boostedAlpha - 1.0/3.0
+	c := 1.0 / math.Sqrt(9*d)
+
+	candidatesShape := shape.Clone()
+	candidatesShape.Dimensions = append(candidatesShape.Dimensions, gammaNumCandidates)
+	normal := ctx.RandomNormal(g, candidatesShape)
+	uniform := ctx.RandomUniform(g, candidatesShape)
+	v := OnePlus(MulScalar(normal, c))
+	v = Mul(Square(v), v)
+	positiveV := MaxScalar(v, 1e-20)
+	// Accept if log(u) < x^2/2 + d - d*v + d*log(v), and v > 0.
+	threshold := Add(MulScalar(Square(normal), 0.5), MulScalar(Sub(Log(positiveV), v), d))
+	threshold = AddScalar(threshold, d)
+	accepted := And(GreaterThan(v, ScalarZero(g, shape.DType)), LessThan(Log(uniform), threshold))
+
+	// Take the first accepted candidate, or d (the mode) if none was accepted.
+	firstAccepted := ArgMax(ConvertDType(accepted, shape.DType), -1, dtypes.Int32)
+	selection := OneHot(firstAccepted, gammaNumCandidates, shape.DType)
+	value := ReduceSum(Mul(MulScalar(v, d), selection), -1)
+	anyAccepted := ReduceLogicalOr(accepted, -1)
+	value = Where(anyAccepted, value, Scalar(g, shape.DType, d))
+
+	if alpha < 1 {
+		// Boosting: Gamma(alpha) = Gamma(alpha+1) * U^(1/alpha).
+		u := ctx.RandomUniform(g, shape)
+		value = Mul(value, Exp(DivScalar(Log(MaxScalar(u, 1e-20)), alpha)))
+	}
+	return value
+}
+
+// SampleBeta samples values from a Beta(alpha, beta) distribution with the given shape, using the context
+// random number generator.
+//
+// It is computed as X/(X+Y), with X ~ Gamma(alpha) and Y ~ Gamma(beta), see SampleGamma.
+func SampleBeta(ctx *context.Context, g *Graph, alpha, beta float64, shape shapes.Shape) *Node {
+	x := SampleGamma(ctx, g, alpha, shape)
+	y := SampleGamma(ctx, g, beta, shape)
+	return Div(x, MaxScalar(Add(x, y), 1e-20))
+}
@@ -231,6 +231,9 @@ func (c *Config) NumControlPoints(numControlPoints int) *Config {
 // Done takes the configuration and apply the KAN bsplineLayer(s) configured.
 func (c *Config) Done() *Node {
 	ctx := c.ctx
+	g := c.input.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 
 	// Reshape to rank-2: [batch, features]
 	numInputNodes := c.input.Shape().Dimensions[c.input.Rank()-1]
@@ -199,6 +199,8 @@ func (builder *LayerNormBuilder) Done() *Node {
 	x := builder.x
 	mask := builder.mask
 	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 
 	// LearnedGain and offset to be applied to the normalized value.
 	var gain, offset *Node
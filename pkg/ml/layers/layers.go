@@ -29,6 +29,7 @@ import (
 	. "github.com/gomlx/gomlx/pkg/core/graph"
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers/quantization"
 	"github.com/gomlx/gomlx/pkg/ml/layers/regularizers"
 	"github.com/gomlx/gomlx/pkg/ml/train"
 	"github.com/gomlx/gopjrt/dtypes"
@@ -81,10 +82,15 @@ func DenseWithBias(ctx *context.Context, input *Node, outputDimensions ...int) *
 // It the input has shape `[<batch dimensions...>, featureDimension]`, the output will have
 // shape `[<batch dimensions...>, <outputDimensions...>]`.
 //
+// If the weights were quantized (see package quantization), they are dequantized on the fly.
+// It supports quantization-aware training, see quantization.ParamQATBits.
+//
 // See also FNN for a more configurable (including hidden layers) version.
 func Dense(ctx *context.Context, input *Node, useBias bool, outputDimensions ...int) *Node {
 	g := input.Graph()
 	ctx = ctx.In("dense")
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	regularizer := regularizers.FromContext(ctx)
 
 	inputShape := input.Shape()
@@ -101,12 +107,19 @@ func Dense(ctx *context.Context, input *Node, useBias bool, outputDimensions ...
 	weightsDims := make([]int, 1+len(outputDimensions))
 	weightsDims[0] = inputLastDimension
 	copy(weightsDims[1:], outputDimensions)
-	weightsVar := ctx.VariableWithShape("weights", shapes.Make(inputShape.DType, weightsDims...))
-	if regularizer != nil {
-		// Only for the weights, not for the bias.
-		regularizer(ctx, g, weightsVar)
+	var weights *Node
+	if quantized := quantization.Get(ctx, "weights"); quantized != nil {
+		weights = quantized.Dequantize(g, inputShape.DType)
+		weights.AssertDims(weightsDims...)
+	} else {
+		weightsVar := ctx.VariableWithShape("weights", shapes.Make(inputShape.DType, weightsDims...))
+		if regularizer != nil {
+			// Only for the weights, not for the bias.
+			regularizer(ctx, g, weightsVar)
+		}
+		weights = quantization.FakeQuantizeWeights(ctx, weightsVar.ValueGraph(g), quantization.DenseChannelAxes(len(weightsDims))...)
 	}
-	weights := weightsVar.ValueGraph(g)
+	input = quantization.FakeQuantizeInput(ctx, input)
 	var output *Node
 	if inputRank <= 2 && len(outputDimensions) == 1 {
 		// Vanilla version: input = [batch_size, feature_size], output = [batch_size, output_dim].
@@ -159,7 +172,12 @@ func Dense(ctx *context.Context, input *Node, useBias bool, outputDimensions ...
 //
 // The output has rank one larger than the input, with the last dimension the same as
 // the embedding dimension.
+//
+// If the embedding table was quantized (see package quantization), only the gathered embeddings are dequantized.
 func Embedding(ctx *context.Context, input *Node, dtype dtypes.DType, vocabSize, dimension int, indicesAreSorted ...bool) *Node {
+	g := input.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	inputShape := input.Shape()
 	if !inputShape.DType.IsInt() {
 		Panicf("can only use Embedding on integer inputs, passed %s instead", input.Shape())
@@ -169,6 +187,11 @@ func Embedding(ctx *context.Context, input *Node, dtype dtypes.DType, vocabSize,
 		// and index of size 1.
 		input = InsertAxes(input, -1)
 	}
+	if quantized := quantization.Get(ctx, "embeddings"); quantized != nil {
+		output := quantized.Gather(input, dtype, indicesAreSorted...)
+		output.AssertDims(append(input.Shape().Clone().Dimensions[:input.Rank()-1], dimension)...)
+		return output
+	}
 	embeddingTable := ctx.VariableWithShape("embeddings", shapes.Make(dtype, vocabSize, dimension))
 	return Gather(embeddingTable.ValueGraph(input.Graph()), input, indicesAreSorted...)
 }
@@ -213,6 +236,8 @@ func AssertQuantilesForPWLCalibrationValid[T cmp.Ordered](values []T) {
 func PieceWiseLinearCalibration(ctx *context.Context, input, keypoints *Node, outputTrainable bool) *Node {
 	g := input.Graph()
 	ctx = ctx.In("piece_wise_linear")
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	if !input.DType().IsFloat() {
 		Panicf("PieceWiseLinearCalibration only accepts float inputs, but got %s", input.Shape())
 	}
@@ -292,6 +317,8 @@ func PieceWiseLinearCalibration(ctx *context.Context, input, keypoints *Node, ou
 func PieceWiseLinearCalibrationCascaded(ctx *context.Context, input, keypoints *Node, outputTrainable bool) *Node {
 	g := input.Graph()
 	ctx = ctx.In("piece_wise_linear")
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	if !input.DType().IsFloat() {
 		Panicf("PieceWiseLinearCalibration only accepts float inputs, but got %s", input.Shape())
 	}
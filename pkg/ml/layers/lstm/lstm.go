@@ -168,6 +168,11 @@ func (l *LSTM) Done() (allHiddenStates, lastHiddenState, lastCellState *Node) {
 	ctx := l.ctx
 	x := l.x
 	g := l.x.Graph()
+	if ctx != nil {
+		// ctx is nil if created with NewWithWeights.
+		g.PushScope(ctx.Scope())
+		defer g.PopScope()
+	}
 	dtype := x.DType()
 	numDirections := l.NumDirections()
 	batchSize := l.batchSize
@@ -277,7 +282,6 @@ func (l *LSTM) Done() (allHiddenStates, lastHiddenState, lastCellState *Node) {
 			// use the prevHidden/prevCell unchanged -- notice it works in both directions.
 			if l.xLengths != nil {
 				masked := GreaterOrEqual(Scalar(g, xLengths.DType(), seqPos), xLengths)
-				masked = ExpandAxes(masked, -1)
 				hiddenState = Where(masked, prevHidden[dirIdx], hiddenState)
 				cellState = Where(masked, prevCell[dirIdx], cellState)
 			}
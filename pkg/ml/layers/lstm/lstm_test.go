@@ -8,6 +8,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
 
 	_ "github.com/gomlx/gomlx/backends/default"
 )
@@ -87,3 +88,40 @@ func TestLSTM(t *testing.T) {
 			}, want[dirIdx], 1e-4)
 	}
 }
+
+func TestLSTMRagged(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	seqLen, featuresSize, hiddenSize := 4, 2, 3
+	dtype := dtypes.Float32
+	outputs := MustExecOnceN(backend, func(g *Graph) (ragged, truncated *Node) {
+		initializeFn := func(dims ...int) *Node {
+			v := IotaFull(g, shapes.Make(dtype, dims...))
+			v = MulScalar(v, 2.0/float64(v.Shape().Size()-1))
+			return AddScalar(v, -1)
+		}
+		inputsW := initializeFn(1, 4, hiddenSize, featuresSize)
+		recurrentW := initializeFn(1, 4, hiddenSize, hiddenSize)
+		biasW := initializeFn(1, 8, hiddenSize)
+
+		// Example 0 is dense, example 1 has only 2 steps, followed by padding with large values.
+		x0 := MulScalar(OnePlus(IotaFull(g, shapes.Make(dtype, seqLen, featuresSize))), 0.1)
+		x1 := Concatenate([]*Node{
+			Slice(x0, AxisRange(0, 2)),
+			Ones(g, shapes.Make(dtype, seqLen-2, featuresSize)),
+		}, 0)
+		x := Stack([]*Node{x0, x1}, 0)
+		lengths := Const(g, []int32{int32(seqLen), 2})
+		_, lastHidden, _ := NewWithWeights(x, inputsW, recurrentW, biasW, nil).Ragged(lengths).Done()
+		lastHidden.AssertDims(1, 2, hiddenSize)
+		ragged = Slice(lastHidden, AxisRange(), AxisElem(1))
+
+		// The same as running example 1 truncated to its length.
+		xTruncated := ExpandAxes(Slice(x0, AxisRange(0, 2)), 0)
+		_, truncated, _ = NewWithWeights(xTruncated, inputsW, recurrentW, biasW, nil).Done()
+		return
+	})
+	require.Equal(t, []int{1, 1, hiddenSize}, outputs[0].Shape().Dimensions)
+	want := outputs[1].Value().([][][]float32)[0][0]
+	got := outputs[0].Value().([][][]float32)[0][0]
+	require.InDeltaSlice(t, want, got, 1e-5)
+}
@@ -20,12 +20,16 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"slices"
+	"strings"
 
 	. "github.com/gomlx/gomlx/internal/exceptions"
 	. "github.com/gomlx/gomlx/pkg/core/graph"
 	"github.com/gomlx/gomlx/pkg/core/shapes"
 	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/initializers"
 	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
 )
 
 // This file contains all parts of the layers.MultiHeadAttention implementation.
@@ -37,6 +41,7 @@ type MultiHeadAttentionBuilder struct {
 	g                 *Graph
 	query, key, value *Node
 	numHeads          int
+	numKVHeads        int
 	keyQueryDim       int
 	valueDim          int
 	outputDim         int
@@ -47,6 +52,14 @@ type MultiHeadAttentionBuilder struct {
 	useProjectionBias bool
 	dropoutRate       float64
 
+	// Optional transformations of the attention.
+	queryKeyTransform func(projectedQuery, projectedKey *Node) (*Node, *Node)
+	attentionBias     *Node
+
+	// KV cache: if kvCacheMaxLength > 0, the projected keys and values are stored in a cache.
+	kvCacheMaxLength int
+	kvCachePosition  *Node
+
 	// Mask related attributes.
 	keyMask, queryMask *Node
 	queryKeyMatrixMask *Node
@@ -95,6 +108,7 @@ func MultiHeadAttention(ctx *context.Context, query, key, value *Node, numHeads
 		key:               key,
 		value:             value,
 		numHeads:          numHeads,
+		numKVHeads:        numHeads,
 		valueDim:          headDim,
 		keyQueryDim:       headDim,
 		innerKeyAxes:      innerKeyAxes,
@@ -257,6 +271,124 @@ func (b *MultiHeadAttentionBuilder) UseCausalMask() *MultiHeadAttentionBuilder {
 	return b
 }
 
+// SetQueryKeyTransform sets a function to transform the query and key after they are projected, and before
+// the attention logits (their dot-product) are calculated. It is used, for instance, to apply rotary
+// position embeddings (RoPE).
+//
+// The projectedQuery is shaped `[batch_size, <query_elements>, numHeads, keyQueryDim]` and the projectedKey is shaped
+// `[batch_size, <key_elements>, numKVHeads, keyQueryDim]`, and the returned values must have the same shapes.
+// If using UseKVCache, the transformation is applied to the keys before they are stored in the cache.
+func (b *MultiHeadAttentionBuilder) SetQueryKeyTransform(
+	transform func(projectedQuery, projectedKey *Node) (newQuery, newKey *Node)) *MultiHeadAttentionBuilder {
+	b.queryKeyTransform = transform
+	return b
+}
+
+// SetAttentionBias sets a bias added to the attention logits, before the softmax. It is used, for instance, for
+// ALiBi (Attention with Linear Biases) position encoding.
+//
+// The bias must have the same rank as the attention coefficients, `[batch_size, <query_elements>, numHeads, <key_elements>]`,
+// and each of its dimensions must either match or be 1, in which case it is broadcast.
+//
+// If using UseKVCache, the <key_elements> axis of the bias refers to the positions in the cache.
+func (b *MultiHeadAttentionBuilder) SetAttentionBias(bias *Node) *MultiHeadAttentionBuilder {
+	b.attentionBias = bias
+	b.checkAttentionBias()
+	return b
+}
+
+// checkAttentionBias checks that the attention bias, if set, is broadcastable to the attention shape.
+func (b *MultiHeadAttentionBuilder) checkAttentionBias() {
+	if b.attentionBias == nil {
+		return
+	}
+	shape := b.attentionBias.Shape()
+	if shape.Rank() != b.attentionShape.Rank() || shape.DType != b.attentionShape.DType {
+		Panicf("invalid attention bias shape %s, expected it to be broadcastable to %s",
+			shape, b.attentionShape)
+	}
+	for axis, dim := range shape.Dimensions {
+		if dim != 1 && dim != b.attentionShape.Dimensions[axis] {
+			Panicf("invalid attention bias shape %s, expected it to be broadcastable to %s",
+				shape, b.attentionShape)
+		}
+	}
+}
+
+// SetNumKVHeads sets the number of heads used for the key and value projections, for grouped-query
+// attention (GQA), as described in "GQA: Training Generalized Multi-Query Transformer Models from Multi-Head
+// Checkpoints", https://arxiv.org/abs/2305.13245. Each key/value head is shared by numHeads/numKVHeads query heads.
+// If set to 1, it is the multi-query attention (MQA).
+//
+// It reduces the size of the KV cache (see UseKVCache) by the factor numHeads/numKVHeads.
+//
+// numHeads must be divisible by numKVHeads. The default is numHeads, the standard multi-head attention.
+func (b *MultiHeadAttentionBuilder) SetNumKVHeads(numKVHeads int) *MultiHeadAttentionBuilder {
+	if numKVHeads < 1 || b.numHeads%numKVHeads != 0 {
+		Panicf("MultiHeadAttention numHeads (%d) must be divisible by numKVHeads (%d)", b.numHeads, numKVHeads)
+	}
+	b.numKVHeads = numKVHeads
+	return b
+}
+
+// KVCacheScope is the scope, under the MultiHeadAttention scope, where the KV cache variables are stored.
+// See MultiHeadAttentionBuilder.UseKVCache.
+const KVCacheScope = "kv_cache"
+
+// UseKVCache stores the projected keys and values (and the key mask, if one is set) in a cache of maxLength
+// elements, for incremental (autoregressive) decoding: the keys and values given are written to the cache at
+// the given position (with DynamicUpdateSlice), and the queries attend to all the cached elements up to
+// position + seq_len (exclusive).
+//
+// Typically, one calls it first with the full prompt at position 0 (the "prefill"), and then one token at
+// a time (decode steps), with the positions incremented accordingly. The position is a scalar integer Node,
+// usually fed as a parameter, so the graph is not recompiled for every step. position + seq_len must
+// be <= maxLength.
+//
+// It requires the query, key and value to be rank-3, `[batch_size, seq_len, dim]`, and the key mask, if set, to be
+// shaped `[batch_size, seq_len]` -- it is also cached.
+// If UseCausalMask is set, a query at (absolute) position `position+i` attends to the keys up to the same position.
+//
+// The cache is stored in non-trainable context variables in the scope KVCacheScope: they are created
+// with the shape `[batch_size, maxLength, numKVHeads, headDim]` on the first use, so the batch size can't
+// change afterward -- use ResetKVCache to remove them. Entries beyond position + seq_len are ignored, so
+// there is no need to clear the cache between sequences.
+func (b *MultiHeadAttentionBuilder) UseKVCache(maxLength int, position *Node) *MultiHeadAttentionBuilder {
+	if b.query.Rank() != 3 || b.key.Rank() != 3 || b.value.Rank() != 3 {
+		Panicf("MultiHeadAttention's UseKVCache requires query, key and value to be rank-3, got "+
+			"query.shape=%s, key.shape=%s and value.shape=%s", b.query.Shape(), b.key.Shape(), b.value.Shape())
+	}
+	if maxLength < b.key.Shape().Dim(1) {
+		Panicf("MultiHeadAttention's UseKVCache maxLength=%d is smaller than the key sequence length (key.shape=%s)",
+			maxLength, b.key.Shape())
+	}
+	if !position.Shape().IsScalar() || !position.DType().IsInt() {
+		Panicf("MultiHeadAttention's UseKVCache position must be a scalar integer, got position.shape=%s",
+			position.Shape())
+	}
+	b.kvCacheMaxLength = maxLength
+	b.kvCachePosition = position
+	b.buildAttentionShape()
+	b.checkAttentionBias()
+	return b
+}
+
+// ResetKVCache removes the KV cache variables (see MultiHeadAttentionBuilder.UseKVCache) of all the attention
+// layers under the ctx scope. They are re-created on the next use.
+//
+// This should not be called from a graph building function.
+func ResetKVCache(ctx *context.Context) {
+	var cacheVars []*context.Variable
+	for v := range ctx.IterVariablesInScope() {
+		if strings.HasSuffix(v.Scope(), context.ScopeSeparator+KVCacheScope) {
+			cacheVars = append(cacheVars, v)
+		}
+	}
+	for _, v := range cacheVars {
+		ctx.DeleteVariable(v.Scope(), v.Name())
+	}
+}
+
 // UseProjectionBias defines whether to use a bias term on the final output projection.
 // Default is true.
 func (b *MultiHeadAttentionBuilder) UseProjectionBias(useProjectionBias bool) *MultiHeadAttentionBuilder {
@@ -294,9 +426,22 @@ func nextNAxes(n int, nextAxis rune) string {
 // `coefficients` is shaped `[batch_size, <query_elements>, <num_heads>, <key_elements>]`
 // with the attention weights (from 0 to 1).
 func (b *MultiHeadAttentionBuilder) DoneWithCoefficients() (attentionOutput, attentionCoefficients *Node) {
-	projectedKey := Dense(b.ctx.In("key"), b.key, true, b.numHeads, b.keyQueryDim)
+	g := b.query.Graph()
+	g.PushScope(b.ctx.Scope())
+	defer g.PopScope()
+	projectedKey := Dense(b.ctx.In("key"), b.key, true, b.numKVHeads, b.keyQueryDim)
 	projectedQuery := Dense(b.ctx.In("query"), b.query, true, b.numHeads, b.keyQueryDim)
-	projectedValue := Dense(b.ctx.In("value"), b.value, true, b.numHeads, b.valueDim)
+	projectedValue := Dense(b.ctx.In("value"), b.value, true, b.numKVHeads, b.valueDim)
+	if b.queryKeyTransform != nil {
+		projectedQuery, projectedKey = b.queryKeyTransform(projectedQuery, projectedKey)
+	}
+	if b.kvCacheMaxLength > 0 {
+		projectedKey, projectedValue = b.updateKVCache(projectedKey, projectedValue)
+	}
+	if b.numKVHeads != b.numHeads {
+		projectedKey = repeatKVHeads(projectedKey, b.numHeads)
+		projectedValue = repeatKVHeads(projectedValue, b.numHeads)
+	}
 
 	// LearnedScale attentionLogits by 1/sqrt(keyQueryDim).
 	projectedQuery = Mul(projectedQuery, ConstAs(projectedQuery, 1.0/math.Sqrt(float64(b.keyQueryDim))))
@@ -328,6 +473,9 @@ func (b *MultiHeadAttentionBuilder) DoneWithCoefficients() (attentionOutput, att
 	attentionLogits := Einsum(attentionEquation, projectedQuery, projectedKey)
 	normalizingFactor := math.Sqrt(float64(b.keyQueryDim))
 	attentionLogits = DivScalar(attentionLogits, normalizingFactor)
+	if b.attentionBias != nil {
+		attentionLogits = Add(attentionLogits, BroadcastToDims(b.attentionBias, b.attentionShape.Dimensions...))
+	}
 	//fmt.Printf("\tattentionLogits: %s\n", attentionLogits.Shape())
 
 	mask := b.buildMask()
@@ -391,7 +539,10 @@ func (b *MultiHeadAttentionBuilder) buildAttentionShape() {
 	pos += b.innerQueryAxes
 	finalDims[pos] = b.numHeads
 	pos += 1
-	copy(finalDims[pos:], b.key.Shape().Dimensions[1:1+b.innerKeyAxes]) // <query_elements>
+	copy(finalDims[pos:], b.key.Shape().Dimensions[1:1+b.innerKeyAxes]) // <key_elements>
+	if b.kvCacheMaxLength > 0 {
+		finalDims[pos] = b.kvCacheMaxLength
+	}
 
 	b.attentionShape = shapes.Make(b.key.DType(), finalDims...)
 }
@@ -407,7 +558,12 @@ func (b *MultiHeadAttentionBuilder) buildMask() (mask *Node) {
 
 	// Combine causal mask.
 	if b.useCausalMask {
-		causalMask := b.buildCausalMask()
+		var causalMask *Node
+		if b.kvCacheMaxLength > 0 {
+			causalMask = b.buildCachedCausalMask()
+		} else {
+			causalMask = b.buildCausalMask()
+		}
 		if mask == nil {
 			mask = causalMask
 		} else {
@@ -459,3 +615,72 @@ func (b *MultiHeadAttentionBuilder) buildCausalMask() (mask *Node) {
 	mask = BroadcastToDims(mask, b.attentionShape.Dimensions...) // Broadcast to target dimensions.
 	return
 }
+
+// buildCachedCausalMask creates a mask where queries can only attend to keys in the cache with a position lower or
+// equal to its own (absolute) position.
+func (b *MultiHeadAttentionBuilder) buildCachedCausalMask() (mask *Node) {
+	seqLen := b.query.Shape().Dim(1)
+	maskShape := shapes.Make(dtypes.Int32, seqLen, b.kvCacheMaxLength)
+	queryPositions := Add(Iota(b.g, maskShape, 0), ConvertDType(b.kvCachePosition, dtypes.Int32))
+	keyPositions := Iota(b.g, maskShape, 1)
+	mask = LessOrEqual(keyPositions, queryPositions)
+
+	// Broadcast mask to target shape of `[batch, <query_elements>, numHeads, <key_elements>]`
+	mask = InsertAxes(mask, 0, 1)
+	mask = BroadcastToDims(mask, b.attentionShape.Dimensions...)
+	return
+}
+
+// updateKVCache writes the projected key and value (and the key mask) to the KV cache at the configured position,
+// and returns the full cached projected key and value. It also replaces the key mask by one covering the full
+// cache, masking out the entries not yet written.
+func (b *MultiHeadAttentionBuilder) updateKVCache(projectedKey, projectedValue *Node) (cachedKey, cachedValue *Node) {
+	g := b.g
+	// The cache variables are created on demand, independent of the context being set to Reuse.
+	ctx := b.ctx.In(KVCacheScope).Checked(false)
+	batchSize, seqLen := projectedKey.Shape().Dim(0), projectedKey.Shape().Dim(1)
+	position := ConvertDType(b.kvCachePosition, dtypes.Int32)
+	zero := ScalarZero(g, dtypes.Int32)
+
+	// update the cache variable with the given name with x, written at position.
+	update := func(name string, x *Node) *Node {
+		cacheShape := x.Shape().Clone()
+		cacheShape.Dimensions[1] = b.kvCacheMaxLength
+		if v := ctx.GetVariable(name); v != nil && !v.Shape().Equal(cacheShape) {
+			Panicf("MultiHeadAttention KV cache variable %q in scope %q has shape %s, but shape %s is required -- "+
+				"if the batch size changed, use layers.ResetKVCache", name, ctx.Scope(), v.Shape(), cacheShape)
+		}
+		cacheVar := ctx.WithInitializer(initializers.Zero).VariableWithShape(name, cacheShape).SetTrainable(false)
+		startIndices := xslices.SliceWithValue(x.Rank(), zero)
+		startIndices[1] = position
+		cache := DynamicUpdateSlice(cacheVar.ValueGraph(g), x, startIndices)
+		cacheVar.SetValueGraph(cache)
+		return cache
+	}
+	cachedKey = update("key", projectedKey)
+	cachedValue = update("value", projectedValue)
+
+	// Key mask: only the positions already written to the cache are valid.
+	keyMask := LessThan(Iota(g, shapes.Make(dtypes.Int32, b.kvCacheMaxLength), 0), AddScalar(position, seqLen))
+	keyMask = BroadcastToDims(InsertAxes(keyMask, 0), batchSize, b.kvCacheMaxLength)
+	if b.keyMask != nil {
+		if b.keyMask.Rank() != 2 {
+			Panicf("MultiHeadAttention with UseKVCache requires the key mask to be shaped [batch_size, seq_len], "+
+				"got keyMask.shape=%s", b.keyMask.Shape())
+		}
+		keyMask = LogicalAnd(keyMask, update("key_mask", b.keyMask))
+	}
+	b.keyMask = keyMask
+	return
+}
+
+// repeatKVHeads repeats each of the key/value heads of x, shaped `[batch, <elements>, numKVHeads, dim]`, so it
+// is shaped `[batch, <elements>, numHeads, dim]`. Used for grouped-query attention.
+func repeatKVHeads(x *Node, numHeads int) *Node {
+	dims := x.Shape().Dimensions
+	rank := x.Rank()
+	numKVHeads, dim := dims[rank-2], dims[rank-1]
+	expandedDims := append(slices.Clone(dims[:rank-1]), numHeads/numKVHeads, dim)
+	x = BroadcastToDims(InsertAxes(x, rank-1), expandedDims...)
+	return Reshape(x, append(slices.Clone(dims[:rank-2]), numHeads, dim)...)
+}
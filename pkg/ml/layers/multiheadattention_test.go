@@ -35,6 +35,7 @@ import (
 	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
 	"github.com/gomlx/gomlx/pkg/support/xslices"
 	"github.com/gomlx/gomlx/ui/commandline"
+	"github.com/gomlx/gopjrt/dtypes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -81,6 +82,68 @@ func TestMultiHeadAttentionGraph(t *testing.T) {
 		}, xslices.Epsilon)
 }
 
+func TestMultiHeadAttentionKVCache(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, seqLen, maxLength, dim, numHeads, numKVHeads = 2, 5, 8, 6, 4, 2
+	x := tensors.FromShape(shapes.Make(dtypes.Float32, batchSize, seqLen, dim))
+	tensors.MutableFlatData(x, func(flat []float32) {
+		for ii := range flat {
+			flat[ii] = float32(math.Sin(float64(ii)))
+		}
+	})
+	maskValues := [][]bool{{true, true, true, true, true}, {true, false, true, true, true}}
+	ctx := context.New()
+	attentionFn := func(ctx *context.Context, x, mask *Node) *MultiHeadAttentionBuilder {
+		return MultiHeadAttention(ctx, x, x, x, numHeads, 3).
+			SetNumKVHeads(numKVHeads).
+			SetKeyMask(mask).
+			UseCausalMask()
+	}
+
+	// Full sequence, no cache.
+	fullExec := context.MustNewExec(backend, ctx, func(ctx *context.Context, x, mask *Node) *Node {
+		return attentionFn(ctx, x, mask).Done()
+	})
+	want := fullExec.MustExec(x, maskValues)[0].Value().([][][]float32)
+	keyWeights := ctx.In("MultiHeadAttention").In("key").In("dense").GetVariable("weights")
+	require.NotNil(t, keyWeights)
+	require.NoError(t, keyWeights.Shape().Check(dtypes.Float32, dim, numKVHeads, 3))
+
+	// Prefill with the first 3 elements, and then decode one element at a time.
+	cachedExec := context.MustNewExec(backend, ctx.Reuse(), func(ctx *context.Context, x, mask, position *Node) *Node {
+		return attentionFn(ctx, x, mask).UseKVCache(maxLength, position).Done()
+	})
+	sliceX := func(from, to int) [][][]float32 {
+		values := x.Value().([][][]float32)
+		return [][][]float32{values[0][from:to], values[1][from:to]}
+	}
+	sliceMask := func(from, to int) [][]bool {
+		return [][]bool{maskValues[0][from:to], maskValues[1][from:to]}
+	}
+	const prefillLen = 3
+	got := cachedExec.MustExec(sliceX(0, prefillLen), sliceMask(0, prefillLen), int32(0))[0].Value().([][][]float32)
+	for batchIdx := range batchSize {
+		for pos := range prefillLen {
+			assert.InDeltaSlice(t, want[batchIdx][pos], got[batchIdx][pos], 1e-4, "batch=%d, pos=%d", batchIdx, pos)
+		}
+	}
+	for pos := prefillLen; pos < seqLen; pos++ {
+		got = cachedExec.MustExec(sliceX(pos, pos+1), sliceMask(pos, pos+1), int32(pos))[0].Value().([][][]float32)
+		for batchIdx := range batchSize {
+			assert.InDeltaSlice(t, want[batchIdx][pos], got[batchIdx][0], 1e-4, "batch=%d, pos=%d", batchIdx, pos)
+		}
+	}
+	cacheVar := ctx.In("MultiHeadAttention").In(KVCacheScope).GetVariable("key")
+	require.NotNil(t, cacheVar)
+	require.NoError(t, cacheVar.Shape().Check(dtypes.Float32, batchSize, maxLength, numKVHeads, 3))
+	assert.False(t, cacheVar.Trainable)
+
+	// Reset cache.
+	ResetKVCache(ctx)
+	assert.Nil(t, ctx.In("MultiHeadAttention").In(KVCacheScope).GetVariable("key"))
+	assert.NotNil(t, ctx.In("MultiHeadAttention").In("key").In("dense").GetVariable("weights"))
+}
+
 // buildSyntheticAttentionModelFn builds a model graph building function that does a regression on the elements
 // of a sequence, with a learnable positional embedding.
 //
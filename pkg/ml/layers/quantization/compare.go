@@ -0,0 +1,99 @@
+package quantization
+
+import (
+	"math"
+
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+// OutputsDelta measures the difference between the outputs of the original and the quantized models.
+// See CompareOutputs.
+type OutputsDelta struct {
+	// MaxAbsDiff is the maximum absolute difference of the outputs.
+	MaxAbsDiff float64
+
+	// RelativeError is the root of the sum of the squared differences, divided by the root of the sum of the
+	// squared original outputs.
+	RelativeError float64
+
+	// ArgMaxAgreement is the fraction of the examples whose largest output (ArgMax over the last axis) is
+	// the same: it's the classification accuracy of the quantized model measured against the original one.
+	ArgMaxAgreement float64
+}
+
+// CompareOutputs executes modelFn with the original and the quantized contexts on the same inputs, and measures
+// the difference of the first output.
+//
+// The modelFn can be any function accepted by context.NewExecAny, and the output must have a float dtype.
+// Usually, both contexts are configured with Context.Reuse, since they hold the variables of trained models.
+func CompareOutputs(backend backends.Backend, original, quantized *context.Context, modelFn any, inputs ...any) (*OutputsDelta, error) {
+	var outputs [2][]float64
+	var lastDim int
+	for ii, ctx := range []*context.Context{original, quantized} {
+		exec, err := context.NewExecAny(backend, ctx, modelFn)
+		if err != nil {
+			return nil, err
+		}
+		results, err := exec.Exec(inputs...)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to execute model")
+		}
+		output := results[0]
+		switch output.DType() {
+		case dtypes.Float32:
+			for _, value := range tensors.CopyFlatData[float32](output) {
+				outputs[ii] = append(outputs[ii], float64(value))
+			}
+		case dtypes.Float64:
+			outputs[ii] = tensors.CopyFlatData[float64](output)
+		default:
+			return nil, errors.Errorf("CompareOutputs requires the model output to be Float32 or Float64, got %s", output.Shape())
+		}
+		lastDim = 1
+		if output.Rank() > 0 {
+			lastDim = output.Shape().Dim(-1)
+		}
+	}
+	if len(outputs[0]) != len(outputs[1]) {
+		return nil, errors.Errorf("original model has %d output values, but the quantized model has %d",
+			len(outputs[0]), len(outputs[1]))
+	}
+
+	delta := &OutputsDelta{}
+	var sumDiff2, sumValue2 float64
+	for ii, value := range outputs[0] {
+		diff := value - outputs[1][ii]
+		delta.MaxAbsDiff = max(delta.MaxAbsDiff, math.Abs(diff))
+		sumDiff2 += diff * diff
+		sumValue2 += value * value
+	}
+	if sumValue2 > 0 {
+		delta.RelativeError = math.Sqrt(sumDiff2 / sumValue2)
+	}
+	numExamples := len(outputs[0]) / lastDim
+	var agreements int
+	for example := range numExamples {
+		if argMax(outputs[0][example*lastDim:(example+1)*lastDim]) == argMax(outputs[1][example*lastDim:(example+1)*lastDim]) {
+			agreements++
+		}
+	}
+	if numExamples > 0 {
+		delta.ArgMaxAgreement = float64(agreements) / float64(numExamples)
+	}
+	return delta, nil
+}
+
+// argMax returns the index of the largest value.
+func argMax(values []float64) int {
+	best := 0
+	for ii, value := range values {
+		if value > values[best] {
+			best = ii
+		}
+	}
+	return best
+}
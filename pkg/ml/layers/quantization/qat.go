@@ -0,0 +1,106 @@
+package quantization
+
+import (
+	"slices"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+)
+
+// This file implements quantization-aware training (QAT).
+
+const (
+	// ParamQATBits context hyperparameter enables quantization-aware training (QAT): if set to 8 or 4,
+	// layers.Dense and layers.Convolution (and the layers built on them) fake-quantize (see graph.FakeQuantizeSymmetric)
+	// their weights per-channel, as they will be quantized by ExportQAT. So the model learns to be robust to the
+	// quantization.
+	//
+	// The value should be an int. The default is 0, which disables QAT.
+	ParamQATBits = "qat_bits"
+
+	// ParamQATActivations context hyperparameter, if set to true, makes the layers using QAT (see ParamQATBits)
+	// also fake-quantize their inputs, with 8 bits, per-tensor and asymmetric (see graph.FakeQuantize).
+	// The ranges are learned, in the variables "qat_min" and "qat_max" of the layer's scope, initialized to [-6, 6].
+	//
+	// The default is false.
+	ParamQATActivations = "qat_activations"
+
+	// ActivationBits is the number of bits used to fake-quantize the inputs with ParamQATActivations.
+	ActivationBits = 8
+)
+
+// QATBits returns the number of bits configured for quantization-aware training with ParamQATBits,
+// or 0 if it is disabled.
+func QATBits(ctx *context.Context) int {
+	bits := context.GetParamOr(ctx, ParamQATBits, 0)
+	if bits != 0 && bits != 8 && bits != 4 {
+		Panicf("context parameter %q must be 0 (disabled), 8 or 4, got %d", ParamQATBits, bits)
+	}
+	return bits
+}
+
+// FakeQuantizeWeights fake-quantizes the weights of a layer if quantization-aware training is enabled
+// (see ParamQATBits), otherwise it returns the weights unchanged.
+//
+// The weights are quantized symmetrically, with one scale per element of the channelAxes (see DenseChannelAxes and
+// ConvChannelAxes), with the range given by the maximum absolute value -- exactly as they will be quantized by
+// ExportQAT.
+func FakeQuantizeWeights(ctx *context.Context, weights *Node, channelAxes ...int) *Node {
+	bits := QATBits(ctx)
+	if bits == 0 {
+		return weights
+	}
+	bits = EffectiveBits(weights.Shape(), bits)
+	var reduceAxes []int
+	for axis := range weights.Rank() {
+		if !slices.Contains(channelAxes, axis) {
+			reduceAxes = append(reduceAxes, axis)
+		}
+	}
+	maxAbs := ReduceAndKeep(Abs(weights), ReduceMax, reduceAxes...)
+	return FakeQuantizeSymmetric(weights, maxAbs, bits)
+}
+
+// FakeQuantizeInput fake-quantizes the input of a layer if quantization-aware training is enabled
+// (see ParamQATBits) and ParamQATActivations is set, otherwise it returns x unchanged.
+//
+// The learnable range is stored in the variables "qat_min" and "qat_max", in the current scope of ctx.
+func FakeQuantizeInput(ctx *context.Context, x *Node) *Node {
+	if QATBits(ctx) == 0 || !context.GetParamOr(ctx, ParamQATActivations, false) {
+		return x
+	}
+	g := x.Graph()
+	scalarShape := shapes.Make(x.DType())
+	minVar := ctx.WithInitializer(constantInitializer(-6)).VariableWithShape("qat_min", scalarShape)
+	maxVar := ctx.WithInitializer(constantInitializer(6)).VariableWithShape("qat_max", scalarShape)
+	return FakeQuantize(x, minVar.ValueGraph(g), maxVar.ValueGraph(g), ActivationBits)
+}
+
+// constantInitializer returns an initializer that sets the variables to the given value.
+func constantInitializer(value float64) context.VariableInitializer {
+	return func(g *Graph, shape shapes.Shape) *Node {
+		return BroadcastToShape(Scalar(g, shape.DType, value), shape)
+	}
+}
+
+// ExportQAT converts the weights of a model trained with quantization-aware training (see ParamQATBits) to
+// the quantized format for inference, in place. The quantized weights are the same as the fake-quantized weights
+// used in training.
+//
+// The inputs (activations) are still fake-quantized during inference, if ParamQATActivations is set.
+// The embedding tables, not quantized during training, are not quantized.
+// The convolution kernels are assumed to use the default images.ChannelsLast layout: for other layouts use
+// New(ctx).Bits(QATBits(ctx)).Embeddings(false).ChannelsAxis(...).Done() instead.
+//
+// It returns a Report with the memory used and the quantization error of each variable.
+func ExportQAT(ctx *context.Context) (*Report, error) {
+	bits := QATBits(ctx)
+	if bits == 0 {
+		return nil, errors.Errorf("ExportQAT requires the context parameter %q to be set to the number of bits "+
+			"used in quantization-aware training", ParamQATBits)
+	}
+	return New(ctx).Bits(bits).Embeddings(false).Done()
+}
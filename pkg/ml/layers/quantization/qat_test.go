@@ -0,0 +1,87 @@
+package quantization_test
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/activations"
+	"github.com/gomlx/gomlx/pkg/ml/layers/quantization"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// convModel embeds the tokens, applies a 1D convolution and classifies the mean of the features.
+func convModel(ctx *context.Context, tokens *Node) *Node {
+	x := layers.Embedding(ctx.In("embeddings"), tokens, dtypes.Float32, vocabSize, embedDim)
+	x = layers.Convolution(ctx.In("conv"), x).Channels(8).KernelSize(3).PadSame().Done()
+	x = ReduceMean(activations.Relu(x), 1)
+	return layers.Dense(ctx.In("logits"), x, true, numClasses)
+}
+
+func TestQAT(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	tokens := makeTokens(16, 6)
+	for _, bits := range []int{8, 4} {
+		ctx := context.New()
+		ctx.SetParam(context.ParamInitialSeed, int64(42))
+		ctx.SetParam(quantization.ParamQATBits, bits)
+		ctx.SetParam(quantization.ParamQATActivations, true)
+		_ = context.MustExecOnce(backend, ctx, convModel, tokens)
+		ctx = ctx.Reuse()
+
+		// The fake-quantized weights of the Dense layer are integer multiples of the per-column scale.
+		maxLevel := float64(int(1)<<(bits-1) - 1)
+		fakeQuantized := context.MustExecOnce(backend, ctx, func(ctx *context.Context, g *Graph) *Node {
+			weights := ctx.In("logits").In("dense").GetVariable("weights").ValueGraph(g)
+			return quantization.FakeQuantizeWeights(ctx, weights, quantization.DenseChannelAxes(2)...)
+		})
+		weights := tensors.CopyFlatData[float32](ctx.In("logits").In("dense").GetVariable("weights").Value())
+		columnMaxAbs := make([]float64, numClasses)
+		for ii, value := range weights {
+			columnMaxAbs[ii%numClasses] = max(columnMaxAbs[ii%numClasses], math.Abs(float64(value)))
+		}
+		for ii, value := range tensors.CopyFlatData[float32](fakeQuantized) {
+			level := float64(value) / (columnMaxAbs[ii%numClasses] / maxLevel)
+			require.InDelta(t, math.Round(level), level, 1e-3)
+		}
+
+		// Gradients (straight-through) reach all trainable variables, including the learned activation ranges.
+		gradients := context.MustExecOnceN(backend, ctx, func(ctx *context.Context, tokens *Node) []*Node {
+			logits := convModel(ctx, tokens)
+			loss := ReduceAllMean(Square(Sub(logits, OnesLike(logits))))
+			return ctx.BuildTrainableVariablesGradientsGraph(loss)
+		}, tokens)
+		var numNonZero int
+		for _, grad := range gradients {
+			for _, value := range tensors.CopyFlatData[float32](grad) {
+				require.False(t, math.IsNaN(float64(value)))
+				if value != 0 {
+					numNonZero++
+					break
+				}
+			}
+		}
+		assert.Equal(t, len(gradients), numNonZero, "all variables should have non-zero gradients")
+		require.NotNil(t, ctx.In("conv").In("conv").GetVariable("qat_min"))
+
+		// Exporting produces the same outputs.
+		want := context.MustExecOnce(backend, ctx, convModel, tokens)
+		report, err := quantization.ExportQAT(ctx)
+		require.NoError(t, err)
+		require.Len(t, report.Variables, 2) // The conv kernel and logits weights: embeddings are not quantized.
+		require.NotNil(t, quantization.Get(ctx.In("conv").In("conv"), "weights"))
+		require.NotNil(t, ctx.In("embeddings").GetVariable("embeddings"))
+		got := context.MustExecOnce(backend, ctx, convModel, tokens)
+		require.True(t, want.InDelta(got, 1e-4), "want %s\ngot %s", want, got)
+	}
+
+	// ExportQAT requires ParamQATBits.
+	_, err := quantization.ExportQAT(context.New())
+	require.Error(t, err)
+}
@@ -0,0 +1,452 @@
+// Package quantization implements post-training quantization and quantization-aware training (QAT) of the
+// weights of a model, to reduce its memory footprint for inference.
+//
+// Config.Done (see New) converts the variables of the layers.Dense ("weights"), layers.Convolution (the kernels) and
+// layers.Embedding ("embeddings") layers -- and hence also of the layers built on them, like
+// layers.MultiHeadAttention -- in a trained context.Context to symmetric per-channel int8 (or int4) values with a
+// float scale per channel. That is, the original value is approximated by `scale * quantizedValue`.
+//
+// The quantized variables replace the original ones in the context, and the layers dequantize them on the fly
+// when building the graph. Saving the context with a checkpoint (see package checkpoints) saves the quantized
+// variables, so models can be loaded for inference with about a quarter of the memory (an eighth for int4).
+//
+// Example:
+//
+//	ctx := context.New()
+//	_ = checkpoints.Build(ctx).Dir(trainedModelDir).Immediate().MustDone()
+//	report, err := quantization.New(ctx).Done()
+//	if err != nil { … }
+//	fmt.Println(report)
+//	checkpoint := checkpoints.Build(ctx).Dir(quantizedModelDir).MustDone()
+//	err = checkpoint.Save()
+//
+// Notice quantized variables are meant for inference only: they are not trainable.
+// See CompareOutputs to measure the change in the model outputs after quantization.
+//
+// For quantization-aware training, set the ParamQATBits context hyperparameter during training, and
+// convert the trained model with ExportQAT.
+package quantization
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Int8Suffix is appended to the name of the original variable to name the variable holding its int8 quantized
+	// values, with the same shape as the original variable.
+	Int8Suffix = "_int8"
+
+	// Int4Suffix is appended to the name of the original variable to name the variable holding its int4 quantized
+	// values. They are packed, two per byte, along the last axis in a Uint8 variable: so the last dimension is
+	// half of the original variable's.
+	Int4Suffix = "_int4"
+
+	// ScalesSuffix is appended to the name of the original variable to name the variable holding the quantization
+	// scales. They have the same rank and dtype as the original variable, with dimension 1 on the axes other than
+	// the channel axes.
+	ScalesSuffix = "_scales"
+)
+
+// Config for the post-training quantization of a context. Create it with New, configure it and
+// then call Done to quantize the variables.
+type Config struct {
+	ctx          *context.Context
+	bits         int
+	minSize      int
+	embeddings   bool
+	channelsAxis images.ChannelsAxisConfig
+}
+
+// New creates a configuration to quantize the weights of the layers.Dense, layers.Convolution and layers.Embedding variables
+// in ctx (in all scopes). Once configured, call Config.Done to quantize them.
+//
+// The default is to quantize to int8.
+func New(ctx *context.Context) *Config {
+	return &Config{
+		ctx:          ctx,
+		bits:         8,
+		embeddings:   true,
+		channelsAxis: images.ChannelsLast,
+	}
+}
+
+// Bits configures the number of bits of the quantized values: it must be 8 or 4.
+// Variables whose last dimension is odd can't be packed in int4, and they are quantized to int8 instead.
+//
+// The default is 8.
+func (c *Config) Bits(bits int) *Config {
+	if bits != 8 && bits != 4 {
+		Panicf("quantization.Config.Bits must be 8 or 4, got %d", bits)
+	}
+	c.bits = bits
+	return c
+}
+
+// MinSize configures the minimum number of elements of a variable to be quantized: smaller variables are kept
+// unchanged, since they don't save much memory.
+//
+// The default is 0, meaning all variables are quantized.
+func (c *Config) MinSize(minSize int) *Config {
+	c.minSize = minSize
+	return c
+}
+
+// Embeddings configures whether to quantize the layers.Embedding tables.
+//
+// The default is true.
+func (c *Config) Embeddings(quantizeEmbeddings bool) *Config {
+	c.embeddings = quantizeEmbeddings
+	return c
+}
+
+// ChannelsAxis configures the channels axis configuration used by the layers.Convolution layers of the model,
+// which defines the layout of their kernels, and hence their output channels axis, quantized per channel.
+// See ConvChannelAxes.
+//
+// The default is images.ChannelsLast, the default of layers.Convolution.
+func (c *Config) ChannelsAxis(channelsAxisConfig images.ChannelsAxisConfig) *Config {
+	c.channelsAxis = channelsAxisConfig
+	return c
+}
+
+// target describes how a variable is quantized.
+type target struct {
+	v *context.Variable
+	// channelAxes are the axes with an independent scale for each element.
+	channelAxes []int
+}
+
+// convScopes are the scope names of the convolution layers, and the names of their kernel variables.
+var convScopes = map[string][]string{
+	"conv":           {"weights"},
+	"conv_transpose": {"weights"},
+	"depthwise_conv": {"weights"},
+	"separable_conv": {"depthwise_weights", "pointwise_weights"},
+}
+
+// targets returns the variables in the context to be quantized.
+func (c *Config) targets() []target {
+	var targets []target
+	for v := range c.ctx.IterVariables() {
+		if !v.DType().IsFloat() || v.Shape().Rank() < 2 || v.Shape().Size() < c.minSize {
+			continue
+		}
+		scopeParts := strings.Split(v.Scope(), context.ScopeSeparator)
+		scopeName := scopeParts[len(scopeParts)-1]
+		switch {
+		case v.Name() == "weights" && scopeName == "dense":
+			targets = append(targets, target{v: v, channelAxes: DenseChannelAxes(v.Shape().Rank())})
+		case v.Name() == "embeddings" && v.Shape().Rank() == 2 && c.embeddings:
+			targets = append(targets, target{v: v, channelAxes: []int{0}})
+		case slices.Contains(convScopes[scopeName], v.Name()):
+			channelAxes := ConvChannelAxes(v.Shape().Rank(), c.channelsAxis, scopeName == "conv_transpose")
+			targets = append(targets, target{v: v, channelAxes: channelAxes})
+		}
+	}
+	return targets
+}
+
+// DenseChannelAxes returns the axes of the layers.Dense weights quantized per channel: the output axes.
+func DenseChannelAxes(rank int) []int {
+	return xslices.Iota(1, rank-1)
+}
+
+// ConvChannelAxes returns the axes of the layers.Convolution kernels quantized per channel: the axis of the output
+// channels of the layer.
+//
+// For convolutions, it is the graph.ConvolveAxesConfig.KernelOutputChannels axis for the given channels axis
+// configuration (see graph.ConvolutionBuilder.ChannelsAxis): the first axis for images.ChannelsFirst, and
+// the last axis for images.ChannelsLast.
+//
+// Transposed convolution kernels (see layers.ConvBuilder.Transposed) hold the output channels of the layer
+// in the kernel input channels axis instead: the second axis for images.ChannelsFirst, and the one before last for
+// images.ChannelsLast.
+func ConvChannelAxes(rank int, channelsAxisConfig images.ChannelsAxisConfig, transposed bool) []int {
+	outputChannelsAxis := rank - 1
+	if channelsAxisConfig == images.ChannelsFirst {
+		outputChannelsAxis = 0
+	}
+	if transposed {
+		if channelsAxisConfig == images.ChannelsFirst {
+			outputChannelsAxis = 1
+		} else {
+			outputChannelsAxis = rank - 2
+		}
+	}
+	return []int{outputChannelsAxis}
+}
+
+// EffectiveBits returns the number of bits used to quantize a variable of the given shape: int4 values are packed
+// in pairs along the last axis, so if its dimension is odd, they are quantized to 8 bits instead.
+func EffectiveBits(shape shapes.Shape, bits int) int {
+	if bits == 4 && shape.Dim(-1)%2 != 0 {
+		return 8
+	}
+	return bits
+}
+
+// Done quantizes the selected variables of the context, replacing them (in place) by the quantized values and
+// their scales.
+//
+// It returns a Report with the memory used and the quantization error of each variable.
+func (c *Config) Done() (*Report, error) {
+	report := &Report{}
+	for _, t := range c.targets() {
+		var varReport VariableReport
+		err := TryCatch[error](func() { varReport = c.quantizeVariable(t) })
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to quantize variable %q", t.v.ScopeAndName())
+		}
+		report.Variables = append(report.Variables, varReport)
+		report.OriginalMemory += varReport.OriginalMemory
+		report.QuantizedMemory += varReport.QuantizedMemory
+	}
+	return report, nil
+}
+
+// quantizeVariable quantizes one variable, and replaces it in the context.
+func (c *Config) quantizeVariable(t target) VariableReport {
+	v := t.v
+	shape := v.Shape()
+	bits := EffectiveBits(shape, c.bits)
+	var values []float64
+	switch shape.DType {
+	case dtypes.Float32:
+		values = make([]float64, shape.Size())
+		for ii, value := range tensors.CopyFlatData[float32](v.Value()) {
+			values[ii] = float64(value)
+		}
+	case dtypes.Float64:
+		values = tensors.CopyFlatData[float64](v.Value())
+	default:
+		Panicf("dtype %s not supported for quantization", shape.DType)
+	}
+
+	// Scales shape: the axes other than the channel axes have dimension 1.
+	scalesShape := shape.Clone()
+	for axis := range shape.Rank() {
+		if !slices.Contains(t.channelAxes, axis) {
+			scalesShape.Dimensions[axis] = 1
+		}
+	}
+	numChannels := scalesShape.Size()
+	channels := make([]int, len(values)) // Index of the channel (scale) for each value.
+	{
+		scalesStrides := scalesShape.Strides()
+		indices := make([]int, shape.Rank())
+		for ii := range channels {
+			for axis, idx := range indices {
+				if scalesShape.Dimensions[axis] != 1 {
+					channels[ii] += idx * scalesStrides[axis]
+				}
+			}
+			for axis := shape.Rank() - 1; axis >= 0; axis-- {
+				indices[axis]++
+				if indices[axis] < shape.Dimensions[axis] {
+					break
+				}
+				indices[axis] = 0
+			}
+		}
+	}
+
+	// Symmetric quantization: the scale is such that the largest absolute value of the channel is mapped to maxQ.
+	maxQ := float64(int(1)<<(bits-1) - 1)
+	scales := make([]float64, numChannels)
+	for ii, value := range values {
+		scales[channels[ii]] = max(scales[channels[ii]], math.Abs(value))
+	}
+	for channel, maxAbs := range scales {
+		scales[channel] = maxAbs / maxQ
+	}
+	quantized := make([]int8, len(values))
+	var sumErr2, sumValue2 float64
+	report := VariableReport{
+		Scope:          v.Scope(),
+		Name:           v.Name(),
+		Shape:          shape,
+		Bits:           bits,
+		OriginalMemory: shape.Memory(),
+	}
+	for ii, value := range values {
+		scale := scales[channels[ii]]
+		if scale == 0 {
+			continue
+		}
+		q := math.Max(-maxQ, math.Min(maxQ, math.Round(value/scale)))
+		quantized[ii] = int8(q)
+		diff := value - q*scale
+		sumErr2 += diff * diff
+		sumValue2 += value * value
+		report.MaxAbsError = max(report.MaxAbsError, math.Abs(diff))
+	}
+	if sumValue2 > 0 {
+		report.RelativeError = math.Sqrt(sumErr2 / sumValue2)
+	}
+
+	// Create the new variables and remove the original one.
+	ctx := c.ctx.InAbsPath(v.Scope()).Checked(false)
+	var valuesT *tensors.Tensor
+	suffix := Int8Suffix
+	if bits == 8 {
+		valuesT = tensors.FromFlatDataAndDimensions(quantized, shape.Dimensions...)
+	} else {
+		suffix = Int4Suffix
+		packed := make([]uint8, len(quantized)/2)
+		for ii := range packed {
+			packed[ii] = uint8(quantized[2*ii]+8) | uint8(quantized[2*ii+1]+8)<<4
+		}
+		packedDims := shape.Clone().Dimensions
+		packedDims[len(packedDims)-1] /= 2
+		valuesT = tensors.FromFlatDataAndDimensions(packed, packedDims...)
+	}
+	scalesT := tensors.FromShape(shapes.Make(shape.DType, scalesShape.Dimensions...))
+	switch shape.DType {
+	case dtypes.Float32:
+		tensors.MutableFlatData[float32](scalesT, func(flat []float32) {
+			for ii, scale := range scales {
+				flat[ii] = float32(scale)
+			}
+		})
+	case dtypes.Float64:
+		tensors.AssignFlatData(scalesT, scales)
+	}
+	name := v.Name()
+	c.ctx.DeleteVariable(v.Scope(), name)
+	ctx.VariableWithValue(name+suffix, valuesT).SetTrainable(false)
+	ctx.VariableWithValue(name+ScalesSuffix, scalesT).SetTrainable(false)
+	report.QuantizedMemory = valuesT.Memory() + scalesT.Memory()
+	return report
+}
+
+// Report of the quantization of a context, returned by Config.Done.
+type Report struct {
+	// Variables quantized.
+	Variables []VariableReport
+
+	// OriginalMemory and QuantizedMemory used by the quantized variables, in bytes.
+	OriginalMemory, QuantizedMemory uintptr
+}
+
+// VariableReport holds the results of the quantization of one variable.
+type VariableReport struct {
+	Scope, Name string
+	Shape       shapes.Shape
+	Bits        int
+
+	// OriginalMemory and QuantizedMemory (including the scales) used by the variable, in bytes.
+	OriginalMemory, QuantizedMemory uintptr
+
+	// MaxAbsError is the maximum absolute difference between the original and the dequantized values.
+	MaxAbsError float64
+
+	// RelativeError is the root of the sum of the squared errors, divided by the root of the sum of the
+	// squared original values.
+	RelativeError float64
+}
+
+// String implements fmt.Stringer, with one line per variable.
+func (r *Report) String() string {
+	var sb strings.Builder
+	for _, v := range r.Variables {
+		_, _ = fmt.Fprintf(&sb, "%s: %s -> int%d, %d -> %d bytes, max abs error=%.3g, relative error=%.3g\n",
+			context.JoinScope(v.Scope, v.Name), v.Shape, v.Bits, v.OriginalMemory, v.QuantizedMemory,
+			v.MaxAbsError, v.RelativeError)
+	}
+	ratio := 0.0
+	if r.OriginalMemory > 0 {
+		ratio = float64(r.QuantizedMemory) / float64(r.OriginalMemory)
+	}
+	_, _ = fmt.Fprintf(&sb, "%d variables quantized: %d -> %d bytes (%.1f%%)",
+		len(r.Variables), r.OriginalMemory, r.QuantizedMemory, 100*ratio)
+	return sb.String()
+}
+
+// Variable holds the quantized values and scales of a variable quantized with Config.Done.
+//
+// The layers supporting quantization use Get to check whether their variables were quantized.
+type Variable struct {
+	// Values holds the quantized values: Int8 for 8 bits, or Uint8 with two values per byte for 4 bits.
+	Values *context.Variable
+
+	// Scales to multiply the values to get the original values.
+	Scales *context.Variable
+
+	// Bits of the quantized values: 8 or 4.
+	Bits int
+}
+
+// Get returns the quantized Variable for the variable with the given name in the current scope of ctx,
+// or nil if it has not been quantized.
+//
+// It triggers the loading of the variables, if a loader (like a checkpoint) is attached to the context.
+func Get(ctx *context.Context, name string) *Variable {
+	for _, bits := range []int{8, 4} {
+		suffix := Int8Suffix
+		if bits == 4 {
+			suffix = Int4Suffix
+		}
+		values := ctx.GetVariable(name + suffix)
+		if values == nil {
+			continue
+		}
+		scales := ctx.GetVariable(name + ScalesSuffix)
+		if scales == nil {
+			Panicf("quantized variable %q in scope %q has no scales variable %q", name+suffix, ctx.Scope(), name+ScalesSuffix)
+		}
+		return &Variable{Values: values, Scales: scales, Bits: bits}
+	}
+	return nil
+}
+
+// Dequantize returns the original value of the variable approximated from its quantized values, converted
+// to dtype.
+func (qv *Variable) Dequantize(g *Graph, dtype dtypes.DType) *Node {
+	values := qv.unpack(qv.Values.ValueGraph(g), dtype)
+	scales := ConvertDType(qv.Scales.ValueGraph(g), dtype)
+	return Mul(values, BroadcastToDims(scales, values.Shape().Dimensions...))
+}
+
+// Gather is equivalent to `Gather(qv.Dequantize(g, dtype), indices)`, but it only dequantizes the gathered rows.
+//
+// The variable must have been quantized with a scale per row (per element of the first axis), like the
+// layers.Embedding table.
+func (qv *Variable) Gather(indices *Node, dtype dtypes.DType, indicesAreSorted ...bool) *Node {
+	g := indices.Graph()
+	scales := qv.Scales.ValueGraph(g)
+	if scales.Shape().Size() != scales.Shape().Dim(0) {
+		Panicf("quantization.Variable.Gather requires one scale per row, got scales shaped %s", scales.Shape())
+	}
+	values := qv.unpack(Gather(qv.Values.ValueGraph(g), indices, indicesAreSorted...), dtype)
+	scales = ConvertDType(Gather(scales, indices, indicesAreSorted...), dtype)
+	return Mul(values, BroadcastToDims(scales, values.Shape().Dimensions...))
+}
+
+// unpack converts the quantized values to dtype, unpacking the int4 values if needed.
+func (qv *Variable) unpack(values *Node, dtype dtypes.DType) *Node {
+	if qv.Bits == 8 {
+		return ConvertDType(values, dtype)
+	}
+	// Two values per byte (low bits first), offset by 8.
+	g := values.Graph()
+	values = ConvertDType(values, dtypes.Int32)
+	sixteen := Scalar(g, dtypes.Int32, 16)
+	low := AddScalar(Rem(values, sixteen), -8)
+	high := AddScalar(Div(values, sixteen), -8)
+	dims := values.Shape().Clone().Dimensions
+	dims[len(dims)-1] *= 2
+	return ConvertDType(Reshape(Stack([]*Node{low, high}, -1), dims...), dtype)
+}
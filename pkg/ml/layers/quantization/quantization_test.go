@@ -0,0 +1,157 @@
+package quantization_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/quantization"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+const vocabSize, embedDim, numClasses = 32, 32, 10
+
+// classifierModel embeds the tokens, applies self-attention and classifies the mean of the embeddings.
+func classifierModel(ctx *context.Context, tokens *Node) *Node {
+	x := layers.Embedding(ctx.In("embeddings"), tokens, dtypes.Float32, vocabSize, embedDim)
+	x = layers.MultiHeadAttention(ctx.In("attention"), x, x, x, 4, 16).Done()
+	x = ReduceMean(x, 1)
+	return layers.Dense(ctx.In("logits"), x, true, numClasses)
+}
+
+func makeTokens(batchSize, seqLen int) *tensors.Tensor {
+	tokens := make([]int32, batchSize*seqLen)
+	for ii := range tokens {
+		tokens[ii] = int32((ii*7 + ii/seqLen*3) % vocabSize)
+	}
+	return tensors.FromFlatDataAndDimensions(tokens, batchSize, seqLen)
+}
+
+func TestQuantize(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.SetParam(context.ParamInitialSeed, int64(42))
+	tokens := makeTokens(64, 6)
+	_ = context.MustExecOnce(backend, ctx, classifierModel, tokens)
+	ctx = ctx.Reuse()
+
+	for _, bits := range []int{8, 4} {
+		quantizedCtx := ctx.Clone()
+		report, err := quantization.New(quantizedCtx).Bits(bits).Done()
+		require.NoError(t, err)
+		fmt.Printf("Quantization to %d bits:\n%s\n", bits, report)
+		// embeddings, key, query, value, output and logits dense layers.
+		require.Len(t, report.Variables, 6)
+		ratio := float64(report.QuantizedMemory) / float64(report.OriginalMemory)
+		maxRelativeError := 0.01
+		if bits == 4 {
+			maxRelativeError = 0.2
+			assert.Less(t, ratio, 0.2)
+		} else {
+			assert.Less(t, ratio, 0.3)
+		}
+		for _, v := range report.Variables {
+			assert.Equal(t, bits, v.Bits)
+			assert.Less(t, v.RelativeError, maxRelativeError, "variable %s/%s", v.Scope, v.Name)
+		}
+		require.Nil(t, quantizedCtx.In("logits").In("dense").GetVariable("weights"))
+		require.NotNil(t, quantization.Get(quantizedCtx.In("logits").In("dense"), "weights"))
+
+		delta, err := quantization.CompareOutputs(backend, ctx, quantizedCtx, classifierModel, tokens)
+		require.NoError(t, err)
+		fmt.Printf("\toutputs delta: %+v\n", *delta)
+		assert.Less(t, delta.RelativeError, 2*maxRelativeError)
+		if bits == 8 {
+			assert.GreaterOrEqual(t, delta.ArgMaxAgreement, 0.9)
+		}
+	}
+}
+
+func TestQuantizedCheckpoint(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	tokens := makeTokens(8, 5)
+	_ = context.MustExecOnce(backend, ctx, classifierModel, tokens)
+	originalMemory := ctx.Memory()
+	_, err := quantization.New(ctx).Done()
+	require.NoError(t, err)
+	want := context.MustExecOnce(backend, ctx.Reuse(), classifierModel, tokens)
+
+	// Save and reload the quantized model.
+	checkpoint, err := checkpoints.Build(ctx).TempDir("", "test_quantization_").Done()
+	require.NoError(t, err)
+	require.NoError(t, checkpoint.Save())
+	loadedCtx := context.New()
+	_, err = checkpoints.Build(loadedCtx).Dir(checkpoint.Dir()).Immediate().Done()
+	require.NoError(t, err)
+	loadedMemory := loadedCtx.Memory()
+	fmt.Printf("Memory: original=%d bytes, quantized=%d bytes\n", originalMemory, loadedMemory)
+	assert.Less(t, float64(loadedMemory), 0.3*float64(originalMemory))
+
+	got := context.MustExecOnce(backend, loadedCtx.Reuse(), classifierModel, tokens)
+	require.True(t, want.InDelta(got, 1e-6), "want %s\ngot %s", want, got)
+}
+
+func TestQuantizeConvolution(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const inputChannels, outputChannels = 4, 6
+	testCases := []struct {
+		name         string
+		channelsAxis images.ChannelsAxisConfig
+		transposed   bool
+		scalesDims   []int
+	}{
+		{"conv/channels-last", images.ChannelsLast, false, []int{1, 1, 1, outputChannels}},
+		{"conv/channels-first", images.ChannelsFirst, false, []int{outputChannels, 1, 1, 1}},
+		{"conv_transpose/channels-last", images.ChannelsLast, true, []int{1, 1, outputChannels, 1}},
+		{"conv_transpose/channels-first", images.ChannelsFirst, true, []int{1, outputChannels, 1, 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.New()
+			ctx.SetParam(context.ParamInitialSeed, int64(42))
+			modelFn := func(ctx *context.Context, x *Node) *Node {
+				convFn := layers.Convolution
+				if tc.transposed {
+					convFn = layers.ConvTranspose
+				}
+				return convFn(ctx, x).Channels(outputChannels).KernelSize(3).ChannelsAxis(tc.channelsAxis).Done()
+			}
+			inputDims := []int{2, 5, 5, inputChannels}
+			if tc.channelsAxis == images.ChannelsFirst {
+				inputDims = []int{2, inputChannels, 5, 5}
+			}
+			x := tensors.FromShape(shapes.Make(dtypes.Float32, inputDims...))
+			tensors.MutableFlatData[float32](x, func(flat []float32) {
+				for ii := range flat {
+					flat[ii] = float32(ii%7) / 7
+				}
+			})
+			want := context.MustExecOnce(backend, ctx, modelFn, x)
+			quantizedCtx := ctx.Clone()
+			_, err := quantization.New(quantizedCtx).ChannelsAxis(tc.channelsAxis).Done()
+			require.NoError(t, err)
+
+			scopeName := "conv"
+			if tc.transposed {
+				scopeName = "conv_transpose"
+			}
+			qv := quantization.Get(quantizedCtx.In(scopeName), "weights")
+			require.NotNil(t, qv)
+			assert.Equal(t, tc.scalesDims, qv.Scales.Shape().Dimensions)
+			got := context.MustExecOnce(backend, quantizedCtx.Reuse(), modelFn, x)
+			require.True(t, want.InDelta(got, 0.02), "want %s\ngot %s", want, got)
+		})
+	}
+}
@@ -220,6 +220,8 @@ func (c *Config) Done() *Node {
 	// Aliases.
 	ctx := c.ctx
 	g := c.input.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	dtype := c.input.DType()
 	x := c.input
 
@@ -68,6 +68,8 @@ func (rms *RMSNormBuilder) Done() *Node {
 	ctx := rms.ctx.In("rms_norm")
 	x := rms.operand
 	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	shape := x.Shape()
 	rank := x.Rank()
 	dtype := x.DType()
@@ -0,0 +1,238 @@
+// Package rnn provides a minimal "simple" (or Elman) recurrent neural network [1] implementation, and Stacked,
+// a composition of stacked and bidirectional recurrent layers: LSTM (see package lstm), GRU (see package gru) or
+// the simple RNN.
+//
+// The simple RNN updates its hidden state with `h_t = f(x_t W + h_{t-1} R + b)`, where f is by default Tanh.
+//
+// Since GoMLX doesn't implement loops, the size of the graph will be O(N) on the size of the sequence -- each
+// step of the RNN is instantiated as its own graph nodes.
+//
+// It follows the specification of ONNX RNN [2], so ONNX models can be converted, but it's fully differentiable
+// and can be used to train models.
+//
+// [1] https://onlinelibrary.wiley.com/doi/10.1207/s15516709cog1402_1, Elman, 1990
+// [2] https://onnx.ai/onnx/operators/onnx__RNN.html
+package rnn
+
+import (
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers/lstm"
+)
+
+// RNN holds a simple RNN configuration. It can be created with New (or NewWithWeights),
+// and once finished to be configured, can be applied to x with Done.
+type RNN struct {
+	ctx                                 *context.Context
+	x                                   *Node
+	xLengths                            *Node
+	initialHiddenState                  *Node
+	direction                           DirectionType
+	batchSize, featuresSize, hiddenSize int
+
+	// Model weights: see NewWithWeights for specification.
+	inputsW, recurrentW, biasesW *Node
+
+	// Activation functions: default to Tanh, for each direction.
+	activations [2]ActivationFn
+}
+
+// ActivationFn defines an activation function used by the RNN.
+type ActivationFn = lstm.ActivationFn
+
+// DirectionType defines the direction to run the RNN. It's the same as lstm.DirectionType.
+type DirectionType = lstm.DirectionType
+
+const (
+	DirForward       = lstm.DirForward
+	DirReverse       = lstm.DirReverse
+	DirBidirectional = lstm.DirBidirectional
+)
+
+// New creates a new simple RNN layer to be configured and then applied to x.
+// x should be shaped [batchSize, sequenceSize, featuresSize].
+//
+// See RNN.Ragged if x is not densely used: a more compact version to padding or masking.
+//
+// Once finished configuring, call RNN.Done and it will return the hidden states of the RNN.
+func New(ctx *context.Context, x *Node, hiddenSize int) *RNN {
+	return &RNN{
+		ctx:          ctx,
+		x:            x,
+		direction:    DirForward,
+		batchSize:    x.Shape().Dim(0),
+		featuresSize: x.Shape().Dim(2),
+		hiddenSize:   hiddenSize,
+		activations:  [2]ActivationFn{Tanh, Tanh},
+	}
+}
+
+// NewWithWeights creates a new simple RNN layer using the given weights -- as opposed to creating them
+// on-the-fly.
+//
+// Args:
+//   - x: shaped [batchSize, sequenceSize, featuresSize]
+//   - inputsW: shaped [numDirections, hiddenSize, featuresSize]
+//   - recurrentW: shaped [numDirections, hiddenSize, hiddenSize]
+//   - biases: for the inputs and then the recurrent projections, shaped [numDirections, 2, hiddenSize].
+//
+// These are the ONNX weights W, R and B, reshaped. See details in [2]
+func NewWithWeights(x *Node, inputsW, recurrentW, biases *Node) *RNN {
+	l := New(nil, x, inputsW.Shape().Dim(1))
+	l.inputsW = inputsW
+	l.recurrentW = recurrentW
+	l.biasesW = biases
+	if inputsW.Shape().Dim(0) == 2 {
+		l.direction = DirBidirectional
+	}
+	inputsW.AssertDims(l.NumDirections(), l.hiddenSize, l.featuresSize)
+	recurrentW.AssertDims(l.NumDirections(), l.hiddenSize, l.hiddenSize)
+	biases.AssertDims(l.NumDirections(), 2, l.hiddenSize)
+	return l
+}
+
+// Direction configures in which direction to run the RNN: DirForward, DirReverse or both.
+func (l *RNN) Direction(dir DirectionType) *RNN {
+	l.direction = dir
+	return l
+}
+
+// Ragged indicates that x is "ragged" (the sequences are not used to the end), and its lengths are
+// given by sequenceLengths, which must be shaped [batchSize].
+// It is a more compact version of padding.
+//
+// The default is to assume all sequences are dense -- used to the end.
+func (l *RNN) Ragged(sequencesLengths *Node) *RNN {
+	l.xLengths = sequencesLengths
+	return l
+}
+
+// Activation configures the activation function of the given direction index (0 for forward, 1 for the reverse of
+// DirBidirectional).
+//
+// Default to Tanh.
+func (l *RNN) Activation(dirIdx int, activationFn ActivationFn) *RNN {
+	l.activations[dirIdx] = activationFn
+	return l
+}
+
+// InitialStates configures the RNN initial hidden state (h_0 in the literature).
+// If not set it defaults to 0.
+//
+// It must be shaped [numDirections, batchSize, hiddenSize].
+//
+// This is useful if concatenating the output of the RNN to another instance of the (same?) RNN.
+// That is, you can feed here the last hidden state returned by RNN.Done of a previous call.
+func (l *RNN) InitialStates(initialHiddenState *Node) *RNN {
+	l.initialHiddenState = initialHiddenState
+	return l
+}
+
+// NumDirections based on the direction information selected.
+// See RNN.Direction to configure the direction.
+func (l *RNN) NumDirections() int {
+	if l.direction == DirBidirectional {
+		return 2
+	}
+	return 1
+}
+
+// Done should be called once the RNN is configured.
+// It will apply the RNN layer to the sequence in X.
+// - allHiddenStates: [sequenceSize, numDirections, batchSize, hiddenSize]
+// - lastHiddenState: [numDirections, batchSize, hiddenSize]
+func (l *RNN) Done() (allHiddenStates, lastHiddenState *Node) {
+	// "Mis en place": everything we need in local variables.
+	ctx := l.ctx
+	x := l.x
+	g := l.x.Graph()
+	if ctx != nil {
+		// ctx is nil if created with NewWithWeights.
+		g.PushScope(ctx.Scope())
+		defer g.PopScope()
+	}
+	dtype := x.DType()
+	numDirections := l.NumDirections()
+	batchSize := l.batchSize
+	sequenceSize := x.Shape().Dim(1)
+	featuresSize := l.featuresSize
+	hiddenSize := l.hiddenSize
+	xLengths := l.xLengths
+	inputsW := l.inputsW
+	recurrentW := l.recurrentW
+	biasesW := l.biasesW
+
+	// If model weights were not given, create them here.
+	if inputsW == nil {
+		inputsW = ctx.VariableWithShape("inputsW", shapes.Make(dtype, numDirections, hiddenSize, featuresSize)).ValueGraph(g)
+		recurrentW = ctx.VariableWithShape("recurrentW", shapes.Make(dtype, numDirections, hiddenSize, hiddenSize)).ValueGraph(g)
+		biasesW = ctx.VariableWithShape("biasesW", shapes.Make(dtype, numDirections, 2, hiddenSize)).ValueGraph(g)
+	}
+
+	// Calculate all linear projections of x, with both biases.
+	// b->batchSize, s->sequenceSize, f->featuresSize, d->numDirections, h->hiddenSize.
+	projX := Einsum("bsf,dhf->dbsh", x, inputsW)
+	{
+		bias := ReduceSum(biasesW, 1) // Sum of the inputs and recurrent biases: [numDirections, hiddenSize].
+		bias = ExpandAxes(bias, 1, 2) // Create batchSize and seqLen axes.
+		projX = Add(projX, bias)
+	}
+
+	// Starting states: h_{i-1} so to say.
+	prevHidden := make([]*Node, numDirections) // One for each direction.
+	for dirIdx := range numDirections {
+		if l.initialHiddenState == nil {
+			prevHidden[dirIdx] = Zeros(g, shapes.Make(dtype, batchSize, hiddenSize))
+		} else {
+			l.initialHiddenState.AssertDims(numDirections, batchSize, hiddenSize)
+			prevHidden[dirIdx] = Squeeze(Slice(l.initialHiddenState, AxisElem(dirIdx)), 0)
+		}
+	}
+
+	// Collect hidden states of each step, to be returned later.
+	seqHiddenStates := make([][]*Node, numDirections)
+	for ii := range numDirections {
+		seqHiddenStates[ii] = make([]*Node, sequenceSize)
+	}
+
+	// Loop over each position of the sequence.
+	for seqIdx := range sequenceSize {
+		// Loop over directions.
+		for dirIdx := range numDirections {
+			seqPos := seqIdx
+			if dirIdx == 1 || l.direction == DirReverse {
+				// DirReverse:
+				seqPos = sequenceSize - 1 - seqIdx
+			}
+			proj := Slice(projX, AxisElem(dirIdx), AxisRange() /*batch*/, AxisElem(seqPos))
+			proj = Reshape(proj, batchSize, hiddenSize)
+			dirRecurrentW := Squeeze(Slice(recurrentW, AxisElem(dirIdx)), 0) // [hiddenSize (j), hiddenSize(h)]
+			proj = Add(proj, Einsum("bh,jh->bj", prevHidden[dirIdx], dirRecurrentW))
+			hiddenState := l.activations[dirIdx](proj)
+
+			// Mask results after the sentence end: if position is after the end of the sentence, just
+			// use the prevHidden unchanged -- notice it works in both directions.
+			if l.xLengths != nil {
+				masked := GreaterOrEqual(Scalar(g, xLengths.DType(), seqPos), xLengths)
+				hiddenState = Where(masked, prevHidden[dirIdx], hiddenState)
+			}
+
+			// Save hidden state and move to next.
+			seqHiddenStates[dirIdx][seqPos] = hiddenState
+			prevHidden[dirIdx] = hiddenState
+		}
+	}
+
+	lastHiddenState = Stack(prevHidden, 0)
+	if numDirections == 2 {
+		allHiddenStates = Stack([]*Node{
+			Stack(seqHiddenStates[0], 0),
+			Stack(seqHiddenStates[1], 0)}, 1)
+	} else {
+		// Only one direction to stack.
+		allHiddenStates = Stack(seqHiddenStates[0], 0)
+		allHiddenStates = Reshape(allHiddenStates, sequenceSize, 1, batchSize, hiddenSize)
+	}
+	return
+}
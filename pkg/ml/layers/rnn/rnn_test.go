@@ -0,0 +1,133 @@
+package rnn
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+// fill returns a slice with deterministic values in (-1, 1).
+func fill(seed float64, size int) []float64 {
+	values := make([]float64, size)
+	for ii := range values {
+		values[ii] = math.Sin(seed + 0.37*float64(ii))
+	}
+	return values
+}
+
+func TestRNN(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, sequenceSize, featuresSize, hiddenSize = 2, 5, 3, 4
+	lengths := []int32{5, 3}
+	for _, dir := range []DirectionType{DirForward, DirReverse, DirBidirectional} {
+		for _, ragged := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s-ragged=%v", dir, ragged), func(t *testing.T) {
+				numDirections := 1
+				if dir == DirBidirectional {
+					numDirections = 2
+				}
+				x := fill(0.1, batchSize*sequenceSize*featuresSize)
+				inputsW := fill(1, numDirections*hiddenSize*featuresSize)
+				recurrentW := fill(2, numDirections*hiddenSize*hiddenSize)
+				biases := fill(3, numDirections*2*hiddenSize)
+				outputs := MustExecOnceN(backend, func(g *Graph) []*Node {
+					layer := NewWithWeights(
+						Reshape(Const(g, x), batchSize, sequenceSize, featuresSize),
+						Reshape(Const(g, inputsW), numDirections, hiddenSize, featuresSize),
+						Reshape(Const(g, recurrentW), numDirections, hiddenSize, hiddenSize),
+						Reshape(Const(g, biases), numDirections, 2, hiddenSize))
+					if dir != DirBidirectional {
+						layer.Direction(dir)
+					}
+					if ragged {
+						layer.Ragged(Const(g, lengths))
+					}
+					allHiddenStates, lastHiddenState := layer.Done()
+					return []*Node{allHiddenStates, lastHiddenState}
+				})
+				got := outputs[0].Value().([][][][]float64)
+				outputs[1].Shape().AssertDims(numDirections, batchSize, hiddenSize)
+
+				// Reference implementation of h_t = tanh(x_t W + h_{t-1} R + b).
+				for dirIdx := range numDirections {
+					reverse := dirIdx == 1 || dir == DirReverse
+					for b := range batchSize {
+						length := sequenceSize
+						if ragged {
+							length = int(lengths[b])
+						}
+						prev := make([]float64, hiddenSize)
+						for seqIdx := range sequenceSize {
+							pos := seqIdx
+							if reverse {
+								pos = sequenceSize - 1 - seqIdx
+							}
+							if pos < length {
+								next := make([]float64, hiddenSize)
+								for h := range hiddenSize {
+									v := biases[(dirIdx*2)*hiddenSize+h] + biases[(dirIdx*2+1)*hiddenSize+h]
+									for f := range featuresSize {
+										v += inputsW[(dirIdx*hiddenSize+h)*featuresSize+f] *
+											x[(b*sequenceSize+pos)*featuresSize+f]
+									}
+									for j := range hiddenSize {
+										v += recurrentW[(dirIdx*hiddenSize+h)*hiddenSize+j] * prev[j]
+									}
+									next[h] = math.Tanh(v)
+								}
+								prev = next
+							}
+							assert.InDeltaSlice(t, prev, got[pos][dirIdx][b], 1e-6)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStacked(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, sequenceSize, featuresSize, hiddenSize = 2, 4, 3, 5
+	for name, layerFn := range map[string]LayerFn{"LSTM": LSTM(hiddenSize), "GRU": GRU(hiddenSize), "Elman": Elman(hiddenSize)} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.New()
+			output := context.MustExecOnce(backend, ctx, func(ctx *context.Context, x, lengths *Node) *Node {
+				return NewStacked(ctx, x, layerFn).
+					NumLayers(3).
+					Direction(DirBidirectional).
+					Residual(true).
+					Dropout(0.1).
+					Ragged(lengths).
+					Done()
+			}, tensors.FromShape(shapes.Make(dtypes.Float32, batchSize, sequenceSize, featuresSize)), []int32{4, 2})
+			require.NoError(t, output.Shape().CheckDims(batchSize, sequenceSize, 2*hiddenSize))
+		})
+	}
+
+	// Residual connections skip the layers whose output have the same shape as the input.
+	ctx := context.New()
+	identity := func(ctx *context.Context, x, lengths *Node, direction DirectionType) *Node {
+		ctx.VariableWithShape("w", shapes.Make(x.DType()))
+		return ZerosLike(x)
+	}
+	x := [][][]float32{{{1, 2}, {3, 4}}}
+	got := context.MustExecOnce(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+		return NewStacked(ctx, x, identity).NumLayers(2).Residual(true).Done()
+	}, x)
+	assert.Equal(t, x, got.Value())
+	for _, scope := range []string{"/layer_0", "/layer_1"} {
+		require.NotNil(t, ctx.InAbsPath(scope).GetVariable("w"))
+	}
+}
@@ -0,0 +1,161 @@
+package rnn
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/gru"
+	"github.com/gomlx/gomlx/pkg/ml/layers/lstm"
+)
+
+// LayerFn creates a recurrent layer and applies it to x, shaped [batchSize, sequenceSize, featuresSize], in the given
+// direction. The lengths of the sequences (for ragged inputs) may be nil.
+//
+// It must return the hidden states shaped [batchSize, sequenceSize, numDirections * hiddenSize] -- for
+// DirBidirectional the forward hidden states come first.
+//
+// See LSTM, GRU and Elman for the LayerFn of the recurrent layers in GoMLX.
+type LayerFn func(ctx *context.Context, x, lengths *Node, direction DirectionType) *Node
+
+// batchMajor converts the hidden states returned by the recurrent layers, shaped
+// [sequenceSize, numDirections, batchSize, hiddenSize], to [batchSize, sequenceSize, numDirections * hiddenSize].
+func batchMajor(allHiddenStates *Node) *Node {
+	dims := allHiddenStates.Shape().Dimensions
+	sequenceSize, numDirections, batchSize, hiddenSize := dims[0], dims[1], dims[2], dims[3]
+	allHiddenStates = TransposeAllAxes(allHiddenStates, 2, 0, 1, 3)
+	return Reshape(allHiddenStates, batchSize, sequenceSize, numDirections*hiddenSize)
+}
+
+// LSTM returns a LayerFn that creates an lstm.LSTM layer with the given hidden size.
+func LSTM(hiddenSize int) LayerFn {
+	return func(ctx *context.Context, x, lengths *Node, direction DirectionType) *Node {
+		layer := lstm.New(ctx, x, hiddenSize).Direction(direction)
+		if lengths != nil {
+			layer.Ragged(lengths)
+		}
+		allHiddenStates, _, _ := layer.Done()
+		return batchMajor(allHiddenStates)
+	}
+}
+
+// GRU returns a LayerFn that creates a gru.GRU layer with the given hidden size.
+func GRU(hiddenSize int) LayerFn {
+	return func(ctx *context.Context, x, lengths *Node, direction DirectionType) *Node {
+		layer := gru.New(ctx, x, hiddenSize).Direction(direction)
+		if lengths != nil {
+			layer.Ragged(lengths)
+		}
+		allHiddenStates, _ := layer.Done()
+		return batchMajor(allHiddenStates)
+	}
+}
+
+// Elman returns a LayerFn that creates a simple RNN layer (see New) with the given hidden size.
+func Elman(hiddenSize int) LayerFn {
+	return func(ctx *context.Context, x, lengths *Node, direction DirectionType) *Node {
+		layer := New(ctx, x, hiddenSize).Direction(direction)
+		if lengths != nil {
+			layer.Ragged(lengths)
+		}
+		allHiddenStates, _ := layer.Done()
+		return batchMajor(allHiddenStates)
+	}
+}
+
+// Stacked holds the configuration of a stack of recurrent layers. It is created with NewStacked, and once
+// configured, it is applied to x with Done.
+type Stacked struct {
+	ctx         *context.Context
+	x, lengths  *Node
+	layerFn     LayerFn
+	numLayers   int
+	direction   DirectionType
+	residual    bool
+	dropoutRate float64
+}
+
+// NewStacked creates a stack of recurrent layers, each created with layerFn, to be configured and then applied to x.
+// x should be shaped [batchSize, sequenceSize, featuresSize].
+//
+// The default is one forward layer, with no residual connections and no dropout.
+//
+// Example: a bidirectional GRU with 3 layers:
+//
+//	output := rnn.NewStacked(ctx, x, rnn.GRU(64)).NumLayers(3).Direction(rnn.DirBidirectional).Dropout(0.1).Done()
+func NewStacked(ctx *context.Context, x *Node, layerFn LayerFn) *Stacked {
+	return &Stacked{
+		ctx:       ctx,
+		x:         x,
+		layerFn:   layerFn,
+		numLayers: 1,
+		direction: DirForward,
+	}
+}
+
+// NumLayers configures the number of stacked layers. Each layer is created in the scope "layer_<i>".
+//
+// Default to 1.
+func (s *Stacked) NumLayers(numLayers int) *Stacked {
+	if numLayers < 1 {
+		Panicf("rnn.Stacked: numLayers must be >= 1, got %d", numLayers)
+	}
+	s.numLayers = numLayers
+	return s
+}
+
+// Direction configures in which direction to run each of the layers: DirForward, DirReverse or both.
+// With DirBidirectional, the outputs of both directions of a layer are concatenated and fed to the next layer.
+func (s *Stacked) Direction(dir DirectionType) *Stacked {
+	s.direction = dir
+	return s
+}
+
+// Ragged indicates that x is "ragged" (the sequences are not used to the end), and its lengths are
+// given by sequenceLengths, which must be shaped [batchSize].
+func (s *Stacked) Ragged(sequencesLengths *Node) *Stacked {
+	s.lengths = sequencesLengths
+	return s
+}
+
+// Residual configures whether to add residual connections around the layers: the input of a layer is added to its
+// output. It's only used for the layers whose output has the same dimension as their input, so usually not the first.
+//
+// Default to false.
+func (s *Stacked) Residual(residual bool) *Stacked {
+	s.residual = residual
+	return s
+}
+
+// Dropout configures the dropout rate applied to the outputs of each layer, except the last, when training.
+//
+// Default to 0 (no dropout).
+func (s *Stacked) Dropout(rate float64) *Stacked {
+	s.dropoutRate = rate
+	return s
+}
+
+// Done applies the stack of recurrent layers to x, and returns the output of the last layer, shaped
+// [batchSize, sequenceSize, numDirections * hiddenSize].
+func (s *Stacked) Done() *Node {
+	x := s.x
+	g := x.Graph()
+	g.PushScope(s.ctx.Scope())
+	defer g.PopScope()
+	for layerIdx := range s.numLayers {
+		ctx := s.ctx.Inf("layer_%d", layerIdx)
+		output := s.layerFn(ctx, x, s.lengths, s.direction)
+		if output.Rank() != 3 || output.Shape().Dim(0) != x.Shape().Dim(0) || output.Shape().Dim(1) != x.Shape().Dim(1) {
+			Panicf("rnn.Stacked: layer %d returned shape %s for input shape %s, expected "+
+				"[batchSize, sequenceSize, numDirections * hiddenSize]", layerIdx, output.Shape(), x.Shape())
+		}
+		if s.residual && output.Shape().Equal(x.Shape()) {
+			output = Add(output, x)
+		}
+		if layerIdx < s.numLayers-1 {
+			output = layers.DropoutStatic(ctx, output, s.dropoutRate)
+		}
+		x = output
+	}
+	return x
+}
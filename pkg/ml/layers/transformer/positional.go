@@ -0,0 +1,176 @@
+package transformer
+
+import (
+	"math"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// PositionEncoding is an enum for the supported types of position encoding.
+//
+// Sinusoidal and learned encodings are added to the input embeddings, by Config.Encoder and Config.Decoder,
+// while RoPE and ALiBi are applied in the attention of each block.
+type PositionEncoding int
+
+const (
+	// PositionNone uses no position encoding.
+	PositionNone PositionEncoding = iota
+
+	// PositionSinusoidal adds the fixed sinusoidal encoding of "Attention Is All You Need" to the input embeddings.
+	// See SinusoidalEncoding.
+	PositionSinusoidal
+
+	// PositionLearned adds a learned embedding of the positions to the input embeddings.
+	// See LearnedPositionEncoding.
+	PositionLearned
+
+	// PositionRoPE rotates the projected queries and keys in the self-attention of each block by an angle
+	// proportional to their positions. See RoPE.
+	PositionRoPE
+
+	// PositionALiBi adds a bias, linear in the distance between the query and key, to the self-attention
+	// logits of each block. See ALiBiBias.
+	PositionALiBi
+)
+
+//go:generate enumer -type=PositionEncoding -trimprefix=Position -transform=lower -values -text -json positional.go
+
+// SinusoidalEncoding returns the fixed sinusoidal position encoding described in "Attention Is All You Need",
+// https://arxiv.org/abs/1706.03762:
+//
+//	PE(pos, 2i) = sin(pos / 10000^(2i/dim))
+//	PE(pos, 2i+1) = cos(pos / 10000^(2i/dim))
+//
+// The positions must be an integer tensor of any shape, and the returned encoding is shaped
+// `[<positions dimensions...>, dim]` with the given dtype. The dim must be even.
+func SinusoidalEncoding(positions *Node, dim int, dtype dtypes.DType) *Node {
+	if dim <= 0 || dim%2 != 0 {
+		Panicf("SinusoidalEncoding requires a positive even dimension, got %d", dim)
+	}
+	g := positions.Graph()
+	halfDim := dim / 2
+	frequencies := Iota(g, shapes.Make(dtype, halfDim), 0)
+	frequencies = Exp(MulScalar(frequencies, -2.0*math.Log(10000.0)/float64(dim)))
+	angles := outerProduct(ConvertDType(positions, dtype), frequencies)
+	// Interleave sin and cos: [<positions dimensions...>, halfDim, 2] -> [<positions dimensions...>, dim].
+	encoding := Stack([]*Node{Sin(angles), Cos(angles)}, -1)
+	outputDims := append(positions.Shape().Clone().Dimensions, dim)
+	return Reshape(encoding, outputDims...)
+}
+
+// outerProduct of x (any shape) and the rank-1 y: the result is shaped `[<x dimensions...>, y.dimension]`.
+func outerProduct(x, y *Node) *Node {
+	yDim := y.Shape().Dim(0)
+	outputDims := append(x.Shape().Clone().Dimensions, yDim)
+	yDims := append(xslices.SliceWithValue(x.Rank(), 1), yDim)
+	return Mul(BroadcastToDims(InsertAxes(x, -1), outputDims...), BroadcastToDims(Reshape(y, yDims...), outputDims...))
+}
+
+// LearnedPositionEncoding returns a learned embedding for each of the positions, shaped
+// `[<positions dimensions...>, dim]`.
+//
+// The positions must be an integer tensor with values in the range [0, maxPositions). The embedding
+// table is stored in the variable "embeddings" in the scope "learned_position_encoding".
+func LearnedPositionEncoding(ctx *context.Context, positions *Node, maxPositions, dim int, dtype dtypes.DType) *Node {
+	// Always add the index axis: otherwise layers.Embedding would take a last axis of size 1 to be the index axis.
+	positions = InsertAxes(positions, -1)
+	return layers.Embedding(ctx.In("learned_position_encoding"), positions, dtype, maxPositions, dim)
+}
+
+// RoPE applies the rotary position embedding, as described in "RoFormer: Enhanced Transformer with Rotary
+// Position Embedding", https://arxiv.org/abs/2104.09864, to x.
+//
+// x must be shaped `[batch_size, seq_len, num_heads, head_dim]`, with an even head_dim -- the shape of the
+// projected queries and keys in layers.MultiHeadAttention. The positions must be an integer tensor shaped
+// `[seq_len]` or `[batch_size, seq_len]`.
+//
+// Each pair of features `(x[i], x[i + head_dim/2])` is rotated by the angle `pos * base^(-2i/head_dim)`,
+// the "rotate half" layout used by most open-weight models. The usual value for base is 10,000.
+func RoPE(x, positions *Node, base float64) *Node {
+	if x.Rank() != 4 {
+		Panicf("RoPE requires x to be shaped [batch_size, seq_len, num_heads, head_dim], got x.shape=%s", x.Shape())
+	}
+	batchSize, seqLen, numHeads, headDim := x.Shape().Dim(0), x.Shape().Dim(1), x.Shape().Dim(2), x.Shape().Dim(3)
+	if headDim%2 != 0 {
+		Panicf("RoPE requires an even head_dim, got x.shape=%s", x.Shape())
+	}
+	if !positions.DType().IsInt() || positions.Shape().Dim(-1) != seqLen || positions.Rank() > 2 {
+		Panicf("RoPE requires integer positions shaped [seq_len] or [batch_size, seq_len], got positions.shape=%s "+
+			"for x.shape=%s", positions.Shape(), x.Shape())
+	}
+	g := x.Graph()
+	dtype := x.DType()
+	halfDim := headDim / 2
+	frequencies := Iota(g, shapes.Make(dtype, halfDim), 0)
+	frequencies = Exp(MulScalar(frequencies, -2.0*math.Log(base)/float64(headDim)))
+	angles := outerProduct(ConvertDType(positions, dtype), frequencies) // [<batch_size>, seq_len, halfDim]
+	if angles.Rank() == 2 {
+		angles = InsertAxes(angles, 0)
+	}
+	// Shape angles to [batch_size (or 1), seq_len, 1 (num_heads), 1 (half), halfDim].
+	angles = InsertAxes(angles, 2, 2)
+	halvesDims := []int{batchSize, seqLen, numHeads, 2, halfDim}
+	cos := BroadcastToDims(Cos(angles), halvesDims...)
+	sin := BroadcastToDims(Sin(angles), halvesDims...)
+
+	// rotated = [-x2, x1], where x1 and x2 are the two halves of x.
+	halves := Reshape(x, halvesDims...)
+	rotation := ConstAsDType(g, dtype, [][]float64{{0, -1}, {1, 0}})
+	rotated := Einsum("bshjd,ij->bshid", halves, rotation)
+	output := Add(Mul(halves, cos), Mul(rotated, sin))
+	return Reshape(output, batchSize, seqLen, numHeads, headDim)
+}
+
+// ALiBiSlopes returns the slopes for each head used by ALiBi, a geometric sequence as defined in
+// "Train Short, Test Long: Attention with Linear Biases Enables Input Length Extrapolation",
+// https://arxiv.org/abs/2108.12409.
+//
+// If numHeads is not a power of 2, it uses the slopes of the closest lower power of 2, complemented by
+// every other slope of the next power of 2, as in the paper's reference implementation.
+func ALiBiSlopes(numHeads int) []float64 {
+	powerOf2Slopes := func(n int) []float64 {
+		start := math.Pow(2, -8.0/float64(n))
+		slopes := make([]float64, n)
+		for ii := range slopes {
+			slopes[ii] = math.Pow(start, float64(ii+1))
+		}
+		return slopes
+	}
+	closestPowerOf2 := 1
+	for closestPowerOf2*2 <= numHeads {
+		closestPowerOf2 *= 2
+	}
+	slopes := powerOf2Slopes(closestPowerOf2)
+	if closestPowerOf2 < numHeads {
+		extraSlopes := powerOf2Slopes(2 * closestPowerOf2)
+		for ii := 0; len(slopes) < numHeads; ii += 2 {
+			slopes = append(slopes, extraSlopes[ii])
+		}
+	}
+	return slopes
+}
+
+// ALiBiBias returns the ALiBi attention bias, `-slope[head] * |queryPosition - keyPosition|`, shaped
+// `[1, query_len, num_heads, key_len]`, as expected by layers.MultiHeadAttentionBuilder.SetAttentionBias.
+//
+// The queryPositions and keyPositions must be integer tensors shaped `[query_len]` and `[key_len]`.
+func ALiBiBias(queryPositions, keyPositions *Node, numHeads int, dtype dtypes.DType) *Node {
+	if queryPositions.Rank() != 1 || keyPositions.Rank() != 1 {
+		Panicf("ALiBiBias requires rank-1 positions, got queryPositions.shape=%s and keyPositions.shape=%s",
+			queryPositions.Shape(), keyPositions.Shape())
+	}
+	g := queryPositions.Graph()
+	queryLen, keyLen := queryPositions.Shape().Dim(0), keyPositions.Shape().Dim(0)
+	biasDims := []int{1, queryLen, numHeads, keyLen}
+	queryPositions = BroadcastToDims(Reshape(ConvertDType(queryPositions, dtype), 1, queryLen, 1, 1), biasDims...)
+	keyPositions = BroadcastToDims(Reshape(ConvertDType(keyPositions, dtype), 1, 1, 1, keyLen), biasDims...)
+	slopes := ConstAsDType(g, dtype, ALiBiSlopes(numHeads))
+	slopes = BroadcastToDims(Reshape(slopes, 1, 1, numHeads, 1), biasDims...)
+	return Neg(Mul(slopes, Abs(Sub(queryPositions, keyPositions))))
+}
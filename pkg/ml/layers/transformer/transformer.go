@@ -0,0 +1,569 @@
+// Package transformer implements the building blocks of transformer models, as described in
+// "Attention Is All You Need", https://arxiv.org/abs/1706.03762, and its many later variations: encoder and
+// decoder blocks with pre- or post-normalization, LayerNormalization or RMSNorm, (gated) feed-forward networks,
+// and sinusoidal, learned, rotary (RoPE) and ALiBi position encodings.
+//
+// The blocks are configured with a Config, created with New, whose defaults can be set by the hyperparameters
+// in the context -- see the Param* constants.
+//
+// E.g.: A decoder-only (GPT-like) language model:
+//
+//	func LanguageModel(ctx *context.Context, tokens *Node) *Node {
+//		embeddings := layers.Embedding(ctx.In("token_embeddings"), tokens, dtypes.Float32, vocabSize, 512)
+//		cfg := transformer.New(ctx).
+//			NumLayers(6).
+//			NumHeads(8).
+//			PositionEncoding(transformer.PositionRoPE).
+//			Normalization("rms").
+//			GatedFFN(true).Activation(activations.TypeSwish)  // SwiGLU
+//		x := cfg.Decoder(ctx.In("decoder"), embeddings, nil, nil, nil)
+//		return layers.Dense(ctx.In("logits"), x, false, vocabSize)
+//	}
+package transformer
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/activations"
+	"github.com/gomlx/gomlx/pkg/ml/layers/fnn"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+const (
+	// ParamNumLayers is the hyperparameter that defines the number of blocks used by Config.Encoder and
+	// Config.Decoder. The default is 1 (int).
+	ParamNumLayers = "transformer_num_layers"
+
+	// ParamNumHeads is the hyperparameter that defines the number of attention heads. The default is 8 (int).
+	ParamNumHeads = "transformer_num_heads"
+
+	// ParamNumKVHeads is the hyperparameter that defines the number of key/value heads of the self-attention, for
+	// grouped-query attention. The default is 0 (int), which means the same as the number of heads.
+	ParamNumKVHeads = "transformer_num_kv_heads"
+
+	// ParamHeadDim is the hyperparameter that defines the dimension of each attention head.
+	// The default is 0 (int), which means the model dimension (the last axis of the input) divided by the
+	// number of heads.
+	ParamHeadDim = "transformer_head_dim"
+
+	// ParamFFNDim is the hyperparameter that defines the hidden dimension of the feed-forward network of each block.
+	// The default is 0 (int), which means 4 times the model dimension.
+	ParamFFNDim = "transformer_ffn_dim"
+
+	// ParamActivation is the hyperparameter that defines the activation of the feed-forward network.
+	// See activations.TypeValues for valid values. The default is "gelu".
+	ParamActivation = "transformer_activation"
+
+	// ParamGatedFFN is the hyperparameter that defines whether to use a gated feed-forward network, as described in
+	// "GLU Variants Improve Transformer", https://arxiv.org/abs/2002.05202. With the "swish" activation, it is
+	// the SwiGLU feed-forward, and with "gelu" it's GeGLU. The default is false (bool).
+	ParamGatedFFN = "transformer_gated_ffn"
+
+	// ParamNormalization is the hyperparameter that defines the normalization used in the blocks: "layer" for
+	// layers.LayerNormalization, "rms" for layers.RMSNorm or "none".
+	//
+	// Defaults to the parameter "normalization" (layers.ParamNormalization) and if that is not set, to "layer".
+	ParamNormalization = "transformer_normalization"
+
+	// ParamPreNorm is the hyperparameter that defines whether the normalization is applied to the input of the
+	// attention and feed-forward sublayers (pre-norm, as in GPT-2 and most modern models), or to the output
+	// of their residual sum (post-norm, as in the original transformer). The default is true (bool).
+	ParamPreNorm = "transformer_pre_norm"
+
+	// ParamDropoutRate is the hyperparameter that defines the dropout rate applied to the outputs of the attention
+	// and feed-forward sublayers, before the residual sum.
+	//
+	// Defaults to the parameter "dropout_rate" (layers.ParamDropoutRate) and if that is not set, to 0.0 (no dropout).
+	ParamDropoutRate = "transformer_dropout_rate"
+
+	// ParamAttentionDropoutRate is the hyperparameter that defines the dropout rate of the attention coefficients.
+	// The default is 0.0 (float64).
+	ParamAttentionDropoutRate = "transformer_attention_dropout_rate"
+
+	// ParamPositionEncoding is the hyperparameter that defines the position encoding: "none", "sinusoidal",
+	// "learned", "rope" or "alibi". See PositionEncoding. The default is "sinusoidal".
+	ParamPositionEncoding = "transformer_position_encoding"
+
+	// ParamMaxPositions is the hyperparameter that defines the maximum number of positions supported by
+	// the "learned" position encoding. The default is 2048 (int).
+	ParamMaxPositions = "transformer_max_positions"
+
+	// ParamRoPEBase is the hyperparameter that defines the base of the rotation angles for the "rope" position
+	// encoding. The default is 10000.0 (float64).
+	ParamRoPEBase = "transformer_rope_base"
+
+	// ParamUseBias is the hyperparameter that defines whether the projections of the attention and feed-forward
+	// layers use a bias term. The default is true (bool).
+	ParamUseBias = "transformer_use_bias"
+)
+
+// Config holds the configuration of transformer blocks. It is created with New, and can be configured
+// with its methods, or by setting the corresponding hyperparameters in the context.
+//
+// The same Config can be used to create any number of blocks, or stacks of blocks, with
+// Config.EncoderBlock, Config.DecoderBlock, Config.Encoder and Config.Decoder.
+type Config struct {
+	numLayers, numHeads, headDim, ffnDim int
+	numKVHeads                           int
+	activation                           activations.Type
+	gatedFFN                             bool
+	normalization                        string
+	preNorm                              bool
+	dropoutRate, attentionDropoutRate    float64
+	positionEncoding                     PositionEncoding
+	maxPositions                         int
+	ropeBase                             float64
+	useBias                              bool
+
+	// KV cache for incremental decoding, see WithKVCache.
+	kvCacheMaxLength int
+	kvCachePosition  *Node
+}
+
+// New creates a transformer configuration, with the defaults read from the hyperparameters in ctx.
+// See the Param* constants for the hyperparameters and their default values.
+func New(ctx *context.Context) *Config {
+	c := &Config{
+		numLayers:            context.GetParamOr(ctx, ParamNumLayers, 1),
+		numHeads:             context.GetParamOr(ctx, ParamNumHeads, 8),
+		numKVHeads:           context.GetParamOr(ctx, ParamNumKVHeads, 0),
+		headDim:              context.GetParamOr(ctx, ParamHeadDim, 0),
+		ffnDim:               context.GetParamOr(ctx, ParamFFNDim, 0),
+		activation:           activations.FromName(context.GetParamOr(ctx, ParamActivation, "gelu")),
+		gatedFFN:             context.GetParamOr(ctx, ParamGatedFFN, false),
+		normalization:        context.GetParamOr(ctx, ParamNormalization, ""),
+		preNorm:              context.GetParamOr(ctx, ParamPreNorm, true),
+		dropoutRate:          context.GetParamOr(ctx, ParamDropoutRate, -1.0),
+		attentionDropoutRate: context.GetParamOr(ctx, ParamAttentionDropoutRate, 0.0),
+		maxPositions:         context.GetParamOr(ctx, ParamMaxPositions, 2048),
+		ropeBase:             context.GetParamOr(ctx, ParamRoPEBase, 10000.0),
+		useBias:              context.GetParamOr(ctx, ParamUseBias, true),
+	}
+
+	// Fallback parameters.
+	if c.normalization == "" {
+		c.normalization = context.GetParamOr(ctx, layers.ParamNormalization, "layer")
+	}
+	c.Normalization(c.normalization)
+	if c.dropoutRate < 0 {
+		c.dropoutRate = context.GetParamOr(ctx, layers.ParamDropoutRate, 0.0)
+	}
+	positionEncodingName := context.GetParamOr(ctx, ParamPositionEncoding, "sinusoidal")
+	positionEncoding, err := PositionEncodingString(positionEncodingName)
+	if err != nil {
+		Panicf("transformer: invalid position encoding %q given in hyperparameter %q: valid values are %v",
+			positionEncodingName, ParamPositionEncoding, PositionEncodingStrings())
+	}
+	c.positionEncoding = positionEncoding
+	return c
+}
+
+// NumLayers sets the number of blocks used by Config.Encoder and Config.Decoder.
+//
+// The default is 1, and it can be configured with the hyperparameter ParamNumLayers.
+func (c *Config) NumLayers(numLayers int) *Config {
+	if numLayers < 1 {
+		Panicf("transformer: numLayers must be >= 1, got %d", numLayers)
+	}
+	c.numLayers = numLayers
+	return c
+}
+
+// NumHeads sets the number of attention heads.
+//
+// The default is 8, and it can be configured with the hyperparameter ParamNumHeads.
+func (c *Config) NumHeads(numHeads int) *Config {
+	if numHeads < 1 {
+		Panicf("transformer: numHeads must be >= 1, got %d", numHeads)
+	}
+	c.numHeads = numHeads
+	return c
+}
+
+// NumKVHeads sets the number of key/value heads of the self-attention, for grouped-query attention -- see
+// layers.MultiHeadAttentionBuilder.SetNumKVHeads. If set to 0, it uses the same as the number of heads.
+//
+// The default is 0, and it can be configured with the hyperparameter ParamNumKVHeads.
+func (c *Config) NumKVHeads(numKVHeads int) *Config {
+	c.numKVHeads = numKVHeads
+	return c
+}
+
+// HeadDim sets the dimension of each attention head. If set to 0, it uses the model dimension (the last axis of
+// the input) divided by the number of heads.
+//
+// The default is 0, and it can be configured with the hyperparameter ParamHeadDim.
+func (c *Config) HeadDim(headDim int) *Config {
+	c.headDim = headDim
+	return c
+}
+
+// FFNDim sets the hidden dimension of the feed-forward network of each block. If set to 0, it uses 4 times the
+// model dimension (the last axis of the input).
+//
+// The default is 0, and it can be configured with the hyperparameter ParamFFNDim.
+func (c *Config) FFNDim(ffnDim int) *Config {
+	c.ffnDim = ffnDim
+	return c
+}
+
+// Activation sets the activation of the feed-forward network.
+//
+// The default is "gelu", and it can be configured with the hyperparameter ParamActivation.
+func (c *Config) Activation(activation activations.Type) *Config {
+	c.activation = activation
+	return c
+}
+
+// GatedFFN sets whether to use a gated feed-forward network, `down(activation(gate(x)) * up(x))`.
+// With the activations.TypeSwish activation, it is the SwiGLU feed-forward, and with activations.TypeGelu
+// it is GeGLU.
+//
+// The default is false, and it can be configured with the hyperparameter ParamGatedFFN.
+func (c *Config) GatedFFN(gated bool) *Config {
+	c.gatedFFN = gated
+	return c
+}
+
+// Normalization sets the normalization used in the blocks: "layer" for layers.LayerNormalization, "rms" for
+// layers.RMSNorm, or "none". See layers.KnownNormalizers for all values.
+//
+// The default is "layer", and it can be configured with the hyperparameter ParamNormalization or
+// layers.ParamNormalization.
+func (c *Config) Normalization(normalization string) *Config {
+	if _, found := layers.KnownNormalizers[normalization]; !found {
+		Panicf("transformer: unknown normalization %q given: valid values are %v",
+			normalization, xslices.SortedKeys(layers.KnownNormalizers))
+	}
+	c.normalization = normalization
+	return c
+}
+
+// PreNorm sets whether the normalization is applied to the input of each sublayer (pre-norm), or to the output
+// of their residual sum (post-norm). With pre-norm, Config.Encoder and Config.Decoder also normalize their final
+// output.
+//
+// The default is true, and it can be configured with the hyperparameter ParamPreNorm.
+func (c *Config) PreNorm(preNorm bool) *Config {
+	c.preNorm = preNorm
+	return c
+}
+
+// Dropout sets the dropout rate applied to the outputs of the attention and feed-forward sublayers.
+// If set to 0.0, no dropout is used.
+//
+// The default is 0.0, and it can be configured with the hyperparameters ParamDropoutRate or
+// layers.ParamDropoutRate.
+func (c *Config) Dropout(rate float64) *Config {
+	if rate < 0 || rate >= 1.0 {
+		Panicf("transformer: invalid dropout rate %f -- set to 0.0 to disable it", rate)
+	}
+	c.dropoutRate = rate
+	return c
+}
+
+// AttentionDropout sets the dropout rate of the attention coefficients. If set to 0.0, no dropout is used.
+//
+// The default is 0.0, and it can be configured with the hyperparameter ParamAttentionDropoutRate.
+func (c *Config) AttentionDropout(rate float64) *Config {
+	if rate < 0 || rate >= 1.0 {
+		Panicf("transformer: invalid attention dropout rate %f -- set to 0.0 to disable it", rate)
+	}
+	c.attentionDropoutRate = rate
+	return c
+}
+
+// PositionEncoding sets the type of position encoding. See PositionEncoding for details.
+//
+// The default is PositionSinusoidal, and it can be configured with the hyperparameter ParamPositionEncoding.
+func (c *Config) PositionEncoding(positionEncoding PositionEncoding) *Config {
+	c.positionEncoding = positionEncoding
+	return c
+}
+
+// MaxPositions sets the maximum number of positions supported by the PositionLearned encoding.
+//
+// The default is 2048, and it can be configured with the hyperparameter ParamMaxPositions.
+func (c *Config) MaxPositions(maxPositions int) *Config {
+	c.maxPositions = maxPositions
+	return c
+}
+
+// RoPEBase sets the base of the rotation angles for the PositionRoPE encoding.
+//
+// The default is 10,000, and it can be configured with the hyperparameter ParamRoPEBase.
+func (c *Config) RoPEBase(base float64) *Config {
+	c.ropeBase = base
+	return c
+}
+
+// UseBias sets whether the projections of the attention and feed-forward layers use a bias term.
+//
+// The default is true, and it can be configured with the hyperparameter ParamUseBias.
+func (c *Config) UseBias(useBias bool) *Config {
+	c.useBias = useBias
+	return c
+}
+
+// WithKVCache returns a copy of the configuration that uses a KV cache in the self-attention of the decoder blocks,
+// for incremental (autoregressive) decoding -- see layers.MultiHeadAttentionBuilder.UseKVCache.
+//
+// The position is a scalar integer Node with the position of the first element of the input x of Config.Decoder
+// (or Config.DecoderBlock) in the sequence being decoded, and the position encodings are offset accordingly.
+// Typically, one first calls the decoder with the prompt at position 0, and then with one element at a time,
+// at the following positions. position + seq_len must be <= maxLength.
+//
+// The cache is stored in context variables -- use layers.ResetKVCache to remove them (e.g.: to change the batch size).
+// Since the configuration holds a Node, the returned Config can only be used in the graph of position.
+func (c *Config) WithKVCache(maxLength int, position *Node) *Config {
+	if maxLength < 1 {
+		Panicf("transformer: KV cache maxLength must be >= 1, got %d", maxLength)
+	}
+	c2 := *c
+	c2.kvCacheMaxLength = maxLength
+	c2.kvCachePosition = position
+	return &c2
+}
+
+// Encoder applies the configured position encoding (if sinusoidal or learned) to x, followed by NumLayers
+// encoder blocks (see EncoderBlock), and a final normalization if using pre-norm.
+//
+// x must be shaped `[batch_size, seq_len, model_dim]`, and the optional mask (can be nil) is a boolean tensor
+// shaped `[batch_size, seq_len]`, set to true for the valid (non-padding) elements.
+// The output has the same shape as x.
+func (c *Config) Encoder(ctx *context.Context, x, mask *Node) *Node {
+	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
+	x = c.addPositionEncoding(ctx, x, c.positions(x, false))
+	for ii := range c.numLayers {
+		x = c.EncoderBlock(ctx.Inf("encoder_block_%d", ii), x, mask)
+	}
+	if c.preNorm {
+		x = c.normalize(ctx.In("encoder_final_norm"), x)
+	}
+	return x
+}
+
+// Decoder applies the configured position encoding (if sinusoidal or learned) to x, followed by NumLayers
+// decoder blocks (see DecoderBlock), and a final normalization if using pre-norm.
+//
+// x must be shaped `[batch_size, seq_len, model_dim]`, and the optional mask (can be nil) is a boolean tensor
+// shaped `[batch_size, seq_len]`, set to true for the valid (non-padding) elements.
+//
+// The memory is the output of the encoder, shaped `[batch_size, memory_len, memory_dim]`, with an optional
+// memoryMask shaped `[batch_size, memory_len]`. If memory is nil, there is no cross-attention, as in
+// decoder-only models (e.g.: GPT).
+//
+// For incremental decoding, see WithKVCache.
+//
+// The output has the same shape as x.
+func (c *Config) Decoder(ctx *context.Context, x, mask, memory, memoryMask *Node) *Node {
+	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
+	x = c.addPositionEncoding(ctx, x, c.positions(x, true))
+	for ii := range c.numLayers {
+		x = c.DecoderBlock(ctx.Inf("decoder_block_%d", ii), x, mask, memory, memoryMask)
+	}
+	if c.preNorm {
+		x = c.normalize(ctx.In("decoder_final_norm"), x)
+	}
+	return x
+}
+
+// EncoderBlock applies one encoder block to x: a self-attention sublayer followed by a feed-forward sublayer,
+// each with a residual connection, normalization and dropout as configured.
+//
+// x must be shaped `[batch_size, seq_len, model_dim]`, and the optional mask (can be nil) is a boolean tensor
+// shaped `[batch_size, seq_len]`, set to true for the valid (non-padding) elements.
+// The output has the same shape as x.
+func (c *Config) EncoderBlock(ctx *context.Context, x, mask *Node) *Node {
+	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
+	c.checkInput(x, mask, "x")
+	x = c.residual(ctx.In("self_attention"), x, func(ctx *context.Context, x *Node) *Node {
+		return c.selfAttention(ctx, x, mask, false)
+	})
+	return c.residual(ctx.In("ffn"), x, c.feedForward)
+}
+
+// DecoderBlock applies one decoder block to x: a causal self-attention sublayer, an optional cross-attention
+// sublayer to memory and a feed-forward sublayer, each with a residual connection, normalization and dropout
+// as configured.
+//
+// x must be shaped `[batch_size, seq_len, model_dim]`, and the optional mask (can be nil) is a boolean tensor
+// shaped `[batch_size, seq_len]`, set to true for the valid (non-padding) elements.
+//
+// The memory is the output of the encoder, shaped `[batch_size, memory_len, memory_dim]`, with an optional
+// memoryMask shaped `[batch_size, memory_len]`. If memory is nil, the cross-attention sublayer is skipped.
+//
+// The output has the same shape as x.
+func (c *Config) DecoderBlock(ctx *context.Context, x, mask, memory, memoryMask *Node) *Node {
+	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
+	c.checkInput(x, mask, "x")
+	x = c.residual(ctx.In("self_attention"), x, func(ctx *context.Context, x *Node) *Node {
+		return c.selfAttention(ctx, x, mask, true)
+	})
+	if memory != nil {
+		c.checkInput(memory, memoryMask, "memory")
+		x = c.residual(ctx.In("cross_attention"), x, func(ctx *context.Context, x *Node) *Node {
+			modelDim := x.Shape().Dim(-1)
+			attention := layers.MultiHeadAttention(ctx, x, memory, memory, c.numHeads, c.headDimFor(modelDim)).
+				SetOutputDim(modelDim).
+				UseProjectionBias(c.useBias).
+				Dropout(c.attentionDropoutRate)
+			if memoryMask != nil {
+				attention.SetKeyMask(memoryMask)
+			}
+			return attention.Done()
+		})
+	} else if memoryMask != nil {
+		Panicf("transformer: memoryMask given without memory")
+	}
+	return c.residual(ctx.In("ffn"), x, c.feedForward)
+}
+
+// checkInput validates the shapes of the input x (or memory) and its mask.
+func (c *Config) checkInput(x, mask *Node, name string) {
+	if x.Rank() != 3 {
+		Panicf("transformer: %s must be shaped [batch_size, seq_len, model_dim], got %s.shape=%s", name, name, x.Shape())
+	}
+	if mask != nil && (mask.DType() != dtypes.Bool || mask.Rank() != 2 ||
+		mask.Shape().Dim(0) != x.Shape().Dim(0) || mask.Shape().Dim(1) != x.Shape().Dim(1)) {
+		Panicf("transformer: mask for %s must be a boolean tensor shaped [batch_size, seq_len], got mask.shape=%s "+
+			"for %s.shape=%s", name, mask.Shape(), name, x.Shape())
+	}
+}
+
+// headDimFor returns the dimension of the attention heads for the given model dimension.
+func (c *Config) headDimFor(modelDim int) int {
+	if c.headDim > 0 {
+		return c.headDim
+	}
+	if modelDim%c.numHeads != 0 {
+		Panicf("transformer: model dimension %d is not divisible by the number of heads %d, set HeadDim explicitly",
+			modelDim, c.numHeads)
+	}
+	return modelDim / c.numHeads
+}
+
+// normalize x with the configured normalization.
+func (c *Config) normalize(ctx *context.Context, x *Node) *Node {
+	return layers.MustNormalizeByName(ctx, c.normalization, x)
+}
+
+// residual applies the sublayer fn to x with a residual connection, and normalization and dropout as configured.
+func (c *Config) residual(ctx *context.Context, x *Node, fn func(ctx *context.Context, x *Node) *Node) *Node {
+	g := x.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
+	y := x
+	if c.preNorm {
+		y = c.normalize(ctx.In("norm"), y)
+	}
+	y = fn(ctx, y)
+	y = layers.DropoutStatic(ctx, y, c.dropoutRate)
+	x = Add(x, y)
+	if !c.preNorm {
+		x = c.normalize(ctx.In("norm"), x)
+	}
+	return x
+}
+
+// positions returns the positions of the elements of x, shaped `[seq_len]`: [0, seqLen), offset by the KV cache
+// position if it is configured and cached is true.
+func (c *Config) positions(x *Node, cached bool) *Node {
+	pos := Iota(x.Graph(), shapes.Make(dtypes.Int32, x.Shape().Dim(1)), 0)
+	if cached && c.kvCacheMaxLength > 0 {
+		pos = Add(pos, ConvertDType(c.kvCachePosition, dtypes.Int32))
+	}
+	return pos
+}
+
+// addPositionEncoding adds the sinusoidal or learned position encodings to x, if configured.
+func (c *Config) addPositionEncoding(ctx *context.Context, x, pos *Node) *Node {
+	var encoding *Node
+	switch c.positionEncoding {
+	case PositionSinusoidal:
+		encoding = SinusoidalEncoding(pos, x.Shape().Dim(-1), x.DType())
+	case PositionLearned:
+		encoding = LearnedPositionEncoding(ctx, pos, c.maxPositions, x.Shape().Dim(-1), x.DType())
+	default:
+		return x
+	}
+	return Add(x, BroadcastToDims(InsertAxes(encoding, 0), x.Shape().Dimensions...))
+}
+
+// selfAttention sublayer, with the RoPE and ALiBi position encodings, if configured.
+// If causal (decoder) and a KV cache is configured, it uses the KV cache.
+func (c *Config) selfAttention(ctx *context.Context, x, mask *Node, causal bool) *Node {
+	modelDim := x.Shape().Dim(-1)
+	attention := layers.MultiHeadAttention(ctx, x, x, x, c.numHeads, c.headDimFor(modelDim)).
+		SetOutputDim(modelDim).
+		UseProjectionBias(c.useBias).
+		Dropout(c.attentionDropoutRate)
+	if c.numKVHeads > 0 {
+		attention.SetNumKVHeads(c.numKVHeads)
+	}
+	if mask != nil {
+		attention.SetKeyMask(mask)
+	}
+	if causal {
+		attention.UseCausalMask()
+	}
+	cached := causal && c.kvCacheMaxLength > 0
+	if cached {
+		attention.UseKVCache(c.kvCacheMaxLength, c.kvCachePosition)
+	}
+	pos := c.positions(x, cached)
+	switch c.positionEncoding {
+	case PositionRoPE:
+		attention.SetQueryKeyTransform(func(projectedQuery, projectedKey *Node) (*Node, *Node) {
+			return RoPE(projectedQuery, pos, c.ropeBase), RoPE(projectedKey, pos, c.ropeBase)
+		})
+	case PositionALiBi:
+		keyPos := pos
+		if cached {
+			keyPos = Iota(x.Graph(), shapes.Make(dtypes.Int32, c.kvCacheMaxLength), 0)
+		}
+		attention.SetAttentionBias(ALiBiBias(pos, keyPos, c.numHeads, x.DType()))
+	default:
+	}
+	return attention.Done()
+}
+
+// feedForward sublayer, built with fnn.
+func (c *Config) feedForward(ctx *context.Context, x *Node) *Node {
+	modelDim := x.Shape().Dim(-1)
+	ffnDim := c.ffnDim
+	if ffnDim <= 0 {
+		ffnDim = 4 * modelDim
+	}
+	// linear creates a fnn with no hidden layers (a linear projection), overriding any fnn hyperparameters.
+	linear := func(ctx *context.Context, x *Node, dim int) *fnn.Config {
+		return fnn.New(ctx, x, dim).
+			NumHiddenLayers(0, 0).
+			Normalization("").
+			Dropout(0).
+			Residual(false).
+			UseBias(c.useBias)
+	}
+	if !c.gatedFFN {
+		return linear(ctx, x, modelDim).
+			NumHiddenLayers(1, ffnDim).
+			Activation(c.activation).
+			Done()
+	}
+	gate := linear(ctx.In("gate"), x, ffnDim).Done()
+	up := linear(ctx.In("up"), x, ffnDim).Done()
+	hidden := Mul(activations.Apply(c.activation, gate), up)
+	return linear(ctx.In("down"), hidden, modelDim).Done()
+}
@@ -0,0 +1,154 @@
+package transformer
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers/activations"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+func TestSinusoidalEncoding(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	encoding := MustExecOnce(backend, func(g *Graph) *Node {
+		return SinusoidalEncoding(Const(g, []int32{0, 1, 2}), 4, dtypes.Float64)
+	})
+	require.NoError(t, encoding.Shape().Check(dtypes.Float64, 3, 4))
+	got := encoding.Value().([][]float64)
+	assert.InDeltaSlice(t, []float64{0, 1, 0, 1}, got[0], 1e-6)
+	assert.InDeltaSlice(t, []float64{math.Sin(2), math.Cos(2), math.Sin(0.02), math.Cos(0.02)}, got[2], 1e-6)
+}
+
+func TestRoPE(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	// Dot-products of rotated queries and keys only depend on their relative position.
+	outputs := MustExecOnceN(backend, func(q, k *Node) []*Node {
+		g := q.Graph()
+		seqLen := q.Shape().Dim(1)
+		pos := Iota(g, shapes.Make(dtypes.Int32, seqLen), 0)
+		rotatedQ := RoPE(q, pos, 10000)
+		rotatedK := RoPE(k, pos, 10000)
+		// q[0] and k[1] vs q[2] and k[3]: both with relative distance 1.
+		dots := Einsum("bshd,bthd->bhst", rotatedQ, rotatedK)
+		// Norms are preserved.
+		return []*Node{dots, ReduceSum(Square(q), -1), ReduceSum(Square(rotatedQ), -1)}
+	}, [][][][]float64{{{{1, 2, 3, 4}}, {{1, 2, 3, 4}}, {{1, 2, 3, 4}}, {{1, 2, 3, 4}}}},
+		[][][][]float64{{{{0.5, -1, 2, 1}}, {{0.5, -1, 2, 1}}, {{0.5, -1, 2, 1}}, {{0.5, -1, 2, 1}}}})
+	dots := outputs[0].Value().([][][][]float64)[0][0]
+	assert.InDelta(t, dots[0][1], dots[2][3], 1e-6)
+	assert.InDelta(t, dots[1][0], dots[3][2], 1e-6)
+	assert.Greater(t, math.Abs(dots[0][1]-dots[0][2]), 1e-3)
+	assert.InDeltaSlice(t, outputs[1].Value().([][][]float64)[0][3], outputs[2].Value().([][][]float64)[0][3], 1e-6)
+}
+
+func TestALiBi(t *testing.T) {
+	assert.InDeltaSlice(t, []float64{1.0 / 2, 1.0 / 4, 1.0 / 8, 1.0 / 16, 1.0 / 32, 1.0 / 64, 1.0 / 128, 1.0 / 256},
+		ALiBiSlopes(8), 1e-9)
+	slopes := ALiBiSlopes(6)
+	require.Len(t, slopes, 6)
+	assert.InDeltaSlice(t, []float64{math.Pow(2, -2), math.Pow(2, -4), math.Pow(2, -6), math.Pow(2, -8),
+		math.Pow(2, -1), math.Pow(2, -3)}, slopes, 1e-9)
+
+	backend := graphtest.BuildTestBackend()
+	bias := MustExecOnce(backend, func(g *Graph) *Node {
+		pos := Iota(g, shapes.Make(dtypes.Int32, 3), 0)
+		return ALiBiBias(pos, pos, 2, dtypes.Float32)
+	})
+	require.NoError(t, bias.Shape().Check(dtypes.Float32, 1, 3, 2, 3))
+	got := bias.Value().([][][][]float32)[0]
+	// Slopes for 2 heads are 1/16 and 1/256.
+	assert.InDeltaSlice(t, []float32{-2.0 / 256, -1.0 / 256, 0}, got[2][1], 1e-7)
+	assert.InDeltaSlice(t, []float32{-1.0 / 16, 0, -1.0 / 16}, got[1][0], 1e-7)
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, seqLen, memoryLen, modelDim = 2, 5, 3, 8
+	for _, positionEncoding := range PositionEncodingValues() {
+		for _, preNorm := range []bool{true, false} {
+			ctx := context.New()
+			ctx.SetParam(ParamPositionEncoding, positionEncoding.String())
+			ctx.SetParam(ParamNumLayers, 2)
+			ctx.SetParam(ParamNormalization, "rms")
+			cfg := New(ctx).NumHeads(2).PreNorm(preNorm).GatedFFN(preNorm).Activation(activations.TypeSwish)
+			exec := context.MustNewExec(backend, ctx, func(ctx *context.Context, x, memory, mask *Node) *Node {
+				encoded := cfg.Encoder(ctx.In("encoder"), memory, nil)
+				return cfg.Decoder(ctx.In("decoder"), x, mask, encoded, nil)
+			})
+			x := tensors.FromShape(shapes.Make(dtypes.Float32, batchSize, seqLen, modelDim))
+			tensors.MutableFlatData(x, func(flat []float32) {
+				for ii := range flat {
+					flat[ii] = float32(math.Sin(float64(ii)))
+				}
+			})
+			memory := tensors.FromShape(shapes.Make(dtypes.Float32, batchSize, memoryLen, modelDim))
+			mask := tensors.FromValue([][]bool{{true, true, true, true, true}, {true, true, true, false, false}})
+			output := exec.MustExec(x, memory, mask)[0]
+			require.NoError(t, output.Shape().Check(dtypes.Float32, batchSize, seqLen, modelDim),
+				"positionEncoding=%s, preNorm=%v", positionEncoding, preNorm)
+
+			// Causality: changing the last element of the sequence doesn't change the output of the previous ones.
+			tensors.MutableFlatData(x, func(flat []float32) {
+				for ii := (seqLen - 1) * modelDim; ii < seqLen*modelDim; ii++ {
+					flat[ii] = 7
+				}
+			})
+			output2 := exec.MustExec(x, memory, mask)[0]
+			got, got2 := output.Value().([][][]float32), output2.Value().([][][]float32)
+			for pos := range seqLen - 1 {
+				assert.InDeltaSlice(t, got[0][pos], got2[0][pos], 1e-4, "positionEncoding=%s, preNorm=%v, pos=%d",
+					positionEncoding, preNorm, pos)
+			}
+			assert.NotEqual(t, got[0][seqLen-1], got2[0][seqLen-1])
+
+			// Variables: 2 encoder blocks (self-attention + ffn) + 2 decoder blocks (self-attention, cross-attention,
+			// ffn).
+			assert.NotNil(t, ctx.In("decoder").In("decoder_block_1").In("cross_attention").
+				In("MultiHeadAttention").In("query").In("dense").GetVariable("weights"))
+			gateVar := ctx.In("decoder").In("decoder_block_1").In("ffn").In("gate").In("fnn_output_layer").
+				GetVariable("weights")
+			assert.Equal(t, preNorm, gateVar != nil)
+		}
+	}
+}
+
+func TestDecoderKVCache(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	const batchSize, seqLen, maxLength, modelDim = 2, 4, 6, 8
+	x := tensors.FromShape(shapes.Make(dtypes.Float32, batchSize, seqLen, modelDim))
+	tensors.MutableFlatData(x, func(flat []float32) {
+		for ii := range flat {
+			flat[ii] = float32(math.Cos(float64(ii)))
+		}
+	})
+	xValues := x.Value().([][][]float32)
+	for _, positionEncoding := range PositionEncodingValues() {
+		ctx := context.New()
+		cfg := New(ctx).NumLayers(2).NumHeads(4).NumKVHeads(2).PositionEncoding(positionEncoding)
+		fullExec := context.MustNewExec(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+			return cfg.Decoder(ctx, x, nil, nil, nil)
+		})
+		want := fullExec.MustExec(x)[0].Value().([][][]float32)
+
+		cachedExec := context.MustNewExec(backend, ctx.Reuse(), func(ctx *context.Context, x, position *Node) *Node {
+			return cfg.WithKVCache(maxLength, position).Decoder(ctx, x, nil, nil, nil)
+		})
+		for pos := range seqLen {
+			step := [][][]float32{xValues[0][pos : pos+1], xValues[1][pos : pos+1]}
+			got := cachedExec.MustExec(step, int32(pos))[0].Value().([][][]float32)
+			for batchIdx := range batchSize {
+				assert.InDeltaSlice(t, want[batchIdx][pos], got[batchIdx][0], 1e-4, "positionEncoding=%s, pos=%d",
+					positionEncoding, pos)
+			}
+		}
+	}
+}
@@ -239,6 +239,8 @@ func (c *Config) Done() *Node {
 	ctx := c.ctx
 	operand := c.operand
 	g := operand.Graph()
+	g.PushScope(ctx.Scope())
+	defer g.PopScope()
 	dtype := operand.DType()
 
 	// Activation function.
@@ -0,0 +1,488 @@
+package onnx
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gomlx/gomlx/backends"
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+)
+
+// ExportOpsetVersion is the version of the default ("ai.onnx") operator set used by exported models.
+const ExportOpsetVersion = 17
+
+// exportIRVersion is the ONNX IR version matching ExportOpsetVersion.
+const exportIRVersion = 8
+
+// Exporter converts a GoMLX model -- a graph building function and the variables of its context -- to an ONNX model.
+//
+// The graph function takes the same forms accepted by context.NewExecAny: a *context.Context followed by one
+// or more *Node (or one []*Node), and it returns one or more *Node (or one []*Node).
+// Create it with NewExporter, optionally configure it, and then call Export or ExportToFile with the shapes of the
+// inputs.
+//
+// Example:
+//
+//	modelFn := func(ctx *context.Context, x *Node) *Node { … }
+//	err := onnx.NewExporter(backend, ctx, modelFn).
+//		WithInputNames("images").
+//		WithOutputNames("logits").
+//		ExportToFile("model.onnx", onnx.ValueShape{DType: dtypes.Float32, Dimensions: []int{-1, 28, 28, 1}})
+//
+// The graph function is traced (the graph is built but not executed) for the given input shapes, and each node
+// of the graph is converted to one or more ONNX operators. Variables used by the graph are exported as initializers,
+// named after the variable's scope and name: they are initialized first, if needed.
+//
+// Dimensions set to -1 in the input shapes are exported as symbolic (dynamic) dimensions, e.g.: the batch size.
+// To find out which dimensions of the intermediary values depend on them, the graph is traced twice with different
+// values for the dynamic dimensions, so the graph function shouldn't depend on their values, other than for shapes.
+//
+// Nodes without an ONNX equivalent (e.g.: random number generation) or unsupported configurations of nodes
+// (e.g.: a reshape that depends on two dynamic dimensions) are reported as errors.
+type Exporter struct {
+	backend     backends.Backend
+	ctx         *context.Context
+	ctxGraphFn  any
+	name        string
+	inputNames  []string
+	outputNames []string
+}
+
+// NewExporter creates an Exporter for the graph function ctxGraphFn and the variables in ctx.
+// The backend is only used to build (trace) the graph, it is not executed.
+//
+// See Exporter for the accepted forms of ctxGraphFn.
+func NewExporter(backend backends.Backend, ctx *context.Context, ctxGraphFn any) *Exporter {
+	return &Exporter{
+		backend:    backend,
+		ctx:        ctx,
+		ctxGraphFn: ctxGraphFn,
+		name:       "gomlx_model",
+	}
+}
+
+// WithName sets the name of the exported ONNX graph. Default is "gomlx_model".
+// It returns the Exporter, so calls can be cascaded.
+func (e *Exporter) WithName(name string) *Exporter {
+	e.name = name
+	return e
+}
+
+// WithInputNames sets the names of the inputs of the exported model. Default is "input_0", "input_1", etc.
+// It returns the Exporter, so calls can be cascaded.
+func (e *Exporter) WithInputNames(names ...string) *Exporter {
+	e.inputNames = names
+	return e
+}
+
+// WithOutputNames sets the names of the outputs of the exported model. Default is "output_0", "output_1", etc.
+// It returns the Exporter, so calls can be cascaded.
+func (e *Exporter) WithOutputNames(names ...string) *Exporter {
+	e.outputNames = names
+	return e
+}
+
+// ExportToFile exports the model for the given input shapes (see Export) and saves it to filePath.
+func (e *Exporter) ExportToFile(filePath string, inputs ...ValueShape) error {
+	proto, err := e.Export(inputs...)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, proto.Marshal(), 0o644); err != nil {
+		return errors.Wrapf(err, "failed to write ONNX model to %q", filePath)
+	}
+	return nil
+}
+
+// Export traces the graph function for the given input shapes and converts it to an ONNX model.
+//
+// Dimensions set to -1 are exported as symbolic dimensions, named after the corresponding ValueShape.DimNames.
+// Unnamed dynamic dimensions are named "batch" if they are the first axis, or "<input_name>_<axis>" otherwise.
+func (e *Exporter) Export(inputs ...ValueShape) (proto *ModelProto, err error) {
+	err = TryCatch[error](func() { proto = e.export(inputs) })
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to export model to ONNX")
+	}
+	return proto, nil
+}
+
+// dynamicDim is a symbolic dimension of the inputs, and the values used for each of the 2 traces.
+type dynamicDim struct {
+	name   string
+	values [2]int
+}
+
+// Values used for dynamic dimensions in the 2 traces of the graph function.
+var dynamicDimValues = [2][]int{{3, 5, 7, 11, 13, 17}, {19, 23, 29, 31, 37, 41}}
+
+func (e *Exporter) export(inputs []ValueShape) *ModelProto {
+	if len(inputs) == 0 {
+		Panicf("at least one input shape must be given")
+	}
+	if e.inputNames != nil && len(e.inputNames) != len(inputs) {
+		Panicf("%d input names given for %d inputs", len(e.inputNames), len(inputs))
+	}
+	inputNames := e.inputNames
+	if inputNames == nil {
+		inputNames = make([]string, len(inputs))
+		for ii := range inputs {
+			inputNames[ii] = fmt.Sprintf("input_%d", ii)
+		}
+	}
+
+	// Collect the dynamic dimensions and build the concrete shapes for each trace.
+	var dynamicDims []*dynamicDim
+	dimsByName := make(map[string]*dynamicDim)
+	var traceShapes [2][]shapes.Shape
+	inputsDimParams := make([][]string, len(inputs))
+	for ii, input := range inputs {
+		for trace := range traceShapes {
+			traceShapes[trace] = append(traceShapes[trace],
+				shapes.Shape{DType: input.DType, Dimensions: slices.Clone(input.Dimensions)})
+		}
+		inputsDimParams[ii] = make([]string, len(input.Dimensions))
+		for axis, dim := range input.Dimensions {
+			if dim >= 0 {
+				continue
+			}
+			name := ""
+			if axis < len(input.DimNames) {
+				name = input.DimNames[axis]
+			}
+			if name == "" {
+				if axis == 0 {
+					name = "batch"
+				} else {
+					name = fmt.Sprintf("%s_%d", inputNames[ii], axis)
+				}
+			}
+			dynDim, found := dimsByName[name]
+			if !found {
+				if len(dynamicDims) == len(dynamicDimValues[0]) {
+					Panicf("too many dynamic dimensions, at most %d are supported", len(dynamicDimValues[0]))
+				}
+				dynDim = &dynamicDim{name: name}
+				for trace := range dynDim.values {
+					dynDim.values[trace] = dynamicDimValues[trace][len(dynamicDims)]
+				}
+				dynamicDims = append(dynamicDims, dynDim)
+				dimsByName[name] = dynDim
+			}
+			inputsDimParams[ii][axis] = name
+			for trace := range traceShapes {
+				traceShapes[trace][ii].Dimensions[axis] = dynDim.values[trace]
+			}
+		}
+	}
+
+	// Trace the graph function: twice if there are dynamic dimensions.
+	numTraces := 1
+	if len(dynamicDims) > 0 {
+		numTraces = 2
+	}
+	var graphs [2]*Graph
+	var outputs [2][]*Node
+	for trace := range numTraces {
+		graphs[trace], outputs[trace] = e.trace(traceShapes[trace], inputNames)
+		defer graphs[trace].Finalize()
+	}
+	if e.outputNames != nil && len(e.outputNames) != len(outputs[0]) {
+		Panicf("%d output names given for %d outputs", len(e.outputNames), len(outputs[0]))
+	}
+	outputNames := e.outputNames
+	if outputNames == nil {
+		outputNames = make([]string, len(outputs[0]))
+		for ii := range outputs[0] {
+			outputNames[ii] = fmt.Sprintf("output_%d", ii)
+		}
+	}
+	e.ctx.InitializeVariables(e.backend)
+
+	x := &graphExporter{
+		ctx:                e.ctx,
+		graph:              &GraphProto{Name: e.name},
+		names:              make(map[NodeId]string),
+		dynamic:            make(map[NodeId][]bool),
+		dynamicConstants:   make(map[NodeId]bool),
+		partiallyBroadcast: make(map[NodeId]bool),
+	}
+	nodes := x.neededNodes(outputs[0])
+	x.checkSupported(nodes)
+	if numTraces == 2 {
+		x.findDynamicAxes(graphs[0], graphs[1])
+	}
+
+	// Inputs.
+	for ii := range inputs {
+		x.graph.Input = append(x.graph.Input, valueInfoFromShape(inputNames[ii], traceShapes[0][ii], inputsDimParams[ii]))
+	}
+
+	// Nodes, in the order they were created in the graph, which is topologically sorted.
+	for _, node := range nodes {
+		x.convertNode(node)
+	}
+
+	// Outputs: rename the values with an Identity operator.
+	for ii, output := range outputs[0] {
+		if x.partiallyBroadcast[output.Id()] {
+			Panicf("output #%d is a broadcast to a dynamic dimension, not supported", ii)
+		}
+		x.emitTo("Identity", []string{x.names[output.Id()]}, outputNames[ii])
+		var dimParams []string
+		if numTraces == 2 {
+			dimParams = make([]string, output.Rank())
+			for axis, isDynamic := range x.dynamic[output.Id()] {
+				if !isDynamic {
+					continue
+				}
+				dimParams[axis] = fmt.Sprintf("%s_%d", outputNames[ii], axis)
+				dims := [2]int{output.Shape().Dimensions[axis], outputs[1][ii].Shape().Dimensions[axis]}
+				for _, dynDim := range dynamicDims {
+					if dynDim.values == dims {
+						dimParams[axis] = dynDim.name
+						break
+					}
+				}
+			}
+		}
+		x.graph.Output = append(x.graph.Output, valueInfoFromShape(outputNames[ii], output.Shape(), dimParams))
+	}
+
+	return &ModelProto{
+		IRVersion:    exportIRVersion,
+		ProducerName: "gomlx",
+		Graph:        x.graph,
+		OpsetImport:  []*OperatorSetIDProto{{Version: ExportOpsetVersion}},
+	}
+}
+
+// trace builds the graph for the given input shapes, and returns it along with its outputs.
+func (e *Exporter) trace(inputShapes []shapes.Shape, inputNames []string) (g *Graph, outputs []*Node) {
+	fnV := reflect.ValueOf(e.ctxGraphFn)
+	fnT := fnV.Type()
+	if fnT.Kind() != reflect.Func || fnT.NumIn() < 2 || fnT.In(0) != reflect.TypeOf(e.ctx) {
+		Panicf("the graph function must take a *context.Context followed by the inputs, got %s", fnT)
+	}
+	nodeT := reflect.TypeOf((*Node)(nil))
+	nodeSliceT := reflect.TypeOf([]*Node(nil))
+
+	g = NewGraph(e.backend, e.name)
+	params := make([]*Node, len(inputShapes))
+	for ii, shape := range inputShapes {
+		params[ii] = Parameter(g, inputNames[ii], shape)
+	}
+	args := []reflect.Value{reflect.ValueOf(e.ctx.Checked(false))}
+	switch {
+	case fnT.NumIn() == 2 && fnT.In(1) == nodeSliceT:
+		args = append(args, reflect.ValueOf(params))
+	case fnT.NumIn()-1 == len(params):
+		for ii, param := range params {
+			if fnT.In(ii+1) != nodeT {
+				Panicf("input #%d of the graph function is not a *Node, got %s", ii, fnT.In(ii+1))
+			}
+			args = append(args, reflect.ValueOf(param))
+		}
+	default:
+		Panicf("the graph function %s takes %d inputs, but %d input shapes were given",
+			fnT, fnT.NumIn()-1, len(params))
+	}
+	for _, result := range fnV.Call(args) {
+		switch result.Type() {
+		case nodeT:
+			outputs = append(outputs, result.Interface().(*Node))
+		case nodeSliceT:
+			outputs = append(outputs, result.Interface().([]*Node)...)
+		default:
+			Panicf("the graph function must return *Node or []*Node, got %s", result.Type())
+		}
+	}
+	if len(outputs) == 0 {
+		Panicf("the graph function returned no outputs")
+	}
+	return
+}
+
+// graphExporter converts the nodes of a traced graph to ONNX.
+type graphExporter struct {
+	ctx   *context.Context
+	graph *GraphProto
+
+	// names of the ONNX values holding the output of each graph node.
+	names map[NodeId]string
+
+	// dynamic holds for each node which axes are dynamic. Only set if there are dynamic dimensions.
+	dynamic map[NodeId][]bool
+
+	// dynamicConstants are the constant nodes whose values change with the dynamic dimensions.
+	dynamicConstants map[NodeId]bool
+
+	// partiallyBroadcast are the nodes whose ONNX values were not broadcast to some of its dynamic axes (they
+	// have dimension 1 instead). They can only be used by element-wise operations, which broadcast them implicitly.
+	partiallyBroadcast map[NodeId]bool
+
+	// counter used to generate unique value names.
+	counter int
+}
+
+// neededNodes returns the nodes needed to compute the outputs, in the order they were created.
+func (x *graphExporter) neededNodes(outputs []*Node) []*Node {
+	needed := make(map[NodeId]bool)
+	toVisit := slices.Clone(outputs)
+	for len(toVisit) > 0 {
+		node := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if needed[node.Id()] {
+			continue
+		}
+		needed[node.Id()] = true
+		toVisit = append(toVisit, node.Inputs()...)
+	}
+	var nodes []*Node
+	for _, node := range outputs[0].Graph().Nodes() {
+		if needed[node.Id()] {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// checkSupported panics listing the node types that can't be exported, if any.
+func (x *graphExporter) checkSupported(nodes []*Node) {
+	unsupported := make(map[NodeType]int)
+	for _, node := range nodes {
+		if _, found := exportConverters[node.Type()]; !found {
+			unsupported[node.Type()]++
+		}
+	}
+	if len(unsupported) == 0 {
+		return
+	}
+	var list []string
+	for nodeType, count := range unsupported {
+		if count == 1 {
+			list = append(list, fmt.Sprintf("%s (1 node)", nodeType))
+		} else {
+			list = append(list, fmt.Sprintf("%s (%d nodes)", nodeType, count))
+		}
+	}
+	sort.Strings(list)
+	Panicf("graph uses operations without an ONNX equivalent: %s", strings.Join(list, ", "))
+}
+
+// findDynamicAxes compares the graphs of the 2 traces and marks the axes of each node whose dimension changed.
+func (x *graphExporter) findDynamicAxes(g0, g1 *Graph) {
+	nodes0, nodes1 := g0.Nodes(), g1.Nodes()
+	if len(nodes0) != len(nodes1) {
+		Panicf("the graph changes with the values of the dynamic dimensions (%d nodes vs %d nodes), "+
+			"it can't be exported with dynamic dimensions", len(nodes0), len(nodes1))
+	}
+	for ii, node0 := range nodes0 {
+		node1 := nodes1[ii]
+		if node0.Type() != node1.Type() || node0.Rank() != node1.Rank() {
+			Panicf("the graph changes with the values of the dynamic dimensions (%s vs %s), "+
+				"it can't be exported with dynamic dimensions", node0, node1)
+		}
+		dynamic := make([]bool, node0.Rank())
+		for axis := range dynamic {
+			dynamic[axis] = node0.Shape().Dimensions[axis] != node1.Shape().Dimensions[axis]
+		}
+		x.dynamic[node0.Id()] = dynamic
+		if node0.Type() == NodeTypeConstant && !node0.ConstantValue().Equal(node1.ConstantValue()) {
+			x.dynamicConstants[node0.Id()] = true
+		}
+	}
+}
+
+// isDynamic returns whether the axis of the node is dynamic.
+func (x *graphExporter) isDynamic(node *Node, axis int) bool {
+	dynamic := x.dynamic[node.Id()]
+	return dynamic != nil && dynamic[axis]
+}
+
+// hasDynamicAxes returns whether any of the axes of the node is dynamic.
+func (x *graphExporter) hasDynamicAxes(node *Node) bool {
+	return slices.Contains(x.dynamic[node.Id()], true)
+}
+
+// convertNode converts one graph node to ONNX operators.
+func (x *graphExporter) convertNode(node *Node) {
+	err := TryCatch[error](func() {
+		allInputsPartial := len(node.Inputs()) > 0
+		for _, input := range node.Inputs() {
+			if !x.partiallyBroadcast[input.Id()] {
+				allInputsPartial = false
+			} else if !elementWiseNodeTypes.Has(node.Type()) {
+				Panicf("broadcast to a dynamic dimension (node #%d) is only supported if used by element-wise "+
+					"operations", input.Id())
+			}
+		}
+		x.names[node.Id()] = exportConverters[node.Type()](x, node)
+		if allInputsPartial {
+			x.partiallyBroadcast[node.Id()] = true
+		}
+	})
+	if err != nil {
+		panic(errors.WithMessagef(err, "exporting node %s", node))
+	}
+}
+
+// name returns the ONNX value name of the output of the node.
+func (x *graphExporter) name(node *Node) string {
+	name, found := x.names[node.Id()]
+	if !found {
+		Panicf("node #%d not converted yet", node.Id())
+	}
+	return name
+}
+
+// newName returns a new unique value name with the given prefix.
+func (x *graphExporter) newName(prefix string) string {
+	x.counter++
+	return fmt.Sprintf("%s_%d", prefix, x.counter)
+}
+
+// emit appends an ONNX operator to the graph, and returns the name of its output.
+func (x *graphExporter) emit(opType string, inputs []string, attrs ...*AttributeProto) string {
+	return x.emitTo(opType, inputs, x.newName(strings.ToLower(opType)), attrs...)
+}
+
+// emitTo appends an ONNX operator to the graph with the given output name, and returns it.
+func (x *graphExporter) emitTo(opType string, inputs []string, output string, attrs ...*AttributeProto) string {
+	x.graph.Node = append(x.graph.Node, &NodeProto{
+		Name:      fmt.Sprintf("%s_%d", opType, len(x.graph.Node)),
+		OpType:    opType,
+		Input:     inputs,
+		Output:    []string{output},
+		Attribute: attrs,
+	})
+	return output
+}
+
+// valueInfoFromShape creates the ValueInfoProto for a value with the given shape. Axes with a non-empty dimParams
+// are set as symbolic.
+func valueInfoFromShape(name string, shape shapes.Shape, dimParams []string) *ValueInfoProto {
+	dataType, err := DataTypeFromDType(shape.DType)
+	if err != nil {
+		panic(errors.WithMessagef(err, "value %q", name))
+	}
+	tensorShape := &TensorShapeProto{}
+	for axis, dim := range shape.Dimensions {
+		if axis < len(dimParams) && dimParams[axis] != "" {
+			tensorShape.Dim = append(tensorShape.Dim, &DimensionProto{DimParam: dimParams[axis]})
+		} else {
+			tensorShape.Dim = append(tensorShape.Dim, &DimensionProto{DimValue: int64(dim)})
+		}
+	}
+	return &ValueInfoProto{
+		Name: name,
+		Type: &TypeProto{TensorType: &TensorTypeProto{ElemType: dataType, Shape: tensorShape}},
+	}
+}
@@ -0,0 +1,666 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/gomlx/gomlx/backends"
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/sets"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// exportConverter converts a graph node to one or more ONNX operators, and returns the name of the value
+// holding the node output.
+type exportConverter func(x *graphExporter, node *Node) string
+
+// exportConverters maps the supported node types to their converters.
+var exportConverters map[NodeType]exportConverter
+
+func init() {
+	exportConverters = map[NodeType]exportConverter{
+		NodeTypeParameter: exportParameter,
+		NodeTypeConstant:  exportConstant,
+		NodeTypeIota:      exportIota,
+
+		// Element-wise unary operations.
+		NodeTypeAbs:        exportSimpleOp("Abs"),
+		NodeTypeNeg:        exportSimpleOp("Neg"),
+		NodeTypeExp:        exportSimpleOp("Exp"),
+		NodeTypeLog:        exportSimpleOp("Log"),
+		NodeTypeSqrt:       exportSimpleOp("Sqrt"),
+		NodeTypeTanh:       exportSimpleOp("Tanh"),
+		NodeTypeLogistic:   exportSimpleOp("Sigmoid"),
+		NodeTypeErf:        exportSimpleOp("Erf"),
+		NodeTypeFloor:      exportSimpleOp("Floor"),
+		NodeTypeCeil:       exportSimpleOp("Ceil"),
+		NodeTypeRound:      exportSimpleOp("Round"),
+		NodeTypeSign:       exportSimpleOp("Sign"),
+		NodeTypeSin:        exportSimpleOp("Sin"),
+		NodeTypeCos:        exportSimpleOp("Cos"),
+		NodeTypeLogicalNot: exportSimpleOp("Not"),
+		NodeTypeIsNaN:      exportSimpleOp("IsNaN"),
+		NodeTypeIdentity:   exportSimpleOp("Identity"),
+		NodeTypeRsqrt:      exportRsqrt,
+		NodeTypeExpm1:      exportExpm1,
+		NodeTypeLog1p:      exportLog1p,
+		NodeTypeIsFinite:   exportIsFinite,
+
+		// Element-wise binary operations: ONNX broadcasting is a superset of the one supported by the backends.
+		NodeTypeAdd:            exportSimpleOp("Add"),
+		NodeTypeSub:            exportSimpleOp("Sub"),
+		NodeTypeMul:            exportSimpleOp("Mul"),
+		NodeTypeDiv:            exportSimpleOp("Div"),
+		NodeTypePow:            exportSimpleOp("Pow"),
+		NodeTypeMax:            exportSimpleOp("Max"),
+		NodeTypeMin:            exportSimpleOp("Min"),
+		NodeTypeEqual:          exportSimpleOp("Equal"),
+		NodeTypeGreaterThan:    exportSimpleOp("Greater"),
+		NodeTypeGreaterOrEqual: exportSimpleOp("GreaterOrEqual"),
+		NodeTypeLessThan:       exportSimpleOp("Less"),
+		NodeTypeLessOrEqual:    exportSimpleOp("LessOrEqual"),
+		NodeTypeLogicalAnd:     exportSimpleOp("And"),
+		NodeTypeLogicalOr:      exportSimpleOp("Or"),
+		NodeTypeLogicalXor:     exportSimpleOp("Xor"),
+		NodeTypeWhere:          exportSimpleOp("Where"),
+		NodeTypeNotEqual:       exportNotEqual,
+		NodeTypeRem:            exportRem,
+		NodeTypeClamp:          exportClamp,
+		NodeTypeConvertDType:   exportConvertDType,
+
+		// Linear algebra and neural networks.
+		NodeTypeDot:                   exportSimpleOp("MatMul"),
+		NodeTypeDotGeneral:            exportDotGeneral,
+		NodeTypeConvGeneral:           exportConvGeneral,
+		NodeTypeReduceWindow:          exportReduceWindow,
+		NodeTypeBatchNormForInference: exportBatchNormForInference,
+
+		// Reductions.
+		NodeTypeReduceSum:     exportReduce("ReduceSum"),
+		NodeTypeReduceMax:     exportReduce("ReduceMax"),
+		NodeTypeReduceMin:     exportReduce("ReduceMin"),
+		NodeTypeReduceProduct: exportReduce("ReduceProd"),
+		NodeTypeArgMinMax:     exportArgMinMax,
+
+		// Shape manipulation.
+		NodeTypeReshape:        exportReshape,
+		NodeTypeTranspose:      exportTranspose,
+		NodeTypeBroadcastInDim: exportBroadcastInDim,
+		NodeTypeConcatenate:    exportConcatenate,
+		NodeTypeSlice:          exportSlice,
+		NodeTypeReverse:        exportReverse,
+		NodeTypePad:            exportPad,
+		NodeTypeGather:         exportGather,
+	}
+}
+
+// elementWiseNodeTypes are the node types exported to ONNX element-wise operators, which support implicit
+// (multidirectional) broadcasting of their operands.
+var elementWiseNodeTypes = sets.MakeWith(
+	NodeTypeAbs, NodeTypeNeg, NodeTypeExp, NodeTypeLog, NodeTypeSqrt, NodeTypeTanh, NodeTypeLogistic, NodeTypeErf,
+	NodeTypeFloor, NodeTypeCeil, NodeTypeRound, NodeTypeSign, NodeTypeSin, NodeTypeCos, NodeTypeLogicalNot,
+	NodeTypeIsNaN, NodeTypeIdentity, NodeTypeRsqrt, NodeTypeExpm1, NodeTypeLog1p, NodeTypeIsFinite,
+	NodeTypeAdd, NodeTypeSub, NodeTypeMul, NodeTypeDiv, NodeTypePow, NodeTypeMax, NodeTypeMin, NodeTypeEqual,
+	NodeTypeGreaterThan, NodeTypeGreaterOrEqual, NodeTypeLessThan, NodeTypeLessOrEqual, NodeTypeLogicalAnd,
+	NodeTypeLogicalOr, NodeTypeLogicalXor, NodeTypeWhere, NodeTypeNotEqual, NodeTypeRem, NodeTypeClamp,
+	NodeTypeConvertDType)
+
+// staticInput returns the static input of the node with the given name, converted to T.
+func staticInput[T any](node *Node, name string) T {
+	value, found := node.StaticInputs()[name]
+	if !found {
+		Panicf("node %s has no static input %q", node.Type(), name)
+	}
+	return value.(T)
+}
+
+// inputNames returns the ONNX value names of the node inputs.
+func (x *graphExporter) inputNames(node *Node) []string {
+	return xslices.Map(node.Inputs(), x.name)
+}
+
+// constant adds the tensor as an initializer, and returns its name.
+func (x *graphExporter) constant(t *tensors.Tensor) string {
+	name := x.newName("const")
+	proto, err := TensorToProto(name, t)
+	if err != nil {
+		panic(err)
+	}
+	x.graph.Initializer = append(x.graph.Initializer, proto)
+	return name
+}
+
+// constantInts adds a 1D int64 initializer with the given values, and returns its name.
+func (x *graphExporter) constantInts(values ...int) string {
+	return x.constant(tensors.FromValue(xslices.Map(values, func(v int) int64 { return int64(v) })))
+}
+
+// constantScalar adds a scalar initializer of the given dtype, and returns its name.
+func (x *graphExporter) constantScalar(dtype dtypes.DType, value float64) string {
+	return x.constant(tensors.FromAnyValue(shapes.CastAsDType(value, dtype)))
+}
+
+// transpose emits a Transpose, if the permutation is not the identity.
+func (x *graphExporter) transpose(value string, permutation []int) string {
+	if slices.Equal(permutation, xslices.Iota(0, len(permutation))) {
+		return value
+	}
+	return x.emit("Transpose", []string{value}, intsAttr("perm", toInt64s(permutation)...))
+}
+
+// inversePermutation returns the permutation that reverts the given one.
+func inversePermutation(permutation []int) []int {
+	inverse := make([]int, len(permutation))
+	for ii, axis := range permutation {
+		inverse[axis] = ii
+	}
+	return inverse
+}
+
+func toInt64s(values []int) []int64 {
+	return xslices.Map(values, func(v int) int64 { return int64(v) })
+}
+
+func exportParameter(x *graphExporter, node *Node) string {
+	paramName := node.GetParameterName()
+	scope, name := context.VariableScopeAndNameFromParameterName(paramName)
+	if name == "" {
+		// Input of the model.
+		return paramName
+	}
+	v := x.ctx.GetVariableByScopeAndName(scope, name)
+	if v == nil {
+		Panicf("variable %q not found in context", context.JoinScope(scope, name))
+	}
+	proto, err := TensorToProto(v.ScopeAndName(), v.Value())
+	if err != nil {
+		panic(err)
+	}
+	x.graph.Initializer = append(x.graph.Initializer, proto)
+	return proto.Name
+}
+
+func exportConstant(x *graphExporter, node *Node) string {
+	if x.hasDynamicAxes(node) {
+		Panicf("constant's shape depends on dynamic dimensions")
+	}
+	if x.dynamicConstants[node.Id()] {
+		Panicf("constant's value depends on dynamic dimensions (e.g.: the mean over a dynamic axis)")
+	}
+	return x.constant(node.ConstantValue())
+}
+
+func exportIota(x *graphExporter, node *Node) string {
+	if x.hasDynamicAxes(node) {
+		Panicf("Iota's shape depends on dynamic dimensions")
+	}
+	shape := staticInput[shapes.Shape](node, "shape")
+	iotaAxis := staticInput[int](node, "iotaAxis")
+	dim := shape.Dimensions[iotaAxis]
+	value := x.emit("Range", []string{x.constant(tensors.FromScalar(int64(0))),
+		x.constant(tensors.FromScalar(int64(dim))), x.constant(tensors.FromScalar(int64(1)))})
+	if shape.DType != dtypes.Int64 {
+		value = exportCast(x, value, shape.DType)
+	}
+	if shape.Rank() > 1 {
+		rangeDims := xslices.SliceWithValue(shape.Rank(), 1)
+		rangeDims[iotaAxis] = dim
+		value = x.emit("Reshape", []string{value, x.constantInts(rangeDims...)})
+		value = x.emit("Expand", []string{value, x.constantInts(shape.Dimensions...)})
+	}
+	return value
+}
+
+// exportSimpleOp returns a converter to an ONNX operator with the same inputs and no attributes.
+func exportSimpleOp(opType string) exportConverter {
+	return func(x *graphExporter, node *Node) string {
+		return x.emit(opType, x.inputNames(node))
+	}
+}
+
+func exportRsqrt(x *graphExporter, node *Node) string {
+	return x.emit("Reciprocal", []string{x.emit("Sqrt", x.inputNames(node))})
+}
+
+func exportExpm1(x *graphExporter, node *Node) string {
+	return x.emit("Sub", []string{x.emit("Exp", x.inputNames(node)), x.constantScalar(node.DType(), 1)})
+}
+
+func exportLog1p(x *graphExporter, node *Node) string {
+	return x.emit("Log", []string{x.emit("Add", []string{x.name(node.Inputs()[0]), x.constantScalar(node.DType(), 1)})})
+}
+
+func exportIsFinite(x *graphExporter, node *Node) string {
+	value := x.name(node.Inputs()[0])
+	return x.emit("Not", []string{x.emit("Or", []string{
+		x.emit("IsNaN", []string{value}), x.emit("IsInf", []string{value})})})
+}
+
+func exportNotEqual(x *graphExporter, node *Node) string {
+	return x.emit("Not", []string{x.emit("Equal", x.inputNames(node))})
+}
+
+func exportRem(x *graphExporter, node *Node) string {
+	// The backends Rem follows C's fmod: the result has the sign of the dividend.
+	return x.emit("Mod", x.inputNames(node), intAttr("fmod", 1))
+}
+
+func exportClamp(x *graphExporter, node *Node) string {
+	names := x.inputNames(node) // min, x, max
+	return x.emit("Min", []string{x.emit("Max", []string{names[1], names[0]}), names[2]})
+}
+
+func exportConvertDType(x *graphExporter, node *Node) string {
+	return exportCast(x, x.name(node.Inputs()[0]), node.DType())
+}
+
+// exportCast emits a Cast of the value to the given dtype.
+func exportCast(x *graphExporter, value string, dtype dtypes.DType) string {
+	dataType, err := DataTypeFromDType(dtype)
+	if err != nil {
+		panic(err)
+	}
+	return x.emit("Cast", []string{value}, intAttr("to", int64(dataType)))
+}
+
+func exportDotGeneral(x *graphExporter, node *Node) string {
+	lhs, rhs := node.Inputs()[0], node.Inputs()[1]
+	lhsContracting, lhsBatch := staticInput[[]int](node, "lhsContractingAxes"), staticInput[[]int](node, "lhsBatchAxes")
+	rhsContracting, rhsBatch := staticInput[[]int](node, "rhsContractingAxes"), staticInput[[]int](node, "rhsBatchAxes")
+	if lhs.Rank()+rhs.Rank() > 52 {
+		Panicf("DotGeneral operands have too many axes (%d) to be exported as an Einsum", lhs.Rank()+rhs.Rank())
+	}
+
+	// Build the Einsum equation: output axes are the batch axes, followed by the lhs and then rhs free axes.
+	letter := func(ii int) byte {
+		if ii < 26 {
+			return byte('a' + ii)
+		}
+		return byte('A' + ii - 26)
+	}
+	lhsLetters := make([]byte, lhs.Rank())
+	for axis := range lhsLetters {
+		lhsLetters[axis] = letter(axis)
+	}
+	rhsLetters := make([]byte, rhs.Rank())
+	nextLetter := lhs.Rank()
+	for ii, axis := range rhsContracting {
+		rhsLetters[axis] = lhsLetters[lhsContracting[ii]]
+	}
+	for ii, axis := range rhsBatch {
+		rhsLetters[axis] = lhsLetters[lhsBatch[ii]]
+	}
+	var outputLetters []byte
+	for _, axis := range lhsBatch {
+		outputLetters = append(outputLetters, lhsLetters[axis])
+	}
+	for axis := range lhs.Rank() {
+		if !slices.Contains(lhsContracting, axis) && !slices.Contains(lhsBatch, axis) {
+			outputLetters = append(outputLetters, lhsLetters[axis])
+		}
+	}
+	for axis := range rhs.Rank() {
+		if rhsLetters[axis] == 0 {
+			rhsLetters[axis] = letter(nextLetter)
+			nextLetter++
+			outputLetters = append(outputLetters, rhsLetters[axis])
+		}
+	}
+	equation := fmt.Sprintf("%s,%s->%s", lhsLetters, rhsLetters, outputLetters)
+	return x.emit("Einsum", x.inputNames(node), stringAttr("equation", equation))
+}
+
+func exportConvGeneral(x *graphExporter, node *Node) string {
+	axes := staticInput[backends.ConvolveAxesConfig](node, "axes")
+	strides := staticInput[[]int](node, "strides")
+	paddings := staticInput[[][2]int](node, "paddings")
+	inputDilations := staticInput[[]int](node, "inputDilations")
+	kernelDilations := staticInput[[]int](node, "kernelDilations")
+	channelGroupCount := staticInput[int](node, "channelGroupCount")
+	batchGroupCount := staticInput[int](node, "batchGroupCount")
+	if batchGroupCount > 1 {
+		Panicf("convolution with batchGroupCount=%d has no ONNX equivalent", batchGroupCount)
+	}
+	for _, dilation := range inputDilations {
+		if dilation > 1 {
+			Panicf("convolution with input dilations %v has no ONNX equivalent", inputDilations)
+		}
+	}
+
+	// ONNX Conv uses the "channels first" layout.
+	input := x.transpose(x.name(node.Inputs()[0]), append([]int{axes.InputBatch, axes.InputChannels}, axes.InputSpatial...))
+	kernel := x.transpose(x.name(node.Inputs()[1]),
+		append([]int{axes.KernelOutputChannels, axes.KernelInputChannels}, axes.KernelSpatial...))
+	numSpatial := len(axes.InputSpatial)
+	attrs := []*AttributeProto{intAttr("group", int64(channelGroupCount))}
+	if len(strides) > 0 {
+		attrs = append(attrs, intsAttr("strides", toInt64s(strides)...))
+	}
+	if len(kernelDilations) > 0 {
+		attrs = append(attrs, intsAttr("dilations", toInt64s(kernelDilations)...))
+	}
+	if len(paddings) > 0 {
+		pads := make([]int64, 2*numSpatial)
+		for ii, padding := range paddings {
+			pads[ii], pads[numSpatial+ii] = int64(padding[0]), int64(padding[1])
+		}
+		attrs = append(attrs, intsAttr("pads", pads...))
+	}
+	output := x.emit("Conv", []string{input, kernel}, attrs...)
+	outputAxes := append([]int{axes.OutputBatch, axes.OutputChannels}, axes.OutputSpatial...)
+	return x.transpose(output, inversePermutation(outputAxes))
+}
+
+func exportReduceWindow(x *graphExporter, node *Node) string {
+	operand := node.Inputs()[0]
+	reductionType := staticInput[ReduceOpType](node, "reductionType")
+	windowDimensions := staticInput[[]int](node, "windowDimensions")
+	strides := staticInput[[]int](node, "strides")
+	baseDilations := staticInput[[]int](node, "baseDilations")
+	windowDilations := staticInput[[]int](node, "windowDilations")
+	paddings := staticInput[[][2]int](node, "paddings")
+	rank := operand.Rank()
+	for _, dilation := range baseDilations {
+		if dilation > 1 {
+			Panicf("ReduceWindow with base dilations %v has no ONNX equivalent", baseDilations)
+		}
+	}
+	if slices.ContainsFunc(windowDilations, func(d int) bool { return d > 1 }) && reductionType == backends.ReduceOpSum {
+		Panicf("sum pooling with window dilations %v not supported", windowDilations)
+	}
+	orDefault := func(values []int, axis, defaultValue int) int {
+		if len(values) == 0 {
+			return defaultValue
+		}
+		return values[axis]
+	}
+
+	// ONNX pooling operates on the axes after the first 2 (batch and channels), so we move 2 axes that are not
+	// pooled to the front.
+	var permutation []int
+	for axis := range rank {
+		isPooled := windowDimensions[axis] != 1 || orDefault(strides, axis, 1) != 1 ||
+			(len(paddings) > 0 && paddings[axis] != [2]int{0, 0})
+		if !isPooled && len(permutation) < 2 {
+			permutation = append(permutation, axis)
+		}
+	}
+	if len(permutation) < 2 || rank < 3 {
+		Panicf("ReduceWindow needs at least 2 non-pooled axes, and rank >= 3, to be exported as ONNX pooling")
+	}
+	for axis := range rank {
+		if !slices.Contains(permutation, axis) {
+			permutation = append(permutation, axis)
+		}
+	}
+	numSpatial := rank - 2
+	kernelShape := make([]int64, numSpatial)
+	poolStrides := make([]int64, numSpatial)
+	dilations := make([]int64, numSpatial)
+	pads := make([]int64, 2*numSpatial)
+	windowSize := 1
+	for ii, axis := range permutation[2:] {
+		kernelShape[ii] = int64(windowDimensions[axis])
+		windowSize *= windowDimensions[axis]
+		poolStrides[ii] = int64(orDefault(strides, axis, windowDimensions[axis]))
+		dilations[ii] = int64(orDefault(windowDilations, axis, 1))
+		if len(paddings) > 0 {
+			pads[ii], pads[numSpatial+ii] = int64(paddings[axis][0]), int64(paddings[axis][1])
+		}
+	}
+	attrs := []*AttributeProto{intsAttr("kernel_shape", kernelShape...), intsAttr("strides", poolStrides...),
+		intsAttr("pads", pads...)}
+
+	value := x.transpose(x.name(operand), permutation)
+	switch reductionType {
+	case backends.ReduceOpMax:
+		value = x.emit("MaxPool", []string{value}, append(attrs, intsAttr("dilations", dilations...))...)
+	case backends.ReduceOpMin:
+		value = x.emit("Neg", []string{value})
+		value = x.emit("MaxPool", []string{value}, append(attrs, intsAttr("dilations", dilations...))...)
+		value = x.emit("Neg", []string{value})
+	case backends.ReduceOpSum:
+		value = x.emit("AveragePool", []string{value}, append(attrs, intAttr("count_include_pad", 1))...)
+		value = x.emit("Mul", []string{value, x.constantScalar(node.DType(), float64(windowSize))})
+	default:
+		Panicf("ReduceWindow with reduction %s has no ONNX equivalent", reductionType)
+	}
+	return x.transpose(value, inversePermutation(permutation))
+}
+
+func exportBatchNormForInference(x *graphExporter, node *Node) string {
+	featureAxis := staticInput[int](node, "featureAxis")
+	epsilon := staticInput[float32](node, "epsilon")
+	names := x.inputNames(node) // operand, scale, offset, mean, variance: same order as ONNX.
+
+	// ONNX BatchNormalization expects the features in axis 1.
+	rank := node.Rank()
+	permutation := xslices.Iota(0, rank)
+	if rank > 1 && featureAxis != 1 {
+		permutation = slices.Delete(permutation, featureAxis, featureAxis+1)
+		permutation = slices.Insert(permutation, 1, featureAxis)
+	}
+	names[0] = x.transpose(names[0], permutation)
+	value := x.emit("BatchNormalization", names, floatAttr("epsilon", epsilon))
+	return x.transpose(value, inversePermutation(permutation))
+}
+
+// exportReduce returns a converter to the ONNX reduce operator.
+// In the opset exported, ReduceSum takes the axes as an input, and the others as an attribute.
+func exportReduce(opType string) exportConverter {
+	return func(x *graphExporter, node *Node) string {
+		axes := staticInput[[]int](node, "axes")
+		value := x.name(node.Inputs()[0])
+		if len(axes) == 0 {
+			return x.emit("Identity", []string{value})
+		}
+		if opType == "ReduceSum" {
+			return x.emit(opType, []string{value, x.constantInts(axes...)}, intAttr("keepdims", 0))
+		}
+		return x.emit(opType, []string{value}, intsAttr("axes", toInt64s(axes)...), intAttr("keepdims", 0))
+	}
+}
+
+func exportArgMinMax(x *graphExporter, node *Node) string {
+	opType := "ArgMax"
+	if staticInput[bool](node, "isMin") {
+		opType = "ArgMin"
+	}
+	value := x.emit(opType, x.inputNames(node), intAttr("axis", int64(staticInput[int](node, "axis"))),
+		intAttr("keepdims", 0))
+	if node.DType() != dtypes.Int64 {
+		value = exportCast(x, value, node.DType())
+	}
+	return value
+}
+
+func exportReshape(x *graphExporter, node *Node) string {
+	operand := node.Inputs()[0]
+	dims := slices.Clone(node.Shape().Dimensions)
+	if slices.Contains(dims, 0) {
+		if x.hasDynamicAxes(node) {
+			Panicf("reshape to a shape with zero-sized and dynamic dimensions not supported")
+		}
+		return x.emit("Reshape", []string{x.name(operand), x.constantInts(dims...)}, intAttr("allowzero", 1))
+	}
+
+	// Dynamic dimensions are copied from the operand if in the same axis (0), or inferred (-1).
+	inferred := -1
+	for axis := range dims {
+		if !x.isDynamic(node, axis) {
+			continue
+		}
+		if axis < operand.Rank() && x.isDynamic(operand, axis) && x.sameDimension(operand, axis, node, axis) {
+			dims[axis] = 0
+			continue
+		}
+		if inferred >= 0 {
+			Panicf("reshape to a shape with more than one dimension (axes %d and %d) derived from dynamic "+
+				"dimensions not supported", inferred, axis)
+		}
+		inferred = axis
+		dims[axis] = -1
+	}
+	return x.emit("Reshape", []string{x.name(operand), x.constantInts(dims...)})
+}
+
+// sameDimension returns whether the axis of node0 and the axis of node1 have the same dimensions, in both traces if
+// the axes are dynamic.
+func (x *graphExporter) sameDimension(node0 *Node, axis0 int, node1 *Node, axis1 int) bool {
+	if node0.Shape().Dimensions[axis0] != node1.Shape().Dimensions[axis1] {
+		return false
+	}
+	// The dynamic dimensions of the 2 traces are all different, so matching the dynamic status is enough
+	// (but not a proof) to make sure they are the same.
+	return x.isDynamic(node0, axis0) == x.isDynamic(node1, axis1)
+}
+
+func exportTranspose(x *graphExporter, node *Node) string {
+	permutation := staticInput[[]int](node, "permutation")
+	return x.emit("Transpose", x.inputNames(node), intsAttr("perm", toInt64s(permutation)...))
+}
+
+func exportBroadcastInDim(x *graphExporter, node *Node) string {
+	operand := node.Inputs()[0]
+	broadcastAxes := staticInput[[]int](node, "broadcastAxes")
+	value := x.name(operand)
+
+	// Sort the operand axes in the order they appear in the output.
+	permutation := xslices.Iota(0, operand.Rank())
+	slices.SortFunc(permutation, func(a, b int) int { return broadcastAxes[a] - broadcastAxes[b] })
+	value = x.transpose(value, permutation)
+	sortedAxes := slices.Clone(broadcastAxes)
+	slices.Sort(sortedAxes)
+
+	// Insert the new axes.
+	var newAxes []int
+	for axis := range node.Rank() {
+		if !slices.Contains(sortedAxes, axis) {
+			newAxes = append(newAxes, axis)
+		}
+	}
+	if len(newAxes) > 0 {
+		value = x.emit("Unsqueeze", []string{value, x.constantInts(newAxes...)})
+	}
+
+	// Expand to the final shape: dimensions that are not broadcast are set to 1, so they work with dynamic dimensions.
+	// Dynamic dimensions not in the operand are left as 1: they are implicitly broadcast by the element-wise operations
+	// using the value (see graphExporter.partiallyBroadcast).
+	dims := slices.Clone(node.Shape().Dimensions)
+	needsExpand := false
+	for axis := range dims {
+		operandAxis := slices.Index(broadcastAxes, axis)
+		if operandAxis >= 0 && x.sameDimension(operand, operandAxis, node, axis) {
+			dims[axis] = 1
+			continue
+		}
+		if x.isDynamic(node, axis) {
+			dims[axis] = 1
+			x.partiallyBroadcast[node.Id()] = true
+			continue
+		}
+		if dims[axis] != 1 {
+			needsExpand = true
+		}
+	}
+	if needsExpand {
+		value = x.emit("Expand", []string{value, x.constantInts(dims...)})
+	}
+	return value
+}
+
+func exportConcatenate(x *graphExporter, node *Node) string {
+	return x.emit("Concat", x.inputNames(node), intAttr("axis", int64(staticInput[int](node, "axis"))))
+}
+
+func exportSlice(x *graphExporter, node *Node) string {
+	operand := node.Inputs()[0]
+	starts, limits := staticInput[[]int](node, "starts"), staticInput[[]int](node, "limits")
+	strides := staticInput[[]int](node, "strides")
+	ends := make([]int, len(limits))
+	for axis, limit := range limits {
+		ends[axis] = limit
+		if !x.isDynamic(operand, axis) {
+			continue
+		}
+		if starts[axis] != 0 || limit != operand.Shape().Dimensions[axis] {
+			Panicf("slice of a dynamic dimension (axis %d) not supported", axis)
+		}
+		ends[axis] = math.MaxInt64
+	}
+	if len(strides) == 0 {
+		strides = xslices.SliceWithValue(len(starts), 1)
+	}
+	return x.emit("Slice", []string{x.name(operand), x.constantInts(starts...), x.constantInts(ends...),
+		x.constantInts(xslices.Iota(0, len(starts))...), x.constantInts(strides...)})
+}
+
+func exportReverse(x *graphExporter, node *Node) string {
+	axes := staticInput[[]int](node, "axes")
+	if len(axes) == 0 {
+		return x.emit("Identity", x.inputNames(node))
+	}
+	return x.emit("Slice", []string{x.name(node.Inputs()[0]),
+		x.constantInts(xslices.SliceWithValue(len(axes), -1)...),
+		x.constantInts(xslices.SliceWithValue(len(axes), math.MinInt64)...),
+		x.constantInts(axes...),
+		x.constantInts(xslices.SliceWithValue(len(axes), -1)...)})
+}
+
+func exportPad(x *graphExporter, node *Node) string {
+	operand, fillValue := node.Inputs()[0], node.Inputs()[1]
+	axesConfig := staticInput[[]backends.PadAxis](node, "axesConfig")
+	rank := operand.Rank()
+	pads := make([]int, 2*rank)
+	for axis, config := range axesConfig {
+		if config.Interior != 0 {
+			Panicf("padding with interior padding has no ONNX equivalent")
+		}
+		pads[axis], pads[rank+axis] = config.Start, config.End
+	}
+	return x.emit("Pad", []string{x.name(operand), x.constantInts(pads...), x.name(fillValue)},
+		stringAttr("mode", "constant"))
+}
+
+func exportGather(x *graphExporter, node *Node) string {
+	operand, indices := node.Inputs()[0], node.Inputs()[1]
+	indexVectorAxis := staticInput[int](node, "indexVectorAxis")
+	offsetOutputAxes := staticInput[[]int](node, "offsetOutputAxes")
+	collapsedSliceAxes := staticInput[[]int](node, "collapsedSliceAxes")
+	startIndexMap := staticInput[[]int](node, "startIndexMap")
+	sliceSizes := staticInput[[]int](node, "sliceSizes")
+
+	// Only the configuration used by graph.Gather is supported: it matches ONNX GatherND.
+	indexedRank := len(startIndexMap)
+	isSupported := indexVectorAxis == indices.Rank()-1 &&
+		slices.Equal(startIndexMap, xslices.Iota(0, indexedRank)) &&
+		slices.Equal(collapsedSliceAxes, startIndexMap) &&
+		slices.Equal(offsetOutputAxes, xslices.Iota(indices.Rank()-1, operand.Rank()-indexedRank))
+	for axis, size := range sliceSizes {
+		if (axis < indexedRank && size != 1) || (axis >= indexedRank && size != operand.Shape().Dimensions[axis]) {
+			isSupported = false
+		}
+	}
+	if !isSupported {
+		Panicf("general gather configuration has no ONNX equivalent, only the one used by graph.Gather is supported")
+	}
+	if indices.DType() != dtypes.Int64 && indices.DType() != dtypes.Int32 {
+		Panicf("gather indices of dtype %s not supported", indices.DType())
+	}
+	if indexedRank == 1 {
+		// Simpler and more common ONNX Gather.
+		squeezed := x.emit("Squeeze", []string{x.name(indices), x.constantInts(-1)})
+		return x.emit("Gather", []string{x.name(operand), squeezed}, intAttr("axis", 0))
+	}
+	indicesName := x.name(indices)
+	if indices.DType() != dtypes.Int64 {
+		indicesName = exportCast(x, indicesName, dtypes.Int64)
+	}
+	return x.emit("GatherND", []string{x.name(operand), indicesName})
+}
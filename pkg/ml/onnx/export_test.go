@@ -0,0 +1,148 @@
+package onnx
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/layers"
+	"github.com/gomlx/gomlx/pkg/ml/layers/activations"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+)
+
+// exportAndCompare exports modelFn, imports it back, and checks that both produce the same results for the
+// given inputs.
+func exportAndCompare(t *testing.T, modelFn any, inputShapes []ValueShape, inputs ...any) *Model {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	exec, err := context.NewExecAny(backend, ctx, modelFn)
+	require.NoError(t, err)
+	want, err := exec.Exec(inputs...)
+	require.NoError(t, err)
+
+	proto, err := NewExporter(backend, ctx, modelFn).WithName("exported").Export(inputShapes...)
+	require.NoError(t, err)
+	m, err := Parse(proto.Marshal())
+	require.NoError(t, err)
+	require.Equal(t, "exported", m.Name())
+	require.Equal(t, ExportOpsetVersion, m.OpsetVersion())
+	require.Empty(t, m.UnsupportedOps())
+
+	importedCtx := context.New()
+	m.VariablesToContext(importedCtx)
+	got := execModel(t, importedCtx, m, inputs...)
+	require.Len(t, got, len(want))
+	for ii := range want {
+		require.Truef(t, want[ii].Shape().Equal(got[ii].Shape()), "output #%d: want shape %s, got %s",
+			ii, want[ii].Shape(), got[ii].Shape())
+		require.InDeltaSlicef(t, tensors.CopyFlatData[float32](want[ii]), tensors.CopyFlatData[float32](got[ii]),
+			1e-4, "output #%d", ii)
+	}
+	return m
+}
+
+func TestExportMLP(t *testing.T) {
+	modelFn := func(ctx *context.Context, x *Node) *Node {
+		x = layers.Dense(ctx.In("hidden"), x, true, 8)
+		x = activations.Gelu(x)
+		x = layers.LayerNormalization(ctx.In("norm"), x, -1).Done()
+		x = layers.Dense(ctx.In("output"), x, true, 3)
+		return Softmax(x)
+	}
+	x := [][]float32{{1, 2, 3, 4}, {-1, 0.5, 0, 2}, {0, 0, 0, 0}, {0.1, -0.2, 0.3, -0.4}}
+	m := exportAndCompare(t, modelFn,
+		[]ValueShape{{DType: dtypes.Float32, Dimensions: []int{-1, 4}}}, x)
+
+	// Dynamic batch dimension.
+	inputNames, inputShapes := m.Inputs()
+	require.Equal(t, []string{"input_0"}, inputNames)
+	require.Equal(t, []int{-1, 4}, inputShapes[0].Dimensions)
+	require.Equal(t, []string{"batch", ""}, inputShapes[0].DimNames)
+	outputNames, outputShapes := m.Outputs()
+	require.Equal(t, []string{"output_0"}, outputNames)
+	require.Equal(t, []int{-1, 3}, outputShapes[0].Dimensions)
+	require.Equal(t, "batch", outputShapes[0].DimNames[0])
+}
+
+func TestExportCNN(t *testing.T) {
+	modelFn := func(ctx *context.Context, images *Node) *Node {
+		x := layers.Convolution(ctx.In("conv"), images).Filters(4).KernelSize(3).PadSame().Done()
+		x = activations.Relu(x)
+		x = MaxPool(x).Window(2).Done()
+		x = Reshape(x, x.Shape().Dimensions[0], -1)
+		return layers.Dense(ctx.In("output"), x, true, 2)
+	}
+	images := tensors.FromShape(shapes.Make(dtypes.Float32, 2, 6, 6, 3))
+	tensors.MutableFlatData(images, func(flat []float32) {
+		for ii := range flat {
+			flat[ii] = float32(ii%7) / 7
+		}
+	})
+	exportAndCompare(t, modelFn,
+		[]ValueShape{{DType: dtypes.Float32, Dimensions: []int{-1, 6, 6, 3}, DimNames: []string{"images"}}}, images)
+}
+
+func TestExportEmbedding(t *testing.T) {
+	modelFn := func(ctx *context.Context, tokens *Node) *Node {
+		embeddings := layers.Embedding(ctx, tokens, dtypes.Float32, 10, 4)
+		return ReduceSum(embeddings, 1)
+	}
+	tokens := [][]int32{{1, 2, 3}, {9, 0, 0}}
+	exportAndCompare(t, modelFn,
+		[]ValueShape{{DType: dtypes.Int32, Dimensions: []int{-1, -1}, DimNames: []string{"batch", "sequence"}}}, tokens)
+}
+
+// TestExportIsFiniteAndGather checks the round-trip of ops the exporter emits as ONNX ops that are otherwise rare
+// in imported models: IsFinite is exported with "IsInf", and Gather with more than one indexed axis with "GatherND".
+func TestExportIsFiniteAndGather(t *testing.T) {
+	modelFn := func(ctx *context.Context, x, indices *Node) *Node {
+		x = Where(IsFinite(x), x, ZerosLike(x))
+		return Gather(x, indices)
+	}
+	inf, nan := float32(math.Inf(1)), float32(math.NaN())
+	x := [][]float32{{1, inf, 3}, {-inf, 5, nan}, {7, 8, 9}}
+	indices := [][]int32{{1, 0}, {0, 2}, {2, 1}}
+	m := exportAndCompare(t, modelFn, []ValueShape{
+		{DType: dtypes.Float32, Dimensions: []int{3, 3}},
+		{DType: dtypes.Int32, Dimensions: []int{-1, 2}, DimNames: []string{"batch"}}}, x, indices)
+	var ops []string
+	for _, node := range m.Proto.Graph.Node {
+		ops = append(ops, node.OpType)
+	}
+	require.Contains(t, ops, "IsInf")
+	require.Contains(t, ops, "GatherND")
+}
+
+func TestExportErrors(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+
+	// Node without ONNX equivalent.
+	_, err := NewExporter(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+		return BitCount(x)
+	}).Export(ValueShape{DType: dtypes.Int32, Dimensions: []int{3}})
+	require.ErrorContains(t, err, "graph uses operations without an ONNX equivalent: BitCount (1 node)")
+
+	// Static shape depending on a dynamic dimension.
+	_, err = NewExporter(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+		return Add(x, Iota(x.Graph(), x.Shape(), 0))
+	}).Export(ValueShape{DType: dtypes.Float32, Dimensions: []int{-1}})
+	require.ErrorContains(t, err, "Iota's shape depends on dynamic dimensions")
+
+	// Constant value depending on a dynamic dimension.
+	_, err = NewExporter(backend, ctx, func(ctx *context.Context, x *Node) *Node {
+		return ReduceMean(x, -1)
+	}).Export(ValueShape{DType: dtypes.Float32, Dimensions: []int{2, -1}})
+	require.ErrorContains(t, err, "constant's value depends on dynamic dimensions")
+
+	// Wrong number of inputs.
+	_, err = NewExporter(backend, ctx, func(ctx *context.Context, x, y *Node) *Node {
+		return Add(x, y)
+	}).Export(ValueShape{DType: dtypes.Float32, Dimensions: []int{3}})
+	require.ErrorContains(t, err, "takes 2 inputs, but 1 input shapes were given")
+}
@@ -0,0 +1,479 @@
+// Package onnx imports ONNX (https://onnx.ai) models into GoMLX, and exports GoMLX models to ONNX.
+//
+// A Model is created with Parse or ReadFile. Its float initializers (the weights) are mapped to trainable
+// context.Context variables, and its operators are converted to pkg/core/graph operations, so the model can be
+// used like any other GoMLX model: executed with context.Exec, combined with other layers, or fine-tuned
+// with train.Trainer.
+//
+// Example:
+//
+//	model, err := onnx.ReadFile("model.onnx")
+//	if err != nil { … }
+//	ctx := context.New()
+//	model.VariablesToContext(ctx.In("onnx"))
+//	exec := context.MustNewExec(backend, ctx.In("onnx"), func(ctx *context.Context, x *Node) *Node {
+//		return model.Call(ctx, x)[0]
+//	})
+//	y := exec.MustExec(xTensor)[0]
+//
+// The graph is built for the concrete shapes of the inputs given, so symbolic dimensions (like a dynamic batch size)
+// are supported, with one graph compiled per input shape (see context.Exec).
+// Values used as static parameters of operations (e.g.: the target shape of a Reshape) must be computable at
+// graph building time, from constants and input shapes.
+//
+// Operators not supported are reported by Model.UnsupportedOps, and Model.CallGraph panics listing them.
+//
+// In the other direction, an Exporter traces a GoMLX graph function (the same used with context.Exec) and converts
+// it to an ONNX model, with the context variables as initializers. See NewExporter.
+package onnx
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+// Model is an ONNX model that can be converted to a GoMLX graph. Create it with Parse or ReadFile.
+//
+// It is safe to use concurrently to build different graphs.
+type Model struct {
+	// Proto is the parsed ONNX model.
+	Proto *ModelProto
+
+	inputsNames, outputsNames   []string
+	inputsShapes, outputsShapes []ValueShape
+
+	// opsetVersion is the version of the default ("ai.onnx") domain operator set.
+	opsetVersion int64
+
+	// variables maps the names of the float initializers to the corresponding context variable names.
+	variables map[string]string
+
+	// initializers holds the values of all initializers.
+	initializers map[string]*tensors.Tensor
+
+	// nodeByOutput maps each value name to the node that produces it.
+	nodeByOutput map[string]*NodeProto
+}
+
+// ValueShape is the dtype and dimensions of an input or output of the model, as declared in the ONNX graph.
+//
+// Dimensions not statically known are set to -1, and their symbolic names (e.g.: "batch_size"), if given, are stored
+// in DimNames.
+type ValueShape struct {
+	DType      dtypes.DType
+	Dimensions []int
+	DimNames   []string
+}
+
+// String implements fmt.Stringer.
+func (vs ValueShape) String() string {
+	dims := make([]string, len(vs.Dimensions))
+	for ii, dim := range vs.Dimensions {
+		switch {
+		case dim >= 0:
+			dims[ii] = fmt.Sprintf("%d", dim)
+		case vs.DimNames[ii] != "":
+			dims[ii] = vs.DimNames[ii]
+		default:
+			dims[ii] = "?"
+		}
+	}
+	return fmt.Sprintf("(%s)[%s]", vs.DType, strings.Join(dims, " "))
+}
+
+// ReadFile reads and parses an ONNX model from a file.
+func ReadFile(filePath string) (*Model, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read ONNX model from %q", filePath)
+	}
+	m, err := Parse(contents)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "ONNX model in %q", filePath)
+	}
+	return m, nil
+}
+
+// Parse parses a serialized ONNX model.
+func Parse(contents []byte) (*Model, error) {
+	proto, err := UnmarshalModel(contents)
+	if err != nil {
+		return nil, err
+	}
+	return NewModel(proto)
+}
+
+// NewModel creates a Model from a ModelProto.
+func NewModel(proto *ModelProto) (*Model, error) {
+	if proto.Graph == nil {
+		return nil, errors.New("ONNX model has no graph")
+	}
+	m := &Model{
+		Proto:        proto,
+		variables:    make(map[string]string),
+		initializers: make(map[string]*tensors.Tensor),
+		nodeByOutput: make(map[string]*NodeProto),
+	}
+	for _, opset := range proto.OpsetImport {
+		if opset.Domain == "" || opset.Domain == "ai.onnx" {
+			m.opsetVersion = opset.Version
+		}
+	}
+
+	for _, initializer := range proto.Graph.Initializer {
+		t, err := TensorFromProto(initializer)
+		if err != nil {
+			return nil, err
+		}
+		m.initializers[initializer.Name] = t
+		if t.DType().IsFloat() {
+			m.variables[initializer.Name] = context.EscapeScopeName(initializer.Name)
+		}
+	}
+	for _, input := range proto.Graph.Input {
+		if _, isInitializer := m.initializers[input.Name]; isInitializer {
+			// Older models list the initializers as inputs, with the initializer as their default value.
+			continue
+		}
+		shape, err := valueShapeFromProto(input)
+		if err != nil {
+			return nil, err
+		}
+		m.inputsNames = append(m.inputsNames, input.Name)
+		m.inputsShapes = append(m.inputsShapes, shape)
+	}
+	for _, output := range proto.Graph.Output {
+		shape, err := valueShapeFromProto(output)
+		if err != nil {
+			return nil, err
+		}
+		m.outputsNames = append(m.outputsNames, output.Name)
+		m.outputsShapes = append(m.outputsShapes, shape)
+	}
+	for _, node := range proto.Graph.Node {
+		for _, output := range node.Output {
+			if output != "" {
+				m.nodeByOutput[output] = node
+			}
+		}
+	}
+	return m, nil
+}
+
+// valueShapeFromProto converts the type of ValueInfoProto to a ValueShape.
+func valueShapeFromProto(info *ValueInfoProto) (shape ValueShape, err error) {
+	if info.Type == nil || info.Type.TensorType == nil {
+		err = errors.Errorf("ONNX value %q is not a tensor: only tensors are supported", info.Name)
+		return
+	}
+	shape.DType, err = info.Type.TensorType.ElemType.DType()
+	if err != nil {
+		err = errors.WithMessagef(err, "ONNX value %q", info.Name)
+		return
+	}
+	if info.Type.TensorType.Shape == nil {
+		return
+	}
+	for _, dim := range info.Type.TensorType.Shape.Dim {
+		if dim.DimParam != "" || dim.DimValue <= 0 {
+			shape.Dimensions = append(shape.Dimensions, -1)
+		} else {
+			shape.Dimensions = append(shape.Dimensions, int(dim.DimValue))
+		}
+		shape.DimNames = append(shape.DimNames, dim.DimParam)
+	}
+	return
+}
+
+// Name of the model's graph.
+func (m *Model) Name() string { return m.Proto.Graph.Name }
+
+// OpsetVersion returns the version of the default ONNX operator set used by the model.
+func (m *Model) OpsetVersion() int { return int(m.opsetVersion) }
+
+// Inputs returns the names and shapes of the inputs of the model, in the order expected by Call.
+func (m *Model) Inputs() (names []string, shapes []ValueShape) { return m.inputsNames, m.inputsShapes }
+
+// Outputs returns the names and shapes of the outputs of the model, in the order returned by Call.
+func (m *Model) Outputs() (names []string, shapes []ValueShape) {
+	return m.outputsNames, m.outputsShapes
+}
+
+// String implements fmt.Stringer, with a summary of the model.
+func (m *Model) String() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "ONNX model %q (opset %d, producer %q): %d nodes, %d initializers\n",
+		m.Name(), m.opsetVersion, m.Proto.ProducerName, len(m.Proto.Graph.Node), len(m.initializers))
+	for ii, name := range m.inputsNames {
+		_, _ = fmt.Fprintf(&sb, "\tinput %q: %s\n", name, m.inputsShapes[ii])
+	}
+	for ii, name := range m.outputsNames {
+		_, _ = fmt.Fprintf(&sb, "\toutput %q: %s\n", name, m.outputsShapes[ii])
+	}
+	return sb.String()
+}
+
+// opKey returns the key used in opConverters for the node: the op type, prefixed with the domain if not
+// the default one.
+func opKey(node *NodeProto) string {
+	if node.Domain == "" || node.Domain == "ai.onnx" {
+		return node.OpType
+	}
+	return node.Domain + "." + node.OpType
+}
+
+// UnsupportedOps returns the sorted list of operator types used by the model that are not supported,
+// with the number of nodes using them (e.g.: "NonMaxSuppression (2 nodes)"), or nil if all are supported.
+func (m *Model) UnsupportedOps() []string {
+	counts := make(map[string]int)
+	for _, node := range m.Proto.Graph.Node {
+		if _, found := opConverters[opKey(node)]; !found {
+			counts[opKey(node)]++
+		}
+	}
+	var unsupported []string
+	for op, count := range counts {
+		unsupported = append(unsupported, fmt.Sprintf("%s (%d nodes)", op, count))
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// VariablesToContext creates in the current scope of ctx the variables holding the float initializers
+// (the weights) of the model, and marks them as trainable.
+//
+// Variables that already exist (e.g.: loaded from a checkpoint) are not changed.
+// It's not required, CallGraph will create any missing variables, but it's convenient to create them before
+// setting up an optimizer or loading a checkpoint.
+func (m *Model) VariablesToContext(ctx *context.Context) {
+	for _, initializer := range m.Proto.Graph.Initializer {
+		if varName, found := m.variables[initializer.Name]; found {
+			m.variable(ctx, initializer.Name, varName)
+		}
+	}
+}
+
+// variable returns the context variable for the initializer, creating it if needed.
+func (m *Model) variable(ctx *context.Context, initializerName, varName string) *context.Variable {
+	v := ctx.GetVariableByScopeAndName(ctx.Scope(), varName)
+	if v == nil {
+		v = ctx.Checked(false).VariableWithValue(varName, m.initializers[initializerName].LocalClone())
+	}
+	return v
+}
+
+// Call converts the model to a graph, using the context variables in the current scope of ctx
+// (see VariablesToContext), and returns the outputs of the model.
+//
+// The inputs must be given in the order returned by Inputs.
+// It panics on errors, as other graph building functions.
+func (m *Model) Call(ctx *context.Context, inputs ...*Node) []*Node {
+	if len(inputs) != len(m.inputsNames) {
+		Panicf("ONNX model %q takes %d inputs %q, %d given", m.Name(), len(m.inputsNames), m.inputsNames, len(inputs))
+	}
+	if len(inputs) == 0 {
+		Panicf("ONNX model %q takes no inputs, use CallGraph instead", m.Name())
+	}
+	inputsByName := make(map[string]*Node, len(inputs))
+	for ii, name := range m.inputsNames {
+		inputsByName[name] = inputs[ii]
+	}
+	return m.CallGraph(ctx, inputs[0].Graph(), inputsByName)
+}
+
+// CallGraph converts the model to a graph, using the context variables in the current scope of ctx
+// (see VariablesToContext), and returns the values named outputNames.
+// If outputNames is empty, it returns the outputs of the model (see Outputs).
+// Intermediary values of the model can also be requested as outputs.
+//
+// inputs maps the names of the model inputs to their values. Only the inputs needed to compute the requested
+// outputs need to be given.
+//
+// It panics on errors, as other graph building functions.
+func (m *Model) CallGraph(ctx *context.Context, g *Graph, inputs map[string]*Node, outputNames ...string) []*Node {
+	if unsupported := m.UnsupportedOps(); len(unsupported) > 0 {
+		Panicf("ONNX model %q uses unsupported operators: %s", m.Name(), strings.Join(unsupported, ", "))
+	}
+	if len(outputNames) == 0 {
+		outputNames = m.outputsNames
+	}
+	c := &converter{
+		model:     m,
+		ctx:       ctx,
+		g:         g,
+		values:    make(map[string]*Node),
+		constants: make(map[string]*tensors.Tensor),
+	}
+	c.root = c
+	for name, input := range inputs {
+		if !slices.Contains(m.inputsNames, name) {
+			Panicf("ONNX model %q has no input named %q, inputs are %q", m.Name(), name, m.inputsNames)
+		}
+		c.values[name] = input
+	}
+
+	// Convert the nodes needed for the outputs, in the order given by the model (topological order).
+	needed := m.neededNodes(outputNames)
+	for _, node := range m.Proto.Graph.Node {
+		if needed[node] {
+			c.convertNode(node)
+		}
+	}
+	outputs := make([]*Node, len(outputNames))
+	for ii, name := range outputNames {
+		outputs[ii] = c.value(name)
+	}
+	return outputs
+}
+
+// neededNodes returns the set of nodes needed to compute the given values.
+func (m *Model) neededNodes(names []string) map[*NodeProto]bool {
+	needed := make(map[*NodeProto]bool)
+	toVisit := slices.Clone(names)
+	for len(toVisit) > 0 {
+		name := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		node := m.nodeByOutput[name]
+		if node == nil || needed[node] {
+			continue
+		}
+		needed[node] = true
+		for _, input := range node.Input {
+			if input != "" {
+				toVisit = append(toVisit, input)
+			}
+		}
+	}
+	return needed
+}
+
+// converter holds the state of the conversion of a model to a graph.
+type converter struct {
+	model *Model
+	ctx   *context.Context
+	g     *Graph
+
+	// values holds the converted values, by name.
+	values map[string]*Node
+
+	// root is the converter of the main graph. Values computed at graph building time (see constantValue) are
+	// converted in separate graphs, with their own converters.
+	root *converter
+
+	// constants holds the values computed at graph building time, only used in the root converter.
+	constants map[string]*tensors.Tensor
+}
+
+// value returns the converted value with the given name. It panics if it is not known.
+func (c *converter) value(name string) *Node {
+	if node, found := c.values[name]; found {
+		return node
+	}
+	var node *Node
+	if varName, found := c.model.variables[name]; found && c.ctx != nil {
+		node = c.model.variable(c.ctx, name, varName).ValueGraph(c.g)
+	} else if t, found := c.model.initializers[name]; found {
+		node = ConstTensor(c.g, t)
+	} else if slices.Contains(c.model.inputsNames, name) {
+		Panicf("ONNX model input %q not given", name)
+	} else {
+		Panicf("ONNX model has no value named %q", name)
+	}
+	c.values[name] = node
+	return node
+}
+
+// convertNode converts the node and stores its outputs.
+func (c *converter) convertNode(node *NodeProto) {
+	inputs := make([]*Node, len(node.Input))
+	for ii, name := range node.Input {
+		if name != "" {
+			inputs[ii] = c.value(name)
+		}
+	}
+	outputs := c.convertOp(node, inputs)
+	for ii, name := range node.Output {
+		if name == "" {
+			continue
+		}
+		if ii >= len(outputs) || outputs[ii] == nil {
+			Panicf("ONNX node %s: output #%d (%q) not supported", nodeDescription(node), ii, name)
+		}
+		c.values[name] = outputs[ii]
+	}
+}
+
+// convertOp converts the node operation, given its converted inputs, and returns its outputs.
+func (c *converter) convertOp(node *NodeProto, inputs []*Node) (outputs []*Node) {
+	convertFn := opConverters[opKey(node)]
+	if convertFn == nil {
+		Panicf("ONNX operator %q not supported, used by node %s", opKey(node), nodeDescription(node))
+	}
+	err := TryCatch[error](func() { outputs = convertFn(c, node, inputs) })
+	if err != nil {
+		panic(errors.WithMessagef(err, "while converting ONNX node %s", nodeDescription(node)))
+	}
+	return outputs
+}
+
+// nodeDescription returns a short description of the node, for error messages.
+func nodeDescription(node *NodeProto) string {
+	return fmt.Sprintf("%q (op %s, inputs %q, outputs %q)", node.Name, opKey(node), node.Input, node.Output)
+}
+
+// constantValue returns the value named name, computed at graph building time: it is used for static
+// parameters of operations (e.g.: the shape of a Reshape), which must be computable from constants and
+// the shapes of the inputs.
+func (c *converter) constantValue(name string) *tensors.Tensor {
+	root := c.root
+	if t, found := root.constants[name]; found {
+		return t
+	}
+	if t, found := c.model.initializers[name]; found {
+		return t
+	}
+	node := c.model.nodeByOutput[name]
+	if node == nil {
+		Panicf("ONNX value %q is used as a static parameter, so it must be computable at graph building time, "+
+			"but it is an input of the model", name)
+	}
+	if node.OpType == "Shape" {
+		// Only depends on the shape of its input, from the main graph.
+		root.constants[name] = shapeTensor(node, root.value(node.Input[0]))
+		return root.constants[name]
+	}
+
+	// Evaluate the node in a separate graph, taking as inputs the (recursively) computed constant values.
+	inputs := make([]*tensors.Tensor, len(node.Input))
+	for ii, input := range node.Input {
+		if input != "" {
+			inputs[ii] = c.constantValue(input)
+		}
+	}
+	outputs := MustExecOnceN(root.g.Backend(), func(g *Graph) []*Node {
+		sub := &converter{model: c.model, g: g, values: make(map[string]*Node), root: root}
+		inputNodes := make([]*Node, len(inputs))
+		for ii, t := range inputs {
+			if t != nil {
+				inputNodes[ii] = ConstTensor(g, t)
+			}
+		}
+		return sub.convertOp(node, inputNodes)
+	})
+	for ii, output := range node.Output {
+		if output != "" && ii < len(outputs) {
+			root.constants[output] = outputs[ii]
+		}
+	}
+	return root.constants[name]
+}
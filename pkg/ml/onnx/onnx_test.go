@@ -0,0 +1,577 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/pkg/ml/train/losses"
+	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
+	"github.com/stretchr/testify/require"
+)
+
+// modelBuilder builds ONNX models for testing.
+type modelBuilder struct {
+	proto *ModelProto
+}
+
+func newModelBuilder(opset int64) *modelBuilder {
+	return &modelBuilder{proto: &ModelProto{
+		IRVersion:    8,
+		ProducerName: "gomlx_test",
+		OpsetImport:  []*OperatorSetIDProto{{Version: opset}},
+		Graph:        &GraphProto{Name: "test"},
+	}}
+}
+
+// valueInfo creates a ValueInfoProto, with dimensions given as int (static) or string (symbolic).
+func valueInfo(name string, dataType DataType, dims ...any) *ValueInfoProto {
+	shape := &TensorShapeProto{}
+	for _, dim := range dims {
+		switch dim := dim.(type) {
+		case int:
+			shape.Dim = append(shape.Dim, &DimensionProto{DimValue: int64(dim)})
+		case string:
+			shape.Dim = append(shape.Dim, &DimensionProto{DimParam: dim})
+		}
+	}
+	return &ValueInfoProto{Name: name, Type: &TypeProto{TensorType: &TensorTypeProto{ElemType: dataType, Shape: shape}}}
+}
+
+func (b *modelBuilder) input(name string, dataType DataType, dims ...any) *modelBuilder {
+	b.proto.Graph.Input = append(b.proto.Graph.Input, valueInfo(name, dataType, dims...))
+	return b
+}
+
+func (b *modelBuilder) output(name string, dataType DataType) *modelBuilder {
+	b.proto.Graph.Output = append(b.proto.Graph.Output, valueInfo(name, dataType))
+	return b
+}
+
+func (b *modelBuilder) initializer(name string, value any) *modelBuilder {
+	proto, err := TensorToProto(name, tensors.FromAnyValue(value))
+	if err != nil {
+		panic(err)
+	}
+	b.proto.Graph.Initializer = append(b.proto.Graph.Initializer, proto)
+	return b
+}
+
+func (b *modelBuilder) node(opType string, inputs, outputs []string, attrs ...*AttributeProto) *modelBuilder {
+	b.proto.Graph.Node = append(b.proto.Graph.Node, &NodeProto{
+		Name:      fmt.Sprintf("%s_%d", opType, len(b.proto.Graph.Node)),
+		OpType:    opType,
+		Input:     inputs,
+		Output:    outputs,
+		Attribute: attrs,
+	})
+	return b
+}
+
+// model serializes and parses the model built.
+func (b *modelBuilder) model(t *testing.T) *Model {
+	m, err := Parse(b.proto.Marshal())
+	require.NoError(t, err)
+	return m
+}
+
+// execModel executes the model with the given inputs, and returns all its outputs.
+func execModel(t *testing.T, ctx *context.Context, m *Model, inputs ...any) []*tensors.Tensor {
+	outputs, err := tryExecModel(ctx, m, inputs...)
+	require.NoError(t, err)
+	return outputs
+}
+
+// tryExecModel executes the model with the given inputs, and returns all its outputs or an error.
+func tryExecModel(ctx *context.Context, m *Model, inputs ...any) ([]*tensors.Tensor, error) {
+	backend := graphtest.BuildTestBackend()
+	exec, err := context.NewExecAny(backend, ctx, func(ctx *context.Context, inputs []*Node) []*Node {
+		return m.Call(ctx, inputs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exec.Exec(inputs...)
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	b := newModelBuilder(17).
+		input("x", DataTypeFloat, "batch", 3).
+		output("y", DataTypeFloat).
+		initializer("w", [][]float32{{1, 2}, {3, 4}, {5, 6}}).
+		node("Foo", []string{"x", "", "w"}, []string{"y"},
+			intAttr("i", -3), floatAttr("f", 0.5), intsAttr("ints", 1, -2), stringAttr("s", "bar"),
+			&AttributeProto{Name: "floats", Type: AttributeTypeFloats, Floats: []float32{1.5, -2}})
+	b.proto.MetadataProps = []*StringStringEntryProto{{Key: "k", Value: "v"}}
+	parsed, err := UnmarshalModel(b.proto.Marshal())
+	require.NoError(t, err)
+	require.Equal(t, b.proto, parsed)
+
+	// Typed (not raw) tensor data.
+	for _, proto := range []*TensorProto{
+		{Name: "f", Dims: []int64{2}, DataType: DataTypeFloat, FloatData: []float32{1, -2}},
+		{Name: "i64", Dims: []int64{2}, DataType: DataTypeInt64, Int64Data: []int64{-1, 1 << 40}},
+		{Name: "i8", Dims: []int64{2}, DataType: DataTypeInt8, Int32Data: []int32{-1, 7}},
+		{Name: "b", Dims: []int64{1, 2}, DataType: DataTypeBool, Int32Data: []int32{1, 0}},
+		{Name: "d", DataType: DataTypeDouble, DoubleData: []float64{math.Pi}},
+	} {
+		parsed := &TensorProto{}
+		require.NoError(t, parsed.unmarshal(proto.appendTo(nil)))
+		tensor, err := TensorFromProto(parsed)
+		require.NoError(t, err)
+		fmt.Printf("\t%s: %s\n", proto.Name, tensor)
+		switch proto.Name {
+		case "f":
+			require.Equal(t, []float32{1, -2}, tensor.Value())
+		case "i64":
+			require.Equal(t, []int64{-1, 1 << 40}, tensor.Value())
+		case "i8":
+			require.Equal(t, []int8{-1, 7}, tensor.Value())
+		case "b":
+			require.Equal(t, [][]bool{{true, false}}, tensor.Value())
+		case "d":
+			require.Equal(t, math.Pi, tensor.Value())
+		}
+	}
+
+	// Errors.
+	_, err = UnmarshalModel([]byte{0xff, 0xff})
+	require.Error(t, err)
+	_, err = TensorFromProto(&TensorProto{Name: "x", Dims: []int64{3}, DataType: DataTypeFloat, FloatData: []float32{1}})
+	require.Error(t, err)
+	_, err = TensorFromProto(&TensorProto{Name: "x", DataType: DataTypeString})
+	require.Error(t, err)
+}
+
+func TestOps(t *testing.T) {
+	type testCase struct {
+		name   string
+		opset  int64
+		build  func(b *modelBuilder)
+		inputs []any
+		want   []any
+	}
+	testCases := []testCase{
+		{
+			name: "Gather-axis1-negative-indices",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 2, 3).initializer("indices", []int64{-1, 0}).
+					node("Gather", []string{"x", "indices"}, []string{"y"}, intAttr("axis", 1))
+			},
+			inputs: []any{[][]float32{{1, 2, 3}, {4, 5, 6}}},
+			want:   []any{[][]float32{{3, 1}, {6, 4}}},
+		},
+		{
+			name: "Slice-negative-step",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 6).
+					initializer("starts", []int64{-1}).initializer("ends", []int64{math.MinInt64}).
+					initializer("axes", []int64{0}).initializer("steps", []int64{-2}).
+					node("Slice", []string{"x", "starts", "ends", "axes", "steps"}, []string{"y"})
+			},
+			inputs: []any{[]float32{0, 1, 2, 3, 4, 5}},
+			want:   []any{[]float32{5, 3, 1}},
+		},
+		{
+			name: "Slice-clamped",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 2, 4).
+					initializer("starts", []int64{1}).initializer("ends", []int64{math.MaxInt64}).
+					initializer("axes", []int64{-1}).
+					node("Slice", []string{"x", "starts", "ends", "axes"}, []string{"y"})
+			},
+			inputs: []any{[][]float32{{0, 1, 2, 3}, {4, 5, 6, 7}}},
+			want:   []any{[][]float32{{1, 2, 3}, {5, 6, 7}}},
+		},
+		{
+			// Typical pattern of exported models: the target shape is computed from the input shape.
+			name: "Reshape-from-Shape",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, "batch", 2, 2).
+					initializer("zero", int64(0)).initializer("minus_one", []int64{-1}).initializer("axes", []int64{0}).
+					node("Shape", []string{"x"}, []string{"shape"}).
+					node("Gather", []string{"shape", "zero"}, []string{"batch"}).
+					node("Unsqueeze", []string{"batch", "axes"}, []string{"batch_1d"}).
+					node("Concat", []string{"batch_1d", "minus_one"}, []string{"new_shape"}, intAttr("axis", 0)).
+					node("Reshape", []string{"x", "new_shape"}, []string{"y"})
+			},
+			inputs: []any{[][][]float32{{{1, 2}, {3, 4}}, {{5, 6}, {7, 8}}}},
+			want:   []any{[][]float32{{1, 2, 3, 4}, {5, 6, 7, 8}}},
+		},
+		{
+			name: "Split",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 5).initializer("split", []int64{2, 3}).
+					node("Split", []string{"x", "split"}, []string{"y0", "y1"})
+			},
+			inputs: []any{[]float32{1, 2, 3, 4, 5}},
+			want:   []any{[]float32{1, 2}, []float32{3, 4, 5}},
+		},
+		{
+			name:  "Split-num_outputs",
+			opset: 18,
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 5).
+					node("Split", []string{"x"}, []string{"y0", "y1"}, intAttr("num_outputs", 2))
+			},
+			inputs: []any{[]float32{1, 2, 3, 4, 5}},
+			want:   []any{[]float32{1, 2, 3}, []float32{4, 5}},
+		},
+		{
+			name: "Expand-Tile",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 2, 1).
+					initializer("shape", []int64{2, 3}).initializer("repeats", []int64{1, 2}).
+					node("Expand", []string{"x", "shape"}, []string{"y0"}).
+					node("Tile", []string{"x", "repeats"}, []string{"y1"})
+			},
+			inputs: []any{[][]float32{{1}, {2}}},
+			want:   []any{[][]float32{{1, 1, 1}, {2, 2, 2}}, [][]float32{{1, 1}, {2, 2}}},
+		},
+		{
+			name: "Where-Equal-broadcast",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 3).initializer("two", float32(2)).initializer("zeros", [][]float32{{0}, {-1}}).
+					node("Equal", []string{"x", "two"}, []string{"cond"}).
+					node("Where", []string{"cond", "zeros", "x"}, []string{"y"})
+			},
+			inputs: []any{[]float32{1, 2, 3}},
+			want:   []any{[][]float32{{1, 0, 3}, {1, -1, 3}}},
+		},
+		{
+			name: "Range-ConstantOfShape",
+			build: func(b *modelBuilder) {
+				value, _ := TensorToProto("value", tensors.FromValue([]int32{7}))
+				b.input("x", DataTypeFloat, 2).
+					initializer("start", int64(0)).initializer("limit", int64(5)).initializer("delta", int64(2)).
+					node("Range", []string{"start", "limit", "delta"}, []string{"y0"}).
+					node("Shape", []string{"x"}, []string{"shape"}).
+					node("ConstantOfShape", []string{"shape"}, []string{"y1"},
+						&AttributeProto{Name: "value", Type: AttributeTypeTensor, T: value})
+			},
+			inputs: []any{[]float32{1, 2}},
+			want:   []any{[]int64{0, 2, 4}, []int32{7, 7}},
+		},
+		{
+			name: "LayerNormalization",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 1, 3).
+					initializer("scale", []float32{1, 1, 2}).initializer("bias", []float32{0, 0, 1}).
+					node("LayerNormalization", []string{"x", "scale", "bias"}, []string{"y"}, floatAttr("epsilon", 0))
+			},
+			inputs: []any{[][]float32{{1, 2, 3}}},
+			want:   []any{[][]float32{{-1.2247449, 0, 1 + 2*1.2247449}}},
+		},
+		{
+			name:  "Pad",
+			opset: 13,
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 1, 2).initializer("pads", []int64{0, 1, 0, 1}).initializer("value", float32(9)).
+					node("Pad", []string{"x", "pads", "value"}, []string{"y"})
+			},
+			inputs: []any{[][]float32{{1, 2}}},
+			want:   []any{[][]float32{{9, 1, 2, 9}}},
+		},
+		{
+			name: "ArgMax-ReduceSum",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 2, 3).initializer("axes", []int64{0}).
+					node("ArgMax", []string{"x"}, []string{"y0"}, intAttr("axis", 1)).
+					node("ReduceSum", []string{"x", "axes"}, []string{"y1"}, intAttr("keepdims", 0))
+			},
+			inputs: []any{[][]float32{{1, 3, 2}, {4, 0, 5}}},
+			want:   []any{[][]int64{{1}, {2}}, []float32{5, 3, 7}},
+		},
+		{
+			name: "Mod",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeInt32, 4).initializer("y", []int32{2, 2, -2, -2}).
+					node("Mod", []string{"x", "y"}, []string{"y0"}).
+					node("Mod", []string{"x", "y"}, []string{"y1"}, intAttr("fmod", 1))
+			},
+			inputs: []any{[]int32{-3, 3, -3, 3}},
+			want:   []any{[]int32{1, 1, -1, -1}, []int32{-1, 1, -1, 1}},
+		},
+		{
+			name: "AveragePool-padding",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 1, 1, 2, 2).
+					node("AveragePool", []string{"x"}, []string{"y"},
+						intsAttr("kernel_shape", 2, 2), intsAttr("pads", 1, 1, 0, 0))
+			},
+			inputs: []any{[][][][]float32{{{{1, 2}, {3, 4}}}}},
+			want:   []any{[][][][]float32{{{{1, 1.5}, {2, 2.5}}}}},
+		},
+		{
+			name: "MaxPool-GlobalAveragePool",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 1, 1, 2, 3).
+					node("MaxPool", []string{"x"}, []string{"y0"},
+						intsAttr("kernel_shape", 2, 2), intsAttr("strides", 1, 1)).
+					node("GlobalAveragePool", []string{"x"}, []string{"y1"})
+			},
+			inputs: []any{[][][][]float32{{{{1, 5, 2}, {3, 4, 6}}}}},
+			want:   []any{[][][][]float32{{{{5, 6}}}}, [][][][]float32{{{{3.5}}}}},
+		},
+		{
+			name:  "Softmax-opset11",
+			opset: 11,
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 1, 2, 2).
+					node("Softmax", []string{"x"}, []string{"y"})
+			},
+			inputs: []any{[][][]float32{{{0, 0}, {0, 0}}}},
+			want:   []any{[][][]float32{{{0.25, 0.25}, {0.25, 0.25}}}},
+		},
+		{
+			name: "Einsum-Cast-Clip",
+			build: func(b *modelBuilder) {
+				b.input("x", DataTypeFloat, 2, 2).initializer("w", [][]float32{{1, 0}, {0.5, -1}}).
+					initializer("min", float32(-0.5)).
+					node("Einsum", []string{"x", "w"}, []string{"y0"}, stringAttr("equation", "ij, jk -> ik")).
+					node("Cast", []string{"y0"}, []string{"y1"}, intAttr("to", int64(DataTypeInt32))).
+					node("Clip", []string{"y0", "min"}, []string{"y2"})
+			},
+			inputs: []any{[][]float32{{1, 2}, {3, 4}}},
+			want: []any{
+				[][]float32{{2, -2}, {5, -4}},
+				[][]int32{{2, -2}, {5, -4}},
+				[][]float32{{2, -0.5}, {5, -0.5}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opset := tc.opset
+			if opset == 0 {
+				opset = 17
+			}
+			b := newModelBuilder(opset)
+			tc.build(b)
+			for ii := range tc.want {
+				name := "y"
+				if len(tc.want) > 1 {
+					name = fmt.Sprintf("y%d", ii)
+				}
+				b.output(name, DataTypeFloat)
+			}
+			outputs := execModel(t, context.New(), b.model(t), tc.inputs...)
+			require.Len(t, outputs, len(tc.want))
+			for ii, output := range outputs {
+				fmt.Printf("\t%s: output #%d: %s\n", tc.name, ii, output)
+				require.True(t, tensors.FromAnyValue(tc.want[ii]).InDelta(output, 1e-5),
+					"output #%d: want %v, got %s", ii, tc.want[ii], output)
+			}
+		})
+	}
+}
+
+// naiveConv2D computes a 2D convolution in the ONNX layout: x shaped [batch, inChannels, height, width],
+// kernel shaped [outChannels, inChannels/groups, kernelHeight, kernelWidth].
+func naiveConv2D(x [][][][]float32, kernel [][][][]float32, bias []float32, strides, pads []int, groups int) [][][][]float32 {
+	batch, inChannels, height, width := len(x), len(x[0]), len(x[0][0]), len(x[0][0][0])
+	outChannels, kernelHeight, kernelWidth := len(kernel), len(kernel[0][0]), len(kernel[0][0][0])
+	outHeight := (height+pads[0]+pads[2]-kernelHeight)/strides[0] + 1
+	outWidth := (width+pads[1]+pads[3]-kernelWidth)/strides[1] + 1
+	inPerGroup, outPerGroup := inChannels/groups, outChannels/groups
+	y := make([][][][]float32, batch)
+	for b := range batch {
+		y[b] = make([][][]float32, outChannels)
+		for oc := range outChannels {
+			group := oc / outPerGroup
+			y[b][oc] = make([][]float32, outHeight)
+			for oh := range outHeight {
+				y[b][oc][oh] = make([]float32, outWidth)
+				for ow := range outWidth {
+					sum := bias[oc]
+					for ic := range inPerGroup {
+						for kh := range kernelHeight {
+							for kw := range kernelWidth {
+								h, w := oh*strides[0]-pads[0]+kh, ow*strides[1]-pads[1]+kw
+								if h < 0 || h >= height || w < 0 || w >= width {
+									continue
+								}
+								sum += x[b][group*inPerGroup+ic][h][w] * kernel[oc][ic][kh][kw]
+							}
+						}
+					}
+					y[b][oc][oh][ow] = sum
+				}
+			}
+		}
+	}
+	return y
+}
+
+// pseudoRandom returns a slice with deterministic values in [-1, 1] built with the given dimensions.
+func pseudoRandom(seed int, dims ...int) [][][][]float32 {
+	value := func(ii int) float32 { return float32(math.Sin(float64(seed*1000+ii) * 0.7)) }
+	var counter int
+	y := make([][][][]float32, dims[0])
+	for a := range y {
+		y[a] = make([][][]float32, dims[1])
+		for b := range y[a] {
+			y[a][b] = make([][]float32, dims[2])
+			for c := range y[a][b] {
+				y[a][b][c] = make([]float32, dims[3])
+				for d := range y[a][b][c] {
+					y[a][b][c][d] = value(counter)
+					counter++
+				}
+			}
+		}
+	}
+	return y
+}
+
+func TestConv(t *testing.T) {
+	x := pseudoRandom(1, 2, 4, 5, 5)
+	for _, groups := range []int{1, 2} {
+		for _, autoPad := range []string{"NOTSET", "SAME_UPPER", "VALID"} {
+			t.Run(fmt.Sprintf("groups=%d-auto_pad=%s", groups, autoPad), func(t *testing.T) {
+				kernel := pseudoRandom(2, 6, 4/groups, 3, 2)
+				bias := []float32{0.1, 0.2, 0.3, -0.1, -0.2, -0.3}
+				strides := []int{2, 1}
+				pads := []int{1, 0, 0, 1}
+				attrs := []*AttributeProto{intsAttr("strides", 2, 1), intAttr("group", int64(groups)),
+					stringAttr("auto_pad", autoPad)}
+				switch autoPad {
+				case "NOTSET":
+					attrs = append(attrs, intsAttr("pads", 1, 0, 0, 1))
+				case "SAME_UPPER":
+					// Height: output 3, total padding 2*2+3-5=2; Width: output 5, total padding 1.
+					pads = []int{1, 0, 1, 1}
+				case "VALID":
+					pads = []int{0, 0, 0, 0}
+				}
+				want := naiveConv2D(x, kernel, bias, strides, pads, groups)
+				b := newModelBuilder(17).input("x", DataTypeFloat, "batch", 4, 5, 5).output("y", DataTypeFloat).
+					initializer("w", kernel).initializer("b", bias).
+					node("Conv", []string{"x", "w", "b"}, []string{"y"}, attrs...)
+				got := execModel(t, context.New(), b.model(t), x)[0]
+				require.True(t, tensors.FromValue(want).InDelta(got, 1e-4), "want %v\ngot %s", want, got)
+			})
+		}
+	}
+}
+
+// buildMLP builds an ONNX MLP classifier with a dynamic batch size: Gemm -> Relu -> MatMul -> Add -> Softmax.
+func buildMLP(t *testing.T) *Model {
+	return newModelBuilder(17).
+		input("x", DataTypeFloat, "batch", 3).
+		output("probs", DataTypeFloat).
+		initializer("fc1.weight", [][]float32{{1, 0, -1, 0.5}, {0, 1, 1, -0.5}}).
+		initializer("fc1.bias", []float32{0, 0.1, 0, -0.1}).
+		initializer("fc2.weight", [][]float32{{1, -1}, {0.5, 0.5}, {-1, 1}, {2, 0}}).
+		initializer("fc2.bias", []float32{0.1, -0.1}).
+		// x is [batch, 3], but fc1.weight is [2, 4]: use only the 2 first features, with a Slice.
+		initializer("starts", []int64{0}).initializer("ends", []int64{2}).initializer("axes", []int64{1}).
+		node("Slice", []string{"x", "starts", "ends", "axes"}, []string{"x2"}).
+		node("Gemm", []string{"x2", "fc1.weight", "fc1.bias"}, []string{"h"}).
+		node("Relu", []string{"h"}, []string{"h_relu"}).
+		node("MatMul", []string{"h_relu", "fc2.weight"}, []string{"logits_no_bias"}).
+		node("Add", []string{"logits_no_bias", "fc2.bias"}, []string{"logits"}).
+		node("Softmax", []string{"logits"}, []string{"probs"}, intAttr("axis", -1)).
+		model(t)
+}
+
+func TestMLP(t *testing.T) {
+	m := buildMLP(t)
+	fmt.Println(m)
+	names, shapes := m.Inputs()
+	require.Equal(t, []string{"x"}, names)
+	require.Equal(t, []int{-1, 3}, shapes[0].Dimensions)
+	require.Equal(t, "(Float32)[batch 3]", shapes[0].String())
+	require.Empty(t, m.UnsupportedOps())
+
+	ctx := context.New()
+	m.VariablesToContext(ctx)
+	require.NotNil(t, ctx.GetVariable("fc1.weight"))
+	require.Equal(t, 4, ctx.NumVariables())
+
+	// Reference computation.
+	mlp := func(x []float32) []float32 {
+		w1 := [][]float32{{1, 0, -1, 0.5}, {0, 1, 1, -0.5}}
+		b1 := []float32{0, 0.1, 0, -0.1}
+		w2 := [][]float32{{1, -1}, {0.5, 0.5}, {-1, 1}, {2, 0}}
+		b2 := []float32{0.1, -0.1}
+		logits := slices.Clone(b2)
+		for j := range 4 {
+			h := b1[j] + x[0]*w1[0][j] + x[1]*w1[1][j]
+			h = max(h, 0)
+			for k := range 2 {
+				logits[k] += h * w2[j][k]
+			}
+		}
+		maxLogit := max(logits[0], logits[1])
+		e0, e1 := math.Exp(float64(logits[0]-maxLogit)), math.Exp(float64(logits[1]-maxLogit))
+		return []float32{float32(e0 / (e0 + e1)), float32(e1 / (e0 + e1))}
+	}
+
+	// Different batch sizes: dynamic batch dimension.
+	for _, batch := range [][][]float32{
+		{{1, 2, 100}},
+		{{1, 2, 100}, {-1, 0.5, 0}, {0.3, -2, 7}},
+	} {
+		want := make([][]float32, len(batch))
+		for ii, x := range batch {
+			want[ii] = mlp(x)
+		}
+		got := execModel(t, ctx, m, batch)[0]
+		require.True(t, tensors.FromValue(want).InDelta(got, 1e-5), "want %v, got %s", want, got)
+	}
+}
+
+func TestFineTune(t *testing.T) {
+	m := buildMLP(t)
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	m.VariablesToContext(ctx.In("mlp"))
+	original := ctx.In("mlp").GetVariable("fc1.weight").Value().Clone()
+
+	modelFn := func(ctx *context.Context, _ any, inputs []*Node) []*Node {
+		return m.Call(ctx.In("mlp"), inputs[0])
+	}
+	trainer := train.NewTrainer(backend, ctx, modelFn, losses.MeanSquaredError,
+		optimizers.StochasticGradientDescent().WithLearningRate(0.5).Done(), nil, nil)
+	x := tensors.FromValue([][]float32{{1, 2, 0}, {-1, 0.5, 0}, {0.3, -2, 0}})
+	labels := tensors.FromValue([][]float32{{1, 0}, {0, 1}, {1, 0}})
+	var firstLoss, lastLoss float32
+	for step := range 20 {
+		metrics := trainer.TrainStep(nil, []*tensors.Tensor{x}, []*tensors.Tensor{labels})
+		lastLoss = metrics[0].Value().(float32)
+		if step == 0 {
+			firstLoss = lastLoss
+		}
+	}
+	fmt.Printf("\tloss: %g -> %g\n", firstLoss, lastLoss)
+	require.Less(t, lastLoss, firstLoss/2)
+	require.False(t, original.Equal(ctx.In("mlp").GetVariable("fc1.weight").Value()))
+}
+
+func TestUnsupportedOps(t *testing.T) {
+	b := newModelBuilder(17).input("x", DataTypeFloat, 2).output("y", DataTypeFloat).
+		node("Relu", []string{"x"}, []string{"h"}).
+		node("NonMaxSuppression", []string{"h"}, []string{"h2"}).
+		node("NonMaxSuppression", []string{"h2"}, []string{"h3"})
+	b.proto.Graph.Node = append(b.proto.Graph.Node,
+		&NodeProto{OpType: "FusedMatMul", Domain: "com.microsoft", Input: []string{"h3"}, Output: []string{"y"}})
+	m := b.model(t)
+	require.Equal(t, []string{"NonMaxSuppression (2 nodes)", "com.microsoft.FusedMatMul (1 nodes)"}, m.UnsupportedOps())
+	_, err := tryExecModel(context.New(), m, []float32{1, 2})
+	require.ErrorContains(t, err,
+		`ONNX model "test" uses unsupported operators: NonMaxSuppression (2 nodes), com.microsoft.FusedMatMul (1 nodes)`)
+
+	// Static parameters must be computable at graph building time.
+	m = newModelBuilder(17).input("x", DataTypeFloat, 2).input("shape", DataTypeInt64, 1).output("y", DataTypeFloat).
+		node("Reshape", []string{"x", "shape"}, []string{"y"}).model(t)
+	_, err = tryExecModel(context.New(), m, []float32{1, 2}, []int64{2})
+	require.ErrorContains(t, err, "must be computable at graph building time")
+}
@@ -0,0 +1,948 @@
+package onnx
+
+import (
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gomlx/gomlx/backends"
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/gomlx/gopjrt/dtypes"
+)
+
+// This file implements the conversion of the ONNX operators to graph operations.
+// See the specification of each operator in https://onnx.ai/onnx/operators/.
+
+// opConverter converts one ONNX node, given its converted inputs (nil for optional inputs not given),
+// and returns its outputs. It panics on errors.
+type opConverter func(c *converter, node *NodeProto, inputs []*Node) []*Node
+
+// opConverters maps the ONNX operator types (prefixed by the domain, if not the default one) to their converters.
+// It is populated in init, since the converters (indirectly) refer to it.
+var opConverters map[string]opConverter
+
+func init() {
+	opConverters = map[string]opConverter{
+		// Element-wise unary operations.
+		"Abs":        unaryOp(Abs),
+		"Neg":        unaryOp(Neg),
+		"Exp":        unaryOp(Exp),
+		"Log":        unaryOp(Log),
+		"Sqrt":       unaryOp(Sqrt),
+		"Reciprocal": unaryOp(Reciprocal),
+		"Floor":      unaryOp(Floor),
+		"Ceil":       unaryOp(Ceil),
+		"Round":      unaryOp(Round),
+		"Sign":       unaryOp(Sign),
+		"Sin":        unaryOp(Sin),
+		"Cos":        unaryOp(Cos),
+		"Tanh":       unaryOp(Tanh),
+		"Sigmoid":    unaryOp(Sigmoid),
+		"Erf":        unaryOp(Erf),
+		"Not":        unaryOp(LogicalNot),
+		"IsNaN":      unaryOp(IsNaN),
+		"IsInf":      convertIsInf,
+		"Softplus":   unaryOp(Softplus),
+		"Identity":   unaryOp(Identity),
+		"Relu":       unaryOp(func(x *Node) *Node { return MaxScalar(x, 0) }),
+		"Softsign":   unaryOp(func(x *Node) *Node { return Div(x, OnePlus(Abs(x))) }),
+
+		// Activations with attributes.
+		"LeakyRelu":   convertLeakyRelu,
+		"Elu":         convertElu,
+		"Selu":        convertSelu,
+		"HardSigmoid": convertHardSigmoid,
+		"HardSwish":   convertHardSwish,
+		"Gelu":        convertGelu,
+		"PRelu":       convertPRelu,
+		"Clip":        convertClip,
+		"Softmax":     convertSoftmax,
+		"LogSoftmax":  convertSoftmax,
+
+		// Element-wise binary and variadic operations, with multidirectional broadcasting.
+		"Add":            binaryOp(Add),
+		"Sub":            binaryOp(Sub),
+		"Mul":            binaryOp(Mul),
+		"Div":            binaryOp(Div),
+		"Pow":            convertPow,
+		"Mod":            convertMod,
+		"Equal":          binaryOp(Equal),
+		"Less":           binaryOp(LessThan),
+		"LessOrEqual":    binaryOp(LessOrEqual),
+		"Greater":        binaryOp(GreaterThan),
+		"GreaterOrEqual": binaryOp(GreaterOrEqual),
+		"And":            binaryOp(LogicalAnd),
+		"Or":             binaryOp(LogicalOr),
+		"Xor":            binaryOp(LogicalXor),
+		"Max":            variadicOp(Max),
+		"Min":            variadicOp(Min),
+		"Sum":            variadicOp(Add),
+		"Mean":           convertMean,
+		"Where":          convertWhere,
+
+		// Linear algebra.
+		"MatMul": convertMatMul,
+		"Gemm":   convertGemm,
+		"Einsum": convertEinsum,
+
+		// Neural network operations: see ops_nn.go.
+		"Conv":                  convertConv,
+		"MaxPool":               convertPool,
+		"AveragePool":           convertPool,
+		"GlobalAveragePool":     convertGlobalPool,
+		"GlobalMaxPool":         convertGlobalPool,
+		"BatchNormalization":    convertBatchNormalization,
+		"LayerNormalization":    convertLayerNormalization,
+		"InstanceNormalization": convertInstanceNormalization,
+		"Dropout":               convertDropout,
+
+		// Reductions.
+		"ReduceMean":      reduceOp(ReduceMean),
+		"ReduceSum":       reduceOp(ReduceSum),
+		"ReduceMax":       reduceOp(ReduceMax),
+		"ReduceMin":       reduceOp(ReduceMin),
+		"ReduceProd":      reduceOp(ReduceMultiply),
+		"ReduceSumSquare": reduceOp(func(x *Node, axes ...int) *Node { return ReduceSum(Square(x), axes...) }),
+		"ReduceL1":        reduceOp(func(x *Node, axes ...int) *Node { return ReduceSum(Abs(x), axes...) }),
+		"ReduceL2":        reduceOp(func(x *Node, axes ...int) *Node { return Sqrt(ReduceSum(Square(x), axes...)) }),
+		"ArgMax":          convertArgMinMax,
+		"ArgMin":          convertArgMinMax,
+		"CumSum":          convertCumSum,
+
+		// Shape manipulation.
+		"Reshape":   convertReshape,
+		"Flatten":   convertFlatten,
+		"Transpose": convertTranspose,
+		"Squeeze":   convertSqueeze,
+		"Unsqueeze": convertUnsqueeze,
+		"Concat":    convertConcat,
+		"Split":     convertSplit,
+		"Slice":     convertSlice,
+		"Gather":    convertGather,
+		"GatherND":  convertGatherND,
+		"Expand":    convertExpand,
+		"Tile":      convertTile,
+		"Pad":       convertPad,
+
+		// Constants, shapes and types.
+		"Shape":           convertShape,
+		"Size":            convertSize,
+		"Cast":            convertCast,
+		"CastLike":        convertCastLike,
+		"Constant":        convertConstant,
+		"ConstantOfShape": convertConstantOfShape,
+		"Range":           convertRange,
+	}
+}
+
+// attribute returns the attribute with the given name, or nil if not set.
+func (n *NodeProto) attribute(name string) *AttributeProto {
+	for _, attr := range n.Attribute {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// intAttr returns the value of an int attribute, or defaultValue if not set.
+func (n *NodeProto) intAttr(name string, defaultValue int) int {
+	if attr := n.attribute(name); attr != nil {
+		return int(attr.I)
+	}
+	return defaultValue
+}
+
+// floatAttr returns the value of a float attribute, or defaultValue if not set.
+func (n *NodeProto) floatAttr(name string, defaultValue float64) float64 {
+	if attr := n.attribute(name); attr != nil {
+		return float64(attr.F)
+	}
+	return defaultValue
+}
+
+// stringAttr returns the value of a string attribute, or defaultValue if not set.
+func (n *NodeProto) stringAttr(name string, defaultValue string) string {
+	if attr := n.attribute(name); attr != nil {
+		return string(attr.S)
+	}
+	return defaultValue
+}
+
+// intsAttr returns the value of an ints attribute, or defaultValue if not set.
+func (n *NodeProto) intsAttr(name string, defaultValue []int) []int {
+	attr := n.attribute(name)
+	if attr == nil {
+		return defaultValue
+	}
+	values := make([]int, len(attr.Ints))
+	for ii, v := range attr.Ints {
+		values[ii] = int(v)
+	}
+	return values
+}
+
+// input returns the ii-th input, or nil if it was not given.
+func input(inputs []*Node, ii int) *Node {
+	if ii >= len(inputs) {
+		return nil
+	}
+	return inputs[ii]
+}
+
+// hasInput returns whether the ii-th input of the node was given.
+func hasInput(node *NodeProto, ii int) bool {
+	return ii < len(node.Input) && node.Input[ii] != ""
+}
+
+// constantInts returns the static value of the ii-th input of the node as ints (see converter.constantValue).
+// It returns nil if the input was not given.
+func (c *converter) constantInts(node *NodeProto, ii int) []int {
+	if !hasInput(node, ii) {
+		return nil
+	}
+	return tensorToInts(c.constantValue(node.Input[ii]))
+}
+
+// constantFloat returns the static value of the ii-th input of the node as a float64 scalar, or defaultValue
+// if the input was not given.
+func (c *converter) constantFloat(node *NodeProto, ii int, defaultValue float64) float64 {
+	if !hasInput(node, ii) {
+		return defaultValue
+	}
+	values := tensorToFloats(c.constantValue(node.Input[ii]))
+	if len(values) != 1 {
+		Panicf("input #%d of node must be a scalar, got %d values", ii, len(values))
+	}
+	return values[0]
+}
+
+// tensorToInts converts the values of an integer tensor to ints.
+func tensorToInts(t *tensors.Tensor) []int {
+	values := make([]int, t.Size())
+	t.ConstFlatData(func(flat any) {
+		flatV := reflect.ValueOf(flat)
+		for ii := range values {
+			v := flatV.Index(ii)
+			switch {
+			case v.Kind() == reflect.Bool:
+				if v.Bool() {
+					values[ii] = 1
+				}
+			case v.CanInt():
+				values[ii] = int(v.Int())
+			case v.CanUint():
+				values[ii] = int(v.Uint())
+			default:
+				Panicf("expected integer values, got dtype %s", t.DType())
+			}
+		}
+	})
+	return values
+}
+
+// tensorToFloats converts the values of a numeric tensor to float64.
+func tensorToFloats(t *tensors.Tensor) []float64 {
+	values := make([]float64, t.Size())
+	t.ConstFlatData(func(flat any) {
+		flatV := reflect.ValueOf(flat)
+		for ii := range values {
+			v := flatV.Index(ii)
+			if f, ok := v.Interface().(interface{ Float32() float32 }); ok {
+				// Float16 and BFloat16.
+				values[ii] = float64(f.Float32())
+				continue
+			}
+			switch {
+			case v.CanFloat():
+				values[ii] = v.Float()
+			case v.CanInt():
+				values[ii] = float64(v.Int())
+			case v.CanUint():
+				values[ii] = float64(v.Uint())
+			default:
+				Panicf("expected numeric values, got dtype %s", t.DType())
+			}
+		}
+	})
+	return values
+}
+
+// adjustAxis converts a negative axis to a positive one, and checks that it is in range.
+func adjustAxis(axis, rank int) int {
+	if axis < 0 {
+		axis += rank
+	}
+	if axis < 0 || axis >= rank {
+		Panicf("axis %d out of range for rank %d", axis, rank)
+	}
+	return axis
+}
+
+// adjustAxes is like adjustAxis for a list of axes.
+func adjustAxes(axes []int, rank int) []int {
+	adjusted := make([]int, len(axes))
+	for ii, axis := range axes {
+		adjusted[ii] = adjustAxis(axis, rank)
+	}
+	return adjusted
+}
+
+// broadcastOperands applies the ONNX multidirectional (numpy) broadcasting to the operands.
+func broadcastOperands(operands ...*Node) []*Node {
+	var rank int
+	for _, operand := range operands {
+		rank = max(rank, operand.Rank())
+	}
+	dims := slices.Repeat([]int{1}, rank)
+	for _, operand := range operands {
+		offset := rank - operand.Rank()
+		for axis, dim := range operand.Shape().Dimensions {
+			if dim == 1 {
+				continue
+			}
+			if dims[offset+axis] != 1 && dims[offset+axis] != dim {
+				Panicf("operands can't be broadcast together: shapes %s", shapesOf(operands))
+			}
+			dims[offset+axis] = dim
+		}
+	}
+	broadcast := make([]*Node, len(operands))
+	for ii, operand := range operands {
+		if operand.Rank() < rank {
+			operand = ExpandLeftToRank(operand, rank)
+		}
+		if !slices.Equal(operand.Shape().Dimensions, dims) {
+			operand = BroadcastToDims(operand, dims...)
+		}
+		broadcast[ii] = operand
+	}
+	return broadcast
+}
+
+// shapesOf returns the shapes of the nodes, for error messages.
+func shapesOf(nodes []*Node) []shapes.Shape {
+	s := make([]shapes.Shape, len(nodes))
+	for ii, node := range nodes {
+		s[ii] = node.Shape()
+	}
+	return s
+}
+
+func unaryOp(fn func(x *Node) *Node) opConverter {
+	return func(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+		return []*Node{fn(inputs[0])}
+	}
+}
+
+func binaryOp(fn func(lhs, rhs *Node) *Node) opConverter {
+	return func(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+		operands := broadcastOperands(inputs[0], inputs[1])
+		return []*Node{fn(operands[0], operands[1])}
+	}
+}
+
+func variadicOp(fn func(lhs, rhs *Node) *Node) opConverter {
+	return func(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+		operands := broadcastOperands(inputs...)
+		result := operands[0]
+		for _, operand := range operands[1:] {
+			result = fn(result, operand)
+		}
+		return []*Node{result}
+	}
+}
+
+func convertMean(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	sum := variadicOp(Add)(c, node, inputs)[0]
+	return []*Node{DivScalar(sum, float64(len(inputs)))}
+}
+
+func convertPow(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	operands := broadcastOperands(inputs[0], ConvertDType(inputs[1], inputs[0].DType()))
+	return []*Node{Pow(operands[0], operands[1])}
+}
+
+func convertMod(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	operands := broadcastOperands(inputs[0], inputs[1])
+	x, y := operands[0], operands[1]
+	remainder := Rem(x, y)
+	if node.intAttr("fmod", 0) == 1 {
+		// Sign of the dividend, as C fmod.
+		return []*Node{remainder}
+	}
+	// Sign of the divisor, as Python's % operator.
+	fix := LogicalAnd(
+		NotEqual(remainder, ZerosLike(remainder)),
+		LogicalXor(IsNegative(remainder), IsNegative(y)))
+	return []*Node{Where(fix, Add(remainder, y), remainder)}
+}
+
+func convertWhere(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	operands := broadcastOperands(inputs...)
+	return []*Node{Where(operands[0], operands[1], operands[2])}
+}
+
+func convertIsInf(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	detectPositive, detectNegative := node.intAttr("detect_positive", 1) != 0, node.intAttr("detect_negative", 1) != 0
+	isInf := LogicalAnd(LogicalNot(IsFinite(x)), LogicalNot(IsNaN(x)))
+	switch {
+	case detectPositive && detectNegative:
+	case detectPositive:
+		isInf = LogicalAnd(isInf, GreaterThan(x, ScalarZero(x.Graph(), x.DType())))
+	case detectNegative:
+		isInf = LogicalAnd(isInf, LessThan(x, ScalarZero(x.Graph(), x.DType())))
+	default:
+		isInf = ZerosLike(isInf)
+	}
+	return []*Node{isInf}
+}
+
+func convertLeakyRelu(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	alpha := node.floatAttr("alpha", 0.01)
+	return []*Node{Where(IsNonNegative(x), x, MulScalar(x, alpha))}
+}
+
+func convertElu(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	alpha := node.floatAttr("alpha", 1.0)
+	return []*Node{Where(IsPositive(x), x, MulScalar(Expm1(x), alpha))}
+}
+
+func convertSelu(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	alpha := node.floatAttr("alpha", 1.67326319217681884765625)
+	gamma := node.floatAttr("gamma", 1.05070102214813232421875)
+	return []*Node{MulScalar(Where(IsPositive(x), x, MulScalar(Expm1(x), alpha)), gamma)}
+}
+
+// hardSigmoid returns max(0, min(1, alpha*x+beta)).
+func hardSigmoid(x *Node, alpha, beta float64) *Node {
+	return ClipScalar(AddScalar(MulScalar(x, alpha), beta), 0, 1)
+}
+
+func convertHardSigmoid(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	return []*Node{hardSigmoid(inputs[0], node.floatAttr("alpha", 0.2), node.floatAttr("beta", 0.5))}
+}
+
+func convertHardSwish(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	return []*Node{Mul(inputs[0], hardSigmoid(inputs[0], 1.0/6.0, 0.5))}
+}
+
+func convertGelu(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	switch approximate := node.stringAttr("approximate", "none"); approximate {
+	case "none":
+		return []*Node{MulScalar(Mul(x, OnePlus(Erf(MulScalar(x, 1/math.Sqrt2)))), 0.5)}
+	case "tanh":
+		inner := MulScalar(Add(x, MulScalar(PowScalar(x, 3), 0.044715)), math.Sqrt(2/math.Pi))
+		return []*Node{MulScalar(Mul(x, OnePlus(Tanh(inner))), 0.5)}
+	default:
+		Panicf("Gelu approximate=%q not supported", approximate)
+		return nil
+	}
+}
+
+func convertPRelu(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	operands := broadcastOperands(inputs[0], inputs[1])
+	x, slope := operands[0], operands[1]
+	return []*Node{Where(IsNegative(x), Mul(x, slope), x)}
+}
+
+func convertClip(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	minValue, maxValue := input(inputs, 1), input(inputs, 2)
+	if c.model.opsetVersion < 11 {
+		// Range given as attributes.
+		if attr := node.attribute("min"); attr != nil {
+			minValue = Scalar(x.Graph(), x.DType(), attr.F)
+		}
+		if attr := node.attribute("max"); attr != nil {
+			maxValue = Scalar(x.Graph(), x.DType(), attr.F)
+		}
+	}
+	if minValue != nil {
+		x = Max(x, minValue)
+	}
+	if maxValue != nil {
+		x = Min(x, maxValue)
+	}
+	return []*Node{x}
+}
+
+func convertSoftmax(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	softmaxFn := Softmax
+	if node.OpType == "LogSoftmax" {
+		softmaxFn = LogSoftmax
+	}
+	if c.model.opsetVersion >= 13 {
+		return []*Node{softmaxFn(x, adjustAxis(node.intAttr("axis", -1), x.Rank()))}
+	}
+	// Older versions coerce the input to 2D, with the axis given splitting the dimensions.
+	axis := adjustAxis(node.intAttr("axis", 1), x.Rank())
+	outerSize := 1
+	for _, dim := range x.Shape().Dimensions[:axis] {
+		outerSize *= dim
+	}
+	y := softmaxFn(Reshape(x, outerSize, -1), 1)
+	return []*Node{Reshape(y, x.Shape().Dimensions...)}
+}
+
+func convertMatMul(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	return []*Node{MatMul(inputs[0], inputs[1])}
+}
+
+func convertGemm(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	a, b, bias := inputs[0], inputs[1], input(inputs, 2)
+	if node.intAttr("transA", 0) != 0 {
+		a = Transpose(a, 0, 1)
+	}
+	if node.intAttr("transB", 0) != 0 {
+		b = Transpose(b, 0, 1)
+	}
+	y := MatMul(a, b)
+	if alpha := node.floatAttr("alpha", 1.0); alpha != 1.0 {
+		y = MulScalar(y, alpha)
+	}
+	if bias != nil {
+		if beta := node.floatAttr("beta", 1.0); beta != 1.0 {
+			bias = MulScalar(bias, beta)
+		}
+		operands := broadcastOperands(y, bias)
+		y = Add(operands[0], operands[1])
+	}
+	return []*Node{y}
+}
+
+func convertEinsum(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	if len(inputs) != 2 {
+		Panicf("Einsum only supported with 2 operands, got %d", len(inputs))
+	}
+	equation := strings.ReplaceAll(node.stringAttr("equation", ""), " ", "")
+	return []*Node{Einsum(equation, inputs[0], inputs[1])}
+}
+
+// reduceAxes returns the axes to reduce of a Reduce* node: from the second input (newer opsets) or from the
+// "axes" attribute. It returns nil if no reduction is to be done.
+func (c *converter) reduceAxes(node *NodeProto, rank int) []int {
+	axes := c.constantInts(node, 1)
+	if axes == nil {
+		axes = node.intsAttr("axes", nil)
+	}
+	if len(axes) == 0 {
+		if node.intAttr("noop_with_empty_axes", 0) != 0 {
+			return nil
+		}
+		return xslices.Iota(0, rank)
+	}
+	axes = adjustAxes(axes, rank)
+	slices.Sort(axes)
+	return slices.Compact(axes)
+}
+
+func reduceOp(fn func(x *Node, axes ...int) *Node) opConverter {
+	return func(c *converter, node *NodeProto, inputs []*Node) []*Node {
+		x := inputs[0]
+		axes := c.reduceAxes(node, x.Rank())
+		if len(axes) == 0 {
+			return []*Node{x}
+		}
+		if node.intAttr("keepdims", 1) != 0 {
+			return []*Node{ReduceAndKeep(x, fn, axes...)}
+		}
+		return []*Node{fn(x, axes...)}
+	}
+}
+
+func convertArgMinMax(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	if node.intAttr("select_last_index", 0) != 0 {
+		Panicf("%s with select_last_index=1 not supported", node.OpType)
+	}
+	axis := adjustAxis(node.intAttr("axis", 0), x.Rank())
+	var y *Node
+	if node.OpType == "ArgMax" {
+		y = ArgMax(x, axis, dtypes.Int64)
+	} else {
+		y = ArgMin(x, axis, dtypes.Int64)
+	}
+	if node.intAttr("keepdims", 1) != 0 {
+		y = ExpandAxes(y, axis)
+	}
+	return []*Node{y}
+}
+
+func convertCumSum(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	axis := adjustAxis(c.constantInts(node, 1)[0], x.Rank())
+	reverse := node.intAttr("reverse", 0) != 0
+	if reverse {
+		x = Reverse(x, axis)
+	}
+	y := CumSum(x, axis)
+	if node.intAttr("exclusive", 0) != 0 {
+		y = Sub(y, x)
+	}
+	if reverse {
+		y = Reverse(y, axis)
+	}
+	return []*Node{y}
+}
+
+func convertReshape(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	dims := c.constantInts(node, 1)
+	if node.intAttr("allowzero", 0) == 0 {
+		// 0 means copying the dimension from the input.
+		for ii, dim := range dims {
+			if dim == 0 {
+				dims[ii] = x.Shape().Dimensions[ii]
+			}
+		}
+	}
+	return []*Node{Reshape(x, dims...)}
+}
+
+func convertFlatten(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	axis := node.intAttr("axis", 1)
+	if axis < 0 {
+		axis += x.Rank()
+	}
+	outerSize, innerSize := 1, 1
+	for ii, dim := range x.Shape().Dimensions {
+		if ii < axis {
+			outerSize *= dim
+		} else {
+			innerSize *= dim
+		}
+	}
+	return []*Node{Reshape(x, outerSize, innerSize)}
+}
+
+func convertTranspose(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	perm := node.intsAttr("perm", nil)
+	if perm == nil {
+		perm = xslices.Iota(0, x.Rank())
+		slices.Reverse(perm)
+	}
+	return []*Node{TransposeAllAxes(x, perm...)}
+}
+
+// axesParam returns the axes of Squeeze and Unsqueeze nodes: from the second input (opset >= 13) or from the
+// "axes" attribute.
+func (c *converter) axesParam(node *NodeProto) []int {
+	if axes := c.constantInts(node, 1); axes != nil {
+		return axes
+	}
+	return node.intsAttr("axes", nil)
+}
+
+func convertSqueeze(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	axes := c.axesParam(node)
+	if len(axes) == 0 {
+		for axis, dim := range x.Shape().Dimensions {
+			if dim == 1 {
+				axes = append(axes, axis)
+			}
+		}
+		if len(axes) == 0 {
+			return []*Node{x}
+		}
+	}
+	return []*Node{Squeeze(x, adjustAxes(axes, x.Rank())...)}
+}
+
+func convertUnsqueeze(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	axes := c.axesParam(node)
+	axes = adjustAxes(axes, x.Rank()+len(axes))
+	slices.Sort(axes)
+	return []*Node{ExpandAxes(x, axes...)}
+}
+
+func convertConcat(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	axis := adjustAxis(node.intAttr("axis", 0), inputs[0].Rank())
+	var operands []*Node
+	for _, operand := range inputs {
+		if operand != nil && operand.Shape().Size() > 0 {
+			operands = append(operands, operand)
+		}
+	}
+	if len(operands) == 0 {
+		return []*Node{inputs[0]}
+	}
+	return []*Node{Concatenate(operands, axis)}
+}
+
+func convertSplit(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	axis := adjustAxis(node.intAttr("axis", 0), x.Rank())
+	dim := x.Shape().Dimensions[axis]
+	sizes := c.constantInts(node, 1)
+	if sizes == nil {
+		sizes = node.intsAttr("split", nil)
+	}
+	if sizes == nil {
+		// Equal splits, with the last one smaller if not divisible.
+		numSplits := node.intAttr("num_outputs", len(node.Output))
+		splitSize := (dim + numSplits - 1) / numSplits
+		for start := 0; start < dim; start += splitSize {
+			sizes = append(sizes, min(splitSize, dim-start))
+		}
+	}
+	outputs := make([]*Node, len(sizes))
+	var start int
+	for ii, size := range sizes {
+		outputs[ii] = SliceAxis(x, axis, AxisRange(start, start+size))
+		start += size
+	}
+	if start != dim {
+		Panicf("Split sizes %v don't add up to the dimension %d of axis %d", sizes, dim, axis)
+	}
+	return outputs
+}
+
+func convertSlice(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	var starts, ends, axes, steps []int
+	if c.model.opsetVersion < 10 {
+		starts, ends, axes = node.intsAttr("starts", nil), node.intsAttr("ends", nil), node.intsAttr("axes", nil)
+	} else {
+		starts, ends, axes, steps = c.constantInts(node, 1), c.constantInts(node, 2), c.constantInts(node, 3),
+			c.constantInts(node, 4)
+	}
+	if axes == nil {
+		axes = xslices.Iota(0, len(starts))
+	}
+	specs := make([]SliceAxisSpec, x.Rank())
+	for ii := range specs {
+		specs[ii] = AxisRange()
+	}
+	var reverseAxes []int
+	for ii, axis := range axes {
+		axis = adjustAxis(axis, x.Rank())
+		dim := x.Shape().Dimensions[axis]
+		start, end, step := starts[ii], ends[ii], 1
+		if steps != nil {
+			step = steps[ii]
+		}
+		if start < 0 {
+			start += dim
+		}
+		if end < 0 {
+			end += dim
+		}
+		switch {
+		case step > 0:
+			start, end = min(max(start, 0), dim), min(max(end, 0), dim)
+		case step < 0:
+			// Reverse the axis, and slice it with a positive step.
+			start, end = min(max(start, 0), dim-1), min(max(end, -1), dim-1)
+			start, end, step = dim-1-start, dim-1-end, -step
+			reverseAxes = append(reverseAxes, axis)
+		default:
+			Panicf("Slice step cannot be 0")
+		}
+		end = max(start, end)
+		specs[axis] = AxisRange(start, end).Stride(step)
+	}
+	if len(reverseAxes) > 0 {
+		x = Reverse(x, reverseAxes...)
+	}
+	return []*Node{Slice(x, specs...)}
+}
+
+func convertGather(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	data, indices := inputs[0], inputs[1]
+	axis := adjustAxis(node.intAttr("axis", 0), data.Rank())
+	dim := data.Shape().Dimensions[axis]
+
+	// Negative indices are counted from the end.
+	indices = Where(IsNegative(indices), AddScalar(indices, float64(dim)), indices)
+
+	// Move the gathered axis to the front.
+	if axis != 0 {
+		perm := append([]int{axis}, xslices.Iota(0, data.Rank())...)
+		perm = slices.Delete(perm, axis+1, axis+2)
+		data = TransposeAllAxes(data, perm...)
+	}
+	y := Gather(data, ExpandAxes(indices, -1))
+	if axis != 0 {
+		// Output axes are data[:axis] + indices.shape + data[axis+1:].
+		indicesRank := indices.Rank()
+		perm := make([]int, 0, y.Rank())
+		for ii := range axis {
+			perm = append(perm, indicesRank+ii)
+		}
+		for ii := range indicesRank {
+			perm = append(perm, ii)
+		}
+		for ii := indicesRank + axis; ii < y.Rank(); ii++ {
+			perm = append(perm, ii)
+		}
+		y = TransposeAllAxes(y, perm...)
+	}
+	return []*Node{y}
+}
+
+func convertGatherND(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	if batchDims := node.intAttr("batch_dims", 0); batchDims != 0 {
+		Panicf("GatherND with batch_dims=%d not supported", batchDims)
+	}
+	// With batch_dims=0, GatherND has the same semantics as Gather.
+	return []*Node{Gather(inputs[0], inputs[1])}
+}
+
+func convertExpand(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	dims := c.constantInts(node, 1)
+	target := Zeros(x.Graph(), shapes.Make(x.DType(), dims...))
+	if x.DType() == dtypes.Bool {
+		target = BroadcastToDims(Const(x.Graph(), false), dims...)
+	}
+	return []*Node{broadcastOperands(x, target)[0]}
+}
+
+func convertTile(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	repeats := c.constantInts(node, 1)
+	if len(repeats) != x.Rank() {
+		Panicf("Tile repeats %v must have one value per axis of the input shaped %s", repeats, x.Shape())
+	}
+	// Insert a new axis before each axis, broadcast it to the number of repeats, and merge them.
+	expanded := InsertAxes(x, xslices.Iota(0, x.Rank())...)
+	broadcastDims := make([]int, 0, 2*x.Rank())
+	tiledDims := make([]int, x.Rank())
+	for axis, dim := range x.Shape().Dimensions {
+		broadcastDims = append(broadcastDims, repeats[axis], dim)
+		tiledDims[axis] = repeats[axis] * dim
+	}
+	return []*Node{Reshape(BroadcastToDims(expanded, broadcastDims...), tiledDims...)}
+}
+
+func convertPad(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	if mode := node.stringAttr("mode", "constant"); mode != "constant" {
+		Panicf("Pad mode %q not supported, only \"constant\"", mode)
+	}
+	var pads []int
+	fillValue := Scalar(x.Graph(), x.DType(), 0)
+	axes := xslices.Iota(0, x.Rank())
+	if c.model.opsetVersion < 11 {
+		pads = node.intsAttr("pads", nil)
+		fillValue = Scalar(x.Graph(), x.DType(), node.floatAttr("value", 0))
+	} else {
+		pads = c.constantInts(node, 1)
+		if constantValue := input(inputs, 2); constantValue != nil {
+			fillValue = Reshape(constantValue)
+		}
+		if hasInput(node, 3) {
+			axes = adjustAxes(c.constantInts(node, 3), x.Rank())
+		}
+	}
+	if len(pads) != 2*len(axes) {
+		Panicf("Pad requires 2 paddings per axis padded (%d axes), got %v", len(axes), pads)
+	}
+	config := make([]backends.PadAxis, x.Rank())
+	for ii, axis := range axes {
+		config[axis] = backends.PadAxis{Start: pads[ii], End: pads[ii+len(axes)]}
+	}
+	return []*Node{Pad(x, fillValue, config...)}
+}
+
+// shapeTensor returns the value of a Shape node applied to x.
+func shapeTensor(node *NodeProto, x *Node) *tensors.Tensor {
+	rank := x.Rank()
+	start, end := node.intAttr("start", 0), node.intAttr("end", rank)
+	if start < 0 {
+		start += rank
+	}
+	if end < 0 {
+		end += rank
+	}
+	start, end = min(max(start, 0), rank), min(max(end, 0), rank)
+	dims := make([]int64, 0, max(end-start, 0))
+	for _, dim := range x.Shape().Dimensions[start:max(start, end)] {
+		dims = append(dims, int64(dim))
+	}
+	return tensors.FromValue(dims)
+}
+
+func convertShape(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	return []*Node{ConstTensor(inputs[0].Graph(), shapeTensor(node, inputs[0]))}
+}
+
+func convertSize(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	return []*Node{Const(inputs[0].Graph(), int64(inputs[0].Shape().Size()))}
+}
+
+func convertCast(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	dtype, err := DataType(node.intAttr("to", 0)).DType()
+	if err != nil {
+		panic(err)
+	}
+	return []*Node{ConvertDType(inputs[0], dtype)}
+}
+
+func convertCastLike(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	return []*Node{ConvertDType(inputs[0], inputs[1].DType())}
+}
+
+func convertConstant(c *converter, node *NodeProto, _ []*Node) []*Node {
+	if len(node.Attribute) != 1 {
+		Panicf("Constant requires exactly one attribute, got %d", len(node.Attribute))
+	}
+	attr := node.Attribute[0]
+	var value any
+	switch attr.Name {
+	case "value":
+		t, err := TensorFromProto(attr.T)
+		if err != nil {
+			panic(err)
+		}
+		return []*Node{ConstTensor(c.g, t)}
+	case "value_float":
+		value = attr.F
+	case "value_floats":
+		value = attr.Floats
+	case "value_int":
+		value = attr.I
+	case "value_ints":
+		value = attr.Ints
+	default:
+		Panicf("Constant attribute %q not supported", attr.Name)
+	}
+	return []*Node{Const(c.g, value)}
+}
+
+func convertConstantOfShape(c *converter, node *NodeProto, _ []*Node) []*Node {
+	dims := c.constantInts(node, 0)
+	value := Const(c.g, float32(0))
+	if attr := node.attribute("value"); attr != nil {
+		t, err := TensorFromProto(attr.T)
+		if err != nil {
+			panic(err)
+		}
+		value = Reshape(ConstTensor(c.g, t))
+	}
+	return []*Node{BroadcastToDims(value, dims...)}
+}
+
+func convertRange(c *converter, node *NodeProto, inputs []*Node) []*Node {
+	start, limit, delta := c.constantFloat(node, 0, 0), c.constantFloat(node, 1, 0), c.constantFloat(node, 2, 1)
+	count := max(int(math.Ceil((limit-start)/delta)), 0)
+	dtype := inputs[0].DType()
+	iota := Iota(c.g, shapes.Make(dtype, count), 0)
+	return []*Node{AddScalar(MulScalar(iota, delta), start)}
+}
@@ -0,0 +1,169 @@
+package onnx
+
+import (
+	"slices"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/tensors/images"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+)
+
+// This file implements the conversion of the neural network ONNX operators: convolutions, pooling and normalizations.
+// ONNX uses the "channels first" layout: inputs are shaped [batch, channels, <spatial dimensions...>].
+
+// spatialPaddings returns the paddings of the spatial axes of a Conv or pooling node, according to its
+// "auto_pad" and "pads" attributes.
+func spatialPaddings(node *NodeProto, spatialDims, kernelDims, strides, dilations []int) [][2]int {
+	numSpatial := len(spatialDims)
+	paddings := make([][2]int, numSpatial)
+	switch autoPad := node.stringAttr("auto_pad", "NOTSET"); autoPad {
+	case "NOTSET":
+		if pads := node.intsAttr("pads", nil); pads != nil {
+			if len(pads) != 2*numSpatial {
+				Panicf("pads %v must have 2 values per spatial axis (%d axes)", pads, numSpatial)
+			}
+			for ii := range paddings {
+				paddings[ii] = [2]int{pads[ii], pads[ii+numSpatial]}
+			}
+		}
+	case "VALID":
+	case "SAME_UPPER", "SAME_LOWER":
+		for ii, dim := range spatialDims {
+			outputDim := (dim + strides[ii] - 1) / strides[ii]
+			total := max((outputDim-1)*strides[ii]+(kernelDims[ii]-1)*dilations[ii]+1-dim, 0)
+			small, large := total/2, total-total/2
+			if autoPad == "SAME_UPPER" {
+				paddings[ii] = [2]int{small, large}
+			} else {
+				paddings[ii] = [2]int{large, small}
+			}
+		}
+	default:
+		Panicf("auto_pad=%q not supported", autoPad)
+	}
+	return paddings
+}
+
+// reshapePerChannel reshapes a per-channel vector (shaped [channels]) such that it can be broadcast
+// to x shaped [batch, channels, <spatial dimensions...>].
+func reshapePerChannel(v *Node, x *Node) *Node {
+	dims := xslices.SliceWithValue(x.Rank(), 1)
+	dims[1] = v.Shape().Size()
+	return Reshape(v, dims...)
+}
+
+func convertConv(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x, kernel, bias := inputs[0], inputs[1], input(inputs, 2)
+	numSpatial := x.Rank() - 2
+	kernelDims := kernel.Shape().Dimensions[2:]
+	strides := node.intsAttr("strides", xslices.SliceWithValue(numSpatial, 1))
+	dilations := node.intsAttr("dilations", xslices.SliceWithValue(numSpatial, 1))
+	paddings := spatialPaddings(node, x.Shape().Dimensions[2:], kernelDims, strides, dilations)
+	conv := Convolve(x, kernel).ChannelsAxis(images.ChannelsFirst).
+		StridePerAxis(strides...).DilationPerAxis(dilations...).PaddingPerDim(paddings)
+	if groups := node.intAttr("group", 1); groups != 1 {
+		conv = conv.ChannelGroupCount(groups)
+	}
+	y := conv.Done()
+	if bias != nil {
+		y = Add(y, reshapePerChannel(bias, y))
+	}
+	return []*Node{y}
+}
+
+func convertPool(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	numSpatial := x.Rank() - 2
+	if node.intAttr("ceil_mode", 0) != 0 {
+		Panicf("%s with ceil_mode=1 not supported", node.OpType)
+	}
+	if node.intAttr("storage_order", 0) != 0 {
+		Panicf("%s with storage_order=1 not supported", node.OpType)
+	}
+	ones := xslices.SliceWithValue(numSpatial, 1)
+	if dilations := node.intsAttr("dilations", ones); !slices.Equal(dilations, ones) {
+		Panicf("%s with dilations %v not supported", node.OpType, dilations)
+	}
+	window := node.intsAttr("kernel_shape", nil)
+	if len(window) != numSpatial {
+		Panicf("%s kernel_shape %v must have one value per spatial axis (%d axes)", node.OpType, window, numSpatial)
+	}
+	strides := node.intsAttr("strides", ones)
+	paddings := spatialPaddings(node, x.Shape().Dimensions[2:], window, strides, ones)
+	configure := func(pool *PoolBuilder) *Node {
+		return pool.ChannelsAxis(images.ChannelsFirst).WindowPerAxis(window...).StridePerAxis(strides...).
+			PaddingPerDim(paddings).Done()
+	}
+	if node.OpType == "MaxPool" {
+		return []*Node{configure(MaxPool(x))}
+	}
+
+	// AveragePool: by default, padded values are not counted.
+	sum := configure(SumPool(x))
+	hasPadding := false
+	for _, padding := range paddings {
+		hasPadding = hasPadding || padding != [2]int{0, 0}
+	}
+	if hasPadding && node.intAttr("count_include_pad", 0) == 0 {
+		return []*Node{Div(sum, configure(SumPool(OnesLike(x))))}
+	}
+	windowSize := 1
+	for _, dim := range window {
+		windowSize *= dim
+	}
+	return []*Node{DivScalar(sum, float64(windowSize))}
+}
+
+func convertGlobalPool(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	spatialAxes := xslices.Iota(2, x.Rank()-2)
+	if node.OpType == "GlobalMaxPool" {
+		return []*Node{ReduceAndKeep(x, ReduceMax, spatialAxes...)}
+	}
+	return []*Node{ReduceAndKeep(x, ReduceMean, spatialAxes...)}
+}
+
+func convertBatchNormalization(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	if node.intAttr("training_mode", 0) != 0 {
+		Panicf("BatchNormalization with training_mode=1 not supported")
+	}
+	x := inputs[0]
+	scale, bias := reshapePerChannel(inputs[1], x), reshapePerChannel(inputs[2], x)
+	mean, variance := reshapePerChannel(inputs[3], x), reshapePerChannel(inputs[4], x)
+	epsilon := node.floatAttr("epsilon", 1e-5)
+	normalized := Mul(Sub(x, mean), Rsqrt(AddScalar(variance, epsilon)))
+	return []*Node{Add(Mul(normalized, scale), bias)}
+}
+
+func convertLayerNormalization(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x, scale, bias := inputs[0], inputs[1], input(inputs, 2)
+	axis := adjustAxis(node.intAttr("axis", -1), x.Rank())
+	axes := xslices.Iota(axis, x.Rank()-axis)
+	epsilon := node.floatAttr("epsilon", 1e-5)
+	mean := ReduceAndKeep(x, ReduceMean, axes...)
+	centered := Sub(x, mean)
+	invStdDev := Rsqrt(AddScalar(ReduceAndKeep(Square(centered), ReduceMean, axes...), epsilon))
+	y := Mul(Mul(centered, invStdDev), ExpandLeftToRank(scale, x.Rank()))
+	if bias != nil {
+		y = Add(y, ExpandLeftToRank(bias, x.Rank()))
+	}
+	return []*Node{y, mean, invStdDev}
+}
+
+func convertInstanceNormalization(_ *converter, node *NodeProto, inputs []*Node) []*Node {
+	x := inputs[0]
+	scale, bias := reshapePerChannel(inputs[1], x), reshapePerChannel(inputs[2], x)
+	spatialAxes := xslices.Iota(2, x.Rank()-2)
+	epsilon := node.floatAttr("epsilon", 1e-5)
+	centered := Sub(x, ReduceAndKeep(x, ReduceMean, spatialAxes...))
+	invStdDev := Rsqrt(AddScalar(ReduceAndKeep(Square(centered), ReduceMean, spatialAxes...), epsilon))
+	return []*Node{Add(Mul(Mul(centered, invStdDev), scale), bias)}
+}
+
+func convertDropout(_ *converter, _ *NodeProto, inputs []*Node) []*Node {
+	// Inference mode: the input is returned unchanged, and the mask is all true.
+	x := inputs[0]
+	mask := BroadcastToDims(Const(x.Graph(), true), x.Shape().Dimensions...)
+	return []*Node{x, mask}
+}
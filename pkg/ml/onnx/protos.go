@@ -0,0 +1,765 @@
+package onnx
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// This file contains a minimal implementation of the ONNX protobuf messages (see onnx.proto in
+// https://github.com/onnx/onnx), with only the fields used by the importer and exporter.
+// Unknown fields are skipped when parsing.
+
+// DataType is the ONNX TensorProto.DataType enum.
+type DataType int32
+
+// Values of DataType, as defined in onnx.proto.
+const (
+	DataTypeUndefined  DataType = 0
+	DataTypeFloat      DataType = 1
+	DataTypeUint8      DataType = 2
+	DataTypeInt8       DataType = 3
+	DataTypeUint16     DataType = 4
+	DataTypeInt16      DataType = 5
+	DataTypeInt32      DataType = 6
+	DataTypeInt64      DataType = 7
+	DataTypeString     DataType = 8
+	DataTypeBool       DataType = 9
+	DataTypeFloat16    DataType = 10
+	DataTypeDouble     DataType = 11
+	DataTypeUint32     DataType = 12
+	DataTypeUint64     DataType = 13
+	DataTypeComplex64  DataType = 14
+	DataTypeComplex128 DataType = 15
+	DataTypeBFloat16   DataType = 16
+)
+
+// AttributeType is the ONNX AttributeProto.AttributeType enum.
+type AttributeType int32
+
+// Values of AttributeType, as defined in onnx.proto.
+const (
+	AttributeTypeUndefined AttributeType = 0
+	AttributeTypeFloat     AttributeType = 1
+	AttributeTypeInt       AttributeType = 2
+	AttributeTypeString    AttributeType = 3
+	AttributeTypeTensor    AttributeType = 4
+	AttributeTypeGraph     AttributeType = 5
+	AttributeTypeFloats    AttributeType = 6
+	AttributeTypeInts      AttributeType = 7
+	AttributeTypeStrings   AttributeType = 8
+	AttributeTypeTensors   AttributeType = 9
+	AttributeTypeGraphs    AttributeType = 10
+)
+
+// ModelProto is the top-level ONNX message, holding the graph and its metadata.
+type ModelProto struct {
+	IRVersion       int64
+	ProducerName    string
+	ProducerVersion string
+	Domain          string
+	ModelVersion    int64
+	DocString       string
+	Graph           *GraphProto
+	OpsetImport     []*OperatorSetIDProto
+	MetadataProps   []*StringStringEntryProto
+}
+
+// OperatorSetIDProto identifies an operator set (domain and version) used by a model.
+// The default ONNX domain is "" (or "ai.onnx").
+type OperatorSetIDProto struct {
+	Domain  string
+	Version int64
+}
+
+// StringStringEntryProto is a key/value pair, used for metadata.
+type StringStringEntryProto struct {
+	Key, Value string
+}
+
+// GraphProto holds the computation graph: its nodes (in topological order), initializers (the weights),
+// inputs and outputs.
+type GraphProto struct {
+	Node        []*NodeProto
+	Name        string
+	Initializer []*TensorProto
+	DocString   string
+	Input       []*ValueInfoProto
+	Output      []*ValueInfoProto
+	ValueInfo   []*ValueInfoProto
+}
+
+// NodeProto is one operation in the graph. Inputs and outputs are referred to by name, and an empty
+// name means an optional input or output not given.
+type NodeProto struct {
+	Input     []string
+	Output    []string
+	Name      string
+	OpType    string
+	Attribute []*AttributeProto
+	DocString string
+	Domain    string
+}
+
+// AttributeProto is a named attribute of a NodeProto. Only the field corresponding to Type is set.
+type AttributeProto struct {
+	Name      string
+	Type      AttributeType
+	F         float32
+	I         int64
+	S         []byte
+	T         *TensorProto
+	G         *GraphProto
+	Floats    []float32
+	Ints      []int64
+	Strings   [][]byte
+	Tensors   []*TensorProto
+	Graphs    []*GraphProto
+	DocString string
+}
+
+// intAttr creates an integer attribute.
+func intAttr(name string, value int64) *AttributeProto {
+	return &AttributeProto{Name: name, Type: AttributeTypeInt, I: value}
+}
+
+// floatAttr creates a float attribute.
+func floatAttr(name string, value float32) *AttributeProto {
+	return &AttributeProto{Name: name, Type: AttributeTypeFloat, F: value}
+}
+
+// intsAttr creates an attribute with a list of integers.
+func intsAttr(name string, values ...int64) *AttributeProto {
+	return &AttributeProto{Name: name, Type: AttributeTypeInts, Ints: values}
+}
+
+// stringAttr creates a string attribute.
+func stringAttr(name string, value string) *AttributeProto {
+	return &AttributeProto{Name: name, Type: AttributeTypeString, S: []byte(value)}
+}
+
+// TensorProto holds a tensor value: either in RawData (little-endian) or in one of the typed fields,
+// depending on DataType.
+type TensorProto struct {
+	Dims         []int64
+	DataType     DataType
+	FloatData    []float32
+	Int32Data    []int32
+	StringData   [][]byte
+	Int64Data    []int64
+	Name         string
+	DocString    string
+	RawData      []byte
+	ExternalData []*StringStringEntryProto
+	DataLocation int32
+	DoubleData   []float64
+	Uint64Data   []uint64
+}
+
+// ValueInfoProto describes a named value of the graph (an input, output or intermediary value).
+type ValueInfoProto struct {
+	Name      string
+	Type      *TypeProto
+	DocString string
+}
+
+// TypeProto describes the type of value: only tensors are supported.
+type TypeProto struct {
+	TensorType *TensorTypeProto
+	Denotation string
+}
+
+// TensorTypeProto describes the element type and shape of a tensor. A nil Shape means the rank is unknown.
+type TensorTypeProto struct {
+	ElemType DataType
+	Shape    *TensorShapeProto
+}
+
+// TensorShapeProto is the shape of a tensor: one DimensionProto per axis.
+type TensorShapeProto struct {
+	Dim []*DimensionProto
+}
+
+// DimensionProto is either a known dimension (DimValue) or a symbolic one (DimParam, e.g.: "batch_size").
+// If DimParam is empty, DimValue is used.
+type DimensionProto struct {
+	DimValue   int64
+	DimParam   string
+	Denotation string
+}
+
+// UnmarshalModel parses a serialized ONNX ModelProto.
+func UnmarshalModel(data []byte) (*ModelProto, error) {
+	m := &ModelProto{}
+	if err := m.unmarshal(data); err != nil {
+		return nil, errors.WithMessage(err, "failed to parse ONNX ModelProto")
+	}
+	return m, nil
+}
+
+// Marshal serializes the model in the protobuf wire format.
+func (m *ModelProto) Marshal() []byte {
+	return m.appendTo(nil)
+}
+
+// wireField is one field parsed from the protobuf wire format.
+type wireField struct {
+	num protowire.Number
+	typ protowire.Type
+
+	// value holds the contents of varint, fixed32 and fixed64 fields.
+	value uint64
+
+	// bytes holds the contents of length-delimited fields.
+	bytes []byte
+}
+
+// forEachField parses the fields of a message and calls fn for each of them.
+func forEachField(data []byte, fn func(f *wireField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		f := &wireField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.value = uint64(v)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return errors.Wrapf(protowire.ParseError(n), "field #%d", num)
+		}
+		data = data[n:]
+		if err := fn(f); err != nil {
+			return errors.WithMessagef(err, "field #%d", num)
+		}
+	}
+	return nil
+}
+
+func (f *wireField) string() string { return string(f.bytes) }
+
+func (f *wireField) int64() int64 { return int64(f.value) }
+
+func (f *wireField) float32() float32 { return math.Float32frombits(uint32(f.value)) }
+
+// message parses the field as a sub-message.
+func (f *wireField) message(msg interface{ unmarshal([]byte) error }) error {
+	if f.typ != protowire.BytesType {
+		return errors.Errorf("expected a message, got wire type %d", f.typ)
+	}
+	return msg.unmarshal(f.bytes)
+}
+
+// varints returns the values of a repeated varint field, which may be packed or not.
+func (f *wireField) varints() ([]uint64, error) {
+	if f.typ != protowire.BytesType {
+		return []uint64{f.value}, nil
+	}
+	var values []uint64
+	for data := f.bytes; len(data) > 0; {
+		v, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+// fixed returns the values of a repeated fixed32 or fixed64 field, which may be packed or not.
+func (f *wireField) fixed(size int) ([]uint64, error) {
+	if f.typ != protowire.BytesType {
+		return []uint64{f.value}, nil
+	}
+	if len(f.bytes)%size != 0 {
+		return nil, errors.Errorf("packed fixed%d field with invalid length %d", 8*size, len(f.bytes))
+	}
+	values := make([]uint64, 0, len(f.bytes)/size)
+	for data := f.bytes; len(data) > 0; data = data[size:] {
+		if size == 4 {
+			v, _ := protowire.ConsumeFixed32(data)
+			values = append(values, uint64(v))
+		} else {
+			v, _ := protowire.ConsumeFixed64(data)
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// appendRepeated parses a repeated numeric field using read to get the raw values, and appends them
+// to dst converted with convert.
+func appendRepeated[T any](dst []T, read func() ([]uint64, error), convert func(uint64) T) ([]T, error) {
+	values, err := read()
+	if err != nil {
+		return dst, err
+	}
+	for _, v := range values {
+		dst = append(dst, convert(v))
+	}
+	return dst, nil
+}
+
+func toInt64(v uint64) int64     { return int64(v) }
+func toInt32(v uint64) int32     { return int32(v) }
+func toUint64(v uint64) uint64   { return v }
+func toFloat32(v uint64) float32 { return math.Float32frombits(uint32(v)) }
+func toFloat64(v uint64) float64 { return math.Float64frombits(v) }
+
+// unmarshalMessage parses a new message of type T and appends it to dst.
+func unmarshalMessage[T any, PT interface {
+	*T
+	unmarshal([]byte) error
+}](dst []PT, f *wireField) ([]PT, error) {
+	msg := PT(new(T))
+	if err := f.message(msg); err != nil {
+		return dst, err
+	}
+	return append(dst, msg), nil
+}
+
+func (m *ModelProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			m.IRVersion = f.int64()
+		case 2:
+			m.ProducerName = f.string()
+		case 3:
+			m.ProducerVersion = f.string()
+		case 4:
+			m.Domain = f.string()
+		case 5:
+			m.ModelVersion = f.int64()
+		case 6:
+			m.DocString = f.string()
+		case 7:
+			m.Graph = &GraphProto{}
+			err = f.message(m.Graph)
+		case 8:
+			m.OpsetImport, err = unmarshalMessage(m.OpsetImport, f)
+		case 14:
+			m.MetadataProps, err = unmarshalMessage(m.MetadataProps, f)
+		}
+		return
+	})
+}
+
+func (m *ModelProto) appendTo(b []byte) []byte {
+	b = appendInt64(b, 1, m.IRVersion)
+	b = appendString(b, 2, m.ProducerName)
+	b = appendString(b, 3, m.ProducerVersion)
+	b = appendString(b, 4, m.Domain)
+	b = appendInt64(b, 5, m.ModelVersion)
+	b = appendString(b, 6, m.DocString)
+	if m.Graph != nil {
+		b = appendMessage(b, 7, m.Graph)
+	}
+	b = appendMessages(b, 8, m.OpsetImport)
+	b = appendMessages(b, 14, m.MetadataProps)
+	return b
+}
+
+func (o *OperatorSetIDProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) error {
+		switch f.num {
+		case 1:
+			o.Domain = f.string()
+		case 2:
+			o.Version = f.int64()
+		}
+		return nil
+	})
+}
+
+func (o *OperatorSetIDProto) appendTo(b []byte) []byte {
+	b = appendString(b, 1, o.Domain)
+	return appendInt64(b, 2, o.Version)
+}
+
+func (e *StringStringEntryProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) error {
+		switch f.num {
+		case 1:
+			e.Key = f.string()
+		case 2:
+			e.Value = f.string()
+		}
+		return nil
+	})
+}
+
+func (e *StringStringEntryProto) appendTo(b []byte) []byte {
+	b = appendString(b, 1, e.Key)
+	return appendString(b, 2, e.Value)
+}
+
+func (gp *GraphProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			gp.Node, err = unmarshalMessage(gp.Node, f)
+		case 2:
+			gp.Name = f.string()
+		case 5:
+			gp.Initializer, err = unmarshalMessage(gp.Initializer, f)
+		case 10:
+			gp.DocString = f.string()
+		case 11:
+			gp.Input, err = unmarshalMessage(gp.Input, f)
+		case 12:
+			gp.Output, err = unmarshalMessage(gp.Output, f)
+		case 13:
+			gp.ValueInfo, err = unmarshalMessage(gp.ValueInfo, f)
+		}
+		return
+	})
+}
+
+func (gp *GraphProto) appendTo(b []byte) []byte {
+	b = appendMessages(b, 1, gp.Node)
+	b = appendString(b, 2, gp.Name)
+	b = appendMessages(b, 5, gp.Initializer)
+	b = appendString(b, 10, gp.DocString)
+	b = appendMessages(b, 11, gp.Input)
+	b = appendMessages(b, 12, gp.Output)
+	b = appendMessages(b, 13, gp.ValueInfo)
+	return b
+}
+
+func (n *NodeProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			n.Input = append(n.Input, f.string())
+		case 2:
+			n.Output = append(n.Output, f.string())
+		case 3:
+			n.Name = f.string()
+		case 4:
+			n.OpType = f.string()
+		case 5:
+			n.Attribute, err = unmarshalMessage(n.Attribute, f)
+		case 6:
+			n.DocString = f.string()
+		case 7:
+			n.Domain = f.string()
+		}
+		return
+	})
+}
+
+func (n *NodeProto) appendTo(b []byte) []byte {
+	for _, input := range n.Input {
+		b = appendBytes(b, 1, []byte(input))
+	}
+	for _, output := range n.Output {
+		b = appendBytes(b, 2, []byte(output))
+	}
+	b = appendString(b, 3, n.Name)
+	b = appendString(b, 4, n.OpType)
+	b = appendMessages(b, 5, n.Attribute)
+	b = appendString(b, 6, n.DocString)
+	b = appendString(b, 7, n.Domain)
+	return b
+}
+
+func (a *AttributeProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			a.Name = f.string()
+		case 2:
+			a.F = f.float32()
+		case 3:
+			a.I = f.int64()
+		case 4:
+			a.S = f.bytes
+		case 5:
+			a.T = &TensorProto{}
+			err = f.message(a.T)
+		case 6:
+			a.G = &GraphProto{}
+			err = f.message(a.G)
+		case 7:
+			a.Floats, err = appendRepeated(a.Floats, func() ([]uint64, error) { return f.fixed(4) }, toFloat32)
+		case 8:
+			a.Ints, err = appendRepeated(a.Ints, f.varints, toInt64)
+		case 9:
+			a.Strings = append(a.Strings, f.bytes)
+		case 10:
+			a.Tensors, err = unmarshalMessage(a.Tensors, f)
+		case 11:
+			a.Graphs, err = unmarshalMessage(a.Graphs, f)
+		case 13:
+			a.DocString = f.string()
+		case 20:
+			a.Type = AttributeType(f.value)
+		}
+		return
+	})
+}
+
+func (a *AttributeProto) appendTo(b []byte) []byte {
+	b = appendString(b, 1, a.Name)
+	switch a.Type {
+	case AttributeTypeFloat:
+		b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(a.F))
+	case AttributeTypeInt:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.I))
+	case AttributeTypeString:
+		b = appendBytes(b, 4, a.S)
+	case AttributeTypeTensor:
+		b = appendMessage(b, 5, a.T)
+	case AttributeTypeGraph:
+		b = appendMessage(b, 6, a.G)
+	case AttributeTypeFloats:
+		b = appendPacked(b, 7, a.Floats, appendFloat32)
+	case AttributeTypeInts:
+		b = appendPacked(b, 8, a.Ints, appendVarint[int64])
+	case AttributeTypeStrings:
+		for _, s := range a.Strings {
+			b = appendBytes(b, 9, s)
+		}
+	case AttributeTypeTensors:
+		b = appendMessages(b, 10, a.Tensors)
+	case AttributeTypeGraphs:
+		b = appendMessages(b, 11, a.Graphs)
+	}
+	b = appendString(b, 13, a.DocString)
+	return appendInt64(b, 20, int64(a.Type))
+}
+
+func (t *TensorProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			t.Dims, err = appendRepeated(t.Dims, f.varints, toInt64)
+		case 2:
+			t.DataType = DataType(f.value)
+		case 4:
+			t.FloatData, err = appendRepeated(t.FloatData, func() ([]uint64, error) { return f.fixed(4) }, toFloat32)
+		case 5:
+			t.Int32Data, err = appendRepeated(t.Int32Data, f.varints, toInt32)
+		case 6:
+			t.StringData = append(t.StringData, f.bytes)
+		case 7:
+			t.Int64Data, err = appendRepeated(t.Int64Data, f.varints, toInt64)
+		case 8:
+			t.Name = f.string()
+		case 9:
+			t.RawData = f.bytes
+		case 10:
+			t.DoubleData, err = appendRepeated(t.DoubleData, func() ([]uint64, error) { return f.fixed(8) }, toFloat64)
+		case 11:
+			t.Uint64Data, err = appendRepeated(t.Uint64Data, f.varints, toUint64)
+		case 12:
+			t.DocString = f.string()
+		case 13:
+			t.ExternalData, err = unmarshalMessage(t.ExternalData, f)
+		case 14:
+			t.DataLocation = int32(f.value)
+		}
+		return
+	})
+}
+
+func (t *TensorProto) appendTo(b []byte) []byte {
+	b = appendPacked(b, 1, t.Dims, appendVarint[int64])
+	b = appendInt64(b, 2, int64(t.DataType))
+	b = appendPacked(b, 4, t.FloatData, appendFloat32)
+	b = appendPacked(b, 5, t.Int32Data, appendVarint[int32])
+	for _, s := range t.StringData {
+		b = appendBytes(b, 6, s)
+	}
+	b = appendPacked(b, 7, t.Int64Data, appendVarint[int64])
+	b = appendString(b, 8, t.Name)
+	if t.RawData != nil {
+		b = appendBytes(b, 9, t.RawData)
+	}
+	b = appendPacked(b, 10, t.DoubleData, appendFloat64)
+	b = appendPacked(b, 11, t.Uint64Data, appendVarint[uint64])
+	b = appendString(b, 12, t.DocString)
+	b = appendMessages(b, 13, t.ExternalData)
+	return appendInt64(b, 14, int64(t.DataLocation))
+}
+
+func (v *ValueInfoProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			v.Name = f.string()
+		case 2:
+			v.Type = &TypeProto{}
+			err = f.message(v.Type)
+		case 3:
+			v.DocString = f.string()
+		}
+		return
+	})
+}
+
+func (v *ValueInfoProto) appendTo(b []byte) []byte {
+	b = appendString(b, 1, v.Name)
+	if v.Type != nil {
+		b = appendMessage(b, 2, v.Type)
+	}
+	return appendString(b, 3, v.DocString)
+}
+
+func (tp *TypeProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			tp.TensorType = &TensorTypeProto{}
+			err = f.message(tp.TensorType)
+		case 6:
+			tp.Denotation = f.string()
+		}
+		return
+	})
+}
+
+func (tp *TypeProto) appendTo(b []byte) []byte {
+	if tp.TensorType != nil {
+		b = appendMessage(b, 1, tp.TensorType)
+	}
+	return appendString(b, 6, tp.Denotation)
+}
+
+func (tt *TensorTypeProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		switch f.num {
+		case 1:
+			tt.ElemType = DataType(f.value)
+		case 2:
+			tt.Shape = &TensorShapeProto{}
+			err = f.message(tt.Shape)
+		}
+		return
+	})
+}
+
+func (tt *TensorTypeProto) appendTo(b []byte) []byte {
+	b = appendInt64(b, 1, int64(tt.ElemType))
+	if tt.Shape != nil {
+		// An empty shape message still has to be written: it means a scalar, as opposed to an unknown rank.
+		b = appendMessage(b, 2, tt.Shape)
+	}
+	return b
+}
+
+func (s *TensorShapeProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) (err error) {
+		if f.num == 1 {
+			s.Dim, err = unmarshalMessage(s.Dim, f)
+		}
+		return
+	})
+}
+
+func (s *TensorShapeProto) appendTo(b []byte) []byte {
+	return appendMessages(b, 1, s.Dim)
+}
+
+func (d *DimensionProto) unmarshal(data []byte) error {
+	return forEachField(data, func(f *wireField) error {
+		switch f.num {
+		case 1:
+			d.DimValue = f.int64()
+		case 2:
+			d.DimParam = f.string()
+		case 3:
+			d.Denotation = f.string()
+		}
+		return nil
+	})
+}
+
+func (d *DimensionProto) appendTo(b []byte) []byte {
+	if d.DimParam != "" {
+		b = appendString(b, 2, d.DimParam)
+	} else {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(d.DimValue))
+	}
+	return appendString(b, 3, d.Denotation)
+}
+
+// appendString appends a string field, if not empty.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendBytes appends a bytes field, even if empty.
+func appendBytes(b []byte, num protowire.Number, value []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// appendInt64 appends an int64 (or enum) field, if not zero.
+func appendInt64(b []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+// appendMessage appends a sub-message field.
+func appendMessage(b []byte, num protowire.Number, msg interface{ appendTo([]byte) []byte }) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg.appendTo(nil))
+}
+
+// appendMessages appends a repeated sub-message field.
+func appendMessages[PT interface{ appendTo([]byte) []byte }](b []byte, num protowire.Number, msgs []PT) []byte {
+	for _, msg := range msgs {
+		b = appendMessage(b, num, msg)
+	}
+	return b
+}
+
+// appendPacked appends a packed repeated numeric field, if not empty.
+func appendPacked[T any](b []byte, num protowire.Number, values []T, appendValue func([]byte, T) []byte) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range values {
+		packed = appendValue(packed, v)
+	}
+	return appendBytes(b, num, packed)
+}
+
+func appendVarint[T int32 | int64 | uint64](b []byte, v T) []byte {
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendFloat32(b []byte, v float32) []byte {
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
@@ -0,0 +1,149 @@
+package onnx
+
+import (
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/gomlx/gopjrt/dtypes/bfloat16"
+	"github.com/pkg/errors"
+	"github.com/x448/float16"
+)
+
+// dataTypeToDType maps the ONNX data types supported to GoMLX dtypes.
+var dataTypeToDType = map[DataType]dtypes.DType{
+	DataTypeFloat:      dtypes.Float32,
+	DataTypeUint8:      dtypes.Uint8,
+	DataTypeInt8:       dtypes.Int8,
+	DataTypeUint16:     dtypes.Uint16,
+	DataTypeInt16:      dtypes.Int16,
+	DataTypeInt32:      dtypes.Int32,
+	DataTypeInt64:      dtypes.Int64,
+	DataTypeBool:       dtypes.Bool,
+	DataTypeFloat16:    dtypes.Float16,
+	DataTypeDouble:     dtypes.Float64,
+	DataTypeUint32:     dtypes.Uint32,
+	DataTypeUint64:     dtypes.Uint64,
+	DataTypeComplex64:  dtypes.Complex64,
+	DataTypeComplex128: dtypes.Complex128,
+	DataTypeBFloat16:   dtypes.BFloat16,
+}
+
+// DType returns the GoMLX dtype corresponding to the ONNX data type, or an error if it is not supported.
+func (dt DataType) DType() (dtypes.DType, error) {
+	dtype, found := dataTypeToDType[dt]
+	if !found {
+		return dtypes.InvalidDType, errors.Errorf("ONNX data type %d not supported", dt)
+	}
+	return dtype, nil
+}
+
+// DataTypeFromDType returns the ONNX data type corresponding to the GoMLX dtype, or an error if there isn't one.
+func DataTypeFromDType(dtype dtypes.DType) (DataType, error) {
+	for dt, candidate := range dataTypeToDType {
+		if candidate == dtype {
+			return dt, nil
+		}
+	}
+	return DataTypeUndefined, errors.Errorf("dtype %s has no ONNX equivalent", dtype)
+}
+
+// TensorFromProto converts an ONNX TensorProto to a tensor.
+//
+// Tensors with external data (stored in separate files) are not supported.
+func TensorFromProto(proto *TensorProto) (*tensors.Tensor, error) {
+	dtype, err := proto.DataType.DType()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "tensor %q", proto.Name)
+	}
+	if proto.DataLocation != 0 || len(proto.ExternalData) > 0 {
+		return nil, errors.Errorf("tensor %q uses external data, which is not supported", proto.Name)
+	}
+	dims := make([]int, len(proto.Dims))
+	for ii, dim := range proto.Dims {
+		if dim < 0 {
+			return nil, errors.Errorf("tensor %q has invalid dimensions %v", proto.Name, proto.Dims)
+		}
+		dims[ii] = int(dim)
+	}
+	shape := shapes.Make(dtype, dims...)
+	t := tensors.FromShape(shape)
+	if proto.RawData != nil {
+		// Raw data is stored in little-endian, as in the supported platforms.
+		if uintptr(len(proto.RawData)) != shape.Memory() {
+			return nil, errors.Errorf("tensor %q shaped %s has %d bytes of raw data, expected %d",
+				proto.Name, shape, len(proto.RawData), shape.Memory())
+		}
+		t.MutableBytes(func(data []byte) { copy(data, proto.RawData) })
+		return t, nil
+	}
+
+	// Data stored in the typed fields.
+	switch dtype {
+	case dtypes.Float32:
+		err = setFlatData(t, proto.FloatData, func(v float32) float32 { return v })
+	case dtypes.Float64:
+		err = setFlatData(t, proto.DoubleData, func(v float64) float64 { return v })
+	case dtypes.Int64:
+		err = setFlatData(t, proto.Int64Data, func(v int64) int64 { return v })
+	case dtypes.Uint64:
+		err = setFlatData(t, proto.Uint64Data, func(v uint64) uint64 { return v })
+	case dtypes.Uint32:
+		err = setFlatData(t, proto.Uint64Data, func(v uint64) uint32 { return uint32(v) })
+	case dtypes.Int32:
+		err = setFlatData(t, proto.Int32Data, func(v int32) int32 { return v })
+	case dtypes.Int16:
+		err = setFlatData(t, proto.Int32Data, func(v int32) int16 { return int16(v) })
+	case dtypes.Int8:
+		err = setFlatData(t, proto.Int32Data, func(v int32) int8 { return int8(v) })
+	case dtypes.Uint16:
+		err = setFlatData(t, proto.Int32Data, func(v int32) uint16 { return uint16(v) })
+	case dtypes.Uint8:
+		err = setFlatData(t, proto.Int32Data, func(v int32) uint8 { return uint8(v) })
+	case dtypes.Bool:
+		err = setFlatData(t, proto.Int32Data, func(v int32) bool { return v != 0 })
+	case dtypes.Float16:
+		err = setFlatData(t, proto.Int32Data, func(v int32) float16.Float16 { return float16.Frombits(uint16(v)) })
+	case dtypes.BFloat16:
+		err = setFlatData(t, proto.Int32Data, func(v int32) bfloat16.BFloat16 { return bfloat16.FromBits(uint16(v)) })
+	default:
+		err = errors.Errorf("dtype %s only supported with raw data", dtype)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "tensor %q shaped %s", proto.Name, shape)
+	}
+	return t, nil
+}
+
+// setFlatData sets the contents of t with the values converted by convert.
+func setFlatData[S any, T dtypes.Supported](t *tensors.Tensor, values []S, convert func(S) T) error {
+	if len(values) != t.Size() {
+		return errors.Errorf("got %d values, expected %d", len(values), t.Size())
+	}
+	tensors.MutableFlatData(t, func(flat []T) {
+		for ii, v := range values {
+			flat[ii] = convert(v)
+		}
+	})
+	return nil
+}
+
+// TensorToProto converts a tensor to an ONNX TensorProto with the given name. The values are stored as raw data.
+func TensorToProto(name string, t *tensors.Tensor) (*TensorProto, error) {
+	dataType, err := DataTypeFromDType(t.DType())
+	if err != nil {
+		return nil, errors.WithMessagef(err, "tensor %q", name)
+	}
+	proto := &TensorProto{
+		Name:     name,
+		DataType: dataType,
+		Dims:     make([]int64, t.Rank()),
+	}
+	for ii, dim := range t.Shape().Dimensions {
+		proto.Dims[ii] = int64(dim)
+	}
+	t.ConstBytes(func(data []byte) {
+		proto.RawData = make([]byte, len(data))
+		copy(proto.RawData, data)
+	})
+	return proto, nil
+}
@@ -0,0 +1,231 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// bpeMerges is the list of merges of a BPE model, in order of priority.
+//
+// In JSON, it accepts both the older format (each merge a string with the two tokens separated by space)
+// and the newer one (each merge a pair of strings). It is always saved in the newer format.
+type bpeMerges [][2]string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (merges *bpeMerges) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*merges = make(bpeMerges, 0, len(raw))
+	for _, rawMerge := range raw {
+		var pair [2]string
+		if len(rawMerge) > 0 && rawMerge[0] == '"' {
+			var merge string
+			if err := json.Unmarshal(rawMerge, &merge); err != nil {
+				return err
+			}
+			parts := strings.SplitN(merge, " ", 2)
+			if len(parts) != 2 {
+				return errors.Errorf("invalid BPE merge %q, expected two tokens separated by a space", merge)
+			}
+			pair = [2]string{parts[0], parts[1]}
+		} else if err := json.Unmarshal(rawMerge, &pair); err != nil {
+			return err
+		}
+		*merges = append(*merges, pair)
+	}
+	return nil
+}
+
+// bpeModel implements the Byte-Pair Encoding model: words are split into characters, and then adjacent tokens
+// are merged following the priority given by the list of merges.
+//
+// Dropout is not applied: tokenization is always deterministic.
+type bpeModel struct {
+	Type                    string         `json:"type"`
+	Dropout                 *float64       `json:"dropout"`
+	UnkToken                *string        `json:"unk_token"`
+	ContinuingSubwordPrefix *string        `json:"continuing_subword_prefix"`
+	EndOfWordSuffix         *string        `json:"end_of_word_suffix"`
+	FuseUnk                 bool           `json:"fuse_unk"`
+	ByteFallback            bool           `json:"byte_fallback"`
+	IgnoreMerges            bool           `json:"ignore_merges"`
+	Vocab                   map[string]int `json:"vocab"`
+	Merges                  bpeMerges      `json:"merges"`
+
+	index  map[int]string
+	prefix string
+	suffix string
+
+	// ranks maps a pair of token ids to the merge rank and the id of the merged token.
+	ranks map[[2]int]bpeMerge
+
+	muCache sync.RWMutex
+	cache   map[string][]token
+}
+
+// bpeMerge is the rank of a merge and the resulting token id.
+type bpeMerge struct {
+	rank, id int
+}
+
+// bpeCacheSize is the maximum number of words cached by the BPE model.
+const bpeCacheSize = 10_000
+
+func (m *bpeModel) init() error {
+	m.index = vocabIndex(m.Vocab)
+	if m.ContinuingSubwordPrefix != nil {
+		m.prefix = *m.ContinuingSubwordPrefix
+	}
+	if m.EndOfWordSuffix != nil {
+		m.suffix = *m.EndOfWordSuffix
+	}
+	m.ranks = make(map[[2]int]bpeMerge, len(m.Merges))
+	for rank, merge := range m.Merges {
+		left, foundLeft := m.Vocab[merge[0]]
+		right, foundRight := m.Vocab[merge[1]]
+		if !foundLeft || !foundRight {
+			return errors.Errorf("BPE merge #%d %q is made of tokens not in the vocabulary", rank, merge)
+		}
+		merged := merge[0] + strings.TrimPrefix(merge[1], m.prefix)
+		id, found := m.Vocab[merged]
+		if !found {
+			return errors.Errorf("BPE merge #%d %q results in token %q not in the vocabulary", rank, merge, merged)
+		}
+		m.ranks[[2]int{left, right}] = bpeMerge{rank: rank, id: id}
+	}
+	m.cache = make(map[string][]token)
+	return nil
+}
+
+func (m *bpeModel) tokenToID(token string) (int, bool) {
+	id, found := m.Vocab[token]
+	return id, found
+}
+
+func (m *bpeModel) idToToken(id int) (string, bool) {
+	t, found := m.index[id]
+	return t, found
+}
+
+func (m *bpeModel) vocabSize() int { return len(m.Vocab) }
+
+func (m *bpeModel) tokenize(text string) ([]token, error) {
+	if text == "" {
+		return nil, nil
+	}
+	m.muCache.RLock()
+	tokens, found := m.cache[text]
+	m.muCache.RUnlock()
+	if found {
+		return tokens, nil
+	}
+	tokens, err := m.tokenizeWord(text)
+	if err != nil {
+		return nil, err
+	}
+	m.muCache.Lock()
+	if len(m.cache) >= bpeCacheSize {
+		clear(m.cache)
+	}
+	m.cache[text] = tokens
+	m.muCache.Unlock()
+	return tokens, nil
+}
+
+// tokenizeWord implements tokenize, without the cache.
+//
+// It returns an error if a character is not in the vocabulary (nor covered by the byte fallback), and the model
+// has no unknown token to represent it.
+func (m *bpeModel) tokenizeWord(text string) ([]token, error) {
+	if m.IgnoreMerges {
+		if id, found := m.Vocab[text]; found {
+			return []token{{id: id, value: text, offsets: [2]int{0, len(text)}}}, nil
+		}
+	}
+
+	// Split the word into characters.
+	unkID := -1
+	if m.UnkToken != nil {
+		if id, found := m.Vocab[*m.UnkToken]; found {
+			unkID = id
+		}
+	}
+	type symbol struct {
+		id         int
+		start, end int
+		canMerge   bool
+	}
+	symbols := make([]symbol, 0, len(text))
+	for pos := 0; pos < len(text); {
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		char := text[pos : pos+size]
+		if pos > 0 {
+			char = m.prefix + char
+		}
+		if pos+size == len(text) {
+			char += m.suffix
+		}
+		if id, found := m.Vocab[char]; found {
+			symbols = append(symbols, symbol{id: id, start: pos, end: pos + size, canMerge: true})
+			pos += size
+			continue
+		}
+		if m.ByteFallback {
+			byteIDs := make([]int, 0, size)
+			for ii := pos; ii < pos+size; ii++ {
+				if id, found := m.Vocab[byteFallbackToken(text[ii])]; found {
+					byteIDs = append(byteIDs, id)
+				}
+			}
+			if len(byteIDs) == size {
+				for ii, id := range byteIDs {
+					symbols = append(symbols, symbol{id: id, start: pos + ii, end: pos + ii + 1})
+				}
+				pos += size
+				continue
+			}
+		}
+		if unkID < 0 {
+			return nil, errors.Errorf("BPE model can't tokenize character %q (byte offset %d in %q): it is not in "+
+				"the vocabulary and the model has no unknown token (\"unk_token\")", text[pos:pos+size], pos, text)
+		}
+		if m.FuseUnk && len(symbols) > 0 && symbols[len(symbols)-1].id == unkID {
+			symbols[len(symbols)-1].end = pos + size
+		} else {
+			symbols = append(symbols, symbol{id: unkID, start: pos, end: pos + size})
+		}
+		pos += size
+	}
+
+	// Merge symbols, from the lowest ranked merge.
+	for len(symbols) > 1 {
+		bestIdx, best := -1, bpeMerge{}
+		for ii := 0; ii < len(symbols)-1; ii++ {
+			if !symbols[ii].canMerge || !symbols[ii+1].canMerge {
+				continue
+			}
+			merge, found := m.ranks[[2]int{symbols[ii].id, symbols[ii+1].id}]
+			if found && (bestIdx < 0 || merge.rank < best.rank) {
+				bestIdx, best = ii, merge
+			}
+		}
+		if bestIdx < 0 {
+			break
+		}
+		symbols[bestIdx].id = best.id
+		symbols[bestIdx].end = symbols[bestIdx+1].end
+		symbols = append(symbols[:bestIdx+1], symbols[bestIdx+2:]...)
+	}
+
+	tokens := make([]token, len(symbols))
+	for ii, s := range symbols {
+		tokens[ii] = token{id: s.id, value: m.index[s.id], offsets: [2]int{s.start, s.end}}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,124 @@
+package tokenizers
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// byteToRune maps each byte to a printable unicode character, as in GPT-2's "bytes_to_unicode": printable
+// latin-1 characters map to themselves, and the others (control characters, space, etc.) are shifted to
+// the range starting at 256.
+var byteToRune [256]rune
+
+// runeToByte is the inverse of byteToRune.
+var runeToByte = make(map[rune]byte, 256)
+
+func init() {
+	isPrintable := func(b int) bool {
+		return (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+	}
+	next := rune(256)
+	for b := range 256 {
+		if isPrintable(b) {
+			byteToRune[b] = rune(b)
+		} else {
+			byteToRune[b] = next
+			next++
+		}
+		runeToByte[byteToRune[b]] = byte(b)
+	}
+}
+
+// byteLevelEncode replaces each byte of the normalized string by its byteToRune mapping.
+func byteLevelEncode(ns *normalizedString) {
+	var b normalizedBuilder
+	text := ns.normalized
+	for pos := 0; pos < len(text); {
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		alignment := ns.span(pos, pos+size)
+		for ii := pos; ii < pos+size; ii++ {
+			b.write(string(byteToRune[text[ii]]), alignment)
+		}
+		pos += size
+	}
+	*ns = *b.done()
+}
+
+// byteLevelDecode converts a text encoded with byteToRune back to the original bytes. Runes that
+// are not part of the mapping are kept as is.
+func byteLevelDecode(text string) string {
+	decoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		if b, found := runeToByte[r]; found {
+			decoded = append(decoded, b)
+		} else {
+			decoded = utf8.AppendRune(decoded, r)
+		}
+	}
+	return string(decoded)
+}
+
+// gpt2Matches returns the ranges matched by GPT-2's pre-tokenization regular expression:
+//
+//	's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+//
+// It's implemented by hand, since Go's regexp package doesn't support look-ahead.
+func gpt2Matches(text string) (matches [][2]int) {
+	runeAt := func(pos int) (rune, int) {
+		if pos >= len(text) {
+			return utf8.RuneError, 0
+		}
+		return utf8.DecodeRuneInString(text[pos:])
+	}
+	// scan returns the position after the run of runes starting at pos for which fn returns true.
+	scan := func(pos int, fn func(r rune) bool) int {
+		for pos < len(text) {
+			r, size := runeAt(pos)
+			if !fn(r) {
+				break
+			}
+			pos += size
+		}
+		return pos
+	}
+	isOther := func(r rune) bool { return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r) }
+	contractions := []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+
+	for pos := 0; pos < len(text); {
+		end := -1
+		for _, contraction := range contractions {
+			if len(text)-pos >= len(contraction) && text[pos:pos+len(contraction)] == contraction {
+				end = pos + len(contraction)
+				break
+			}
+		}
+		if end < 0 {
+			start := pos
+			if text[pos] == ' ' {
+				start++
+			}
+			r, _ := runeAt(start)
+			switch {
+			case start < len(text) && unicode.IsLetter(r):
+				end = scan(start, unicode.IsLetter)
+			case start < len(text) && unicode.IsNumber(r):
+				end = scan(start, unicode.IsNumber)
+			case start < len(text) && isOther(r):
+				end = scan(start, isOther)
+			}
+		}
+		if end < 0 {
+			// Sequence of white spaces: if followed by a non-space, leave the last one out.
+			end = scan(pos, unicode.IsSpace)
+			if end < len(text) {
+				_, lastSize := utf8.DecodeLastRuneInString(text[pos:end])
+				if end-lastSize > pos {
+					end -= lastSize
+				}
+			}
+		}
+		matches = append(matches, [2]int{pos, end})
+		pos = end
+	}
+	return
+}
@@ -0,0 +1,286 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// decoder converts tokens back to text, reverting the transformations of the pre-tokenizer and model
+// (e.g.: byte-level encoding, word-piece prefixes, etc.).
+//
+// It corresponds to the "decoder" field of the HuggingFace tokenizer.json file.
+type decoder interface {
+	// decodeChain transforms the tokens: the final text is the concatenation of the returned strings.
+	decodeChain(tokens []string) []string
+}
+
+// parseDecoder from its JSON description. It returns nil for a JSON null.
+func parseDecoder(data json.RawMessage) (decoder, error) {
+	typeName, err := componentType(data)
+	if err != nil || typeName == "" {
+		return nil, err
+	}
+	var d decoder
+	switch typeName {
+	case "Sequence":
+		var raw struct {
+			Decoders []json.RawMessage `json:"decoders"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		seq := &sequenceDecoder{Type: typeName}
+		for _, rawSub := range raw.Decoders {
+			var sub decoder
+			sub, err = parseDecoder(rawSub)
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				seq.Decoders = append(seq.Decoders, sub)
+			}
+		}
+		return seq, nil
+	case "ByteLevel":
+		d = &byteLevelDecoder{}
+	case "WordPiece":
+		d = &wordPieceDecoder{Prefix: "##", Cleanup: true}
+	case "Metaspace":
+		d = &metaspaceDecoder{Replacement: "▁", PrependScheme: "always", Split: true}
+	case "BPEDecoder":
+		d = &bpeDecoder{Suffix: "</w>"}
+	case "Replace":
+		d = &replaceDecoder{}
+	case "ByteFallback":
+		d = &byteFallbackDecoder{}
+	case "Fuse":
+		d = &fuseDecoder{}
+	case "Strip":
+		d = &stripDecoder{}
+	default:
+		return nil, errors.Errorf("decoder type %q not supported", typeName)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, d)
+	}
+	if err == nil {
+		if initializer, ok := d.(interface{ init() error }); ok {
+			err = initializer.init()
+		}
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to parse decoder %q", typeName)
+	}
+	return d, nil
+}
+
+// sequenceDecoder applies a sequence of decoders.
+type sequenceDecoder struct {
+	Type     string    `json:"type"`
+	Decoders []decoder `json:"decoders"`
+}
+
+func (d *sequenceDecoder) decodeChain(tokens []string) []string {
+	for _, sub := range d.Decoders {
+		tokens = sub.decodeChain(tokens)
+	}
+	return tokens
+}
+
+// byteLevelDecoder reverts the byte-level encoding, see byteToRune.
+type byteLevelDecoder struct {
+	Type string `json:"type"`
+}
+
+func (d *byteLevelDecoder) decodeChain(tokens []string) []string {
+	return []string{strings.ToValidUTF8(byteLevelDecode(strings.Join(tokens, "")), "�")}
+}
+
+// wordPieceDecoder joins the tokens with spaces, except the ones starting with Prefix, which are appended to the
+// previous token.
+type wordPieceDecoder struct {
+	Type    string `json:"type"`
+	Prefix  string `json:"prefix"`
+	Cleanup bool   `json:"cleanup"`
+}
+
+func (d *wordPieceDecoder) decodeChain(tokens []string) []string {
+	decoded := make([]string, len(tokens))
+	for ii, token := range tokens {
+		if ii > 0 {
+			if strings.HasPrefix(token, d.Prefix) {
+				token = strings.TrimPrefix(token, d.Prefix)
+			} else {
+				token = " " + token
+			}
+		}
+		if d.Cleanup {
+			token = cleanupTokenization(token)
+		}
+		decoded[ii] = token
+	}
+	return decoded
+}
+
+// cleanupTokenizationReplacer removes the spaces before punctuation and contractions.
+var cleanupTokenizationReplacer = strings.NewReplacer(
+	" .", ".", " ?", "?", " !", "!", " ,", ",", " ' ", "'", " n't", "n't", " 'm", "'m", " 's", "'s",
+	" 've", "'ve", " 're", "'re")
+
+// cleanupTokenization removes the spaces before punctuation and English contractions.
+func cleanupTokenization(text string) string {
+	return cleanupTokenizationReplacer.Replace(text)
+}
+
+// metaspaceDecoder reverts the metaspace pre-tokenization, see metaspacePreTokenizer.
+type metaspaceDecoder struct {
+	Type           string `json:"type"`
+	Replacement    string `json:"replacement"`
+	PrependScheme  string `json:"prepend_scheme"`
+	Split          bool   `json:"split"`
+	AddPrefixSpace *bool  `json:"add_prefix_space,omitempty"`
+}
+
+func (d *metaspaceDecoder) init() error {
+	if d.AddPrefixSpace != nil {
+		if !*d.AddPrefixSpace {
+			d.PrependScheme = "never"
+		}
+		d.AddPrefixSpace = nil
+	}
+	return nil
+}
+
+func (d *metaspaceDecoder) decodeChain(tokens []string) []string {
+	return metaspaceDecode(tokens, d.Replacement, d.PrependScheme)
+}
+
+// bpeDecoder replaces the end-of-word suffix by spaces.
+type bpeDecoder struct {
+	Type   string `json:"type"`
+	Suffix string `json:"suffix"`
+}
+
+func (d *bpeDecoder) decodeChain(tokens []string) []string {
+	decoded := make([]string, len(tokens))
+	for ii, token := range tokens {
+		replacement := " "
+		if ii == len(tokens)-1 {
+			replacement = ""
+		}
+		decoded[ii] = strings.ReplaceAll(token, d.Suffix, replacement)
+	}
+	return decoded
+}
+
+// replaceDecoder replaces a pattern in each token.
+type replaceDecoder struct {
+	Type    string  `json:"type"`
+	Pattern pattern `json:"pattern"`
+	Content string  `json:"content"`
+
+	matcher *matcher
+}
+
+func (d *replaceDecoder) init() (err error) {
+	d.matcher, err = d.Pattern.compile()
+	return
+}
+
+func (d *replaceDecoder) decodeChain(tokens []string) []string {
+	decoded := make([]string, len(tokens))
+	for ii, token := range tokens {
+		ns := newNormalizedString(token, 0)
+		ns.replaceAll(d.matcher.findAll(token), d.Content)
+		decoded[ii] = ns.normalized
+	}
+	return decoded
+}
+
+// byteFallbackDecoder converts sequences of byte tokens (e.g.: "<0xE2>") back to the text they encode.
+// Invalid UTF-8 sequences are replaced by "�", one per byte.
+type byteFallbackDecoder struct {
+	Type string `json:"type"`
+}
+
+// parseByteFallbackToken returns the byte encoded by a token of the form "<0xXX>".
+func parseByteFallbackToken(token string) (byte, bool) {
+	if len(token) != 6 || !strings.HasPrefix(token, "<0x") || token[5] != '>' {
+		return 0, false
+	}
+	b, err := strconv.ParseUint(token[3:5], 16, 8)
+	if err != nil {
+		return 0, false
+	}
+	return byte(b), true
+}
+
+func (d *byteFallbackDecoder) decodeChain(tokens []string) []string {
+	decoded := make([]string, 0, len(tokens))
+	var pending []byte
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if utf8.Valid(pending) {
+			decoded = append(decoded, string(pending))
+		} else {
+			for range pending {
+				decoded = append(decoded, "�")
+			}
+		}
+		pending = pending[:0]
+	}
+	for _, token := range tokens {
+		if b, ok := parseByteFallbackToken(token); ok {
+			pending = append(pending, b)
+			continue
+		}
+		flush()
+		decoded = append(decoded, token)
+	}
+	flush()
+	return decoded
+}
+
+// fuseDecoder concatenates all tokens into one.
+type fuseDecoder struct {
+	Type string `json:"type"`
+}
+
+func (d *fuseDecoder) decodeChain(tokens []string) []string {
+	return []string{strings.Join(tokens, "")}
+}
+
+// stripDecoder removes up to Start occurrences of Content from the start of each token, and up to Stop
+// occurrences from the end.
+type stripDecoder struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	Start   int    `json:"start"`
+	Stop    int    `json:"stop"`
+}
+
+func (d *stripDecoder) decodeChain(tokens []string) []string {
+	decoded := make([]string, len(tokens))
+	for ii, token := range tokens {
+		for range d.Start {
+			if !strings.HasPrefix(token, d.Content) {
+				break
+			}
+			token = strings.TrimPrefix(token, d.Content)
+		}
+		for range d.Stop {
+			if !strings.HasSuffix(token, d.Content) {
+				break
+			}
+			token = strings.TrimSuffix(token, d.Content)
+		}
+		decoded[ii] = token
+	}
+	return decoded
+}
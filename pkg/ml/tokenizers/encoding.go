@@ -0,0 +1,415 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"slices"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+)
+
+// Encoding is the result of tokenizing a text (or a pair of texts). All its slices have the same length, one entry
+// per token.
+type Encoding struct {
+	// IDs of the tokens.
+	IDs []int
+
+	// TypeIDs are the segment ids of each token: usually 0 for the first sequence and 1 for the second sequence of
+	// a pair, as defined by the post-processor.
+	TypeIDs []int
+
+	// Tokens are the string representation of each token.
+	Tokens []string
+
+	// Offsets are the byte offsets [start, end) of each token in the original text (in the text of its own
+	// sequence, for pairs). Special tokens added by the post-processor and padding have offsets (0, 0).
+	Offsets [][2]int
+
+	// WordIDs are the index of the pre-tokenized "word" each token came from, or -1 for special tokens and padding.
+	WordIDs []int
+
+	// SequenceIDs are 0 for tokens of the first sequence, 1 for the second sequence of a pair, and -1 for special
+	// tokens and padding.
+	SequenceIDs []int
+
+	// SpecialTokensMask is true for special tokens and padding.
+	SpecialTokensMask []bool
+
+	// AttentionMask is false for padding, and true for all the other tokens.
+	AttentionMask []bool
+
+	// Overflowing holds the parts of the sequence that were truncated away, see TruncationParams.
+	Overflowing []*Encoding
+}
+
+// Len returns the number of tokens in the encoding.
+func (e *Encoding) Len() int {
+	return len(e.IDs)
+}
+
+// clone returns a copy of the encoding (without the Overflowing parts).
+func (e *Encoding) clone() *Encoding {
+	return &Encoding{
+		IDs:               slices.Clone(e.IDs),
+		TypeIDs:           slices.Clone(e.TypeIDs),
+		Tokens:            slices.Clone(e.Tokens),
+		Offsets:           slices.Clone(e.Offsets),
+		WordIDs:           slices.Clone(e.WordIDs),
+		SequenceIDs:       slices.Clone(e.SequenceIDs),
+		SpecialTokensMask: slices.Clone(e.SpecialTokensMask),
+		AttentionMask:     slices.Clone(e.AttentionMask),
+	}
+}
+
+// slice returns a new encoding with the tokens [start, end).
+func (e *Encoding) slice(start, end int) *Encoding {
+	return &Encoding{
+		IDs:               slices.Clone(e.IDs[start:end]),
+		TypeIDs:           slices.Clone(e.TypeIDs[start:end]),
+		Tokens:            slices.Clone(e.Tokens[start:end]),
+		Offsets:           slices.Clone(e.Offsets[start:end]),
+		WordIDs:           slices.Clone(e.WordIDs[start:end]),
+		SequenceIDs:       slices.Clone(e.SequenceIDs[start:end]),
+		SpecialTokensMask: slices.Clone(e.SpecialTokensMask[start:end]),
+		AttentionMask:     slices.Clone(e.AttentionMask[start:end]),
+	}
+}
+
+// append concatenates other to the encoding.
+func (e *Encoding) append(other *Encoding) {
+	e.IDs = append(e.IDs, other.IDs...)
+	e.TypeIDs = append(e.TypeIDs, other.TypeIDs...)
+	e.Tokens = append(e.Tokens, other.Tokens...)
+	e.Offsets = append(e.Offsets, other.Offsets...)
+	e.WordIDs = append(e.WordIDs, other.WordIDs...)
+	e.SequenceIDs = append(e.SequenceIDs, other.SequenceIDs...)
+	e.SpecialTokensMask = append(e.SpecialTokensMask, other.SpecialTokensMask...)
+	e.AttentionMask = append(e.AttentionMask, other.AttentionMask...)
+}
+
+// appendToken appends a regular token.
+func (e *Encoding) appendToken(id int, value string, offsets [2]int, wordID, sequenceID int, special bool) {
+	e.IDs = append(e.IDs, id)
+	e.TypeIDs = append(e.TypeIDs, 0)
+	e.Tokens = append(e.Tokens, value)
+	e.Offsets = append(e.Offsets, offsets)
+	e.WordIDs = append(e.WordIDs, wordID)
+	e.SequenceIDs = append(e.SequenceIDs, sequenceID)
+	e.SpecialTokensMask = append(e.SpecialTokensMask, special)
+	e.AttentionMask = append(e.AttentionMask, true)
+}
+
+// appendSpecial appends a special token added by a post-processor.
+func (e *Encoding) appendSpecial(id int, value string, typeID int) {
+	e.appendToken(id, value, [2]int{0, 0}, -1, -1, true)
+	e.TypeIDs[len(e.TypeIDs)-1] = typeID
+}
+
+// Direction of truncation or padding.
+type Direction int
+
+//go:generate enumer -type=Direction -trimprefix=Direction -values -text -json encoding.go
+
+const (
+	// DirectionRight truncates or pads at the end of the sequence.
+	DirectionRight Direction = iota
+
+	// DirectionLeft truncates or pads at the start of the sequence.
+	DirectionLeft
+)
+
+// TruncationStrategy defines how to truncate pairs of sequences.
+type TruncationStrategy int
+
+//go:generate enumer -type=TruncationStrategy -trimprefix=Truncate -values -text -json encoding.go
+
+const (
+	// TruncateLongestFirst removes tokens from the longest sequence of the pair, one at a time.
+	TruncateLongestFirst TruncationStrategy = iota
+
+	// TruncateOnlyFirst only truncates the first sequence.
+	TruncateOnlyFirst
+
+	// TruncateOnlySecond only truncates the second sequence of a pair.
+	TruncateOnlySecond
+)
+
+// TruncationParams configures the truncation of the encoded sequences, see Tokenizer.WithTruncation.
+type TruncationParams struct {
+	// MaxLength is the maximum number of tokens of the encoding, including the special tokens added by the
+	// post-processor.
+	MaxLength int `json:"max_length"`
+
+	// Strategy to truncate pairs of sequences.
+	Strategy TruncationStrategy `json:"strategy"`
+
+	// Stride is the number of tokens repeated between the truncated encoding and each of its Overflowing parts.
+	// It must be smaller than MaxLength.
+	Stride int `json:"stride"`
+
+	// Direction from which to remove tokens.
+	Direction Direction `json:"direction"`
+}
+
+// truncate the encoding to maxLength tokens, and set the remaining parts, with stride tokens repeated, as
+// the Overflowing encodings.
+func (e *Encoding) truncate(maxLength, stride int, direction Direction) {
+	length := e.Len()
+	if maxLength >= length {
+		return
+	}
+	if maxLength == 0 {
+		*e = Encoding{Overflowing: []*Encoding{e.clone()}}
+		return
+	}
+	var parts [][2]int
+	step := maxLength - stride
+	for start := 0; ; start += step {
+		end := min(start+maxLength, length)
+		if direction == DirectionLeft {
+			parts = append(parts, [2]int{length - end, length - start})
+		} else {
+			parts = append(parts, [2]int{start, end})
+		}
+		if end == length {
+			break
+		}
+	}
+	truncated := e.slice(parts[0][0], parts[0][1])
+	for _, part := range parts[1:] {
+		truncated.Overflowing = append(truncated.Overflowing, e.slice(part[0], part[1]))
+	}
+	*e = *truncated
+}
+
+// truncateEncodings truncates the encoding and its optional pair, such that together with numAddedTokens they
+// fit params.MaxLength.
+func truncateEncodings(encoding, pair *Encoding, params *TruncationParams, numAddedTokens int) error {
+	if params.MaxLength > 0 && params.Stride >= params.MaxLength {
+		return errors.Errorf("truncation stride (%d) must be smaller than the max length (%d)",
+			params.Stride, params.MaxLength)
+	}
+	total := encoding.Len() + numAddedTokens
+	if pair != nil {
+		total += pair.Len()
+	}
+	if total <= params.MaxLength {
+		return nil
+	}
+	toRemove := total - params.MaxLength
+	if pair == nil {
+		if toRemove > encoding.Len() {
+			return errors.Errorf("can't truncate sequence to max length %d, there are %d special tokens added",
+				params.MaxLength, numAddedTokens)
+		}
+		encoding.truncate(encoding.Len()-toRemove, params.Stride, params.Direction)
+		return nil
+	}
+	switch params.Strategy {
+	case TruncateLongestFirst:
+		nFirst, nSecond := encoding.Len(), pair.Len()
+		for range toRemove {
+			if nFirst > nSecond {
+				nFirst--
+			} else {
+				nSecond--
+			}
+		}
+		if nSecond < 0 {
+			return errors.Errorf("can't truncate pair of sequences to max length %d, there are %d special tokens added",
+				params.MaxLength, numAddedTokens)
+		}
+		encoding.truncate(nFirst, params.Stride, params.Direction)
+		pair.truncate(nSecond, params.Stride, params.Direction)
+	case TruncateOnlyFirst, TruncateOnlySecond:
+		target := encoding
+		if params.Strategy == TruncateOnlySecond {
+			target = pair
+		}
+		if toRemove >= target.Len() {
+			return errors.Errorf("sequence to truncate (strategy %s) is too short to respect the max length %d",
+				params.Strategy, params.MaxLength)
+		}
+		target.truncate(target.Len()-toRemove, params.Stride, params.Direction)
+	}
+	return nil
+}
+
+// PaddingParams configures the padding of encodings, see Tokenizer.WithPadding.
+type PaddingParams struct {
+	// Length to pad to. If 0, it pads to the longest encoding of the batch.
+	Length int
+
+	// PadToMultipleOf, if > 0, rounds up the padded length to a multiple of this value. Fixed sizes
+	// limit the number of different shapes -- and hence of graph compilations.
+	PadToMultipleOf int
+
+	// PadID, PadTypeID and PadToken are used for the padding tokens.
+	PadID, PadTypeID int
+	PadToken         string
+
+	// Direction to add the padding.
+	Direction Direction
+}
+
+// paddingJSON is the HuggingFace's tokenizer.json representation of PaddingParams.
+type paddingJSON struct {
+	Strategy        json.RawMessage `json:"strategy"`
+	Direction       Direction       `json:"direction"`
+	PadToMultipleOf *int            `json:"pad_to_multiple_of"`
+	PadID           int             `json:"pad_id"`
+	PadTypeID       int             `json:"pad_type_id"`
+	PadToken        string          `json:"pad_token"`
+}
+
+// MarshalJSON implements json.Marshaler, using HuggingFace's tokenizer.json representation.
+func (p *PaddingParams) MarshalJSON() ([]byte, error) {
+	raw := paddingJSON{
+		Strategy:  json.RawMessage(`"BatchLongest"`),
+		Direction: p.Direction,
+		PadID:     p.PadID,
+		PadTypeID: p.PadTypeID,
+		PadToken:  p.PadToken,
+	}
+	if p.Length > 0 {
+		strategy, err := json.Marshal(map[string]int{"Fixed": p.Length})
+		if err != nil {
+			return nil, err
+		}
+		raw.Strategy = strategy
+	}
+	if p.PadToMultipleOf > 0 {
+		raw.PadToMultipleOf = &p.PadToMultipleOf
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, using HuggingFace's tokenizer.json representation.
+func (p *PaddingParams) UnmarshalJSON(data []byte) error {
+	var raw paddingJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*p = PaddingParams{Direction: raw.Direction, PadID: raw.PadID, PadTypeID: raw.PadTypeID, PadToken: raw.PadToken}
+	if raw.PadToMultipleOf != nil {
+		p.PadToMultipleOf = *raw.PadToMultipleOf
+	}
+	if len(raw.Strategy) > 0 && raw.Strategy[0] == '{' {
+		var fixed struct {
+			Fixed int `json:"Fixed"`
+		}
+		if err := json.Unmarshal(raw.Strategy, &fixed); err != nil {
+			return errors.Wrapf(err, "invalid padding strategy %s", raw.Strategy)
+		}
+		p.Length = fixed.Fixed
+	}
+	return nil
+}
+
+// paddedLength returns the length to pad to, given the longest encoding.
+func (p *PaddingParams) paddedLength(longest int) int {
+	length := p.Length
+	if length <= 0 {
+		length = longest
+	}
+	if p.PadToMultipleOf > 0 && length%p.PadToMultipleOf != 0 {
+		length += p.PadToMultipleOf - length%p.PadToMultipleOf
+	}
+	return length
+}
+
+// pad the encoding (and its Overflowing parts) to the given length.
+func (e *Encoding) pad(length int, params *PaddingParams) {
+	for _, overflowing := range e.Overflowing {
+		overflowing.pad(length, params)
+	}
+	n := length - e.Len()
+	if n <= 0 {
+		return
+	}
+	padding := &Encoding{}
+	for range n {
+		padding.appendSpecial(params.PadID, params.PadToken, params.PadTypeID)
+		padding.AttentionMask[len(padding.AttentionMask)-1] = false
+	}
+	if params.Direction == DirectionLeft {
+		padding.append(e)
+		padding.Overflowing = e.Overflowing
+		*e = *padding
+	} else {
+		e.append(padding)
+	}
+}
+
+// checkBatch checks that all encodings have the same length, and returns it.
+func checkBatch(encodings []*Encoding) (length int) {
+	if len(encodings) == 0 {
+		Panicf("empty batch of encodings given")
+	}
+	length = encodings[0].Len()
+	for ii, e := range encodings {
+		if e.Len() != length {
+			Panicf("encodings in the batch have different lengths (#0 has %d tokens, #%d has %d tokens) -- "+
+				"configure the padding of the Tokenizer, see Tokenizer.WithPadding", length, ii, e.Len())
+		}
+	}
+	return
+}
+
+// intsToTensor converts the values of the batch, taken with get, to a tensor shaped [batchSize, length].
+func intsToTensor(encodings []*Encoding, dtype dtypes.DType, get func(e *Encoding) []int) *tensors.Tensor {
+	length := checkBatch(encodings)
+	switch dtype {
+	case dtypes.Int32:
+		flat := make([]int32, 0, len(encodings)*length)
+		for _, e := range encodings {
+			for _, v := range get(e) {
+				flat = append(flat, int32(v))
+			}
+		}
+		return tensors.FromFlatDataAndDimensions(flat, len(encodings), length)
+	case dtypes.Int64:
+		flat := make([]int64, 0, len(encodings)*length)
+		for _, e := range encodings {
+			for _, v := range get(e) {
+				flat = append(flat, int64(v))
+			}
+		}
+		return tensors.FromFlatDataAndDimensions(flat, len(encodings), length)
+	default:
+		Panicf("only Int32 or Int64 dtypes supported for token ids, got %s", dtype)
+	}
+	return nil
+}
+
+// IDsTensor returns the token ids of a batch of encodings as a tensor shaped `[batch_size, sequence_length]`,
+// with the given dtype (Int32 or Int64). It can be fed directly to layers.Embedding.
+//
+// All encodings must have the same length: see Tokenizer.WithPadding.
+func IDsTensor(encodings []*Encoding, dtype dtypes.DType) *tensors.Tensor {
+	return intsToTensor(encodings, dtype, func(e *Encoding) []int { return e.IDs })
+}
+
+// TypeIDsTensor returns the type ids (segment ids) of a batch of encodings as a tensor shaped
+// `[batch_size, sequence_length]`, with the given dtype (Int32 or Int64).
+//
+// All encodings must have the same length: see Tokenizer.WithPadding.
+func TypeIDsTensor(encodings []*Encoding, dtype dtypes.DType) *tensors.Tensor {
+	return intsToTensor(encodings, dtype, func(e *Encoding) []int { return e.TypeIDs })
+}
+
+// AttentionMaskTensor returns the attention masks of a batch of encodings as a Bool tensor shaped
+// `[batch_size, sequence_length]`: true for tokens, false for padding. It can be used as the mask for
+// layers.MultiHeadAttention.
+//
+// All encodings must have the same length: see Tokenizer.WithPadding.
+func AttentionMaskTensor(encodings []*Encoding) *tensors.Tensor {
+	length := checkBatch(encodings)
+	flat := make([]bool, 0, len(encodings)*length)
+	for _, e := range encodings {
+		flat = append(flat, e.AttentionMask...)
+	}
+	return tensors.FromFlatDataAndDimensions(flat, len(encodings), length)
+}
@@ -0,0 +1,159 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// model converts a pre-tokenized "word" to tokens. It holds the vocabulary.
+//
+// It corresponds to the "model" field of the HuggingFace tokenizer.json file.
+type model interface {
+	// tokenize the text (a "word"). The offsets of the returned tokens are relative to the text.
+	tokenize(text string) ([]token, error)
+
+	// tokenToID returns the id of the token in the vocabulary.
+	tokenToID(token string) (int, bool)
+
+	// idToToken returns the token for the given id.
+	idToToken(id int) (string, bool)
+
+	// vocabSize returns the size of the vocabulary.
+	vocabSize() int
+}
+
+// token is a token produced by the model.
+type token struct {
+	id      int
+	value   string
+	offsets [2]int
+}
+
+// parseModel from its JSON description.
+func parseModel(data json.RawMessage) (model, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, errors.New("tokenizer has no model defined")
+	}
+	var header struct {
+		Type   string          `json:"type"`
+		Merges json.RawMessage `json:"merges"`
+		Vocab  json.RawMessage `json:"vocab"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse tokenizer model")
+	}
+	typeName := header.Type
+	if typeName == "" {
+		// Older files don't include the type of the model: infer it from its fields.
+		switch {
+		case len(header.Merges) > 0:
+			typeName = "BPE"
+		case len(header.Vocab) > 0 && header.Vocab[0] == '[':
+			typeName = "Unigram"
+		default:
+			typeName = "WordPiece"
+		}
+	}
+	var m model
+	switch typeName {
+	case "BPE":
+		m = &bpeModel{Type: typeName}
+	case "WordPiece":
+		m = &wordPieceModel{Type: typeName, UnkToken: "[UNK]", ContinuingSubwordPrefix: "##", MaxInputCharsPerWord: 100}
+	case "Unigram":
+		m = &unigramModel{Type: typeName}
+	default:
+		return nil, errors.Errorf("model type %q not supported", typeName)
+	}
+	err := json.Unmarshal(data, m)
+	if err == nil {
+		err = m.(interface{ init() error }).init()
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to parse model %q", typeName)
+	}
+	return m, nil
+}
+
+// vocabIndex builds the reverse index of a vocabulary.
+func vocabIndex(vocab map[string]int) map[int]string {
+	index := make(map[int]string, len(vocab))
+	for t, id := range vocab {
+		index[id] = t
+	}
+	return index
+}
+
+// byteFallbackToken returns the token used for the byte b with "byte fallback", e.g.: "<0x0A>".
+func byteFallbackToken(b byte) string {
+	return fmt.Sprintf("<0x%02X>", b)
+}
+
+// wordPieceModel implements the WordPiece model used by BERT: each word is greedily split in the longest
+// tokens found in the vocabulary, with the tokens that don't start a word prefixed by ContinuingSubwordPrefix.
+type wordPieceModel struct {
+	Type                    string         `json:"type"`
+	UnkToken                string         `json:"unk_token"`
+	ContinuingSubwordPrefix string         `json:"continuing_subword_prefix"`
+	MaxInputCharsPerWord    int            `json:"max_input_chars_per_word"`
+	Vocab                   map[string]int `json:"vocab"`
+
+	index map[int]string
+}
+
+func (m *wordPieceModel) init() error {
+	m.index = vocabIndex(m.Vocab)
+	return nil
+}
+
+func (m *wordPieceModel) tokenToID(token string) (int, bool) {
+	id, found := m.Vocab[token]
+	return id, found
+}
+
+func (m *wordPieceModel) idToToken(id int) (string, bool) {
+	t, found := m.index[id]
+	return t, found
+}
+
+func (m *wordPieceModel) vocabSize() int { return len(m.Vocab) }
+
+func (m *wordPieceModel) unknown(text string) ([]token, error) {
+	id, found := m.Vocab[m.UnkToken]
+	if !found {
+		return nil, errors.Errorf("WordPiece unknown token %q is not in the vocabulary", m.UnkToken)
+	}
+	return []token{{id: id, value: m.UnkToken, offsets: [2]int{0, len(text)}}}, nil
+}
+
+func (m *wordPieceModel) tokenize(text string) ([]token, error) {
+	if m.MaxInputCharsPerWord > 0 && utf8.RuneCountInString(text) > m.MaxInputCharsPerWord {
+		return m.unknown(text)
+	}
+	var tokens []token
+	for start := 0; start < len(text); {
+		end := len(text)
+		found := false
+		for end > start {
+			candidate := text[start:end]
+			if start > 0 {
+				candidate = m.ContinuingSubwordPrefix + candidate
+			}
+			if id, ok := m.Vocab[candidate]; ok {
+				tokens = append(tokens, token{id: id, value: candidate, offsets: [2]int{start, end}})
+				found = true
+				break
+			}
+			_, size := utf8.DecodeLastRuneInString(text[start:end])
+			end -= size
+		}
+		if !found {
+			return m.unknown(text)
+		}
+		start = end
+	}
+	return tokens, nil
+}
@@ -0,0 +1,299 @@
+package tokenizers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizedString holds a piece of the input text as it goes through normalization and pre-tokenization,
+// keeping track of the alignment of each of its bytes to the original input, so tokens offsets can be reported
+// with respect to the original input.
+type normalizedString struct {
+	// normalized is the current (transformed) text.
+	normalized string
+
+	// alignments holds for each byte of normalized the range [start, end) of the original input bytes it came from.
+	alignments [][2]int
+}
+
+// newNormalizedString creates a normalizedString for the original text, where the original text starts
+// at the byte offset shift of the full input.
+func newNormalizedString(original string, shift int) *normalizedString {
+	ns := &normalizedString{
+		normalized: original,
+		alignments: make([][2]int, len(original)),
+	}
+	for pos := 0; pos < len(original); {
+		_, size := utf8.DecodeRuneInString(original[pos:])
+		for ii := range size {
+			ns.alignments[pos+ii] = [2]int{shift + pos, shift + pos + size}
+		}
+		pos += size
+	}
+	return ns
+}
+
+// isEmpty returns whether the normalized string is empty.
+func (ns *normalizedString) isEmpty() bool {
+	return len(ns.normalized) == 0
+}
+
+// span returns the range of the original input covered by the bytes [start, end) of the normalized string.
+func (ns *normalizedString) span(start, end int) [2]int {
+	if start >= end || start >= len(ns.alignments) {
+		if len(ns.alignments) == 0 {
+			return [2]int{0, 0}
+		}
+		if start >= len(ns.alignments) {
+			last := ns.alignments[len(ns.alignments)-1][1]
+			return [2]int{last, last}
+		}
+		return [2]int{ns.alignments[start][0], ns.alignments[start][0]}
+	}
+	return [2]int{ns.alignments[start][0], ns.alignments[end-1][1]}
+}
+
+// slice returns a new normalizedString with the bytes [start, end) of the normalized string.
+func (ns *normalizedString) slice(start, end int) *normalizedString {
+	return &normalizedString{
+		normalized: ns.normalized[start:end],
+		alignments: ns.alignments[start:end:end], // Capacity limited, so appends don't overwrite other slices.
+	}
+}
+
+// builder is used to construct a transformed normalizedString.
+type normalizedBuilder struct {
+	sb         strings.Builder
+	alignments [][2]int
+}
+
+// write appends text aligned to the given original range.
+func (b *normalizedBuilder) write(text string, alignment [2]int) {
+	b.sb.WriteString(text)
+	for range len(text) {
+		b.alignments = append(b.alignments, alignment)
+	}
+}
+
+// done returns the built normalizedString.
+func (b *normalizedBuilder) done() *normalizedString {
+	return &normalizedString{normalized: b.sb.String(), alignments: b.alignments}
+}
+
+// mapRunes transforms each rune of the normalized string with fn. The returned text (which can be empty, to
+// remove the rune) is aligned to the original range of the rune it replaces.
+func (ns *normalizedString) mapRunes(fn func(r rune) string) {
+	var b normalizedBuilder
+	for pos := 0; pos < len(ns.normalized); {
+		r, size := utf8.DecodeRuneInString(ns.normalized[pos:])
+		b.write(fn(r), ns.span(pos, pos+size))
+		pos += size
+	}
+	*ns = *b.done()
+}
+
+// unicodeNormalize applies the unicode normalization form. Each segment of the text between normalization
+// boundaries is normalized together and aligned to the original range of the segment.
+func (ns *normalizedString) unicodeNormalize(form norm.Form) {
+	if form.IsNormalString(ns.normalized) {
+		return
+	}
+	var b normalizedBuilder
+	text := ns.normalized
+	for pos := 0; pos < len(text); {
+		size := form.NextBoundaryInString(text[pos:], true)
+		if size <= 0 {
+			size = len(text) - pos
+		}
+		b.write(form.String(text[pos:pos+size]), ns.span(pos, pos+size))
+		pos += size
+	}
+	*ns = *b.done()
+}
+
+// replaceAll replaces all matches (sorted ranges of the normalized string) with content, aligned to the range
+// of the match.
+func (ns *normalizedString) replaceAll(matches [][2]int, content string) {
+	if len(matches) == 0 {
+		return
+	}
+	var b normalizedBuilder
+	pos := 0
+	for _, match := range matches {
+		for ii := pos; ii < match[0]; ii++ {
+			b.sb.WriteByte(ns.normalized[ii])
+			b.alignments = append(b.alignments, ns.alignments[ii])
+		}
+		b.write(content, ns.span(match[0], match[1]))
+		pos = match[1]
+	}
+	for ii := pos; ii < len(ns.normalized); ii++ {
+		b.sb.WriteByte(ns.normalized[ii])
+		b.alignments = append(b.alignments, ns.alignments[ii])
+	}
+	*ns = *b.done()
+}
+
+// prepend adds text to the start of the normalized string, aligned to the first character.
+func (ns *normalizedString) prepend(text string) {
+	if ns.isEmpty() {
+		return
+	}
+	alignment := ns.alignments[0]
+	var b normalizedBuilder
+	b.write(text, alignment)
+	b.sb.WriteString(ns.normalized)
+	b.alignments = append(b.alignments, ns.alignments...)
+	*ns = *b.done()
+}
+
+// append adds text to the end of the normalized string, aligned to the last character.
+func (ns *normalizedString) append(text string) {
+	if ns.isEmpty() {
+		return
+	}
+	alignment := ns.alignments[len(ns.alignments)-1]
+	ns.normalized += text
+	for range len(text) {
+		ns.alignments = append(ns.alignments, alignment)
+	}
+}
+
+// strip removes white spaces from the left and/or right of the normalized string.
+func (ns *normalizedString) strip(left, right bool) {
+	start, end := 0, len(ns.normalized)
+	if left {
+		start = len(ns.normalized) - len(strings.TrimLeftFunc(ns.normalized, unicode.IsSpace))
+	}
+	if right {
+		end = len(strings.TrimRightFunc(ns.normalized, unicode.IsSpace))
+	}
+	if end < start {
+		end = start
+	}
+	*ns = *ns.slice(start, end)
+}
+
+// SplitBehavior defines how the delimiters found when splitting a text are handled by the pre-tokenizers.
+type SplitBehavior int
+
+//go:generate enumer -type=SplitBehavior -trimprefix=Split -values -text -json normalized.go
+
+const (
+	// SplitRemoved removes the delimiters.
+	SplitRemoved SplitBehavior = iota
+
+	// SplitIsolated keeps each delimiter as a separate split.
+	SplitIsolated
+
+	// SplitMergedWithPrevious appends each delimiter to the previous split.
+	SplitMergedWithPrevious
+
+	// SplitMergedWithNext prepends each delimiter to the next split.
+	SplitMergedWithNext
+
+	// SplitContiguous keeps consecutive delimiters together as one split.
+	SplitContiguous
+)
+
+// split the normalized string according to the delimiters given by the matches (ranges of bytes of the
+// normalized string, sorted and not overlapping) and the behavior.
+func (ns *normalizedString) split(matches [][2]int, behavior SplitBehavior) []*normalizedString {
+	if len(matches) == 0 {
+		if ns.isEmpty() {
+			return nil
+		}
+		return []*normalizedString{ns}
+	}
+
+	// Merge contiguous delimiters if requested.
+	if behavior == SplitContiguous {
+		merged := make([][2]int, 0, len(matches))
+		for _, match := range matches {
+			if len(merged) > 0 && merged[len(merged)-1][1] == match[0] {
+				merged[len(merged)-1][1] = match[1]
+				continue
+			}
+			merged = append(merged, match)
+		}
+		matches = merged
+		behavior = SplitIsolated
+	}
+
+	// Pieces are given as ranges of the normalized string.
+	var pieces [][2]int
+	pos := 0
+	pendingStart := -1 // Used by SplitMergedWithNext.
+	for _, match := range matches {
+		if match[0] > pos {
+			start := pos
+			if pendingStart >= 0 {
+				start = pendingStart
+				pendingStart = -1
+			}
+			pieces = append(pieces, [2]int{start, match[0]})
+		}
+		switch behavior {
+		case SplitRemoved:
+		case SplitIsolated:
+			pieces = append(pieces, match)
+		case SplitMergedWithPrevious:
+			if len(pieces) > 0 && pieces[len(pieces)-1][1] == match[0] {
+				pieces[len(pieces)-1][1] = match[1]
+			} else {
+				pieces = append(pieces, match)
+			}
+		case SplitMergedWithNext:
+			if pendingStart >= 0 {
+				pieces = append(pieces, [2]int{pendingStart, match[0]})
+			}
+			pendingStart = match[0]
+		}
+		pos = match[1]
+	}
+	if pos < len(ns.normalized) || pendingStart >= 0 {
+		start := pos
+		if pendingStart >= 0 {
+			start = pendingStart
+		}
+		pieces = append(pieces, [2]int{start, len(ns.normalized)})
+	}
+
+	splits := make([]*normalizedString, 0, len(pieces))
+	for _, piece := range pieces {
+		if piece[1] > piece[0] {
+			splits = append(splits, ns.slice(piece[0], piece[1]))
+		}
+	}
+	return splits
+}
+
+// invertMatches returns the ranges of the text not covered by matches.
+func invertMatches(matches [][2]int, length int) (inverted [][2]int) {
+	pos := 0
+	for _, match := range matches {
+		if match[0] > pos {
+			inverted = append(inverted, [2]int{pos, match[0]})
+		}
+		pos = match[1]
+	}
+	if pos < length {
+		inverted = append(inverted, [2]int{pos, length})
+	}
+	return
+}
+
+// runeMatches returns the ranges of each of the runes of text for which fn returns true.
+func runeMatches(text string, fn func(r rune) bool) (matches [][2]int) {
+	for pos := 0; pos < len(text); {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		if fn(r) {
+			matches = append(matches, [2]int{pos, pos + size})
+		}
+		pos += size
+	}
+	return
+}
@@ -0,0 +1,291 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizer transforms the input text before it is pre-tokenized, e.g.: unicode normalization, lower-casing, etc.
+//
+// It corresponds to the "normalizer" field of the HuggingFace tokenizer.json file.
+type normalizer interface {
+	normalize(ns *normalizedString)
+}
+
+// parseNormalizer from its JSON description. It returns nil for a JSON null.
+func parseNormalizer(data json.RawMessage) (normalizer, error) {
+	typeName, err := componentType(data)
+	if err != nil || typeName == "" {
+		return nil, err
+	}
+	var n normalizer
+	switch typeName {
+	case "Sequence":
+		var raw struct {
+			Normalizers []json.RawMessage `json:"normalizers"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		seq := &sequenceNormalizer{Type: typeName}
+		for _, rawSub := range raw.Normalizers {
+			var sub normalizer
+			sub, err = parseNormalizer(rawSub)
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				seq.Normalizers = append(seq.Normalizers, sub)
+			}
+		}
+		return seq, nil
+	case "NFC", "NFD", "NFKC", "NFKD":
+		n = &unicodeNormalizer{Type: typeName}
+	case "Precompiled":
+		// The SentencePiece precompiled character maps are mostly NFKC normalization.
+		n = &precompiledNormalizer{}
+	case "BertNormalizer":
+		n = &bertNormalizer{CleanText: true, HandleChineseChars: true, Lowercase: true}
+	case "Lowercase":
+		n = &lowercaseNormalizer{}
+	case "Strip":
+		n = &stripNormalizer{StripLeft: true, StripRight: true}
+	case "StripAccents":
+		n = &stripAccentsNormalizer{}
+	case "Replace":
+		n = &replaceNormalizer{}
+	case "Prepend":
+		n = &prependNormalizer{}
+	case "ByteLevel":
+		n = &byteLevelNormalizer{}
+	default:
+		return nil, errors.Errorf("normalizer type %q not supported", typeName)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, n)
+	}
+	if err == nil {
+		if initializer, ok := n.(interface{ init() error }); ok {
+			err = initializer.init()
+		}
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to parse normalizer %q", typeName)
+	}
+	return n, nil
+}
+
+// componentType returns the "type" field of a tokenizer component. It returns "" if data is a JSON null.
+func componentType(data json.RawMessage) (string, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return "", nil
+	}
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", errors.Wrapf(err, "failed to parse tokenizer component")
+	}
+	if header.Type == "" {
+		return "", errors.Errorf("tokenizer component has no \"type\" field: %s", data)
+	}
+	return header.Type, nil
+}
+
+// sequenceNormalizer applies a sequence of normalizers.
+type sequenceNormalizer struct {
+	Type        string       `json:"type"`
+	Normalizers []normalizer `json:"normalizers"`
+}
+
+func (n *sequenceNormalizer) normalize(ns *normalizedString) {
+	for _, sub := range n.Normalizers {
+		sub.normalize(ns)
+	}
+}
+
+// unicodeNormalizer applies one of the unicode normalization forms: NFC, NFD, NFKC or NFKD.
+type unicodeNormalizer struct {
+	Type string `json:"type"`
+}
+
+func (n *unicodeNormalizer) normalize(ns *normalizedString) {
+	switch n.Type {
+	case "NFC":
+		ns.unicodeNormalize(norm.NFC)
+	case "NFD":
+		ns.unicodeNormalize(norm.NFD)
+	case "NFKC":
+		ns.unicodeNormalize(norm.NFKC)
+	case "NFKD":
+		ns.unicodeNormalize(norm.NFKD)
+	}
+}
+
+// precompiledNormalizer approximates SentencePiece's precompiled normalization (by default "nmt_nfkc") with
+// NFKC normalization and the removal of control characters.
+type precompiledNormalizer struct {
+	Type                string `json:"type"`
+	PrecompiledCharsmap string `json:"precompiled_charsmap"`
+}
+
+func (n *precompiledNormalizer) normalize(ns *normalizedString) {
+	ns.mapRunes(func(r rune) string {
+		if r != '\t' && r != '\n' && r != '\r' && unicode.IsControl(r) {
+			return ""
+		}
+		if unicode.IsSpace(r) {
+			return " "
+		}
+		return string(r)
+	})
+	ns.unicodeNormalize(norm.NFKC)
+}
+
+// bertNormalizer implements the normalization used by BERT.
+type bertNormalizer struct {
+	Type               string `json:"type"`
+	CleanText          bool   `json:"clean_text"`
+	HandleChineseChars bool   `json:"handle_chinese_chars"`
+	StripAccents       *bool  `json:"strip_accents"`
+	Lowercase          bool   `json:"lowercase"`
+}
+
+func (n *bertNormalizer) normalize(ns *normalizedString) {
+	if n.CleanText {
+		ns.mapRunes(func(r rune) string {
+			if r == 0 || r == 0xFFFD || isBertControl(r) {
+				return ""
+			}
+			if isBertWhitespace(r) {
+				return " "
+			}
+			return string(r)
+		})
+	}
+	if n.HandleChineseChars {
+		ns.mapRunes(func(r rune) string {
+			if isChineseChar(r) {
+				return " " + string(r) + " "
+			}
+			return string(r)
+		})
+	}
+	if (n.StripAccents == nil && n.Lowercase) || (n.StripAccents != nil && *n.StripAccents) {
+		stripAccents(ns)
+	}
+	if n.Lowercase {
+		ns.mapRunes(func(r rune) string { return strings.ToLower(string(r)) })
+	}
+}
+
+// isBertWhitespace returns whether r is considered a whitespace by BERT.
+func isBertWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || unicode.Is(unicode.Zs, r)
+}
+
+// isBertControl returns whether r is considered a control character by BERT.
+func isBertControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs)
+}
+
+// isChineseChar returns whether r is in one of the CJK unified ideographs blocks.
+func isChineseChar(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B820 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
+
+// stripAccents decomposes the text (NFD) and removes the combining marks.
+func stripAccents(ns *normalizedString) {
+	ns.unicodeNormalize(norm.NFD)
+	ns.mapRunes(func(r rune) string {
+		if unicode.Is(unicode.Mn, r) {
+			return ""
+		}
+		return string(r)
+	})
+}
+
+// lowercaseNormalizer converts the text to lower case.
+type lowercaseNormalizer struct {
+	Type string `json:"type"`
+}
+
+func (n *lowercaseNormalizer) normalize(ns *normalizedString) {
+	ns.mapRunes(func(r rune) string { return strings.ToLower(string(r)) })
+}
+
+// stripNormalizer removes the white spaces at the start and/or end of the text.
+type stripNormalizer struct {
+	Type       string `json:"type"`
+	StripLeft  bool   `json:"strip_left"`
+	StripRight bool   `json:"strip_right"`
+}
+
+func (n *stripNormalizer) normalize(ns *normalizedString) {
+	ns.strip(n.StripLeft, n.StripRight)
+}
+
+// stripAccentsNormalizer removes the combining marks (accents). It is usually used after NFD normalization.
+type stripAccentsNormalizer struct {
+	Type string `json:"type"`
+}
+
+func (n *stripAccentsNormalizer) normalize(ns *normalizedString) {
+	ns.mapRunes(func(r rune) string {
+		if unicode.Is(unicode.Mn, r) {
+			return ""
+		}
+		return string(r)
+	})
+}
+
+// replaceNormalizer replaces all occurrences of a pattern by a content.
+type replaceNormalizer struct {
+	Type    string  `json:"type"`
+	Pattern pattern `json:"pattern"`
+	Content string  `json:"content"`
+
+	matcher *matcher
+}
+
+func (n *replaceNormalizer) init() (err error) {
+	n.matcher, err = n.Pattern.compile()
+	return
+}
+
+func (n *replaceNormalizer) normalize(ns *normalizedString) {
+	ns.replaceAll(n.matcher.findAll(ns.normalized), n.Content)
+}
+
+// prependNormalizer adds a prefix to the text.
+type prependNormalizer struct {
+	Type    string `json:"type"`
+	Prepend string `json:"prepend"`
+}
+
+func (n *prependNormalizer) normalize(ns *normalizedString) {
+	ns.prepend(n.Prepend)
+}
+
+// byteLevelNormalizer converts each byte to a printable unicode character, see byteToRune.
+type byteLevelNormalizer struct {
+	Type string `json:"type"`
+}
+
+func (n *byteLevelNormalizer) normalize(ns *normalizedString) {
+	byteLevelEncode(ns)
+}
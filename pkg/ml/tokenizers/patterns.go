@@ -0,0 +1,105 @@
+package tokenizers
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// pattern used by some components, it is either a literal string or a regular expression.
+type pattern struct {
+	String *string `json:"String,omitempty"`
+	Regex  *string `json:"Regex,omitempty"`
+}
+
+// whitespaceLookahead is the regular expression idiom used by most byte-level BPE tokenizers to leave the
+// last space of a sequence of spaces to be merged with the following word.
+const whitespaceLookahead = `\s+(?!\S)`
+
+// compile the pattern to a matcher.
+//
+// Go regular expressions don't support look-ahead. The idiom `\s+(?!\S)`, used by most byte-level BPE
+// tokenizers as one of the top-level alternatives, is emulated by the matcher. Other uses of look-ahead,
+// or other unsupported syntax, return an error.
+func (p pattern) compile() (*matcher, error) {
+	m := &matcher{}
+	var err error
+	switch {
+	case p.String != nil:
+		m.re, err = regexp.Compile(regexp.QuoteMeta(*p.String))
+	case p.Regex != nil:
+		expr := *p.Regex
+		if idx := strings.Index(expr, whitespaceLookahead); idx >= 0 {
+			prefix := strings.TrimSuffix(expr[:idx], "|")
+			expr = strings.ReplaceAll(expr, whitespaceLookahead+"|", "")
+			expr = strings.ReplaceAll(expr, "|"+whitespaceLookahead, "")
+			if prefix != "" {
+				m.prefixRe, err = regexp.Compile("^(?:" + prefix + ")")
+			}
+			m.emulateLookahead = true
+		}
+		if err == nil {
+			m.re, err = regexp.Compile(expr)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "regular expression %q not supported by Go's regexp package", *p.Regex)
+		}
+	default:
+		err = errors.New("pattern must define either \"String\" or \"Regex\"")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// matcher finds the matches of a pattern.
+type matcher struct {
+	re *regexp.Regexp
+
+	// emulateLookahead is set if the `\s+(?!\S)` alternative was removed from the regular expression, and
+	// prefixRe matches the alternatives that preceded it.
+	emulateLookahead bool
+	prefixRe         *regexp.Regexp
+}
+
+// findAll returns the sorted ranges of all non-empty matches in text.
+func (m *matcher) findAll(text string) (matches [][2]int) {
+	if !m.emulateLookahead {
+		for _, match := range m.re.FindAllStringIndex(text, -1) {
+			if match[1] > match[0] {
+				matches = append(matches, [2]int{match[0], match[1]})
+			}
+		}
+		return
+	}
+	for pos := 0; pos < len(text); {
+		loc := m.re.FindStringIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if end == start {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+			continue
+		}
+		// Emulate `\s+(?!\S)`: a sequence of spaces followed by a non-space leaves its last space out, as long as
+		// the match didn't come from one of the preceding alternatives.
+		if end < len(text) && strings.TrimFunc(text[start:end], unicode.IsSpace) == "" &&
+			(m.prefixRe == nil || !m.prefixRe.MatchString(text[start:])) {
+			if next, _ := utf8.DecodeRuneInString(text[end:]); !unicode.IsSpace(next) {
+				_, lastSize := utf8.DecodeLastRuneInString(text[start:end])
+				if end-lastSize > start {
+					end -= lastSize
+				}
+			}
+		}
+		matches = append(matches, [2]int{start, end})
+		pos = end
+	}
+	return
+}
@@ -0,0 +1,306 @@
+package tokenizers
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// postProcessor adds the special tokens (e.g.: "[CLS]" and "[SEP]") to the encoded sequences, and merges
+// the pair of sequences, if one is given.
+//
+// It corresponds to the "post_processor" field of the HuggingFace tokenizer.json file.
+type postProcessor interface {
+	// numAddedTokens returns the number of special tokens added to a single sequence or to a pair.
+	numAddedTokens(isPair bool) int
+
+	// process the encoding, and the optional pair (it can be nil). It returns the merged encoding.
+	process(encoding, pair *Encoding) *Encoding
+
+	// trimsOffsets returns whether the offsets of the tokens should be trimmed of white spaces.
+	trimsOffsets() bool
+}
+
+// parsePostProcessor from its JSON description. It returns nil for a JSON null.
+func parsePostProcessor(data json.RawMessage) (postProcessor, error) {
+	typeName, err := componentType(data)
+	if err != nil || typeName == "" {
+		return nil, err
+	}
+	var p postProcessor
+	switch typeName {
+	case "Sequence":
+		var raw struct {
+			Processors []json.RawMessage `json:"processors"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		seq := &sequencePostProcessor{Type: typeName}
+		for _, rawSub := range raw.Processors {
+			var sub postProcessor
+			sub, err = parsePostProcessor(rawSub)
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				seq.Processors = append(seq.Processors, sub)
+			}
+		}
+		return seq, nil
+	case "TemplateProcessing":
+		p = &templateProcessing{}
+	case "BertProcessing":
+		p = &bertProcessing{}
+	case "RobertaProcessing":
+		p = &robertaProcessing{TrimOffsets: true, AddPrefixSpace: true}
+	case "ByteLevel":
+		p = &byteLevelPostProcessor{TrimOffsets: true}
+	default:
+		return nil, errors.Errorf("post-processor type %q not supported", typeName)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, p)
+	}
+	if err == nil {
+		if initializer, ok := p.(interface{ init() error }); ok {
+			err = initializer.init()
+		}
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to parse post-processor %q", typeName)
+	}
+	return p, nil
+}
+
+// mergeEncodings concatenates the pair to the encoding, if it is not nil.
+func mergeEncodings(encoding, pair *Encoding) *Encoding {
+	if pair == nil {
+		return encoding
+	}
+	merged := encoding.clone()
+	merged.append(pair)
+	return merged
+}
+
+// sequencePostProcessor applies a sequence of post-processors.
+type sequencePostProcessor struct {
+	Type       string          `json:"type"`
+	Processors []postProcessor `json:"processors"`
+}
+
+func (p *sequencePostProcessor) numAddedTokens(isPair bool) (count int) {
+	for _, sub := range p.Processors {
+		count += sub.numAddedTokens(isPair)
+	}
+	return
+}
+
+func (p *sequencePostProcessor) process(encoding, pair *Encoding) *Encoding {
+	// Only the last processor merges the pair, the others only transform each sequence individually.
+	for ii, sub := range p.Processors {
+		if ii == len(p.Processors)-1 {
+			return sub.process(encoding, pair)
+		}
+		encoding = sub.process(encoding, nil)
+		if pair != nil {
+			pair = sub.process(pair, nil)
+		}
+	}
+	return mergeEncodings(encoding, pair)
+}
+
+func (p *sequencePostProcessor) trimsOffsets() bool {
+	for _, sub := range p.Processors {
+		if sub.trimsOffsets() {
+			return true
+		}
+	}
+	return false
+}
+
+// templatePiece is either a special token or one of the sequences ("A" or "B") in a template.
+type templatePiece struct {
+	SpecialToken *templatePieceID `json:"SpecialToken,omitempty"`
+	Sequence     *templatePieceID `json:"Sequence,omitempty"`
+}
+
+// templatePieceID identifies the special token or the sequence of a templatePiece, and its type id.
+type templatePieceID struct {
+	ID     string `json:"id"`
+	TypeID int    `json:"type_id"`
+}
+
+// templateSpecialToken defines the ids (and tokens) of a special token used by a template.
+type templateSpecialToken struct {
+	ID     string   `json:"id"`
+	IDs    []int    `json:"ids"`
+	Tokens []string `json:"tokens"`
+}
+
+// templateProcessing defines templates with the special tokens for single sequences and for pairs.
+type templateProcessing struct {
+	Type          string                           `json:"type"`
+	Single        []templatePiece                  `json:"single"`
+	Pair          []templatePiece                  `json:"pair"`
+	SpecialTokens map[string]*templateSpecialToken `json:"special_tokens"`
+}
+
+func (p *templateProcessing) init() error {
+	for _, template := range [][]templatePiece{p.Single, p.Pair} {
+		for _, piece := range template {
+			if piece.SpecialToken != nil {
+				special, found := p.SpecialTokens[piece.SpecialToken.ID]
+				if !found {
+					return errors.Errorf("TemplateProcessing special token %q is not defined", piece.SpecialToken.ID)
+				}
+				if len(special.IDs) != len(special.Tokens) {
+					return errors.Errorf("TemplateProcessing special token %q has %d ids but %d tokens",
+						special.ID, len(special.IDs), len(special.Tokens))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *templateProcessing) numAddedTokens(isPair bool) (count int) {
+	template := p.Single
+	if isPair {
+		template = p.Pair
+	}
+	for _, piece := range template {
+		if piece.SpecialToken != nil {
+			count += len(p.SpecialTokens[piece.SpecialToken.ID].IDs)
+		}
+	}
+	return
+}
+
+func (p *templateProcessing) process(encoding, pair *Encoding) *Encoding {
+	template := p.Single
+	if pair != nil {
+		template = p.Pair
+	}
+	result := &Encoding{}
+	for _, piece := range template {
+		if piece.SpecialToken != nil {
+			special := p.SpecialTokens[piece.SpecialToken.ID]
+			for ii, id := range special.IDs {
+				result.appendSpecial(id, special.Tokens[ii], piece.SpecialToken.TypeID)
+			}
+			continue
+		}
+		seq := encoding
+		if piece.Sequence.ID == "B" {
+			seq = pair
+		}
+		if seq == nil {
+			continue
+		}
+		seq = seq.clone()
+		for ii := range seq.TypeIDs {
+			seq.TypeIDs[ii] = piece.Sequence.TypeID
+		}
+		result.append(seq)
+	}
+	return result
+}
+
+func (p *templateProcessing) trimsOffsets() bool { return false }
+
+// newTemplateProcessing creates a templateProcessing for templates of the form "cls A sep" and
+// "cls A sep [sep] B sep" (the extra separator is used by RoBERTa), with the given type id for B.
+func newTemplateProcessing(cls, sep [2]any, extraSep bool, pairTypeID int) (*templateProcessing, error) {
+	clsToken, ok1 := cls[0].(string)
+	sepToken, ok2 := sep[0].(string)
+	clsID, ok3 := cls[1].(float64)
+	sepID, ok4 := sep[1].(float64)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.Errorf("invalid special tokens definitions %v and %v, expected [token, id]", cls, sep)
+	}
+	special := func(token string) templatePiece {
+		return templatePiece{SpecialToken: &templatePieceID{ID: token}}
+	}
+	p := &templateProcessing{
+		Type: "TemplateProcessing",
+		Single: []templatePiece{
+			special(clsToken), {Sequence: &templatePieceID{ID: "A"}}, special(sepToken),
+		},
+		SpecialTokens: map[string]*templateSpecialToken{
+			clsToken: {ID: clsToken, IDs: []int{int(clsID)}, Tokens: []string{clsToken}},
+			sepToken: {ID: sepToken, IDs: []int{int(sepID)}, Tokens: []string{sepToken}},
+		},
+	}
+	p.Pair = append(p.Pair, p.Single...)
+	if extraSep {
+		p.Pair = append(p.Pair, templatePiece{SpecialToken: &templatePieceID{ID: sepToken, TypeID: pairTypeID}})
+	}
+	p.Pair = append(p.Pair,
+		templatePiece{Sequence: &templatePieceID{ID: "B", TypeID: pairTypeID}},
+		templatePiece{SpecialToken: &templatePieceID{ID: sepToken, TypeID: pairTypeID}})
+	return p, nil
+}
+
+// bertProcessing adds the BERT special tokens: "[CLS] A [SEP]" or "[CLS] A [SEP] B [SEP]", with type id 1 for B.
+type bertProcessing struct {
+	Type string `json:"type"`
+	Sep  [2]any `json:"sep"`
+	Cls  [2]any `json:"cls"`
+
+	template *templateProcessing
+}
+
+func (p *bertProcessing) init() (err error) {
+	p.template, err = newTemplateProcessing(p.Cls, p.Sep, false, 1)
+	return
+}
+
+func (p *bertProcessing) numAddedTokens(isPair bool) int { return p.template.numAddedTokens(isPair) }
+
+func (p *bertProcessing) process(encoding, pair *Encoding) *Encoding {
+	return p.template.process(encoding, pair)
+}
+
+func (p *bertProcessing) trimsOffsets() bool { return false }
+
+// robertaProcessing adds the RoBERTa special tokens: "<s> A </s>" or "<s> A </s> </s> B </s>", all with type id 0.
+type robertaProcessing struct {
+	Type           string `json:"type"`
+	Sep            [2]any `json:"sep"`
+	Cls            [2]any `json:"cls"`
+	TrimOffsets    bool   `json:"trim_offsets"`
+	AddPrefixSpace bool   `json:"add_prefix_space"`
+
+	template *templateProcessing
+}
+
+func (p *robertaProcessing) init() (err error) {
+	p.template, err = newTemplateProcessing(p.Cls, p.Sep, true, 0)
+	return
+}
+
+func (p *robertaProcessing) numAddedTokens(isPair bool) int { return p.template.numAddedTokens(isPair) }
+
+func (p *robertaProcessing) process(encoding, pair *Encoding) *Encoding {
+	return p.template.process(encoding, pair)
+}
+
+func (p *robertaProcessing) trimsOffsets() bool { return p.TrimOffsets }
+
+// byteLevelPostProcessor trims the white spaces from the offsets of the tokens, and otherwise simply merges
+// the pair of sequences.
+type byteLevelPostProcessor struct {
+	Type           string `json:"type"`
+	AddPrefixSpace bool   `json:"add_prefix_space"`
+	TrimOffsets    bool   `json:"trim_offsets"`
+	UseRegex       bool   `json:"use_regex"`
+}
+
+func (p *byteLevelPostProcessor) numAddedTokens(bool) int { return 0 }
+
+func (p *byteLevelPostProcessor) process(encoding, pair *Encoding) *Encoding {
+	return mergeEncodings(encoding, pair)
+}
+
+func (p *byteLevelPostProcessor) trimsOffsets() bool { return p.TrimOffsets }
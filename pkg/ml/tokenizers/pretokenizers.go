@@ -0,0 +1,300 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// preTokenizer splits the normalized text into "words", that are then tokenized independently by the model.
+//
+// It corresponds to the "pre_tokenizer" field of the HuggingFace tokenizer.json file.
+type preTokenizer interface {
+	// splitOne splits one piece of text.
+	splitOne(ns *normalizedString) []*normalizedString
+}
+
+// preTokenize applies the pre-tokenizer to each of the splits, and returns the concatenated results.
+func preTokenize(p preTokenizer, splits []*normalizedString) []*normalizedString {
+	results := make([]*normalizedString, 0, len(splits))
+	for _, split := range splits {
+		results = append(results, p.splitOne(split)...)
+	}
+	return results
+}
+
+// parsePreTokenizer from its JSON description. It returns nil for a JSON null.
+func parsePreTokenizer(data json.RawMessage) (preTokenizer, error) {
+	typeName, err := componentType(data)
+	if err != nil || typeName == "" {
+		return nil, err
+	}
+	var p preTokenizer
+	switch typeName {
+	case "Sequence":
+		var raw struct {
+			PreTokenizers []json.RawMessage `json:"pretokenizers"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		seq := &sequencePreTokenizer{Type: typeName}
+		for _, rawSub := range raw.PreTokenizers {
+			var sub preTokenizer
+			sub, err = parsePreTokenizer(rawSub)
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				seq.PreTokenizers = append(seq.PreTokenizers, sub)
+			}
+		}
+		return seq, nil
+	case "Whitespace":
+		p = &whitespacePreTokenizer{}
+	case "WhitespaceSplit":
+		p = &whitespaceSplitPreTokenizer{}
+	case "BertPreTokenizer":
+		p = &bertPreTokenizer{}
+	case "Punctuation":
+		p = &punctuationPreTokenizer{Behavior: SplitIsolated}
+	case "Digits":
+		p = &digitsPreTokenizer{}
+	case "CharDelimiterSplit":
+		p = &charDelimiterPreTokenizer{}
+	case "Metaspace":
+		p = &metaspacePreTokenizer{Replacement: "▁", PrependScheme: "always", Split: true}
+	case "ByteLevel":
+		p = &byteLevelPreTokenizer{AddPrefixSpace: true, TrimOffsets: true, UseRegex: true}
+	case "Split":
+		p = &splitPreTokenizer{}
+	default:
+		return nil, errors.Errorf("pre-tokenizer type %q not supported", typeName)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, p)
+	}
+	if err == nil {
+		if initializer, ok := p.(interface{ init() error }); ok {
+			err = initializer.init()
+		}
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to parse pre-tokenizer %q", typeName)
+	}
+	return p, nil
+}
+
+// sequencePreTokenizer applies a sequence of pre-tokenizers.
+type sequencePreTokenizer struct {
+	Type          string         `json:"type"`
+	PreTokenizers []preTokenizer `json:"pretokenizers"`
+}
+
+func (p *sequencePreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	splits := []*normalizedString{ns}
+	for _, sub := range p.PreTokenizers {
+		splits = preTokenize(sub, splits)
+	}
+	return splits
+}
+
+// whitespaceRegexp is the unicode version of `\w+|[^\w\s]+`.
+var whitespaceRegexp = regexp.MustCompile(`[\p{L}\p{N}\p{M}_]+|[^\p{L}\p{N}\p{M}_\s\p{Z}]+`)
+
+// whitespacePreTokenizer splits words and sequences of punctuation, removing the white spaces.
+type whitespacePreTokenizer struct {
+	Type string `json:"type"`
+}
+
+func (p *whitespacePreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	var matches [][2]int
+	for _, match := range whitespaceRegexp.FindAllStringIndex(ns.normalized, -1) {
+		matches = append(matches, [2]int{match[0], match[1]})
+	}
+	return ns.split(invertMatches(matches, len(ns.normalized)), SplitRemoved)
+}
+
+// whitespaceSplitPreTokenizer splits on white spaces, removing them.
+type whitespaceSplitPreTokenizer struct {
+	Type string `json:"type"`
+}
+
+func (p *whitespaceSplitPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	return ns.split(runeMatches(ns.normalized, unicode.IsSpace), SplitRemoved)
+}
+
+// isBertPunctuation returns whether r is considered a punctuation by BERT: all non-letter/number ASCII symbols
+// are included.
+func isBertPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// bertPreTokenizer splits on white spaces (removed) and punctuation (isolated).
+type bertPreTokenizer struct {
+	Type string `json:"type"`
+}
+
+func (p *bertPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	var splits []*normalizedString
+	for _, word := range ns.split(runeMatches(ns.normalized, isBertWhitespace), SplitRemoved) {
+		splits = append(splits, word.split(runeMatches(word.normalized, isBertPunctuation), SplitIsolated)...)
+	}
+	return splits
+}
+
+// punctuationPreTokenizer splits on punctuation.
+type punctuationPreTokenizer struct {
+	Type     string        `json:"type"`
+	Behavior SplitBehavior `json:"behavior"`
+}
+
+func (p *punctuationPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	return ns.split(runeMatches(ns.normalized, isBertPunctuation), p.Behavior)
+}
+
+// digitsPreTokenizer splits numbers from the rest of the text, optionally splitting each digit individually.
+type digitsPreTokenizer struct {
+	Type             string `json:"type"`
+	IndividualDigits bool   `json:"individual_digits"`
+}
+
+func (p *digitsPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	behavior := SplitContiguous
+	if p.IndividualDigits {
+		behavior = SplitIsolated
+	}
+	return ns.split(runeMatches(ns.normalized, unicode.IsDigit), behavior)
+}
+
+// charDelimiterPreTokenizer splits on a given character, removing it.
+type charDelimiterPreTokenizer struct {
+	Type      string `json:"type"`
+	Delimiter string `json:"delimiter"`
+}
+
+func (p *charDelimiterPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	return ns.split(runeMatches(ns.normalized, func(r rune) bool { return string(r) == p.Delimiter }), SplitRemoved)
+}
+
+// metaspacePreTokenizer replaces spaces by a replacement character (usually "▁"), optionally prepends it
+// to the text, and splits the words keeping the replacement character as a prefix.
+// This is the pre-tokenization used by SentencePiece.
+type metaspacePreTokenizer struct {
+	Type        string `json:"type"`
+	Replacement string `json:"replacement"`
+
+	// PrependScheme is one of "always", "first" (only prepend at the start of the input) or "never".
+	PrependScheme string `json:"prepend_scheme"`
+	Split         bool   `json:"split"`
+
+	// AddPrefixSpace is the legacy version of PrependScheme, only used when reading older files.
+	AddPrefixSpace *bool `json:"add_prefix_space,omitempty"`
+}
+
+func (p *metaspacePreTokenizer) init() error {
+	if p.AddPrefixSpace != nil {
+		if !*p.AddPrefixSpace {
+			p.PrependScheme = "never"
+		}
+		p.AddPrefixSpace = nil
+	}
+	if p.Replacement == "" {
+		return errors.New("Metaspace requires a non-empty replacement")
+	}
+	return nil
+}
+
+func (p *metaspacePreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	ns.mapRunes(func(r rune) string {
+		if r == ' ' {
+			return p.Replacement
+		}
+		return string(r)
+	})
+	if !ns.isEmpty() && !strings.HasPrefix(ns.normalized, p.Replacement) {
+		if p.PrependScheme == "always" || (p.PrependScheme == "first" && ns.alignments[0][0] == 0) {
+			ns.prepend(p.Replacement)
+		}
+	}
+	if !p.Split {
+		return []*normalizedString{ns}
+	}
+	var matches [][2]int
+	text := ns.normalized
+	for pos := 0; pos < len(text); {
+		idx := strings.Index(text[pos:], p.Replacement)
+		if idx < 0 {
+			break
+		}
+		matches = append(matches, [2]int{pos + idx, pos + idx + len(p.Replacement)})
+		pos += idx + len(p.Replacement)
+	}
+	return ns.split(matches, SplitMergedWithNext)
+}
+
+// metaspaceDecode reverts the metaspace pre-tokenization.
+func metaspaceDecode(tokens []string, replacement, prependScheme string) []string {
+	decoded := make([]string, len(tokens))
+	for ii, token := range tokens {
+		token = strings.ReplaceAll(token, replacement, " ")
+		if ii == 0 && prependScheme != "never" {
+			token = strings.TrimPrefix(token, " ")
+		}
+		decoded[ii] = token
+	}
+	return decoded
+}
+
+// byteLevelPreTokenizer splits the text using GPT-2's regular expression (if UseRegex is set), and then
+// converts all bytes to printable characters, see byteToRune.
+type byteLevelPreTokenizer struct {
+	Type           string `json:"type"`
+	AddPrefixSpace bool   `json:"add_prefix_space"`
+	TrimOffsets    bool   `json:"trim_offsets"`
+	UseRegex       bool   `json:"use_regex"`
+}
+
+func (p *byteLevelPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	if p.AddPrefixSpace && !ns.isEmpty() && !strings.HasPrefix(ns.normalized, " ") {
+		ns.prepend(" ")
+	}
+	splits := []*normalizedString{ns}
+	if p.UseRegex {
+		splits = ns.split(gpt2Matches(ns.normalized), SplitIsolated)
+	}
+	for _, split := range splits {
+		byteLevelEncode(split)
+	}
+	return splits
+}
+
+// splitPreTokenizer splits on a pattern, with the given behavior for the delimiters.
+// If Invert is set, the matches are the pieces to keep, and the text in between are the delimiters.
+type splitPreTokenizer struct {
+	Type     string        `json:"type"`
+	Pattern  pattern       `json:"pattern"`
+	Behavior SplitBehavior `json:"behavior"`
+	Invert   bool          `json:"invert"`
+
+	matcher *matcher
+}
+
+func (p *splitPreTokenizer) init() (err error) {
+	p.matcher, err = p.Pattern.compile()
+	return
+}
+
+func (p *splitPreTokenizer) splitOne(ns *normalizedString) []*normalizedString {
+	matches := p.matcher.findAll(ns.normalized)
+	if p.Invert {
+		matches = invertMatches(matches, len(ns.normalized))
+	}
+	return ns.split(matches, p.Behavior)
+}
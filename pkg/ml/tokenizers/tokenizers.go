@@ -0,0 +1,557 @@
+// Package tokenizers implements text tokenizers in pure Go, compatible with HuggingFace's `tokenizer.json` files.
+//
+// It supports the BPE (including byte-level BPE, as used by GPT-2 and Llama), WordPiece (as used by BERT) and
+// Unigram (as used by SentencePiece models like T5) models, along with the most common normalizers,
+// pre-tokenizers, post-processors (special tokens) and decoders. It also supports truncation and padding,
+// and reports the offsets of each token in the original text.
+//
+// Example:
+//
+//	tokenizer, err := tokenizers.Load("tokenizer.json")
+//	if err != nil { ... }
+//	tokenizer.WithTruncation(&tokenizers.TruncationParams{MaxLength: 128}).
+//		WithPadding(&tokenizers.PaddingParams{PadToMultipleOf: 16})
+//	encodings, err := tokenizer.EncodeBatch([]string{"Hello world!", "How are you?"}, true)
+//	if err != nil { ... }
+//	ids := tokenizers.IDsTensor(encodings, dtypes.Int32)      // Feed to layers.Embedding.
+//	mask := tokenizers.AttentionMaskTensor(encodings)         // Use as mask to layers.MultiHeadAttention.
+//
+// New BPE vocabularies can be trained from a corpus with NewBPETrainer.
+//
+// Offsets are given in bytes (not characters) of the original text, as usual in Go.
+package tokenizers
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// AddedToken is a token added to the vocabulary of the model, matched in the text before normalization
+// (or after, if Normalized is set) -- it's never split by the model. Special tokens (e.g.: "[CLS]", "<|endoftext|>")
+// are usually added tokens.
+type AddedToken struct {
+	ID      int    `json:"id"`
+	Content string `json:"content"`
+
+	// SingleWord only matches the token if it is not part of a larger word.
+	SingleWord bool `json:"single_word"`
+
+	// LStrip and RStrip include the white spaces on the left or right of the token in the match.
+	LStrip bool `json:"lstrip"`
+	RStrip bool `json:"rstrip"`
+
+	// Normalized tokens are matched against the normalized text.
+	Normalized bool `json:"normalized"`
+
+	// Special tokens can be skipped when decoding.
+	Special bool `json:"special"`
+}
+
+// Tokenizer converts text to tokens and back. Create it with Load or FromJSON, or train a new one with
+// NewBPETrainer.
+//
+// After configured (WithTruncation, WithPadding, AddSpecialTokens), it is safe for concurrent use.
+type Tokenizer struct {
+	version       string
+	addedTokens   []*AddedToken
+	normalizer    normalizer
+	preTokenizer  preTokenizer
+	model         model
+	postProcessor postProcessor
+	decoder       decoder
+	truncation    *TruncationParams
+	padding       *PaddingParams
+
+	addedTokensByID      map[int]*AddedToken
+	addedTokensByContent map[string]*AddedToken
+
+	// rawMatchers and normalizedMatchers are the added tokens indexed by their first byte, for added tokens
+	// matched before and after normalization respectively.
+	rawMatchers, normalizedMatchers map[byte][]addedTokenMatcher
+}
+
+// addedTokenMatcher is the content to match for an added token.
+type addedTokenMatcher struct {
+	content string
+	token   *AddedToken
+}
+
+// tokenizerJSON is the format of HuggingFace's tokenizer.json files.
+type tokenizerJSON struct {
+	Version       string            `json:"version"`
+	Truncation    *TruncationParams `json:"truncation"`
+	Padding       *PaddingParams    `json:"padding"`
+	AddedTokens   []*AddedToken     `json:"added_tokens"`
+	Normalizer    json.RawMessage   `json:"normalizer"`
+	PreTokenizer  json.RawMessage   `json:"pre_tokenizer"`
+	PostProcessor json.RawMessage   `json:"post_processor"`
+	Decoder       json.RawMessage   `json:"decoder"`
+	Model         json.RawMessage   `json:"model"`
+}
+
+// Load a tokenizer from a HuggingFace tokenizer.json file.
+func Load(filePath string) (*Tokenizer, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read tokenizer file %q", filePath)
+	}
+	t, err := FromJSON(contents)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to load tokenizer from %q", filePath)
+	}
+	return t, nil
+}
+
+// FromJSON creates a tokenizer from the contents of a HuggingFace tokenizer.json file.
+func FromJSON(contents []byte) (*Tokenizer, error) {
+	var raw tokenizerJSON
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse tokenizer JSON")
+	}
+	t := &Tokenizer{
+		version:     raw.Version,
+		truncation:  raw.Truncation,
+		padding:     raw.Padding,
+		addedTokens: raw.AddedTokens,
+	}
+	var err error
+	if t.normalizer, err = parseNormalizer(raw.Normalizer); err != nil {
+		return nil, err
+	}
+	if t.preTokenizer, err = parsePreTokenizer(raw.PreTokenizer); err != nil {
+		return nil, err
+	}
+	if t.model, err = parseModel(raw.Model); err != nil {
+		return nil, err
+	}
+	if t.postProcessor, err = parsePostProcessor(raw.PostProcessor); err != nil {
+		return nil, err
+	}
+	if t.decoder, err = parseDecoder(raw.Decoder); err != nil {
+		return nil, err
+	}
+	t.indexAddedTokens()
+	return t, nil
+}
+
+// ToJSON returns the tokenizer in the HuggingFace tokenizer.json format.
+func (t *Tokenizer) ToJSON() ([]byte, error) {
+	raw := struct {
+		Version       string            `json:"version"`
+		Truncation    *TruncationParams `json:"truncation"`
+		Padding       *PaddingParams    `json:"padding"`
+		AddedTokens   []*AddedToken     `json:"added_tokens"`
+		Normalizer    normalizer        `json:"normalizer"`
+		PreTokenizer  preTokenizer      `json:"pre_tokenizer"`
+		PostProcessor postProcessor     `json:"post_processor"`
+		Decoder       decoder           `json:"decoder"`
+		Model         model             `json:"model"`
+	}{
+		Version:       t.version,
+		Truncation:    t.truncation,
+		Padding:       t.padding,
+		AddedTokens:   t.addedTokens,
+		Normalizer:    t.normalizer,
+		PreTokenizer:  t.preTokenizer,
+		PostProcessor: t.postProcessor,
+		Decoder:       t.decoder,
+		Model:         t.model,
+	}
+	if raw.Version == "" {
+		raw.Version = "1.0"
+	}
+	if raw.AddedTokens == nil {
+		raw.AddedTokens = []*AddedToken{}
+	}
+	contents, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize tokenizer to JSON")
+	}
+	return contents, nil
+}
+
+// Save the tokenizer in the HuggingFace tokenizer.json format.
+func (t *Tokenizer) Save(filePath string) error {
+	contents, err := t.ToJSON()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, contents, 0o644); err != nil {
+		return errors.Wrapf(err, "failed to save tokenizer to %q", filePath)
+	}
+	return nil
+}
+
+// indexAddedTokens builds the indices used to find the added tokens.
+func (t *Tokenizer) indexAddedTokens() {
+	slices.SortFunc(t.addedTokens, func(a, b *AddedToken) int { return a.ID - b.ID })
+	t.addedTokensByID = make(map[int]*AddedToken, len(t.addedTokens))
+	t.addedTokensByContent = make(map[string]*AddedToken, len(t.addedTokens))
+	t.rawMatchers = make(map[byte][]addedTokenMatcher)
+	t.normalizedMatchers = make(map[byte][]addedTokenMatcher)
+	for _, added := range t.addedTokens {
+		t.addedTokensByID[added.ID] = added
+		t.addedTokensByContent[added.Content] = added
+		if added.Content == "" {
+			continue
+		}
+		content, matchers := added.Content, t.rawMatchers
+		if added.Normalized {
+			matchers = t.normalizedMatchers
+			if t.normalizer != nil {
+				ns := newNormalizedString(content, 0)
+				t.normalizer.normalize(ns)
+				content = ns.normalized
+				if content == "" {
+					continue
+				}
+			}
+		}
+		matchers[content[0]] = append(matchers[content[0]], addedTokenMatcher{content: content, token: added})
+	}
+	// Longest matches first.
+	for _, matchers := range []map[byte][]addedTokenMatcher{t.rawMatchers, t.normalizedMatchers} {
+		for _, list := range matchers {
+			slices.SortStableFunc(list, func(a, b addedTokenMatcher) int { return len(b.content) - len(a.content) })
+		}
+	}
+}
+
+// AddSpecialTokens adds the given special tokens: they are never split, and they can be skipped when decoding.
+// Tokens already in the vocabulary of the model keep their ids, the others are assigned new ids after the
+// largest id in use.
+//
+// It returns the modified Tokenizer, so calls can be cascaded if one wants.
+func (t *Tokenizer) AddSpecialTokens(contents ...string) *Tokenizer {
+	for _, content := range contents {
+		if _, found := t.addedTokensByContent[content]; found {
+			continue
+		}
+		id, found := t.model.tokenToID(content)
+		if !found {
+			id = t.VocabSize()
+		}
+		t.addedTokens = append(t.addedTokens, &AddedToken{ID: id, Content: content, Special: true})
+		t.indexAddedTokens()
+	}
+	return t
+}
+
+// AddedTokens returns the list of tokens added to the vocabulary, sorted by id. It should not be modified.
+func (t *Tokenizer) AddedTokens() []*AddedToken {
+	return t.addedTokens
+}
+
+// WithTruncation configures the truncation of the encodings. If params is nil, truncation is disabled.
+// Files from HuggingFace may already include truncation parameters.
+//
+// It returns the modified Tokenizer, so calls can be cascaded if one wants.
+func (t *Tokenizer) WithTruncation(params *TruncationParams) *Tokenizer {
+	t.truncation = params
+	return t
+}
+
+// Truncation returns the current truncation parameters, or nil if truncation is disabled.
+func (t *Tokenizer) Truncation() *TruncationParams {
+	return t.truncation
+}
+
+// WithPadding configures the padding of the encodings. If params is nil, padding is disabled.
+// Files from HuggingFace may already include padding parameters.
+//
+// If params.PadToken is empty, it is set to the first of "[PAD]", "<pad>", "<|padding|>" or "<|endoftext|>"
+// found in the vocabulary, and params.PadID is set accordingly.
+//
+// It returns the modified Tokenizer, so calls can be cascaded if one wants.
+func (t *Tokenizer) WithPadding(params *PaddingParams) *Tokenizer {
+	if params != nil && params.PadToken == "" {
+		for _, candidate := range []string{"[PAD]", "<pad>", "<|padding|>", "<|endoftext|>"} {
+			if id, found := t.TokenToID(candidate); found {
+				params.PadToken, params.PadID = candidate, id
+				break
+			}
+		}
+	}
+	t.padding = params
+	return t
+}
+
+// Padding returns the current padding parameters, or nil if padding is disabled.
+func (t *Tokenizer) Padding() *PaddingParams {
+	return t.padding
+}
+
+// VocabSize returns the size of the vocabulary, including the added tokens. It is the number of rows needed for
+// the embedding table.
+func (t *Tokenizer) VocabSize() int {
+	size := t.model.vocabSize()
+	for _, added := range t.addedTokens {
+		size = max(size, added.ID+1)
+	}
+	return size
+}
+
+// TokenToID returns the id of the token, if it is in the vocabulary (or one of the added tokens).
+func (t *Tokenizer) TokenToID(token string) (id int, found bool) {
+	if added, ok := t.addedTokensByContent[token]; ok {
+		return added.ID, true
+	}
+	return t.model.tokenToID(token)
+}
+
+// IDToToken returns the token for the id, if it is in the vocabulary (or one of the added tokens).
+func (t *Tokenizer) IDToToken(id int) (token string, found bool) {
+	if added, ok := t.addedTokensByID[id]; ok {
+		return added.Content, true
+	}
+	return t.model.idToToken(id)
+}
+
+// isWordRune is used to check boundaries of AddedToken.SingleWord tokens.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
+
+// textPiece is either a piece of text to be tokenized, or an added token found in the text.
+type textPiece struct {
+	ns    *normalizedString
+	added *AddedToken
+}
+
+// splitAddedTokens finds the added tokens (from the given matchers) in the text, and splits it around them.
+func splitAddedTokens(ns *normalizedString, matchers map[byte][]addedTokenMatcher) []textPiece {
+	if len(matchers) == 0 {
+		return []textPiece{{ns: ns}}
+	}
+	text := ns.normalized
+	var pieces []textPiece
+	pieceStart := 0
+	for pos := 0; pos < len(text); {
+		var match *addedTokenMatcher
+		for ii, candidate := range matchers[text[pos]] {
+			if !strings.HasPrefix(text[pos:], candidate.content) {
+				continue
+			}
+			if candidate.token.SingleWord {
+				before, _ := utf8.DecodeLastRuneInString(text[:pos])
+				after, _ := utf8.DecodeRuneInString(text[pos+len(candidate.content):])
+				if (pos > 0 && isWordRune(before)) ||
+					(pos+len(candidate.content) < len(text) && isWordRune(after)) {
+					continue
+				}
+			}
+			match = &matchers[text[pos]][ii]
+			break
+		}
+		if match == nil {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
+			continue
+		}
+		start, end := pos, pos+len(match.content)
+		if match.token.LStrip {
+			start = pieceStart + len(strings.TrimRightFunc(text[pieceStart:start], unicode.IsSpace))
+		}
+		if match.token.RStrip {
+			end = len(text) - len(strings.TrimLeftFunc(text[end:], unicode.IsSpace))
+		}
+		if start > pieceStart {
+			pieces = append(pieces, textPiece{ns: ns.slice(pieceStart, start)})
+		}
+		pieces = append(pieces, textPiece{ns: ns.slice(start, end), added: match.token})
+		pieceStart, pos = end, end
+	}
+	if pieceStart < len(text) {
+		pieces = append(pieces, textPiece{ns: ns.slice(pieceStart, len(text))})
+	}
+	return pieces
+}
+
+// encodeSequence tokenizes one sequence, without post-processing.
+func (t *Tokenizer) encodeSequence(text string, sequenceID int) (*Encoding, error) {
+	encoding := &Encoding{}
+	wordID := 0
+	for _, rawPiece := range splitAddedTokens(newNormalizedString(text, 0), t.rawMatchers) {
+		pieces := []textPiece{rawPiece}
+		if rawPiece.added == nil {
+			if t.normalizer != nil {
+				t.normalizer.normalize(rawPiece.ns)
+			}
+			pieces = splitAddedTokens(rawPiece.ns, t.normalizedMatchers)
+		}
+		for _, piece := range pieces {
+			if piece.added != nil {
+				encoding.appendToken(piece.added.ID, piece.added.Content, piece.ns.span(0, len(piece.ns.normalized)),
+					wordID, sequenceID, piece.added.Special)
+				wordID++
+				continue
+			}
+			words := []*normalizedString{piece.ns}
+			if t.preTokenizer != nil {
+				words = preTokenize(t.preTokenizer, words)
+			}
+			for _, word := range words {
+				if word.isEmpty() {
+					continue
+				}
+				tokens, err := t.model.tokenize(word.normalized)
+				if err != nil {
+					return nil, err
+				}
+				for _, tok := range tokens {
+					encoding.appendToken(tok.id, tok.value, word.span(tok.offsets[0], tok.offsets[1]),
+						wordID, sequenceID, false)
+				}
+				wordID++
+			}
+		}
+	}
+	if t.postProcessor != nil && t.postProcessor.trimsOffsets() {
+		for ii, offsets := range encoding.Offsets {
+			start, end := offsets[0], offsets[1]
+			for start < end && unicode.IsSpace(rune(text[start])) {
+				start++
+			}
+			for end > start && unicode.IsSpace(rune(text[end-1])) {
+				end--
+			}
+			encoding.Offsets[ii] = [2]int{start, end}
+		}
+	}
+	return encoding, nil
+}
+
+// encode implements Encode and EncodePair, without padding.
+func (t *Tokenizer) encode(text string, pair *string, addSpecialTokens bool) (*Encoding, error) {
+	encoding, err := t.encodeSequence(text, 0)
+	if err != nil {
+		return nil, err
+	}
+	var pairEncoding *Encoding
+	if pair != nil {
+		pairEncoding, err = t.encodeSequence(*pair, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.truncation != nil {
+		numAdded := 0
+		if addSpecialTokens && t.postProcessor != nil {
+			numAdded = t.postProcessor.numAddedTokens(pair != nil)
+		}
+		if err = truncateEncodings(encoding, pairEncoding, t.truncation, numAdded); err != nil {
+			return nil, err
+		}
+	}
+	process := func(e, p *Encoding) *Encoding {
+		if addSpecialTokens && t.postProcessor != nil {
+			return t.postProcessor.process(e, p)
+		}
+		return mergeEncodings(e, p)
+	}
+	result := process(encoding, pairEncoding)
+	for _, overflowing := range encoding.Overflowing {
+		result.Overflowing = append(result.Overflowing, process(overflowing, pairEncoding))
+	}
+	if pairEncoding != nil {
+		for _, overflowing := range pairEncoding.Overflowing {
+			result.Overflowing = append(result.Overflowing, process(encoding, overflowing))
+		}
+	}
+	return result, nil
+}
+
+// Encode the text. If addSpecialTokens is true, the post-processor adds the special tokens (e.g.: "[CLS]" and
+// "[SEP]" for BERT).
+//
+// Truncation and padding are applied if configured, see WithTruncation and WithPadding.
+func (t *Tokenizer) Encode(text string, addSpecialTokens bool) (*Encoding, error) {
+	encoding, err := t.encode(text, nil, addSpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	if t.padding != nil {
+		encoding.pad(t.padding.paddedLength(encoding.Len()), t.padding)
+	}
+	return encoding, nil
+}
+
+// EncodePair encodes a pair of texts (e.g.: question and context), merged by the post-processor.
+// See Encode.
+func (t *Tokenizer) EncodePair(text, pair string, addSpecialTokens bool) (*Encoding, error) {
+	encoding, err := t.encode(text, &pair, addSpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	if t.padding != nil {
+		encoding.pad(t.padding.paddedLength(encoding.Len()), t.padding)
+	}
+	return encoding, nil
+}
+
+// EncodeBatch encodes the texts in parallel. See Encode.
+//
+// If padding is configured (see WithPadding) all encodings will have the same length, and they can be
+// converted to tensors with IDsTensor, TypeIDsTensor and AttentionMaskTensor.
+func (t *Tokenizer) EncodeBatch(texts []string, addSpecialTokens bool) ([]*Encoding, error) {
+	encodings := make([]*Encoding, len(texts))
+	errs := make([]error, len(texts))
+	var wg sync.WaitGroup
+	numWorkers := min(runtime.NumCPU(), len(texts))
+	for worker := range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ii := worker; ii < len(texts); ii += numWorkers {
+				encodings[ii], errs[ii] = t.encode(texts[ii], nil, addSpecialTokens)
+			}
+		}()
+	}
+	wg.Wait()
+	for ii, err := range errs {
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to encode text #%d of the batch", ii)
+		}
+	}
+	if t.padding != nil && len(encodings) > 0 {
+		longest := 0
+		for _, encoding := range encodings {
+			longest = max(longest, encoding.Len())
+		}
+		length := t.padding.paddedLength(longest)
+		for _, encoding := range encodings {
+			encoding.pad(length, t.padding)
+		}
+	}
+	return encodings, nil
+}
+
+// Decode converts the token ids back to text. If skipSpecialTokens is true, special tokens (e.g.: "[CLS]",
+// "<|endoftext|>") are skipped. Unknown ids are ignored.
+func (t *Tokenizer) Decode(ids []int, skipSpecialTokens bool) string {
+	tokens := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if added, ok := t.addedTokensByID[id]; ok {
+			if skipSpecialTokens && added.Special {
+				continue
+			}
+			tokens = append(tokens, added.Content)
+			continue
+		}
+		if token, found := t.model.idToToken(id); found {
+			tokens = append(tokens, token)
+		}
+	}
+	if t.decoder == nil {
+		return strings.Join(tokens, " ")
+	}
+	return strings.Join(t.decoder.decodeChain(tokens), "")
+}
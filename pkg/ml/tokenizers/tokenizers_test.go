@@ -0,0 +1,189 @@
+package tokenizers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/require"
+)
+
+const bertTokenizerJSON = `{
+  "version": "1.0",
+  "truncation": null,
+  "padding": null,
+  "added_tokens": [
+    {"id": 0, "content": "[PAD]", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true},
+    {"id": 1, "content": "[UNK]", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true},
+    {"id": 2, "content": "[CLS]", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true},
+    {"id": 3, "content": "[SEP]", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true}
+  ],
+  "normalizer": {"type": "BertNormalizer", "clean_text": true, "handle_chinese_chars": true, "strip_accents": null, "lowercase": true},
+  "pre_tokenizer": {"type": "BertPreTokenizer"},
+  "post_processor": {
+    "type": "TemplateProcessing",
+    "single": [{"SpecialToken": {"id": "[CLS]", "type_id": 0}}, {"Sequence": {"id": "A", "type_id": 0}}, {"SpecialToken": {"id": "[SEP]", "type_id": 0}}],
+    "pair": [{"SpecialToken": {"id": "[CLS]", "type_id": 0}}, {"Sequence": {"id": "A", "type_id": 0}}, {"SpecialToken": {"id": "[SEP]", "type_id": 0}},
+             {"Sequence": {"id": "B", "type_id": 1}}, {"SpecialToken": {"id": "[SEP]", "type_id": 1}}],
+    "special_tokens": {
+      "[CLS]": {"id": "[CLS]", "ids": [2], "tokens": ["[CLS]"]},
+      "[SEP]": {"id": "[SEP]", "ids": [3], "tokens": ["[SEP]"]}
+    }
+  },
+  "decoder": {"type": "WordPiece", "prefix": "##", "cleanup": true},
+  "model": {
+    "type": "WordPiece", "unk_token": "[UNK]", "continuing_subword_prefix": "##", "max_input_chars_per_word": 100,
+    "vocab": {"[PAD]": 0, "[UNK]": 1, "[CLS]": 2, "[SEP]": 3, "hello": 4, "world": 5, ",": 6, "!": 7,
+              "un": 8, "##aff": 9, "##able": 10, "how": 11, "are": 12, "you": 13, "?": 14, "cafe": 15}
+  }
+}`
+
+func TestWordPiece(t *testing.T) {
+	tok, err := FromJSON([]byte(bertTokenizerJSON))
+	require.NoError(t, err)
+	require.Equal(t, 16, tok.VocabSize())
+
+	text := "Hello, unaffable WORLD!"
+	enc, err := tok.Encode(text, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[CLS]", "hello", ",", "un", "##aff", "##able", "world", "!", "[SEP]"}, enc.Tokens)
+	require.Equal(t, []int{2, 4, 6, 8, 9, 10, 5, 7, 3}, enc.IDs)
+	require.Equal(t, "unaffable", text[enc.Offsets[3][0]:enc.Offsets[5][1]])
+	require.Equal(t, "WORLD", text[enc.Offsets[6][0]:enc.Offsets[6][1]])
+	require.Equal(t, [2]int{0, 0}, enc.Offsets[0])
+	require.Equal(t, []bool{true, false, false, false, false, false, false, false, true}, enc.SpecialTokensMask)
+	require.Equal(t, "hello, unaffable world!", tok.Decode(enc.IDs, true))
+
+	// Accents are stripped when lowercasing, unknown words are mapped to [UNK].
+	enc, err = tok.Encode("Café xyz", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cafe", "[UNK]"}, enc.Tokens)
+
+	// Pairs and type ids.
+	enc, err = tok.EncodePair("Hello world", "How are you?", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[CLS]", "hello", "world", "[SEP]", "how", "are", "you", "?", "[SEP]"}, enc.Tokens)
+	require.Equal(t, []int{0, 0, 0, 0, 1, 1, 1, 1, 1}, enc.TypeIDs)
+
+	// Truncation with overflow.
+	tok.WithTruncation(&TruncationParams{MaxLength: 5})
+	enc, err = tok.Encode("Hello, unaffable world!", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"[CLS]", "hello", ",", "un", "[SEP]"}, enc.Tokens)
+	require.NotEmpty(t, enc.Overflowing)
+	tok.WithTruncation(nil)
+
+	// Batch with padding and conversion to tensors.
+	tok.WithPadding(&PaddingParams{})
+	encodings, err := tok.EncodeBatch([]string{"hello world", "how are you?"}, true)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 4, 5, 3, 0, 0}, encodings[0].IDs)
+	require.Equal(t, []bool{true, true, true, true, false, false}, encodings[0].AttentionMask)
+	ids := IDsTensor(encodings, dtypes.Int32)
+	require.Equal(t, [][]int32{{2, 4, 5, 3, 0, 0}, {2, 11, 12, 13, 14, 3}}, ids.Value())
+	mask := AttentionMaskTensor(encodings)
+	require.Equal(t, []int{2, 6}, mask.Shape().Dimensions)
+	require.Equal(t, dtypes.Bool, mask.DType())
+
+	// Save and reload.
+	filePath := filepath.Join(t.TempDir(), "tokenizer.json")
+	require.NoError(t, tok.Save(filePath))
+	tok2, err := Load(filePath)
+	require.NoError(t, err)
+	require.NotNil(t, tok2.Padding())
+	encodings2, err := tok2.EncodeBatch([]string{"hello world", "how are you?"}, true)
+	require.NoError(t, err)
+	require.Equal(t, encodings[1].IDs, encodings2[1].IDs)
+}
+
+const byteLevelBPETokenizerJSON = `{
+  "version": "1.0",
+  "added_tokens": [
+    {"id": 9, "content": "<|endoftext|>", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true}
+  ],
+  "normalizer": null,
+  "pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "trim_offsets": true, "use_regex": true},
+  "post_processor": {"type": "ByteLevel", "add_prefix_space": true, "trim_offsets": true, "use_regex": true},
+  "decoder": {"type": "ByteLevel", "add_prefix_space": true, "trim_offsets": true, "use_regex": true},
+  "model": {
+    "type": "BPE", "dropout": null, "unk_token": null, "continuing_subword_prefix": "", "end_of_word_suffix": "",
+    "fuse_unk": false, "byte_fallback": false,
+    "vocab": {"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "w": 5, "r": 6, "d": 7, "he": 8, "ll": 10, "hell": 11,
+              "hello": 12, "Ġw": 13, "or": 14, "Ġwor": 15, "Ġworl": 16, "Ġworld": 17},
+    "merges": ["h e", "l l", "he ll", "hell o", "Ġ w", "o r", "Ġw or", "Ġwor l", "Ġworl d"]
+  }
+}`
+
+func TestByteLevelBPE(t *testing.T) {
+	tok, err := FromJSON([]byte(byteLevelBPETokenizerJSON))
+	require.NoError(t, err)
+
+	text := "hello world<|endoftext|>"
+	enc, err := tok.Encode(text, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "Ġworld", "<|endoftext|>"}, enc.Tokens)
+	require.Equal(t, []int{12, 17, 9}, enc.IDs)
+	// Offsets are trimmed of the leading space.
+	require.Equal(t, [2]int{6, 11}, enc.Offsets[1])
+	require.Equal(t, "hello world", tok.Decode(enc.IDs, true))
+	require.Equal(t, text, tok.Decode(enc.IDs, false))
+
+	// Partial merges.
+	enc, err = tok.Encode("hold wed", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"h", "o", "l", "d", "Ġw", "e", "d"}, enc.Tokens)
+}
+
+const unigramTokenizerJSON = `{
+  "version": "1.0",
+  "added_tokens": [
+    {"id": 0, "content": "<unk>", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true},
+    {"id": 1, "content": "</s>", "single_word": false, "lstrip": false, "rstrip": false, "normalized": false, "special": true}
+  ],
+  "normalizer": {"type": "Sequence", "normalizers": [{"type": "NFKC"}, {"type": "Replace", "pattern": {"Regex": " {2,}"}, "content": " "}]},
+  "pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+  "post_processor": {
+    "type": "TemplateProcessing",
+    "single": [{"Sequence": {"id": "A", "type_id": 0}}, {"SpecialToken": {"id": "</s>", "type_id": 0}}],
+    "pair": [{"Sequence": {"id": "A", "type_id": 0}}, {"SpecialToken": {"id": "</s>", "type_id": 0}},
+             {"Sequence": {"id": "B", "type_id": 0}}, {"SpecialToken": {"id": "</s>", "type_id": 0}}],
+    "special_tokens": {"</s>": {"id": "</s>", "ids": [1], "tokens": ["</s>"]}}
+  },
+  "decoder": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+  "model": {
+    "type": "Unigram", "unk_id": 0, "byte_fallback": false,
+    "vocab": [["<unk>", 0.0], ["</s>", 0.0], ["▁", -2.0], ["▁hello", -3.0], ["▁wor", -4.0], ["ld", -4.0],
+              ["▁world", -9.0], ["h", -5.0], ["e", -5.0], ["l", -5.0], ["o", -5.0], ["w", -5.0], ["r", -5.0], ["d", -5.0]]
+  }
+}`
+
+func TestUnigram(t *testing.T) {
+	tok, err := FromJSON([]byte(unigramTokenizerJSON))
+	require.NoError(t, err)
+
+	enc, err := tok.Encode("hello  world", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"▁hello", "▁wor", "ld", "</s>"}, enc.Tokens)
+	require.Equal(t, []int{3, 4, 5, 1}, enc.IDs)
+	require.Equal(t, "hello world", tok.Decode(enc.IDs, true))
+
+	// Unknown characters are fused into one "<unk>".
+	enc, err = tok.Encode("hello xyz", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"▁hello", "▁", "<unk>"}, enc.Tokens)
+}
+
+func TestSplitPattern(t *testing.T) {
+	// GPT-2 pattern, which uses a negative lookahead, emulated by the matcher.
+	gpt2 := `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+	m, err := pattern{Regex: &gpt2}.compile()
+	require.NoError(t, err)
+	for _, text := range []string{
+		"Hello world",
+		"Hello   world!!  ",
+		"it's 2024,\n\n  we're   here\t\tnow",
+		"   leading spaces",
+	} {
+		require.Equal(t, gpt2Matches(text), m.findAll(text), "text=%q", text)
+	}
+}
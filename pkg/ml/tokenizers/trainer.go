@@ -0,0 +1,362 @@
+package tokenizers
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// BPETrainer trains a BPE (Byte-Pair Encoding) tokenizer from a corpus.
+//
+// Create it with NewBPETrainer, configure it, then feed it the corpus with Feed (or FeedFiles), and finally
+// call Train to create the Tokenizer. The configuration can't be changed after the first text is fed.
+//
+// Example:
+//
+//	trainer := tokenizers.NewBPETrainer(8000).ByteLevel().SpecialTokens("<|endoftext|>")
+//	err := trainer.FeedFiles("corpus.txt")
+//	if err != nil { ... }
+//	tokenizer, err := trainer.Train()
+//	if err != nil { ... }
+//	err = tokenizer.Save("tokenizer.json")
+type BPETrainer struct {
+	vocabSize, minFrequency int
+	specialTokens           []string
+	byteLevel, lowercase    bool
+	unkToken                string
+	continuingSubwordPrefix string
+	endOfWordSuffix         string
+	limitAlphabet           int
+	pipeline                *Tokenizer
+	wordCounts              map[string]int
+}
+
+// NewBPETrainer creates a BPETrainer for a vocabulary of the given size (including special tokens and the
+// alphabet).
+//
+// By default, texts are NFC normalized and split on white spaces and punctuation (see ByteLevel for an
+// alternative), merges need a minimum frequency of 2, and there are no special tokens.
+func NewBPETrainer(vocabSize int) *BPETrainer {
+	return &BPETrainer{
+		vocabSize:    vocabSize,
+		minFrequency: 2,
+		wordCounts:   make(map[string]int),
+	}
+}
+
+// MinFrequency sets the minimum number of occurrences of a pair of tokens for it to be merged. Default is 2.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) MinFrequency(n int) *BPETrainer {
+	tr.minFrequency = n
+	return tr
+}
+
+// SpecialTokens sets the special tokens, which take the first ids of the vocabulary, in the order given.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) SpecialTokens(tokens ...string) *BPETrainer {
+	tr.specialTokens = tokens
+	return tr
+}
+
+// ByteLevel configures the tokenizer to use byte-level BPE, as in GPT-2: the text is split with GPT-2's
+// regular expression, and all 256 bytes are part of the alphabet, so there are never unknown tokens.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) ByteLevel() *BPETrainer {
+	tr.byteLevel = true
+	return tr
+}
+
+// Lowercase configures the tokenizer to convert the text to lower case.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) Lowercase() *BPETrainer {
+	tr.lowercase = true
+	return tr
+}
+
+// UnkToken sets the token used for characters not in the alphabet (see LimitAlphabet). If not set, unknown
+// characters are dropped. It is added as a special token, if not already listed.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) UnkToken(token string) *BPETrainer {
+	tr.unkToken = token
+	return tr
+}
+
+// ContinuingSubwordPrefix sets a prefix (e.g.: "##") added to the tokens that don't start a word.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) ContinuingSubwordPrefix(prefix string) *BPETrainer {
+	tr.continuingSubwordPrefix = prefix
+	return tr
+}
+
+// EndOfWordSuffix sets a suffix (e.g.: "</w>") added to the tokens that end a word.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) EndOfWordSuffix(suffix string) *BPETrainer {
+	tr.endOfWordSuffix = suffix
+	return tr
+}
+
+// LimitAlphabet limits the number of different characters in the initial alphabet to the n most frequent ones.
+// It is ignored for ByteLevel tokenizers. Default is 0, meaning no limit.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) LimitAlphabet(n int) *BPETrainer {
+	tr.limitAlphabet = n
+	return tr
+}
+
+// buildPipeline creates the tokenizer, without a model, used to normalize and pre-tokenize the texts.
+func (tr *BPETrainer) buildPipeline() {
+	if tr.pipeline != nil {
+		return
+	}
+	normalizers := []normalizer{&unicodeNormalizer{Type: "NFC"}}
+	if tr.lowercase {
+		normalizers = append(normalizers, &lowercaseNormalizer{Type: "Lowercase"})
+	}
+	t := &Tokenizer{
+		version:    "1.0",
+		normalizer: &sequenceNormalizer{Type: "Sequence", Normalizers: normalizers},
+	}
+	if tr.byteLevel {
+		t.preTokenizer = &byteLevelPreTokenizer{Type: "ByteLevel", TrimOffsets: true, UseRegex: true}
+		t.postProcessor = &byteLevelPostProcessor{Type: "ByteLevel", TrimOffsets: true, UseRegex: true}
+		t.decoder = &byteLevelDecoder{Type: "ByteLevel"}
+	} else {
+		t.preTokenizer = &whitespacePreTokenizer{Type: "Whitespace"}
+		switch {
+		case tr.endOfWordSuffix != "":
+			t.decoder = &bpeDecoder{Type: "BPEDecoder", Suffix: tr.endOfWordSuffix}
+		case tr.continuingSubwordPrefix != "":
+			t.decoder = &wordPieceDecoder{Type: "WordPiece", Prefix: tr.continuingSubwordPrefix}
+		}
+	}
+	tr.pipeline = t
+}
+
+// Feed texts of the corpus to the trainer. Only the counts of the words are kept in memory.
+//
+// It returns the modified BPETrainer, so calls can be cascaded if one wants.
+func (tr *BPETrainer) Feed(texts ...string) *BPETrainer {
+	tr.buildPipeline()
+	for _, text := range texts {
+		ns := newNormalizedString(text, 0)
+		tr.pipeline.normalizer.normalize(ns)
+		for _, word := range tr.pipeline.preTokenizer.splitOne(ns) {
+			if !word.isEmpty() {
+				tr.wordCounts[word.normalized]++
+			}
+		}
+	}
+	return tr
+}
+
+// FeedFiles feeds the trainer with the text files, one line at a time.
+func (tr *BPETrainer) FeedFiles(paths ...string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open corpus file")
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			tr.Feed(scanner.Text())
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read corpus file %q", path)
+		}
+	}
+	return nil
+}
+
+// Train creates the tokenizer from the texts fed so far.
+func (tr *BPETrainer) Train() (*Tokenizer, error) {
+	tr.buildPipeline()
+	vocab := make(map[string]int)
+	var tokens []string // Reverse of vocab.
+	addToken := func(token string) int {
+		if id, found := vocab[token]; found {
+			return id
+		}
+		vocab[token] = len(tokens)
+		tokens = append(tokens, token)
+		return len(tokens) - 1
+	}
+	specialTokens := slices.Clone(tr.specialTokens)
+	if tr.unkToken != "" && !slices.Contains(specialTokens, tr.unkToken) {
+		specialTokens = append(specialTokens, tr.unkToken)
+	}
+	for _, special := range specialTokens {
+		addToken(special)
+	}
+
+	// Sort words, so training is deterministic.
+	words := make([]string, 0, len(tr.wordCounts))
+	for word := range tr.wordCounts {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+	counts := make([]int, len(words))
+	for ii, word := range words {
+		counts[ii] = tr.wordCounts[word]
+	}
+
+	// Initial alphabet.
+	charCounts := make(map[rune]int)
+	for ii, word := range words {
+		for _, r := range word {
+			charCounts[r] += counts[ii]
+		}
+	}
+	var alphabet []rune
+	if tr.byteLevel {
+		alphabet = slices.Clone(byteToRune[:])
+	} else {
+		for r := range charCounts {
+			alphabet = append(alphabet, r)
+		}
+		if tr.limitAlphabet > 0 && len(alphabet) > tr.limitAlphabet {
+			slices.SortFunc(alphabet, func(a, b rune) int {
+				if charCounts[a] != charCounts[b] {
+					return charCounts[b] - charCounts[a]
+				}
+				return int(a - b)
+			})
+			alphabet = alphabet[:tr.limitAlphabet]
+		}
+	}
+	slices.Sort(alphabet)
+	inAlphabet := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		inAlphabet[r] = true
+		addToken(string(r))
+	}
+
+	// Convert words to sequences of symbols.
+	unkID := -1
+	if tr.unkToken != "" {
+		unkID = vocab[tr.unkToken]
+	}
+	wordSymbols := make([][]int, len(words))
+	for ii, word := range words {
+		symbols := make([]int, 0, utf8.RuneCountInString(word))
+		for pos, r := range word {
+			if !inAlphabet[r] {
+				if unkID >= 0 {
+					symbols = append(symbols, unkID)
+				}
+				continue
+			}
+			char := string(r)
+			if pos > 0 {
+				char = tr.continuingSubwordPrefix + char
+			}
+			if pos+utf8.RuneLen(r) == len(word) {
+				char += tr.endOfWordSuffix
+			}
+			symbols = append(symbols, addToken(char))
+		}
+		wordSymbols[ii] = symbols
+	}
+
+	// Count pairs.
+	type pair [2]int
+	pairCounts := make(map[pair]int)
+	pairWords := make(map[pair]map[int]bool)
+	updatePairs := func(wordIdx, sign int) {
+		symbols := wordSymbols[wordIdx]
+		for ii := 0; ii < len(symbols)-1; ii++ {
+			if symbols[ii] == unkID || symbols[ii+1] == unkID {
+				continue
+			}
+			p := pair{symbols[ii], symbols[ii+1]}
+			pairCounts[p] += sign * counts[wordIdx]
+			if sign > 0 {
+				if pairWords[p] == nil {
+					pairWords[p] = make(map[int]bool)
+				}
+				pairWords[p][wordIdx] = true
+			} else if pairCounts[p] <= 0 {
+				delete(pairCounts, p)
+				delete(pairWords, p)
+			}
+		}
+	}
+	for ii := range words {
+		updatePairs(ii, 1)
+	}
+
+	// Merge the most frequent pairs until the vocabulary is complete.
+	var merges bpeMerges
+	for len(tokens) < tr.vocabSize {
+		best, bestCount := pair{}, 0
+		for p, count := range pairCounts {
+			if count > bestCount || (count == bestCount &&
+				(tokens[p[0]] < tokens[best[0]] || (tokens[p[0]] == tokens[best[0]] && tokens[p[1]] < tokens[best[1]]))) {
+				best, bestCount = p, count
+			}
+		}
+		if bestCount == 0 || bestCount < tr.minFrequency {
+			break
+		}
+		left, right := tokens[best[0]], tokens[best[1]]
+		merges = append(merges, [2]string{left, right})
+		newID := addToken(left + strings.TrimPrefix(right, tr.continuingSubwordPrefix))
+		affected := make([]int, 0, len(pairWords[best]))
+		for wordIdx := range pairWords[best] {
+			affected = append(affected, wordIdx)
+		}
+		for _, wordIdx := range affected {
+			updatePairs(wordIdx, -1)
+			symbols := wordSymbols[wordIdx]
+			merged := symbols[:0]
+			for ii := 0; ii < len(symbols); ii++ {
+				if ii < len(symbols)-1 && symbols[ii] == best[0] && symbols[ii+1] == best[1] {
+					merged = append(merged, newID)
+					ii++
+					continue
+				}
+				merged = append(merged, symbols[ii])
+			}
+			wordSymbols[wordIdx] = merged
+			updatePairs(wordIdx, 1)
+		}
+		delete(pairCounts, best)
+		delete(pairWords, best)
+	}
+
+	// Create the tokenizer.
+	m := &bpeModel{Type: "BPE", Vocab: vocab, Merges: merges}
+	if tr.unkToken != "" {
+		m.UnkToken = &tr.unkToken
+	}
+	if tr.continuingSubwordPrefix != "" {
+		m.ContinuingSubwordPrefix = &tr.continuingSubwordPrefix
+	}
+	if tr.endOfWordSuffix != "" {
+		m.EndOfWordSuffix = &tr.endOfWordSuffix
+	}
+	if err := m.init(); err != nil {
+		return nil, errors.WithMessagef(err, "failed to create trained BPE model")
+	}
+	t := *tr.pipeline
+	t.model = m
+	for _, special := range specialTokens {
+		t.addedTokens = append(t.addedTokens, &AddedToken{ID: vocab[special], Content: special, Special: true})
+	}
+	t.indexAddedTokens()
+	return &t, nil
+}
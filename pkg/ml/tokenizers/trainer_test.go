@@ -0,0 +1,75 @@
+package tokenizers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var trainerCorpus = []string{
+	"the quick brown fox jumps over the lazy dog",
+	"the lazy dog sleeps, the quick fox runs",
+	"a quick brown dog jumps over a lazy fox",
+	"the fox and the dog are friends",
+}
+
+func TestBPETrainer(t *testing.T) {
+	for _, byteLevel := range []bool{false, true} {
+		vocabSize := 100
+		if byteLevel {
+			vocabSize = 300 // The byte-level alphabet alone takes 256 tokens.
+		}
+		trainer := NewBPETrainer(vocabSize).SpecialTokens("<pad>", "<s>").UnkToken("<unk>").Lowercase()
+		if byteLevel {
+			trainer.ByteLevel()
+		} else {
+			trainer.EndOfWordSuffix("</w>")
+		}
+		tok, err := trainer.Feed(trainerCorpus...).Train()
+		require.NoError(t, err)
+		require.LessOrEqual(t, tok.VocabSize(), vocabSize)
+		id, found := tok.TokenToID("<pad>")
+		require.True(t, found)
+		require.Equal(t, 0, id)
+
+		// Frequent words become single tokens.
+		enc, err := tok.Encode("The quick fox", false)
+		require.NoError(t, err)
+		if byteLevel {
+			require.Equal(t, []string{"the", "Ġquick", "Ġfox"}, enc.Tokens)
+		} else {
+			require.Equal(t, []string{"the</w>", "quick</w>", "fox</w>"}, enc.Tokens)
+		}
+		require.Equal(t, "the quick fox", tok.Decode(enc.IDs, false))
+
+		// Unseen words are split into smaller pieces, and round-trip.
+		enc, err = tok.Encode("the brown frog", false)
+		require.NoError(t, err)
+		require.Equal(t, "the brown frog", tok.Decode(enc.IDs, false))
+
+		// Save and reload.
+		filePath := filepath.Join(t.TempDir(), "tokenizer.json")
+		require.NoError(t, tok.Save(filePath))
+		tok2, err := Load(filePath)
+		require.NoError(t, err)
+		enc2, err := tok2.Encode("the brown frog", false)
+		require.NoError(t, err)
+		require.Equal(t, enc.IDs, enc2.IDs)
+	}
+}
+
+func TestBPEUnknownCharacters(t *testing.T) {
+	// With an unknown token, unseen characters are mapped to it.
+	tok, err := NewBPETrainer(100).UnkToken("<unk>").EndOfWordSuffix("</w>").Feed(trainerCorpus...).Train()
+	require.NoError(t, err)
+	enc, err := tok.Encode("the ë", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"the</w>", "<unk>"}, enc.Tokens)
+
+	// Without an unknown token, it is an error: the characters are not silently dropped.
+	tok, err = NewBPETrainer(100).EndOfWordSuffix("</w>").Feed(trainerCorpus...).Train()
+	require.NoError(t, err)
+	_, err = tok.Encode("the ë", false)
+	require.ErrorContains(t, err, `"ë"`)
+}
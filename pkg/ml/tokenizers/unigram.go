@@ -0,0 +1,165 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"math"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// unigramPiece is an entry in the vocabulary of the Unigram model. In JSON, it is represented as a pair
+// `[piece, score]`.
+type unigramPiece struct {
+	Piece string
+	Score float64
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p unigramPiece) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{p.Piece, p.Score})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *unigramPiece) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 2 {
+		return errors.Errorf("invalid Unigram vocabulary entry %s, expected [piece, score]", data)
+	}
+	if err := json.Unmarshal(raw[0], &p.Piece); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[1], &p.Score)
+}
+
+// unigramUnknownPenalty is subtracted from the minimum score of the vocabulary, to score unknown characters.
+const unigramUnknownPenalty = 10.0
+
+// unigramModel implements the SentencePiece Unigram model: each word is split into the sequence of pieces
+// that maximizes the sum of the pieces' scores (log-probabilities), using the Viterbi algorithm.
+type unigramModel struct {
+	Type         string         `json:"type"`
+	UnkID        *int           `json:"unk_id"`
+	ByteFallback bool           `json:"byte_fallback"`
+	Vocab        []unigramPiece `json:"vocab"`
+
+	pieces       map[string]int
+	maxPieceLen  int
+	unknownScore float64
+}
+
+func (m *unigramModel) init() error {
+	m.pieces = make(map[string]int, len(m.Vocab))
+	minScore := math.Inf(1)
+	for id, piece := range m.Vocab {
+		m.pieces[piece.Piece] = id
+		m.maxPieceLen = max(m.maxPieceLen, len(piece.Piece))
+		minScore = min(minScore, piece.Score)
+	}
+	m.unknownScore = minScore - unigramUnknownPenalty
+	if m.UnkID != nil && (*m.UnkID < 0 || *m.UnkID >= len(m.Vocab)) {
+		return errors.Errorf("Unigram unk_id=%d is out of the vocabulary range", *m.UnkID)
+	}
+	return nil
+}
+
+func (m *unigramModel) tokenToID(token string) (int, bool) {
+	id, found := m.pieces[token]
+	return id, found
+}
+
+func (m *unigramModel) idToToken(id int) (string, bool) {
+	if id < 0 || id >= len(m.Vocab) {
+		return "", false
+	}
+	return m.Vocab[id].Piece, true
+}
+
+func (m *unigramModel) vocabSize() int { return len(m.Vocab) }
+
+func (m *unigramModel) tokenize(text string) ([]token, error) {
+	if text == "" {
+		return nil, nil
+	}
+	// best[pos] holds the best segmentation of text[:pos]: its score, the start of the last piece and its id
+	// (-1 for unknown).
+	type node struct {
+		score     float64
+		start     int
+		id        int
+		reachable bool
+	}
+	best := make([]node, len(text)+1)
+	best[0].reachable = true
+	for start := 0; start < len(text); {
+		_, charSize := utf8.DecodeRuneInString(text[start:])
+		if best[start].reachable {
+			hasSingleChar := false
+			for end := start + 1; end <= len(text) && end-start <= m.maxPieceLen; end++ {
+				id, found := m.pieces[text[start:end]]
+				if !found {
+					continue
+				}
+				if end == start+charSize {
+					hasSingleChar = true
+				}
+				score := best[start].score + m.Vocab[id].Score
+				if !best[end].reachable || score > best[end].score {
+					best[end] = node{score: score, start: start, id: id, reachable: true}
+				}
+			}
+			if !hasSingleChar {
+				end := start + charSize
+				score := best[start].score + m.unknownScore
+				if !best[end].reachable || score > best[end].score {
+					best[end] = node{score: score, start: start, id: -1, reachable: true}
+				}
+			}
+		}
+		start += charSize
+	}
+
+	// Backtrack, merging consecutive unknown pieces.
+	var reversed []token
+	for end := len(text); end > 0; {
+		n := best[end]
+		if n.id < 0 && len(reversed) > 0 && reversed[len(reversed)-1].id < 0 {
+			reversed[len(reversed)-1].offsets[0] = n.start
+		} else {
+			reversed = append(reversed, token{id: n.id, offsets: [2]int{n.start, end}})
+		}
+		end = n.start
+	}
+	tokens := make([]token, 0, len(reversed))
+	for ii := len(reversed) - 1; ii >= 0; ii-- {
+		t := reversed[ii]
+		if t.id >= 0 {
+			t.value = m.Vocab[t.id].Piece
+			tokens = append(tokens, t)
+			continue
+		}
+		if m.ByteFallback {
+			byteTokens := make([]token, 0, t.offsets[1]-t.offsets[0])
+			for pos := t.offsets[0]; pos < t.offsets[1]; pos++ {
+				value := byteFallbackToken(text[pos])
+				if id, found := m.pieces[value]; found {
+					byteTokens = append(byteTokens, token{id: id, value: value, offsets: [2]int{pos, pos + 1}})
+				}
+			}
+			if len(byteTokens) == t.offsets[1]-t.offsets[0] {
+				tokens = append(tokens, byteTokens...)
+				continue
+			}
+		}
+		if m.UnkID == nil {
+			return nil, errors.Errorf("Unigram model can't tokenize %q: no unknown token defined", text[t.offsets[0]:t.offsets[1]])
+		}
+		t.id = *m.UnkID
+		t.value = m.Vocab[t.id].Piece
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,446 @@
+// Package hpsearch implements hyperparameter search over context hyperparameters.
+//
+// A search space (Space) is defined over context param keys, each with a distribution (Choice, Uniform, LogUniform or
+// Int). A Study then runs trials: for each trial a Sampler (Random, Grid or TPE) selects values for the
+// parameters, which are set in a new context, and the user's train function is called to train a model and return
+// the value of the objective (e.g., the validation loss).
+//
+// During training the trials can report intermediate values (see Trial.Report and Trial.AttachToLoop for
+// train.Loop), and a Pruner (e.g., ASHA) may decide to stop the trials that are not promising.
+//
+// If a directory is configured, the trials are persisted to it (one JSON file per trial), and running the study
+// again resumes it: finished trials are loaded, and the ones that were interrupted are run again.
+//
+// Trials can run in parallel goroutines, see Config.Parallelism. The train function is responsible for creating
+// (or sharing) the backend: backends can be shared by the concurrent trials.
+//
+// Example:
+//
+//	space := hpsearch.NewSpace(
+//		hpsearch.LogUniform(optimizers.ParamLearningRate, 1e-4, 1e-1),
+//		hpsearch.Int("num_layers", 1, 4),
+//		hpsearch.Choice("activation", "relu", "swish"))
+//	study, err := hpsearch.New(space).Dir("~/work/my_study").NumTrials(50).
+//		Sampler(hpsearch.TPE()).Pruner(hpsearch.ASHA(100, 3)).Parallelism(2).Done()
+//	if err != nil { ... }
+//	err = study.Run(func(ctx *context.Context, trial *hpsearch.Trial) (float64, error) {
+//		... create trainer and loop with ctx ...
+//		trial.AttachToLoop(loop, 100, evalLossFn)
+//		if _, err := loop.RunSteps(trainDS, 1000); err != nil {
+//			return 0, err  // It may be hpsearch.ErrPruned.
+//		}
+//		return evalLoss(), nil
+//	})
+//	fmt.Println(study.Best())
+package hpsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/fsutil"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// Direction of the optimization of the objective.
+type Direction int
+
+const (
+	Minimize Direction = iota
+	Maximize
+)
+
+// String implements fmt.Stringer.
+func (d Direction) String() string {
+	if d == Maximize {
+		return "maximize"
+	}
+	return "minimize"
+}
+
+// compare returns a negative number if a is better than b, positive if b is better than a, and 0 if they are equal.
+func (d Direction) compare(a, b float64) int {
+	if d == Maximize {
+		a, b = b, a
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// DefaultNumTrials is the default number of trials of a study. See Config.NumTrials.
+const DefaultNumTrials = 100
+
+// TrialFilePattern is the pattern (for fmt.Sprintf) of the name of the files where trials are persisted.
+const TrialFilePattern = "trial-%06d.json"
+
+// TrainFn is the user function that trains a model for a trial, and returns the value of the objective.
+//
+// ctx is a new context (see Config.ContextFn) with the trial hyperparameters set. If the trial is pruned
+// (see Trial.Report) it should return ErrPruned (possibly wrapped). Any other error (or panic) fails the trial,
+// but doesn't stop the study.
+type TrainFn func(ctx *context.Context, trial *Trial) (value float64, err error)
+
+// Config for a Study. Create it with New, configure it and call Done to create the Study.
+type Config struct {
+	space       *Space
+	dir         string
+	direction   Direction
+	sampler     Sampler
+	pruner      Pruner
+	numTrials   int
+	parallelism int
+	seed        uint64
+	contextFn   func() *context.Context
+}
+
+// New creates the configuration of a Study over the given search space.
+//
+// The defaults are: minimize the objective, Random sampler, no pruning, DefaultNumTrials trials, run sequentially,
+// results kept only in memory.
+func New(space *Space) *Config {
+	return &Config{
+		space:       space,
+		sampler:     Random(),
+		numTrials:   DefaultNumTrials,
+		parallelism: 1,
+		contextFn:   context.New,
+	}
+}
+
+// Dir sets the directory where the trials are persisted. If it already has trials, the study is resumed.
+// The directory is created if it doesn't exist. A "~" prefix is expanded to the user's home directory.
+func (c *Config) Dir(dir string) *Config {
+	c.dir = dir
+	return c
+}
+
+// Minimize the objective returned by the train function. This is the default.
+func (c *Config) Minimize() *Config {
+	c.direction = Minimize
+	return c
+}
+
+// Maximize the objective returned by the train function.
+func (c *Config) Maximize() *Config {
+	c.direction = Maximize
+	return c
+}
+
+// Sampler sets the strategy used to select the hyperparameter values of each trial: Random (the default), Grid or TPE.
+func (c *Config) Sampler(sampler Sampler) *Config {
+	c.sampler = sampler
+	return c
+}
+
+// Pruner sets the strategy used to stop trials early, based on their intermediate values. E.g.: ASHA.
+// The default is nil, meaning no pruning.
+func (c *Config) Pruner(pruner Pruner) *Config {
+	c.pruner = pruner
+	return c
+}
+
+// NumTrials sets the total number of trials of the study, including the ones loaded when resuming it.
+// Set it to -1 to run until the sampler is exhausted (only for Grid).
+// It defaults to DefaultNumTrials.
+func (c *Config) NumTrials(n int) *Config {
+	c.numTrials = n
+	return c
+}
+
+// Parallelism sets the number of trials run concurrently, each in its own goroutine. It defaults to 1.
+func (c *Config) Parallelism(n int) *Config {
+	c.parallelism = max(n, 1)
+	return c
+}
+
+// Seed for the random number generator used by the samplers.
+// When resuming a study, the seed is combined with the number of trials already run.
+func (c *Config) Seed(seed uint64) *Config {
+	c.seed = seed
+	return c
+}
+
+// ContextFn sets the function used to create the context of each trial, typically setting the default values
+// of all hyperparameters. The trial hyperparameter values are then set on top of it.
+// It defaults to context.New.
+func (c *Config) ContextFn(fn func() *context.Context) *Config {
+	c.contextFn = fn
+	return c
+}
+
+// Done creates the Study, loading the trials persisted in the directory, if one was configured.
+func (c *Config) Done() (*Study, error) {
+	if c.space == nil || len(c.space.Params) == 0 {
+		return nil, errors.New("hpsearch: the search space has no parameters")
+	}
+	if c.sampler == nil {
+		return nil, errors.New("hpsearch: no sampler configured")
+	}
+	if c.numTrials == -1 {
+		if _, isGrid := c.sampler.(*GridSampler); !isGrid {
+			return nil, errors.New("hpsearch: NumTrials(-1) can only be used with the Grid sampler")
+		}
+	} else if c.numTrials <= 0 {
+		return nil, errors.Errorf("hpsearch: invalid NumTrials(%d)", c.numTrials)
+	}
+	s := &Study{Config: c}
+	if c.dir != "" {
+		var err error
+		c.dir, err = fsutil.ReplaceTildeInDir(c.dir)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.MkdirAll(c.dir, 0o777); err != nil {
+			return nil, errors.Wrapf(err, "hpsearch: failed to create directory %q", c.dir)
+		}
+		if err = s.loadTrials(); err != nil {
+			return nil, err
+		}
+	}
+	s.rng = rand.New(rand.NewPCG(c.seed, uint64(len(s.trials))))
+	return s, nil
+}
+
+// Study runs the trials of a hyperparameter search. Create it with New.
+type Study struct {
+	*Config
+
+	mu      sync.Mutex
+	trials  []*Trial
+	resumed []*Trial // Trials interrupted in a previous run, to be run again.
+	rng     *rand.Rand
+	err     error // First error persisting trials.
+}
+
+// Trials returns a copy of all the trials of the study so far, ordered by ID.
+func (s *Study) Trials() []*Trial {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trials := make([]*Trial, len(s.trials))
+	for ii, trial := range s.trials {
+		trials[ii] = trial.clone()
+	}
+	return trials
+}
+
+// Best returns a copy of the completed trial with the best value, or nil if no trial has completed yet.
+func (s *Study) Best() *Trial {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best *Trial
+	for _, trial := range s.trials {
+		if trial.Status != StatusCompleted {
+			continue
+		}
+		if best == nil || s.direction.compare(trial.Value, best.Value) < 0 {
+			best = trial
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.clone()
+}
+
+// Run the trials of the study, calling trainFn for each of them, until the configured number of trials is reached
+// or the sampler is exhausted.
+//
+// Trials that fail don't stop the study: they are logged and recorded as StatusFailed.
+// It returns an error only if the trials couldn't be persisted.
+func (s *Study) Run(trainFn TrainFn) error {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, s.parallelism)
+	for {
+		slots <- struct{}{}
+		s.mu.Lock()
+		trial := s.nextTrial()
+		s.mu.Unlock()
+		if trial == nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.runTrial(trainFn, trial)
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// nextTrial returns the next trial to run, or nil if the study is finished. It must be called with s.mu locked.
+func (s *Study) nextTrial() *Trial {
+	if s.err != nil {
+		return nil
+	}
+	if len(s.resumed) > 0 {
+		trial := s.resumed[0]
+		s.resumed = s.resumed[1:]
+		return trial
+	}
+	if s.numTrials != -1 && len(s.trials) >= s.numTrials {
+		return nil
+	}
+	params := s.sampler.Sample(s.space, s.trials, s.direction, s.rng)
+	if params == nil {
+		return nil
+	}
+	trial := &Trial{
+		ID:     len(s.trials),
+		Params: params,
+		Status: StatusRunning,
+		Start:  time.Now(),
+		study:  s,
+	}
+	s.trials = append(s.trials, trial)
+	s.err = s.saveTrial(trial)
+	return trial
+}
+
+// runTrial calls trainFn for the trial, and records the result.
+func (s *Study) runTrial(trainFn TrainFn, trial *Trial) {
+	var value float64
+	var err error
+	exception := Try(func() {
+		ctx := s.contextFn()
+		ApplyParams(ctx, trial.Params)
+		value, err = trainFn(ctx, trial)
+	})
+	if exception != nil {
+		var ok bool
+		if err, ok = exception.(error); !ok {
+			err = errors.Errorf("panic: %v", exception)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trial.End = time.Now()
+	switch {
+	case errors.Is(err, ErrPruned):
+		trial.Status = StatusPruned
+		if len(trial.Intermediate) > 0 {
+			trial.Value = trial.lastIntermediate()
+		}
+		klog.V(1).Infof("hpsearch: %s", trial)
+	case err != nil:
+		trial.Status = StatusFailed
+		trial.Error = err.Error()
+		klog.Warningf("hpsearch: %s", trial)
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		trial.Status = StatusFailed
+		trial.Error = fmt.Sprintf("invalid objective value %g", value)
+		klog.Warningf("hpsearch: %s", trial)
+	default:
+		trial.Status = StatusCompleted
+		trial.Value = value
+		klog.V(1).Infof("hpsearch: %s", trial)
+	}
+	if err := s.saveTrial(trial); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// saveTrial persists the trial in the study directory, if one is configured. It must be called with s.mu locked.
+func (s *Study) saveTrial(trial *Trial) error {
+	if s.dir == "" {
+		return nil
+	}
+	contents, err := json.MarshalIndent(trial, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "hpsearch: failed to serialize trial #%d", trial.ID)
+	}
+	filePath := path.Join(s.dir, fmt.Sprintf(TrialFilePattern, trial.ID))
+	// Write to a temporary file and rename it, so a trial file is never left half-written.
+	tmpPath := filePath + ".tmp"
+	if err = os.WriteFile(tmpPath, contents, 0o666); err != nil {
+		return errors.Wrapf(err, "hpsearch: failed to write trial file %q", tmpPath)
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return errors.Wrapf(err, "hpsearch: failed to rename trial file %q to %q", tmpPath, filePath)
+	}
+	return nil
+}
+
+// loadTrials loads the trials persisted in the study directory. Trials that were still running are set
+// to be run again.
+func (s *Study) loadTrials() error {
+	filePaths, err := filepath.Glob(path.Join(s.dir, "trial-*.json"))
+	if err != nil {
+		return errors.Wrapf(err, "hpsearch: failed to list trials in %q", s.dir)
+	}
+	for _, filePath := range filePaths {
+		contents, err := os.ReadFile(filePath)
+		if err != nil {
+			return errors.Wrapf(err, "hpsearch: failed to read trial file %q", filePath)
+		}
+		trial := &Trial{study: s}
+		if err = json.Unmarshal(contents, trial); err != nil {
+			return errors.Wrapf(err, "hpsearch: failed to parse trial file %q", filePath)
+		}
+		trial.Params, err = s.space.normalize(trial.Params)
+		if err != nil {
+			return errors.WithMessagef(err, "hpsearch: trial file %q doesn't match the search space", filePath)
+		}
+		s.trials = append(s.trials, trial)
+	}
+	sort.Slice(s.trials, func(i, j int) bool { return s.trials[i].ID < s.trials[j].ID })
+	for ii, trial := range s.trials {
+		if trial.ID != ii {
+			return errors.Errorf("hpsearch: missing trial #%d in %q", ii, s.dir)
+		}
+		if !trial.Status.IsFinished() {
+			// Interrupted trial: it will be run again from scratch.
+			trial.Status = StatusRunning
+			trial.Intermediate = nil
+			trial.Start = time.Now()
+			s.resumed = append(s.resumed, trial)
+		}
+	}
+	if len(s.trials) > 0 {
+		klog.V(1).Infof("hpsearch: loaded %d trials from %q (%d to be resumed)", len(s.trials), s.dir, len(s.resumed))
+	}
+	return nil
+}
+
+// Summary returns a human-readable summary of the study: the number of trials in each status and the best trial.
+func (s *Study) Summary() string {
+	trials := s.Trials()
+	counts := make(map[TrialStatus]int)
+	for _, trial := range trials {
+		counts[trial.Status]++
+	}
+	var parts []string
+	for _, status := range []TrialStatus{StatusCompleted, StatusPruned, StatusFailed, StatusRunning} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	summary := fmt.Sprintf("%d trials (%s)", len(trials), strings.Join(parts, ", "))
+	if best := s.Best(); best != nil {
+		summary += fmt.Sprintf("; best: %s", best)
+	}
+	return summary
+}
@@ -0,0 +1,291 @@
+package hpsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpace(t *testing.T) {
+	space := NewSpace(
+		Choice("activation", "relu", "swish"),
+		LogUniform("/optimizer/learning_rate", 1e-4, 1e-2),
+		Uniform("dropout", 0, 0.5).GridPoints(2),
+		Int("num_layers", 1, 3))
+	assert.Equal(t, 2*3*2*3, space.GridSize())
+	assert.Equal(t, []any{1e-4, 1e-3, 1e-2}, roundFloats(space.Params[1].Grid()))
+	point := space.GridPoint(space.GridSize() - 1)
+	assert.Equal(t, "swish", point["activation"])
+	assert.InDelta(t, 1e-2, point["/optimizer/learning_rate"], 1e-9)
+	assert.Equal(t, 0.5, point["dropout"])
+	assert.Equal(t, 3, point["num_layers"])
+
+	rng := rand.New(rand.NewPCG(42, 0))
+	for range 100 {
+		values := space.Sample(rng)
+		lr := values["/optimizer/learning_rate"].(float64)
+		assert.True(t, lr >= 1e-4 && lr <= 1e-2, "learning_rate=%g", lr)
+		dropout := values["dropout"].(float64)
+		assert.True(t, dropout >= 0 && dropout <= 0.5, "dropout=%g", dropout)
+		numLayers := values["num_layers"].(int)
+		assert.True(t, numLayers >= 1 && numLayers <= 3, "num_layers=%d", numLayers)
+	}
+
+	// Values read back from JSON are converted to the parameter types.
+	values := space.Sample(rng)
+	contents, err := json.Marshal(values)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(contents, &decoded))
+	normalized, err := space.normalize(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, values, normalized)
+	decoded["activation"] = "tanh"
+	_, err = space.normalize(decoded)
+	require.Error(t, err)
+
+	// Parameters are set in their scopes.
+	ctx := context.New()
+	ApplyParams(ctx, values)
+	lr, found := ctx.InAbsPath("/optimizer").GetParam("learning_rate")
+	require.True(t, found)
+	assert.Equal(t, values["/optimizer/learning_rate"], lr)
+	assert.Equal(t, values["num_layers"], context.GetParamOr(ctx, "num_layers", 0))
+}
+
+func roundFloats(values []any) []any {
+	rounded := make([]any, len(values))
+	for ii, v := range values {
+		rounded[ii] = math.Round(v.(float64)*1e9) / 1e9
+	}
+	return rounded
+}
+
+// testSpace and testObjective define a simple problem with a known minimum of 0, at learning_rate=0.01, x=0 and
+// activation="relu".
+var testSpace = NewSpace(
+	LogUniform("learning_rate", 1e-5, 1),
+	Uniform("x", -1, 1),
+	Choice("activation", "relu", "swish", "tanh"))
+
+func testObjective(ctx *context.Context) float64 {
+	lr := context.GetParamOr(ctx, "learning_rate", 0.0)
+	x := context.GetParamOr(ctx, "x", 0.0)
+	value := math.Pow(math.Log10(lr)+2, 2) + x*x
+	if context.GetParamOr(ctx, "activation", "") != "relu" {
+		value += 1
+	}
+	return value
+}
+
+func TestSamplers(t *testing.T) {
+	trainFn := func(ctx *context.Context, _ *Trial) (float64, error) { return testObjective(ctx), nil }
+	for _, sampler := range []Sampler{Random(), TPE()} {
+		t.Run(fmt.Sprintf("%T", sampler), func(t *testing.T) {
+			study, err := New(testSpace).Sampler(sampler).NumTrials(100).Seed(1).Done()
+			require.NoError(t, err)
+			require.NoError(t, study.Run(trainFn))
+			trials := study.Trials()
+			require.Len(t, trials, 100)
+			for _, trial := range trials {
+				assert.Equal(t, StatusCompleted, trial.Status)
+			}
+			best := study.Best()
+			require.NotNil(t, best)
+			fmt.Printf("\t%T: %s\n", sampler, best)
+			assert.Less(t, best.Value, 1.2)
+		})
+	}
+
+	// TPE should do better than random search on average: compare the mean of the last 50 trials.
+	meanOfLast := func(sampler Sampler) float64 {
+		study, err := New(testSpace).Sampler(sampler).NumTrials(100).Seed(7).Done()
+		require.NoError(t, err)
+		require.NoError(t, study.Run(trainFn))
+		var sum float64
+		for _, trial := range study.Trials()[50:] {
+			sum += trial.Value
+		}
+		return sum / 50
+	}
+	randomMean, tpeMean := meanOfLast(Random()), meanOfLast(TPE())
+	fmt.Printf("\tMean of last 50 trials: random=%g, TPE=%g\n", randomMean, tpeMean)
+	assert.Less(t, tpeMean, randomMean)
+}
+
+func TestGrid(t *testing.T) {
+	space := NewSpace(Choice("activation", "relu", "swish"), Int("num_layers", 1, 3))
+	var count int
+	study, err := New(space).Sampler(Grid()).NumTrials(-1).Maximize().Done()
+	require.NoError(t, err)
+	require.NoError(t, study.Run(func(ctx *context.Context, _ *Trial) (float64, error) {
+		count++
+		return float64(context.GetParamOr(ctx, "num_layers", 0)), nil
+	}))
+	require.Equal(t, 6, count)
+	trials := study.Trials()
+	for ii, trial := range trials {
+		for _, other := range trials[:ii] {
+			assert.False(t, equalParams(trial.Params, other.Params), "trials %s and %s are the same", trial, other)
+		}
+	}
+	assert.Equal(t, 3, study.Best().Params["num_layers"])
+
+	// NumTrials(-1) is only valid for grid search.
+	_, err = New(space).NumTrials(-1).Done()
+	require.Error(t, err)
+}
+
+func TestASHA(t *testing.T) {
+	// The objective decreases with the number of steps, and otherwise only depends on quality (shuffled, so trials
+	// are not run in the order of their values). Trials are run sequentially, so the later ones can be pruned.
+	space := NewSpace(Int("quality", 0, 19))
+	study, err := New(space).Sampler(Grid()).NumTrials(-1).Pruner(ASHA(10, 2)).Done()
+	require.NoError(t, err)
+	var maxStepsRun []int
+	require.NoError(t, study.Run(func(ctx *context.Context, trial *Trial) (float64, error) {
+		quality := context.GetParamOr(ctx, "quality", 0)
+		value := func(step int) float64 { return float64((quality+7)%20) + 100/float64(step) }
+		for step := 5; step <= 80; step += 5 {
+			if err := trial.Report(step, value(step)); err != nil {
+				maxStepsRun = append(maxStepsRun, step)
+				return 0, errors.WithMessagef(err, "at step %d", step)
+			}
+		}
+		maxStepsRun = append(maxStepsRun, 80)
+		return value(80), nil
+	}))
+	trials := study.Trials()
+	require.Len(t, trials, 20)
+	var numPruned int
+	for ii, trial := range trials {
+		if trial.Status == StatusPruned {
+			numPruned++
+			assert.Less(t, maxStepsRun[ii], 80)
+			assert.Contains(t, []int{10, 20, 40, 80}, maxStepsRun[ii], "pruning must happen at the rungs")
+			assert.Equal(t, trial.Intermediate[len(trial.Intermediate)-1].Value, trial.Value)
+		} else {
+			require.Equal(t, StatusCompleted, trial.Status)
+		}
+	}
+	fmt.Printf("\t%s\n", study.Summary())
+	assert.Greater(t, numPruned, 5)
+	// The best trial (quality=13, value 0) must not have been pruned.
+	best := study.Best()
+	require.NotNil(t, best)
+	assert.Equal(t, 13, best.Params["quality"])
+	assert.Equal(t, 0, trials[0].ID)
+	assert.Equal(t, StatusCompleted, trials[0].Status, "first trial can't be pruned")
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	newStudy := func(numTrials int) *Study {
+		study, err := New(testSpace).Dir(dir).Sampler(TPE()).NumTrials(numTrials).Done()
+		require.NoError(t, err)
+		return study
+	}
+	var failedOnce bool
+	trainFn := func(ctx *context.Context, trial *Trial) (float64, error) {
+		if err := trial.Report(1, 10); err != nil {
+			return 0, err
+		}
+		if trial.ID == 1 && !failedOnce {
+			failedOnce = true
+			panic("training exploded")
+		}
+		return testObjective(ctx), nil
+	}
+	study := newStudy(3)
+	require.NoError(t, study.Run(trainFn))
+	trials := study.Trials()
+	require.Len(t, trials, 3)
+	assert.Equal(t, StatusFailed, trials[1].Status)
+	assert.Contains(t, trials[1].Error, "training exploded")
+	for ii := range 3 {
+		assert.FileExists(t, path.Join(dir, fmt.Sprintf(TrialFilePattern, ii)))
+	}
+
+	// Simulate trial #2 being interrupted.
+	trial2Path := path.Join(dir, fmt.Sprintf(TrialFilePattern, 2))
+	trial2 := trials[2]
+	trial2.Status = StatusRunning
+	contents, err := json.Marshal(trial2)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(trial2Path, contents, 0o666))
+
+	// Resume with 5 trials: trial #2 must be run again (with the same parameters), plus 2 new trials.
+	study = newStudy(5)
+	var runIDs []int
+	require.NoError(t, study.Run(func(ctx *context.Context, trial *Trial) (float64, error) {
+		runIDs = append(runIDs, trial.ID)
+		return trainFn(ctx, trial)
+	}))
+	assert.Equal(t, []int{2, 3, 4}, runIDs)
+	resumedTrials := study.Trials()
+	require.Len(t, resumedTrials, 5)
+	for ii, trial := range resumedTrials[:3] {
+		assert.Equal(t, trials[ii].Params, trial.Params)
+	}
+	assert.Equal(t, StatusFailed, resumedTrials[1].Status)
+	assert.Equal(t, StatusCompleted, resumedTrials[2].Status)
+	assert.Len(t, resumedTrials[2].Intermediate, 1)
+
+	// Nothing more to run.
+	study = newStudy(5)
+	require.NoError(t, study.Run(func(ctx *context.Context, trial *Trial) (float64, error) {
+		t.Fatalf("no trials should be run, but trial #%d was", trial.ID)
+		return 0, nil
+	}))
+	assert.Equal(t, resumedTrials[4].Value, study.Trials()[4].Value)
+
+	// Search space not matching the persisted trials.
+	_, err = New(NewSpace(Uniform("x", -1, 1))).Dir(dir).Done()
+	require.Error(t, err)
+}
+
+func TestParallel(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	study, err := New(testSpace).Parallelism(4).NumTrials(20).Pruner(ASHA(2, 2)).Done()
+	require.NoError(t, err)
+	require.NoError(t, study.Run(func(ctx *context.Context, trial *Trial) (float64, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		value := testObjective(ctx)
+		for step := 1; step <= 8; step++ {
+			time.Sleep(time.Millisecond)
+			if err := trial.Report(step, value+1/float64(step)); err != nil {
+				return 0, err
+			}
+		}
+		return value, nil
+	}))
+	trials := study.Trials()
+	require.Len(t, trials, 20)
+	for ii, trial := range trials {
+		assert.Equal(t, ii, trial.ID)
+		assert.Contains(t, []TrialStatus{StatusCompleted, StatusPruned}, trial.Status)
+	}
+	assert.LessOrEqual(t, maxRunning, 4)
+	assert.Greater(t, maxRunning, 1)
+	fmt.Printf("\t%s\n", study.Summary())
+}
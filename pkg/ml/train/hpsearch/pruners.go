@@ -0,0 +1,103 @@
+package hpsearch
+
+import (
+	. "github.com/gomlx/gomlx/internal/exceptions"
+)
+
+// Pruner decides whether a running trial should be stopped early, based on the intermediate values it reported
+// (see Trial.Report) and the ones reported by the other trials.
+//
+// Implementations: ASHA.
+type Pruner interface {
+	// ShouldPrune is called after each value reported by the trial (the last one in trial.Intermediate).
+	// trials include all trials of the study, including trial itself.
+	//
+	// It is called with the study locked, so it is never called concurrently, and it can read the trials.
+	ShouldPrune(trial *Trial, trials []*Trial, direction Direction) bool
+}
+
+// ASHAPruner implements the Asynchronous Successive Halving Algorithm (Li et al., 2018,
+// "A System for Massively Parallel Hyperparameter Tuning").
+//
+// Trials are compared at "rungs", at the steps MinSteps * ReductionFactor^k (k=0, 1, ...). When a trial reaches a rung,
+// it only continues if its value is in the top 1/ReductionFactor of the values of all trials that reached that
+// rung so far -- or if it is the best one, when fewer than ReductionFactor trials reached it.
+//
+// The value of a trial at a rung is the first value it reported at a step >= the rung step.
+type ASHAPruner struct {
+	MinSteps, ReductionFactor int
+}
+
+// ASHA creates an Asynchronous Successive Halving pruner. See ASHAPruner.
+//
+// minSteps is the step of the first rung, and reductionFactor (typically 3 or 4) is both the ratio between the steps of
+// consecutive rungs and the inverse of the fraction of trials promoted at each rung.
+func ASHA(minSteps, reductionFactor int) *ASHAPruner {
+	if minSteps < 1 || reductionFactor < 2 {
+		Panicf("hpsearch.ASHA(minSteps=%d, reductionFactor=%d) requires minSteps >= 1 and reductionFactor >= 2",
+			minSteps, reductionFactor)
+	}
+	return &ASHAPruner{MinSteps: minSteps, ReductionFactor: reductionFactor}
+}
+
+// rungStep returns the step of the rung.
+func (a *ASHAPruner) rungStep(rung int) int {
+	step := a.MinSteps
+	for range rung {
+		step *= a.ReductionFactor
+	}
+	return step
+}
+
+// rungValue returns the value of the trial at the rung, and whether the trial reached it.
+func (a *ASHAPruner) rungValue(trial *Trial, rung int) (float64, bool) {
+	step := a.rungStep(rung)
+	for _, iv := range trial.Intermediate {
+		if iv.Step >= step {
+			return iv.Value, true
+		}
+	}
+	return 0, false
+}
+
+// ShouldPrune implements Pruner.
+func (a *ASHAPruner) ShouldPrune(trial *Trial, trials []*Trial, direction Direction) bool {
+	numReports := len(trial.Intermediate)
+	if numReports == 0 {
+		return false
+	}
+	lastStep := trial.Intermediate[numReports-1].Step
+	prevStep := -1
+	if numReports > 1 {
+		prevStep = trial.Intermediate[numReports-2].Step
+	}
+
+	// Find the highest rung just reached by the last report: decisions are only taken when a rung is reached.
+	rung := -1
+	for k := 0; a.rungStep(k) <= lastStep; k++ {
+		if a.rungStep(k) > prevStep {
+			rung = k
+		}
+	}
+	if rung < 0 {
+		return false
+	}
+
+	value, _ := a.rungValue(trial, rung)
+	var numBetter, numCompeting int
+	for _, other := range trials {
+		if other == trial {
+			continue
+		}
+		otherValue, found := a.rungValue(other, rung)
+		if !found {
+			continue
+		}
+		numCompeting++
+		if direction.compare(otherValue, value) < 0 {
+			numBetter++
+		}
+	}
+	numPromoted := max(1, (numCompeting+1)/a.ReductionFactor)
+	return numBetter >= numPromoted
+}
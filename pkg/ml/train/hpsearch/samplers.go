@@ -0,0 +1,219 @@
+package hpsearch
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Sampler selects the hyperparameter values for the next trial.
+//
+// Implementations: Random, Grid and TPE.
+type Sampler interface {
+	// Sample returns the values (indexed by Param.Key) for the next trial, given the trials so far
+	// (including the ones still running). It returns nil if there are no more values to try.
+	//
+	// It is called with the study locked, so it is never called concurrently, and it can read the trials.
+	Sample(space *Space, trials []*Trial, direction Direction, rng *rand.Rand) map[string]any
+}
+
+// RandomSampler samples the values of each parameter independently from their distributions.
+type RandomSampler struct{}
+
+// Random search sampler.
+func Random() *RandomSampler { return &RandomSampler{} }
+
+// Sample implements Sampler.
+func (*RandomSampler) Sample(space *Space, _ []*Trial, _ Direction, rng *rand.Rand) map[string]any {
+	return space.Sample(rng)
+}
+
+// GridSampler enumerates all combinations of the values of the parameters (see Param.Grid), in order.
+// Combinations already used by previous trials (e.g., when resuming a study) are skipped.
+type GridSampler struct{}
+
+// Grid search sampler. The study ends when all combinations were tried.
+func Grid() *GridSampler { return &GridSampler{} }
+
+// Sample implements Sampler.
+func (*GridSampler) Sample(space *Space, trials []*Trial, _ Direction, _ *rand.Rand) map[string]any {
+	for idx := range space.GridSize() {
+		values := space.GridPoint(idx)
+		used := slices.ContainsFunc(trials, func(trial *Trial) bool { return equalParams(trial.Params, values) })
+		if !used {
+			return values
+		}
+	}
+	return nil
+}
+
+// TPESampler implements the Tree-structured Parzen Estimator (Bergstra et al., 2011,
+// "Algorithms for Hyper-Parameter Optimization").
+//
+// The completed trials are split into the "good" ones (the best Gamma fraction) and the others, and a density
+// is estimated for each parameter on each group: l(x) for the good and g(x) for the others. Candidates are sampled
+// from l(x) and the one maximizing l(x)/g(x) is selected. Parameters are modeled independently.
+//
+// Until NumStartup trials completed, values are sampled randomly.
+type TPESampler struct {
+	// NumStartup is the number of completed trials before the TPE is used: before that values are sampled randomly.
+	NumStartup int
+
+	// Gamma is the fraction of the completed trials considered "good".
+	Gamma float64
+
+	// NumCandidates sampled from l(x) for each parameter.
+	NumCandidates int
+}
+
+// TPE creates a Tree-structured Parzen Estimator sampler with default values. See TPESampler.
+func TPE() *TPESampler {
+	return &TPESampler{NumStartup: 10, Gamma: 0.25, NumCandidates: 24}
+}
+
+// Sample implements Sampler.
+func (tpe *TPESampler) Sample(space *Space, trials []*Trial, direction Direction, rng *rand.Rand) map[string]any {
+	var completed []*Trial
+	for _, trial := range trials {
+		if trial.Status == StatusCompleted {
+			completed = append(completed, trial)
+		}
+	}
+	if len(completed) < max(tpe.NumStartup, 2) {
+		return space.Sample(rng)
+	}
+	slices.SortStableFunc(completed, func(a, b *Trial) int {
+		return direction.compare(a.Value, b.Value)
+	})
+	numGood := max(1, int(math.Ceil(tpe.Gamma*float64(len(completed)))))
+	good, bad := completed[:numGood], completed[numGood:]
+
+	values := make(map[string]any, len(space.Params))
+	for _, p := range space.Params {
+		if p.Kind == KindChoice {
+			values[p.Key] = tpe.sampleChoice(p, good, bad, rng)
+		} else {
+			values[p.Key] = tpe.sampleNumeric(p, good, bad, rng)
+		}
+	}
+	return values
+}
+
+// sampleChoice samples a KindChoice parameter: the densities are the frequencies of the choices (plus a prior of 1).
+func (tpe *TPESampler) sampleChoice(p *Param, good, bad []*Trial, rng *rand.Rand) any {
+	weights := func(trials []*Trial) []float64 {
+		w := make([]float64, len(p.choices))
+		for ii := range w {
+			w[ii] = 1
+		}
+		for _, trial := range trials {
+			if idx := p.choiceIndex(trial.Params[p.Key]); idx >= 0 {
+				w[idx]++
+			}
+		}
+		total := float64(len(trials) + len(p.choices))
+		for ii := range w {
+			w[ii] /= total
+		}
+		return w
+	}
+	l, g := weights(good), weights(bad)
+	bestIdx, bestScore := 0, math.Inf(-1)
+	for range tpe.NumCandidates {
+		// Sample from l.
+		r := rng.Float64()
+		idx := 0
+		for ; idx < len(l)-1; idx++ {
+			r -= l[idx]
+			if r < 0 {
+				break
+			}
+		}
+		score := math.Log(l[idx]) - math.Log(g[idx])
+		if score > bestScore {
+			bestIdx, bestScore = idx, score
+		}
+	}
+	return p.choices[bestIdx]
+}
+
+// sampleNumeric samples a KindUniform, KindLogUniform or KindInt parameter, using Parzen estimators in the
+// internal representation of the parameter.
+func (tpe *TPESampler) sampleNumeric(p *Param, good, bad []*Trial, rng *rand.Rand) any {
+	low, high := p.lowInternal(), p.highInternal()
+	if low == high {
+		return p.fromInternal(low)
+	}
+	observations := func(trials []*Trial) []float64 {
+		obs := make([]float64, 0, len(trials))
+		for _, trial := range trials {
+			obs = append(obs, p.toInternal(trial.Params[p.Key]))
+		}
+		return obs
+	}
+	l := newParzenEstimator(observations(good), low, high)
+	g := newParzenEstimator(observations(bad), low, high)
+	var best float64
+	bestScore := math.Inf(-1)
+	for range tpe.NumCandidates {
+		x := l.sample(rng)
+		score := l.logPDF(x) - g.logPDF(x)
+		if score > bestScore {
+			best, bestScore = x, score
+		}
+	}
+	return p.fromInternal(best)
+}
+
+// parzenEstimator is a mixture of truncated gaussians (to [low, high]) with equal weights: one centered at each
+// observation, plus a prior centered in the middle of the range.
+type parzenEstimator struct {
+	mus, sigmas []float64
+	low, high   float64
+}
+
+func newParzenEstimator(observations []float64, low, high float64) *parzenEstimator {
+	mus := append(slices.Clone(observations), (low+high)/2)
+	slices.Sort(mus)
+	width := high - low
+	minSigma := width / min(100, float64(1+len(mus)))
+	sigmas := make([]float64, len(mus))
+	for ii, mu := range mus {
+		// The bandwidth of each component is the largest distance to its neighbours (or range limits).
+		left, right := low, high
+		if ii > 0 {
+			left = mus[ii-1]
+		}
+		if ii < len(mus)-1 {
+			right = mus[ii+1]
+		}
+		sigmas[ii] = min(max(mu-left, right-mu, minSigma), width)
+	}
+	return &parzenEstimator{mus: mus, sigmas: sigmas, low: low, high: high}
+}
+
+// sample a value from the mixture.
+func (pe *parzenEstimator) sample(rng *rand.Rand) float64 {
+	idx := rng.IntN(len(pe.mus))
+	for range 100 {
+		x := pe.mus[idx] + rng.NormFloat64()*pe.sigmas[idx]
+		if x >= pe.low && x <= pe.high {
+			return x
+		}
+	}
+	return min(max(pe.mus[idx], pe.low), pe.high)
+}
+
+// logPDF returns the log of the probability density at x.
+func (pe *parzenEstimator) logPDF(x float64) float64 {
+	normalCDF := func(z float64) float64 { return 0.5 * (1 + math.Erf(z/math.Sqrt2)) }
+	var pdf float64
+	for ii, mu := range pe.mus {
+		sigma := pe.sigmas[ii]
+		z := (x - mu) / sigma
+		truncation := normalCDF((pe.high-mu)/sigma) - normalCDF((pe.low-mu)/sigma)
+		pdf += math.Exp(-0.5*z*z) / (sigma * math.Sqrt(2*math.Pi) * max(truncation, 1e-12))
+	}
+	pdf /= float64(len(pe.mus))
+	return math.Log(max(pdf, 1e-300))
+}
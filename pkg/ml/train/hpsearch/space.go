@@ -0,0 +1,345 @@
+package hpsearch
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	. "github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+)
+
+// ParamKind enumerates the types of distributions of a search space parameter.
+type ParamKind int
+
+const (
+	// KindChoice is a categorical parameter, that takes one of a list of values. See Choice.
+	KindChoice ParamKind = iota
+
+	// KindUniform is a float64 parameter sampled uniformly from a range. See Uniform.
+	KindUniform
+
+	// KindLogUniform is a float64 parameter whose logarithm is sampled uniformly from a range. See LogUniform.
+	KindLogUniform
+
+	// KindInt is an int parameter sampled uniformly from a range. See Int.
+	KindInt
+)
+
+// String implements fmt.Stringer.
+func (k ParamKind) String() string {
+	switch k {
+	case KindChoice:
+		return "choice"
+	case KindUniform:
+		return "uniform"
+	case KindLogUniform:
+		return "log-uniform"
+	case KindInt:
+		return "int"
+	}
+	return fmt.Sprintf("ParamKind(%d)", int(k))
+}
+
+// DefaultGridPoints is the number of values used by the grid search for KindUniform and KindLogUniform parameters.
+// It can be changed per parameter with Param.GridPoints.
+const DefaultGridPoints = 3
+
+// Param defines the distribution of one hyperparameter in the search space.
+//
+// It is created with Choice, Uniform, LogUniform or Int.
+type Param struct {
+	// Key of the context hyperparameter. It may include a scope, e.g. "/layer_1/l2_regularization",
+	// otherwise it is set in the root scope.
+	Key string
+
+	// Kind of distribution.
+	Kind ParamKind
+
+	choices    []any
+	min, max   float64
+	gridPoints int
+}
+
+// Choice creates a categorical parameter that takes one of the given values.
+// The values are set as is in the context, so they should match the type expected by the model (e.g.: "relu", 0.1 or 3).
+func Choice(key string, values ...any) *Param {
+	if len(values) == 0 {
+		Panicf("hpsearch.Choice(%q) requires at least one value", key)
+	}
+	return &Param{Key: key, Kind: KindChoice, choices: values}
+}
+
+// Uniform creates a float64 parameter sampled uniformly in the range [min, max].
+func Uniform(key string, min, max float64) *Param {
+	if min > max {
+		Panicf("hpsearch.Uniform(%q, %g, %g) requires min <= max", key, min, max)
+	}
+	return &Param{Key: key, Kind: KindUniform, min: min, max: max, gridPoints: DefaultGridPoints}
+}
+
+// LogUniform creates a float64 parameter whose logarithm is sampled uniformly in the range [log(min), log(max)].
+// It's the usual choice for learning rates and regularization factors.
+func LogUniform(key string, min, max float64) *Param {
+	if min <= 0 || min > max {
+		Panicf("hpsearch.LogUniform(%q, %g, %g) requires 0 < min <= max", key, min, max)
+	}
+	return &Param{Key: key, Kind: KindLogUniform, min: min, max: max, gridPoints: DefaultGridPoints}
+}
+
+// Int creates an int parameter sampled uniformly from min to max, both inclusive.
+func Int(key string, min, max int) *Param {
+	if min > max {
+		Panicf("hpsearch.Int(%q, %d, %d) requires min <= max", key, min, max)
+	}
+	return &Param{Key: key, Kind: KindInt, min: float64(min), max: float64(max)}
+}
+
+// GridPoints sets the number of values, evenly spaced (in log-scale for LogUniform), used by the grid search for
+// Uniform and LogUniform parameters. It defaults to DefaultGridPoints.
+//
+// It returns the Param itself, so calls can be cascaded.
+func (p *Param) GridPoints(n int) *Param {
+	if n < 1 {
+		Panicf("hpsearch.Param(%q).GridPoints(%d) requires n >= 1", p.Key, n)
+	}
+	p.gridPoints = n
+	return p
+}
+
+// Choices returns the values of a KindChoice parameter.
+func (p *Param) Choices() []any {
+	return p.choices
+}
+
+// Range returns the min and max values of KindUniform, KindLogUniform and KindInt parameters.
+func (p *Param) Range() (min, max float64) {
+	return p.min, p.max
+}
+
+// String implements fmt.Stringer.
+func (p *Param) String() string {
+	switch p.Kind {
+	case KindChoice:
+		return fmt.Sprintf("%s: choice%v", p.Key, p.choices)
+	case KindInt:
+		return fmt.Sprintf("%s: int[%d, %d]", p.Key, int(p.min), int(p.max))
+	default:
+		return fmt.Sprintf("%s: %s[%g, %g]", p.Key, p.Kind, p.min, p.max)
+	}
+}
+
+// Sample a random value for the parameter.
+func (p *Param) Sample(rng *rand.Rand) any {
+	switch p.Kind {
+	case KindChoice:
+		return p.choices[rng.IntN(len(p.choices))]
+	case KindInt:
+		return int(p.min) + rng.IntN(int(p.max)-int(p.min)+1)
+	default:
+		return p.fromInternal(p.lowInternal() + rng.Float64()*(p.highInternal()-p.lowInternal()))
+	}
+}
+
+// Grid returns the values used by the grid search.
+func (p *Param) Grid() []any {
+	switch p.Kind {
+	case KindChoice:
+		return p.choices
+	case KindInt:
+		values := make([]any, 0, int(p.max)-int(p.min)+1)
+		for ii := int(p.min); ii <= int(p.max); ii++ {
+			values = append(values, ii)
+		}
+		return values
+	default:
+		if p.gridPoints == 1 || p.min == p.max {
+			return []any{p.fromInternal((p.lowInternal() + p.highInternal()) / 2)}
+		}
+		values := make([]any, p.gridPoints)
+		low, high := p.lowInternal(), p.highInternal()
+		for ii := range values {
+			values[ii] = p.fromInternal(low + float64(ii)*(high-low)/float64(p.gridPoints-1))
+		}
+		return values
+	}
+}
+
+// lowInternal and highInternal return the range of the parameter in the internal (numeric) representation:
+// log-scale for KindLogUniform, and with 0.5 margins for KindInt, so rounding gives each int the same probability.
+func (p *Param) lowInternal() float64 {
+	switch p.Kind {
+	case KindLogUniform:
+		return math.Log(p.min)
+	case KindInt:
+		return p.min - 0.5
+	}
+	return p.min
+}
+
+func (p *Param) highInternal() float64 {
+	switch p.Kind {
+	case KindLogUniform:
+		return math.Log(p.max)
+	case KindInt:
+		return p.max + 0.5
+	}
+	return p.max
+}
+
+// toInternal converts a numeric value of the parameter to its internal representation.
+func (p *Param) toInternal(value any) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		if p.Kind == KindLogUniform {
+			return math.Log(v)
+		}
+		return v
+	}
+	Panicf("hpsearch parameter %q: unexpected value %v (%T)", p.Key, value, value)
+	return 0
+}
+
+// fromInternal converts from the internal representation to the value of the parameter.
+func (p *Param) fromInternal(x float64) any {
+	x = min(max(x, p.lowInternal()), p.highInternal())
+	switch p.Kind {
+	case KindLogUniform:
+		return min(max(math.Exp(x), p.min), p.max)
+	case KindInt:
+		return int(min(max(math.Round(x), p.min), p.max))
+	}
+	return x
+}
+
+// choiceIndex returns the index of value in the choices of a KindChoice parameter, or -1 if not found.
+// Values are compared by their string representation, so it works with values read back from JSON.
+func (p *Param) choiceIndex(value any) int {
+	valueStr := fmt.Sprintf("%v", value)
+	return slices.IndexFunc(p.choices, func(choice any) bool {
+		return fmt.Sprintf("%v", choice) == valueStr
+	})
+}
+
+// normalize converts a value read from a JSON file (where numbers are float64) back to the type of the parameter.
+func (p *Param) normalize(value any) (any, error) {
+	switch p.Kind {
+	case KindChoice:
+		idx := p.choiceIndex(value)
+		if idx < 0 {
+			return nil, errors.Errorf("value %v for parameter %q is not one of its choices %v", value, p.Key, p.choices)
+		}
+		return p.choices[idx], nil
+	case KindInt:
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			return int(f), nil
+		}
+		if i, ok := value.(int); ok {
+			return i, nil
+		}
+	default:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+	}
+	return nil, errors.Errorf("invalid value %v (%T) for %s parameter %q", value, value, p.Kind, p.Key)
+}
+
+// Space is the search space: the list of hyperparameters to search over.
+type Space struct {
+	Params []*Param
+}
+
+// NewSpace creates a search space with the given parameters. The keys must be unique.
+func NewSpace(params ...*Param) *Space {
+	keys := make(map[string]bool, len(params))
+	for _, p := range params {
+		if keys[p.Key] {
+			Panicf("hpsearch.NewSpace(): parameter %q defined more than once", p.Key)
+		}
+		keys[p.Key] = true
+	}
+	return &Space{Params: params}
+}
+
+// Sample random values for all parameters of the space.
+func (s *Space) Sample(rng *rand.Rand) map[string]any {
+	values := make(map[string]any, len(s.Params))
+	for _, p := range s.Params {
+		values[p.Key] = p.Sample(rng)
+	}
+	return values
+}
+
+// GridSize returns the number of combinations of the grid search.
+func (s *Space) GridSize() int {
+	size := 1
+	for _, p := range s.Params {
+		size *= len(p.Grid())
+	}
+	return size
+}
+
+// GridPoint returns the values for the combination idx of the grid search, for 0 <= idx < GridSize().
+// The last parameter changes the fastest.
+func (s *Space) GridPoint(idx int) map[string]any {
+	values := make(map[string]any, len(s.Params))
+	for ii := len(s.Params) - 1; ii >= 0; ii-- {
+		p := s.Params[ii]
+		grid := p.Grid()
+		values[p.Key] = grid[idx%len(grid)]
+		idx /= len(grid)
+	}
+	return values
+}
+
+// normalize the values read from a JSON file. See Param.normalize.
+func (s *Space) normalize(values map[string]any) (map[string]any, error) {
+	if len(values) != len(s.Params) {
+		return nil, errors.Errorf("%d parameters given, but the search space has %d", len(values), len(s.Params))
+	}
+	normalized := make(map[string]any, len(values))
+	for _, p := range s.Params {
+		value, found := values[p.Key]
+		if !found {
+			return nil, errors.Errorf("parameter %q of the search space is missing", p.Key)
+		}
+		var err error
+		normalized[p.Key], err = p.normalize(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// ApplyParams sets the hyperparameters values in the context. Keys with a scope (e.g.: "/layer_1/dropout_rate")
+// are set in the corresponding scope, others in the root scope.
+func ApplyParams(ctx *context.Context, values map[string]any) {
+	for key, value := range values {
+		scope, name := context.SplitScope(key)
+		if scope == "" {
+			ctx.InAbsPath(context.RootScope).SetParam(name, value)
+		} else {
+			ctx.InAbsPath(scope).SetParam(name, value)
+		}
+	}
+}
+
+// equalParams returns whether the two sets of parameter values are the same.
+func equalParams(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, valueA := range a {
+		valueB, found := b[key]
+		if !found || fmt.Sprintf("%v", valueA) != fmt.Sprintf("%v", valueB) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package hpsearch
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/pkg/errors"
+)
+
+// ErrPruned is returned by Trial.Report (and by the train.Loop hook installed by Trial.AttachToLoop) when the
+// Pruner decided the trial should be stopped early. The train function should return it (possibly wrapped),
+// and the trial is then recorded as StatusPruned.
+var ErrPruned = errors.New("trial pruned")
+
+// TrialStatus is the state of a trial.
+type TrialStatus string
+
+const (
+	StatusRunning   TrialStatus = "running"
+	StatusCompleted TrialStatus = "completed"
+	StatusPruned    TrialStatus = "pruned"
+	StatusFailed    TrialStatus = "failed"
+)
+
+// IsFinished returns whether the trial finished, successfully or not.
+func (s TrialStatus) IsFinished() bool {
+	return s == StatusCompleted || s == StatusPruned || s == StatusFailed
+}
+
+// IntermediateValue is a metric value reported by a trial during training. See Trial.Report.
+type IntermediateValue struct {
+	Step  int     `json:"step"`
+	Value float64 `json:"value"`
+}
+
+// Trial is one evaluation of the train function with a set of hyperparameter values.
+//
+// Its fields are serialized (as JSON) to the study directory: they are meant for reading only,
+// and they should only be accessed while the trial is running by the train function itself.
+// To get a consistent copy of the trials of a Study use Study.Trials.
+type Trial struct {
+	// ID of the trial, sequential starting from 0.
+	ID int `json:"id"`
+
+	// Params are the hyperparameter values for this trial, indexed by the Param.Key.
+	Params map[string]any `json:"params"`
+
+	Status TrialStatus `json:"status"`
+
+	// Value of the objective returned by the train function, for completed trials.
+	// For pruned trials it's the last reported intermediate value.
+	Value float64 `json:"value"`
+
+	// Intermediate values reported with Trial.Report.
+	Intermediate []IntermediateValue `json:"intermediate,omitempty"`
+
+	// Error message, for failed trials.
+	Error string `json:"error,omitempty"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitzero"`
+
+	study *Study
+}
+
+// String implements fmt.Stringer.
+func (t *Trial) String() string {
+	switch t.Status {
+	case StatusCompleted, StatusPruned:
+		return fmt.Sprintf("Trial #%d (%s, value=%g): %v", t.ID, t.Status, t.Value, t.Params)
+	case StatusFailed:
+		return fmt.Sprintf("Trial #%d (%s: %s): %v", t.ID, t.Status, t.Error, t.Params)
+	}
+	return fmt.Sprintf("Trial #%d (%s): %v", t.ID, t.Status, t.Params)
+}
+
+// clone makes a copy of the trial that can be read without locks.
+func (t *Trial) clone() *Trial {
+	newT := *t
+	newT.Params = make(map[string]any, len(t.Params))
+	for key, value := range t.Params {
+		newT.Params[key] = value
+	}
+	newT.Intermediate = append([]IntermediateValue(nil), t.Intermediate...)
+	newT.study = nil
+	return &newT
+}
+
+// lastIntermediate returns the last intermediate value reported, or NaN if none were reported.
+func (t *Trial) lastIntermediate() float64 {
+	if len(t.Intermediate) == 0 {
+		return math.NaN()
+	}
+	return t.Intermediate[len(t.Intermediate)-1].Value
+}
+
+// Report an intermediate value of the objective (e.g.: an evaluation metric) at the given training step,
+// typically the train.Loop global step. Steps should be increasing.
+//
+// The value is recorded (and persisted) and the study Pruner decides whether the trial should be stopped:
+// in which case it returns ErrPruned, which the train function should return.
+//
+// If the study is being maximized, the value is still reported as is: the pruner handles the direction.
+// Non-finite values (NaN or infinity, e.g. from a diverging training) are rejected with an error.
+func (t *Trial) Report(step int, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errors.Errorf("trial #%d reported invalid value %g at step %d", t.ID, value, step)
+	}
+	s := t.study
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Intermediate = append(t.Intermediate, IntermediateValue{Step: step, Value: value})
+	if err := s.saveTrial(t); err != nil {
+		return err
+	}
+	if s.pruner != nil && s.pruner.ShouldPrune(t, s.trials, s.direction) {
+		return ErrPruned
+	}
+	return nil
+}
+
+// MetricFn returns the value to report to a trial, given the train.Loop and the metrics of the last training step.
+// See Trial.AttachToLoop.
+type MetricFn func(loop *train.Loop, metrics []*tensors.Tensor) (float64, error)
+
+// AttachToLoop registers an OnStep hook in the loop that, every n steps, reports the value returned by metricFn to
+// the trial (see Trial.Report). If the trial is pruned, the hook returns ErrPruned, which interrupts the loop:
+// the error returned by train.Loop.RunSteps will wrap it, and it can be returned as is by the train function.
+//
+// metricFn can be created with TrainMetric, or it can run an evaluation, e.g.:
+//
+//	trial.AttachToLoop(loop, 100, func(loop *train.Loop, _ []*tensors.Tensor) (float64, error) {
+//		metrics, err := loop.Trainer.Eval(validationDS)
+//		if err != nil {
+//			return 0, err
+//		}
+//		return shapes.ConvertTo[float64](metrics[0].Value()), nil
+//	})
+func (t *Trial) AttachToLoop(loop *train.Loop, n int, metricFn MetricFn) {
+	train.EveryNSteps(loop, n, fmt.Sprintf("hpsearch trial #%d", t.ID), 0,
+		func(loop *train.Loop, metrics []*tensors.Tensor) error {
+			value, err := metricFn(loop, metrics)
+			if err != nil {
+				return err
+			}
+			return t.Report(loop.LoopStep, value)
+		})
+}
+
+// TrainMetric returns a MetricFn that reports the metric with the given index of the train step: by default
+// index 0 is the batch loss and 1 is the moving average of the loss (see train.Trainer.TrainMetrics).
+func TrainMetric(index int) MetricFn {
+	return func(loop *train.Loop, metrics []*tensors.Tensor) (float64, error) {
+		if index < 0 || index >= len(metrics) {
+			return 0, errors.Errorf("hpsearch.TrainMetric(%d): train step only has %d metrics", index, len(metrics))
+		}
+		metric := metrics[index]
+		if metric.Shape().Size() != 1 || !(metric.DType().IsFloat() || metric.DType().IsInt()) {
+			return 0, errors.Errorf("hpsearch.TrainMetric(%d): metric must be a numeric scalar, got shape %s",
+				index, metric.Shape())
+		}
+		return shapes.ConvertTo[float64](metric.Value()), nil
+	}
+}
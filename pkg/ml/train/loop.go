@@ -21,6 +21,7 @@ import (
 	"math"
 	"slices"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	. "github.com/gomlx/gomlx/internal/exceptions"
@@ -97,6 +98,9 @@ type Loop struct {
 	onStep  *priorityHooks[*hookWithName[OnStepFn]]
 	onEnd   *priorityHooks[*hookWithName[OnEndFn]]
 
+	// stopRequested is set by Loop.Stop, and checked after each step.
+	stopRequested atomic.Bool
+
 	// finalizeYieldedTrainTensors indicates whether the training datasets yielded tensors should be finalized.
 	// True by default.
 	finalizeYieldedTrainTensors bool
@@ -278,6 +282,7 @@ func (loop *Loop) RunSteps(ds Dataset, steps int) (metrics []*tensors.Tensor, er
 		return
 	}
 	loop.finalizeYieldedTrainTensors = finalizeYieldedTensors(ds)
+	loop.stopRequested.Store(false)
 	loop.StartStep = loop.LoopStep
 	loop.setLastStep(loop.LoopStep + steps)
 	err = loop.start(ds)
@@ -313,6 +318,10 @@ func (loop *Loop) RunSteps(ds Dataset, steps int) (metrics []*tensors.Tensor, er
 		if err != nil {
 			return nil, errors.WithMessagef(err, "Loop.RunSteps(%d): failed TrainStep(LoopStep=%d)", steps, loop.LoopStep)
 		}
+		if loop.stopRequested.Load() {
+			// Graceful stop: this was the last step.
+			loop.setLastStep(loop.LoopStep + 1)
+		}
 	}
 	for _, metric := range metrics {
 		// Transfer results locally and immediately free on-device storage.
@@ -340,6 +349,7 @@ func (loop *Loop) RunEpochs(ds Dataset, epochs int) (metrics []*tensors.Tensor,
 		return
 	}
 	loop.finalizeYieldedTrainTensors = finalizeYieldedTensors(ds)
+	loop.stopRequested.Store(false)
 	loop.StartStep = loop.LoopStep
 	loop.setLastStep(-1)
 	loop.Epoch = 0
@@ -381,6 +391,14 @@ func (loop *Loop) RunEpochs(ds Dataset, epochs int) (metrics []*tensors.Tensor,
 				return nil, errors.WithMessagef(err, "Loop.RunEpochs(%d): failed reading from Dataset (LoopStep=%d)", epochs, loop.LoopStep)
 			}
 			loop.LoopStep++
+			if loop.stopRequested.Load() {
+				break
+			}
+		}
+		if loop.stopRequested.Load() {
+			// Graceful stop: the dataset is not reset, since the epoch may not have been finished.
+			loop.setLastStep(loop.LoopStep)
+			break
 		}
 		ds.Reset()
 	}
@@ -391,6 +409,20 @@ func (loop *Loop) RunEpochs(ds Dataset, epochs int) (metrics []*tensors.Tensor,
 	return
 }
 
+// Stop requests the loop to stop gracefully after the current training step: EndStep is adjusted to the
+// next step, and the run (Loop.RunSteps or Loop.RunEpochs) returns normally, after calling the OnEnd hooks.
+//
+// It can be called concurrently, e.g., from an HTTP handler, or from a hook. It is only valid during a run:
+// requests made before a run starts are ignored.
+func (loop *Loop) Stop() {
+	loop.stopRequested.Store(true)
+}
+
+// StopRequested returns whether Loop.Stop was called during the current run.
+func (loop *Loop) StopRequested() bool {
+	return loop.stopRequested.Load()
+}
+
 // MedianTrainStepDuration returns the median duration of each training step. It returns 1 millisecond
 // if no training step was recorded (to avoid potential division by 0).
 //
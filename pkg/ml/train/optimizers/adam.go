@@ -329,6 +329,7 @@ func (o *adam) applyAdamGraph(ctx *context.Context, g *Graph, v *context.Variabl
 		grad = ConvertDType(grad, dtype)
 	}
 	TraceNaNInGradients(ctx, v, grad)
+	TraceGradients(ctx, v, grad)
 	grad = ClipNaNsInGradients(ctx, grad)
 
 	// Do the gradient step with momentum.
@@ -110,6 +110,11 @@ var (
 	//	trainer := train.NewTrainer(…)
 	//	nanLogger.AttachToTrainer(trainer)
 	ParamNanLogger = "nanlogger"
+
+	// ParamGradientsTracer configures a Tracer to be called with the gradients of each trainable variable,
+	// see TraceGradients. It is used, for instance, to collect histograms of the gradients for TensorBoard.
+	// Like ParamNanLogger, this value is not saved in a checkpoint.
+	ParamGradientsTracer = "gradients_tracer"
 )
 
 const (
@@ -243,6 +248,20 @@ func TraceNaNInGradients(ctx *context.Context, variable *context.Variable, gradi
 	l.Trace(gradients, "Gradients", variable.ScopeAndName())
 }
 
+// TraceGradients calls the Tracer configured with ParamGradientsTracer, if any, with the gradients of the given variable.
+// The scope passed to the Tracer is the variable ScopeAndName.
+func TraceGradients(ctx *context.Context, variable *context.Variable, gradients *Node) {
+	tAny, found := ctx.GetParam(ParamGradientsTracer)
+	if !found {
+		return
+	}
+	t, ok := tAny.(Tracer)
+	if !ok {
+		return
+	}
+	t.Trace(gradients, variable.ScopeAndName())
+}
+
 // ClipNaNsInGradients will replace the gradient tensor by zeros if there are any NaNs or +/-Inf values.
 // It is only enabled if ParamClipNaN is set to true.
 //
@@ -375,6 +394,7 @@ func addGradientsToVariablesGraph(ctx *context.Context, grads []*Node, learningR
 			// complex.
 			lrCast = ConvertDType(learningRate, grads[ii].DType())
 		}
+		TraceGradients(ctx, v, grads[ii])
 		scaledGradient := Mul(grads[ii], lrCast)
 		scaledGradient = ClipStepByValue(ctx, scaledGradient)
 		TraceNaNInGradients(ctx, v, scaledGradient)
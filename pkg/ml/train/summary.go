@@ -0,0 +1,232 @@
+package train
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gomlx/gomlx/backends"
+	"github.com/gomlx/gomlx/internal/exceptions"
+	"github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/xslices"
+	"github.com/pkg/errors"
+)
+
+// ModelSummary describes a model, per context scope, like Keras' `model.summary()`: see Summarize.
+//
+// It can be printed as a table (String) or serialized to JSON (JSON), e.g., to track regressions in model size.
+type ModelSummary struct {
+	// InputShapes and OutputShapes of the model.
+	InputShapes  []string `json:"input_shapes"`
+	OutputShapes []string `json:"output_shapes"`
+
+	// Scopes used by the model, sorted by scope.
+	Scopes []ScopeSummary `json:"scopes"`
+
+	// Totals for all the variables used by the model.
+	NumParameters          int     `json:"num_parameters"`
+	NumTrainableParameters int     `json:"num_trainable_parameters"`
+	Memory                 uintptr `json:"memory_bytes"`
+
+	// FLOPs is the estimated number of floating point operations for one call of the model (forward pass only).
+	// See graph.Node.EstimateFLOPs.
+	FLOPs int64 `json:"flops"`
+}
+
+// ScopeSummary describes the variables and the computation of one context scope of a model.
+// The values don't include the sub-scopes.
+type ScopeSummary struct {
+	Scope string `json:"scope"`
+
+	// Variables in the scope, used by the model.
+	Variables []VariableSummary `json:"variables,omitempty"`
+
+	// NumParameters and Memory of the variables in the scope.
+	NumParameters int     `json:"num_parameters"`
+	Memory        uintptr `json:"memory_bytes"`
+
+	// OutputShapes are the shapes of the values computed in the scope and used outside of it: the
+	// intermediary outputs of a layer.
+	OutputShapes []string `json:"output_shapes,omitempty"`
+
+	// NumNodes in the computation graph attributed to the scope, see graph.Node.Scope.
+	NumNodes int `json:"num_nodes"`
+
+	// FLOPs is the estimated number of floating point operations of the nodes attributed to the scope.
+	FLOPs int64 `json:"flops"`
+}
+
+// VariableSummary describes one variable of the model.
+type VariableSummary struct {
+	Name          string  `json:"name"`
+	Shape         string  `json:"shape"`
+	Trainable     bool    `json:"trainable"`
+	NumParameters int     `json:"num_parameters"`
+	Memory        uintptr `json:"memory_bytes"`
+}
+
+// Summarize traces the modelFn with inputs of the given shapes, and returns a ModelSummary with, for each
+// context scope, the variables used, the number of parameters and their memory, the shapes of the
+// intermediary outputs, and the estimated number of floating point operations (FLOPs).
+//
+// The model is traced as for evaluation (see context.Context.SetTraining), on a clone of ctx, so ctx is not
+// changed: new variables created by modelFn are not kept. The graph is built but not compiled or executed.
+//
+// Nodes of the computation graph are attributed to the scope of the layer that created them, or to the scope of ctx
+// for nodes created by modelFn outside the layers: see graph.Node.Scope and graph.Graph.PushScope.
+//
+// The spec is passed as is to modelFn, and it can be nil.
+func Summarize(backend backends.Backend, ctx *context.Context, modelFn ModelFn, spec any,
+	inputShapes ...shapes.Shape) (*ModelSummary, error) {
+	ctx = ctx.Clone()
+	g := graph.NewGraph(backend, "ModelSummary")
+	defer g.Finalize()
+	var outputs []*graph.Node
+	err := exceptions.TryCatch[error](func() {
+		inputs := make([]*graph.Node, len(inputShapes))
+		for ii, shape := range inputShapes {
+			inputs[ii] = graph.Parameter(g, fmt.Sprintf("input_%d", ii), shape)
+		}
+		ctx.SetTraining(g, false)
+		g.PushScope(ctx.Scope())
+		outputs = modelFn(ctx, spec, inputs)
+		g.PopScope()
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to trace the model for summary")
+	}
+
+	summary := &ModelSummary{
+		InputShapes:  xslices.Map(inputShapes, shapes.Shape.String),
+		OutputShapes: xslices.Map(outputs, func(node *graph.Node) string { return node.Shape().String() }),
+	}
+	scopes := make(map[string]*ScopeSummary)
+	getScope := func(scope string) *ScopeSummary {
+		if scope == "" {
+			scope = context.RootScope
+		}
+		s := scopes[scope]
+		if s == nil {
+			s = &ScopeSummary{Scope: scope}
+			scopes[scope] = s
+		}
+		return s
+	}
+
+	// Variables.
+	for v := range ctx.IterVariables() {
+		if !v.InUseByGraph(g) {
+			continue
+		}
+		s := getScope(v.Scope())
+		shape := v.Shape()
+		vs := VariableSummary{
+			Name:          v.Name(),
+			Shape:         shape.String(),
+			Trainable:     v.Trainable,
+			NumParameters: shape.Size(),
+			Memory:        shape.Memory(),
+		}
+		s.Variables = append(s.Variables, vs)
+		s.NumParameters += vs.NumParameters
+		s.Memory += vs.Memory
+		summary.NumParameters += vs.NumParameters
+		summary.Memory += vs.Memory
+		if vs.Trainable {
+			summary.NumTrainableParameters += vs.NumParameters
+		}
+	}
+
+	// Computation: nodes attributed to each scope, and the values used outside the scope.
+	isOutput := make(map[graph.NodeId]bool)
+	for _, node := range outputs {
+		isOutput[node.Id()] = true
+	}
+	usedOutside := make(map[graph.NodeId]bool)
+	for _, node := range g.Nodes() {
+		for _, input := range node.Inputs() {
+			if input.Scope() != node.Scope() {
+				usedOutside[input.Id()] = true
+			}
+		}
+	}
+	for _, node := range g.Nodes() {
+		if node.Type() == graph.NodeTypeParameter || node.Type() == graph.NodeTypeConstant {
+			// Inputs, variables and constants are not part of the computation.
+			continue
+		}
+		s := getScope(node.Scope())
+		s.NumNodes++
+		flops := node.EstimateFLOPs()
+		s.FLOPs += flops
+		summary.FLOPs += flops
+		if (usedOutside[node.Id()] || isOutput[node.Id()]) && node.NumOutputs() == 1 {
+			s.OutputShapes = append(s.OutputShapes, node.Shape().String())
+		}
+	}
+
+	for _, s := range scopes {
+		slices.SortFunc(s.Variables, func(a, b VariableSummary) int { return strings.Compare(a.Name, b.Name) })
+		summary.Scopes = append(summary.Scopes, *s)
+	}
+	slices.SortFunc(summary.Scopes, func(a, b ScopeSummary) int { return strings.Compare(a.Scope, b.Scope) })
+	return summary, nil
+}
+
+// JSON returns the summary serialized as indented JSON.
+func (s *ModelSummary) JSON() ([]byte, error) {
+	encoded, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode model summary to JSON")
+	}
+	return encoded, nil
+}
+
+// String implements fmt.Stringer, and returns the summary as a table, with one row per scope, followed by
+// the scope variables.
+func (s *ModelSummary) String() string {
+	type row struct{ name, outputs, params, memory, flops string }
+	rows := []row{{"Scope / Variable", "Output Shapes", "Params", "Memory", "FLOPs"}}
+	for _, scope := range s.Scopes {
+		outputs := strings.Join(scope.OutputShapes, ", ")
+		if len(scope.OutputShapes) > 3 {
+			outputs = strings.Join(scope.OutputShapes[:3], ", ") + fmt.Sprintf(", … (%d more)", len(scope.OutputShapes)-3)
+		}
+		rows = append(rows, row{scope.Scope, outputs, humanize.Comma(int64(scope.NumParameters)),
+			humanize.Bytes(uint64(scope.Memory)), humanize.Comma(scope.FLOPs)})
+		for _, v := range scope.Variables {
+			name := "  " + v.Name
+			if !v.Trainable {
+				name += " (non-trainable)"
+			}
+			rows = append(rows, row{name, v.Shape, humanize.Comma(int64(v.NumParameters)),
+				humanize.Bytes(uint64(v.Memory)), ""})
+		}
+	}
+	widths := make([]int, 5)
+	for _, r := range rows {
+		for ii, cell := range []string{r.name, r.outputs, r.params, r.memory, r.flops} {
+			widths[ii] = max(widths[ii], len([]rune(cell)))
+		}
+	}
+	var sb strings.Builder
+	separator := strings.Repeat("-", widths[0]+widths[1]+widths[2]+widths[3]+widths[4]+8) + "\n"
+	for ii, r := range rows {
+		_, _ = fmt.Fprintf(&sb, "%-*s  %-*s  %*s  %*s  %*s\n", widths[0], r.name, widths[1], r.outputs,
+			widths[2], r.params, widths[3], r.memory, widths[4], r.flops)
+		if ii == 0 {
+			sb.WriteString(separator)
+		}
+	}
+	sb.WriteString(separator)
+	_, _ = fmt.Fprintf(&sb, "Inputs: %s\n", strings.Join(s.InputShapes, ", "))
+	_, _ = fmt.Fprintf(&sb, "Outputs: %s\n", strings.Join(s.OutputShapes, ", "))
+	_, _ = fmt.Fprintf(&sb, "Total parameters: %s (%s), trainable: %s\n", humanize.Comma(int64(s.NumParameters)),
+		humanize.Bytes(uint64(s.Memory)), humanize.Comma(int64(s.NumTrainableParameters)))
+	_, _ = fmt.Fprintf(&sb, "Estimated FLOPs (forward pass): %s\n", humanize.Comma(s.FLOPs))
+	return sb.String()
+}
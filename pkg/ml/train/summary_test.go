@@ -0,0 +1,83 @@
+package train
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	dense := func(ctx *context.Context, x *Node, outputDim int) *Node {
+		g := x.Graph()
+		g.PushScope(ctx.Scope())
+		defer g.PopScope()
+		inputDim := x.Shape().Dimensions[1]
+		weights := ctx.VariableWithShape("weights", shapes.Make(dtypes.Float32, inputDim, outputDim)).ValueGraph(g)
+		bias := ctx.VariableWithShape("bias", shapes.Make(dtypes.Float32, outputDim)).ValueGraph(g)
+		return Add(Dot(x, weights), ExpandAxes(bias, 0))
+	}
+	modelFn := func(ctx *context.Context, spec any, inputs []*Node) []*Node {
+		x := dense(ctx.In("dense_0"), inputs[0], 16)
+		x = Tanh(x)
+		x = dense(ctx.In("dense_1"), x, 3)
+		return []*Node{x}
+	}
+	summary, err := Summarize(backend, ctx, modelFn, nil, shapes.Make(dtypes.Float32, 8, 4))
+	require.NoError(t, err)
+	fmt.Printf("%s\n", summary)
+
+	assert.Equal(t, []string{"(Float32)[8 4]"}, summary.InputShapes)
+	assert.Equal(t, []string{"(Float32)[8 3]"}, summary.OutputShapes)
+	assert.Equal(t, 4*16+16+16*3+3, summary.NumParameters)
+	assert.Equal(t, summary.NumParameters, summary.NumTrainableParameters)
+	assert.Equal(t, uintptr(4*summary.NumParameters), summary.Memory)
+	require.Len(t, summary.Scopes, 3)
+
+	// The activation between the layers is attributed to the model (root) scope.
+	root := summary.Scopes[0]
+	assert.Equal(t, context.RootScope, root.Scope)
+	assert.Empty(t, root.Variables)
+	assert.Equal(t, int64(8*16), root.FLOPs)
+
+	dense0 := summary.Scopes[1]
+	assert.Equal(t, "/dense_0", dense0.Scope)
+	require.Len(t, dense0.Variables, 2)
+	assert.Equal(t, VariableSummary{Name: "bias", Shape: "(Float32)[16]", Trainable: true, NumParameters: 16, Memory: 64},
+		dense0.Variables[0])
+	assert.Equal(t, 4*16+16, dense0.NumParameters)
+	assert.Equal(t, []string{"(Float32)[8 16]"}, dense0.OutputShapes)
+	// Dot + bias.
+	assert.Equal(t, int64(2*8*4*16+8*16), dense0.FLOPs)
+
+	dense1 := summary.Scopes[2]
+	assert.Equal(t, "/dense_1", dense1.Scope)
+	assert.Equal(t, []string{"(Float32)[8 3]"}, dense1.OutputShapes)
+	assert.Equal(t, int64(2*8*16*3+8*3), dense1.FLOPs)
+	assert.Equal(t, root.FLOPs+dense0.FLOPs+dense1.FLOPs, summary.FLOPs)
+
+	// Context is not changed.
+	assert.Equal(t, 0, ctx.NumVariables())
+
+	// Table.
+	table := summary.String()
+	assert.Contains(t, table, "/dense_0")
+	assert.Contains(t, table, "  weights")
+	assert.Contains(t, table, "Total parameters: 131")
+
+	// JSON.
+	encoded, err := summary.JSON()
+	require.NoError(t, err)
+	var decoded ModelSummary
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, *summary, decoded)
+}
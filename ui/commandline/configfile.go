@@ -0,0 +1,252 @@
+package commandline
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/support/fsutil"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat of a configuration file with context hyperparameters. See LoadContextConfigFile.
+type ConfigFormat string
+
+const (
+	ConfigYAML ConfigFormat = "yaml"
+	ConfigTOML ConfigFormat = "toml"
+	ConfigJSON ConfigFormat = "json"
+)
+
+// configFormatFromPath returns the ConfigFormat based on the file extension, and whether it is a known one.
+func configFormatFromPath(filePath string) (ConfigFormat, bool) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		return ConfigYAML, true
+	case ".toml":
+		return ConfigTOML, true
+	case ".json":
+		return ConfigJSON, true
+	}
+	return "", false
+}
+
+// LoadContextConfigFile sets the context hyperparameters from a YAML, TOML or JSON configuration file.
+// The format is selected by the file extension (".yaml", ".yml", ".toml" or ".json").
+//
+// The configuration is a map of parameter names to values, and scopes are given as nested maps. E.g., in YAML:
+//
+//	learning_rate: 0.001
+//	layer_1:
+//	  l2_regularization: 0.1
+//
+// It follows the same rules as ParseContextSettings: all parameters must be already set with default values in the
+// root scope of ctx, and their values are parsed to the type of the default value -- unknown parameters
+// and values of the wrong type are rejected. Lists (e.g., `[1, 2, 3]`) are accepted for parameters of slice types.
+//
+// Configuration files can also be given to ParseContextSettings as "config:<path>", which allows layering of
+// several configuration files and individual settings: they are applied in order, later ones overriding
+// earlier ones. E.g.: "config:base.yaml;config:experiment.toml;learning_rate=0.01".
+//
+// It returns the list of parameters set (with their scopes).
+func LoadContextConfigFile(ctx *context.Context, filePath string) (paramsSet []string, err error) {
+	filePath = fsutil.MustReplaceTildeInDir(filePath)
+	format, ok := configFormatFromPath(filePath)
+	if !ok {
+		return nil, errors.Errorf("unknown configuration file format for %q: it must have one of the extensions "+
+			".yaml, .yml, .toml or .json", filePath)
+	}
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read configuration file %q", filePath)
+	}
+	paramsSet, err = ParseContextConfig(ctx, contents, format)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "in configuration file %q", filePath)
+	}
+	return paramsSet, nil
+}
+
+// ParseContextConfig sets the context hyperparameters from the contents of a configuration file in the given format.
+// See LoadContextConfigFile for details.
+func ParseContextConfig(ctx *context.Context, contents []byte, format ConfigFormat) (paramsSet []string, err error) {
+	var config map[string]any
+	switch format {
+	case ConfigYAML:
+		err = yaml.Unmarshal(contents, &config)
+	case ConfigTOML:
+		err = toml.Unmarshal(contents, &config)
+	case ConfigJSON:
+		dec := json.NewDecoder(bytes.NewReader(contents))
+		dec.UseNumber() // Keep numbers as they were written, so they can be parsed as integers.
+		err = dec.Decode(&config)
+	default:
+		err = errors.Errorf("unknown configuration format %q", format)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s configuration", format)
+	}
+	err = setContextConfig(ctx, context.RootScope, config, &paramsSet)
+	return
+}
+
+// setContextConfig sets the parameters in config (in scope), recursively for the nested maps (sub-scopes).
+// Keys are sorted, so the order is deterministic.
+func setContextConfig(ctx *context.Context, scope string, config map[string]any, paramsSet *[]string) error {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if key == "" || strings.Contains(key, context.ScopeSeparator) {
+			return errors.Errorf("invalid key %q in scope %q: use nested maps for scopes", key, scope)
+		}
+		paramPath := context.JoinScope(scope, key)
+		if subConfig, ok := config[key].(map[string]any); ok {
+			if err := setContextConfig(ctx, paramPath, subConfig, paramsSet); err != nil {
+				return err
+			}
+			continue
+		}
+		valueStr, err := configValueToString(config[key])
+		if err != nil {
+			return errors.WithMessagef(err, "parameter %q", paramPath)
+		}
+		if scope == context.RootScope {
+			// Parameters in the root scope are set without the scope prefix, as in ParseContextSettings.
+			paramPath = key
+		}
+		if err = setContextParam(ctx, paramPath, valueStr); err != nil {
+			return err
+		}
+		*paramsSet = append(*paramsSet, paramPath)
+	}
+	return nil
+}
+
+// configValueToString converts a value decoded from a configuration file to the string format used
+// by ParseContextSettings, so it can be parsed to the type of the parameter default value.
+func configValueToString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case []any:
+		parts := make([]string, len(v))
+		for ii, element := range v {
+			if _, isList := element.([]any); isList {
+				return "", errors.Errorf("nested lists are not supported")
+			}
+			part, err := configValueToString(element)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(part, ",") {
+				return "", errors.Errorf("list elements can't contain \",\", got %q", part)
+			}
+			parts[ii] = part
+		}
+		return strings.Join(parts, ","), nil
+	case nil:
+		return "", errors.Errorf("missing value")
+	default:
+		return "", errors.Errorf("values of type %T are not supported", value)
+	}
+}
+
+// MarshalContextConfig serializes the context hyperparameters in the given format, as read by ParseContextConfig:
+// scopes are written as nested maps.
+//
+// Only parameters of the types supported by ParseContextSettings are included, others are silently skipped.
+func MarshalContextConfig(ctx *context.Context, format ConfigFormat) ([]byte, error) {
+	config := make(map[string]any)
+	ctx.EnumerateParams(func(scope, key string, value any) {
+		if !isSupportedSettingType(value) {
+			return
+		}
+		scopeConfig := config
+		for _, scopeName := range strings.Split(strings.Trim(scope, context.ScopeSeparator), context.ScopeSeparator) {
+			if scopeName == "" {
+				continue
+			}
+			subConfig, ok := scopeConfig[scopeName].(map[string]any)
+			if !ok {
+				subConfig = make(map[string]any)
+				scopeConfig[scopeName] = subConfig
+			}
+			scopeConfig = subConfig
+		}
+		scopeConfig[key] = value
+	})
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case ConfigYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(config)
+		if err == nil {
+			err = enc.Close()
+		}
+	case ConfigTOML:
+		err = toml.NewEncoder(&buf).Encode(config)
+	case ConfigJSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(config)
+	default:
+		err = errors.Errorf("unknown configuration format %q", format)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize context parameters as %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteContextConfigFile writes the context hyperparameters to a configuration file, in the format given by the
+// file extension (see LoadContextConfigFile). See MarshalContextConfig for details.
+func WriteContextConfigFile(ctx *context.Context, filePath string) error {
+	filePath = fsutil.MustReplaceTildeInDir(filePath)
+	format, ok := configFormatFromPath(filePath)
+	if !ok {
+		return errors.Errorf("unknown configuration file format for %q: it must have one of the extensions "+
+			".yaml, .yml, .toml or .json", filePath)
+	}
+	contents, err := MarshalContextConfig(ctx, format)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, contents, 0o644); err != nil {
+		return errors.Wrapf(err, "failed to write configuration file %q", filePath)
+	}
+	return nil
+}
+
+// isSupportedSettingType returns whether the value is of one of the types parsed by ParseContextSettings.
+func isSupportedSettingType(value any) bool {
+	switch value.(type) {
+	case int, int32, int64, uint, uint32, uint64, float32, float64, bool, string, []string, []int, []float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package commandline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContextConfig(t *testing.T) {
+	configs := map[ConfigFormat]string{
+		ConfigYAML: `
+x: 13
+y: 1_000
+list_int: [1, 3, 7]
+list_str: [a, b]
+a:
+  z: true
+  b:
+    y: 3
+`,
+		ConfigTOML: `
+x = 13
+y = 1_000
+list_int = [1, 3, 7]
+list_str = ["a", "b"]
+
+[a]
+z = true
+
+[a.b]
+y = 3
+`,
+		ConfigJSON: `{
+  "x": 13, "y": 1000, "list_int": [1, 3, 7], "list_str": ["a", "b"],
+  "a": {"z": true, "b": {"y": 3}}
+}`,
+	}
+	for format, config := range configs {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := createTestContext()
+			paramsSet, err := ParseContextConfig(ctx, []byte(config), format)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"/a/b/y", "/a/z", "list_int", "list_str", "x", "y"}, paramsSet)
+			assert.Equal(t, 13.0, context.GetParamOr(ctx, "x", 0.0))
+			assert.Equal(t, 1000, context.GetParamOr(ctx, "y", 0))
+			assert.Equal(t, 3, context.GetParamOr(ctx.In("a").In("b"), "y", 0))
+			assert.Equal(t, true, context.GetParamOr(ctx.In("a"), "z", false))
+			assert.Equal(t, false, context.GetParamOr(ctx, "z", true))
+			assert.Equal(t, []int{1, 3, 7}, context.GetParamOr(ctx, "list_int", []int{}))
+			assert.Equal(t, []string{"a", "b"}, context.GetParamOr(ctx, "list_str", []string{}))
+		})
+	}
+
+	// Unknown parameter.
+	_, err := ParseContextConfig(createTestContext(), []byte("q: 3"), ConfigYAML)
+	require.Error(t, err)
+
+	// Wrong type of value.
+	_, err = ParseContextConfig(createTestContext(), []byte("y: 3.14"), ConfigYAML)
+	require.Error(t, err)
+	_, err = ParseContextConfig(createTestContext(), []byte(`{"z": "yes"}`), ConfigJSON)
+	require.Error(t, err)
+}
+
+func TestContextConfigLayering(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.yaml")
+	require.NoError(t, os.WriteFile(basePath, []byte("x: 1.0\ny: 2\ns: base\n"), 0o644))
+	experimentPath := filepath.Join(dir, "experiment.toml")
+	require.NoError(t, os.WriteFile(experimentPath, []byte("y = 3\n[a]\ns = \"experiment\"\n"), 0o644))
+
+	ctx := createTestContext()
+	_, err := ParseContextSettings(ctx, "config:"+basePath+";config:"+experimentPath+";x=5")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, context.GetParamOr(ctx, "x", 0.0))
+	assert.Equal(t, 3, context.GetParamOr(ctx, "y", 0))
+	assert.Equal(t, "base", context.GetParamOr(ctx, "s", ""))
+	assert.Equal(t, "experiment", context.GetParamOr(ctx.In("a"), "s", ""))
+
+	// Dump configuration and read it back in a new context.
+	for _, ext := range []string{".yaml", ".toml", ".json"} {
+		dumpPath := filepath.Join(dir, "dump"+ext)
+		require.NoError(t, WriteContextConfigFile(ctx, dumpPath))
+		ctx2 := createTestContext()
+		_, err = LoadContextConfigFile(ctx2, dumpPath)
+		require.NoError(t, err, "reading back %q", dumpPath)
+		assert.Equal(t, SprintContextSettings(ctx), SprintContextSettings(ctx2), "reading back %q", dumpPath)
+	}
+}
+
+func TestContextSettingsFileIsNotConfig(t *testing.T) {
+	// "file:" always reads settings lines, whatever the file extension: only "config:" reads configuration files.
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+	require.NoError(t, os.WriteFile(settingsPath, []byte("# Settings.\nx=7\ny=4;/a/s=lines\n"), 0o644))
+	ctx := createTestContext()
+	_, err := ParseContextSettings(ctx, "file:"+settingsPath)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, context.GetParamOr(ctx, "x", 0.0))
+	assert.Equal(t, 4, context.GetParamOr(ctx, "y", 0))
+	assert.Equal(t, "lines", context.GetParamOr(ctx.In("a"), "s", ""))
+
+	_, err = ParseContextSettings(createTestContext(), "config:"+settingsPath)
+	require.Error(t, err)
+}
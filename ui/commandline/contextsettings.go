@@ -27,6 +27,11 @@ import (
 // Note, one can also provide a scope for the parameters: "layer_1/l2_regularization=0.1"
 // will work, as long as a default "l2_regularization" is defined in `ctx`.
 //
+// A setting can also be "file:<path>", in which case each line of the file is parsed as a list of settings,
+// or "config:<path>" for a YAML, TOML or JSON configuration file (see LoadContextConfigFile).
+// Settings (and files) are applied in order, so later ones override earlier ones: this allows layering of
+// configurations, e.g.: "config:base.yaml;config:experiment.yaml;learning_rate=0.01".
+//
 // For integer types, "_" is removed: it allows one to enter large numbers using it as a separator, like
 // in Go. E.g.: 1_000_000 = 1000000.
 //
@@ -59,6 +64,13 @@ func parseContextSetting(ctx *context.Context, setting string, paramsSet []strin
 	if setting == "" {
 		return
 	}
+	if strings.HasPrefix(setting, "config:") {
+		// Structured (YAML, TOML or JSON) configuration file.
+		var fileParamsSet []string
+		fileParamsSet, err = LoadContextConfigFile(ctx, strings.TrimPrefix(setting, "config:"))
+		newParamsSet = append(newParamsSet, fileParamsSet...)
+		return
+	}
 	if strings.HasPrefix(setting, "file:") {
 		// Read parameters from a file.
 		filePath := strings.TrimPrefix(setting, "file:")
@@ -93,6 +105,17 @@ func parseContextSetting(ctx *context.Context, setting string, paramsSet []strin
 		return
 	}
 	paramPath, valueStr := parts[0], parts[1]
+	err = setContextParam(ctx, paramPath, valueStr)
+	if err != nil {
+		return
+	}
+	newParamsSet = append(newParamsSet, paramPath)
+	return
+}
+
+// setContextParam parses valueStr to the type of the default value of the parameter (which must be set in the
+// root scope of ctx) and sets it in the scope given in paramPath.
+func setContextParam(ctx *context.Context, paramPath, valueStr string) (err error) {
 	paramScope, paramName := context.SplitScope(paramPath)
 	if strings.Index(paramName, context.ScopeSeparator) != -1 {
 		err = errors.Errorf("can't set parameter %q  because some scope is set, but it is not absolue (it does not start with %q)",
@@ -153,6 +176,10 @@ func parseContextSetting(ctx *context.Context, setting string, paramsSet []strin
 	case []string:
 		value = strings.Split(valueStr, ",")
 	case []int:
+		if valueStr == "" {
+			value = []int{}
+			break
+		}
 		parts := strings.Split(valueStr, ",")
 		value = xslices.Map(parts, func(str string) int {
 			var asInt int
@@ -164,6 +191,10 @@ func parseContextSetting(ctx *context.Context, setting string, paramsSet []strin
 			return asInt
 		})
 	case []float64:
+		if valueStr == "" {
+			value = []float64{}
+			break
+		}
 		parts := strings.Split(valueStr, ",")
 		value = xslices.Map(parts, func(str string) float64 {
 			var asNum float64
@@ -175,14 +206,13 @@ func parseContextSetting(ctx *context.Context, setting string, paramsSet []strin
 		})
 	default:
 		err = fmt.Errorf("don't know how to parse type %T for setting parameter %q -- it's easy to write a parser to a new type, ask in github if you need something standard",
-			value, setting)
+			value, paramPath+"="+valueStr)
 	}
 	if err != nil {
 		err = errors.Wrapf(err, "failed to parse value %q for parameter %q (default value is %#v)", valueStr, paramPath, value)
 		return
 	}
 	ctxInScope.SetParam(paramName, value)
-	newParamsSet = append(newParamsSet, paramPath)
 	return
 }
 
@@ -214,6 +244,8 @@ func CreateContextSettingsFlag(ctx *context.Context, flagName string) *string {
 			`It can also be given an entry like: "file:settings_file.txt", in `+
 			`which case the file will be read and the settings will be parsed, `+
 			`with new-lines working as ";" to separate settings and lines starting with "#" are considered comments. `+
+			`An entry like "config:settings.yaml" reads a YAML, TOML or JSON configuration file (selected by the `+
+			`file extension), with scopes as nested maps. Settings are applied in order, later ones overriding earlier ones. `+
 			`Current available parameters that can be set:`,
 		context.ScopeSeparator))
 	ctx.EnumerateParams(func(scope, key string, value any) {
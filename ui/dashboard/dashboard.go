@@ -0,0 +1,452 @@
+// Package dashboard implements a self-hosted live training dashboard, served over HTTP by the training program
+// itself: useful to monitor training running on remote machines.
+//
+// It is attached to a train.Loop with AttachToLoop, which starts an embedded HTTP server. The web page served
+// (bundled in the binary, with no external assets, so it works offline) shows:
+//
+//   - Live plots of the train and eval metrics (see plots.Point), streamed with server-sent events (SSE).
+//   - The progress of the training loop and the latest training metrics.
+//   - The hyperparameters of the context.
+//   - A summary of the variables (like `gomlx_checkpoints -summary`).
+//   - Buttons to trigger a checkpoint save or a graceful stop of the training (see train.Loop.Stop).
+//
+// The dashboard only reads the model state in the training goroutine (in the loop hooks), so it doesn't interfere
+// with the training.
+//
+// The HTTP server has no authentication: bind it to a local address (the default), and use an SSH tunnel
+// (e.g. `ssh -L 8080:localhost:8080 <remote_host>`) to access it from a remote machine.
+// The requests that change the training (checkpoint and stop) require a random token generated for each Server
+// and embedded in the dashboard page, so other web pages open in the browser can't trigger them. And requests
+// to unknown host names are rejected (see Server.WithAllowedHosts), so other web pages can't read the dashboard
+// using DNS rebinding.
+package dashboard
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/ui/plots"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// ParamDashboard is the context parameter that can be used by models to start the dashboard: it holds the
+	// address to serve it, e.g. "localhost:8080". It defaults to "", meaning the dashboard is disabled.
+	ParamDashboard = "dashboard"
+
+	// DefaultStatusInterval is the default minimum interval between updates of the loop status sent to the
+	// dashboard pages. See Server.WithStatusInterval.
+	DefaultStatusInterval = time.Second
+)
+
+// Server is the HTTP server of the dashboard, attached to a train.Loop. Create it with AttachToLoop.
+//
+// It implements plots.Plotter, so the points can also be added by other tools.
+type Server struct {
+	loop     *train.Loop
+	listener net.Listener
+	server   *http.Server
+	closed   atomic.Bool
+
+	// token required by the requests that change the training, see requireToken.
+	token string
+
+	// Configuration.
+	checkpoint          *checkpoints.Handler
+	evalDatasets        []train.Dataset
+	batchNormAveragesDS train.Dataset
+	customMetricFn      plots.CustomMetricFn
+	statusInterval      time.Duration
+	scheduled           bool
+	lastStepCollected   int64
+	lastStatusUpdate    time.Time
+
+	// Requests from the dashboard page, handled in the training goroutine.
+	saveRequested atomic.Bool
+
+	// mu protects the state below, shared with the HTTP handlers.
+	mu           sync.Mutex
+	points       []plots.Point
+	status       Status
+	summary      Summary
+	subscribers  map[chan []byte]struct{}
+	allowedHosts []string
+}
+
+// Status of the training loop, as shown in the dashboard.
+type Status struct {
+	Running       bool
+	StopRequested bool
+	LoopStep      int
+	StartStep     int
+	EndStep       int
+	Epoch         int
+	GlobalStep    int64
+
+	// StepDuration is the median duration of the train steps so far, in seconds.
+	StepDuration float64
+
+	// Metrics are the latest train metrics, as returned by the last train step.
+	Metrics []MetricValue
+
+	// Checkpoint is the checkpoint directory, if one was configured. See Server.WithCheckpoint.
+	Checkpoint string
+}
+
+// MetricValue is the value of a named metric.
+type MetricValue struct {
+	Name  string
+	Value float64
+}
+
+// Summary of the model: the hyperparameters and the variables.
+type Summary struct {
+	Params []Param
+
+	NumVariables  int
+	NumParameters int
+	NumBytes      uintptr
+	Variables     []VariableSummary
+}
+
+// Param is a hyperparameter of the context.
+type Param struct {
+	Scope, Key, Value string
+}
+
+// VariableSummary describes one variable of the context.
+type VariableSummary struct {
+	Name      string
+	Shape     string
+	Size      int
+	Bytes     uintptr
+	Trainable bool
+}
+
+// AttachToLoop starts the dashboard HTTP server on addr (e.g. "localhost:8080", or "localhost:0" to pick any
+// free port -- see Server.URL), and attaches it to the training loop.
+//
+// Configure it with the With* methods, and schedule the collection of metrics during training with
+// ScheduleEveryNSteps, ScheduleNTimes or ScheduleExponential. E.g.:
+//
+//	if addr := context.GetParamOr(ctx, dashboard.ParamDashboard, ""); addr != "" {
+//		db, err := dashboard.AttachToLoop(loop, addr)
+//		if err != nil { ... }
+//		defer db.Close()
+//		fmt.Printf("\t- dashboard in %s\n", db.URL())
+//		db.WithCheckpoint(checkpoint).
+//			WithDatasets(validationEvalDS).
+//			ScheduleExponential(100, 1.2)
+//	}
+//
+// Close the Server when the program no longer needs to serve the dashboard.
+func AttachToLoop(loop *train.Loop, addr string) (*Server, error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, errors.Wrap(err, "dashboard failed to generate its token")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dashboard failed to listen on %q", addr)
+	}
+	s := &Server{
+		loop:           loop,
+		listener:       listener,
+		token:          hex.EncodeToString(tokenBytes),
+		statusInterval: DefaultStatusInterval,
+		subscribers:    make(map[chan []byte]struct{}),
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		s.allowedHosts = append(s.allowedHosts, host)
+	}
+	s.server = &http.Server{Handler: s.handler()}
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("dashboard HTTP server failed: %+v", err)
+		}
+	}()
+
+	loop.OnStart("dashboard", 120, func(loop *train.Loop, _ train.Dataset) error {
+		s.updateSummary(loop.Trainer.Context())
+		s.updateStatus(loop, nil, true)
+		return nil
+	})
+	loop.OnStep("dashboard", 120, func(loop *train.Loop, metrics []*tensors.Tensor) error {
+		s.handleRequests(loop)
+		if time.Since(s.lastStatusUpdate) >= s.statusInterval {
+			s.updateStatus(loop, metrics, true)
+		}
+		return nil
+	})
+	loop.OnEnd("dashboard", 120, func(loop *train.Loop, metrics []*tensors.Tensor) error {
+		if s.scheduled {
+			if err := s.collect(loop, metrics); err != nil {
+				return err
+			}
+		}
+		s.updateSummary(loop.Trainer.Context())
+		s.updateStatus(loop, metrics, false)
+		return nil
+	})
+	return s, nil
+}
+
+// URL returns the URL of the dashboard page.
+func (s *Server) URL() string {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	host := "localhost"
+	if !addr.IP.IsUnspecified() {
+		host = addr.IP.String()
+	}
+	return fmt.Sprintf("http://%s/", net.JoinHostPort(host, fmt.Sprint(addr.Port)))
+}
+
+// Close the HTTP server, disconnecting any dashboard pages. It is idempotent.
+func (s *Server) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+	}
+	clear(s.subscribers)
+	s.mu.Unlock()
+	return s.server.Close()
+}
+
+// WithCheckpoint configures the checkpoint handler used by the "save checkpoint" button of the dashboard.
+// The points previously saved in the checkpoint directory (see plots.TrainingPlotFileName), if any, are loaded
+// and shown in the plots.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithCheckpoint(checkpoint *checkpoints.Handler) *Server {
+	s.checkpoint = checkpoint
+	if checkpoint == nil || checkpoint.Dir() == "" {
+		return s
+	}
+	points, err := plots.LoadPointsFromCheckpoint(checkpoint.Dir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			klog.Warningf("dashboard failed to load previous plot points: %+v", err)
+		}
+		return s
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.points = append(points, s.points...)
+	return s
+}
+
+// WithAllowedHosts adds host names (without port) under which the dashboard can be accessed, e.g. the name of the
+// machine when listening on all interfaces. "localhost", IP addresses and the host given to AttachToLoop are
+// always allowed. Requests to other host names are rejected, to protect against DNS rebinding.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithAllowedHosts(hosts ...string) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowedHosts = append(s.allowedHosts, hosts...)
+	return s
+}
+
+// WithDatasets configures the datasets to evaluate at each collecting step (see `Schedule*` methods).
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithDatasets(datasets ...train.Dataset) *Server {
+	s.evalDatasets = datasets
+	return s
+}
+
+// WithBatchNormalizationAveragesUpdate configures a dataset to use to update the averages (of mean and variance)
+// for batch normalization, before evaluating the datasets. See plots.AddTrainAndEvalMetrics.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithBatchNormalizationAveragesUpdate(oneEpochDS train.Dataset) *Server {
+	s.batchNormAveragesDS = oneEpochDS
+	return s
+}
+
+// WithCustomMetricFn registers the given function to run at every step it collects metrics: the points it adds
+// (see plots.Plotter) are plotted along the others. Only one function can be registered. Set to nil to reset.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithCustomMetricFn(fn plots.CustomMetricFn) *Server {
+	s.customMetricFn = fn
+	return s
+}
+
+// WithStatusInterval sets the minimum interval between updates of the loop status (step, latest train metrics)
+// sent to the dashboard pages. It defaults to DefaultStatusInterval.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) WithStatusInterval(interval time.Duration) *Server {
+	s.statusInterval = interval
+	return s
+}
+
+// ScheduleExponential collection of metrics, starting at `startStep` and with an increasing step factor
+// of `stepFactor`. Typical values where could be 100 and 1.1.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) ScheduleExponential(startStep int, stepFactor float64) *Server {
+	s.scheduled = true
+	train.ExponentialCallback(s.loop, startStep, stepFactor, true, "dashboard", 0, s.collect)
+	return s
+}
+
+// ScheduleNTimes collections of metrics during the loop.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) ScheduleNTimes(numPoints int) *Server {
+	s.scheduled = true
+	train.NTimesDuringLoop(s.loop, numPoints, "dashboard", 0, s.collect)
+	return s
+}
+
+// ScheduleEveryNSteps to collect metrics.
+//
+// It returns itself to allow cascading configuration method calls.
+func (s *Server) ScheduleEveryNSteps(n int) *Server {
+	s.scheduled = true
+	train.EveryNSteps(s.loop, n, "dashboard", 0, s.collect)
+	return s
+}
+
+// AddPoint implements plots.Plotter: the point is kept and sent to the dashboard pages.
+func (s *Server) AddPoint(point plots.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.points = append(s.points, point)
+	s.broadcastLocked(encodeEvent(eventPoint, point))
+}
+
+// DynamicSampleDone implements plots.Plotter. It is a no-op.
+func (s *Server) DynamicSampleDone(_ bool) {}
+
+// Points returns a copy of the points collected so far.
+func (s *Server) Points() []plots.Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.points)
+}
+
+// collect the metrics for the current step. It implements train.OnStepFn.
+func (s *Server) collect(loop *train.Loop, metrics []*tensors.Tensor) error {
+	// Only collect once per step: multiple calls can happen if more than one schedule is configured.
+	step := loop.Trainer.GlobalStep()
+	if step <= s.lastStepCollected {
+		return nil
+	}
+	s.lastStepCollected = step
+
+	if s.customMetricFn != nil {
+		if err := s.customMetricFn(s, float64(step)); err != nil {
+			return errors.WithMessagef(err, "dashboard CustomMetricFn returned an error at step %d", step)
+		}
+	}
+	return plots.AddTrainAndEvalMetrics(s, loop, metrics, s.evalDatasets, s.batchNormAveragesDS)
+}
+
+// handleRequests made from the dashboard page. It is called in the training goroutine, at every step.
+func (s *Server) handleRequests(loop *train.Loop) {
+	if !s.saveRequested.Swap(false) || s.checkpoint == nil {
+		return
+	}
+	if err := s.checkpoint.Save(); err != nil {
+		klog.Errorf("dashboard failed to save checkpoint: %+v", err)
+		s.message(fmt.Sprintf("Failed to save checkpoint at step %d: %v", loop.LoopStep, err))
+		return
+	}
+	s.message(fmt.Sprintf("Checkpoint saved at step %d.", loop.LoopStep))
+}
+
+// message sends a text message to be displayed on the dashboard pages.
+func (s *Server) message(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcastLocked(encodeEvent(eventMessage, msg))
+}
+
+// updateStatus of the loop, and sends it to the dashboard pages. Called in the training goroutine.
+func (s *Server) updateStatus(loop *train.Loop, metrics []*tensors.Tensor, running bool) {
+	s.lastStatusUpdate = time.Now()
+	status := Status{
+		Running:       running,
+		StopRequested: loop.StopRequested(),
+		LoopStep:      loop.LoopStep,
+		StartStep:     loop.StartStep,
+		EndStep:       loop.EndStep,
+		Epoch:         loop.Epoch,
+		GlobalStep:    loop.Trainer.GlobalStep(),
+	}
+	if len(loop.TrainStepDurations) > 0 {
+		durations := slices.Clone(loop.TrainStepDurations)
+		slices.Sort(durations)
+		status.StepDuration = durations[len(durations)/2].Seconds()
+	}
+	if s.checkpoint != nil {
+		status.Checkpoint = s.checkpoint.Dir()
+	}
+	for ii, desc := range loop.Trainer.TrainMetrics() {
+		if ii >= len(metrics) || metrics[ii] == nil || !metrics[ii].Shape().IsScalar() {
+			continue
+		}
+		status.Metrics = append(status.Metrics, MetricValue{
+			Name:  desc.Name(),
+			Value: shapes.ConvertTo[float64](metrics[ii].Value()),
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.broadcastLocked(encodeEvent(eventStatus, status))
+}
+
+// updateSummary of the hyperparameters and variables, and sends it to the dashboard pages.
+// Called in the training goroutine.
+func (s *Server) updateSummary(ctx *context.Context) {
+	var summary Summary
+	ctx.EnumerateParams(func(scope, key string, value any) {
+		summary.Params = append(summary.Params, Param{Scope: scope, Key: key, Value: fmt.Sprintf("%v", value)})
+	})
+	slices.SortFunc(summary.Params, func(a, b Param) int {
+		return cmp.Or(cmp.Compare(a.Scope, b.Scope), cmp.Compare(a.Key, b.Key))
+	})
+
+	for v := range ctx.IterVariables() {
+		summary.NumVariables++
+		summary.NumParameters += v.Shape().Size()
+		summary.NumBytes += v.Shape().Memory()
+		summary.Variables = append(summary.Variables, VariableSummary{
+			Name:      v.ScopeAndName(),
+			Shape:     v.Shape().String(),
+			Size:      v.Shape().Size(),
+			Bytes:     v.Shape().Memory(),
+			Trainable: v.Trainable,
+		})
+	}
+	slices.SortFunc(summary.Variables, func(a, b VariableSummary) int { return cmp.Compare(a.Name, b.Name) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+	s.broadcastLocked(encodeEvent(eventSummary, summary))
+}
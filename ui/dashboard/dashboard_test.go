@@ -0,0 +1,258 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/context/checkpoints"
+	"github.com/gomlx/gomlx/pkg/ml/datasets"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
+	"github.com/gomlx/gomlx/ui/plots"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+func newTestLoop(t *testing.T) (*context.Context, *train.Loop) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.SetParam("activation", "relu")
+	modelFn := func(ctx *context.Context, spec any, inputs []*Node) []*Node {
+		g := inputs[0].Graph()
+		weights := ctx.In("model").VariableWithValue("weights", []float32{1, 2, 3, 4}).ValueGraph(g)
+		train.AddLoss(ctx, ReduceAllSum(Square(weights)))
+		return nil
+	}
+	optimizer := optimizers.StochasticGradientDescent().WithDecay(false).WithLearningRate(0.01).Done()
+	trainer := train.NewTrainer(backend, ctx, modelFn, nil, optimizer, nil, nil)
+	return ctx, train.NewLoop(trainer)
+}
+
+func getJSON[T any](t *testing.T, url string) T {
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var value T
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&value))
+	return value
+}
+
+// post sends a POST request with the given token (if not empty) and Origin (if not empty) headers, and returns
+// the status code.
+func post(t *testing.T, url, token, origin string) int {
+	request, err := http.NewRequest(http.MethodPost, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		request.Header.Set(tokenHeader, token)
+	}
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+	return response.StatusCode
+}
+
+func TestDashboard(t *testing.T) {
+	ctx, loop := newTestLoop(t)
+	checkpoint, err := checkpoints.Build(ctx).Dir(t.TempDir()).Keep(-1).Done()
+	require.NoError(t, err)
+	s, err := AttachToLoop(loop, "localhost:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	s.WithCheckpoint(checkpoint).ScheduleEveryNSteps(5)
+	url := s.URL()
+
+	// Page is self-contained.
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	page, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(page), "EventSource")
+	assert.NotContains(t, string(page), "https://")
+	assert.Contains(t, string(page), s.token)
+	assert.NotContains(t, string(page), tokenPlaceholder)
+
+	// Request a checkpoint save and a stop from the page, during training.
+	loop.OnStep("test", 200, func(loop *train.Loop, _ []*tensors.Tensor) error {
+		switch loop.LoopStep {
+		case 7:
+			assert.Equal(t, http.StatusAccepted, post(t, url+"api/checkpoint", s.token, ""))
+		case 11:
+			assert.Equal(t, http.StatusAccepted, post(t, url+"api/stop", s.token, ""))
+		}
+		return nil
+	})
+	_, err = loop.RunSteps(datasets.NewConstantDataset(), 100)
+	require.NoError(t, err)
+	assert.Equal(t, 12, loop.LoopStep, "training should have stopped after step 11")
+	assert.Equal(t, 12, loop.EndStep)
+	checkpointFiles, err := checkpoint.ListCheckpoints()
+	require.NoError(t, err)
+	assert.Len(t, checkpointFiles, 1, "checkpoint at step 8 should have been saved")
+
+	// Points collected at steps 5, 10 and at the end (12).
+	points := getJSON[[]plots.Point](t, url+"api/points")
+	steps := make(map[float64]bool)
+	for _, point := range points {
+		steps[point.Step] = true
+	}
+	assert.Equal(t, map[float64]bool{5: true, 10: true, 12: true}, steps)
+
+	status := getJSON[Status](t, url+"api/status")
+	assert.False(t, status.Running)
+	assert.Equal(t, int64(12), status.GlobalStep)
+	assert.Equal(t, checkpoint.Dir(), status.Checkpoint)
+	assert.NotEmpty(t, status.Metrics)
+
+	summary := getJSON[Summary](t, url+"api/summary")
+	assert.Contains(t, summary.Params, Param{Scope: context.RootScope, Key: "activation", Value: "relu"})
+	var found bool
+	for _, v := range summary.Variables {
+		if v.Name == "/model/weights" {
+			found = true
+			assert.Equal(t, 4, v.Size)
+			assert.True(t, v.Trainable)
+		}
+	}
+	assert.True(t, found, "variable /model/weights not in summary")
+	assert.GreaterOrEqual(t, summary.NumParameters, 4)
+
+	// A new loop run doesn't carry over the stop request.
+	_, err = loop.RunSteps(datasets.NewConstantDataset(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, 15, loop.LoopStep)
+}
+
+func TestEvents(t *testing.T) {
+	_, loop := newTestLoop(t)
+	s, err := AttachToLoop(loop, "localhost:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	s.AddPoint(plots.Point{MetricName: "Train: Loss", MetricType: "loss", Step: 1, Value: 0.5})
+
+	response, err := http.Get(s.URL() + "events")
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+
+	// readEvent returns the next event name and data.
+	readEvent := func() (name, data string) {
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return
+			}
+			if value, found := strings.CutPrefix(line, "event: "); found {
+				name = value
+			} else if value, found := strings.CutPrefix(line, "data: "); found {
+				data = value
+			}
+		}
+	}
+
+	// Initial state.
+	name, _ := readEvent()
+	assert.Equal(t, eventReset, name)
+	name, data := readEvent()
+	assert.Equal(t, eventPoint, name)
+	var point plots.Point
+	require.NoError(t, json.Unmarshal([]byte(data), &point))
+	assert.Equal(t, 0.5, point.Value)
+	name, _ = readEvent()
+	assert.Equal(t, eventSummary, name)
+	name, _ = readEvent()
+	assert.Equal(t, eventStatus, name)
+
+	// Updates.
+	s.AddPoint(plots.Point{MetricName: "Train: Loss", MetricType: "loss", Step: 2, Value: 0.25})
+	name, data = readEvent()
+	assert.Equal(t, eventPoint, name)
+	require.NoError(t, json.Unmarshal([]byte(data), &point))
+	assert.Equal(t, 0.25, point.Value)
+
+	// No checkpoint configured.
+	assert.Equal(t, http.StatusBadRequest, post(t, s.URL()+"api/checkpoint", s.token, ""))
+}
+
+func TestRequireToken(t *testing.T) {
+	_, loop := newTestLoop(t)
+	s, err := AttachToLoop(loop, "localhost:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	require.Len(t, s.token, 32)
+	url := s.URL() + "api/stop"
+	ownOrigin := strings.TrimSuffix(s.URL(), "/")
+
+	// Rejected: missing or wrong token, or a request from another page.
+	assert.Equal(t, http.StatusForbidden, post(t, url, "", ""))
+	assert.Equal(t, http.StatusForbidden, post(t, url, "not-the-token", ownOrigin))
+	assert.Equal(t, http.StatusForbidden, post(t, url, s.token, "http://evil.example.com"))
+	assert.False(t, loop.StopRequested())
+
+	// Accepted: from the dashboard page.
+	assert.Equal(t, http.StatusAccepted, post(t, url, s.token, ownOrigin))
+	assert.True(t, loop.StopRequested())
+}
+
+func TestCheckHost(t *testing.T) {
+	_, loop := newTestLoop(t)
+	s, err := AttachToLoop(loop, "localhost:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	_, port, err := net.SplitHostPort(strings.TrimSuffix(strings.TrimPrefix(s.URL(), "http://"), "/"))
+	require.NoError(t, err)
+
+	// request sends a request to the Server with the given Host header, with the token and a matching Origin,
+	// as a page from that host could after rebinding its name to the dashboard address.
+	request := func(method, path, host string) int {
+		req, err := http.NewRequest(method, s.URL()+path, nil)
+		require.NoError(t, err)
+		req.Host = host
+		req.Header.Set(tokenHeader, s.token)
+		req.Header.Set("Origin", "http://"+host)
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+		return response.StatusCode
+	}
+
+	// Foreign host: all routes are rejected.
+	foreign := net.JoinHostPort("evil.example.com", port)
+	for _, path := range []string{"", "api/points", "api/status", "api/summary", "events"} {
+		assert.Equal(t, http.StatusForbidden, request(http.MethodGet, path, foreign), "path=%q", path)
+	}
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "api/stop", foreign))
+	assert.False(t, loop.StopRequested())
+
+	// Local and IP hosts are accepted.
+	for _, host := range []string{"localhost", "LOCALHOST:" + port, "127.0.0.1:" + port, "[::1]:" + port, "192.168.1.7"} {
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "api/status", host), "host=%q", host)
+	}
+
+	// Explicitly allowed host.
+	s.WithAllowedHosts("evil.example.com")
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "", foreign))
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "api/stop", foreign))
+	assert.True(t, loop.StopRequested())
+}
@@ -0,0 +1,244 @@
+package dashboard
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// Names of the server-sent events.
+const (
+	// eventReset is sent at the start of a connection, before all the points collected so far: a reconnecting
+	// page should clear its data.
+	eventReset   = "reset"
+	eventPoint   = "point"
+	eventStatus  = "status"
+	eventSummary = "summary"
+	eventMessage = "message"
+)
+
+const (
+	// tokenHeader is the HTTP header with the Server token, sent by the dashboard page in the requests that change
+	// the training.
+	tokenHeader = "X-Dashboard-Token"
+
+	// tokenPlaceholder in the page is replaced by the Server token when serving it.
+	tokenPlaceholder = "{{DASHBOARD_TOKEN}}"
+)
+
+// subscriberBufferSize is the number of events buffered per connected page. Pages that fall behind are
+// disconnected: they reconnect automatically, and receive the full history again.
+const subscriberBufferSize = 1024
+
+// encodeEvent encodes an SSE event with the data encoded as JSON.
+func encodeEvent(name string, data any) []byte {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		klog.Errorf("dashboard failed to encode %q event: %+v", name, err)
+		encoded = []byte("null")
+	}
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, encoded))
+}
+
+// broadcastLocked sends the encoded event to all connected pages. It must be called with s.mu locked.
+func (s *Server) broadcastLocked(event []byte) {
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Page is not keeping up: disconnect it, instead of blocking the training.
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// handler returns the HTTP handler with all the dashboard endpoints.
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /api/points", s.handlePoints)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/summary", s.handleSummary)
+	mux.HandleFunc("POST /api/checkpoint", s.requireToken(s.handleCheckpoint))
+	mux.HandleFunc("POST /api/stop", s.requireToken(s.handleStop))
+	return s.checkHost(mux)
+}
+
+// checkHost wraps the handler to reject requests whose Host header is not allowed, see isAllowedHost.
+// This protects against DNS rebinding: a page from another domain whose name resolves to the dashboard address
+// would otherwise be able to read the dashboard -- including the Server token.
+func (s *Server) checkHost(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAllowedHost(r.Host) {
+			writeJSON(w, http.StatusForbidden, fmt.Sprintf("host %q is not allowed, see Server.WithAllowedHosts", r.Host))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// isAllowedHost returns whether the host (with an optional port) of a request can be served: "localhost",
+// IP addresses (DNS rebinding requires a domain name), the host given to AttachToLoop, or one of the hosts
+// configured with WithAllowedHosts.
+func (s *Server) isAllowedHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.allowedHosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	})
+}
+
+// requireToken wraps the handler of a request that changes the training: it rejects requests from other origins
+// and requests without the Server token (see tokenHeader), which only the dashboard page served by this Server has.
+// This protects against cross-site requests from other pages open in the browser. The Host of the request, used
+// for the origin, is validated by checkHost.
+func (s *Server) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+			writeJSON(w, http.StatusForbidden, fmt.Sprintf("requests from origin %q are not allowed", origin))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(tokenHeader)), []byte(s.token)) != 1 {
+			writeJSON(w, http.StatusForbidden, "missing or invalid dashboard token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleIndex serves the dashboard page, with the Server token embedded.
+func (s *Server) handleIndex(w http.ResponseWriter, _ *http.Request) {
+	page, err := staticFiles.ReadFile("static/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page = bytes.ReplaceAll(page, []byte(tokenPlaceholder), []byte(s.token))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(page)
+}
+
+// handleEvents streams the dashboard events (SSE): first the current state, then the updates.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe and take the current state atomically, so no event is lost in between.
+	ch := make(chan []byte, subscriberBufferSize)
+	s.mu.Lock()
+	if s.closed.Load() {
+		s.mu.Unlock()
+		http.Error(w, "dashboard closed", http.StatusServiceUnavailable)
+		return
+	}
+	initial := [][]byte{encodeEvent(eventReset, nil)}
+	for _, point := range s.points {
+		initial = append(initial, encodeEvent(eventPoint, point))
+	}
+	initial = append(initial, encodeEvent(eventSummary, s.summary), encodeEvent(eventStatus, s.status))
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if _, found := s.subscribers[ch]; found {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	for _, event := range initial {
+		if _, err := w.Write(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeJSON writes the value as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		klog.Errorf("dashboard failed to write response: %+v", err)
+	}
+}
+
+func (s *Server) handlePoints(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.Points())
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleSummary(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	summary := s.summary
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleCheckpoint requests a checkpoint to be saved: it is saved after the current training step.
+func (s *Server) handleCheckpoint(w http.ResponseWriter, _ *http.Request) {
+	if s.checkpoint == nil {
+		writeJSON(w, http.StatusBadRequest, "no checkpoint configured")
+		return
+	}
+	s.saveRequested.Store(true)
+	writeJSON(w, http.StatusAccepted, "checkpoint will be saved after the current training step")
+}
+
+// handleStop requests the training loop to stop gracefully, see train.Loop.Stop.
+func (s *Server) handleStop(w http.ResponseWriter, _ *http.Request) {
+	s.loop.Stop()
+	s.message("Stop requested: training will stop after the current step.")
+	writeJSON(w, http.StatusAccepted, "training will stop after the current step")
+}
@@ -0,0 +1,167 @@
+package tensorboard
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// This file implements the encoding of the TensorBoard event files: records in the TFRecord format, each holding
+// an Event protocol buffer. The protos are encoded manually with protowire, so there is no dependency on
+// TensorFlow or TensorBoard generated code. Only the fields used are encoded, the field numbers are from:
+//
+//   - tensorflow/core/util/event.proto
+//   - tensorflow/core/framework/summary.proto
+//   - tensorboard/plugins/hparams/api.proto and plugin_data.proto
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC returns the masked CRC32C checksum used by the TFRecord format.
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, crc32cTable)
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
+
+// writeRecord writes data as one TFRecord: length, masked CRC of the length, data and masked CRC of the data.
+func writeRecord(w io.Writer, data []byte) error {
+	var header [12]byte
+	binary.LittleEndian.PutUint64(header[:8], uint64(len(data)))
+	binary.LittleEndian.PutUint32(header[8:], maskedCRC(header[:8]))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	var footer [4]byte
+	binary.LittleEndian.PutUint32(footer[:], maskedCRC(data))
+	_, err := w.Write(footer[:])
+	return err
+}
+
+// Helpers to append proto fields.
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendFloat(b []byte, num protowire.Number, v float32) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendPackedDoubles(b []byte, num protowire.Number, values []float64) []byte {
+	packed := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(v))
+	}
+	return appendBytes(b, num, packed)
+}
+
+// encodeEvent encodes an Event proto. Either fileVersion or summary should be set.
+func encodeEvent(wallTime float64, step int64, fileVersion string, summary []byte) []byte {
+	var b []byte
+	b = appendDouble(b, 1, wallTime)
+	if step != 0 {
+		b = appendVarint(b, 2, uint64(step))
+	}
+	if fileVersion != "" {
+		b = appendString(b, 3, fileVersion)
+	}
+	if summary != nil {
+		b = appendBytes(b, 5, summary)
+	}
+	return b
+}
+
+// encodeSummary encodes a Summary proto with the given (already encoded) Summary.Value protos.
+func encodeSummary(values ...[]byte) []byte {
+	var b []byte
+	for _, value := range values {
+		b = appendBytes(b, 1, value)
+	}
+	return b
+}
+
+// encodeScalarValue encodes a Summary.Value proto with a simple_value.
+func encodeScalarValue(tag string, value float64) []byte {
+	var b []byte
+	b = appendString(b, 1, tag)
+	return appendFloat(b, 2, float32(value))
+}
+
+// encodeHistogramValue encodes a Summary.Value proto with a HistogramProto.
+func encodeHistogramValue(tag string, h *histogram) []byte {
+	var histo []byte
+	histo = appendDouble(histo, 1, h.min)
+	histo = appendDouble(histo, 2, h.max)
+	histo = appendDouble(histo, 3, h.num)
+	histo = appendDouble(histo, 4, h.sum)
+	histo = appendDouble(histo, 5, h.sumSquares)
+	histo = appendPackedDoubles(histo, 6, h.bucketLimits)
+	histo = appendPackedDoubles(histo, 7, h.buckets)
+	var b []byte
+	b = appendString(b, 1, tag)
+	return appendBytes(b, 5, histo)
+}
+
+// encodeImageValue encodes a Summary.Value proto with a Summary.Image.
+func encodeImageValue(tag string, height, width, colorSpace int, encodedPNG []byte) []byte {
+	var img []byte
+	img = appendVarint(img, 1, uint64(height))
+	img = appendVarint(img, 2, uint64(width))
+	img = appendVarint(img, 3, uint64(colorSpace))
+	img = appendBytes(img, 4, encodedPNG)
+	var b []byte
+	b = appendString(b, 1, tag)
+	return appendBytes(b, 4, img)
+}
+
+// encodePluginValue encodes a Summary.Value proto with only SummaryMetadata for the given plugin and content.
+// This is how the hparams plugin data is stored.
+func encodePluginValue(tag, pluginName string, content []byte) []byte {
+	var pluginData []byte
+	pluginData = appendString(pluginData, 1, pluginName)
+	pluginData = appendBytes(pluginData, 2, content)
+	var metadata []byte
+	metadata = appendBytes(metadata, 1, pluginData)
+	var b []byte
+	b = appendString(b, 1, tag)
+	return appendBytes(b, 9, metadata)
+}
+
+// encodeProtobufValue encodes a google.protobuf.Value: value must be a float64, string or bool.
+func encodeProtobufValue(value any) []byte {
+	switch v := value.(type) {
+	case float64:
+		return appendDouble(nil, 2, v)
+	case string:
+		return appendString(nil, 3, v)
+	case bool:
+		var bv uint64
+		if v {
+			bv = 1
+		}
+		return appendVarint(nil, 4, bv)
+	}
+	return nil
+}
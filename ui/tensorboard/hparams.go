@@ -0,0 +1,157 @@
+package tensorboard
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/pkg/errors"
+)
+
+// Constants of the TensorBoard hparams plugin.
+const (
+	hparamsPluginName      = "hparams"
+	hparamsExperimentTag   = "_hparams_/experiment"
+	hparamsSessionStartTag = "_hparams_/session_start_info"
+	hparamsSessionEndTag   = "_hparams_/session_end_info"
+
+	// DataType enum of the HParamInfo proto.
+	hparamsTypeString  = 1
+	hparamsTypeBool    = 2
+	hparamsTypeFloat64 = 3
+
+	// Status enum of the SessionEndInfo proto.
+	hparamsStatusSuccess = 1
+)
+
+// hparamValue converts a hyperparameter value to one of the types supported by the hparams plugin:
+// float64, string or bool. Other values (e.g. slices) are converted to strings.
+func hparamValue(value any) any {
+	switch v := value.(type) {
+	case bool, string, float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// AddHParams writes the hyperparameters of this run, and the tags of the metrics to compare them by,
+// for the TensorBoard "HPARAMS" dashboard.
+//
+// The values must be numbers, strings or booleans; other values are converted to strings.
+// The metricTags should match the tags of scalars written with AddScalar.
+//
+// The run is marked as finished (successfully) when the Writer is closed.
+func (w *Writer) AddHParams(hparams map[string]any, metricTags ...string) error {
+	if len(hparams) == 0 {
+		return errors.New("tensorboard.Writer.AddHParams() requires at least one hyperparameter")
+	}
+	names := make([]string, 0, len(hparams))
+	for name := range hparams {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	values := make(map[string]any, len(hparams))
+	for _, name := range names {
+		values[name] = hparamValue(hparams[name])
+	}
+	now := float64(time.Now().UnixNano()) / 1e9
+
+	// Experiment: hyperparameters and metrics definitions.
+	var experiment []byte
+	experiment = appendDouble(experiment, 3, now)
+	for _, name := range names {
+		var info []byte
+		info = appendString(info, 1, name)
+		switch values[name].(type) {
+		case float64:
+			info = appendVarint(info, 4, hparamsTypeFloat64)
+		case bool:
+			info = appendVarint(info, 4, hparamsTypeBool)
+		default:
+			info = appendVarint(info, 4, hparamsTypeString)
+		}
+		experiment = appendBytes(experiment, 4, info)
+	}
+	for _, tag := range metricTags {
+		metricName := appendString(nil, 2, tag)
+		experiment = appendBytes(experiment, 5, appendBytes(nil, 1, metricName))
+	}
+
+	// Session start: the values of the hyperparameters.
+	var sessionStart []byte
+	for _, name := range names {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendBytes(entry, 2, encodeProtobufValue(values[name]))
+		sessionStart = appendBytes(sessionStart, 1, entry)
+	}
+	sessionStart = appendDouble(sessionStart, 5, now)
+
+	summary := encodeSummary(
+		encodePluginValue(hparamsExperimentTag, hparamsPluginName, appendBytes(nil, 2, experiment)),
+		encodePluginValue(hparamsSessionStartTag, hparamsPluginName, appendBytes(nil, 3, sessionStart)))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hparamsStarted = true
+	return w.writeSummaryLocked(0, summary)
+}
+
+// endHParamsSessionLocked writes the hparams session end info, if AddHParams was called. It must be called with
+// w.mu locked.
+func (w *Writer) endHParamsSessionLocked() error {
+	if !w.hparamsStarted {
+		return nil
+	}
+	w.hparamsStarted = false
+	var sessionEnd []byte
+	sessionEnd = appendVarint(sessionEnd, 1, hparamsStatusSuccess)
+	sessionEnd = appendDouble(sessionEnd, 2, float64(time.Now().UnixNano())/1e9)
+	summary := encodeSummary(
+		encodePluginValue(hparamsSessionEndTag, hparamsPluginName, appendBytes(nil, 4, sessionEnd)))
+	return w.writeSummaryLocked(0, summary)
+}
+
+// ContextHParams returns the hyperparameters of the context, in all scopes, as a map that can be given to
+// Writer.AddHParams. Parameters in sub-scopes are named "<scope>/<key>".
+//
+// Only values of types supported by the hparams plugin (numbers, strings and booleans) and slices of them are
+// included.
+func ContextHParams(ctx *context.Context) map[string]any {
+	hparams := make(map[string]any)
+	ctx.EnumerateParams(func(scope, key string, value any) {
+		switch value.(type) {
+		case int, int32, int64, uint, uint32, uint64, float32, float64, bool, string, []int, []float64, []string:
+		default:
+			return
+		}
+		name := key
+		if scope != context.RootScope {
+			name = context.JoinScope(scope, key)
+		}
+		hparams[name] = value
+	})
+	return hparams
+}
@@ -0,0 +1,304 @@
+package tensorboard
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/shapes"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
+	"github.com/gomlx/gomlx/ui/plots"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// ParamTensorBoard is the context parameter that can be used by models to trigger writing TensorBoard event
+	// files to the checkpoint directory. A boolean value that defaults to false.
+	ParamTensorBoard = "tensorboard"
+)
+
+// AttachToLoop creates a Writer in logDir (typically the checkpoint directory) and attaches it to the
+// training loop. At the end of the loop the metrics are collected, and the events are flushed.
+//
+// Configure it with the With* methods, and schedule the collection of metrics during training with
+// ScheduleEveryNSteps, ScheduleNTimes or ScheduleExponential. E.g.:
+//
+//	if context.GetParamOr(ctx, tensorboard.ParamTensorBoard, false) {
+//		tb, err := tensorboard.AttachToLoop(loop, checkpoint.Dir())
+//		if err != nil { ... }
+//		defer tb.Close()
+//		tb.WithDatasets(validationEvalDS).
+//			WithHParams().
+//			WithVariableHistograms().
+//			WithGradientHistograms().
+//			ScheduleExponential(100, 1.2)
+//	}
+//
+// Close the Writer when the training is finished.
+func AttachToLoop(loop *train.Loop, logDir string) (*Writer, error) {
+	w, err := New(logDir)
+	if err != nil {
+		return nil, err
+	}
+	w.loop = loop
+	loop.OnStart("tensorboard", 120, func(loop *train.Loop, _ train.Dataset) error {
+		if !w.withHParams {
+			return nil
+		}
+		w.withHParams = false // Only written once.
+		return w.AddHParams(ContextHParams(loop.Trainer.Context()), w.metricTags()...)
+	})
+	loop.OnEnd("tensorboard", 120, func(loop *train.Loop, metrics []*tensors.Tensor) error {
+		if w.scheduled {
+			if err := w.collect(loop, metrics); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+	return w, nil
+}
+
+// WithDatasets configures the datasets to evaluate at each collecting step (see `Schedule*` methods).
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithDatasets(datasets ...train.Dataset) *Writer {
+	w.evalDatasets = datasets
+	return w
+}
+
+// WithBatchNormalizationAveragesUpdate configures a dataset to use to update the averages (of mean and variance)
+// for batch normalization, before evaluating the datasets. See plots.AddTrainAndEvalMetrics.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithBatchNormalizationAveragesUpdate(oneEpochDS train.Dataset) *Writer {
+	w.batchNormAveragesDS = oneEpochDS
+	return w
+}
+
+// WithCustomMetricFn registers the given function to run at every step it collects metrics: the points it adds
+// (see plots.Plotter) are written as scalars. Only one function can be registered. Set to nil to reset.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithCustomMetricFn(fn plots.CustomMetricFn) *Writer {
+	w.customMetricFn = fn
+	return w
+}
+
+// WithHParams writes the hyperparameters of the trainer context (see ContextHParams) when the loop starts,
+// for the TensorBoard "HPARAMS" dashboard. They are compared by the train and eval metrics.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithHParams() *Writer {
+	w.withHParams = true
+	return w
+}
+
+// WithVariableHistograms writes the histograms of the trainable variables at each collecting step.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithVariableHistograms() *Writer {
+	w.variableHistograms = true
+	return w
+}
+
+// WithGradientHistograms writes the histograms of the gradients of the trainable variables at each collecting step.
+//
+// The gradients are summarized (into histogram buckets) in the training graph, at every training step, using
+// optimizers.ParamGradientsTracer: so it has to be configured before the training graph is built (before
+// training starts), and it only works with optimizers that support it (SGD and Adam).
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) WithGradientHistograms() *Writer {
+	if w.loop == nil {
+		klog.Errorf("tensorboard.Writer.WithGradientHistograms() requires the Writer to be attached to a train.Loop")
+		return w
+	}
+	if w.gradientHistograms {
+		return w
+	}
+	w.gradientHistograms = true
+	ctx := w.loop.Trainer.Context().InAbsPath(context.RootScope)
+	ctx.SetParam(optimizers.ParamGradientsTracer, gradientsTracer{})
+	w.loop.Trainer.OnExecCreation(func(exec *context.Exec, _ train.GraphType) {
+		w.attachToExec(exec)
+	})
+	return w
+}
+
+// ScheduleExponential collection of metrics, starting at `startStep` and with an increasing step factor
+// of `stepFactor`. Typical values where could be 100 and 1.1.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) ScheduleExponential(startStep int, stepFactor float64) *Writer {
+	w.scheduled = true
+	train.ExponentialCallback(w.loop, startStep, stepFactor, true, "tensorboard", 0, w.collect)
+	return w
+}
+
+// ScheduleNTimes collections of metrics during the loop.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) ScheduleNTimes(numPoints int) *Writer {
+	w.scheduled = true
+	train.NTimesDuringLoop(w.loop, numPoints, "tensorboard", 0, w.collect)
+	return w
+}
+
+// ScheduleEveryNSteps to collect metrics.
+//
+// It returns itself to allow cascading configuration method calls.
+func (w *Writer) ScheduleEveryNSteps(n int) *Writer {
+	w.scheduled = true
+	train.EveryNSteps(w.loop, n, "tensorboard", 0, w.collect)
+	return w
+}
+
+// metricTag returns the tag used for a metric: metrics are grouped by type.
+func metricTag(metricType, name string) string {
+	if metricType == "" {
+		return name
+	}
+	return metricType + "/" + name
+}
+
+// metricTags returns the tags of the train and eval metrics, as written by plots.AddTrainAndEvalMetrics.
+func (w *Writer) metricTags() []string {
+	var tags []string
+	for _, desc := range w.loop.Trainer.TrainMetrics() {
+		if desc.Name() == "Batch Loss" {
+			// Skipped by plots.AddTrainAndEvalMetrics.
+			continue
+		}
+		tags = append(tags, metricTag(desc.MetricType(), "Train: "+desc.Name()))
+	}
+	for _, ds := range w.evalDatasets {
+		for _, desc := range w.loop.Trainer.EvalMetrics() {
+			tags = append(tags, metricTag(desc.MetricType(), fmt.Sprintf("%s on %s", desc.Name(), ds.Name())))
+		}
+	}
+	return tags
+}
+
+// AddPoint implements plots.Plotter, and writes the point as a scalar.
+func (w *Writer) AddPoint(point plots.Point) {
+	// Errors are kept in the Writer, and reported by Flush.
+	_ = w.AddScalar(metricTag(point.MetricType, point.MetricName), int64(point.Step), point.Value)
+}
+
+// DynamicSampleDone implements plots.Plotter. It is a no-op.
+func (w *Writer) DynamicSampleDone(_ bool) {}
+
+// collect the metrics and histograms for the current step. It implements train.OnStepFn.
+func (w *Writer) collect(loop *train.Loop, metrics []*tensors.Tensor) error {
+	// Only collect once per step: multiple calls can happen if more than one schedule is configured.
+	step := loop.Trainer.GlobalStep()
+	if step <= w.lastStepCollected {
+		return nil
+	}
+	w.lastStepCollected = step
+
+	if w.customMetricFn != nil {
+		if err := w.customMetricFn(w, float64(step)); err != nil {
+			return errors.WithMessagef(err, "tensorboard.Writer CustomMetricFn returned an error at step %d", step)
+		}
+	}
+	if err := plots.AddTrainAndEvalMetrics(w, loop, metrics, w.evalDatasets, w.batchNormAveragesDS); err != nil {
+		return err
+	}
+
+	if w.variableHistograms {
+		for v := range loop.Trainer.Context().IterVariables() {
+			if !v.Trainable || !v.Shape().DType.IsFloat() {
+				continue
+			}
+			if err := w.AddHistogram("variables"+v.ScopeAndName(), step, v.Value()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.gradientHistograms {
+		w.mu.Lock()
+		gradients := maps.Clone(w.gradients)
+		w.mu.Unlock()
+		for _, name := range slices.Sorted(maps.Keys(gradients)) {
+			h := newHistogram(gradients[name])
+			if h == nil {
+				continue
+			}
+			if err := w.writeSummary(step, encodeSummary(encodeHistogramValue("gradients"+name, h))); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// gradientsLogPrefix is the prefix of the messages of the logged nodes with the gradients summaries.
+const gradientsLogPrefix = "#tensorboard_gradients:"
+
+// gradientsTracer implements optimizers.Tracer: it summarizes the gradients in the graph and marks the
+// summary to be logged, so it is captured by Writer.attachToExec.
+type gradientsTracer struct{}
+
+// Trace implements optimizers.Tracer.
+func (gradientsTracer) Trace(gradients *Node, scopes ...string) {
+	if !gradients.DType().IsFloat() {
+		return
+	}
+	summary := summaryGraph(gradients, DefaultHistogramBuckets)
+	summary.SetLogged(gradientsLogPrefix + strings.Join(scopes, context.ScopeSeparator))
+}
+
+// summaryGraph returns the summary of the values of x (see summarizeValues), computed in the graph.
+// Non-finite values are not excluded.
+func summaryGraph(x *Node, numBuckets int) *Node {
+	g := x.Graph()
+	x = Reshape(ConvertDType(x, dtypes.Float32), -1)
+	minV, maxV := ReduceAllMin(x), ReduceAllMax(x)
+	count := Scalar(g, dtypes.Float32, x.Shape().Size())
+	header := Stack([]*Node{minV, maxV, count, ReduceAllSum(x), ReduceAllSum(Square(x))}, 0)
+
+	width := DivScalar(Sub(maxV, minV), float64(numBuckets))
+	width = Where(GreaterThan(width, ScalarZero(g, dtypes.Float32)), width, OnesLike(width))
+	indices := ConvertDType(Floor(Div(Sub(x, minV), width)), dtypes.Int32)
+	indices = ClipScalar(indices, 0, float64(numBuckets-1))
+	counts := ScatterSum(Zeros(g, shapes.Make(dtypes.Float32, numBuckets)), InsertAxes(indices, -1), OnesLike(x),
+		false, false)
+	return ConvertDType(Concatenate([]*Node{header, counts}, 0), dtypes.Float64)
+}
+
+// attachToExec sets a node logger on the executor that captures the gradients summaries, and passes
+// along any other logged nodes to the previous logger.
+func (w *Writer) attachToExec(exec *context.Exec) {
+	prevLoggerFn := exec.GetNodeLogger()
+	exec.SetNodeLogger(func(g *Graph, messages []string, values []*tensors.Tensor, nodes []NodeId) {
+		var otherMessages []string
+		var otherValues []*tensors.Tensor
+		var otherNodes []NodeId
+		for ii, msg := range messages {
+			name, found := strings.CutPrefix(msg, gradientsLogPrefix)
+			if !found {
+				otherMessages = append(otherMessages, msg)
+				otherValues = append(otherValues, values[ii])
+				otherNodes = append(otherNodes, nodes[ii])
+				continue
+			}
+			summary := tensors.CopyFlatData[float64](values[ii])
+			w.mu.Lock()
+			w.gradients[name] = summary
+			w.mu.Unlock()
+		}
+		if prevLoggerFn != nil && len(otherMessages) > 0 {
+			prevLoggerFn(g, otherMessages, otherValues, otherNodes)
+		}
+	})
+}
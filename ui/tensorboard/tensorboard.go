@@ -0,0 +1,393 @@
+// Package tensorboard writes TensorBoard event files ("events.out.tfevents.*"), so training can be monitored
+// with the standard TensorBoard tooling (`tensorboard --logdir=<dir>`).
+//
+// It supports scalars, histograms, images and hyperparameters (the "HPARAMS" dashboard). It has no dependency
+// on TensorFlow or TensorBoard: the records and protocol buffers are encoded directly.
+//
+// The Writer can be used directly (see New), or attached to a train.Loop to collect train and eval metrics,
+// histograms of the variables and of their gradients, and the hyperparameters of the model -- see AttachToLoop.
+package tensorboard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/pkg/support/fsutil"
+	"github.com/gomlx/gomlx/ui/plots"
+	"github.com/gomlx/gopjrt/dtypes"
+	"github.com/gomlx/gopjrt/dtypes/bfloat16"
+	"github.com/pkg/errors"
+	"github.com/x448/float16"
+)
+
+// FileNamePrefix of the event files created by the Writer.
+const FileNamePrefix = "events.out.tfevents."
+
+// DefaultHistogramBuckets is the number of buckets used by histograms.
+const DefaultHistogramBuckets = 30
+
+// Writer of TensorBoard event files. Create it with New or AttachToLoop.
+//
+// It is safe for concurrent use.
+type Writer struct {
+	mu       sync.Mutex
+	filePath string
+	file     *os.File
+	buf      *bufio.Writer
+	err      error // First error writing to the file.
+
+	hparamsStarted bool
+
+	// Attributes used when attached to a train.Loop.
+	loop                *train.Loop
+	evalDatasets        []train.Dataset
+	batchNormAveragesDS train.Dataset
+	customMetricFn      plots.CustomMetricFn
+	variableHistograms  bool
+	gradientHistograms  bool
+	gradients           map[string][]float64 // Latest gradients summaries, by variable ScopeAndName.
+	withHParams         bool
+	scheduled           bool
+	lastStepCollected   int64
+}
+
+// New creates a Writer of a new event file in the logDir directory, which is created if it doesn't exist.
+// A "~" prefix is expanded to the user's home directory.
+//
+// TensorBoard reads all event files in a directory as one "run", and each subdirectory of the --logdir as
+// a separate run.
+func New(logDir string) (*Writer, error) {
+	logDir, err := fsutil.ReplaceTildeInDir(logDir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(logDir, 0o777); err != nil {
+		return nil, errors.Wrapf(err, "failed to create TensorBoard log directory %q", logDir)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	now := time.Now()
+	filePath := path.Join(logDir, fmt.Sprintf("%s%010d.%s", FileNamePrefix, now.Unix(), hostname))
+	for ii := 1; fsutil.MustFileExists(filePath); ii++ {
+		// Files created in the same second: add a suffix.
+		filePath = path.Join(logDir, fmt.Sprintf("%s%010d.%s.%d", FileNamePrefix, now.Unix(), hostname, ii))
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create TensorBoard event file %q", filePath)
+	}
+	w := &Writer{
+		filePath:          filePath,
+		file:              f,
+		buf:               bufio.NewWriter(f),
+		gradients:         make(map[string][]float64),
+		lastStepCollected: -1,
+	}
+	// The first event of the file is the version.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.writeRecordLocked(encodeEvent(wallTime(now), 0, "brain.Event:2", nil))
+	if err = w.flushLocked(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// FilePath returns the path of the event file being written.
+func (w *Writer) FilePath() string {
+	return w.filePath
+}
+
+func wallTime(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// writeRecordLocked writes one record to the file. It must be called with w.mu locked.
+// Errors are stored in w.err, and after the first error nothing else is written.
+func (w *Writer) writeRecordLocked(data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.file == nil {
+		w.err = errors.Errorf("tensorboard.Writer for %q already closed", w.filePath)
+		return w.err
+	}
+	if err := writeRecord(w.buf, data); err != nil {
+		w.err = errors.Wrapf(err, "failed to write to TensorBoard event file %q", w.filePath)
+	}
+	return w.err
+}
+
+// writeSummaryLocked writes an event with the given encoded Summary proto. It must be called with w.mu locked.
+func (w *Writer) writeSummaryLocked(step int64, summary []byte) error {
+	return w.writeRecordLocked(encodeEvent(wallTime(time.Now()), step, "", summary))
+}
+
+// writeSummary writes an event with the given encoded Summary proto.
+func (w *Writer) writeSummary(step int64, summary []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeSummaryLocked(step, summary)
+}
+
+// AddScalar writes the value of a scalar at the given step. Tags can be grouped using "/", e.g.: "loss/train".
+func (w *Writer) AddScalar(tag string, step int64, value float64) error {
+	return w.writeSummary(step, encodeSummary(encodeScalarValue(tag, value)))
+}
+
+// AddHistogram writes the histogram of the values of the tensor at the given step.
+// The tensor must be of a numeric (non-complex) dtype. Non-finite values (NaN, ±Inf) are ignored.
+func (w *Writer) AddHistogram(tag string, step int64, values *tensors.Tensor) error {
+	flat, err := tensorToFloat64s(values)
+	if err != nil {
+		return errors.WithMessagef(err, "tensorboard.Writer.AddHistogram(%q)", tag)
+	}
+	return w.AddHistogramValues(tag, step, flat)
+}
+
+// AddHistogramValues writes the histogram of the given values at the given step.
+// Non-finite values (NaN, ±Inf) are ignored.
+func (w *Writer) AddHistogramValues(tag string, step int64, values []float64) error {
+	h := newHistogram(summarizeValues(values, DefaultHistogramBuckets))
+	if h == nil {
+		// No finite values.
+		return nil
+	}
+	return w.writeSummary(step, encodeSummary(encodeHistogramValue(tag, h)))
+}
+
+// AddImage writes an image given as a tensor shaped [height, width] (grayscale) or [height, width, channels],
+// with 1 (grayscale), 3 (RGB) or 4 (RGBA) channels.
+//
+// Images of dtype Uint8 are used as is, images of float dtypes are expected to be in the range [0, 1],
+// and are clipped to it.
+func (w *Writer) AddImage(tag string, step int64, img *tensors.Tensor) error {
+	shape := img.Shape()
+	channels := 1
+	switch {
+	case shape.Rank() == 3 && slices.Contains([]int{1, 3, 4}, shape.Dimensions[2]):
+		channels = shape.Dimensions[2]
+	case shape.Rank() == 2:
+	default:
+		return errors.Errorf("tensorboard.Writer.AddImage(%q): image must be shaped [height, width] or "+
+			"[height, width, channels] with channels 1, 3 or 4, got %s", tag, shape)
+	}
+	height, width := shape.Dimensions[0], shape.Dimensions[1]
+	var pixels []uint8
+	if shape.DType == dtypes.Uint8 {
+		tensors.ConstFlatData(img, func(flat []uint8) {
+			pixels = append([]uint8(nil), flat...)
+		})
+	} else if shape.DType.IsFloat() {
+		flat, err := tensorToFloat64s(img)
+		if err != nil {
+			return errors.WithMessagef(err, "tensorboard.Writer.AddImage(%q)", tag)
+		}
+		pixels = make([]uint8, len(flat))
+		for ii, v := range flat {
+			if math.IsNaN(v) {
+				v = 0
+			}
+			pixels[ii] = uint8(math.Round(min(max(v, 0), 1) * 255))
+		}
+	} else {
+		return errors.Errorf("tensorboard.Writer.AddImage(%q): image dtype must be Uint8 or float, got %s",
+			tag, shape.DType)
+	}
+
+	var goImg image.Image
+	var colorSpace int
+	switch channels {
+	case 1:
+		gray := image.NewGray(image.Rect(0, 0, width, height))
+		copy(gray.Pix, pixels)
+		goImg, colorSpace = gray, 1
+	case 3:
+		rgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for ii := range height * width {
+			rgba.Pix[ii*4], rgba.Pix[ii*4+1], rgba.Pix[ii*4+2] = pixels[ii*3], pixels[ii*3+1], pixels[ii*3+2]
+			rgba.Pix[ii*4+3] = 255
+		}
+		goImg, colorSpace = rgba, 3
+	case 4:
+		rgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+		copy(rgba.Pix, pixels)
+		goImg, colorSpace = rgba, 4
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, goImg); err != nil {
+		return errors.Wrapf(err, "tensorboard.Writer.AddImage(%q): failed to encode PNG", tag)
+	}
+	return w.writeSummary(step, encodeSummary(encodeImageValue(tag, height, width, colorSpace, encoded.Bytes())))
+}
+
+// flushLocked flushes the buffered events to the file. It must be called with w.mu locked.
+func (w *Writer) flushLocked() error {
+	if w.err != nil || w.file == nil {
+		return w.err
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.err = errors.Wrapf(err, "failed to write to TensorBoard event file %q", w.filePath)
+	}
+	return w.err
+}
+
+// Flush the events written so far to the file. It returns the first error that happened while writing, if any.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+// Close the event file. If hyperparameters were written (AddHParams), the run is marked as finished.
+// It returns the first error that happened while writing, if any.
+//
+// It is a no-op if the Writer is already closed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return w.err
+	}
+	_ = w.endHParamsSessionLocked()
+	_ = w.flushLocked()
+	if err := w.file.Close(); err != nil && w.err == nil {
+		w.err = errors.Wrapf(err, "failed to close TensorBoard event file %q", w.filePath)
+	}
+	w.file = nil
+	return w.err
+}
+
+// tensorToFloat64s converts the flat values of a tensor of a numeric (non-complex) dtype to float64.
+func tensorToFloat64s(t *tensors.Tensor) (values []float64, err error) {
+	t.ConstFlatData(func(flatAny any) {
+		switch flat := flatAny.(type) {
+		case []float64:
+			values = append([]float64(nil), flat...)
+		case []float32:
+			values = convertFlat(flat)
+		case []float16.Float16:
+			values = make([]float64, len(flat))
+			for ii, v := range flat {
+				values[ii] = float64(v.Float32())
+			}
+		case []bfloat16.BFloat16:
+			values = make([]float64, len(flat))
+			for ii, v := range flat {
+				values[ii] = float64(v.Float32())
+			}
+		case []int:
+			values = convertFlat(flat)
+		case []int8:
+			values = convertFlat(flat)
+		case []int16:
+			values = convertFlat(flat)
+		case []int32:
+			values = convertFlat(flat)
+		case []int64:
+			values = convertFlat(flat)
+		case []uint8:
+			values = convertFlat(flat)
+		case []uint16:
+			values = convertFlat(flat)
+		case []uint32:
+			values = convertFlat(flat)
+		case []uint64:
+			values = convertFlat(flat)
+		default:
+			err = errors.Errorf("tensor dtype %s not supported", t.DType())
+		}
+	})
+	return
+}
+
+func convertFlat[T int | int8 | int16 | int32 | int64 | uint8 | uint16 | uint32 | uint64 | float32](flat []T) []float64 {
+	values := make([]float64, len(flat))
+	for ii, v := range flat {
+		values[ii] = float64(v)
+	}
+	return values
+}
+
+// Summaries are vectors with the statistics of a set of values used to build histograms:
+// [min, max, count, sum, sum of squares, counts of each of the numBuckets buckets...].
+// The buckets have equal width, from min to max.
+// They can be computed on host (summarizeValues) or in the graph (summaryGraph).
+const summaryHeaderLen = 5
+
+// summarizeValues returns the summary of the finite values, using numBuckets buckets.
+func summarizeValues(values []float64, numBuckets int) []float64 {
+	summary := make([]float64, summaryHeaderLen+numBuckets)
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		minV, maxV = min(minV, v), max(maxV, v)
+		summary[2]++
+		summary[3] += v
+		summary[4] += v * v
+	}
+	summary[0], summary[1] = minV, maxV
+	if summary[2] == 0 {
+		return summary
+	}
+	width := (maxV - minV) / float64(numBuckets)
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		idx := 0
+		if width > 0 {
+			idx = min(int((v-minV)/width), numBuckets-1)
+		}
+		summary[summaryHeaderLen+idx]++
+	}
+	return summary
+}
+
+// histogram holds the fields of the HistogramProto.
+type histogram struct {
+	min, max, num, sum, sumSquares float64
+	bucketLimits, buckets          []float64
+}
+
+// newHistogram creates the histogram from a summary. It returns nil if there were no (finite) values.
+func newHistogram(summary []float64) *histogram {
+	count := summary[2]
+	if count == 0 || math.IsNaN(summary[0]) || math.IsInf(summary[0], 0) || math.IsInf(summary[1], 0) {
+		return nil
+	}
+	h := &histogram{min: summary[0], max: summary[1], num: count, sum: summary[3], sumSquares: summary[4]}
+	counts := summary[summaryHeaderLen:]
+	if h.min == h.max {
+		// All values are the same: one bucket.
+		h.bucketLimits = []float64{h.max}
+		h.buckets = []float64{count}
+		return h
+	}
+	numBuckets := len(counts)
+	width := (h.max - h.min) / float64(numBuckets)
+	h.bucketLimits = make([]float64, numBuckets)
+	h.buckets = make([]float64, numBuckets)
+	for ii := range numBuckets {
+		h.bucketLimits[ii] = h.min + float64(ii+1)*width
+		h.buckets[ii] = counts[ii]
+	}
+	h.bucketLimits[numBuckets-1] = h.max
+	return h
+}
@@ -0,0 +1,265 @@
+package tensorboard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/gomlx/gomlx/pkg/core/graph"
+	"github.com/gomlx/gomlx/pkg/core/graph/graphtest"
+	"github.com/gomlx/gomlx/pkg/core/tensors"
+	"github.com/gomlx/gomlx/pkg/ml/context"
+	"github.com/gomlx/gomlx/pkg/ml/datasets"
+	"github.com/gomlx/gomlx/pkg/ml/train"
+	"github.com/gomlx/gomlx/pkg/ml/train/optimizers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	_ "github.com/gomlx/gomlx/backends/default"
+)
+
+// protoFields is a minimal decoding of a proto message: field number to its raw values.
+// Varint and fixed values are stored as uint64, bytes as []byte.
+type protoFields map[protowire.Number][]any
+
+func parseProto(t *testing.T, b []byte) protoFields {
+	fields := make(protoFields)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		var value any
+		switch typ {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			value = uint64(v)
+		case protowire.Fixed64Type:
+			value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected proto wire type %d", typ)
+		}
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		fields[num] = append(fields[num], value)
+	}
+	return fields
+}
+
+func (f protoFields) bytes(num protowire.Number) []byte {
+	if len(f[num]) == 0 {
+		return nil
+	}
+	return f[num][0].([]byte)
+}
+
+func (f protoFields) double(num protowire.Number) float64 {
+	return math.Float64frombits(f[num][0].(uint64))
+}
+
+// eventValue is a decoded Summary.Value of an event.
+type eventValue struct {
+	step   int64
+	tag    string
+	fields protoFields
+}
+
+// readEvents reads all records of the event file, checking the CRCs, and returns the file version and the
+// summary values.
+func readEvents(t *testing.T, filePath string) (fileVersion string, values []eventValue) {
+	contents, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	r := bytes.NewReader(contents)
+	for {
+		var header [12]byte
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, maskedCRC(header[:8]), binary.LittleEndian.Uint32(header[8:]))
+		data := make([]byte, binary.LittleEndian.Uint64(header[:8]))
+		_, err = io.ReadFull(r, data)
+		require.NoError(t, err)
+		var footer [4]byte
+		_, err = io.ReadFull(r, footer[:])
+		require.NoError(t, err)
+		require.Equal(t, maskedCRC(data), binary.LittleEndian.Uint32(footer[:]))
+
+		event := parseProto(t, data)
+		if version := event.bytes(3); version != nil {
+			fileVersion = string(version)
+			continue
+		}
+		var step int64
+		if len(event[2]) > 0 {
+			step = int64(event[2][0].(uint64))
+		}
+		summary := parseProto(t, event.bytes(5))
+		for _, valueAny := range summary[1] {
+			value := parseProto(t, valueAny.([]byte))
+			values = append(values, eventValue{step: step, tag: string(value.bytes(1)), fields: value})
+		}
+	}
+	return
+}
+
+func findValues(values []eventValue, tagPrefix string) []eventValue {
+	var found []eventValue
+	for _, v := range values {
+		if strings.HasPrefix(v.tag, tagPrefix) {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(dir)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(filepath.Base(w.FilePath()), FileNamePrefix))
+
+	require.NoError(t, w.AddScalar("loss/train", 10, 0.5))
+	require.NoError(t, w.AddHistogramValues("weights", 10, []float64{1, 2, 2, 3, math.NaN(), 4}))
+	require.NoError(t, w.AddHistogram("constant", 10, tensors.FromValue([]float32{7, 7, 7})))
+	require.NoError(t, w.AddImage("image", 20, tensors.FromValue([][][]float32{
+		{{0, 0, 0}, {1, 1, 1}, {1, 0, 0}},
+		{{0, 1, 0}, {0, 0, 1}, {0.5, 0.5, 0.5}}})))
+	require.Error(t, w.AddImage("bad_image", 20, tensors.FromValue([]float32{1, 2})))
+	require.NoError(t, w.AddHParams(map[string]any{"learning_rate": 0.01, "activation": "relu", "layers": 2},
+		"loss/train"))
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+	require.Error(t, w.AddScalar("loss/train", 11, 0.4))
+
+	fileVersion, values := readEvents(t, w.FilePath())
+	assert.Equal(t, "brain.Event:2", fileVersion)
+
+	scalars := findValues(values, "loss/train")
+	require.Len(t, scalars, 1)
+	assert.Equal(t, int64(10), scalars[0].step)
+	assert.Equal(t, float32(0.5), math.Float32frombits(uint32(scalars[0].fields[2][0].(uint64))))
+
+	histograms := findValues(values, "weights")
+	require.Len(t, histograms, 1)
+	histo := parseProto(t, histograms[0].fields.bytes(5))
+	assert.Equal(t, 1.0, histo.double(1))  // min
+	assert.Equal(t, 4.0, histo.double(2))  // max
+	assert.Equal(t, 5.0, histo.double(3))  // num, NaN is ignored.
+	assert.Equal(t, 12.0, histo.double(4)) // sum
+	assert.Equal(t, 34.0, histo.double(5)) // sum of squares
+	buckets := histo.bytes(7)
+	require.Len(t, buckets, 8*DefaultHistogramBuckets)
+	var total float64
+	for ii := range DefaultHistogramBuckets {
+		total += math.Float64frombits(binary.LittleEndian.Uint64(buckets[ii*8:]))
+	}
+	assert.Equal(t, 5.0, total)
+
+	histograms = findValues(values, "constant")
+	require.Len(t, histograms, 1)
+	histo = parseProto(t, histograms[0].fields.bytes(5))
+	assert.Len(t, histo.bytes(7), 8, "constant values should have only one bucket")
+
+	images := findValues(values, "image")
+	require.Len(t, images, 1)
+	img := parseProto(t, images[0].fields.bytes(4))
+	assert.Equal(t, uint64(2), img[1][0]) // height
+	assert.Equal(t, uint64(3), img[2][0]) // width
+	assert.Equal(t, uint64(3), img[3][0]) // colorspace
+	decoded, err := png.Decode(bytes.NewReader(img.bytes(4)))
+	require.NoError(t, err)
+	assert.Equal(t, 3, decoded.Bounds().Dx())
+	assert.Equal(t, 2, decoded.Bounds().Dy())
+	r, g, b, _ := decoded.At(0, 1).RGBA()
+	assert.Equal(t, []uint32{0, 0xFFFF, 0}, []uint32{r, g, b})
+
+	for _, tag := range []string{hparamsExperimentTag, hparamsSessionStartTag, hparamsSessionEndTag} {
+		hparamsValues := findValues(values, tag)
+		require.Len(t, hparamsValues, 1, "tag %q", tag)
+		pluginData := parseProto(t, parseProto(t, hparamsValues[0].fields.bytes(9)).bytes(1))
+		assert.Equal(t, hparamsPluginName, string(pluginData.bytes(1)))
+	}
+	experimentValue := findValues(values, hparamsExperimentTag)[0]
+	pluginData := parseProto(t, parseProto(t, experimentValue.fields.bytes(9)).bytes(1))
+	experiment := parseProto(t, parseProto(t, pluginData.bytes(2)).bytes(2))
+	require.Len(t, experiment[4], 3) // HParamInfo
+	require.Len(t, experiment[5], 1) // MetricInfo
+	firstHParam := parseProto(t, experiment[4][0].([]byte))
+	assert.Equal(t, "activation", string(firstHParam.bytes(1)))
+	assert.Equal(t, uint64(hparamsTypeString), firstHParam[4][0])
+}
+
+func TestAttachToLoop(t *testing.T) {
+	backend := graphtest.BuildTestBackend()
+	ctx := context.New()
+	ctx.SetParam("activation", "relu")
+	ctx.In("model").SetParam("num_layers", 3)
+	modelFn := func(ctx *context.Context, spec any, inputs []*Node) []*Node {
+		g := inputs[0].Graph()
+		weights := ctx.In("model").VariableWithValue("weights", []float32{1, 2, 3, 4}).ValueGraph(g)
+		train.AddLoss(ctx, ReduceAllSum(Square(weights)))
+		return nil
+	}
+	optimizer := optimizers.StochasticGradientDescent().WithDecay(false).WithLearningRate(0.01).Done()
+	trainer := train.NewTrainer(backend, ctx, modelFn, nil, optimizer, nil, nil)
+	loop := train.NewLoop(trainer)
+
+	dir := t.TempDir()
+	w, err := AttachToLoop(loop, dir)
+	require.NoError(t, err)
+	w.WithHParams().WithVariableHistograms().WithGradientHistograms().ScheduleEveryNSteps(5)
+	_, err = loop.RunSteps(datasets.NewConstantDataset(), 12)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, values := readEvents(t, w.FilePath())
+	var trainScalars []eventValue
+	for _, v := range values {
+		if strings.Contains(v.tag, "Train: ") {
+			trainScalars = append(trainScalars, v)
+		}
+	}
+	// Collected at steps 5, 10 and at the end (12).
+	require.NotEmpty(t, trainScalars)
+	steps := make(map[int64]bool)
+	for _, v := range trainScalars {
+		steps[v.step] = true
+	}
+	assert.Equal(t, map[int64]bool{5: true, 10: true, 12: true}, steps)
+
+	variables := findValues(values, "variables/model/weights")
+	require.Len(t, variables, 3)
+	gradients := findValues(values, "gradients/model/weights")
+	require.Len(t, gradients, 3)
+	// The gradient of the loss is 2*weights: the last one should be close to 2*[1, 2, 3, 4]*(1-0.02)^11.
+	histo := parseProto(t, gradients[2].fields.bytes(5))
+	factor := 2 * math.Pow(0.98, 11)
+	assert.InDelta(t, 1*factor, histo.double(1), 1e-3) // min
+	assert.InDelta(t, 4*factor, histo.double(2), 1e-3) // max
+	assert.Equal(t, 4.0, histo.double(3))              // num
+
+	require.Len(t, findValues(values, hparamsSessionStartTag), 1)
+	startValue := findValues(values, hparamsSessionStartTag)[0]
+	pluginData := parseProto(t, parseProto(t, startValue.fields.bytes(9)).bytes(1))
+	sessionStart := parseProto(t, parseProto(t, pluginData.bytes(2)).bytes(3))
+	var names []string
+	for _, entry := range sessionStart[1] {
+		names = append(names, string(parseProto(t, entry.([]byte)).bytes(1)))
+	}
+	assert.Contains(t, names, "activation")
+	assert.Contains(t, names, "/model/num_layers")
+	require.Len(t, findValues(values, hparamsSessionEndTag), 1)
+}